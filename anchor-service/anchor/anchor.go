@@ -0,0 +1,291 @@
+// Package anchor proves when files turned up in a directory by recording
+// their SHA-256 on the blockchain. The chain's transactions carry no data, so
+// a file is anchored by paying a token amount to its hash as if it were an
+// address, which no key can ever spend from; the block holding that payment
+// shows the file existed by the time the block was mined.
+package anchor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/client"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+// DefaultAmount is what each anchor pays to the file's hash: the smallest
+// amount a transaction's ID tells apart from zero
+const DefaultAmount = 0.000001
+
+// Anchorer watches a directory and anchors the files that turn up in it
+type Anchorer struct {
+	dir     string
+	store   *Store
+	node    *client.Client
+	wallet  *wallet.Wallet
+	amount  float64
+	pending map[string]file // files that changed since they were last seen, hashed once they hold still
+}
+
+// New returns an Anchorer for dir, paying amount from w through node for each
+// anchor and keeping track of them in store
+func New(dir string, store *Store, node *client.Client, w *wallet.Wallet, amount float64) *Anchorer {
+	return &Anchorer{dir: dir, store: store, node: node, wallet: w, amount: amount, pending: map[string]file{}}
+}
+
+// Address returns the address anchors are paid from
+func (a *Anchorer) Address() string {
+	return a.wallet.Address()
+}
+
+// Run scans the directory straight away and then every interval until ctx is done
+func (a *Anchorer) Run(ctx context.Context, interval time.Duration) {
+	for {
+		if err := a.Scan(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("scan failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Scan looks for new and changed files, hashing each once its size and
+// modification time are the same as on the scan before, so files still being
+// written are left until they are finished. It then submits anchors for new
+// contents and checks on those waiting to be mined. Hidden files and
+// directories are skipped.
+func (a *Anchorer) Scan(ctx context.Context) error {
+	seen, err := a.walk()
+	if err != nil {
+		return err
+	}
+	for _, name := range a.settled(seen) {
+		sum, err := hashFile(filepath.Join(a.dir, filepath.FromSlash(name)))
+		if err != nil {
+			log.Printf("%s: %v", name, err)
+			continue
+		}
+		f := seen[name]
+		f.SHA256 = sum
+		if err := a.store.update(func(st *state) {
+			st.Files[name] = f
+			an, ok := st.Anchors[sum]
+			if !ok {
+				an = &Anchor{SHA256: sum, Size: f.Size}
+				st.Anchors[sum] = an
+			}
+			if !slices.Contains(an.Files, name) {
+				an.Files = append(an.Files, name)
+			}
+		}); err != nil {
+			return err
+		}
+		log.Printf("%s has SHA-256 %s", name, sum)
+	}
+	if gone := a.gone(seen); len(gone) > 0 {
+		// Forget them, so they are hashed again if they come back
+		if err := a.store.update(func(st *state) {
+			for _, name := range gone {
+				delete(st.Files, name)
+			}
+		}); err != nil {
+			return err
+		}
+	}
+
+	spent := 0.0
+	for _, an := range a.store.Anchors() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		switch {
+		case an.Confirmed():
+		case an.TxID != "":
+			err = a.confirm(ctx, an)
+		default:
+			err = a.submit(ctx, an, &spent)
+		}
+		if err != nil {
+			log.Printf("anchor of %s: %v", an.SHA256, err)
+		}
+	}
+	return nil
+}
+
+// walk lists the regular files under the directory, by slash-separated path
+// relative to it
+func (a *Anchorer) walk() (map[string]file, error) {
+	seen := map[string]file{}
+	err := filepath.WalkDir(a.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != a.dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // removed since it was listed
+		}
+		rel, err := filepath.Rel(a.dir, path)
+		if err != nil {
+			return err
+		}
+		seen[filepath.ToSlash(rel)] = file{Size: info.Size(), ModTime: info.ModTime()}
+		return nil
+	})
+	return seen, err
+}
+
+// settled returns the files that have changed since they were hashed but not
+// since the last scan, remembering the others to check next time
+func (a *Anchorer) settled(seen map[string]file) []string {
+	a.store.mu.Lock()
+	known := a.store.state.Files
+	var ready []string
+	for name, f := range seen {
+		if k, ok := known[name]; ok && k.Size == f.Size && k.ModTime.Equal(f.ModTime) {
+			delete(a.pending, name)
+			continue
+		}
+		if p, ok := a.pending[name]; ok && p.Size == f.Size && p.ModTime.Equal(f.ModTime) {
+			delete(a.pending, name)
+			ready = append(ready, name)
+			continue
+		}
+		a.pending[name] = f
+	}
+	a.store.mu.Unlock()
+
+	for name := range a.pending {
+		if _, ok := seen[name]; !ok {
+			delete(a.pending, name)
+		}
+	}
+	slices.Sort(ready)
+	return ready
+}
+
+// gone returns the files hashed before that are no longer there
+func (a *Anchorer) gone(seen map[string]file) []string {
+	a.store.mu.Lock()
+	defer a.store.mu.Unlock()
+
+	var gone []string
+	for name := range a.store.state.Files {
+		if _, ok := seen[name]; !ok {
+			gone = append(gone, name)
+		}
+	}
+	return gone
+}
+
+// submit sends the transaction anchoring some contents, unless they were
+// anchored already, as when the store was lost. spent counts what this scan
+// has paid so far, so the wallet's confirmed balance isn't counted twice.
+func (a *Anchorer) submit(ctx context.Context, an Anchor, spent *float64) error {
+	if p, err := Verify(ctx, a.node, an.SHA256); err == nil {
+		log.Printf("%s was already anchored at height %d", an.SHA256, p.Height)
+		return a.store.update(func(st *state) {
+			s := st.Anchors[an.SHA256]
+			s.TxID, s.Height, s.BlockHash, s.BlockTime, s.Error = p.TxID, p.Height, p.Block.Hash, p.Block.Timestamp, ""
+		})
+	}
+
+	err := a.pay(ctx, an.SHA256, spent)
+	return a.store.update(func(st *state) {
+		s := st.Anchors[an.SHA256]
+		if err != nil {
+			s.Error = err.Error()
+			return
+		}
+		s.Error = ""
+	})
+}
+
+// pay sends amount to sum from the wallet and records the transaction
+func (a *Anchorer) pay(ctx context.Context, sum string, spent *float64) error {
+	balance, err := a.node.Balance(ctx, a.Address())
+	if err != nil {
+		return err
+	}
+	if balance-*spent < a.amount {
+		return fmt.Errorf("wallet %s has %g, not enough to pay %g", a.Address(), balance-*spent, a.amount)
+	}
+	tx := transaction.New(a.Address(), sum, a.amount)
+	if err := tx.Sign(a.wallet.PrivateKey); err != nil {
+		return err
+	}
+	if _, err := a.node.SubmitTransaction(ctx, tx); err != nil {
+		return err
+	}
+	*spent += a.amount
+	log.Printf("anchoring %s in transaction %s", sum, tx.ID)
+	return a.store.update(func(st *state) {
+		s := st.Anchors[sum]
+		s.TxID, s.Submitted = tx.ID, tx.Timestamp.UTC()
+	})
+}
+
+// confirm checks whether an anchor's transaction has been mined, clearing it
+// to be sent again if the node has dropped it
+func (a *Anchorer) confirm(ctx context.Context, an Anchor) error {
+	info, err := a.node.Transaction(ctx, an.TxID)
+	if client.IsNotFound(err) {
+		log.Printf("transaction %s anchoring %s was dropped; sending another", an.TxID, an.SHA256)
+		return a.store.update(func(st *state) {
+			st.Anchors[an.SHA256].TxID = ""
+		})
+	}
+	if err != nil || info.Status != "confirmed" {
+		return err
+	}
+	b, err := a.node.BlockByHeight(ctx, info.Height)
+	if err != nil {
+		return err
+	}
+	log.Printf("%s anchored at height %d", an.SHA256, info.Height)
+	return a.store.update(func(st *state) {
+		s := st.Anchors[an.SHA256]
+		s.Height, s.BlockHash, s.BlockTime = info.Height, info.BlockHash, b.Timestamp
+	})
+}
+
+// Sum returns the hex SHA-256 of what r reads, as anchors record it
+func Sum(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashFile returns the hex SHA-256 of a file
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return Sum(f)
+}
@@ -0,0 +1,137 @@
+package anchor
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/client"
+	"github.com/oksmith/home-server/blockchain/pkg/node"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+// setup serves a regtest node and returns an Anchorer for a fresh directory
+// with a funded wallet, along with the node's client
+func setup(t *testing.T) (*Anchorer, *client.Client, string) {
+	t.Helper()
+	n, err := node.New("localhost:9000", 1, 10.0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.EnableRegtest()
+	srv := httptest.NewServer(n.Handler())
+	t.Cleanup(srv.Close)
+	c := client.New(srv.URL)
+
+	w, _ := wallet.New()
+	if _, err := c.Faucet(t.Context(), w.Address(), 1); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	store, err := OpenStore(filepath.Join(dir, ".anchors.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(dir, store, c, w, DefaultAmount), c, dir
+}
+
+func TestScan(t *testing.T) {
+	a, c, dir := setup(t)
+	os.WriteFile(filepath.Join(dir, "deed.pdf"), []byte("deed"), 0644)
+	os.WriteFile(filepath.Join(dir, ".partial"), []byte("skip me"), 0644)
+	sum, _ := Sum(strings.NewReader("deed"))
+
+	// The first scan only notes the file, in case it is still being written
+	if err := a.Scan(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if got := a.store.Anchors(); len(got) != 0 {
+		t.Fatalf("expected nothing anchored yet, got %+v", got)
+	}
+
+	if err := a.Scan(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	an, ok := a.store.Anchor(sum)
+	if !ok || an.TxID == "" || an.Confirmed() || len(an.Files) != 1 || an.Files[0] != "deed.pdf" {
+		t.Fatalf("expected deed.pdf to be submitted, got %+v", a.store.Anchors())
+	}
+	if _, err := Verify(t.Context(), c, sum); !errors.Is(err, ErrNotAnchored) {
+		t.Errorf("expected no proof before it is mined, got %v", err)
+	}
+
+	if _, err := c.Generate(t.Context(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Scan(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	an, _ = a.store.Anchor(sum)
+	if !an.Confirmed() || an.Height != 3 {
+		t.Fatalf("expected the anchor to be mined at height 3, got %+v", an)
+	}
+
+	p, err := Verify(t.Context(), c, sum)
+	if err != nil || p.TxID != an.TxID || p.Height != 3 || p.From != a.Address() || p.Block.Hash != an.BlockHash {
+		t.Errorf("got %+v, %v", p, err)
+	}
+
+	// The same contents under another name share the anchor
+	os.WriteFile(filepath.Join(dir, "copy.pdf"), []byte("deed"), 0644)
+	a.Scan(t.Context())
+	a.Scan(t.Context())
+	if all := a.store.Anchors(); len(all) != 1 || len(all[0].Files) != 2 {
+		t.Errorf("expected one anchor of two files, got %+v", all)
+	}
+
+	// A fresh store finds the anchor on the chain rather than paying again
+	store, _ := OpenStore(filepath.Join(t.TempDir(), "anchors.json"))
+	b := New(dir, store, c, a.wallet, DefaultAmount)
+	b.Scan(t.Context())
+	b.Scan(t.Context())
+	if again, _ := store.Anchor(sum); again.TxID != an.TxID || !again.Confirmed() {
+		t.Errorf("expected the existing anchor to be found, got %+v", again)
+	}
+}
+
+func TestScanUnfunded(t *testing.T) {
+	a, _, dir := setup(t)
+	w, _ := wallet.New()
+	a.wallet = w
+	os.WriteFile(filepath.Join(dir, "note.txt"), []byte("note"), 0644)
+	a.Scan(t.Context())
+	a.Scan(t.Context())
+
+	all := a.store.Anchors()
+	if len(all) != 1 || all[0].TxID != "" || !strings.Contains(all[0].Error, "not enough") {
+		t.Errorf("expected the anchor to wait for funds, got %+v", all)
+	}
+}
+
+func TestVerifyRejectsBadHash(t *testing.T) {
+	_, c, _ := setup(t)
+	if _, err := Verify(t.Context(), c, "not-a-hash"); err == nil || errors.Is(err, ErrNotAnchored) {
+		t.Errorf("expected a bad hash to be refused, got %v", err)
+	}
+}
+
+func TestStore(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "anchors.json")
+	s, err := OpenStore(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.update(func(st *state) {
+		st.Anchors["ab"] = &Anchor{SHA256: "ab", Files: []string{"a"}, TxID: "tx"}
+	})
+	s, err = OpenStore(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if an, ok := s.Anchor("ab"); !ok || an.TxID != "tx" {
+		t.Errorf("got %+v", an)
+	}
+}
@@ -0,0 +1,138 @@
+package anchor
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Anchor is a file's contents as recorded on the chain
+type Anchor struct {
+	SHA256    string    `json:"sha256"`
+	Files     []string  `json:"files"` // paths with these contents, relative to the directory
+	Size      int64     `json:"size"`
+	TxID      string    `json:"tx_id,omitempty"`
+	Submitted time.Time `json:"submitted,omitempty"`
+	Height    int64     `json:"height,omitempty"` // of the block holding the transaction, once it is mined
+	BlockHash string    `json:"block_hash,omitempty"`
+	BlockTime time.Time `json:"block_time,omitempty"`
+	Error     string    `json:"error,omitempty"` // why the last submission failed
+}
+
+// Confirmed reports whether the anchor's transaction has been mined
+func (a *Anchor) Confirmed() bool {
+	return a.BlockHash != ""
+}
+
+// file is what was last seen of a file, so it is only hashed again once it changes
+type file struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	SHA256  string    `json:"sha256"`
+}
+
+// state is what the store saves
+type state struct {
+	Files   map[string]file    `json:"files"`
+	Anchors map[string]*Anchor `json:"anchors"`
+}
+
+// Store keeps the files seen and their anchors in a JSON file
+type Store struct {
+	filename string
+	state    state
+	mu       sync.Mutex
+}
+
+// OpenStore loads the store saved in filename, if there is one
+func OpenStore(filename string) (*Store, error) {
+	s := &Store{filename: filename, state: state{Files: map[string]file{}, Anchors: map[string]*Anchor{}}}
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.state); err != nil {
+		return nil, err
+	}
+	if s.state.Files == nil {
+		s.state.Files = map[string]file{}
+	}
+	if s.state.Anchors == nil {
+		s.state.Anchors = map[string]*Anchor{}
+	}
+	return s, nil
+}
+
+// Anchors returns every anchor, newest submission first
+func (s *Store) Anchors() []Anchor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Anchor, 0, len(s.state.Anchors))
+	for _, a := range s.state.Anchors {
+		c := *a
+		c.Files = slices.Clone(a.Files)
+		list = append(list, c)
+	}
+	slices.SortFunc(list, func(a, b Anchor) int {
+		if c := b.Submitted.Compare(a.Submitted); c != 0 {
+			return c
+		}
+		return strings.Compare(a.SHA256, b.SHA256)
+	})
+	return list
+}
+
+// Anchor returns the anchor of some contents, if they have one
+func (s *Store) Anchor(sum string) (Anchor, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.state.Anchors[sum]
+	if !ok {
+		return Anchor{}, false
+	}
+	c := *a
+	c.Files = slices.Clone(a.Files)
+	return c, true
+}
+
+// update changes the store and saves it
+func (s *Store) update(change func(*state)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	change(&s.state)
+	return s.save()
+}
+
+// save writes the store via a temporary file so a crash never leaves it half
+// written. Callers must hold the lock.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.filename), ".anchors-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.filename)
+}
@@ -0,0 +1,57 @@
+package anchor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/client"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+// ErrNotAnchored is returned by Verify for contents the chain holds no anchor of
+var ErrNotAnchored = errors.New("not anchored")
+
+// Proof shows that some contents were anchored in a block
+type Proof struct {
+	SHA256 string         `json:"sha256"`
+	TxID   string         `json:"tx_id"`
+	From   string         `json:"from"` // the wallet that paid for the anchor
+	Height int64          `json:"height"`
+	Block  block.Header   `json:"block"`
+	Proof  *block.TxProof `json:"proof"` // that the transaction is in the block with that header
+}
+
+// Verify finds the earliest anchor of the contents with hex SHA-256 sum on
+// the node's chain, whoever paid for it, and checks its transaction's
+// signature and its inclusion proof against the block's header
+func Verify(ctx context.Context, node *client.Client, sum string) (Proof, error) {
+	if !wallet.ValidAddress(sum) {
+		return Proof{}, fmt.Errorf("%q is not a hex SHA-256", sum)
+	}
+	proven, err := node.Proofs(ctx, sum, 0)
+	if err != nil {
+		return Proof{}, err
+	}
+	for _, p := range proven {
+		tx := p.Tx
+		if tx == nil || p.Proof == nil || tx.To != sum || tx.ID != tx.Hash() {
+			continue
+		}
+		key, err := tx.SignerKey()
+		if err != nil || wallet.PublicKeyToAddress(key) != tx.From || !tx.Verify(key) {
+			continue
+		}
+		b, err := node.BlockByHeight(ctx, p.Height)
+		if err != nil {
+			return Proof{}, err
+		}
+		h := b.Header()
+		if !p.Proof.Verify(h, tx.ID) {
+			return Proof{}, fmt.Errorf("the proof of transaction %s doesn't match block %d", tx.ID, p.Height)
+		}
+		return Proof{SHA256: sum, TxID: tx.ID, From: tx.From, Height: p.Height, Block: h, Proof: p.Proof}, nil
+	}
+	return Proof{}, ErrNotAnchored
+}
@@ -0,0 +1,244 @@
+// Command anchor-service proves when files turned up. It watches a
+// directory, hashes each new or changed file and records the SHA-256 on the
+// blockchain through a node, so anyone with the file can later show it
+// existed by the time a given block was mined.
+//
+// ANCHOR_DIR is the directory to watch, including its subdirectories but not
+// hidden files or directories. It is scanned every SCAN_INTERVAL (default
+// 30s), and a file is hashed once its size and modification time hold
+// still from one scan to the next, so files still being copied in are left
+// until they are finished. Files with the same contents share one anchor.
+// What has been hashed and anchored is kept in ANCHOR_STATE (default
+// .anchors.json in ANCHOR_DIR).
+//
+// The chain's transactions carry no data, so an anchor is a payment of
+// ANCHOR_AMOUNT (default 0.000001) to the file's SHA-256 as if it were an
+// address, which no key can spend from. ANCHOR_WALLET is the wallet key file
+// that pays, encrypted with ANCHOR_WALLET_PASSPHRASE or not; it needs a
+// balance on the chain, and anchors wait, retried each scan, until it has
+// one. NODE_URL is the node to send them to (default http://localhost:8080).
+// A transaction the node drops is sent again.
+//
+// GET /api/v1/anchors lists the anchors with the files they cover and the
+// blocks they were mined in. GET /api/v1/verify?sha256=HEX checks a hash, and
+// POST /api/v1/verify checks the file sent as the body, both against the
+// node's chain rather than this service's records, so they find anchors paid
+// for by anyone. Each answers with the earliest anchor's transaction, block
+// header and inclusion proof, or 404 if there is none. With ?block=HEIGHT or
+// ?block=HASH, it also says whether the anchor is in that block or an
+// earlier one, so the file existed before the block was mined, answering 422
+// if it isn't.
+//
+// Otherwise it serves as package httpserver describes, on LISTEN_ADDR
+// (default :8099) with ANCHOR_TOKEN as its token, and registers with the
+// gateway as anchor by default.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/oksmith/home-server/anchor-service/anchor"
+	"github.com/oksmith/home-server/blockchain/pkg/client"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+	"github.com/oksmith/home-server/pkg/config"
+	"github.com/oksmith/home-server/pkg/httpserver"
+	"github.com/oksmith/home-server/pkg/registry"
+	"github.com/oksmith/home-server/pkg/sigauth"
+)
+
+// settings are the service's settings
+var settings = []config.Field{
+	{Name: "ANCHOR_DIR", Required: true},
+	{Name: "ANCHOR_STATE"},
+	{Name: "ANCHOR_WALLET", Required: true},
+	{Name: "ANCHOR_WALLET_PASSPHRASE", Secret: true},
+	{Name: "ANCHOR_AMOUNT", Default: "0.000001", Check: config.NumberBetween(anchor.DefaultAmount, 1)},
+	{Name: "NODE_URL", Default: "http://localhost:8080", Check: config.HTTPURL},
+	{Name: "SCAN_INTERVAL", Default: "30s", Check: config.PositiveDuration},
+	{Name: "LISTEN_ADDR", Default: ":8099", Check: config.HostPort},
+	{Name: "ANCHOR_TOKEN", Secret: true, Reload: true},
+	{Name: "TLS_CERT"},
+	{Name: "TLS_KEY"},
+	{Name: "GATEWAY_URL", Check: config.HTTPURL},
+	{Name: "GATEWAY_REGISTRY_TOKEN", Secret: true},
+	{Name: "GATEWAY_NAME", Default: "anchor"},
+	{Name: "GATEWAY_SERVICE_URL", Check: config.HTTPURL},
+	{Name: "AUTHORIZED_KEYS"},
+	{Name: "SERVICE_KEY"},
+}
+
+// verification is the answer to a verify request
+type verification struct {
+	SHA256 string        `json:"sha256"`
+	Proof  *anchor.Proof `json:"proof,omitempty"`
+	Files  []string      `json:"files,omitempty"` // this service's files with these contents
+	Block  *int64        `json:"block,omitempty"` // the height asked about
+	Before *bool         `json:"before,omitempty"`
+}
+
+// verifyHandler checks the hash given, or the hash of the body, against the chain
+func verifyHandler(node *client.Client, store *anchor.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := verification{SHA256: r.URL.Query().Get("sha256")}
+		if r.Method == http.MethodPost {
+			sum, err := anchor.Sum(r.Body)
+			if err != nil {
+				http.Error(w, "failed to read the file: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			v.SHA256 = sum
+		}
+		if !wallet.ValidAddress(v.SHA256) {
+			http.Error(w, "sha256 must be 64 lowercase hex digits", http.StatusBadRequest)
+			return
+		}
+		if s := r.URL.Query().Get("block"); s != "" {
+			height, err := blockHeight(r.Context(), node, s)
+			if err != nil {
+				http.Error(w, "block: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			v.Block = &height
+		}
+
+		p, err := anchor.Verify(r.Context(), node, v.SHA256)
+		switch {
+		case errors.Is(err, anchor.ErrNotAnchored):
+			httpserver.WriteJSON(w, http.StatusNotFound, v)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		v.Proof = &p
+		if an, ok := store.Anchor(v.SHA256); ok {
+			v.Files = an.Files
+		}
+		status := http.StatusOK
+		if v.Block != nil {
+			before := p.Height <= *v.Block
+			v.Before = &before
+			if !before {
+				status = http.StatusUnprocessableEntity
+			}
+		}
+		httpserver.WriteJSON(w, status, v)
+	}
+}
+
+// blockHeight reads a block height, or looks up a block hash's
+func blockHeight(ctx context.Context, node *client.Client, s string) (int64, error) {
+	if height, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if height < 0 {
+			return 0, errors.New("height must not be negative")
+		}
+		return height, nil
+	}
+	b, err := node.BlockByHash(ctx, s)
+	if err != nil {
+		return 0, err
+	}
+	return b.Index, nil
+}
+
+func main() {
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"), settings...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dir := cfg.Get("ANCHOR_DIR")
+	if st, err := os.Stat(dir); err != nil || !st.IsDir() {
+		log.Fatalf("ANCHOR_DIR %s must be a directory", dir)
+	}
+	stateFile := cfg.Get("ANCHOR_STATE")
+	if stateFile == "" {
+		stateFile = filepath.Join(dir, ".anchors.json")
+	}
+	store, err := anchor.OpenStore(stateFile)
+	if err != nil {
+		log.Fatalf("ANCHOR_STATE: %v", err)
+	}
+	w, err := wallet.LoadWithPassphrase(cfg.Get("ANCHOR_WALLET"), []byte(cfg.Get("ANCHOR_WALLET_PASSPHRASE")))
+	if err != nil {
+		log.Fatalf("ANCHOR_WALLET: %v", err)
+	}
+	node := client.New(cfg.Get("NODE_URL"))
+	a := anchor.New(dir, store, node, w, cfg.Float("ANCHOR_AMOUNT"))
+	addr := cfg.Get("LISTEN_ADDR")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go cfg.Watch(ctx, config.DefaultPoll)
+	go a.Run(ctx, cfg.Duration("SCAN_INTERVAL"))
+	log.Printf("anchoring files in %s from wallet %s through %s", dir, a.Address(), cfg.Get("NODE_URL"))
+
+	keys, err := sigauth.LoadKeyring(cfg.Get("AUTHORIZED_KEYS"))
+	if err != nil {
+		log.Fatalf("AUTHORIZED_KEYS: %v", err)
+	}
+	signer, err := sigauth.LoadSigner(cfg.Get("SERVICE_KEY"))
+	if err != nil {
+		log.Fatalf("SERVICE_KEY: %v", err)
+	}
+
+	token := func() string { return cfg.Get("ANCHOR_TOKEN") }
+	g := httpserver.NewGuard(httpserver.DefaultLimits)
+	auth := func(next http.HandlerFunc) http.Handler {
+		return httpserver.RequireAuth("anchor-service", token, keys, g, next)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.Handle("GET /api/v1/anchors", auth(func(w http.ResponseWriter, r *http.Request) {
+		httpserver.WriteJSON(w, http.StatusOK, map[string]any{"wallet": a.Address(), "anchors": store.Anchors()})
+	}))
+	mux.Handle("GET /api/v1/verify", auth(verifyHandler(node, store)))
+	mux.Handle("POST /api/v1/verify", auth(verifyHandler(node, store)))
+	metrics := httpserver.NewMetrics()
+	server := &http.Server{Addr: addr, Handler: g.Middleware(httpserver.InstrumentMux(metrics, slog.Default(), mux))}
+
+	certFile, keyFile := cfg.Get("TLS_CERT"), cfg.Get("TLS_KEY")
+	switch {
+	case certFile == "" && keyFile == "":
+		log.Printf("anchor-service starting on %s", addr)
+	case certFile == "" || keyFile == "":
+		log.Fatal("TLS_CERT and TLS_KEY must be set together")
+	default:
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		log.Printf("anchor-service starting on %s with TLS", addr)
+	}
+
+	var withdrawn chan struct{}
+	if gateway := cfg.Get("GATEWAY_URL"); gateway != "" {
+		s, err := registry.Local(cfg.Get("GATEWAY_NAME"), cfg.Get("GATEWAY_SERVICE_URL"), addr, server.TLSConfig != nil)
+		if err != nil {
+			log.Fatalf("GATEWAY_URL: %v", err)
+		}
+		withdrawn = make(chan struct{})
+		go func() {
+			registry.Announce(ctx, gateway, cfg.Get("GATEWAY_REGISTRY_TOKEN"), signer, func() registry.Service {
+				s.Token = token()
+				return s
+			}, registry.DefaultTTL/3)
+			close(withdrawn)
+		}()
+	}
+	if err := httpserver.ListenAndServe(ctx, server, certFile, keyFile); err != nil {
+		log.Fatal(err)
+	}
+	if withdrawn != nil {
+		<-withdrawn
+	}
+	log.Println("anchor-service stopped")
+}
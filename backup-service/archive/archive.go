@@ -0,0 +1,252 @@
+// Package archive writes backups as gzipped tarballs that end with a
+// manifest of every file and its SHA-256, so a backup can be checked in full
+// without restoring it, and optionally encrypts them under a passphrase
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// manifestName is the archive's last entry
+const manifestName = "MANIFEST.json"
+
+// Source is a file or directory to back up, stored under Name
+type Source struct {
+	Name string
+	Path string
+}
+
+// File is one file in a backup
+type File struct {
+	Path   string      `json:"path"` // slash-separated, under its source's name
+	Size   int64       `json:"size"`
+	Mode   fs.FileMode `json:"mode"`
+	SHA256 string      `json:"sha256"`
+}
+
+// Manifest lists what a backup holds
+type Manifest struct {
+	Created time.Time `json:"created"`
+	Host    string    `json:"host,omitempty"`
+	Files   []File    `json:"files"`
+}
+
+// Size is the total size of the files
+func (m Manifest) Size() int64 {
+	var total int64
+	for _, f := range m.Files {
+		total += f.Size
+	}
+	return total
+}
+
+// Create writes a backup of sources to w, leaving out files and directories
+// whose names match any of the exclude patterns. Each file is stored at the
+// size it had when it was opened, so one that is being appended to, like the
+// node's event log, is backed up as it was at that moment.
+func Create(w io.Writer, sources []Source, exclude []string, host string) (Manifest, error) {
+	m := Manifest{Created: time.Now().UTC(), Host: host, Files: []File{}}
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, src := range sources {
+		if !fs.ValidPath(src.Name) || strings.Contains(src.Name, "/") || src.Name == manifestName {
+			return m, fmt.Errorf("bad source name %q", src.Name)
+		}
+		err := filepath.WalkDir(src.Path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if p != src.Path && excluded(d.Name(), exclude) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(src.Path, p)
+			if err != nil {
+				return err
+			}
+			name := src.Name
+			if rel != "." {
+				name = path.Join(src.Name, filepath.ToSlash(rel))
+			}
+			f, err := addFile(tw, p, name)
+			if err != nil {
+				return err
+			}
+			m.Files = append(m.Files, f)
+			return nil
+		})
+		if err != nil {
+			return m, fmt.Errorf("%s: %w", src.Name, err)
+		}
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return m, err
+	}
+	hdr := &tar.Header{Name: manifestName, Mode: 0644, Size: int64(len(data)), ModTime: m.Created, Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return m, err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return m, err
+	}
+	if err := tw.Close(); err != nil {
+		return m, err
+	}
+	return m, gz.Close()
+}
+
+// excluded reports whether name matches any of the patterns
+func excluded(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// addFile stores a file as name, returning its manifest entry
+func addFile(tw *tar.Writer, filename, name string) (File, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return File{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return File{}, err
+	}
+	file := File{Path: name, Size: info.Size(), Mode: info.Mode().Perm()}
+	hdr := &tar.Header{Name: name, Mode: int64(file.Mode), Size: file.Size, ModTime: info.ModTime(), Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return file, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tw, h), io.LimitReader(f, file.Size)); err != nil {
+		return file, fmt.Errorf("%s: %w", filename, err)
+	}
+	file.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return file, nil
+}
+
+// ErrCorrupt means a backup doesn't match its manifest
+var ErrCorrupt = errors.New("backup is corrupt")
+
+// Verify reads a whole backup, checking every file against the manifest,
+// and returns the manifest
+func Verify(r io.Reader) (Manifest, error) {
+	return walk(r, func(File, io.Reader) error { return nil })
+}
+
+// Restore verifies a backup while extracting it into dir, which must not
+// exist yet. Files are only moved into place once all of them check out, so
+// a corrupt backup leaves nothing behind.
+func Restore(r io.Reader, dir string) (Manifest, error) {
+	if _, err := os.Lstat(dir); err == nil {
+		return Manifest{}, fmt.Errorf("%s already exists", dir)
+	}
+	tmp := dir + ".partial"
+	if err := os.MkdirAll(tmp, 0700); err != nil {
+		return Manifest{}, err
+	}
+	m, err := walk(r, func(f File, content io.Reader) error {
+		target := filepath.Join(tmp, filepath.FromSlash(f.Path))
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return err
+		}
+		out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, f.Mode)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, content); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+	if err != nil {
+		os.RemoveAll(tmp)
+		return m, err
+	}
+	return m, os.Rename(tmp, dir)
+}
+
+// walk reads a backup, passing each file's content to fn, and checks what it
+// read against the manifest at the end
+func walk(r io.Reader, fn func(File, io.Reader) error) (Manifest, error) {
+	var m Manifest
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return m, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	tr := tar.NewReader(gz)
+	var found []File
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return m, fmt.Errorf("%w: no manifest", ErrCorrupt)
+		}
+		if err != nil {
+			return m, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		if hdr.Name == manifestName {
+			if err := json.NewDecoder(tr).Decode(&m); err != nil {
+				return m, fmt.Errorf("%w: manifest: %v", ErrCorrupt, err)
+			}
+			break
+		}
+		// Names come from the archive, so refuse any that would escape
+		if hdr.Typeflag != tar.TypeReg || !fs.ValidPath(hdr.Name) {
+			return m, fmt.Errorf("%w: unexpected entry %q", ErrCorrupt, hdr.Name)
+		}
+		f := File{Path: hdr.Name, Size: hdr.Size, Mode: fs.FileMode(hdr.Mode).Perm()}
+		h := sha256.New()
+		content := io.TeeReader(tr, h)
+		if err := fn(f, content); err != nil {
+			return m, err
+		}
+		// Hash whatever fn didn't read
+		if _, err := io.Copy(io.Discard, content); err != nil {
+			return m, fmt.Errorf("%w: %s: %v", ErrCorrupt, f.Path, err)
+		}
+		f.SHA256 = hex.EncodeToString(h.Sum(nil))
+		found = append(found, f)
+	}
+	if _, err := tr.Next(); err != io.EOF {
+		return m, fmt.Errorf("%w: entries after the manifest", ErrCorrupt)
+	}
+	// Reading to the end checks the gzip trailer's CRC
+	if _, err := io.Copy(io.Discard, gz); err != nil {
+		return m, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+
+	if len(found) != len(m.Files) {
+		return m, fmt.Errorf("%w: holds %d files but the manifest lists %d", ErrCorrupt, len(found), len(m.Files))
+	}
+	for i, want := range m.Files {
+		if found[i] != want {
+			return m, fmt.Errorf("%w: %s doesn't match the manifest", ErrCorrupt, want.Path)
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,119 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testSources makes a data directory and a lone config file to back up
+func testSources(t *testing.T) []Source {
+	t.Helper()
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data")
+	files := map[string]string{
+		"data/chain.json":       `{"blocks":[]}`,
+		"data/wallets/a.pem":    "key a",
+		"data/node.pid":         "123",
+		"data/cache/blob":       "cached",
+		"node.env":              "NODE_TOKEN=x",
+		"data/wallets/b.pem":    "key b",
+		"data/chain.json.tmp":   "partial",
+		"data/events/2026.json": "{}",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return []Source{{Name: "node", Path: data}, {Name: "config", Path: filepath.Join(dir, "node.env")}}
+}
+
+func TestCreateVerifyRestore(t *testing.T) {
+	var buf bytes.Buffer
+	m, err := Create(&buf, testSources(t), []string{"*.tmp", "*.pid", "cache"}, "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, f := range m.Files {
+		paths = append(paths, f.Path)
+	}
+	want := []string{"node/chain.json", "node/events/2026.json", "node/wallets/a.pem", "node/wallets/b.pem", "config"}
+	if len(paths) != len(want) {
+		t.Fatalf("backed up %v, want %v", paths, want)
+	}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Fatalf("backed up %v, want %v", paths, want)
+		}
+	}
+	if m.Host != "server" || m.Size() != int64(len(`{"blocks":[]}`)+len("{}")+10+len("NODE_TOKEN=x")) {
+		t.Errorf("manifest %+v, size %d", m, m.Size())
+	}
+
+	verified, err := Verify(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verified.Files) != len(m.Files) || !verified.Created.Equal(m.Created) {
+		t.Errorf("verified manifest %+v differs from %+v", verified, m)
+	}
+
+	dir := filepath.Join(t.TempDir(), "restored")
+	if _, err := Restore(bytes.NewReader(buf.Bytes()), dir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "node", "wallets", "b.pem"))
+	if err != nil || string(got) != "key b" {
+		t.Errorf("restored b.pem = %q, %v", got, err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "config")); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("restored config: %v, %v", info, err)
+	}
+	if _, err := Restore(bytes.NewReader(buf.Bytes()), dir); err == nil {
+		t.Error("restored over an existing directory")
+	}
+}
+
+func TestVerifyCorrupt(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := Create(&buf, testSources(t), nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	good := buf.Bytes()
+
+	for name, corrupt := range map[string][]byte{
+		"truncated": good[:len(good)/2],
+		"flipped":   append(append(append([]byte{}, good[:len(good)/2]...), good[len(good)/2]^0xff), good[len(good)/2+1:]...),
+		"empty":     nil,
+	} {
+		if _, err := Verify(bytes.NewReader(corrupt)); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: Verify = %v, want ErrCorrupt", name, err)
+		}
+		dir := filepath.Join(t.TempDir(), "restored")
+		if _, err := Restore(bytes.NewReader(corrupt), dir); err == nil {
+			t.Errorf("%s: restored", name)
+		}
+		if _, err := os.Stat(dir); err == nil {
+			t.Errorf("%s: left %s behind", name, dir)
+		}
+		if _, err := os.Stat(dir + ".partial"); err == nil {
+			t.Errorf("%s: left %s.partial behind", name, dir)
+		}
+	}
+}
+
+func TestBadSourceName(t *testing.T) {
+	for _, name := range []string{"", "..", "a/b", manifestName} {
+		if _, err := Create(&bytes.Buffer{}, []Source{{Name: name, Path: t.TempDir()}}, nil, ""); err == nil {
+			t.Errorf("accepted source name %q", name)
+		}
+	}
+}
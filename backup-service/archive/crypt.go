@@ -0,0 +1,212 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// An encrypted backup starts with a header giving the magic, format version,
+// PBKDF2 iterations and salt and a nonce prefix, followed by the backup
+// sealed with AES-256-GCM in chunks. Each chunk's nonce is the prefix and its
+// number, and the header and whether it is the last chunk are authenticated
+// with it, so chunks can't be reordered, dropped or cut off at the end.
+const (
+	cryptMagic   = "HSBACKUP"
+	cryptVersion = 1
+	saltSize     = 16
+	prefixSize   = 4
+	headerSize   = len(cryptMagic) + 1 + 4 + saltSize + prefixSize
+	chunkSize    = 64 * 1024
+)
+
+// cryptIterations is the PBKDF2 work factor for new backups. Tests lower it
+// to stay fast.
+var cryptIterations = 600_000
+
+// maxIterations stops a crafted file from tying up the CPU
+const maxIterations = 10_000_000
+
+var (
+	// ErrNotEncrypted is returned when decrypting something that isn't an
+	// encrypted backup
+	ErrNotEncrypted = errors.New("not an encrypted backup")
+	// ErrWrongPassphrase is returned when a backup fails to decrypt
+	ErrWrongPassphrase = errors.New("wrong passphrase, or the backup is damaged")
+)
+
+// Encrypt returns a writer that encrypts what is written to it under
+// passphrase and writes it to w. It must be closed to write the last chunk.
+func Encrypt(w io.Writer, passphrase []byte) (io.WriteCloser, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase is empty")
+	}
+	header := make([]byte, headerSize)
+	copy(header, cryptMagic)
+	header[len(cryptMagic)] = cryptVersion
+	binary.BigEndian.PutUint32(header[len(cryptMagic)+1:], uint32(cryptIterations))
+	if _, err := rand.Read(header[len(cryptMagic)+5:]); err != nil {
+		return nil, err
+	}
+	gcm, err := cipherFor(passphrase, header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encrypter{w: w, gcm: gcm, header: header}, nil
+}
+
+type encrypter struct {
+	w       io.Writer
+	gcm     cipher.AEAD
+	header  []byte
+	buf     []byte
+	counter uint64
+	closed  bool
+}
+
+func (e *encrypter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("write after close")
+	}
+	e.buf = append(e.buf, p...)
+	// Hold back a full chunk, which may turn out to be the last
+	for len(e.buf) > chunkSize {
+		if err := e.seal(e.buf[:chunkSize], false); err != nil {
+			return 0, err
+		}
+		e.buf = e.buf[chunkSize:]
+	}
+	return len(p), nil
+}
+
+// Close writes the last chunk, without closing the underlying writer
+func (e *encrypter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	return e.seal(e.buf, true)
+}
+
+func (e *encrypter) seal(chunk []byte, last bool) error {
+	sealed := e.gcm.Seal(nil, nonce(e.header, e.counter), chunk, chunkAAD(e.header, last))
+	e.counter++
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+// Decrypt returns a reader for the backup encrypted in r. A wrong passphrase
+// fails here; damage further in fails the read that reaches it.
+func Decrypt(r io.Reader, passphrase []byte) (io.Reader, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.HasPrefix(header, []byte(cryptMagic)) {
+		return nil, ErrNotEncrypted
+	}
+	if v := header[len(cryptMagic)]; v != cryptVersion {
+		return nil, fmt.Errorf("unsupported encrypted backup version %d", v)
+	}
+	gcm, err := cipherFor(passphrase, header)
+	if err != nil {
+		return nil, err
+	}
+	d := &decrypter{r: bufio.NewReaderSize(r, chunkSize+gcm.Overhead()+1), gcm: gcm, header: header}
+	// Open the first chunk now so a wrong passphrase is reported straight away
+	if err := d.next(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+type decrypter struct {
+	r       *bufio.Reader
+	gcm     cipher.AEAD
+	header  []byte
+	buf     []byte
+	counter uint64
+	done    bool
+}
+
+func (d *decrypter) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+// next opens the next chunk. It is the last one if nothing follows it.
+func (d *decrypter) next() error {
+	sealed := make([]byte, chunkSize+d.gcm.Overhead())
+	n, err := io.ReadFull(d.r, sealed)
+	switch {
+	case err == io.ErrUnexpectedEOF || err == io.EOF:
+		d.done = true
+	case err != nil:
+		return err
+	default:
+		if _, err := d.r.Peek(1); err == io.EOF {
+			d.done = true
+		} else if err != nil {
+			return err
+		}
+	}
+	plain, err := d.gcm.Open(sealed[:0], nonce(d.header, d.counter), sealed[:n], chunkAAD(d.header, d.done))
+	if err != nil {
+		return ErrWrongPassphrase
+	}
+	d.counter++
+	d.buf = plain
+	return nil
+}
+
+// cipherFor derives the key for a header's salt and iterations
+func cipherFor(passphrase, header []byte) (cipher.AEAD, error) {
+	iterations := int(binary.BigEndian.Uint32(header[len(cryptMagic)+1:]))
+	if iterations < 1 || iterations > maxIterations {
+		return nil, fmt.Errorf("bad iteration count %d", iterations)
+	}
+	salt := header[len(cryptMagic)+5 : len(cryptMagic)+5+saltSize]
+	key, err := pbkdf2.Key(sha256.New, string(passphrase), salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// nonce is the header's nonce prefix followed by the chunk number
+func nonce(header []byte, counter uint64) []byte {
+	n := make([]byte, 12)
+	copy(n, header[headerSize-prefixSize:])
+	binary.BigEndian.PutUint64(n[prefixSize:], counter)
+	return n
+}
+
+// chunkAAD authenticates the header and whether this is the last chunk
+func chunkAAD(header []byte, last bool) []byte {
+	flag := byte(0)
+	if last {
+		flag = 1
+	}
+	return append(append([]byte{}, header...), flag)
+}
@@ -0,0 +1,92 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+func init() {
+	cryptIterations = 1000
+}
+
+func encrypt(t *testing.T, plain, passphrase []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := Encrypt(&buf, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Write in odd-sized pieces to cross chunk boundaries
+	for rest := plain; len(rest) > 0; {
+		n := min(len(rest), 10_000)
+		if _, err := w.Write(rest[:n]); err != nil {
+			t.Fatal(err)
+		}
+		rest = rest[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decrypt(sealed, passphrase []byte) ([]byte, error) {
+	r, err := Decrypt(bytes.NewReader(sealed), passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	pass := []byte("correct horse")
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 17} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+		got, err := decrypt(encrypt(t, plain, pass), pass)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("size %d: decrypted %d bytes that differ", size, len(got))
+		}
+	}
+}
+
+func TestDecryptFailures(t *testing.T) {
+	pass := []byte("correct horse")
+	plain := make([]byte, 2*chunkSize+100)
+	sealed := encrypt(t, plain, pass)
+	overhead := 16
+
+	if _, err := decrypt(sealed, []byte("wrong")); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("wrong passphrase: %v", err)
+	}
+	if _, err := decrypt(plain, pass); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("plain input: %v", err)
+	}
+
+	// Cutting off the last chunk leaves a full chunk that wasn't sealed as the last
+	cut := sealed[:headerSize+2*(chunkSize+overhead)]
+	if _, err := decrypt(cut, pass); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("truncated: %v", err)
+	}
+
+	flipped := append([]byte{}, sealed...)
+	flipped[headerSize+chunkSize+overhead+5] ^= 1
+	if _, err := decrypt(flipped, pass); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("flipped: %v", err)
+	}
+
+	// Swapping the first two chunks breaks their nonces
+	swapped := append([]byte{}, sealed[:headerSize]...)
+	first := sealed[headerSize : headerSize+chunkSize+overhead]
+	second := sealed[headerSize+chunkSize+overhead : headerSize+2*(chunkSize+overhead)]
+	swapped = append(append(append(swapped, second...), first...), sealed[headerSize+2*(chunkSize+overhead):]...)
+	if _, err := decrypt(swapped, pass); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("swapped: %v", err)
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oksmith/home-server/backup-service/archive"
+	"github.com/oksmith/home-server/backup-service/retention"
+	"github.com/oksmith/home-server/backup-service/target"
+	"github.com/oksmith/home-server/pkg/notify"
+)
+
+// Backup names are PREFIX-STAMP.tar.gz, with .enc added when encrypted
+const (
+	stampFormat = "20060102T150405Z"
+	plainExt    = ".tar.gz"
+	cryptExt    = ".tar.gz.enc"
+)
+
+// backup is one stored backup
+type backup struct {
+	Name      string    `json:"name"`
+	Time      time.Time `json:"time"`
+	Size      int64     `json:"size"`
+	Encrypted bool      `json:"encrypted"`
+}
+
+// targetResult is how a run went on one target
+type targetResult struct {
+	Target   string   `json:"target"`
+	Verified bool     `json:"verified"`
+	Pruned   []string `json:"pruned,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// runResult is how a run went
+type runResult struct {
+	Name     string         `json:"name,omitempty"`
+	Started  time.Time      `json:"started"`
+	Finished time.Time      `json:"finished"`
+	Files    int            `json:"files"`
+	Size     int64          `json:"size"` // of the files backed up, before compression
+	Stored   int64          `json:"stored_size"`
+	Targets  []targetResult `json:"targets,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// ok reports whether the backup reached every target and checked out
+func (r runResult) ok() bool {
+	if r.Error != "" {
+		return false
+	}
+	for _, t := range r.Targets {
+		if t.Error != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// backuper takes backups to every target and prunes old ones. Only one run
+// happens at a time.
+type backuper struct {
+	prefix     string
+	sources    []archive.Source
+	exclude    []string
+	targets    []target.Target
+	policy     retention.Policy
+	passphrase []byte
+	workdir    string
+	events     *notify.Client // told how each run went
+
+	mu      sync.Mutex
+	running bool
+	last    *runResult
+	next    time.Time // the next scheduled run
+}
+
+var errRunning = errors.New("a backup is already running")
+
+// run takes a backup, uploads it to each target, reads it back to check it,
+// then prunes what the retention policy no longer keeps. A target that fails
+// isn't pruned, so a failing backup never costs an older good one.
+func (b *backuper) run(ctx context.Context) (runResult, error) {
+	if !b.claim() {
+		return runResult{}, errRunning
+	}
+	return b.finish(b.take(ctx)), nil
+}
+
+// start runs a backup in the background
+func (b *backuper) start(ctx context.Context) error {
+	if !b.claim() {
+		return errRunning
+	}
+	go func() { b.finish(b.take(ctx)) }()
+	return nil
+}
+
+// claim marks a run as started, unless one already is
+func (b *backuper) claim() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.running {
+		return false
+	}
+	b.running = true
+	return true
+}
+
+func (b *backuper) finish(result runResult) runResult {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.running = false
+	b.last = &result
+	b.report(result)
+	return result
+}
+
+// report tells the notification hub how a run went
+func (b *backuper) report(result runResult) {
+	if result.ok() {
+		b.events.Send(notify.Message{Event: "backup_succeeded", Priority: notify.Low,
+			Title:  "Backup " + result.Name + " succeeded",
+			Text:   fmt.Sprintf("backed up %d files (%d bytes, %d stored) to %d targets", result.Files, result.Size, result.Stored, len(result.Targets)),
+			Fields: map[string]string{"name": result.Name}})
+		return
+	}
+	var problems []string
+	if result.Error != "" {
+		problems = append(problems, result.Error)
+	}
+	for _, t := range result.Targets {
+		if t.Error != "" {
+			problems = append(problems, t.Target+": "+t.Error)
+		}
+	}
+	b.events.Send(notify.Message{Event: "backup_failed", Priority: notify.High,
+		Title: "Backup " + result.Name + " failed", Text: strings.Join(problems, "\n"),
+		Fields: map[string]string{"name": result.Name}})
+}
+
+// status returns the last run, if any, whether one is running and when the
+// next is scheduled
+func (b *backuper) status() (*runResult, bool, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.last, b.running, b.next
+}
+
+func (b *backuper) setNext(at time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.next = at
+}
+
+func (b *backuper) take(ctx context.Context) (result runResult) {
+	result.Started = time.Now().UTC()
+	defer func() { result.Finished = time.Now().UTC() }()
+	result.Name = b.prefix + "-" + result.Started.Format(stampFormat) + plainExt
+	if len(b.passphrase) > 0 {
+		result.Name = b.prefix + "-" + result.Started.Format(stampFormat) + cryptExt
+	}
+	log.Printf("backing up to %s", result.Name)
+
+	tmp, err := os.CreateTemp(b.workdir, "backup-*"+plainExt)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer os.Remove(tmp.Name())
+	m, err := b.write(tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		result.Error = err.Error()
+		log.Printf("backup failed: %v", err)
+		return result
+	}
+	result.Files, result.Size = len(m.Files), m.Size()
+	if info, err := os.Stat(tmp.Name()); err == nil {
+		result.Stored = info.Size()
+	}
+
+	for _, t := range b.targets {
+		tr := targetResult{Target: t.String()}
+		err := t.Put(ctx, result.Name, tmp.Name())
+		if err == nil {
+			err = b.check(ctx, t, result.Name, m)
+		}
+		if err != nil {
+			tr.Error = err.Error()
+			log.Printf("%s: %v", t, err)
+		} else {
+			tr.Verified = true
+			tr.Pruned, err = b.prune(ctx, t)
+			if err != nil {
+				tr.Error = "pruning: " + err.Error()
+				log.Printf("%s: pruning: %v", t, err)
+			}
+		}
+		result.Targets = append(result.Targets, tr)
+	}
+	log.Printf("backed up %d files (%d bytes, %d stored) to %s", result.Files, result.Size, result.Stored, result.Name)
+	return result
+}
+
+// write writes a backup of the sources to w, encrypted if there's a passphrase
+func (b *backuper) write(w io.Writer) (archive.Manifest, error) {
+	host, _ := os.Hostname()
+	if len(b.passphrase) == 0 {
+		return archive.Create(w, b.sources, b.exclude, host)
+	}
+	enc, err := archive.Encrypt(w, b.passphrase)
+	if err != nil {
+		return archive.Manifest{}, err
+	}
+	m, err := archive.Create(enc, b.sources, b.exclude, host)
+	if err != nil {
+		return m, err
+	}
+	return m, enc.Close()
+}
+
+// check reads a backup back from t and verifies it is the one just written
+func (b *backuper) check(ctx context.Context, t target.Target, name string, want archive.Manifest) error {
+	got, err := b.verify(ctx, t, name)
+	if err != nil {
+		return fmt.Errorf("reading back %s: %w", name, err)
+	}
+	if !got.Created.Equal(want.Created) || len(got.Files) != len(want.Files) {
+		return fmt.Errorf("reading back %s: found a different backup", name)
+	}
+	return nil
+}
+
+// open returns a reader for a stored backup, decrypting it if need be
+func (b *backuper) open(ctx context.Context, t target.Target, name string) (io.Reader, io.Closer, error) {
+	r, err := t.Get(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !strings.HasSuffix(name, cryptExt) {
+		return r, r, nil
+	}
+	if len(b.passphrase) == 0 {
+		r.Close()
+		return nil, nil, errors.New("the backup is encrypted and BACKUP_PASSPHRASE isn't set")
+	}
+	plain, err := archive.Decrypt(r, b.passphrase)
+	if err != nil {
+		r.Close()
+		return nil, nil, err
+	}
+	return plain, r, nil
+}
+
+// verify reads a stored backup in full, checking every file
+func (b *backuper) verify(ctx context.Context, t target.Target, name string) (archive.Manifest, error) {
+	r, closer, err := b.open(ctx, t, name)
+	if err != nil {
+		return archive.Manifest{}, err
+	}
+	defer closer.Close()
+	return archive.Verify(r)
+}
+
+// restore extracts a stored backup into dir, which must not exist yet
+func (b *backuper) restore(ctx context.Context, t target.Target, name, dir string) (archive.Manifest, error) {
+	r, closer, err := b.open(ctx, t, name)
+	if err != nil {
+		return archive.Manifest{}, err
+	}
+	defer closer.Close()
+	return archive.Restore(r, dir)
+}
+
+// list returns this service's backups on t, newest first. Anything else in
+// the same place is left out, and so never pruned.
+func (b *backuper) list(ctx context.Context, t target.Target) ([]backup, error) {
+	objects, err := t.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var backups []backup
+	for _, o := range objects {
+		stamp, ok := strings.CutPrefix(o.Name, b.prefix+"-")
+		if !ok {
+			continue
+		}
+		encrypted := strings.HasSuffix(stamp, cryptExt)
+		stamp = strings.TrimSuffix(strings.TrimSuffix(stamp, cryptExt), plainExt)
+		at, err := time.Parse(stampFormat, stamp)
+		if err != nil || at.Format(stampFormat) != stamp {
+			continue
+		}
+		backups = append(backups, backup{Name: o.Name, Time: at, Size: o.Size, Encrypted: encrypted})
+	}
+	slices.SortFunc(backups, func(x, y backup) int { return y.Time.Compare(x.Time) })
+	return backups, nil
+}
+
+// has reports whether t holds a backup called name
+func (b *backuper) has(ctx context.Context, t target.Target, name string) bool {
+	backups, err := b.list(ctx, t)
+	if err != nil {
+		return false
+	}
+	return slices.ContainsFunc(backups, func(bk backup) bool { return bk.Name == name })
+}
+
+// prune deletes the backups on t that the retention policy doesn't keep,
+// counting days and weeks in local time
+func (b *backuper) prune(ctx context.Context, t target.Target) ([]string, error) {
+	backups, err := b.list(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	times := make([]time.Time, len(backups))
+	for i, bk := range backups {
+		times[i] = bk.Time.Local()
+	}
+	var pruned []string
+	for i, keep := range b.policy.Keep(times) {
+		if keep {
+			continue
+		}
+		if err := t.Delete(ctx, backups[i].Name); err != nil {
+			return pruned, err
+		}
+		log.Printf("%s: pruned %s", t, backups[i].Name)
+		pruned = append(pruned, backups[i].Name)
+	}
+	return pruned, nil
+}
+
+// newest returns when the newest backup on any target was taken
+func (b *backuper) newest(ctx context.Context) time.Time {
+	var newest time.Time
+	for _, t := range b.targets {
+		backups, err := b.list(ctx, t)
+		if err != nil {
+			log.Printf("%s: %v", t, err)
+			continue
+		}
+		if len(backups) > 0 && backups[0].Time.After(newest) {
+			newest = backups[0].Time
+		}
+	}
+	return newest
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// command runs one of the commands for use by hand, returning the exit code
+func command(b *backuper, args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch {
+	case args[0] == "run" && len(args) == 1:
+		result, err := b.run(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if result.Error != "" {
+			fmt.Fprintln(os.Stderr, result.Error)
+			return 1
+		}
+		fmt.Printf("%s: %d files, %d bytes (%d stored)\n", result.Name, result.Files, result.Size, result.Stored)
+		for _, t := range result.Targets {
+			switch {
+			case t.Error != "":
+				fmt.Printf("  %s: %s\n", t.Target, t.Error)
+			default:
+				fmt.Printf("  %s: verified, pruned %d\n", t.Target, len(t.Pruned))
+			}
+		}
+		if !result.ok() {
+			return 1
+		}
+		return 0
+
+	case args[0] == "list" && len(args) == 1:
+		failed := false
+		for _, t := range b.targets {
+			fmt.Println(t)
+			backups, err := b.list(ctx, t)
+			if err != nil {
+				fmt.Printf("  %v\n", err)
+				failed = true
+				continue
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			for _, bk := range backups {
+				fmt.Fprintf(w, "  %s\t%s\t%d\n", bk.Name, bk.Time.Local().Format(time.DateTime), bk.Size)
+			}
+			w.Flush()
+		}
+		if failed {
+			return 1
+		}
+		return 0
+
+	case args[0] == "verify" && len(args) == 2:
+		found, failed := false, false
+		for _, t := range b.targets {
+			if !b.has(ctx, t, args[1]) {
+				continue
+			}
+			found = true
+			m, err := b.verify(ctx, t, args[1])
+			if err != nil {
+				fmt.Printf("%s: %v\n", t, err)
+				failed = true
+				continue
+			}
+			fmt.Printf("%s: verified %d files, %d bytes, taken %s\n", t, len(m.Files), m.Size(), m.Created.Local().Format(time.DateTime))
+		}
+		if !found {
+			fmt.Fprintf(os.Stderr, "no target holds %s\n", args[1])
+			return 1
+		}
+		if failed {
+			return 1
+		}
+		return 0
+
+	case args[0] == "restore" && len(args) == 3:
+		for _, t := range b.targets {
+			if !b.has(ctx, t, args[1]) {
+				continue
+			}
+			m, err := b.restore(ctx, t, args[1], args[2])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", t, err)
+				return 1
+			}
+			fmt.Printf("restored %d files, %d bytes, from %s into %s\n", len(m.Files), m.Size(), t, args[2])
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "no target holds %s\n", args[1])
+		return 1
+	}
+
+	fmt.Fprintln(os.Stderr, "usage: backup-service [run | list | verify NAME | restore NAME DIR]")
+	return 2
+}
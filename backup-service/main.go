@@ -0,0 +1,346 @@
+// Command backup-service backs up the blockchain node's data directory, the
+// encrypted wallet keystores and the services' configs on a schedule, to a
+// local disk, another host over SFTP or an S3-compatible bucket.
+//
+// BACKUP_SOURCES lists what to back up as NAME=PATH pairs separated by
+// commas, such as "node=/var/lib/bchain,wallets=/home/me/.bchain/wallets,
+// config=/etc/shutdown-service.env"; each is stored under its name. Files and
+// directories whose names match a pattern in BACKUP_EXCLUDE (default
+// "*.tmp,*.pid,*.sock") are left out. Each backup is one gzipped tarball,
+// named BACKUP_PREFIX (default this machine's hostname) and the time, such as
+// server-20261016T030000Z.tar.gz, ending with a manifest of every file's size
+// and SHA-256. With BACKUP_PASSPHRASE, or BACKUP_PASSPHRASE_FILE holding it,
+// backups are encrypted with AES-256-GCM under a key derived from it, and
+// end in .enc; without it, anyone who can read a target can read the
+// backups, including any unencrypted wallet keys.
+//
+// BACKUP_TARGETS lists where to send backups, separated by commas: a path or
+// file:// URL such as a mounted USB drive, sftp://user@host[:port]/path
+// (using the sftp command's keys and known_hosts, /~/path for one under the
+// user's home) or s3://bucket/prefix?endpoint=URL&region=REGION (with
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY; the endpoint defaults to
+// AWS's). After uploading, the service reads each backup back from the
+// target and checks every file against the manifest, as a restore would.
+//
+// BACKUP_SCHEDULE is a cron expression for when to back up (default
+// "0 3 * * *", 3am daily, in local time). If a scheduled backup was missed
+// because the machine was off, one is taken at startup. BACKUP_RETENTION
+// says which backups to keep on each target once a new one has checked out
+// there (default "last=7,daily=14,weekly=8,monthly=12", also yearly=N); an
+// empty policy keeps everything. Other files in a target are left alone.
+// BACKUP_WORKDIR is where backups are assembled before uploading (default
+// the system's temp directory).
+//
+// GET /api/v1/backups lists the backups on each target with the last run and
+// the next scheduled one. POST /api/v1/backups starts a backup now, answering
+// 409 if one is running. POST /api/v1/backups/NAME/verify?target=N reads
+// a stored backup back from target N (default 0, the first) and checks it.
+//
+// NOTIFY_URL, the address of notify-service, has it tell people how each
+// backup went, as event backup_failed (high priority) or backup_succeeded
+// (low), and when a backup fails verification through the API, as
+// verify_failed. NOTIFY_TOKEN is the hub's token.
+//
+// The same settings drive commands for use by hand: "backup-service run"
+// takes a backup and exits, failing if any target failed; "backup-service
+// list" lists the backups on each target; "backup-service verify NAME" checks
+// a backup on every target holding it; and "backup-service restore NAME DIR"
+// extracts it from the first target holding it into DIR, which must not
+// exist, checking every file before anything is left in DIR.
+//
+// Otherwise it serves as package httpserver describes, on LISTEN_ADDR
+// (default :8095) with BACKUP_TOKEN as its token, and registers with the
+// gateway as backup by default. Stopping it abandons a backup in progress.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/oksmith/home-server/backup-service/archive"
+	"github.com/oksmith/home-server/backup-service/retention"
+	"github.com/oksmith/home-server/backup-service/target"
+	"github.com/oksmith/home-server/pkg/config"
+	"github.com/oksmith/home-server/pkg/cron"
+	"github.com/oksmith/home-server/pkg/httpserver"
+	"github.com/oksmith/home-server/pkg/notify"
+	"github.com/oksmith/home-server/pkg/registry"
+	"github.com/oksmith/home-server/pkg/sigauth"
+)
+
+// settings are the service's settings
+var settings = []config.Field{
+	{Name: "BACKUP_SOURCES", Required: true},
+	{Name: "BACKUP_EXCLUDE", Default: "*.tmp,*.pid,*.sock"},
+	{Name: "BACKUP_PREFIX"},
+	{Name: "BACKUP_PASSPHRASE", Secret: true},
+	{Name: "BACKUP_PASSPHRASE_FILE"},
+	{Name: "BACKUP_TARGETS", Required: true},
+	{Name: "AWS_ACCESS_KEY_ID"},
+	{Name: "AWS_SECRET_ACCESS_KEY", Secret: true},
+	{Name: "AWS_SESSION_TOKEN", Secret: true},
+	{Name: "BACKUP_SCHEDULE", Default: "0 3 * * *", Check: func(s string) error {
+		_, err := cron.Parse(s)
+		return err
+	}},
+	{Name: "BACKUP_RETENTION", Default: "last=7,daily=14,weekly=8,monthly=12", Check: func(s string) error {
+		_, err := retention.Parse(s)
+		return err
+	}},
+	{Name: "BACKUP_WORKDIR"},
+	{Name: "LISTEN_ADDR", Default: ":8095", Check: config.HostPort},
+	{Name: "BACKUP_TOKEN", Secret: true, Reload: true},
+	{Name: "TLS_CERT"},
+	{Name: "TLS_KEY"},
+	{Name: "GATEWAY_URL", Check: config.HTTPURL},
+	{Name: "GATEWAY_REGISTRY_TOKEN", Secret: true},
+	{Name: "GATEWAY_NAME", Default: "backup"},
+	{Name: "GATEWAY_SERVICE_URL", Check: config.HTTPURL},
+	{Name: "AUTHORIZED_KEYS"},
+	{Name: "SERVICE_KEY"},
+	{Name: "NOTIFY_URL", Check: config.HTTPURL},
+	{Name: "NOTIFY_TOKEN", Secret: true, Reload: true},
+}
+
+// load reads the backup settings
+func load(cfg *config.Config) (*backuper, error) {
+	b := &backuper{
+		prefix:  cfg.Get("BACKUP_PREFIX"),
+		exclude: cfg.List("BACKUP_EXCLUDE"),
+		workdir: cfg.Get("BACKUP_WORKDIR"),
+	}
+	if b.prefix == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		b.prefix = host
+	}
+	if strings.ContainsAny(b.prefix, `/\"`) {
+		return nil, fmt.Errorf("BACKUP_PREFIX %q can't contain slashes or quotes", b.prefix)
+	}
+
+	for _, pair := range cfg.List("BACKUP_SOURCES") {
+		name, path, ok := strings.Cut(pair, "=")
+		if !ok || name == "" || path == "" {
+			return nil, fmt.Errorf("BACKUP_SOURCES: %q should be NAME=PATH", pair)
+		}
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("BACKUP_SOURCES: %w", err)
+		}
+		b.sources = append(b.sources, archive.Source{Name: name, Path: path})
+	}
+	if len(b.sources) == 0 {
+		return nil, errors.New("BACKUP_SOURCES must list what to back up, as NAME=PATH pairs")
+	}
+
+	// S3 targets take their keys from the environment, so pass on any from
+	// the settings file or a secret reference
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN"} {
+		if v := cfg.Get(name); v != os.Getenv(name) {
+			os.Setenv(name, v)
+		}
+	}
+	for _, raw := range cfg.List("BACKUP_TARGETS") {
+		t, err := target.Open(raw)
+		if err != nil {
+			return nil, fmt.Errorf("BACKUP_TARGETS: %w", err)
+		}
+		b.targets = append(b.targets, t)
+	}
+	if len(b.targets) == 0 {
+		return nil, errors.New("BACKUP_TARGETS must list where to send backups")
+	}
+
+	var err error
+	if b.policy, err = retention.Parse(cfg.Get("BACKUP_RETENTION")); err != nil {
+		return nil, fmt.Errorf("BACKUP_RETENTION: %w", err)
+	}
+
+	b.passphrase = []byte(cfg.Get("BACKUP_PASSPHRASE"))
+	if file := cfg.Get("BACKUP_PASSPHRASE_FILE"); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("BACKUP_PASSPHRASE_FILE: %w", err)
+		}
+		b.passphrase = []byte(strings.TrimRight(string(data), "\r\n"))
+		if len(b.passphrase) == 0 {
+			return nil, fmt.Errorf("BACKUP_PASSPHRASE_FILE: %s is empty", file)
+		}
+	}
+	return b, nil
+}
+
+// schedule takes a backup each time s matches until ctx is done, starting
+// with one straight away if a scheduled time has passed since the newest
+// backup, as happens when the machine was off
+func schedule(ctx context.Context, b *backuper, s *cron.Schedule) {
+	at, err := s.Next(b.newest(ctx))
+	for {
+		if err != nil {
+			log.Printf("BACKUP_SCHEDULE: %v", err)
+			return
+		}
+		if at.Before(time.Now()) {
+			log.Printf("a backup was due at %s, taking one now", at.Format(time.RFC3339))
+			at = time.Now()
+		} else {
+			log.Printf("next backup at %s", at.Format(time.RFC3339))
+		}
+		b.setNext(at)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(at)):
+		}
+		if _, err := b.run(ctx); errors.Is(err, errRunning) {
+			log.Printf("skipping the scheduled backup: %v", err)
+		}
+		at, err = s.Next(time.Now())
+	}
+}
+
+func main() {
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"), settings...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	b, err := load(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(os.Args) > 1 {
+		os.Exit(command(b, os.Args[1:]))
+	}
+
+	s, err := cron.Parse(cfg.Get("BACKUP_SCHEDULE"))
+	if err != nil {
+		log.Fatalf("BACKUP_SCHEDULE: %v", err)
+	}
+	addr := cfg.Get("LISTEN_ADDR")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go cfg.Watch(ctx, config.DefaultPoll)
+	go schedule(ctx, b, s)
+	log.Printf("backing up %d sources to %d targets, keeping %s", len(b.sources), len(b.targets), b.policy)
+
+	keys, err := sigauth.LoadKeyring(cfg.Get("AUTHORIZED_KEYS"))
+	if err != nil {
+		log.Fatalf("AUTHORIZED_KEYS: %v", err)
+	}
+	signer, err := sigauth.LoadSigner(cfg.Get("SERVICE_KEY"))
+	if err != nil {
+		log.Fatalf("SERVICE_KEY: %v", err)
+	}
+	b.events = notify.NewClient(cfg.Get("NOTIFY_URL"), "backup-service", func() string { return cfg.Get("NOTIFY_TOKEN") }, signer)
+
+	token := func() string { return cfg.Get("BACKUP_TOKEN") }
+	g := httpserver.NewGuard(httpserver.DefaultLimits)
+	auth := func(next http.HandlerFunc) http.Handler {
+		return httpserver.RequireAuth("backup-service", token, keys, g, next)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.Handle("GET /api/v1/backups", auth(func(w http.ResponseWriter, r *http.Request) {
+		type listing struct {
+			Target  string   `json:"target"`
+			Backups []backup `json:"backups"`
+			Error   string   `json:"error,omitempty"`
+		}
+		last, running, next := b.status()
+		resp := struct {
+			Targets []listing  `json:"targets"`
+			Last    *runResult `json:"last"`
+			Running bool       `json:"running"`
+			Next    time.Time  `json:"next"`
+			Policy  string     `json:"retention"`
+		}{Last: last, Running: running, Next: next, Policy: b.policy.String()}
+		for _, t := range b.targets {
+			l := listing{Target: t.String(), Backups: []backup{}}
+			if backups, err := b.list(r.Context(), t); err != nil {
+				l.Error = err.Error()
+			} else {
+				l.Backups = backups
+			}
+			resp.Targets = append(resp.Targets, l)
+		}
+		httpserver.WriteJSON(w, http.StatusOK, resp)
+	}))
+	mux.Handle("POST /api/v1/backups", auth(func(w http.ResponseWriter, r *http.Request) {
+		// The backup outlives the request, but not the service
+		if err := b.start(ctx); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		httpserver.WriteJSON(w, http.StatusAccepted, map[string]string{"status": "started"})
+	}))
+	mux.Handle("POST /api/v1/backups/{name}/verify", auth(func(w http.ResponseWriter, r *http.Request) {
+		index := 0
+		if s := r.URL.Query().Get("target"); s != "" {
+			if index, err = strconv.Atoi(s); err != nil || index < 0 || index >= len(b.targets) {
+				http.Error(w, fmt.Sprintf("target must be from 0 to %d", len(b.targets)-1), http.StatusBadRequest)
+				return
+			}
+		}
+		t := b.targets[index]
+		m, err := b.verify(r.Context(), t, r.PathValue("name"))
+		if err != nil {
+			b.events.Send(notify.Message{Event: "verify_failed", Priority: notify.High,
+				Title: "Backup " + r.PathValue("name") + " failed verification", Text: t.String() + ": " + err.Error(),
+				Fields: map[string]string{"name": r.PathValue("name"), "target": t.String()}})
+			httpserver.WriteJSON(w, http.StatusUnprocessableEntity, map[string]any{"target": t.String(), "verified": false, "error": err.Error()})
+			return
+		}
+		httpserver.WriteJSON(w, http.StatusOK, map[string]any{"target": t.String(), "verified": true, "created": m.Created, "files": len(m.Files), "size": m.Size()})
+	}))
+	metrics := httpserver.NewMetrics()
+	server := &http.Server{Addr: addr, Handler: g.Middleware(httpserver.InstrumentMux(metrics, slog.Default(), mux))}
+
+	certFile, keyFile := cfg.Get("TLS_CERT"), cfg.Get("TLS_KEY")
+	switch {
+	case certFile == "" && keyFile == "":
+		log.Printf("backup-service starting on %s", addr)
+	case certFile == "" || keyFile == "":
+		log.Fatal("TLS_CERT and TLS_KEY must be set together")
+	default:
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		log.Printf("backup-service starting on %s with TLS", addr)
+	}
+
+	var withdrawn chan struct{}
+	if gateway := cfg.Get("GATEWAY_URL"); gateway != "" {
+		s, err := registry.Local(cfg.Get("GATEWAY_NAME"), cfg.Get("GATEWAY_SERVICE_URL"), addr, server.TLSConfig != nil)
+		if err != nil {
+			log.Fatalf("GATEWAY_URL: %v", err)
+		}
+		withdrawn = make(chan struct{})
+		go func() {
+			registry.Announce(ctx, gateway, cfg.Get("GATEWAY_REGISTRY_TOKEN"), signer, func() registry.Service {
+				s.Token = token()
+				return s
+			}, registry.DefaultTTL/3)
+			close(withdrawn)
+		}()
+	}
+	if err := httpserver.ListenAndServe(ctx, server, certFile, keyFile); err != nil {
+		log.Fatal(err)
+	}
+	if withdrawn != nil {
+		<-withdrawn
+	}
+	log.Println("backup-service stopped")
+}
@@ -0,0 +1,117 @@
+// Package retention decides which backups to keep, in the style of keeping
+// the last few plus one a day, a week, a month and a year going back
+package retention
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy says how many backups to keep of each kind. A backup is kept if any
+// rule keeps it. The zero Policy keeps everything.
+type Policy struct {
+	Last    int // the most recent
+	Daily   int // the newest on each of this many days that have backups
+	Weekly  int // the newest in each of this many ISO weeks
+	Monthly int
+	Yearly  int
+}
+
+// Parse reads a policy such as "last=7,daily=14,weekly=8,monthly=12"
+func Parse(s string) (Policy, error) {
+	var p Policy
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(field, "=")
+		n, err := strconv.Atoi(value)
+		if !ok || err != nil || n < 0 {
+			return p, fmt.Errorf("bad retention %q, expected NAME=COUNT", field)
+		}
+		switch name {
+		case "last":
+			p.Last = n
+		case "daily":
+			p.Daily = n
+		case "weekly":
+			p.Weekly = n
+		case "monthly":
+			p.Monthly = n
+		case "yearly":
+			p.Yearly = n
+		default:
+			return p, fmt.Errorf("unknown retention %q, expected last, daily, weekly, monthly or yearly", name)
+		}
+	}
+	return p, nil
+}
+
+func (p Policy) String() string {
+	if p == (Policy{}) {
+		return "keep everything"
+	}
+	var fields []string
+	for _, f := range []struct {
+		name string
+		n    int
+	}{{"last", p.Last}, {"daily", p.Daily}, {"weekly", p.Weekly}, {"monthly", p.Monthly}, {"yearly", p.Yearly}} {
+		if f.n > 0 {
+			fields = append(fields, f.name+"="+strconv.Itoa(f.n))
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// Keep reports which of the backups taken at times to keep, in the same
+// order. Days, weeks and so on are taken in each time's location.
+func (p Policy) Keep(times []time.Time) []bool {
+	keep := make([]bool, len(times))
+	if p == (Policy{}) {
+		for i := range keep {
+			keep[i] = true
+		}
+		return keep
+	}
+
+	// Newest first, so each period keeps its newest backup
+	order := make([]int, len(times))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int { return times[b].Compare(times[a]) })
+
+	for i := 0; i < p.Last && i < len(order); i++ {
+		keep[order[i]] = true
+	}
+	rules := []struct {
+		n      int
+		period func(time.Time) string
+	}{
+		{p.Daily, func(t time.Time) string { return t.Format(time.DateOnly) }},
+		{p.Weekly, func(t time.Time) string {
+			y, w := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", y, w)
+		}},
+		{p.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+		{p.Yearly, func(t time.Time) string { return t.Format("2006") }},
+	}
+	for _, rule := range rules {
+		seen := map[string]bool{}
+		for _, i := range order {
+			if len(seen) == rule.n {
+				break
+			}
+			period := rule.period(times[i])
+			if !seen[period] {
+				seen[period] = true
+				keep[i] = true
+			}
+		}
+	}
+	return keep
+}
@@ -0,0 +1,70 @@
+package retention
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	p, err := Parse("last=3, daily=7,weekly=4,monthly=12,yearly=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Policy{Last: 3, Daily: 7, Weekly: 4, Monthly: 12, Yearly: 2}); p != want {
+		t.Errorf("got %+v, want %+v", p, want)
+	}
+	if got := p.String(); got != "last=3,daily=7,weekly=4,monthly=12,yearly=2" {
+		t.Errorf("String() = %q", got)
+	}
+	for _, bad := range []string{"last", "last=-1", "hourly=3", "daily=x"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Parse(%q) succeeded", bad)
+		}
+	}
+	if p, err := Parse(""); err != nil || p != (Policy{}) {
+		t.Errorf("Parse(\"\") = %+v, %v", p, err)
+	}
+}
+
+func TestKeepEverythingByDefault(t *testing.T) {
+	times := []time.Time{time.Now(), time.Now().Add(-time.Hour)}
+	for i, keep := range (Policy{}).Keep(times) {
+		if !keep {
+			t.Errorf("backup %d not kept", i)
+		}
+	}
+}
+
+func TestKeep(t *testing.T) {
+	// Two backups a day for 60 days, given oldest first
+	start := time.Date(2026, 1, 1, 3, 0, 0, 0, time.UTC)
+	var times []time.Time
+	for d := 0; d < 60; d++ {
+		day := start.AddDate(0, 0, d)
+		times = append(times, day, day.Add(12*time.Hour))
+	}
+	keep := Policy{Last: 3, Daily: 5, Weekly: 3, Monthly: 3}.Keep(times)
+
+	var kept []string
+	for i, k := range keep {
+		if k {
+			kept = append(kept, times[i].Format("01-02 15"))
+		}
+	}
+	want := []string{
+		"01-31 15", // newest in January
+		"02-15 15", // newest in week 7
+		"02-22 15", // newest in week 8
+		"02-25 15", "02-26 15", "02-27 15",
+		"02-28 15",             // newest in February, and one of the last three
+		"03-01 03", "03-01 15", // the rest of the last three
+	}
+	if len(kept) != len(want) {
+		t.Fatalf("kept %v, want %v", kept, want)
+	}
+	for i := range want {
+		if kept[i] != want[i] {
+			t.Fatalf("kept %v, want %v", kept, want)
+		}
+	}
+}
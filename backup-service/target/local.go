@@ -0,0 +1,107 @@
+package target
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tmpSuffix marks a file still being written
+const tmpSuffix = ".partial"
+
+// Local keeps backups in a directory
+type Local struct {
+	dir string
+}
+
+// NewLocal returns a target for dir, creating it if needed
+func NewLocal(dir string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Local{dir: dir}, nil
+}
+
+func (l *Local) String() string {
+	return l.dir
+}
+
+// Put copies filename in under a temporary name and renames it into place
+// once it is synced
+func (l *Local) Put(ctx context.Context, name, filename string) error {
+	if err := validName(name); err != nil {
+		return err
+	}
+	in, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := filepath.Join(l.dir, name+tmpSuffix)
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, readerWithContext{ctx, in})
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, filepath.Join(l.dir, name))
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+func (l *Local) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := validName(name); err != nil {
+		return nil, err
+	}
+	return os.Open(filepath.Join(l.dir, name))
+}
+
+func (l *Local) List(ctx context.Context) ([]Object, error) {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+	var objects []Object
+	for _, e := range entries {
+		if !e.Type().IsRegular() || strings.HasSuffix(e.Name(), tmpSuffix) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue // removed since the directory was read
+		}
+		objects = append(objects, Object{Name: e.Name(), Size: info.Size(), Modified: info.ModTime().UTC()})
+	}
+	return objects, nil
+}
+
+func (l *Local) Delete(ctx context.Context, name string) error {
+	if err := validName(name); err != nil {
+		return err
+	}
+	return os.Remove(filepath.Join(l.dir, name))
+}
+
+// readerWithContext stops a copy once ctx is done
+type readerWithContext struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r readerWithContext) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,176 @@
+package target
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// SFTP keeps backups in a directory on another host, running the system's
+// sftp command so the usual keys, agent and known_hosts apply. It runs in
+// batch mode, so the host must be known and the key needs no passphrase or
+// must be in the agent.
+type SFTP struct {
+	dest     string // user@host
+	port     string
+	identity string
+	dir      string
+}
+
+// newSFTP reads sftp://user@host[:port]/path[?identity=keyfile]. The path is
+// taken from the root; use /~/path for one under the user's home.
+func newSFTP(u *url.URL) (*SFTP, error) {
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("sftp target %s has no host", u.Redacted())
+	}
+	if _, ok := u.User.Password(); ok {
+		return nil, fmt.Errorf("sftp target %s has a password; use a key instead", u.Redacted())
+	}
+	s := &SFTP{dest: u.Hostname(), port: u.Port(), identity: u.Query().Get("identity"), dir: u.Path}
+	if u.User != nil {
+		s.dest = u.User.Username() + "@" + s.dest
+	}
+	s.dir = strings.TrimPrefix(s.dir, "/~/")
+	if s.dir == "" || s.dir == "/~" {
+		s.dir = "."
+	}
+	return s, nil
+}
+
+func (s *SFTP) String() string {
+	dir := s.dir
+	if !strings.HasPrefix(dir, "/") {
+		dir = "/~/" + dir
+	}
+	host := s.dest
+	if s.port != "" {
+		host += ":" + s.port
+	}
+	return "sftp://" + host + dir
+}
+
+// run runs sftp with a batch of commands, returning what it printed
+func (s *SFTP) run(ctx context.Context, commands ...string) ([]byte, error) {
+	args := []string{"-b", "-", "-o", "BatchMode=yes"}
+	if s.port != "" {
+		args = append(args, "-P", s.port)
+	}
+	if s.identity != "" {
+		args = append(args, "-i", s.identity)
+	}
+	cmd := exec.CommandContext(ctx, "sftp", append(args, s.dest)...)
+	cmd.Stdin = strings.NewReader(strings.Join(commands, "\n") + "\n")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("sftp %s: %s", s.dest, msg)
+		}
+		return nil, fmt.Errorf("sftp %s: %w", s.dest, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+func (s *SFTP) path(name string) string {
+	return path.Join(s.dir, name)
+}
+
+// Put uploads under a temporary name and renames it into place. Commands
+// starting with - may fail without stopping the batch.
+func (s *SFTP) Put(ctx context.Context, name, filename string) error {
+	if err := validName(name); err != nil {
+		return err
+	}
+	tmp := s.path(name + tmpSuffix)
+	_, err := s.run(ctx,
+		"-mkdir "+quote(s.dir),
+		"-rm "+quote(tmp),
+		"put "+quote(filename)+" "+quote(tmp),
+		"-rm "+quote(s.path(name)),
+		"rename "+quote(tmp)+" "+quote(s.path(name)),
+	)
+	return err
+}
+
+// Get downloads to a temporary file, which is removed when it is closed
+func (s *SFTP) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := validName(name); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp("", "backup-*")
+	if err != nil {
+		return nil, err
+	}
+	tmp := f.Name()
+	f.Close()
+	if _, err := s.run(ctx, "get "+quote(s.path(name))+" "+quote(tmp)); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	f, err = os.Open(tmp)
+	if err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	return removeOnClose{f}, nil
+}
+
+func (s *SFTP) List(ctx context.Context) ([]Object, error) {
+	out, err := s.run(ctx, "ls -ln "+quote(s.dir))
+	if err != nil {
+		return nil, err
+	}
+	return parseListing(out), nil
+}
+
+// parseListing reads the regular files from sftp's ls -ln output, in which
+// the fifth field is the size and the last the path
+func parseListing(out []byte) []Object {
+	var objects []Object
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 9 || !strings.HasPrefix(fields[0], "-") {
+			continue // the echoed command, directories and links
+		}
+		size, err := strconv.ParseInt(fields[4], 10, 64)
+		name := path.Base(fields[len(fields)-1])
+		if err != nil || strings.HasSuffix(name, tmpSuffix) {
+			continue
+		}
+		objects = append(objects, Object{Name: name, Size: size})
+	}
+	return objects
+}
+
+func (s *SFTP) Delete(ctx context.Context, name string) error {
+	if err := validName(name); err != nil {
+		return err
+	}
+	_, err := s.run(ctx, "rm "+quote(s.path(name)))
+	return err
+}
+
+// quote quotes an argument for an sftp batch file
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// removeOnClose removes a temporary file once it has been read
+type removeOnClose struct {
+	*os.File
+}
+
+func (r removeOnClose) Close() error {
+	err := r.File.Close()
+	os.Remove(r.Name())
+	return err
+}
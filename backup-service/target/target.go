@@ -0,0 +1,63 @@
+// Package target stores backups somewhere other than the disk they were
+// taken from: a local directory such as a mounted USB drive, a host reached
+// over SFTP, or an S3-compatible bucket
+package target
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Object is a stored backup
+type Object struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified,omitzero"`
+}
+
+// Target is somewhere to keep backups. Names are plain file names without
+// slashes. Put must not leave a partial object under name if it fails.
+type Target interface {
+	Put(ctx context.Context, name, filename string) error
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	List(ctx context.Context) ([]Object, error)
+	Delete(ctx context.Context, name string) error
+	String() string // for logs, without credentials
+}
+
+// Open returns the target at a URL:
+//
+//	/mnt/backup or file:///mnt/backup         a local directory
+//	sftp://user@host[:port]/path              over the sftp command, with its keys and known_hosts
+//	s3://bucket/prefix?endpoint=URL&region=R  an S3-compatible bucket, with keys from
+//	                                          AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+func Open(raw string) (Target, error) {
+	if strings.HasPrefix(raw, "/") {
+		return NewLocal(raw)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "file":
+		return NewLocal(u.Path)
+	case "sftp":
+		return newSFTP(u)
+	case "s3":
+		return newS3(u)
+	}
+	return nil, fmt.Errorf("unknown target %q, expected a path or a file, sftp or s3 URL", u.Redacted())
+}
+
+// validName reports whether name is fine as an object name
+func validName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\\"\n\r") {
+		return fmt.Errorf("bad backup name %q", name)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/oksmith/home-server/blockchain/pkg/alert"
+	"github.com/oksmith/home-server/blockchain/pkg/node"
+)
+
+// alertsAdd registers a rule the node checks on every new block, notifying a
+// webhook or running a command when it fires
+func alertsAdd(ctx context.Context, args []string) error {
+	fs, opts := newFlags("alerts add", "RULE")
+	notify := fs.String("notify", node.NotifyWebhook, "How to notify: webhook or command")
+	hookURL := fs.String("url", "", "URL to POST the alert to, for -notify webhook")
+	command := fs.String("command", "", "Shell command the node runs, for -notify command")
+	adminToken := fs.String("admin-token", os.Getenv("NODE_ADMIN_TOKEN"), "Node's admin token (defaults to $NODE_ADMIN_TOKEN)")
+	args, err := opts.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	expr, err := resolveRuleAddress(opts.walletDir, args[0])
+	if err != nil {
+		return err
+	}
+	rule, err := alert.Parse(expr)
+	if err != nil {
+		return err
+	}
+	if *adminToken == "" {
+		return errors.New("adding an alert needs the node's admin token; set -admin-token or $NODE_ADMIN_TOKEN")
+	}
+
+	c := opts.client()
+	c.SetAdminToken(*adminToken)
+	a, err := c.AddAlert(ctx, node.AlertRequest{Rule: rule.String(), Notify: *notify, URL: *hookURL, Command: *command})
+	if err != nil {
+		return err
+	}
+	return opts.print(a, func(tw *tabwriter.Writer) {
+		fmt.Fprintf(tw, "ID\t%s\n", a.ID)
+		fmt.Fprintf(tw, "RULE\t%s\n", a.Rule)
+		fmt.Fprintf(tw, "NOTIFY\t%s\n", alertTarget(a))
+	})
+}
+
+// alertsList shows the node's alert rules and whether each is firing
+func alertsList(ctx context.Context, args []string) error {
+	fs, opts := newFlags("alerts list", "")
+	adminToken := fs.String("admin-token", os.Getenv("NODE_ADMIN_TOKEN"), "Node's admin token, needed to see where alerts notify (defaults to $NODE_ADMIN_TOKEN)")
+	if _, err := opts.parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	c := opts.client()
+	c.SetAdminToken(*adminToken)
+	alerts, err := c.Alerts(ctx)
+	if err != nil {
+		return err
+	}
+	return opts.print(alerts, func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "ID\tRULE\tNOTIFY\tFIRING\tLAST FIRED")
+		for _, a := range alerts {
+			lastFired := "-"
+			if a.LastFired != nil {
+				lastFired = a.LastFired.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%t\t%s\n", a.ID, a.Rule, alertTarget(a), a.Firing, lastFired)
+		}
+	})
+}
+
+// alertsRemove deletes an alert rule by ID
+func alertsRemove(ctx context.Context, args []string) error {
+	fs, opts := newFlags("alerts remove", "ID")
+	adminToken := fs.String("admin-token", os.Getenv("NODE_ADMIN_TOKEN"), "Node's admin token (defaults to $NODE_ADMIN_TOKEN)")
+	args, err := opts.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	c := opts.client()
+	c.SetAdminToken(*adminToken)
+	if err := c.RemoveAlert(ctx, args[0]); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Removed alert %s\n", args[0])
+	return nil
+}
+
+// resolveRuleAddress replaces a wallet name or payment URI inside a rule's
+// parentheses with its address, so "balance(alice) < 10" works
+func resolveRuleAddress(dir, expr string) (string, error) {
+	start, end := strings.Index(expr, "("), strings.Index(expr, ")")
+	if start < 0 || end < start {
+		return expr, nil
+	}
+	arg := strings.TrimSpace(expr[start+1 : end])
+	if arg == "" {
+		return expr, nil
+	}
+	address, err := resolveAddress(dir, arg)
+	if err != nil {
+		return "", err
+	}
+	return expr[:start+1] + address + expr[end:], nil
+}
+
+// alertTarget describes where an alert is sent, for tables. Without the admin
+// token the node only says how.
+func alertTarget(a node.Alert) string {
+	if a.URL == "" && a.Command == "" {
+		return a.Notify
+	}
+	if a.Notify == node.NotifyCommand {
+		return "command: " + a.Command
+	}
+	return "webhook: " + a.URL
+}
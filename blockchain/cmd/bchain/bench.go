@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"text/tabwriter"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+)
+
+// benchEstimate is the expected time to find one block at a difficulty
+type benchEstimate struct {
+	Difficulty     int     `json:"difficulty"`
+	ExpectedHashes float64 `json:"expected_hashes"`
+	SingleSeconds  float64 `json:"single_core_seconds"`
+	MultiSeconds   float64 `json:"multi_core_seconds,omitempty"`
+}
+
+// benchMine measures the local hash rate on one core and on every core, and
+// estimates how long a block takes to find at each difficulty
+func benchMine(ctx context.Context, args []string) error {
+	fs, opts := newFlags("bench mine", "")
+	difficulty := fs.Int("difficulty", 3, "Difficulty to mine at while measuring")
+	duration := fs.Duration("duration", 30*time.Second, "How long to measure each of the single and multi-core runs")
+	workers := fs.Int("workers", runtime.NumCPU(), "Goroutines for the multi-core run")
+	if _, err := opts.parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *difficulty < 0 || *difficulty > 64 {
+		return fmt.Errorf("difficulty must be between 0 and 64, got %d", *difficulty)
+	}
+	if *duration <= 0 || *workers < 1 {
+		return errors.New("-duration and -workers must be positive")
+	}
+
+	fmt.Fprintf(os.Stderr, "Mining at difficulty %d on 1 core for %v...\n", *difficulty, *duration)
+	single := block.Bench(ctx, *difficulty, 1, *duration)
+	var multi *block.BenchResult
+	if *workers > 1 && ctx.Err() == nil {
+		fmt.Fprintf(os.Stderr, "Mining at difficulty %d on %d workers for %v...\n", *difficulty, *workers, *duration)
+		result := block.Bench(ctx, *difficulty, *workers, *duration)
+		multi = &result
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Cover the difficulties around the one measured, and at least the common ones
+	var estimates []benchEstimate
+	for d := 1; d <= max(6, *difficulty+2); d++ {
+		e := benchEstimate{Difficulty: d, ExpectedHashes: block.ExpectedHashes(d)}
+		e.SingleSeconds = e.ExpectedHashes / single.HashRate
+		if multi != nil {
+			e.MultiSeconds = e.ExpectedHashes / multi.HashRate
+		}
+		estimates = append(estimates, e)
+	}
+
+	result := struct {
+		Difficulty int                `json:"difficulty"`
+		Single     block.BenchResult  `json:"single_core"`
+		Multi      *block.BenchResult `json:"multi_core,omitempty"`
+		Estimates  []benchEstimate    `json:"estimates"`
+	}{*difficulty, single, multi, estimates}
+	return opts.print(result, func(tw *tabwriter.Writer) {
+		fmt.Fprintf(tw, "SINGLE CORE\t%s (%d hashes, %d blocks found)\n", formatHashRate(single.HashRate), single.Hashes, single.Blocks)
+		if multi != nil {
+			fmt.Fprintf(tw, "MULTI CORE\t%s (%d workers, %.1fx single core)\n",
+				formatHashRate(multi.HashRate), multi.Workers, multi.HashRate/single.HashRate)
+		}
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "DIFFICULTY\tEXPECTED HASHES\tSINGLE CORE\tMULTI CORE")
+		for _, e := range estimates {
+			multiTime := "-"
+			if multi != nil {
+				multiTime = formatSeconds(e.MultiSeconds)
+			}
+			marker := ""
+			if e.Difficulty == *difficulty {
+				marker = " *"
+			}
+			fmt.Fprintf(tw, "%d%s\t%.0f\t%s\t%s\n", e.Difficulty, marker, e.ExpectedHashes, formatSeconds(e.SingleSeconds), multiTime)
+		}
+	})
+}
+
+// formatHashRate writes a hash rate with an SI prefix, e.g. "1.25 MH/s"
+func formatHashRate(rate float64) string {
+	for _, unit := range []string{"H/s", "kH/s", "MH/s", "GH/s"} {
+		if rate < 1000 || unit == "GH/s" {
+			return fmt.Sprintf("%.2f %s", rate, unit)
+		}
+		rate /= 1000
+	}
+	return ""
+}
+
+// formatSeconds writes an expected duration, switching to days and years
+// where a time.Duration would be unreadable or overflow
+func formatSeconds(s float64) string {
+	const day = 24 * 60 * 60
+	switch {
+	case s < 1:
+		return time.Duration(s * float64(time.Second)).Round(time.Microsecond).String()
+	case s < 60:
+		return time.Duration(s * float64(time.Second)).Round(time.Millisecond).String()
+	case s < 2*day:
+		return time.Duration(s * float64(time.Second)).Round(time.Second).String()
+	case s < 365*day:
+		return fmt.Sprintf("%.1f days", s/day)
+	default:
+		return fmt.Sprintf("%.3g years", s/(365*day))
+	}
+}
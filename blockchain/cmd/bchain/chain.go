@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/oksmith/home-server/blockchain/internal/chainsync"
+	"github.com/oksmith/home-server/blockchain/internal/term"
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+	"github.com/oksmith/home-server/blockchain/pkg/client"
+	"github.com/oksmith/home-server/blockchain/pkg/node"
+)
+
+// chainInfo shows the node's status summary
+func chainInfo(ctx context.Context, args []string) error {
+	fs, opts := newFlags("chain info", "")
+	if _, err := opts.parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	return showStatus(ctx, opts)
+}
+
+// showStatus prints the node's status summary
+func showStatus(ctx context.Context, opts *options) error {
+	st, err := opts.client().Status(ctx)
+	if err != nil {
+		return err
+	}
+	return opts.print(st, func(tw *tabwriter.Writer) {
+		fmt.Fprintf(tw, "NODE\t%s\n", st.Address)
+		fmt.Fprintf(tw, "VERSION\t%s\n", st.Version)
+		fmt.Fprintf(tw, "HEIGHT\t%d\n", st.Height)
+		fmt.Fprintf(tw, "TIP\t%s\n", st.BestBlockHash)
+		fmt.Fprintf(tw, "MEMPOOL\t%d\n", st.MempoolSize)
+		fmt.Fprintf(tw, "PEERS\t%d\n", st.PeerCount)
+		fmt.Fprintf(tw, "MINING\t%t\n", st.Mining.Enabled)
+		fmt.Fprintf(tw, "WALLET\t%s\n", st.WalletAddress)
+	})
+}
+
+// chainValidate downloads the node's chain and checks every block's hash,
+// proof of work and link to its parent
+func chainValidate(ctx context.Context, args []string) error {
+	fs, opts := newFlags("chain validate", "")
+	if _, err := opts.parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	c, err := opts.client().Chain(ctx)
+	if err != nil {
+		return fmt.Errorf("chain is invalid: %w", err)
+	}
+
+	tip := c.GetLatestBlock()
+	result := struct {
+		Valid  bool   `json:"valid"`
+		Height int64  `json:"height"`
+		Tip    string `json:"tip"`
+	}{true, tip.Index, tip.Hash}
+	return opts.print(result, func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "VALID\tHEIGHT\tTIP")
+		fmt.Fprintf(tw, "%t\t%d\t%s\n", result.Valid, result.Height, result.Tip)
+	})
+}
+
+// chainExport saves the node's gzip chain snapshot to a file or stdout
+func chainExport(ctx context.Context, args []string) error {
+	fs, opts := newFlags("chain export", "")
+	out := fs.String("o", "-", "File to write the snapshot to (- for stdout)")
+	if _, err := opts.parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	if *out == "-" {
+		return opts.client().ExportChain(ctx, os.Stdout)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := opts.client().ExportChain(ctx, f); err != nil {
+		f.Close()
+		os.Remove(*out)
+		return err
+	}
+	return f.Close()
+}
+
+// chainSync downloads another node's chain into a data directory, for
+// seeding a new node without running it
+func chainSync(ctx context.Context, args []string) error {
+	fs, opts := newFlags("chain sync", "")
+	from := fs.String("from", "", "Node to download the chain from, as host:port or a URL")
+	dataDir := fs.String("datadir", "", "Data directory to sync, created if missing (its node must be stopped)")
+	batch := fs.Int("batch", chainsync.DefaultBatchSize, "Blocks to request at a time")
+	quiet := fs.Bool("quiet", false, "Don't show progress")
+	if _, err := opts.parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *from == "" || *dataDir == "" {
+		return errors.New("-from and -datadir are required")
+	}
+
+	syncOpts := chainsync.Options{BatchSize: *batch}
+	bar := term.NewProgressBar(os.Stderr)
+	if !*quiet {
+		syncOpts.Progress = func(p chainsync.Progress) {
+			if p.Phase == chainsync.PhaseBlocks {
+				bar.Update("blocks", p.Done, p.Total)
+			}
+		}
+	}
+	result, err := chainsync.Sync(ctx, client.New(*from), *dataDir, syncOpts)
+	bar.Finish()
+	if err != nil {
+		if result.Downloaded > 0 {
+			fmt.Fprintf(os.Stderr, "Saved %d blocks; run the same command again to carry on.\n", result.Downloaded)
+		}
+		return err
+	}
+
+	return opts.print(result, func(tw *tabwriter.Writer) {
+		switch {
+		case result.Downloaded == 0:
+			fmt.Fprintf(tw, "Already up to date at height %d\n", result.Height)
+			return
+		case result.StartHeight < 0:
+			fmt.Fprintf(tw, "HEIGHT\t%d (new chain)\n", result.Height)
+		default:
+			fmt.Fprintf(tw, "HEIGHT\t%d (was %d)\n", result.Height, result.StartHeight)
+		}
+		fmt.Fprintf(tw, "TIP\t%s\n", result.Tip)
+		fmt.Fprintf(tw, "DOWNLOADED\t%d blocks\n", result.Downloaded)
+		if result.RolledBack > 0 {
+			fmt.Fprintf(tw, "ROLLED BACK\t%d blocks the peer's chain replaced\n", result.RolledBack)
+		}
+	})
+}
+
+// chainFsck checks the chain in a stopped node's data directory and can cut
+// it back to the last valid block
+func chainFsck(_ context.Context, args []string) error {
+	fs, opts := newFlags("chain fsck", "")
+	dataDir := fs.String("datadir", "", "Data directory of a stopped node")
+	repair := fs.Bool("repair", false, "Truncate the chain to the last valid block, keeping a copy of the original")
+	if _, err := opts.parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *dataDir == "" {
+		return errors.New("-datadir is required")
+	}
+
+	report, err := node.Fsck(*dataDir, *repair)
+	if report.Blocks > 0 || report.Fault != nil {
+		if printErr := printFsck(opts, report); printErr != nil {
+			return printErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if report.Fault != nil && !report.Repaired {
+		return fmt.Errorf("chain is corrupt from height %d (run with -repair to truncate it)", report.Fault.Height)
+	}
+	return nil
+}
+
+// printFsck prints a data directory check
+func printFsck(opts *options, report node.FsckReport) error {
+	return opts.print(report, func(tw *tabwriter.Writer) {
+		fmt.Fprintf(tw, "BLOCKS\t%d\n", report.Blocks)
+		fmt.Fprintf(tw, "SIGNATURES\t%d verified\n", report.Verified)
+		if report.Fault == nil {
+			fmt.Fprintf(tw, "STATUS\tok\n")
+			return
+		}
+		fmt.Fprintf(tw, "STATUS\tcorrupt\n")
+		fmt.Fprintf(tw, "FIRST BAD HEIGHT\t%d\n", report.Fault.Height)
+		if report.Fault.Hash != "" {
+			fmt.Fprintf(tw, "BLOCK\t%s\n", report.Fault.Hash)
+		}
+		if report.Fault.TxID != "" {
+			fmt.Fprintf(tw, "TRANSACTION\t%s\n", report.Fault.TxID)
+		}
+		fmt.Fprintf(tw, "REASON\t%s\n", report.Fault.Reason)
+		if report.Repaired {
+			fmt.Fprintf(tw, "REPAIRED\ttruncated to height %d\n", report.Height)
+			fmt.Fprintf(tw, "BACKUP\t%s\n", report.Backup)
+		}
+	})
+}
+
+// chainSide is one node's view in chain diff
+type chainSide struct {
+	Node   string `json:"node"`
+	Height int64  `json:"height"`
+	Tip    string `json:"tip"`
+}
+
+// chainDiffResult is where two nodes' chains diverge and what differs after
+type chainDiffResult struct {
+	A         chainSide      `json:"a"`
+	B         chainSide      `json:"b"`
+	ForkPoint int64          `json:"fork_point"` // last shared height, -1 for different genesis blocks
+	Verdict   string         `json:"verdict"`
+	BlocksA   []block.Header `json:"blocks_a"` // after the fork point, up to -max-blocks
+	BlocksB   []block.Header `json:"blocks_b"`
+	Truncated bool           `json:"truncated"` // more blocks follow than were compared
+	Txs       chain.ForkDiff `json:"transactions"`
+}
+
+// chainDiff compares two nodes' chains: where they diverge, the blocks each
+// has since, and the transactions only one of them confirmed
+func chainDiff(ctx context.Context, args []string) error {
+	fs, opts := newFlags("chain diff", "NODE_A NODE_B")
+	maxBlocks := fs.Int("max-blocks", 50, "Most blocks past the fork point to download from each node")
+	args, err := opts.parse(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	if *maxBlocks < 0 {
+		return errors.New("-max-blocks can't be negative")
+	}
+
+	clients := []*client.Client{client.New(args[0]), client.New(args[1])}
+	var headers [2][]block.Header
+	for i, c := range clients {
+		if headers[i], err = c.Headers(ctx, 0); err != nil {
+			return fmt.Errorf("%s: %w", args[i], err)
+		}
+		if len(headers[i]) == 0 {
+			return fmt.Errorf("%s: node returned no blocks", args[i])
+		}
+	}
+
+	fork := chain.ForkPoint(headers[0], headers[1])
+	result := chainDiffResult{ForkPoint: fork, BlocksA: []block.Header{}, BlocksB: []block.Header{}}
+	var blocks [2][]*block.Block
+	for i, c := range clients {
+		tip := headers[i][len(headers[i])-1]
+		side := chainSide{Node: args[i], Height: tip.Index, Tip: tip.Hash}
+		after := headers[i][fork+1:]
+		if len(after) > *maxBlocks {
+			after, result.Truncated = after[:*maxBlocks], true
+		}
+		for _, h := range after {
+			b, err := c.BlockByHash(ctx, h.Hash)
+			if err != nil {
+				return fmt.Errorf("%s: block %d: %w", args[i], h.Index, err)
+			}
+			blocks[i] = append(blocks[i], b)
+		}
+		if i == 0 {
+			result.A, result.BlocksA = side, after
+		} else {
+			result.B, result.BlocksB = side, after
+		}
+	}
+	result.Txs = chain.DiffBlocks(blocks[0], blocks[1])
+	result.Verdict = diffVerdict(result)
+
+	return opts.print(result, func(tw *tabwriter.Writer) {
+		fmt.Fprintf(tw, "A\t%s\theight %d\ttip %s\n", result.A.Node, result.A.Height, short(result.A.Tip))
+		fmt.Fprintf(tw, "B\t%s\theight %d\ttip %s\n", result.B.Node, result.B.Height, short(result.B.Tip))
+		if fork >= 0 {
+			fmt.Fprintf(tw, "COMMON ANCESTOR\theight %d\t%s\n", fork, short(headers[0][fork].Hash))
+		}
+		fmt.Fprintf(tw, "VERDICT\t%s\n", result.Verdict)
+		if len(result.BlocksA) == 0 && len(result.BlocksB) == 0 {
+			return
+		}
+
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "HEIGHT\tA\tA TXS\tB\tB TXS")
+		for i := 0; i < max(len(result.BlocksA), len(result.BlocksB)); i++ {
+			height := fork + 1 + int64(i)
+			a, aTxs := diffBlockCells(result.BlocksA, i)
+			b, bTxs := diffBlockCells(result.BlocksB, i)
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", height, a, aTxs, b, bTxs)
+		}
+		if result.Truncated {
+			fmt.Fprintf(tw, "...\tonly the first %d blocks after the fork are compared (-max-blocks)\n", *maxBlocks)
+		}
+
+		fmt.Fprintln(tw)
+		fmt.Fprintf(tw, "TRANSACTIONS\t%d on both sides, %d only on A, %d only on B (coinbases left out)\n",
+			result.Txs.Both, len(result.Txs.OnlyA), len(result.Txs.OnlyB))
+		if len(result.Txs.OnlyA)+len(result.Txs.OnlyB) == 0 {
+			return
+		}
+		fmt.Fprintln(tw, "ONLY ON\tTXID\tHEIGHT\tFROM\tTO\tAMOUNT")
+		for _, side := range []struct {
+			name string
+			txs  []chain.DiffTx
+		}{{"A", result.Txs.OnlyA}, {"B", result.Txs.OnlyB}} {
+			for _, tx := range side.txs {
+				fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\n", side.name, short(tx.TxID), tx.Height, short(tx.From), short(tx.To), formatAmount(tx.Amount))
+			}
+		}
+	})
+}
+
+// diffVerdict sums up how two chains relate
+func diffVerdict(r chainDiffResult) string {
+	switch {
+	case r.ForkPoint < 0:
+		return "different genesis blocks: the nodes are on different networks or settings"
+	case r.A.Tip == r.B.Tip:
+		return "in sync"
+	case r.ForkPoint == r.B.Height:
+		return fmt.Sprintf("no fork: B is %d blocks behind A", r.A.Height-r.B.Height)
+	case r.ForkPoint == r.A.Height:
+		return fmt.Sprintf("no fork: A is %d blocks behind B", r.B.Height-r.A.Height)
+	default:
+		return fmt.Sprintf("forked after height %d: A has %d blocks since, B has %d",
+			r.ForkPoint, r.A.Height-r.ForkPoint, r.B.Height-r.ForkPoint)
+	}
+}
+
+// diffBlockCells returns the hash and transaction count of blocks[i], or
+// dashes past the end
+func diffBlockCells(blocks []block.Header, i int) (string, string) {
+	if i >= len(blocks) {
+		return "-", "-"
+	}
+	return short(blocks[i].Hash), fmt.Sprint(blocks[i].TxCount)
+}
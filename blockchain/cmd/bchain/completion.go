@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/oksmith/home-server/blockchain/internal/nodecmd"
+	"github.com/oksmith/home-server/blockchain/pkg/node"
+)
+
+// completeCommand is the hidden command completion scripts call with the
+// words typed so far, the last being the one to complete
+const completeCommand = "__complete"
+
+// completionScripts are the shell scripts completion prints. Each hands the
+// words to "bchain __complete" and falls back to file names when it offers
+// nothing.
+var completionScripts = map[string]string{
+	"bash": `# bash completion for bchain. Load it with:
+#   source <(bchain completion bash)
+_bchain() {
+    local IFS=$'\n'
+    COMPREPLY=($(bchain __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _bchain bchain
+`,
+	"zsh": `# zsh completion for bchain. Load it with:
+#   source <(bchain completion zsh)
+_bchain() {
+    local -a candidates
+    candidates=(${(f)"$(bchain __complete "${(@)words[2,CURRENT]}" 2>/dev/null)"})
+    if (( ${#candidates} )); then
+        compadd -a candidates
+    else
+        _files
+    fi
+}
+compdef _bchain bchain
+`,
+	"fish": `# fish completion for bchain. Load it with:
+#   bchain completion fish | source
+function __bchain_complete
+    set -l candidates (bchain __complete (commandline -opc)[2..-1] (commandline -ct) 2>/dev/null)
+    if test (count $candidates) -gt 0
+        printf '%s\n' $candidates
+    else
+        __fish_complete_path (commandline -ct)
+    end
+end
+complete -c bchain -f -a '(__bchain_complete)'
+`,
+}
+
+// collectFlags, when set, receives a subcommand's flag set in place of
+// parsing its arguments, which then fail with errFlagsCollected. It lets
+// completion find each subcommand's flags without running it.
+var collectFlags func(fs *flag.FlagSet)
+
+var errFlagsCollected = errors.New("flags collected")
+
+// completionRun prints a shell's completion script
+func completionRun(_ context.Context, args []string) error {
+	fs, opts := newFlags("completion", "bash|zsh|fish")
+	args, err := opts.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	script, ok := completionScripts[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown shell %q (use bash, zsh or fish)", args[0])
+	}
+	fmt.Print(script)
+	return nil
+}
+
+// complete prints the candidates for the last of words, one per line
+func complete(words []string) {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	for _, c := range completions(words[:len(words)-1], words[len(words)-1]) {
+		fmt.Println(c)
+	}
+}
+
+// completions returns the commands, flags, flag values or wallet names that
+// could follow the typed words and start with cur
+func completions(typed []string, cur string) []string {
+	// Global flags before the command
+	for len(typed) > 0 && strings.HasPrefix(typed[0], "-") {
+		if typed[0] == "-output" || typed[0] == "--output" {
+			if len(typed) == 1 {
+				return matching([]string{outputTable, outputJSON, outputYAML}, cur)
+			}
+			typed = typed[1:]
+		}
+		typed = typed[1:]
+	}
+	if len(typed) == 0 {
+		if strings.HasPrefix(cur, "-") {
+			return matching([]string{"-output", "-json"}, cur)
+		}
+		var groups []string
+		for _, cmd := range commands {
+			if !slices.Contains(groups, cmd.group) {
+				groups = append(groups, cmd.group)
+			}
+		}
+		return matching(groups, cur)
+	}
+
+	cmd, rest, ok := findCommand(typed)
+	if !ok {
+		if len(typed) > 1 {
+			return nil
+		}
+		var names []string
+		for _, c := range commands {
+			if c.group == typed[0] {
+				names = append(names, c.name)
+			}
+		}
+		return matching(names, cur)
+	}
+
+	fs := commandFlags(cmd)
+	if fs == nil {
+		return nil
+	}
+
+	// The value of the flag before cur
+	if len(rest) > 0 {
+		prev := strings.TrimLeft(rest[len(rest)-1], "-")
+		if f := fs.Lookup(prev); f != nil && strings.HasPrefix(rest[len(rest)-1], "-") && !isBoolFlag(f) {
+			switch prev {
+			case "output":
+				return matching([]string{outputTable, outputJSON, outputYAML}, cur)
+			case "network":
+				return matching([]string{"main", "regtest"}, cur)
+			case "format":
+				switch {
+				case cmd.group == "tx":
+					return matching([]string{txFormatJSON, txFormatHex}, cur)
+				case cmd.name == "paper":
+					return matching([]string{paperHTML, paperText}, cur)
+				case cmd.name == "qr":
+					return matching([]string{qrText, qrPNG, qrSVG}, cur)
+				}
+				return matching([]string{historyTable, historyCSV, historyLedger, historyJSON}, cur)
+			case "notify":
+				return matching([]string{node.NotifyWebhook, node.NotifyCommand}, cur)
+			case "from", "to":
+				return matching(walletNames(walletDirFrom(rest)), cur)
+			}
+			return nil
+		}
+	}
+
+	if strings.HasPrefix(cur, "-") {
+		var names []string
+		fs.VisitAll(func(f *flag.Flag) { names = append(names, "-"+f.Name) })
+		return matching(names, cur)
+	}
+	if strings.Contains(cmd.args, "NAME") {
+		return matching(walletNames(walletDirFrom(rest)), cur)
+	}
+	return nil
+}
+
+// commandFlags returns a subcommand's flags, without running it
+func commandFlags(cmd command) *flag.FlagSet {
+	if cmd.group == "node" && cmd.name == "start" {
+		return nodecmd.Flags()
+	}
+
+	var fs *flag.FlagSet
+	collectFlags = func(f *flag.FlagSet) { fs = f }
+	defer func() { collectFlags = nil }()
+	cmd.run(context.Background(), nil)
+	return fs
+}
+
+// isBoolFlag reports whether a flag needs no value
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// walletDirFrom returns the -wallet-dir among typed words, or the default
+func walletDirFrom(words []string) string {
+	for i, w := range words {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(w, "-"), "=")
+		if name != "wallet-dir" || !strings.HasPrefix(w, "-") {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(words) {
+			return words[i+1]
+		}
+	}
+	return envOr("BCHAIN_WALLET_DIR", defaultWalletDir())
+}
+
+// walletNames lists the saved wallets' names
+func walletNames(dir string) []string {
+	paths, _ := filepath.Glob(filepath.Join(dir, "*"+walletExt))
+	names := make([]string, 0, len(paths))
+	for _, p := range paths {
+		names = append(names, strings.TrimSuffix(filepath.Base(p), walletExt))
+	}
+	return names
+}
+
+// matching returns the candidates starting with prefix
+func matching(candidates []string, prefix string) []string {
+	var out []string
+	for _, c := range candidates {
+		if c != "" && strings.HasPrefix(c, prefix) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
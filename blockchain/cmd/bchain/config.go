@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/oksmith/home-server/blockchain/internal/nodecmd"
+)
+
+// configInit writes a config file of every node setting and its default,
+// commented out, for node start -config
+func configInit(_ context.Context, args []string) error {
+	fs, opts := newFlags("config init", "")
+	out := fs.String("o", "-", "File to write the config to (- for stdout)")
+	if _, err := opts.parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := nodecmd.WriteDefaultConfig(&buf); err != nil {
+		return err
+	}
+	if *out == "-" {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s. Edit it, check it with \"bchain config check %s\", then run \"bchain node start -config %s\".\n", *out, *out, *out)
+	return nil
+}
+
+// configCheck checks a node config file and the machine it will run on,
+// failing if any check does
+func configCheck(_ context.Context, args []string) error {
+	fs, opts := newFlags("config check", "FILE")
+	args, err := opts.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	results := nodecmd.CheckConfig(args[0])
+	failed := 0
+	for _, r := range results {
+		if !r.OK {
+			failed++
+		}
+	}
+	err = opts.print(results, func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "CHECK\tRESULT\tDETAIL")
+		for _, r := range results {
+			result := "ok"
+			if !r.OK {
+				result = "FAIL"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Check, result, r.Detail)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/internal/term"
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+)
+
+// defaultConsoleLimit is how many blocks or transactions list commands show
+const defaultConsoleLimit = 10
+
+// consoleCommand is one command understood by the console
+type consoleCommand struct {
+	name    string
+	args    string // for help
+	summary string
+	// complete returns the candidates for argument i (0-based), if any
+	complete func(c *console, i int) []string
+	run      func(ctx context.Context, c *console, args []string) error
+}
+
+// consoleCommands lists the console's commands in the order help shows them.
+// "help" and "exit" are handled by the console itself.
+var consoleCommands = []consoleCommand{
+	{"status", "", "Node height, tip, mempool, peers and mining state", nil, consoleStatus},
+	{"blocks", "[N]", "The newest N blocks", nil, consoleBlocks},
+	{"block", "HEIGHT|HASH", "A block and its transactions", nil, consoleBlock},
+	{"tx", "TXID", "Whether a transaction is pending or confirmed", nil, consoleTx},
+	{"mempool", "[N]", "The next N pending transactions", nil, consoleMempool},
+	{"wallets", "", "Saved wallets and their addresses", nil, consoleWallets},
+	{"balance", "NAME|ADDRESS", "Confirmed balance of a wallet or address", completeWallets, consoleBalance},
+	{"send", "FROM TO AMOUNT", "Sign and submit a transaction from a saved wallet", completeWallets, consoleSend},
+	{"mine", "", "Mine one block now", nil, consoleMine},
+	{"mining", "start|stop", "Start or stop continuous mining", completeMining, consoleMining},
+	{"peers", "", "The node's peers", nil, consolePeers},
+}
+
+// console is an interactive session with one node
+type console struct {
+	opts *options
+	out  io.Writer
+}
+
+// consoleRun opens an interactive prompt attached to a node
+func consoleRun(ctx context.Context, args []string) error {
+	fs, opts := newFlags("console", "")
+	if _, err := opts.parse(fs, args, 0); err != nil {
+		return err
+	}
+	c := &console{opts: opts, out: os.Stdout}
+
+	// Ctrl-C interrupts the running command, not the whole console
+	ctx = context.WithoutCancel(ctx)
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		// Piped input runs as a script, one command per line
+		return c.runScript(ctx, os.Stdin)
+	}
+
+	st, err := opts.client().Status(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "Connected to %s (height %d). Type \"help\" for commands, Tab to complete.\n", opts.node, st.Height)
+
+	editor := term.NewLineEditor(os.Stdin, c.out)
+	editor.Prompt = "bchain> "
+	editor.Complete = c.complete
+	for {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		line, err := editor.ReadLine()
+		term.Restore(fd, state)
+
+		switch {
+		case errors.Is(err, term.ErrInterrupted):
+			continue
+		case errors.Is(err, io.EOF):
+			return nil
+		case err != nil:
+			return err
+		}
+		if c.exec(ctx, line) {
+			return nil
+		}
+	}
+}
+
+// runScript runs each line of r as a console command
+func (c *console) runScript(ctx context.Context, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if c.exec(ctx, scanner.Text()) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// exec runs one command line, reporting errors without ending the session.
+// It returns true when the command ends the session.
+func (c *console) exec(ctx context.Context, line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+		return false
+	}
+
+	switch fields[0] {
+	case "exit", "quit":
+		return true
+	case "help":
+		c.help()
+		return false
+	}
+
+	cmd, ok := findConsoleCommand(fields[0])
+	if !ok {
+		fmt.Fprintf(c.out, "unknown command %q, try \"help\"\n", fields[0])
+		return false
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	if err := cmd.run(ctx, c, fields[1:]); err != nil {
+		fmt.Fprintf(c.out, "error: %v\n", err)
+	}
+	return false
+}
+
+// help lists the console's commands
+func (c *console) help() {
+	tw := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	for _, cmd := range consoleCommands {
+		fmt.Fprintf(tw, "  %s %s\t%s\n", cmd.name, cmd.args, cmd.summary)
+	}
+	fmt.Fprintf(tw, "  help\tThis list\n")
+	fmt.Fprintf(tw, "  exit\tLeave the console (or Ctrl-D)\n")
+	tw.Flush()
+}
+
+// complete returns the completions of a partly typed command line
+func (c *console) complete(line string) []string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.HasSuffix(line, " ") {
+		fields = append(fields, "")
+	}
+	word := fields[len(fields)-1]
+	head := line[:len(line)-len(word)]
+
+	var candidates []string
+	if len(fields) == 1 {
+		candidates = []string{"help", "exit"}
+		for _, cmd := range consoleCommands {
+			candidates = append(candidates, cmd.name)
+		}
+	} else if cmd, ok := findConsoleCommand(fields[0]); ok && cmd.complete != nil {
+		candidates = cmd.complete(c, len(fields)-2)
+	}
+
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) {
+			matches = append(matches, head+candidate)
+		}
+	}
+	if len(matches) == 1 {
+		matches[0] += " " // ready for the next word
+	}
+	return matches
+}
+
+// findConsoleCommand looks up a console command by name
+func findConsoleCommand(name string) (consoleCommand, bool) {
+	for _, cmd := range consoleCommands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return consoleCommand{}, false
+}
+
+// wantArgs checks a command got between lo and hi arguments
+func wantArgs(args []string, lo, hi int, usage string) error {
+	if len(args) < lo || len(args) > hi {
+		return fmt.Errorf("usage: %s", usage)
+	}
+	return nil
+}
+
+// limitArg parses an optional count argument
+func limitArg(args []string) (int, error) {
+	if len(args) == 0 {
+		return defaultConsoleLimit, nil
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%q is not a positive number", args[0])
+	}
+	return n, nil
+}
+
+// completeWallets offers saved wallet names for the first two arguments
+func completeWallets(c *console, i int) []string {
+	if i > 1 {
+		return nil
+	}
+	wallets, _ := savedWallets(c.opts.walletDir)
+	names := make([]string, len(wallets))
+	for j, w := range wallets {
+		names[j] = w.Name
+	}
+	return names
+}
+
+// completeMining offers the mining subcommands
+func completeMining(_ *console, i int) []string {
+	if i > 0 {
+		return nil
+	}
+	return []string{"start", "stop"}
+}
+
+func consoleStatus(ctx context.Context, c *console, args []string) error {
+	if err := wantArgs(args, 0, 0, "status"); err != nil {
+		return err
+	}
+	return showStatus(ctx, c.opts)
+}
+
+func consoleBlocks(ctx context.Context, c *console, args []string) error {
+	if err := wantArgs(args, 0, 1, "blocks [N]"); err != nil {
+		return err
+	}
+	limit, err := limitArg(args)
+	if err != nil {
+		return err
+	}
+
+	headers, err := c.opts.client().RecentBlocks(ctx, limit)
+	if err != nil {
+		return err
+	}
+	return c.opts.print(headers, func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "HEIGHT\tHASH\tTXS\tTIME")
+		for _, h := range headers {
+			fmt.Fprintf(tw, "%d\t%s\t%d\t%s\n", h.Index, h.Hash, h.TxCount, h.Timestamp.Format(time.DateTime))
+		}
+	})
+}
+
+func consoleBlock(ctx context.Context, c *console, args []string) error {
+	if err := wantArgs(args, 1, 1, "block HEIGHT|HASH"); err != nil {
+		return err
+	}
+
+	var (
+		b   *block.Block
+		err error
+	)
+	if height, parseErr := strconv.ParseInt(args[0], 10, 64); parseErr == nil {
+		b, err = c.opts.client().BlockByHeight(ctx, height)
+	} else {
+		b, err = c.opts.client().BlockByHash(ctx, args[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.opts.print(b, func(tw *tabwriter.Writer) {
+		fmt.Fprintf(tw, "HEIGHT\t%d\n", b.Index)
+		fmt.Fprintf(tw, "HASH\t%s\n", b.Hash)
+		fmt.Fprintf(tw, "PREVIOUS\t%s\n", b.PreviousHash)
+		fmt.Fprintf(tw, "TIME\t%s\n", b.Timestamp.Format(time.DateTime))
+		fmt.Fprintf(tw, "NONCE\t%d\n", b.Nonce)
+		fmt.Fprintln(tw, "\nTXID\tFROM\tTO\tAMOUNT")
+		for _, tx := range b.Transactions {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%.2f\n", tx.ID, tx.From, tx.To, tx.Amount)
+		}
+	})
+}
+
+func consoleTx(ctx context.Context, c *console, args []string) error {
+	if err := wantArgs(args, 1, 1, "tx TXID"); err != nil {
+		return err
+	}
+	return showTx(ctx, c.opts, args[0])
+}
+
+func consoleMempool(ctx context.Context, c *console, args []string) error {
+	if err := wantArgs(args, 0, 1, "mempool [N]"); err != nil {
+		return err
+	}
+	limit, err := limitArg(args)
+	if err != nil {
+		return err
+	}
+
+	txs, err := c.opts.client().Mempool(ctx, limit)
+	if err != nil {
+		return err
+	}
+	return c.opts.print(txs, func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "TXID\tFROM\tTO\tAMOUNT")
+		for _, tx := range txs {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%.2f\n", tx.ID, tx.From, tx.To, tx.Amount)
+		}
+	})
+}
+
+func consoleWallets(_ context.Context, c *console, args []string) error {
+	if err := wantArgs(args, 0, 0, "wallets"); err != nil {
+		return err
+	}
+	return showWallets(c.opts)
+}
+
+func consoleBalance(ctx context.Context, c *console, args []string) error {
+	if err := wantArgs(args, 1, 1, "balance NAME|ADDRESS"); err != nil {
+		return err
+	}
+	return showBalance(ctx, c.opts, args[0])
+}
+
+func consoleSend(ctx context.Context, c *console, args []string) error {
+	if err := wantArgs(args, 3, 3, "send FROM TO AMOUNT"); err != nil {
+		return err
+	}
+	amount, err := strconv.ParseFloat(args[2], 64)
+	if err != nil || amount <= 0 {
+		return fmt.Errorf("%q is not a positive amount", args[2])
+	}
+	return sendTx(ctx, c.opts, args[0], args[1], amount, 0)
+}
+
+func consoleMine(ctx context.Context, c *console, args []string) error {
+	if err := wantArgs(args, 0, 0, "mine"); err != nil {
+		return err
+	}
+	if err := c.opts.client().Mine(ctx); err != nil {
+		return err
+	}
+	return showStatus(ctx, c.opts)
+}
+
+func consoleMining(ctx context.Context, c *console, args []string) error {
+	if err := wantArgs(args, 1, 1, "mining start|stop"); err != nil {
+		return err
+	}
+	switch args[0] {
+	case "start":
+		if err := c.opts.client().StartMining(ctx); err != nil {
+			return err
+		}
+		fmt.Fprintln(c.out, "mining started")
+	case "stop":
+		if err := c.opts.client().StopMining(ctx); err != nil {
+			return err
+		}
+		fmt.Fprintln(c.out, "mining stopped")
+	default:
+		return errors.New("usage: mining start|stop")
+	}
+	return nil
+}
+
+func consolePeers(ctx context.Context, c *console, args []string) error {
+	if err := wantArgs(args, 0, 0, "peers"); err != nil {
+		return err
+	}
+	peers, err := c.opts.client().Peers(ctx)
+	if err != nil {
+		return err
+	}
+	return c.opts.print(peers, func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "PEER")
+		for _, p := range peers {
+			fmt.Fprintln(tw, p)
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/oksmith/home-server/blockchain/internal/fuzzing"
+)
+
+// devFaucet has a regtest node pay funds to an address and mine them into a
+// block straight away
+func devFaucet(ctx context.Context, args []string) error {
+	fs, opts := newFlags("dev faucet", "NAME|ADDRESS AMOUNT")
+	args, err := opts.parse(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	amount, err := strconv.ParseFloat(args[1], 64)
+	if err != nil || !(amount > 0) {
+		return fmt.Errorf("invalid amount %q", args[1])
+	}
+	address, err := resolveAddress(opts.walletDir, args[0])
+	if err != nil {
+		return err
+	}
+
+	result, err := opts.client().Faucet(ctx, address, amount)
+	if err != nil {
+		return err
+	}
+	return opts.print(result, func(tw *tabwriter.Writer) {
+		fmt.Fprintf(tw, "ADDRESS\t%s\n", result.Address)
+		fmt.Fprintf(tw, "AMOUNT\t%.2f\n", result.Amount)
+		fmt.Fprintf(tw, "TXID\t%s\n", result.TxID)
+		fmt.Fprintf(tw, "HEIGHT\t%d\n", result.Height)
+		fmt.Fprintf(tw, "BLOCKS MINED\t%d\n", len(result.Hashes))
+	})
+}
+
+// devCorpus writes the raw bytes a fuzz corpus entry stands for, such as a
+// crasher go test -fuzz saved, so it can be looked at or sent to a node
+func devCorpus(ctx context.Context, args []string) error {
+	fs, opts := newFlags("dev corpus", "FILE")
+	input := fs.Int("input", 1, "Which of the entry's inputs to write, for targets taking more than one")
+	args, err := opts.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	inputs, err := fuzzing.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	if *input < 1 || *input > len(inputs) {
+		return fmt.Errorf("%s has %d inputs, so -input must be between 1 and %d", args[0], len(inputs), len(inputs))
+	}
+	_, err = os.Stdout.Write(inputs[*input-1])
+	return err
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/internal/term"
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/node"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+)
+
+// exploreFetchLimit is how many blocks and mempool transactions each refresh loads
+const exploreFetchLimit = 100
+
+// ANSI sequences used to draw the explorer
+const (
+	ansiAltScreen  = "\x1b[?1049h\x1b[?25l" // switch to the alternate screen and hide the cursor
+	ansiMainScreen = "\x1b[?25h\x1b[?1049l"
+	ansiHome       = "\x1b[H"
+	ansiClearLine  = "\x1b[K"
+	ansiClearBelow = "\x1b[J"
+	ansiReverse    = "\x1b[7m"
+	ansiBold       = "\x1b[1m"
+	ansiReset      = "\x1b[0m"
+)
+
+// Explorer panes, in Tab order
+const (
+	paneBlocks = iota
+	paneMempool
+	panePeers
+	paneCount
+)
+
+var paneTitles = [paneCount]string{"RECENT BLOCKS", "MEMPOOL", "PEERS"}
+
+// exploreSnapshot is one refresh's worth of node data
+type exploreSnapshot struct {
+	status  node.Status
+	blocks  []block.Header
+	mempool []*transaction.Transaction
+	peers   []string
+	err     error
+	at      time.Time
+}
+
+// explorer is the state of the terminal UI. Following the model/update/view
+// pattern, update changes it in response to keys and data, and view renders it.
+type explorer struct {
+	opts   *options
+	snap   exploreSnapshot
+	focus  int
+	cursor [paneCount]int
+
+	// detail is the open block or transaction view, nil when showing the panes
+	detail      []string
+	detailTitle string
+	detailTop   int
+
+	width, height int
+}
+
+// exploreRun shows a live terminal dashboard of a node
+func exploreRun(ctx context.Context, args []string) error {
+	fs, opts := newFlags("explore", "")
+	interval := fs.Duration("interval", 2*time.Second, "How often to refresh")
+	if _, err := opts.parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *interval <= 0 {
+		return errors.New("-interval must be positive")
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return errors.New("explore needs an interactive terminal")
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+
+	out := os.Stdout
+	fmt.Fprint(out, ansiAltScreen)
+	defer fmt.Fprint(out, ansiMainScreen)
+
+	e := &explorer{opts: opts}
+	e.width, e.height = terminalSize(int(out.Fd()))
+
+	keys := make(chan term.Key)
+	go readKeys(os.Stdin, keys)
+	resized := make(chan os.Signal, 1)
+	term.NotifyResize(resized)
+
+	snapshots := make(chan exploreSnapshot, 1)
+	fetching := false
+	refresh := func() {
+		if fetching {
+			return
+		}
+		fetching = true
+		go func() {
+			fetchCtx, cancel := context.WithTimeout(ctx, *interval*2)
+			defer cancel()
+			snapshots <- fetchSnapshot(fetchCtx, opts)
+		}()
+	}
+	refresh()
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		e.render(out)
+		select {
+		case <-ctx.Done():
+			return nil
+		case k, ok := <-keys:
+			if !ok || e.handleKey(ctx, k) {
+				return nil
+			}
+			if k == "r" {
+				refresh()
+			}
+		case snap := <-snapshots:
+			fetching = false
+			e.update(snap)
+		case <-ticker.C:
+			refresh()
+		case <-resized:
+			e.width, e.height = terminalSize(int(out.Fd()))
+		}
+	}
+}
+
+// terminalSize returns the terminal's size, or 80x24 if it can't be read
+func terminalSize(fd int) (int, int) {
+	w, h, err := term.Size(fd)
+	if err != nil || w <= 0 || h <= 0 {
+		return 80, 24
+	}
+	return w, h
+}
+
+// readKeys sends key presses from r until it fails
+func readKeys(r io.Reader, keys chan<- term.Key) {
+	defer close(keys)
+	buf := make([]byte, 64)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, k := range term.ParseKeys(buf[:n]) {
+			keys <- k
+		}
+	}
+}
+
+// fetchSnapshot loads everything the explorer shows
+func fetchSnapshot(ctx context.Context, opts *options) exploreSnapshot {
+	c := opts.client()
+	snap := exploreSnapshot{at: time.Now()}
+	if snap.status, snap.err = c.Status(ctx); snap.err != nil {
+		return snap
+	}
+	if snap.blocks, snap.err = c.RecentBlocks(ctx, exploreFetchLimit); snap.err != nil {
+		return snap
+	}
+	if snap.mempool, snap.err = c.Mempool(ctx, exploreFetchLimit); snap.err != nil {
+		return snap
+	}
+	snap.peers, snap.err = c.Peers(ctx)
+	return snap
+}
+
+// update takes in fresh data, keeping the last good data if the fetch failed
+func (e *explorer) update(snap exploreSnapshot) {
+	if snap.err != nil {
+		e.snap.err = snap.err
+		e.snap.at = snap.at
+		return
+	}
+	e.snap = snap
+	for p := range paneCount {
+		e.cursor[p] = max(0, min(e.cursor[p], e.rows(p)-1))
+	}
+}
+
+// rows returns how many rows a pane has
+func (e *explorer) rows(pane int) int {
+	switch pane {
+	case paneBlocks:
+		return len(e.snap.blocks)
+	case paneMempool:
+		return len(e.snap.mempool)
+	default:
+		return len(e.snap.peers)
+	}
+}
+
+// handleKey applies a key press, returning true to quit
+func (e *explorer) handleKey(ctx context.Context, k term.Key) bool {
+	switch k {
+	case "q", term.KeyCtrlC:
+		return true
+	}
+
+	if e.detail != nil {
+		switch k {
+		case term.KeyEscape, term.KeyBackspace, term.KeyLeft, "h":
+			e.detail = nil
+		case term.KeyUp, "k":
+			e.detailTop = max(0, e.detailTop-1)
+		case term.KeyDown, "j":
+			e.detailTop = min(max(0, len(e.detail)-1), e.detailTop+1)
+		}
+		return false
+	}
+
+	n := e.rows(e.focus)
+	page := max(1, e.paneHeight()-2)
+	switch k {
+	case term.KeyTab, term.KeyRight, "l":
+		e.focus = (e.focus + 1) % paneCount
+	case term.KeyBacktab, term.KeyLeft, "h":
+		e.focus = (e.focus + paneCount - 1) % paneCount
+	case term.KeyUp, "k":
+		e.cursor[e.focus] = max(0, e.cursor[e.focus]-1)
+	case term.KeyDown, "j":
+		e.cursor[e.focus] = max(0, min(n-1, e.cursor[e.focus]+1))
+	case term.KeyPageUp:
+		e.cursor[e.focus] = max(0, e.cursor[e.focus]-page)
+	case term.KeyPageDown:
+		e.cursor[e.focus] = max(0, min(n-1, e.cursor[e.focus]+page))
+	case term.KeyHome, "g":
+		e.cursor[e.focus] = 0
+	case term.KeyEnd, "G":
+		e.cursor[e.focus] = max(0, n-1)
+	case term.KeyEnter:
+		e.openDetail(ctx)
+	}
+	return false
+}
+
+// openDetail opens the selected block or transaction
+func (e *explorer) openDetail(ctx context.Context) {
+	i := e.cursor[e.focus]
+	switch {
+	case e.focus == paneBlocks && i < len(e.snap.blocks):
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		b, err := e.opts.client().BlockByHash(ctx, e.snap.blocks[i].Hash)
+		if err != nil {
+			e.snap.err = err
+			return
+		}
+		e.detailTitle = fmt.Sprintf("BLOCK %d", b.Index)
+		e.detail = blockDetail(b)
+	case e.focus == paneMempool && i < len(e.snap.mempool):
+		e.detailTitle = "PENDING TRANSACTION"
+		e.detail = txDetail(e.snap.mempool[i])
+	default:
+		return
+	}
+	e.detailTop = 0
+}
+
+// blockDetail lists a block's fields and transactions
+func blockDetail(b *block.Block) []string {
+	lines := []string{
+		"Height    " + fmt.Sprint(b.Index),
+		"Hash      " + b.Hash,
+		"Previous  " + b.PreviousHash,
+		"Time      " + b.Timestamp.Format(time.DateTime),
+		"Nonce     " + fmt.Sprint(b.Nonce),
+		"",
+		fmt.Sprintf("%d transactions:", len(b.Transactions)),
+	}
+	for _, tx := range b.Transactions {
+		lines = append(lines, "", "  "+tx.ID)
+		lines = append(lines, fmt.Sprintf("    %s -> %s  %.2f", tx.From, tx.To, tx.Amount))
+	}
+	return lines
+}
+
+// txDetail lists a transaction's fields
+func txDetail(tx *transaction.Transaction) []string {
+	return []string{
+		"ID      " + tx.ID,
+		"From    " + tx.From,
+		"To      " + tx.To,
+		"Amount  " + fmt.Sprintf("%.2f", tx.Amount),
+		"Time    " + tx.Timestamp.Format(time.DateTime),
+	}
+}
+
+// paneHeight is how many screen rows each pane gets, title included
+func (e *explorer) paneHeight() int {
+	// Two header lines, a footer, and a blank line between panes
+	return max(3, (e.height-3-(paneCount-1))/paneCount)
+}
+
+// render draws the whole screen
+func (e *explorer) render(w io.Writer) {
+	var b strings.Builder
+	b.WriteString(ansiHome)
+	for i, line := range e.view() {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(line)
+		b.WriteString(ansiClearLine)
+	}
+	b.WriteString(ansiClearBelow)
+	io.WriteString(w, b.String())
+}
+
+// view returns the screen's lines
+func (e *explorer) view() []string {
+	lines := []string{e.headerLine(), e.statusLine()}
+
+	if e.detail != nil {
+		lines = append(lines, ansiBold+e.detailTitle+ansiReset)
+		room := max(1, e.height-len(lines)-1)
+		end := min(len(e.detail), e.detailTop+room)
+		for _, l := range e.detail[e.detailTop:end] {
+			lines = append(lines, fit(l, e.width))
+		}
+		for len(lines) < e.height-1 {
+			lines = append(lines, "")
+		}
+		return append(lines, fit("↑/↓ scroll  Esc back  q quit", e.width))
+	}
+
+	for p := range paneCount {
+		if p > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, e.pane(p)...)
+	}
+	for len(lines) < e.height-1 {
+		lines = append(lines, "")
+	}
+	return append(lines, fit("Tab/←/→ switch pane  ↑/↓ move  Enter details  r refresh  q quit", e.width))
+}
+
+// headerLine summarises the chain tip
+func (e *explorer) headerLine() string {
+	st := e.snap.status
+	mining := "off"
+	if st.Mining.Enabled {
+		mining = "on"
+	}
+	line := fmt.Sprintf("%s  height %d  tip %s  mempool %d  peers %d  mining %s",
+		e.opts.node, st.Height, short(st.BestBlockHash), st.MempoolSize, st.PeerCount, mining)
+	return ansiBold + fit(line, e.width) + ansiReset
+}
+
+// statusLine shows when data was last refreshed, or the last error
+func (e *explorer) statusLine() string {
+	switch {
+	case e.snap.at.IsZero():
+		return "connecting..."
+	case e.snap.err != nil:
+		return fit(fmt.Sprintf("%s  error: %v", e.snap.at.Format(time.TimeOnly), e.snap.err), e.width)
+	default:
+		return fit("updated "+e.snap.at.Format(time.TimeOnly), e.width)
+	}
+}
+
+// pane renders one pane's title, column headings and visible rows
+func (e *explorer) pane(p int) []string {
+	title := paneTitles[p]
+	if p == e.focus {
+		title = ansiReverse + " " + title + " " + ansiReset
+	} else {
+		title = " " + title
+	}
+
+	var heading string
+	var rows []string
+	now := time.Now()
+	switch p {
+	case paneBlocks:
+		heading = fmt.Sprintf("%-8s %-18s %4s  %s", "HEIGHT", "HASH", "TXS", "AGE")
+		for _, h := range e.snap.blocks {
+			rows = append(rows, fmt.Sprintf("%-8d %-18s %4d  %s", h.Index, short(h.Hash), h.TxCount, age(now.Sub(h.Timestamp))))
+		}
+	case paneMempool:
+		heading = fmt.Sprintf("%-18s %-18s %-18s %10s", "TXID", "FROM", "TO", "AMOUNT")
+		for _, tx := range e.snap.mempool {
+			rows = append(rows, fmt.Sprintf("%-18s %-18s %-18s %10.2f", short(tx.ID), short(tx.From), short(tx.To), tx.Amount))
+		}
+	case panePeers:
+		heading = "ADDRESS"
+		rows = e.snap.peers
+	}
+
+	lines := []string{title, fit("  "+heading, e.width)}
+	visible := e.paneHeight() - 2
+	if len(rows) == 0 {
+		return append(lines, "  (none)")
+	}
+
+	// Scroll so the cursor stays on screen
+	top := max(0, e.cursor[p]-visible+1)
+	for i := top; i < len(rows) && i < top+visible; i++ {
+		line := fit("  "+rows[i], e.width)
+		if p == e.focus && i == e.cursor[p] {
+			line = ansiReverse + line + ansiReset
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// short abbreviates a hash or address for a table column
+func short(s string) string {
+	if len(s) <= 16 {
+		return s
+	}
+	return s[:8] + "…" + s[len(s)-7:]
+}
+
+// age formats how long ago something happened
+func age(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
+
+// fit cuts a line to the screen width
+func fit(s string, width int) string {
+	r := []rune(s)
+	if len(r) <= width {
+		return s
+	}
+	return string(r[:max(0, width-1)]) + "…"
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+)
+
+// Formats for history -format
+const (
+	historyTable  = "table"
+	historyCSV    = "csv"
+	historyLedger = "ledger"
+	historyJSON   = "json"
+)
+
+// historyPayees describes each kind of entry in ledger output
+var historyPayees = map[string]string{
+	chain.EntryMined:    "Mining reward",
+	chain.EntryReceived: "Received from %s",
+	chain.EntrySent:     "Sent to %s",
+	chain.EntrySelf:     "Transfer to self",
+}
+
+// historyRun exports an address's confirmed credits and debits with its
+// running balance
+func historyRun(ctx context.Context, args []string) error {
+	fs, opts := newFlags("history", "NAME|ADDRESS")
+	format := fs.String("format", historyTable, "Output format: table, csv, ledger or json")
+	account := fs.String("account", "Assets:Bchain", "Account holding the address, for -format ledger")
+	commodity := fs.String("commodity", "BCHAIN", "Commodity symbol for amounts, for -format ledger")
+	args, err := opts.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	switch *format {
+	case historyTable, historyCSV, historyLedger, historyJSON:
+	default:
+		return fmt.Errorf("unknown format %q (use table, csv, ledger or json)", *format)
+	}
+
+	address, err := resolveAddress(opts.walletDir, args[0])
+	if err != nil {
+		return err
+	}
+
+	// The node's /address endpoint is capped, so work from the full chain
+	c, err := opts.client().Chain(ctx)
+	if err != nil {
+		return err
+	}
+	entries := c.Statement(address)
+
+	switch *format {
+	case historyCSV:
+		return writeHistoryCSV(os.Stdout, entries)
+	case historyLedger:
+		return writeHistoryLedger(os.Stdout, entries, *account, *commodity)
+	case historyJSON:
+		opts.output = outputJSON
+	}
+	return opts.print(entries, func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "DATE\tHEIGHT\tKIND\tCREDIT\tDEBIT\tBALANCE\tCOUNTERPARTY\tTXID")
+		for _, e := range entries {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Time.Local().Format(time.DateTime), e.Height, e.Kind,
+				formatAmount(e.Credit), formatAmount(e.Debit), formatAmount(e.Balance), e.Counterparty, e.TxID)
+		}
+	})
+}
+
+// writeHistoryCSV writes entries as CSV with a header row, dated in UTC
+func writeHistoryCSV(w io.Writer, entries []chain.StatementEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"date", "height", "block_hash", "txid", "kind", "counterparty", "credit", "debit", "balance"})
+	for _, e := range entries {
+		cw.Write([]string{
+			e.Time.UTC().Format(time.RFC3339),
+			strconv.FormatInt(e.Height, 10),
+			e.BlockHash,
+			e.TxID,
+			e.Kind,
+			e.Counterparty,
+			formatAmount(e.Credit),
+			formatAmount(e.Debit),
+			formatAmount(e.Balance),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeHistoryLedger writes entries as ledger/hledger journal transactions,
+// asserting the running balance after each one so a bad import is caught
+func writeHistoryLedger(w io.Writer, entries []chain.StatementEntry, account, commodity string) error {
+	ew := &errWriter{w: w}
+	for i, e := range entries {
+		if i > 0 {
+			ew.printf("\n")
+		}
+		payee := historyPayees[e.Kind]
+		if e.Counterparty != "" {
+			payee = fmt.Sprintf(payee, e.Counterparty)
+		}
+		ew.printf("%s * %s\n", e.Time.UTC().Format(time.DateOnly), payee)
+		ew.printf("    ; txid: %s\n", e.TxID)
+		ew.printf("    ; height: %d\n", e.Height)
+
+		balance := fmt.Sprintf("= %s %s", formatAmount(e.Balance), commodity)
+		switch e.Kind {
+		case chain.EntryMined:
+			ew.printf("    %s  %s %s %s\n", account, formatAmount(e.Credit), commodity, balance)
+			ew.printf("    Income:Bchain:Mining\n")
+		case chain.EntryReceived:
+			ew.printf("    %s  %s %s %s\n", account, formatAmount(e.Credit), commodity, balance)
+			ew.printf("    Income:Bchain:Transfers\n")
+		case chain.EntrySent:
+			ew.printf("    %s  -%s %s %s\n", account, formatAmount(e.Debit), commodity, balance)
+			if e.Fee > 0 {
+				ew.printf("    Expenses:Bchain:Fees  %s %s\n", formatAmount(e.Fee), commodity)
+			}
+			ew.printf("    Expenses:Bchain:Transfers\n")
+		case chain.EntrySelf:
+			ew.printf("    %s  %s %s\n", account, formatAmount(e.Credit), commodity)
+			ew.printf("    %s  -%s %s %s\n", account, formatAmount(e.Debit), commodity, balance)
+			if e.Fee > 0 {
+				ew.printf("    Expenses:Bchain:Fees\n")
+			}
+		}
+	}
+	return ew.err
+}
+
+// errWriter keeps the first write error so a run of writes needs one check
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...any) {
+	if ew.err == nil {
+		_, ew.err = fmt.Fprintf(ew.w, format, args...)
+	}
+}
+
+// formatAmount writes an amount with up to 8 decimal places and no trailing
+// zeros, hiding float error from summing many amounts
+func formatAmount(v float64) string {
+	v = math.Round(v*1e8) / 1e8
+	if v == 0 {
+		v = 0 // no "-0"
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
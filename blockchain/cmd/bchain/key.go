@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/oksmith/home-server/blockchain/internal/term"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+// maxKeyFileSize bounds the file key import reads
+const maxKeyFileSize = 64 << 10
+
+// keyResult describes a key in the keystore
+type keyResult struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	wallet.KeyInfo
+}
+
+// keyNew creates a wallet and saves its key encrypted under a passphrase
+func keyNew(ctx context.Context, args []string) error {
+	fs, opts := newFlags("key new", "NAME")
+	args, err := opts.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	path, err := newKeyPath(opts.walletDir, args[0])
+	if err != nil {
+		return err
+	}
+	passphrase, err := newPassphrase(ctx)
+	if err != nil {
+		return err
+	}
+	w, err := wallet.New()
+	if err != nil {
+		return err
+	}
+	if err := w.SaveEncrypted(path, passphrase); err != nil {
+		return fmt.Errorf("failed to save key: %w", err)
+	}
+
+	return showKey(opts, args[0], path)
+}
+
+// keyImport copies a PEM key file into the keystore, encrypting it
+func keyImport(ctx context.Context, args []string) error {
+	fs, opts := newFlags("key import", "NAME FILE")
+	args, err := opts.parse(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	name, file := args[0], args[1]
+
+	path, err := newKeyPath(opts.walletDir, name)
+	if err != nil {
+		return err
+	}
+	data, err := readFileLimited(file, maxKeyFileSize)
+	if err != nil {
+		return err
+	}
+
+	// An encrypted key keeps its passphrase; a plain one gets a new one
+	w, err := wallet.DecodePEM(data, nil)
+	var passphrase []byte
+	switch {
+	case errors.Is(err, wallet.ErrPassphraseRequired):
+		if passphrase, err = term.ReadPassphrase(ctx, "Passphrase for "+file+": "); err != nil {
+			return err
+		}
+		if w, err = wallet.DecodePEM(data, passphrase); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	case err != nil:
+		return fmt.Errorf("%s: %w", file, err)
+	default:
+		if passphrase, err = newPassphrase(ctx); err != nil {
+			return err
+		}
+	}
+	if err := w.SaveEncrypted(path, passphrase); err != nil {
+		return fmt.Errorf("failed to save key: %w", err)
+	}
+
+	return showKey(opts, name, path)
+}
+
+// keyExport writes a key from the keystore to stdout or a file, encrypted as
+// stored unless -unencrypted is given
+func keyExport(ctx context.Context, args []string) error {
+	fs, opts := newFlags("key export", "NAME")
+	out := fs.String("o", "-", "File to write the key to (- for stdout)")
+	unencrypted := fs.Bool("unencrypted", false, "Decrypt the key, e.g. to use it as a node's wallet.pem")
+	args, err := opts.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	path, err := walletPath(opts.walletDir, args[0])
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("no key named %q in %s", args[0], opts.walletDir)
+	} else if err != nil {
+		return err
+	}
+
+	if *unencrypted {
+		w, err := loadKey(ctx, path, fmt.Sprintf("key %q", args[0]))
+		if err != nil {
+			return err
+		}
+		if data, err = w.EncodePEM(); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "Warning: the exported key is not encrypted; anyone who reads it can spend from this wallet.")
+	}
+
+	if *out == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// keyInspect shows a key's address and how it is protected, without asking
+// for its passphrase
+func keyInspect(_ context.Context, args []string) error {
+	fs, opts := newFlags("key inspect", "NAME|FILE")
+	args, err := opts.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	// A saved key by name, or else any key file by path
+	name, path := args[0], args[0]
+	if p, err := walletPath(opts.walletDir, name); err == nil {
+		if _, err := os.Stat(p); err == nil {
+			path = p
+		}
+	}
+	if path == args[0] {
+		name = ""
+	}
+	return showKey(opts, name, path)
+}
+
+// keyAuthorize prints the line for a service's AUTHORIZED_KEYS file that
+// trusts a key's signatures, so a service holding the key can call another
+// without a shared token
+func keyAuthorize(ctx context.Context, args []string) error {
+	fs, opts := newFlags("key authorize", "NAME|FILE")
+	as := fs.String("as", "", "Name the service knows the key by (defaults to the key's name)")
+	scopes := fs.String("scopes", "", "Comma-separated scopes to grant, for services that have them, e.g. wake,hosts")
+	args, err := opts.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	// A saved key by name, or else any key file by path
+	path := args[0]
+	if p, err := walletPath(opts.walletDir, args[0]); err == nil {
+		if _, err := os.Stat(p); err == nil {
+			path = p
+		}
+	}
+	name := *as
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(args[0]), ".pem")
+	}
+	if strings.ContainsAny(name, " \t#") {
+		return fmt.Errorf("key names can't hold spaces or #, as %q does", name)
+	}
+	w, err := loadKey(ctx, path, fmt.Sprintf("key %q", args[0]))
+	if err != nil {
+		return err
+	}
+	var granted []string
+	if *scopes != "" {
+		granted = strings.Split(*scopes, ",")
+	}
+	line, err := w.AuthorizedKey(name, granted...)
+	if err != nil {
+		return err
+	}
+	fmt.Println(line)
+	return nil
+}
+
+// showKey prints a key file's details
+func showKey(opts *options, name, path string) error {
+	info, err := inspectKey(path)
+	if err != nil {
+		return err
+	}
+
+	result := keyResult{Name: name, Path: path, KeyInfo: info}
+	return opts.print(result, func(tw *tabwriter.Writer) {
+		if name != "" {
+			fmt.Fprintf(tw, "NAME\t%s\n", name)
+		}
+		fmt.Fprintf(tw, "PATH\t%s\n", path)
+		fmt.Fprintf(tw, "ADDRESS\t%s\n", info.Address)
+		if info.Encrypted {
+			fmt.Fprintf(tw, "ENCRYPTED\t%s, %s with %d iterations\n", info.Cipher, info.KDF, info.Iterations)
+		} else {
+			fmt.Fprintf(tw, "ENCRYPTED\tno\n")
+		}
+		if st, err := os.Stat(path); err == nil && st.Mode().Perm()&0077 != 0 {
+			fmt.Fprintf(tw, "WARNING\treadable by other users (mode %o); run chmod 600 %s\n", st.Mode().Perm(), path)
+		}
+	})
+}
+
+// newKeyPath returns where a new key called name goes in the keystore,
+// creating the directory and refusing to overwrite an existing key
+func newKeyPath(dir, name string) (string, error) {
+	path, err := walletPath(dir, name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("a key named %q already exists", name)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create key directory: %w", err)
+	}
+	return path, nil
+}
+
+// newPassphrase asks for a passphrase twice on the terminal
+func newPassphrase(ctx context.Context) ([]byte, error) {
+	passphrase, err := term.ReadPassphrase(ctx, "New passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase is empty (use wallet new for an unencrypted key)")
+	}
+	again, err := term.ReadPassphrase(ctx, "Repeat passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(passphrase, again) {
+		return nil, errors.New("passphrases don't match")
+	}
+	return passphrase, nil
+}
@@ -0,0 +1,251 @@
+// Command bchain manages wallets and talks to a running node over its API
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/oksmith/home-server/blockchain/internal/yaml"
+	"github.com/oksmith/home-server/blockchain/pkg/client"
+)
+
+// Output modes for -output
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// defaultOutput is the -output every subcommand starts with: $BCHAIN_OUTPUT,
+// or -output given before the command
+var defaultOutput = envOr("BCHAIN_OUTPUT", outputTable)
+
+// command is one "bchain <group> <name>" subcommand, or "bchain <group>" when
+// name is empty
+type command struct {
+	group   string
+	name    string
+	args    string // positional arguments, for usage
+	summary string
+	run     func(ctx context.Context, args []string) error
+}
+
+// commands lists every subcommand in the order usage shows them
+var commands = []command{
+	{"wallet", "new", "NAME", "Create a wallet and save its key in the wallet directory", walletNew},
+	{"wallet", "list", "", "List saved wallets and their addresses", walletList},
+	{"wallet", "balance", "NAME|ADDRESS", "Show the confirmed balance of a wallet or address", walletBalance},
+	{"wallet", "qr", "NAME|ADDRESS", "Show a payment URI for a wallet as a QR code for phones to scan", walletQR},
+	{"wallet", "paper", "", "Create a wallet on a printable page only, for cold storage or gifts", walletPaper},
+	{"key", "new", "NAME", "Create a wallet whose key is encrypted under a passphrase", keyNew},
+	{"key", "import", "NAME FILE", "Encrypt a PEM key file into the wallet directory", keyImport},
+	{"key", "export", "NAME", "Write a saved key out, encrypted unless -unencrypted", keyExport},
+	{"key", "inspect", "NAME|FILE", "Show a key's address and encryption without its passphrase", keyInspect},
+	{"key", "authorize", "NAME|FILE", "Print the line that lets a key sign requests to a home-server service", keyAuthorize},
+	{"tx", "send", "", "Sign a transaction locally and submit it to the node", txSend},
+	{"tx", "create", "", "Sign a transaction without submitting it, for offline machines", txCreate},
+	{"tx", "broadcast", "FILE", "Submit a transaction written by tx create (- for stdin)", txBroadcast},
+	{"tx", "status", "TXID", "Show whether a transaction is pending or confirmed", txStatus},
+	{"history", "", "NAME|ADDRESS", "Export an address's credits and debits with its running balance", historyRun},
+	{"alerts", "add", "RULE", "Notify a webhook or run a command when a rule such as balance(NAME) < 10 holds on a new block", alertsAdd},
+	{"alerts", "list", "", "List the node's alert rules and whether each is firing", alertsList},
+	{"alerts", "remove", "ID", "Delete an alert rule", alertsRemove},
+	{"chain", "info", "", "Show the node's height, tip and mempool", chainInfo},
+	{"chain", "validate", "", "Download the node's chain and check every block", chainValidate},
+	{"chain", "export", "", "Save the node's gzip chain snapshot", chainExport},
+	{"chain", "sync", "", "Download another node's chain into a data directory, resuming if interrupted", chainSync},
+	{"chain", "fsck", "", "Check a stopped node's saved chain and optionally repair it", chainFsck},
+	{"chain", "diff", "NODE_A NODE_B", "Show where two nodes' chains diverge and which blocks and transactions differ", chainDiff},
+	{"bench", "mine", "", "Measure this machine's hash rate and time to find a block at each difficulty", benchMine},
+	{"dev", "faucet", "NAME|ADDRESS AMOUNT", "Pay funds to an address and mine them at once (regtest nodes only)", devFaucet},
+	{"dev", "corpus", "FILE", "Write the raw input of a fuzz corpus entry, such as a crasher, to stdout", devCorpus},
+	{"scenario", "run", "FILE", "Run a scripted story of wallets, transfers, mining and balance checks", scenarioRun},
+	{"node", "start", "[node flags]", "Run a node in the foreground (see cmd/node), or in the background with -daemon", nodeStart},
+	{"node", "stop", "", "Stop a node started with -daemon, by its pidfile", nodeStop},
+	{"node", "install-service", "[-- node flags]", "Write a systemd unit that runs a node at boot", nodeInstallService},
+	{"config", "init", "", "Write a commented node config file of every setting and its default", configInit},
+	{"config", "check", "FILE", "Check a node config file: values, free port, writable datadir, loadable key", configCheck},
+	{"testnet", "up", "", "Run a local regtest network of nodes peered with each other", testnetUp},
+	{"console", "", "", "Interactive prompt attached to a node", consoleRun},
+	{"explore", "", "", "Live terminal dashboard of the chain tip, blocks, mempool and peers", exploreRun},
+	{"version", "", "", "Show bchain's and the node's versions, commits and protocol and chain rule versions", versionRun},
+	{"completion", "", "bash|zsh|fish", "Print a shell completion script for commands, flags and wallet names", completionRun},
+}
+
+func main() {
+	args := globalFlags(os.Args[1:])
+	if len(args) > 0 && args[0] == completeCommand {
+		complete(args[1:])
+		return
+	}
+
+	cmd, args, ok := findCommand(args)
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := cmd.run(ctx, args); err != nil {
+		fmt.Fprintf(os.Stderr, "bchain %s: %v\n", cmd.title(), err)
+		os.Exit(1)
+	}
+}
+
+// globalFlags applies -output and -json given before the command, e.g.
+// "bchain -output json chain info", and returns the arguments after them
+func globalFlags(args []string) []string {
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(args[0], "-"), "=")
+		switch {
+		case name == "json" && !hasValue:
+			defaultOutput = outputJSON
+		case name == "output" && hasValue:
+			defaultOutput = value
+		case name == "output" && len(args) > 1:
+			defaultOutput = args[1]
+			args = args[1:]
+		default:
+			return args
+		}
+		args = args[1:]
+	}
+	return args
+}
+
+// findCommand matches the leading arguments to a command, returning the rest
+func findCommand(args []string) (command, []string, bool) {
+	for _, cmd := range commands {
+		switch {
+		case len(args) >= 1 && cmd.name == "" && cmd.group == args[0]:
+			return cmd, args[1:], true
+		case len(args) >= 2 && cmd.group == args[0] && cmd.name == args[1]:
+			return cmd, args[2:], true
+		}
+	}
+	return command{}, nil, false
+}
+
+// title is the command as typed, e.g. "tx send"
+func (c command) title() string {
+	return strings.TrimSpace(c.group + " " + c.name)
+}
+
+// usage prints the list of subcommands
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: bchain [-output table|json|yaml] <command> [flags] [args]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s %s\t%s\n", cmd.title(), cmd.args, cmd.summary)
+	}
+	w.Flush()
+	fmt.Fprintln(os.Stderr, "\nRun \"bchain <command> -h\" for a command's flags.")
+}
+
+// options holds the flags shared by every subcommand
+type options struct {
+	node      string
+	output    string
+	json      bool
+	walletDir string
+}
+
+// newFlags creates a subcommand's flag set with the shared flags registered
+func newFlags(name, args string) (*flag.FlagSet, *options) {
+	fs := flag.NewFlagSet("bchain "+name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bchain %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+
+	opts := &options{}
+	fs.StringVar(&opts.node, "node", envOr("BCHAIN_NODE", "localhost:8080"), "Node to talk to, as host:port or a URL (defaults to $BCHAIN_NODE)")
+	fs.StringVar(&opts.output, "output", defaultOutput, "Output format: table, json or yaml (defaults to $BCHAIN_OUTPUT)")
+	fs.BoolVar(&opts.json, "json", false, "Shorthand for -output json")
+	fs.StringVar(&opts.walletDir, "wallet-dir", envOr("BCHAIN_WALLET_DIR", defaultWalletDir()), "Directory holding wallet keys (defaults to $BCHAIN_WALLET_DIR)")
+	return fs, opts
+}
+
+// parse parses args and checks the shared flags, returning the positional
+// arguments after requiring exactly want of them. Flags may come before or
+// after positional arguments.
+func (o *options) parse(fs *flag.FlagSet, args []string, want int) ([]string, error) {
+	if collectFlags != nil {
+		collectFlags(fs)
+		return nil, errFlagsCollected
+	}
+
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	if o.json {
+		o.output = outputJSON
+	}
+	switch o.output {
+	case outputTable, outputJSON, outputYAML:
+	default:
+		return nil, fmt.Errorf("unknown output format %q (use table, json or yaml)", o.output)
+	}
+	if len(positional) != want {
+		fs.Usage()
+		return nil, fmt.Errorf("expected %d argument(s), got %d", want, len(positional))
+	}
+	return positional, nil
+}
+
+// client returns an API client for the -node address
+func (o *options) client() *client.Client {
+	return client.New(o.node)
+}
+
+// print writes v as indented JSON or YAML, or calls table to write it as
+// aligned columns
+func (o *options) print(v any, table func(w *tabwriter.Writer)) error {
+	switch o.output {
+	case outputJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case outputYAML:
+		return yaml.Encode(os.Stdout, v)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+// envOr returns the environment variable, or fallback when it is unset
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// defaultWalletDir is ~/.bchain/wallets, or a relative path if there is no home
+func defaultWalletDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".bchain", "wallets")
+	}
+	return filepath.Join(home, ".bchain", "wallets")
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/internal/nodecmd"
+)
+
+// nodeStart runs a node with cmd/node's flags until it is interrupted
+func nodeStart(_ context.Context, args []string) error {
+	return nodecmd.Run(args)
+}
+
+// nodeStop stops a node started with -daemon, by its pidfile
+func nodeStop(_ context.Context, args []string) error {
+	fs, opts := newFlags("node stop", "")
+	pidFile := fs.String("pidfile", "", "Pidfile of the node to stop (defaults to DATADIR/node.pid)")
+	dataDir := fs.String("datadir", "", "Data directory of the node to stop")
+	timeout := fs.Duration("timeout", time.Minute, "How long to wait for the node to save its state and exit")
+	if _, err := opts.parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *pidFile == "" {
+		if *dataDir == "" {
+			return errors.New("give the node's -pidfile or -datadir")
+		}
+		*pidFile = nodecmd.DefaultPIDFile(*dataDir)
+	}
+
+	pid, err := nodecmd.StopDaemon(*pidFile, *timeout)
+	if err != nil {
+		return err
+	}
+	result := struct {
+		PID     int    `json:"pid"`
+		PIDFile string `json:"pidfile"`
+	}{pid, *pidFile}
+	return opts.print(result, func(tw *tabwriter.Writer) {
+		fmt.Fprintf(tw, "Stopped node (pid %d)\n", pid)
+	})
+}
+
+// nodeInstallService writes a systemd unit that runs a node at boot. Node
+// flags for the unit go after "--".
+func nodeInstallService(_ context.Context, args []string) error {
+	fs, opts := newFlags("node install-service", "[-- node flags]")
+	name := fs.String("name", "bchain-node", "Name of the systemd service")
+	out := fs.String("o", "", "File to write the unit to (defaults to /etc/systemd/system/NAME.service; - for stdout)")
+	force := fs.Bool("force", false, "Replace an existing unit file")
+	runAs := fs.String("user", defaultServiceUser(), "User the node runs as")
+	dataDir := fs.String("datadir", "", "Data directory of the node (defaults to /var/lib/NAME)")
+	network := fs.String("network", "main", "Network: main or regtest")
+	port := fs.Int("port", 8080, "Port the node listens on")
+	listen := fs.String("listen", "", "Address the node binds to, e.g. 0.0.0.0:8080 (defaults to localhost:PORT)")
+	config := fs.String("config", "", "Node config file the service reads")
+	envFile := fs.String("env-file", "", "File of environment variables for the node, e.g. NODE_ADMIN_TOKEN=...")
+	binary := fs.String("binary", "", "bchain binary the service runs (defaults to this one)")
+
+	var nodeArgs []string
+	if i := slices.Index(args, "--"); i >= 0 {
+		args, nodeArgs = args[:i], args[i+1:]
+	}
+	if _, err := opts.parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	if *dataDir == "" {
+		*dataDir = "/var/lib/" + *name
+	}
+	if *binary == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		if *binary, err = filepath.EvalSymlinks(exe); err != nil {
+			return err
+		}
+	}
+	flags := []string{"-network", *network, "-port", strconv.Itoa(*port)}
+	if *listen != "" {
+		flags = append(flags, "-listen", *listen)
+	}
+	if *config != "" {
+		abs, err := filepath.Abs(*config)
+		if err != nil {
+			return err
+		}
+		flags = append(flags, "-config", abs)
+	}
+
+	var err error
+	svc := nodecmd.Service{
+		Name:    *name,
+		Binary:  *binary,
+		User:    *runAs,
+		EnvFile: *envFile,
+		Args:    append(flags, nodeArgs...),
+	}
+	if svc.DataDir, err = filepath.Abs(*dataDir); err != nil {
+		return err
+	}
+	if svc.EnvFile != "" {
+		if svc.EnvFile, err = filepath.Abs(svc.EnvFile); err != nil {
+			return err
+		}
+	}
+	if err := svc.Validate(); err != nil {
+		return err
+	}
+
+	unit := svc.Unit()
+	if *out == "-" {
+		fmt.Print(unit)
+		return nil
+	}
+	if *out == "" {
+		*out = filepath.Join("/etc/systemd/system", *name+".service")
+	}
+	mode := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if *force {
+		mode = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(*out, mode, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s already exists (use -force to replace it)", *out)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(unit); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Wrote %s. Start the node now and at every boot with:\n", *out)
+	fmt.Fprintf(os.Stderr, "  sudo systemctl daemon-reload\n  sudo systemctl enable --now %s\n", *name)
+	fmt.Fprintf(os.Stderr, "Follow its log with: journalctl -u %s -f\n", *name)
+	return nil
+}
+
+// defaultServiceUser is the user running bchain, or the one who ran sudo
+func defaultServiceUser() string {
+	if u := os.Getenv("SUDO_USER"); u != "" {
+		return u
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
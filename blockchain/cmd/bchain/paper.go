@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/qr"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+// Formats for wallet paper -format
+const (
+	paperHTML = "html"
+	paperText = "text"
+)
+
+// paperWallet is what a paper wallet page shows
+type paperWallet struct {
+	Address    string
+	Key        string // encrypted PEM
+	AddressQR  *qr.Code
+	KeyQR      *qr.Code
+	Created    time.Time
+	ImportHelp string
+}
+
+// paperPage lays a paper wallet out on one printed A4 or Letter page
+var paperPage = template.Must(template.New("paper").Funcs(template.FuncMap{
+	"svg": func(c *qr.Code) template.HTML { return template.HTML(c.SVG()) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Paper wallet {{printf "%.8s" .Address}}</title>
+<style>
+  @page { margin: 15mm; }
+  body { font-family: sans-serif; color: #000; max-width: 180mm; margin: 0 auto; }
+  h1 { font-size: 18pt; margin-bottom: 2mm; }
+  .created { color: #444; font-size: 9pt; }
+  .half { border: 1px dashed #888; padding: 5mm; margin-top: 6mm; page-break-inside: avoid; }
+  .half svg { float: left; width: 55mm; height: 55mm; margin-right: 5mm; }
+  .half.key svg { width: 70mm; height: 70mm; }
+  .half::after { content: ""; display: block; clear: both; }
+  h2 { font-size: 13pt; margin: 0 0 3mm; }
+  .mono { font-family: monospace; font-size: 8pt; word-break: break-all; white-space: pre-wrap; }
+  .note { font-size: 9pt; }
+</style>
+</head>
+<body>
+<h1>Home chain paper wallet</h1>
+<div class="created">Created {{.Created.Format "2 January 2006"}}</div>
+
+<div class="half">
+  {{svg .AddressQR}}
+  <h2>Address: share this to receive coins</h2>
+  <div class="mono">{{.Address}}</div>
+  <p class="note">Check its balance at any time with <code>bchain wallet balance ADDRESS</code>.</p>
+</div>
+
+<div class="half key">
+  {{svg .KeyQR}}
+  <h2>Private key: keep this secret</h2>
+  <p class="note">Encrypted under a passphrase that is not on this page. Without both, the coins can't be spent. Anyone with both can spend them.</p>
+  <p class="note">Passphrase hint: ______________________________</p>
+  <p class="note">{{.ImportHelp}}</p>
+  <div class="mono">{{.Key}}</div>
+</div>
+</body>
+</html>
+`))
+
+// walletPaper creates a wallet that exists only on paper: a printable page of
+// its address and passphrase-encrypted key, each with a QR code
+func walletPaper(ctx context.Context, args []string) error {
+	fs, opts := newFlags("wallet paper", "")
+	out := fs.String("o", "-", "File to write the page to (- for stdout)")
+	format := fs.String("format", paperHTML, "Page format: html to print from a browser, or text")
+	if _, err := opts.parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *format != paperHTML && *format != paperText {
+		return fmt.Errorf("unknown format %q (use html or text)", *format)
+	}
+
+	passphrase, err := newPassphrase(ctx)
+	if err != nil {
+		return err
+	}
+	w, err := wallet.New()
+	if err != nil {
+		return err
+	}
+	key, err := w.EncodeEncryptedPEM(passphrase)
+	if err != nil {
+		return err
+	}
+
+	page := paperWallet{
+		Address:    w.Address(),
+		Key:        string(key),
+		Created:    time.Now(),
+		ImportHelp: "To spend: scan or type the key, with its BEGIN and END lines, into a file such as key.pem, then run \"bchain key import NAME key.pem\" and enter the passphrase.",
+	}
+	if page.AddressQR, err = qr.Encode([]byte(page.Address), qr.M); err != nil {
+		return err
+	}
+	if page.KeyQR, err = qr.Encode(key, qr.M); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if *format == paperHTML {
+		err = paperPage.Execute(&buf, page)
+	} else {
+		writePaperText(&buf, page)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *out == "-" {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Wrote %s. Print it, then delete the file: the key isn't saved anywhere else.\n", *out)
+	result := struct {
+		Address string `json:"address"`
+		File    string `json:"file"`
+	}{page.Address, *out}
+	return opts.print(result, func(tw *tabwriter.Writer) {
+		fmt.Fprintf(tw, "ADDRESS\t%s\n", result.Address)
+		fmt.Fprintf(tw, "FILE\t%s\n", result.File)
+	})
+}
+
+// writePaperText lays a paper wallet out as plain text, with the QR codes
+// drawn in block characters for a monospaced printout
+func writePaperText(buf *bytes.Buffer, page paperWallet) {
+	rule := strings.Repeat("=", 72)
+	fmt.Fprintf(buf, "HOME CHAIN PAPER WALLET                       created %s\n", page.Created.Format("2006-01-02"))
+	fmt.Fprintln(buf, rule)
+	fmt.Fprintln(buf, "ADDRESS: share this to receive coins")
+	fmt.Fprintln(buf)
+	buf.WriteString(page.AddressQR.Text(false))
+	fmt.Fprintln(buf, page.Address)
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, rule)
+	fmt.Fprintln(buf, "PRIVATE KEY: keep this secret")
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "Encrypted under a passphrase that is not on this page. Without both, the")
+	fmt.Fprintln(buf, "coins can't be spent. Anyone with both can spend them.")
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "Passphrase hint: ______________________________")
+	fmt.Fprintln(buf)
+	buf.WriteString(page.KeyQR.Text(false))
+	buf.WriteString(page.Key)
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, page.ImportHelp)
+}
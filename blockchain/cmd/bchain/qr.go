@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/oksmith/home-server/blockchain/pkg/qr"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+// Formats for wallet qr -format
+const (
+	qrText = "text"
+	qrPNG  = "png"
+	qrSVG  = "svg"
+)
+
+// walletQR shows a payment URI for a wallet or address as a QR code, for a
+// phone on the LAN to scan and pay
+func walletQR(_ context.Context, args []string) error {
+	fs, opts := newFlags("wallet qr", "NAME|ADDRESS")
+	amount := fs.Float64("amount", 0, "Amount to ask for (left to the payer if unset)")
+	label := fs.String("label", "", "Who is being paid, shown to the payer")
+	format := fs.String("format", qrText, "Format: text for the terminal, png or svg")
+	out := fs.String("o", "-", "File to write the code to (- for stdout)")
+	scale := fs.Int("scale", 8, "Pixels per module in a PNG")
+	invert := fs.Bool("invert", false, "Swap dark and light in text, for terminals whose phone scans fail")
+	args, err := opts.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if *format != qrText && *format != qrPNG && *format != qrSVG {
+		return fmt.Errorf("unknown format %q (use text, png or svg)", *format)
+	}
+	if *amount < 0 {
+		return errors.New("-amount can't be negative")
+	}
+
+	address, err := resolveAddress(opts.walletDir, args[0])
+	if err != nil {
+		return err
+	}
+	if !wallet.ValidAddress(address) {
+		return fmt.Errorf("%q is neither a saved wallet nor an address", args[0])
+	}
+	uri := wallet.PaymentURI{Address: address, Amount: *amount, Label: *label}
+	code, err := qr.Encode([]byte(uri.String()), qr.M)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	switch *format {
+	case qrText:
+		data = []byte(code.Text(*invert) + uri.String() + "\n")
+	case qrPNG:
+		if data, err = code.PNG(*scale); err != nil {
+			return err
+		}
+	case qrSVG:
+		data = []byte(code.SVG() + "\n")
+	}
+
+	if *out == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(*out, data, 0644); err != nil {
+		return err
+	}
+	result := struct {
+		URI  string `json:"uri"`
+		File string `json:"file"`
+	}{uri.String(), *out}
+	return opts.print(result, func(tw *tabwriter.Writer) {
+		fmt.Fprintf(tw, "URI\t%s\n", result.URI)
+		fmt.Fprintf(tw, "FILE\t%s\n", result.File)
+	})
+}
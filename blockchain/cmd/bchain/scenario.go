@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/oksmith/home-server/blockchain/internal/scenario"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+// maxScenarioSize bounds the scenario file scenario run reads
+const maxScenarioSize = 1 << 20
+
+// scenarioRun runs a scenario file of wallet, transfer, mining and balance
+// steps against the node, stopping at the first step that fails
+func scenarioRun(ctx context.Context, args []string) error {
+	fs, opts := newFlags("scenario run", "FILE")
+	args, err := opts.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	data, err := readFileLimited(args[0], maxScenarioSize)
+	if err != nil {
+		return err
+	}
+	s, err := scenario.Parse(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+
+	// Names the scenario doesn't create fall back to saved wallets
+	runner := &scenario.Runner{
+		Client: opts.client(),
+		Wallet: func(ctx context.Context, name string) (*wallet.Wallet, error) {
+			return loadWallet(ctx, opts.walletDir, name)
+		},
+		Address: func(name string) (string, error) {
+			return resolveAddress(opts.walletDir, name)
+		},
+	}
+
+	// Table output streams each step as it finishes; JSON and YAML wait for
+	// the end
+	var results []scenario.Result
+	report := func(r scenario.Result) {
+		results = append(results, r)
+		if opts.output == outputTable {
+			status := "ok"
+			if !r.OK {
+				status = "FAIL"
+			}
+			fmt.Printf("%-4s  line %-4d  %s", status, r.Line, r.Step)
+			if r.Detail != "" {
+				fmt.Printf("  (%s)", r.Detail)
+			}
+			fmt.Println()
+		}
+	}
+	if s.Name != "" && opts.output == outputTable {
+		fmt.Fprintf(os.Stderr, "Running %q against %s\n", s.Name, opts.node)
+	}
+	runErr := runner.Run(ctx, s, report)
+
+	if opts.output != outputTable {
+		result := struct {
+			Name  string            `json:"name,omitempty"`
+			OK    bool              `json:"ok"`
+			Steps []scenario.Result `json:"steps"`
+		}{s.Name, runErr == nil, results}
+		if err := opts.print(result, func(*tabwriter.Writer) {}); err != nil {
+			return err
+		}
+	}
+	if runErr != nil {
+		return runErr
+	}
+	if opts.output == outputTable {
+		if len(results) == 1 {
+			fmt.Println("\nThe step passed.")
+		} else {
+			fmt.Printf("\nAll %d steps passed.\n", len(results))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/client"
+	"github.com/oksmith/home-server/blockchain/pkg/logging"
+	"github.com/oksmith/home-server/blockchain/pkg/node"
+)
+
+// testnetStartTimeout bounds how long testnet up waits for every node's API
+const testnetStartTimeout = 15 * time.Second
+
+// testnetStopTimeout is how long a node process gets to save and exit before
+// it is killed
+const testnetStopTimeout = 10 * time.Second
+
+// testnetMember is one node of a local testnet
+type testnetMember struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Wallet  string `json:"wallet"`
+	DataDir string `json:"datadir,omitempty"`
+	PID     int    `json:"pid,omitempty"` // 0 when the node runs in process
+}
+
+// testnetConfig is what every node of a testnet shares
+type testnetConfig struct {
+	nodes        int
+	basePort     int
+	difficulty   int
+	reward       float64
+	dataDir      string
+	syncInterval time.Duration
+	verbose      bool
+}
+
+// name and address of node i, and where it keeps its state
+func (cfg testnetConfig) name(i int) string    { return "node" + strconv.Itoa(i) }
+func (cfg testnetConfig) address(i int) string { return "localhost:" + strconv.Itoa(cfg.basePort+i) }
+func (cfg testnetConfig) dir(i int) string {
+	if cfg.dataDir == "" {
+		return ""
+	}
+	return filepath.Join(cfg.dataDir, cfg.name(i))
+}
+
+// peers lists every node's address except node i's
+func (cfg testnetConfig) peers(i int) []string {
+	var peers []string
+	for j := 0; j < cfg.nodes; j++ {
+		if j != i {
+			peers = append(peers, cfg.address(j))
+		}
+	}
+	return peers
+}
+
+// testnetUp starts a regtest network of nodes on sequential ports, all peered
+// with each other, and stops them all on Ctrl-C
+func testnetUp(ctx context.Context, args []string) error {
+	fs, opts := newFlags("testnet up", "")
+	cfg := testnetConfig{}
+	fs.IntVar(&cfg.nodes, "nodes", 3, "Number of nodes to start")
+	fs.IntVar(&cfg.basePort, "base-port", 18080, "Port of the first node; the rest count up from it")
+	fs.IntVar(&cfg.difficulty, "difficulty", node.MaxRegtestDifficulty, "Mining difficulty (regtest allows at most 1)")
+	fs.Float64Var(&cfg.reward, "reward", 50.0, "Mining reward")
+	fs.StringVar(&cfg.dataDir, "datadir", "", "Directory to keep each node's state in, under node0, node1, ... (empty keeps everything in memory)")
+	fs.DurationVar(&cfg.syncInterval, "sync-interval", 5*time.Second, "How often nodes reconcile with each other")
+	fs.BoolVar(&cfg.verbose, "verbose", false, "Show the nodes' logs on stderr")
+	inProcess := fs.Bool("in-process", false, "Run the nodes inside this process instead of as separate node processes")
+	if _, err := opts.parse(fs, args, 0); err != nil {
+		return err
+	}
+	if cfg.nodes < 1 || cfg.basePort < 1 || cfg.basePort+cfg.nodes-1 > 65535 {
+		return fmt.Errorf("-nodes and -base-port must give ports between 1 and 65535")
+	}
+	if cfg.difficulty < 0 || cfg.difficulty > node.MaxRegtestDifficulty {
+		return fmt.Errorf("difficulty must be between 0 and %d on regtest", node.MaxRegtestDifficulty)
+	}
+	for i := 0; i < cfg.nodes; i++ {
+		if err := checkPortFree(cfg.address(i)); err != nil {
+			return err
+		}
+	}
+
+	start := startTestnetProcesses
+	if *inProcess {
+		start = startTestnetInProcess
+	}
+	members, shutdown, err := start(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer shutdown()
+
+	err = opts.print(members, func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "NAME\tAPI\tWALLET\tPID\tDATADIR")
+		for _, m := range members {
+			pid := "-"
+			if m.PID != 0 {
+				pid = strconv.Itoa(m.PID)
+			}
+			fmt.Fprintf(tw, "%s\thttp://%s\t%s\t%s\t%s\n", m.Name, m.Address, m.Wallet, pid, orDash(m.DataDir))
+		}
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "\n%d nodes running on regtest. Press Ctrl-C to stop them.\n", len(members))
+
+	<-ctx.Done()
+	fmt.Fprintln(os.Stderr, "Stopping nodes...")
+	return nil
+}
+
+// startTestnetProcesses runs each node as a "bchain node start" process
+func startTestnetProcesses(ctx context.Context, cfg testnetConfig) ([]testnetMember, func(), error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var procs []testnetProcess
+	exited := make(chan error, cfg.nodes)
+	shutdown := func() { stopProcesses(procs) }
+	for i := 0; i < cfg.nodes; i++ {
+		args := []string{"node", "start",
+			"-network", "regtest",
+			"-port", strconv.Itoa(cfg.basePort + i),
+			"-peers", strings.Join(cfg.peers(i), ","),
+			"-difficulty", strconv.Itoa(cfg.difficulty),
+			"-reward", strconv.FormatFloat(cfg.reward, 'f', -1, 64),
+			"-sync-interval", cfg.syncInterval.String(),
+		}
+		if dir := cfg.dir(i); dir != "" {
+			args = append(args, "-datadir", dir)
+		}
+		if !cfg.verbose {
+			args = append(args, "-log-level", "warn")
+		}
+
+		// Not CommandContext: Ctrl-C should let nodes save their state, not kill them
+		cmd := exec.Command(exe, args...)
+		cmd.Stderr = &prefixWriter{prefix: cfg.name(i) + " | "}
+		if err := cmd.Start(); err != nil {
+			shutdown()
+			return nil, nil, fmt.Errorf("failed to start %s: %w", cfg.name(i), err)
+		}
+		p := testnetProcess{cmd: cmd, done: make(chan struct{})}
+		procs = append(procs, p)
+		go func(name string) {
+			err := cmd.Wait()
+			close(p.done)
+			exited <- fmt.Errorf("%s exited: %v", name, err)
+		}(cfg.name(i))
+	}
+
+	members, err := waitForTestnet(ctx, cfg, exited)
+	if err != nil {
+		shutdown()
+		return nil, nil, err
+	}
+	for i := range members {
+		members[i].PID = procs[i].cmd.Process.Pid
+	}
+	return members, shutdown, nil
+}
+
+// testnetProcess is a running node process; done is closed once it exits
+type testnetProcess struct {
+	cmd  *exec.Cmd
+	done chan struct{}
+}
+
+// stopProcesses interrupts every node process so it saves its state, killing
+// any that don't exit in time
+func stopProcesses(procs []testnetProcess) {
+	var wg sync.WaitGroup
+	for _, p := range procs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.cmd.Process.Signal(os.Interrupt)
+			select {
+			case <-p.done:
+			case <-time.After(testnetStopTimeout):
+				p.cmd.Process.Kill()
+				<-p.done
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// startTestnetInProcess runs every node inside this process, each serving its
+// API on its own port
+func startTestnetInProcess(ctx context.Context, cfg testnetConfig) ([]testnetMember, func(), error) {
+	level := "warn"
+	if cfg.verbose {
+		level = "info"
+	}
+	logger, err := logging.New(os.Stderr, level, "text")
+	if err != nil {
+		return nil, nil, err
+	}
+	slog.SetDefault(logger)
+
+	var (
+		nodes   []*node.Node
+		servers []*http.Server
+	)
+	nodeCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	shutdown := func() {
+		cancel()
+		for _, srv := range servers {
+			srv.Close()
+		}
+		for _, n := range nodes {
+			n.Shutdown()
+			n.StopMining()
+			if err := n.SaveState(); err != nil {
+				slog.Warn("failed to save state", "node", n.Address, "err", err)
+			}
+		}
+	}
+
+	exited := make(chan error, cfg.nodes)
+	for i := 0; i < cfg.nodes; i++ {
+		n, err := openTestnetNode(cfg, i)
+		if err != nil {
+			shutdown()
+			return nil, nil, err
+		}
+		ln, err := net.Listen("tcp", cfg.address(i))
+		if err != nil {
+			shutdown()
+			return nil, nil, err
+		}
+		srv := &http.Server{Handler: n.Handler()}
+		nodes, servers = append(nodes, n), append(servers, srv)
+		go func(name string) {
+			if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+				exited <- fmt.Errorf("%s stopped serving: %v", name, err)
+			}
+		}(cfg.name(i))
+	}
+
+	// Every API is up, so peers can be added and greeted straight away
+	for i, n := range nodes {
+		n.StartPeerSessions(nodeCtx)
+		for _, peer := range cfg.peers(i) {
+			n.AddPeer(peer)
+		}
+		n.StartSyncLoop(nodeCtx, cfg.syncInterval)
+	}
+
+	members, err := waitForTestnet(ctx, cfg, exited)
+	if err != nil {
+		shutdown()
+		return nil, nil, err
+	}
+	return members, shutdown, nil
+}
+
+// openTestnetNode creates node i in regtest mode, from its data directory if
+// the testnet has one
+func openTestnetNode(cfg testnetConfig, i int) (*node.Node, error) {
+	var (
+		n   *node.Node
+		err error
+	)
+	if dir := cfg.dir(i); dir != "" {
+		n, err = node.Open(dir, cfg.address(i), cfg.difficulty, cfg.reward)
+	} else {
+		n, err = node.New(cfg.address(i), cfg.difficulty, cfg.reward)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.name(i), err)
+	}
+	if err := n.EnableRegtest(); err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.name(i), err)
+	}
+	return n, nil
+}
+
+// waitForTestnet polls each node's status until all of them answer, and
+// returns what they report. A node exiting early fails the wait.
+func waitForTestnet(ctx context.Context, cfg testnetConfig, exited <-chan error) ([]testnetMember, error) {
+	ctx, cancel := context.WithTimeout(ctx, testnetStartTimeout)
+	defer cancel()
+
+	members := make([]testnetMember, cfg.nodes)
+	for i := range members {
+		c := client.New(cfg.address(i))
+		for {
+			st, err := c.Status(ctx)
+			if err == nil {
+				members[i] = testnetMember{Name: cfg.name(i), Address: cfg.address(i), Wallet: st.WalletAddress, DataDir: cfg.dir(i)}
+				break
+			}
+			select {
+			case err := <-exited:
+				return nil, err
+			case <-ctx.Done():
+				return nil, fmt.Errorf("%s didn't start answering on %s: %w", cfg.name(i), cfg.address(i), ctx.Err())
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+	return members, nil
+}
+
+// checkPortFree fails if something is already listening on address
+func checkPortFree(address string) error {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("%s is not free: %w", address, err)
+	}
+	return ln.Close()
+}
+
+// testnetOutput serialises node log lines so they don't interleave
+var testnetOutput sync.Mutex
+
+// prefixWriter copies a node's log to stderr a line at a time, labelling
+// each line with the node's name
+type prefixWriter struct {
+	prefix string
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		testnetOutput.Lock()
+		fmt.Fprintf(os.Stderr, "%s%s\n", w.prefix, w.buf[:i])
+		testnetOutput.Unlock()
+		w.buf = w.buf[i+1:]
+	}
+}
+
+// orDash returns s, or "-" when it is empty
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
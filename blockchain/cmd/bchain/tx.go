@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/oksmith/home-server/blockchain/pkg/node"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+// txSend signs a transaction with a saved wallet and submits it to the node
+func txSend(ctx context.Context, args []string) error {
+	fs, opts := newFlags("tx send", "")
+	from := fs.String("from", "", "Name of the sending wallet")
+	to := fs.String("to", "", "Recipient address, saved wallet name or payment URI")
+	amount := fs.Float64("amount", 0, "Amount to send (defaults to a payment URI's amount)")
+	fee := fs.Float64("fee", 0, "Fee to pay the miner, on top of the amount")
+	if _, err := opts.parse(fs, args, 0); err != nil {
+		return err
+	}
+	if err := paymentTarget(*to, amount); err != nil {
+		return err
+	}
+	if *from == "" || *to == "" || *amount <= 0 {
+		return errors.New("-from, -to and a positive -amount are required")
+	}
+	if !(*fee >= 0) {
+		return errors.New("-fee can't be negative")
+	}
+
+	return sendTx(ctx, opts, *from, *to, *amount, *fee)
+}
+
+// sendTx signs a transaction from a saved wallet to a name or address,
+// submits it and prints the node's response
+func sendTx(ctx context.Context, opts *options, from, to string, amount, fee float64) error {
+	w, err := loadWallet(ctx, opts.walletDir, from)
+	if err != nil {
+		return err
+	}
+	recipient, err := resolveAddress(opts.walletDir, to)
+	if err != nil {
+		return err
+	}
+
+	tx := transaction.New(w.Address(), recipient, amount)
+	tx.Fee = fee
+	if err := tx.Sign(w.PrivateKey); err != nil {
+		return fmt.Errorf("failed to sign transaction: %w", err)
+	}
+	return submitTx(ctx, opts, tx)
+}
+
+// paymentTarget fills in amount from a payment URI given as the recipient,
+// when it is unset. The recipient itself is resolved with the others by
+// resolveAddress.
+func paymentTarget(to string, amount *float64) error {
+	if !wallet.IsPaymentURI(to) {
+		return nil
+	}
+	uri, err := wallet.ParsePaymentURI(to)
+	if err != nil {
+		return err
+	}
+	switch {
+	case *amount == 0:
+		*amount = uri.Amount
+	case uri.Amount != 0 && *amount != uri.Amount:
+		return fmt.Errorf("-amount %g doesn't match the payment URI's amount %g", *amount, uri.Amount)
+	}
+	if uri.Label != "" {
+		fmt.Fprintf(os.Stderr, "Paying %s\n", uri.Label)
+	}
+	return nil
+}
+
+// txFormats are the encodings tx create can write
+const (
+	txFormatJSON = "json"
+	txFormatHex  = "hex"
+)
+
+// txCreate signs a transaction and writes it to stdout without submitting it,
+// for moving to a networked machine and broadcasting there
+func txCreate(ctx context.Context, args []string) error {
+	fs, opts := newFlags("tx create", "")
+	from := fs.String("from", "", "Name of the sending wallet")
+	keyfile := fs.String("from-keyfile", "", "PEM key file of the sending wallet, instead of -from")
+	to := fs.String("to", "", "Recipient address, saved wallet name or payment URI")
+	amount := fs.Float64("amount", 0, "Amount to send (defaults to a payment URI's amount)")
+	fee := fs.Float64("fee", 0, "Fee to pay the miner, on top of the amount")
+	offline := fs.Bool("offline", false, "Never contact the node; skips the balance check")
+	format := fs.String("format", txFormatJSON, "Encoding to write: json for POST /transaction, hex for POST /transaction/raw")
+	if _, err := opts.parse(fs, args, 0); err != nil {
+		return err
+	}
+	if (*from == "") == (*keyfile == "") {
+		return errors.New("set exactly one of -from and -from-keyfile")
+	}
+	if err := paymentTarget(*to, amount); err != nil {
+		return err
+	}
+	if *to == "" || *amount <= 0 {
+		return errors.New("-to and a positive -amount are required")
+	}
+	if !(*fee >= 0) {
+		return errors.New("-fee can't be negative")
+	}
+	if *format != txFormatJSON && *format != txFormatHex {
+		return fmt.Errorf("unknown format %q (use json or hex)", *format)
+	}
+
+	var (
+		w   *wallet.Wallet
+		err error
+	)
+	if *keyfile != "" {
+		w, err = loadKey(ctx, *keyfile, *keyfile)
+	} else {
+		w, err = loadWallet(ctx, opts.walletDir, *from)
+	}
+	if err != nil {
+		return err
+	}
+	recipient, err := resolveAddress(opts.walletDir, *to)
+	if err != nil {
+		return err
+	}
+
+	if !*offline {
+		balance, err := opts.client().Balance(ctx, w.Address())
+		if err != nil {
+			return fmt.Errorf("failed to check balance (use -offline on a machine without network): %w", err)
+		}
+		if balance < *amount+*fee {
+			return fmt.Errorf("insufficient confirmed balance: have %.2f, sending %.2f", balance, *amount+*fee)
+		}
+	}
+
+	tx := transaction.New(w.Address(), recipient, *amount)
+	tx.Fee = *fee
+	if err := tx.Sign(w.PrivateKey); err != nil {
+		return fmt.Errorf("failed to sign transaction: %w", err)
+	}
+
+	if *format == txFormatHex {
+		data, err := tx.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Println(hex.EncodeToString(data))
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(tx)
+}
+
+// txBroadcast submits a transaction written by tx create
+func txBroadcast(ctx context.Context, args []string) error {
+	fs, opts := newFlags("tx broadcast", "FILE")
+	args, err := opts.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	if args[0] == "-" {
+		data, err = io.ReadAll(io.LimitReader(os.Stdin, maxTxFileSize))
+	} else {
+		data, err = readFileLimited(args[0], maxTxFileSize)
+	}
+	if err != nil {
+		return err
+	}
+
+	tx, err := parseSignedTx(data)
+	if err != nil {
+		return err
+	}
+	return submitTx(ctx, opts, tx)
+}
+
+// maxTxFileSize bounds the file tx broadcast reads
+const maxTxFileSize = 64 << 10
+
+// readFileLimited reads a file, failing if it is larger than limit
+func readFileLimited(name string, limit int64) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s is larger than %d bytes", name, limit)
+	}
+	return data, nil
+}
+
+// parseSignedTx decodes a transaction from JSON or canonical binary hex and
+// checks it is complete and signed by the key it carries, so mistakes show up
+// before anything is sent
+func parseSignedTx(data []byte) (*transaction.Transaction, error) {
+	data = bytes.TrimSpace(data)
+	tx := &transaction.Transaction{}
+	if bytes.HasPrefix(data, []byte("{")) {
+		if err := json.Unmarshal(data, tx); err != nil {
+			return nil, fmt.Errorf("invalid transaction JSON: %w", err)
+		}
+	} else {
+		raw, err := hex.DecodeString(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("transaction is neither JSON nor hex: %w", err)
+		}
+		if err := tx.UnmarshalBinary(raw); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.IsValid(); err != nil {
+		return nil, fmt.Errorf("invalid transaction: %w", err)
+	}
+	if tx.ID != tx.Hash() {
+		return nil, errors.New("transaction ID doesn't match its contents")
+	}
+	key, err := tx.SignerKey()
+	if err != nil {
+		return nil, err
+	}
+	if wallet.PublicKeyToAddress(key) != tx.From {
+		return nil, errors.New("public key doesn't belong to the sender")
+	}
+	if !tx.Verify(key) {
+		return nil, errors.New("signature is invalid")
+	}
+	return tx, nil
+}
+
+// submitTx sends a signed transaction to the node and prints its response
+func submitTx(ctx context.Context, opts *options, tx *transaction.Transaction) error {
+	resp, err := opts.client().SubmitTransaction(ctx, tx)
+	if err != nil {
+		return err
+	}
+	return opts.print(resp, func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "TXID\tMEMPOOL POSITION\tMEMPOOL SIZE")
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", resp.TxID, resp.MempoolPosition, resp.MempoolSize)
+	})
+}
+
+// txStatus shows whether a transaction is pending or confirmed
+func txStatus(ctx context.Context, args []string) error {
+	fs, opts := newFlags("tx status", "TXID")
+	args, err := opts.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	return showTx(ctx, opts, args[0])
+}
+
+// showTx looks up a transaction and prints its details
+func showTx(ctx context.Context, opts *options, id string) error {
+	info, err := opts.client().Transaction(ctx, id)
+	if err != nil {
+		return err
+	}
+	return opts.print(info, func(tw *tabwriter.Writer) {
+		printTxInfo(tw, info)
+	})
+}
+
+// printTxInfo writes a transaction's details as key/value rows
+func printTxInfo(tw *tabwriter.Writer, info node.TxInfo) {
+	fmt.Fprintf(tw, "TXID\t%s\n", info.Tx.ID)
+	fmt.Fprintf(tw, "STATUS\t%s\n", info.Status)
+	if info.Status == "confirmed" {
+		fmt.Fprintf(tw, "HEIGHT\t%d\n", info.Height)
+		fmt.Fprintf(tw, "BLOCK\t%s\n", info.BlockHash)
+		fmt.Fprintf(tw, "CONFIRMATIONS\t%d\n", info.Confirmations)
+	}
+	fmt.Fprintf(tw, "FROM\t%s\n", info.Tx.From)
+	fmt.Fprintf(tw, "TO\t%s\n", info.Tx.To)
+	fmt.Fprintf(tw, "AMOUNT\t%.2f\n", info.Tx.Amount)
+	if info.Tx.Fee != 0 {
+		fmt.Fprintf(tw, "FEE\t%.2f\n", info.Tx.Fee)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/oksmith/home-server/blockchain/pkg/node"
+)
+
+// versionRun shows bchain's build details next to the node's, warning when
+// the two can't talk or disagree about which blocks are valid
+func versionRun(ctx context.Context, args []string) error {
+	fs, opts := newFlags("version", "")
+	if _, err := opts.parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	result := struct {
+		Client node.BuildInfo  `json:"client"`
+		Node   *node.BuildInfo `json:"node,omitempty"`
+	}{Client: node.Build()}
+	if st, err := opts.client().Status(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Node %s is unreachable, so only bchain's version is shown: %v\n", opts.node, err)
+	} else {
+		result.Node = &st.BuildInfo
+		for _, warning := range versionMismatches(result.Client, st.BuildInfo) {
+			fmt.Fprintln(os.Stderr, "Warning: "+warning)
+		}
+	}
+
+	return opts.print(result, func(tw *tabwriter.Writer) {
+		rows := []struct {
+			name  string
+			value func(b node.BuildInfo) string
+		}{
+			{"VERSION", func(b node.BuildInfo) string { return b.Version }},
+			{"COMMIT", func(b node.BuildInfo) string { return orDash(b.Commit) }},
+			{"BUILT", func(b node.BuildInfo) string { return orDash(b.BuildTime) }},
+			{"GO", func(b node.BuildInfo) string { return orDash(b.GoVersion) }},
+			// Nodes from before these were reported leave them at 0
+			{"PROTOCOL", func(b node.BuildInfo) string {
+				if b.ProtocolVersion == 0 {
+					return "-"
+				}
+				return fmt.Sprintf("%d (min %d)", b.ProtocolVersion, b.MinProtocolVersion)
+			}},
+			{"CHAIN RULES", func(b node.BuildInfo) string {
+				if b.ChainRulesVersion == 0 {
+					return "-"
+				}
+				return strconv.Itoa(b.ChainRulesVersion)
+			}},
+		}
+		if result.Node == nil {
+			for _, row := range rows {
+				fmt.Fprintf(tw, "%s\t%s\n", row.name, row.value(result.Client))
+			}
+			return
+		}
+		fmt.Fprintln(tw, "\tBCHAIN\tNODE")
+		for _, row := range rows {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", row.name, row.value(result.Client), row.value(*result.Node))
+		}
+	})
+}
+
+// versionMismatches explains why a client and node built from different
+// versions may not work together
+func versionMismatches(client, n node.BuildInfo) []string {
+	var warnings []string
+	if n.ProtocolVersion != 0 && (n.ProtocolVersion < client.MinProtocolVersion || n.MinProtocolVersion > client.ProtocolVersion) {
+		warnings = append(warnings, fmt.Sprintf("the node speaks protocol %d (min %d) and bchain %d (min %d); upgrade the older one",
+			n.ProtocolVersion, n.MinProtocolVersion, client.ProtocolVersion, client.MinProtocolVersion))
+	}
+	if n.ChainRulesVersion != 0 && n.ChainRulesVersion != client.ChainRulesVersion {
+		warnings = append(warnings, fmt.Sprintf("the node follows chain rules %d and bchain %d, so chain validate and fsck may disagree with it",
+			n.ChainRulesVersion, client.ChainRulesVersion))
+	}
+	return warnings
+}
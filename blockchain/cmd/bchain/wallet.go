@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/oksmith/home-server/blockchain/internal/term"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+// walletExt is the extension of key files in the wallet directory
+const walletExt = ".pem"
+
+// namedWallet is a wallet saved in the wallet directory
+type namedWallet struct {
+	Name      string `json:"name"`
+	Address   string `json:"address"`
+	Encrypted bool   `json:"encrypted"`
+}
+
+// walletPath returns the key file for a wallet name, rejecting names that
+// would escape the wallet directory
+func walletPath(dir, name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid wallet name %q", name)
+	}
+	return filepath.Join(dir, name+walletExt), nil
+}
+
+// loadWallet loads a named wallet from the wallet directory, asking for its
+// passphrase if it is encrypted
+func loadWallet(ctx context.Context, dir, name string) (*wallet.Wallet, error) {
+	path, err := walletPath(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	w, err := loadKey(ctx, path, fmt.Sprintf("wallet %q", name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("no wallet named %q in %s", name, dir)
+	}
+	return w, err
+}
+
+// loadKey loads a key file, prompting on the terminal for the passphrase of
+// an encrypted one. label names the key in the prompt.
+func loadKey(ctx context.Context, path, label string) (*wallet.Wallet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := wallet.DecodePEM(data, nil)
+	if errors.Is(err, wallet.ErrPassphraseRequired) {
+		var passphrase []byte
+		if passphrase, err = term.ReadPassphrase(ctx, "Passphrase for "+label+": "); err != nil {
+			return nil, err
+		}
+		w, err = wallet.DecodePEM(data, passphrase)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return w, nil
+}
+
+// inspectKey reads a key file's address without needing its passphrase
+func inspectKey(path string) (wallet.KeyInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return wallet.KeyInfo{}, err
+	}
+	info, err := wallet.InspectPEM(data)
+	if err != nil {
+		return info, fmt.Errorf("%s: %w", path, err)
+	}
+	return info, nil
+}
+
+// resolveAddress returns the address of a saved wallet or a payment URI, or s
+// itself when it is neither
+func resolveAddress(dir, s string) (string, error) {
+	if wallet.IsPaymentURI(s) {
+		uri, err := wallet.ParsePaymentURI(s)
+		return uri.Address, err
+	}
+	path, err := walletPath(dir, s)
+	if err != nil {
+		return s, nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return s, nil
+	}
+	info, err := inspectKey(path)
+	if err != nil {
+		return "", err
+	}
+	return info.Address, nil
+}
+
+// walletNew creates a wallet and saves it under a name
+func walletNew(ctx context.Context, args []string) error {
+	fs, opts := newFlags("wallet new", "NAME")
+	args, err := opts.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	path, err := newKeyPath(opts.walletDir, args[0])
+	if err != nil {
+		return err
+	}
+	w, err := wallet.New()
+	if err != nil {
+		return err
+	}
+	if err := w.SaveToFile(path); err != nil {
+		return fmt.Errorf("failed to save wallet: %w", err)
+	}
+
+	created := namedWallet{Name: args[0], Address: w.Address()}
+	return opts.print(created, func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "NAME\tADDRESS")
+		fmt.Fprintf(tw, "%s\t%s\n", created.Name, created.Address)
+	})
+}
+
+// walletList lists the wallets in the wallet directory
+func walletList(ctx context.Context, args []string) error {
+	fs, opts := newFlags("wallet list", "")
+	if _, err := opts.parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	return showWallets(opts)
+}
+
+// showWallets prints the saved wallets and their addresses
+func showWallets(opts *options) error {
+	wallets, err := savedWallets(opts.walletDir)
+	if err != nil {
+		return err
+	}
+	return opts.print(wallets, func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "NAME\tADDRESS\tENCRYPTED")
+		for _, w := range wallets {
+			fmt.Fprintf(tw, "%s\t%s\t%t\n", w.Name, w.Address, w.Encrypted)
+		}
+	})
+}
+
+// savedWallets loads every wallet in the wallet directory, sorted by name
+func savedWallets(dir string) ([]namedWallet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+walletExt))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	wallets := []namedWallet{}
+	for _, path := range paths {
+		info, err := inspectKey(path)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSuffix(filepath.Base(path), walletExt)
+		wallets = append(wallets, namedWallet{Name: name, Address: info.Address, Encrypted: info.Encrypted})
+	}
+	return wallets, nil
+}
+
+// walletBalance shows the confirmed balance of a saved wallet or any address
+func walletBalance(ctx context.Context, args []string) error {
+	fs, opts := newFlags("wallet balance", "NAME|ADDRESS")
+	args, err := opts.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	return showBalance(ctx, opts, args[0])
+}
+
+// showBalance prints the confirmed balance of a saved wallet or address
+func showBalance(ctx context.Context, opts *options, nameOrAddress string) error {
+	address, err := resolveAddress(opts.walletDir, nameOrAddress)
+	if err != nil {
+		return err
+	}
+	balance, err := opts.client().Balance(ctx, address)
+	if err != nil {
+		return err
+	}
+
+	result := struct {
+		Address string  `json:"address"`
+		Balance float64 `json:"balance"`
+	}{address, balance}
+	return opts.print(result, func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "ADDRESS\tBALANCE")
+		fmt.Fprintf(tw, "%s\t%.2f\n", result.Address, result.Balance)
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/logging"
+	"github.com/oksmith/home-server/blockchain/pkg/node"
+)
+
+// retryDelay is how long a worker waits after failing to reach the node
+const retryDelay = 5 * time.Second
+
+func main() {
+	nodeAddr := flag.String("node", "localhost:8080", "Address of a node running with -pool")
+	name := flag.String("name", defaultName(), "Worker name reported to the node")
+	threads := flag.Int("threads", runtime.NumCPU(), "Number of nonce ranges to search in parallel")
+	logLevel := flag.String("log-level", "info", "Log level: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "Log format: text or json")
+	flag.Parse()
+
+	logger, err := logging.New(os.Stderr, *logLevel, *logFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	baseURL := fmt.Sprintf("http://%s", *nodeAddr)
+
+	slog.Info("worker started", "node", *nodeAddr, "name", *name, "threads", *threads)
+
+	var wg sync.WaitGroup
+	for i := 0; i < *threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			work(ctx, client, baseURL, *name)
+		}()
+	}
+	wg.Wait()
+}
+
+// work repeatedly fetches a work unit, searches its nonce range and submits any solution
+func work(ctx context.Context, client *http.Client, baseURL, name string) {
+	for ctx.Err() == nil {
+		w, err := getWork(ctx, client, baseURL)
+		if err != nil {
+			slog.Warn("failed to get work", "err", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(retryDelay):
+			}
+			continue
+		}
+
+		found, err := w.Block.MineRange(ctx, w.Difficulty, w.NonceStart, w.NonceEnd)
+		if err != nil || !found {
+			continue
+		}
+
+		sub := node.WorkSubmission{WorkID: w.WorkID, Nonce: w.Block.Nonce, Worker: name}
+		if err := submitWork(ctx, client, baseURL, sub); err != nil {
+			slog.Warn("share rejected", "height", w.Block.Index, "err", err)
+			continue
+		}
+		slog.Info("solved block", "height", w.Block.Index, "hash", w.Block.Hash)
+	}
+}
+
+// getWork asks the node for the next work unit
+func getWork(ctx context.Context, client *http.Client, baseURL string) (*node.Work, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/work/get", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("node returned %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+
+	var w node.Work
+	if err := json.NewDecoder(resp.Body).Decode(&w); err != nil {
+		return nil, fmt.Errorf("failed to decode work: %w", err)
+	}
+	return &w, nil
+}
+
+// submitWork sends a solved nonce back to the node
+func submitWork(ctx context.Context, client *http.Client, baseURL string, sub node.WorkSubmission) error {
+	data, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/work/submit", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("node returned %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// defaultName uses the hostname so shares can be attributed to machines
+func defaultName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return "worker"
+	}
+	return host
+}
@@ -0,0 +1,298 @@
+// Package chainsync downloads a node's chain into a data directory without
+// running a node: headers first, then full blocks in batches, each checked
+// against its header and the chain so far. Progress is saved as it goes, so
+// an interrupted sync carries on where it stopped.
+package chainsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+	"github.com/oksmith/home-server/blockchain/pkg/client"
+	"github.com/oksmith/home-server/blockchain/pkg/node"
+)
+
+// DefaultBatchSize is how many blocks are requested at a time, the most a
+// node returns from /blocks/range
+const DefaultBatchSize = 500
+
+// DefaultSaveInterval is how often the chain downloaded so far is saved
+const DefaultSaveInterval = 10 * time.Second
+
+// Phases reported to Options.Progress
+const (
+	PhaseHeaders = "headers"
+	PhaseBlocks  = "blocks"
+)
+
+// Progress is how far a sync has got. In PhaseBlocks, Done of Total blocks
+// have been downloaded.
+type Progress struct {
+	Phase string
+	Done  int64
+	Total int64
+}
+
+// Options tune a sync. The zero value uses the defaults.
+type Options struct {
+	BatchSize    int
+	SaveInterval time.Duration
+	Progress     func(Progress) // called after each header and block batch
+}
+
+// Result describes a finished sync
+type Result struct {
+	StartHeight int64  `json:"start_height"` // local tip before the sync, -1 if there was no chain
+	Height      int64  `json:"height"`
+	Tip         string `json:"tip"`
+	Downloaded  int    `json:"downloaded"`  // blocks
+	RolledBack  int    `json:"rolled_back"` // local blocks dropped because the peer's chain forked from them
+}
+
+// Sync brings the chain in dataDir up to date with the node peer talks to,
+// creating it if there is none. The chain is saved every SaveInterval and
+// when ctx is cancelled, so running Sync again resumes the download. The
+// local chain must use the peer's difficulty, reward and emission schedule,
+// and a node using
+// dataDir must be stopped first.
+func Sync(ctx context.Context, peer *client.Client, dataDir string, opts Options) (Result, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.SaveInterval <= 0 {
+		opts.SaveInterval = DefaultSaveInterval
+	}
+	progress := func(p Progress) {
+		if opts.Progress != nil {
+			opts.Progress(p)
+		}
+	}
+
+	st, err := peer.Status(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	if st.MiningReward == 0 {
+		return Result{}, errors.New("peer doesn't report its difficulty and reward; it needs upgrading first")
+	}
+
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return Result{}, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	store, local, err := node.OpenChain(dataDir)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to load chain: %w", err)
+	}
+	defer store.Close()
+	switch {
+	case local == nil:
+	case local.Difficulty != st.Difficulty || local.MiningReward != st.MiningReward:
+		return Result{}, fmt.Errorf("consensus mismatch: peer has difficulty %d reward %.2f, local chain has difficulty %d reward %.2f",
+			st.Difficulty, st.MiningReward, local.Difficulty, local.MiningReward)
+	case !local.Emission.Equal(st.Emission):
+		return Result{}, errors.New("consensus mismatch: peer and local chain follow different emission schedules")
+	}
+
+	result := Result{StartHeight: -1}
+	progress(Progress{Phase: PhaseHeaders})
+	headers, fork, err := fetchHeaders(ctx, peer, local)
+	if err != nil {
+		return result, err
+	}
+	if err := checkHeaders(headers, st.Difficulty); err != nil {
+		return result, fmt.Errorf("peer sent bad headers: %w", err)
+	}
+	peerHeight := headers[len(headers)-1].Index
+
+	if local != nil {
+		result.StartHeight = local.GetLatestBlock().Index
+		if fork < result.StartHeight {
+			if fork == peerHeight {
+				// The peer is behind us on the same chain
+				result.Height, result.Tip = result.StartHeight, local.GetLatestBlock().Hash
+				return result, nil
+			}
+			if peerHeight <= result.StartHeight {
+				return result, fmt.Errorf("peer's chain forked from ours after block %d and is not longer (height %d, ours %d)",
+					fork, peerHeight, result.StartHeight)
+			}
+			result.RolledBack = int(result.StartHeight - fork)
+			if err := local.Truncate(int(fork) + 1); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	// A chain cut back to a fork point is only saved once it is longer than
+	// it was, so a failed sync never leaves it shorter
+	saved := time.Now()
+	save := func() error {
+		if local == nil || local.GetLatestBlock().Index <= result.StartHeight {
+			return nil
+		}
+		if err := local.SaveTo(store); err != nil {
+			return fmt.Errorf("failed to save chain: %w", err)
+		}
+		saved = time.Now()
+		return nil
+	}
+
+	total := peerHeight - fork
+	rangeSupported := true
+	for {
+		next := int64(0)
+		if local != nil {
+			next = local.GetLatestBlock().Index + 1
+		}
+		if next > peerHeight {
+			break
+		}
+
+		blocks, err := fetchBlocks(ctx, peer, next, min(int64(opts.BatchSize), peerHeight-next+1), &rangeSupported)
+		if err == nil {
+			err = matchHeaders(blocks, headers)
+		}
+		if err == nil && local == nil {
+			local, err = newChain(blocks[0], st.Difficulty, st.MiningReward, st.Emission)
+			blocks = blocks[1:]
+		}
+		if err == nil {
+			if err = local.Extend(blocks); err != nil {
+				err = fmt.Errorf("peer sent an invalid block: %w", err)
+			}
+		}
+		if local != nil {
+			result.Downloaded += int(local.GetLatestBlock().Index - next + 1)
+		}
+		if err != nil {
+			// Keep what was downloaded, so the next sync resumes from there
+			if saveErr := save(); saveErr != nil {
+				return result, errors.Join(err, saveErr)
+			}
+			return result, err
+		}
+
+		progress(Progress{Phase: PhaseBlocks, Done: int64(result.Downloaded), Total: total})
+		if time.Since(saved) >= opts.SaveInterval {
+			if err := save(); err != nil {
+				return result, err
+			}
+		}
+	}
+	if err := save(); err != nil {
+		return result, err
+	}
+
+	tip := local.GetLatestBlock()
+	result.Height, result.Tip = tip.Index, tip.Hash
+	return result, nil
+}
+
+// fetchHeaders returns the peer's headers from our tip onwards, or from
+// genesis if we have no chain or the peer's chain no longer contains our tip.
+// fork is the height of the last block the chains share, -1 for none.
+func fetchHeaders(ctx context.Context, peer *client.Client, local *chain.Chain) (headers []block.Header, fork int64, err error) {
+	if local != nil {
+		tip := local.GetLatestBlock()
+		headers, err = peer.Headers(ctx, tip.Index)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(headers) > 0 && headers[0].Hash == tip.Hash {
+			return headers, tip.Index, nil
+		}
+	}
+
+	headers, err = peer.Headers(ctx, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(headers) == 0 {
+		return nil, 0, errors.New("peer has no blocks")
+	}
+	if local == nil {
+		return headers, -1, nil
+	}
+	fork = chain.ForkPoint(local.Headers(0), headers)
+	if fork < 0 {
+		return nil, 0, errors.New("peer's chain has a different genesis block; is it on another network?")
+	}
+	return headers[fork:], fork, nil
+}
+
+// checkHeaders makes sure headers form a chain with enough proof-of-work
+func checkHeaders(headers []block.Header, difficulty int) error {
+	target := strings.Repeat("0", difficulty)
+	for i, h := range headers {
+		if i > 0 && (h.Index != headers[i-1].Index+1 || h.PreviousHash != headers[i-1].Hash) {
+			return fmt.Errorf("header %d does not link to its predecessor", h.Index)
+		}
+		if h.Index > 0 && !strings.HasPrefix(h.Hash, target) {
+			return fmt.Errorf("header %d has insufficient proof-of-work", h.Index)
+		}
+	}
+	return nil
+}
+
+// fetchBlocks downloads count blocks from height from, a batch at a time
+// from nodes serving /blocks/range and one at a time from older ones
+func fetchBlocks(ctx context.Context, peer *client.Client, from, count int64, rangeSupported *bool) ([]*block.Block, error) {
+	if *rangeSupported {
+		blocks, err := peer.BlockRange(ctx, from, int(count))
+		if !client.IsNotFound(err) {
+			if err == nil && len(blocks) == 0 {
+				err = fmt.Errorf("peer has no block %d; its chain changed during the sync, so run it again", from)
+			}
+			return blocks, err
+		}
+		*rangeSupported = false
+	}
+
+	blocks := make([]*block.Block, 0, count)
+	for height := from; height < from+count; height++ {
+		b, err := peer.BlockByHeight(ctx, height)
+		if err != nil {
+			if len(blocks) > 0 {
+				return blocks, nil
+			}
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+// matchHeaders checks downloaded blocks are the ones the headers promised
+func matchHeaders(blocks []*block.Block, headers []block.Header) error {
+	for _, b := range blocks {
+		if b == nil {
+			return errors.New("peer sent a missing block")
+		}
+		i := b.Index - headers[0].Index
+		if i < 0 || i >= int64(len(headers)) || headers[i].Hash != b.Hash {
+			return errors.New("peer's chain changed during the sync, so run it again")
+		}
+	}
+	return nil
+}
+
+// newChain starts a chain from a downloaded genesis block
+func newChain(genesis *block.Block, difficulty int, reward float64, emission chain.Emission) (*chain.Chain, error) {
+	if genesis.Index != 0 || len(genesis.Transactions) > 0 || !genesis.IsValid() {
+		return nil, errors.New("peer sent a malformed genesis block")
+	}
+	if err := emission.Validate(); err != nil {
+		return nil, fmt.Errorf("peer reports an invalid emission schedule: %w", err)
+	}
+	c := &chain.Chain{Blocks: []*block.Block{genesis}, Difficulty: difficulty, MiningReward: reward, Emission: emission}
+	if err := c.RebuildState(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,205 @@
+package chainsync
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+	"github.com/oksmith/home-server/blockchain/pkg/client"
+	"github.com/oksmith/home-server/blockchain/pkg/node"
+)
+
+// servePeer serves a node with blocks mined on it, optionally through a
+// wrapper, and returns a client for it
+func servePeer(t *testing.T, n *node.Node, blocks int, wrap func(http.Handler) http.Handler) *client.Client {
+	t.Helper()
+	for range blocks {
+		if err := n.Mine(); err != nil {
+			t.Fatalf("failed to mine: %v", err)
+		}
+	}
+	var h http.Handler = n.Handler()
+	if wrap != nil {
+		h = wrap(h)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return client.New(srv.URL)
+}
+
+// newNode creates a node that can mine
+func newNode(t *testing.T) *node.Node {
+	t.Helper()
+	n, err := node.New("localhost:9000", 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	return n
+}
+
+// loadSynced reads back the chain a sync saved
+func loadSynced(t *testing.T, dataDir string) *chain.Chain {
+	t.Helper()
+	s, c, err := node.OpenChain(dataDir)
+	if err != nil || c == nil {
+		t.Fatalf("failed to load synced chain: %v", err)
+	}
+	s.Close()
+	return c
+}
+
+func TestSyncFreshAndIncremental(t *testing.T) {
+	n := newNode(t)
+	peer := servePeer(t, n, 5, nil)
+	dataDir := t.TempDir()
+
+	var progress []Progress
+	opts := Options{BatchSize: 2, Progress: func(p Progress) { progress = append(progress, p) }}
+	result, err := Sync(t.Context(), peer, dataDir, opts)
+	if err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if result.StartHeight != -1 || result.Height != 5 || result.Downloaded != 6 || result.Tip != n.Chain.GetLatestBlock().Hash {
+		t.Errorf("unexpected result %+v", result)
+	}
+	// Headers, then six blocks two at a time
+	if len(progress) != 4 || progress[0].Phase != PhaseHeaders || progress[3] != (Progress{PhaseBlocks, 6, 6}) {
+		t.Errorf("unexpected progress %+v", progress)
+	}
+
+	synced := loadSynced(t, dataDir)
+	if !synced.IsValid() || synced.GetBalance(n.Wallet.Address()) != 50 {
+		t.Errorf("expected a valid chain paying the miner 50, got %.2f", synced.GetBalance(n.Wallet.Address()))
+	}
+
+	// Only new blocks are fetched next time
+	for range 3 {
+		n.Mine()
+	}
+	result, err = Sync(t.Context(), peer, dataDir, Options{})
+	if err != nil || result.StartHeight != 5 || result.Height != 8 || result.Downloaded != 3 {
+		t.Errorf("expected 3 new blocks, got %+v, %v", result, err)
+	}
+
+	result, err = Sync(t.Context(), peer, dataDir, Options{})
+	if err != nil || result.Downloaded != 0 || result.Height != 8 {
+		t.Errorf("expected nothing to do, got %+v, %v", result, err)
+	}
+}
+
+func TestSyncResumesAfterInterrupt(t *testing.T) {
+	peer := servePeer(t, newNode(t), 9, nil)
+	dataDir := t.TempDir()
+
+	// Stop after the first batch, which is saved on the way out
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	stopAfterBatch := func(p Progress) {
+		if p.Phase == PhaseBlocks {
+			cancel()
+		}
+	}
+	_, err := Sync(ctx, peer, dataDir, Options{BatchSize: 4, Progress: stopAfterBatch})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the sync to be cancelled, got %v", err)
+	}
+	if height := loadSynced(t, dataDir).GetLatestBlock().Index; height != 3 {
+		t.Fatalf("expected the first 4 blocks saved, got height %d", height)
+	}
+
+	result, err := Sync(t.Context(), peer, dataDir, Options{BatchSize: 4})
+	if err != nil || result.StartHeight != 3 || result.Downloaded != 6 || result.Height != 9 {
+		t.Errorf("expected the sync to resume from height 3, got %+v, %v", result, err)
+	}
+}
+
+func TestSyncRollsBackFork(t *testing.T) {
+	n := newNode(t)
+	n.Mine()
+	rival := newNode(t)
+	rival.Chain.ReplaceWith(n.Chain)
+
+	dataDir := t.TempDir()
+	if _, err := Sync(t.Context(), servePeer(t, n, 2, nil), dataDir, Options{}); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	// A shorter fork is refused
+	rivalPeer := servePeer(t, rival, 1, nil)
+	if _, err := Sync(t.Context(), rivalPeer, dataDir, Options{}); err == nil || !strings.Contains(err.Error(), "not longer") {
+		t.Fatalf("expected a shorter fork to be refused, got %v", err)
+	}
+
+	// A longer one replaces our blocks after the fork
+	for range 3 {
+		rival.Mine()
+	}
+	result, err := Sync(t.Context(), rivalPeer, dataDir, Options{})
+	if err != nil || result.RolledBack != 2 || result.Downloaded != 4 || result.Tip != rival.Chain.GetLatestBlock().Hash {
+		t.Fatalf("expected 2 blocks rolled back and 4 downloaded, got %+v, %v", result, err)
+	}
+	if synced := loadSynced(t, dataDir); synced.GetBalance(n.Wallet.Address()) != 10 {
+		t.Errorf("expected only the shared block's reward left, got %.2f", synced.GetBalance(n.Wallet.Address()))
+	}
+}
+
+func TestSyncFromOlderPeer(t *testing.T) {
+	// Nodes without /blocks/range are downloaded from one block at a time
+	withoutRange := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/blocks/range") {
+				http.NotFound(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	peer := servePeer(t, newNode(t), 3, withoutRange)
+
+	result, err := Sync(t.Context(), peer, t.TempDir(), Options{})
+	if err != nil || result.Height != 3 || result.Downloaded != 4 {
+		t.Errorf("expected 4 blocks downloaded, got %+v, %v", result, err)
+	}
+}
+
+func TestSyncRejectsOtherChains(t *testing.T) {
+	dataDir := t.TempDir()
+	if _, err := Sync(t.Context(), servePeer(t, newNode(t), 1, nil), dataDir, Options{}); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	// Every node has its own genesis block outside regtest
+	if _, err := Sync(t.Context(), servePeer(t, newNode(t), 2, nil), dataDir, Options{}); err == nil || !strings.Contains(err.Error(), "genesis") {
+		t.Errorf("expected a genesis mismatch, got %v", err)
+	}
+
+	richer, _ := node.New("localhost:9000", 1, 20.0)
+	if _, err := Sync(t.Context(), servePeer(t, richer, 2, nil), dataDir, Options{}); err == nil || !strings.Contains(err.Error(), "consensus mismatch") {
+		t.Errorf("expected a consensus mismatch, got %v", err)
+	}
+
+	halving := newNode(t)
+	halving.SetEmission(chain.Emission{HalvingInterval: 100})
+	if _, err := Sync(t.Context(), servePeer(t, halving, 2, nil), dataDir, Options{}); err == nil || !strings.Contains(err.Error(), "consensus mismatch") {
+		t.Errorf("expected a consensus mismatch over the emission schedule, got %v", err)
+	}
+}
+
+func TestSyncAdoptsEmission(t *testing.T) {
+	peer := newNode(t)
+	emission := chain.Emission{HalvingInterval: 2}
+	if err := peer.SetEmission(emission); err != nil {
+		t.Fatal(err)
+	}
+	dataDir := t.TempDir()
+	if _, err := Sync(t.Context(), servePeer(t, peer, 3, nil), dataDir, Options{}); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if got := loadSynced(t, dataDir).Emission; !got.Equal(emission) {
+		t.Errorf("expected the synced chain to follow %+v, got %+v", emission, got)
+	}
+}
@@ -0,0 +1,83 @@
+// Package fuzzing reads and writes the corpus files of Go's native fuzzing,
+// for the fuzz targets guarding what the node decodes from untrusted peers
+// and clients:
+//
+//	FuzzTransactionJSON    pkg/transaction  a transaction as clients and peers send it
+//	FuzzTransactionBinary  pkg/transaction  a transaction's canonical binary encoding
+//	FuzzBlockJSON          pkg/block        a block as peers announce it
+//	FuzzDecode             pkg/chain        a chain snapshot
+//	FuzzPeerChain          pkg/node         a peer's /headers and /chain answers during a sync
+//
+// Each is run from the blockchain module with, for example,
+//
+//	go test -run='^$' -fuzz='^FuzzPeerChain$' -fuzztime=1m ./pkg/node
+//
+// An input that fails is saved in the package's testdata/fuzz/TARGET
+// directory, where plain go test runs it from then on, and go test
+// -run=TARGET/NAME runs it alone. bchain dev corpus prints the raw bytes such
+// a file stands for, to look at or send to a node; Marshal goes the other way,
+// turning bytes met in the wild, such as a peer's chain that broke a node,
+// into a seed to save there.
+package fuzzing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// header starts every corpus file
+const header = "go test fuzz v1"
+
+// Marshal encodes inputs as a corpus file for a target taking that many
+// []byte arguments
+func Marshal(inputs ...[]byte) []byte {
+	var b bytes.Buffer
+	b.WriteString(header + "\n")
+	for _, in := range inputs {
+		fmt.Fprintf(&b, "[]byte(%s)\n", strconv.Quote(string(in)))
+	}
+	return b.Bytes()
+}
+
+// Unmarshal decodes a corpus file whose values are all []byte or string
+func Unmarshal(data []byte) ([][]byte, error) {
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if lines[0] != header {
+		return nil, errors.New("not a fuzz corpus file: it doesn't start with " + strconv.Quote(header))
+	}
+	var inputs [][]byte
+	for i, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		var quoted string
+		for _, kind := range []string{"[]byte(", "string("} {
+			if strings.HasPrefix(line, kind) && strings.HasSuffix(line, ")") {
+				quoted = line[len(kind) : len(line)-1]
+			}
+		}
+		if quoted == "" {
+			return nil, fmt.Errorf("line %d: only []byte and string values are supported", i+2)
+		}
+		s, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+2, err)
+		}
+		inputs = append(inputs, []byte(s))
+	}
+	return inputs, nil
+}
+
+// ReadFile reads the inputs held by a corpus file
+func ReadFile(path string) ([][]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Unmarshal(data)
+}
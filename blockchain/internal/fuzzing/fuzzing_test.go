@@ -0,0 +1,47 @@
+package fuzzing
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	inputs := [][]byte{[]byte(`{"blocks":[null]}`), {0, 1, 0xff, '\n', '"'}, {}}
+	data := Marshal(inputs...)
+	got, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(inputs) {
+		t.Fatalf("got %d inputs from %q", len(got), data)
+	}
+	for i := range inputs {
+		if !bytes.Equal(got[i], inputs[i]) {
+			t.Errorf("input %d: got %q, want %q", i, got[i], inputs[i])
+		}
+	}
+}
+
+func TestUnmarshalGoCorpus(t *testing.T) {
+	// As go test -fuzz writes them
+	got, err := Unmarshal([]byte("go test fuzz v1\n[]byte(\"{\\\"index\\\":1}\")\nstring(\"\\x00a\")\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || string(got[0]) != `{"index":1}` || string(got[1]) != "\x00a" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"[]byte(\"x\")\n",
+		"go test fuzz v1\nint(5)\n",
+		"go test fuzz v1\n[]byte(\"unterminated)\n",
+	} {
+		if _, err := Unmarshal([]byte(data)); err == nil {
+			t.Errorf("expected %q to be refused", data)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package nodecmd
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/logging"
+	"github.com/oksmith/home-server/blockchain/pkg/node"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+	"github.com/oksmith/home-server/pkg/config"
+)
+
+// A config file holds node settings one per line as "name = value", where
+// name is a flag without its dash, in the format pkg/config reads: blank
+// lines and lines starting with # are ignored, a value may be quoted and it
+// may refer to a secret kept elsewhere as ${file:PATH}, ${env:NAME} or
+// ${cred:NAME}.
+
+// secretSettings are left out of a default config, since their defaults
+// come from the environment
+var secretSettings = map[string]bool{"admin-token": true, "gateway-token": true, "notify-token": true}
+
+// reloadSettings take effect while the node runs when the config file
+// changes or the node gets SIGHUP; the rest need a restart
+var reloadSettings = map[string]bool{"peers": true, "admin-token": true}
+
+// configFields describes every flag in fs but -config as a setting, checked
+// by parsing it as the flag would
+func configFields(fs *flag.FlagSet) []config.Field {
+	var fields []config.Field
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" {
+			return
+		}
+		name := f.Name
+		fields = append(fields, config.Field{
+			Name:    name,
+			Default: f.DefValue,
+			Secret:  secretSettings[name],
+			Reload:  reloadSettings[name],
+			Check: func(value string) error {
+				probe, _, _ := newRunFlagSet()
+				probe.SetOutput(io.Discard)
+				return probe.Set(name, value)
+			},
+		})
+	})
+	return fields
+}
+
+// givenFlags returns the flags set so far, which the config file doesn't
+// override
+func givenFlags(fs *flag.FlagSet) map[string]bool {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	return given
+}
+
+// loadConfig reads a config file and sets each flag from its setting, unless
+// the flag was given on the command line
+func loadConfig(fs *flag.FlagSet, filename string) (*config.Config, error) {
+	given := givenFlags(fs)
+	cfg, err := config.Load(filename, configFields(fs)...)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range cfg.Settings() {
+		if s.Source != config.FromFile || given[s.Name] {
+			continue
+		}
+		if err := fs.Set(s.Name, cfg.Get(s.Name)); err != nil {
+			return nil, fmt.Errorf("%s: invalid %s: %w", filename, s.Name, err)
+		}
+	}
+	return cfg, nil
+}
+
+// reloadConfig applies changes to the peers and admin token from the config
+// file to a running node, unless they were given on the command line. New
+// peers are added; peers dropped from the file stay until restart, as the
+// node has likely learned them from other peers as well.
+func reloadConfig(cfg *config.Config, n *node.Node, given map[string]bool) func(changed []string) {
+	return func(changed []string) {
+		for _, name := range changed {
+			if given[name] {
+				slog.Warn("config setting changed but the command line overrides it", "setting", name)
+				continue
+			}
+			switch name {
+			case "admin-token":
+				n.SetAdminToken(cfg.Get(name))
+				slog.Info("admin token changed")
+			case "peers":
+				peers := parsePeers(cfg.Get(name))
+				slog.Info("peers changed", "peers", len(peers))
+				go func() {
+					for _, peer := range peers {
+						n.AddPeer(peer)
+					}
+				}()
+			}
+		}
+	}
+}
+
+// WriteDefaultConfig writes a config file listing every setting with its
+// description and default value, all commented out
+func WriteDefaultConfig(w io.Writer) error {
+	fs, _ := newFlagSet()
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# Node config. Each setting is a node flag without its dash, as name = value.")
+	fmt.Fprintln(bw, "# Uncomment a line to change it from the default shown. Flags given to the")
+	fmt.Fprintln(bw, "# node override the settings here. Run \"bchain config check FILE\" after editing.")
+	fs.VisitAll(func(f *flag.Flag) {
+		fmt.Fprintln(bw)
+		for _, line := range wrapComment(f.Usage, 78) {
+			fmt.Fprintf(bw, "# %s\n", line)
+		}
+		value := f.DefValue
+		if secretSettings[f.Name] {
+			value = ""
+		}
+		if value == "" {
+			fmt.Fprintf(bw, "# %s =\n", f.Name)
+		} else {
+			fmt.Fprintf(bw, "# %s = %s\n", f.Name, value)
+		}
+	})
+	return bw.Flush()
+}
+
+// wrapComment breaks text into lines of at most width characters, where it
+// can
+func wrapComment(text string, width int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && len(line)+1+len(word) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	return append(lines, line)
+}
+
+// CheckResult is the outcome of one of CheckConfig's checks
+type CheckResult struct {
+	Check  string `json:"check"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// CheckConfig checks a config file before a node is started with it: that
+// it parses, its values are valid, the listen port is free, the data
+// directory is writable and the wallet key in it can be loaded. It stops
+// after the first check if the file can't be read.
+func CheckConfig(filename string) []CheckResult {
+	fs, o := newFlagSet()
+	var results []CheckResult
+	report := func(check string, err error, detail string, args ...any) {
+		r := CheckResult{Check: check, OK: err == nil, Detail: fmt.Sprintf(detail, args...)}
+		if err != nil {
+			r.Detail = err.Error()
+		}
+		results = append(results, r)
+	}
+
+	cfg, err := loadConfig(fs, filename)
+	count := 0
+	if err == nil {
+		for _, s := range cfg.Settings() {
+			if s.Source == config.FromFile {
+				count++
+			}
+		}
+	}
+	report("file", err, "%d settings", count)
+	if err != nil {
+		return results
+	}
+
+	err = checkNetwork(fs, o)
+	report("network", err, "%s, difficulty %d", o.network, o.difficulty)
+	_, err = logging.New(io.Discard, o.logLevel, o.logFormat)
+	report("logging", err, "%s, %s", o.logLevel, o.logFormat)
+
+	listenAddr := o.listen
+	if listenAddr == "" {
+		listenAddr = fmt.Sprintf("localhost:%d", o.port)
+	}
+	report("listen", checkListen(listenAddr), "%s is free", listenAddr)
+
+	peers := parsePeers(o.peers)
+	report("peers", checkPeers(peers, o.advertise, o.lightMode), "%d configured", len(peers))
+
+	filter := node.PeerFilter{Allow: strings.Split(o.peerAllow, ","), Deny: strings.Split(o.peerDeny, ","), Private: o.private}
+	report("peer filter", filter.Validate(), "%d allowed, %d denied", len(parsePeers(o.peerAllow)), len(parsePeers(o.peerDeny)))
+
+	err = block.ThrottleConfig{CPUPercent: o.mineCPU, MaxHashRate: o.mineHashRate}.Validate()
+	if err == nil && o.mine && o.mineInterval <= 0 {
+		err = fmt.Errorf("mine-interval must be positive, got %v", o.mineInterval)
+	}
+	report("mining", err, "%s", onOff(o.mine))
+
+	switch o.natMethod {
+	case "none", "upnp", "pmp", "auto":
+		report("nat", nil, "%s", o.natMethod)
+	default:
+		report("nat", fmt.Errorf("unknown NAT method %q (use none, upnp, pmp or auto)", o.natMethod), "")
+	}
+
+	detail, err := checkDataDir(o.dataDir)
+	report("datadir", err, "%s", detail)
+	detail, err = checkWallet(o.dataDir)
+	report("wallet", err, "%s", detail)
+
+	if o.bootstrap != "" && !strings.HasPrefix(o.bootstrap, "http://") && !strings.HasPrefix(o.bootstrap, "https://") {
+		_, err := os.Stat(o.bootstrap)
+		report("bootstrap", err, "%s exists", o.bootstrap)
+	}
+	return results
+}
+
+// checkNetwork checks the network name and that regtest's difficulty limit
+// holds
+func checkNetwork(fs *flag.FlagSet, o *options) error {
+	switch o.network {
+	case "main":
+	case "regtest":
+		if !flagSet(fs, "difficulty") {
+			o.difficulty = node.MaxRegtestDifficulty
+		}
+		if o.difficulty > node.MaxRegtestDifficulty {
+			return fmt.Errorf("regtest difficulty must be at most %d, got %d", node.MaxRegtestDifficulty, o.difficulty)
+		}
+	default:
+		return fmt.Errorf("unknown network %q (use main or regtest)", o.network)
+	}
+	if o.difficulty < 0 {
+		return fmt.Errorf("difficulty can't be negative, got %d", o.difficulty)
+	}
+	return nil
+}
+
+// checkListen checks the node could bind its listen address
+func checkListen(address string) error {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("can't listen on %s: %w", address, err)
+	}
+	return ln.Close()
+}
+
+// checkPeers checks every peer and the advertised address are host:port pairs
+func checkPeers(peers []string, advertise string, light bool) error {
+	if light && len(peers) == 0 {
+		return errors.New("light mode needs at least one peer")
+	}
+	if advertise != "" {
+		peers = append(peers, advertise)
+	}
+	for _, peer := range peers {
+		host, port, err := net.SplitHostPort(peer)
+		if err != nil || host == "" || port == "" {
+			return fmt.Errorf("%q is not a host:port address", peer)
+		}
+	}
+	return nil
+}
+
+// checkDataDir checks the node can write to its data directory, or create
+// it if it doesn't exist yet
+func checkDataDir(dir string) (string, error) {
+	if dir == "" {
+		return "not set; state is kept in memory", nil
+	}
+	st, err := os.Stat(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		// The node creates it on first start, so the closest existing parent must be writable
+		parent := filepath.Dir(dir)
+		for {
+			if _, err := os.Stat(parent); err == nil || parent == filepath.Dir(parent) {
+				break
+			}
+			parent = filepath.Dir(parent)
+		}
+		if err := checkWritable(parent); err != nil {
+			return "", fmt.Errorf("%s doesn't exist and can't be created: %w", dir, err)
+		}
+		return dir + " will be created on first start", nil
+	} else if err != nil {
+		return "", err
+	}
+	if !st.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", dir)
+	}
+	if err := checkWritable(dir); err != nil {
+		return "", err
+	}
+	return dir + " is writable", nil
+}
+
+// checkWritable creates and removes a file in dir
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".config-check-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// checkWallet checks the node can load the wallet key in its data directory
+func checkWallet(dir string) (string, error) {
+	if dir == "" {
+		return "not set; a throwaway wallet is made on each start", nil
+	}
+	filename := filepath.Join(dir, "wallet.pem")
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return filename + " will be created on first start", nil
+	} else if err != nil {
+		return "", err
+	}
+	w, err := wallet.DecodePEM(data, nil)
+	if errors.Is(err, wallet.ErrPassphraseRequired) {
+		return "", fmt.Errorf("%s is encrypted, but a node can't ask for a passphrase; use an unencrypted key", filename)
+	} else if err != nil {
+		return "", fmt.Errorf("%s: %w", filename, err)
+	}
+	return "address " + w.Address(), nil
+}
+
+// onOff describes a boolean setting
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,150 @@
+package nodecmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/node"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+	"github.com/oksmith/home-server/pkg/config"
+)
+
+// writeConfig writes a config file in a temporary directory
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "node.conf")
+	if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestLoadConfig(t *testing.T) {
+	fs, o := newFlagSet()
+	fs.Parse([]string{"-port", "7000"})
+
+	filename := writeConfig(t, "# comment\n\nport = 9000\n  peers=localhost:8081,localhost:8082  \ncors-origins = \"*\"\nsync-interval = 1m\nmine = true\n")
+	if _, err := loadConfig(fs, filename); err != nil {
+		t.Fatal(err)
+	}
+	if o.port != 7000 {
+		t.Errorf("port = %d, want the command line's 7000", o.port)
+	}
+	if o.peers != "localhost:8081,localhost:8082" || o.corsOrigins != "*" {
+		t.Errorf("peers = %q, cors-origins = %q", o.peers, o.corsOrigins)
+	}
+	if o.syncInterval != time.Minute || !o.mine {
+		t.Errorf("sync-interval = %v, mine = %v; want 1m0s, true", o.syncInterval, o.mine)
+	}
+
+	for _, bad := range []string{"port 9000", "port = 1\nport = 2", `peers = "unterminated`, "no-such-flag = 1", "port = lots", "config = other.conf"} {
+		fs, _ := newFlagSet()
+		if _, err := loadConfig(fs, writeConfig(t, bad)); err == nil {
+			t.Errorf("loadConfig(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	fs, _ := newFlagSet()
+	filename := writeConfig(t, "admin-token = one\n")
+	cfg, err := loadConfig(fs, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := node.New("localhost:0", 1, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Shutdown()
+	n.SetAdminToken(cfg.Get("admin-token"))
+	cfg.OnReload(reloadConfig(cfg, n, nil))
+
+	os.WriteFile(filename, []byte("admin-token = two\n"), 0600)
+	if err := cfg.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := n.AdminToken(); got != "two" {
+		t.Errorf("admin token = %q after reloading, want two", got)
+	}
+
+	// A flag given on the command line wins over the file
+	cfg, err = loadConfig(fs, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.OnReload(reloadConfig(cfg, n, map[string]bool{"admin-token": true}))
+	n.SetAdminToken("flag")
+	os.WriteFile(filename, []byte("admin-token = three\n"), 0600)
+	if err := cfg.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := n.AdminToken(); got != "flag" {
+		t.Errorf("admin token = %q, want the command line's", got)
+	}
+}
+
+func TestWriteDefaultConfig(t *testing.T) {
+	t.Setenv("NODE_ADMIN_TOKEN", "secret")
+	var buf bytes.Buffer
+	if err := WriteDefaultConfig(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if strings.Contains(out, "secret") {
+		t.Error("default config contains the admin token from the environment")
+	}
+	if !strings.Contains(out, "# port = 8080\n") {
+		t.Errorf("default config is missing the port setting:\n%s", out)
+	}
+
+	// Everything is commented out, so it applies no settings
+	settings, err := config.Parse(buf.Bytes())
+	if err != nil || len(settings) != 0 {
+		t.Errorf("config.Parse(default) = %d settings, %v; want none", len(settings), err)
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	dir := t.TempDir()
+	dataDir := filepath.Join(dir, "data")
+	config := filepath.Join(dir, "node.conf")
+	os.WriteFile(config, []byte("listen = localhost:0\nnetwork = regtest\ndatadir = "+dataDir+"\n"), 0600)
+
+	failed := func() []string {
+		var names []string
+		for _, r := range CheckConfig(config) {
+			if !r.OK {
+				names = append(names, r.Check+": "+r.Detail)
+			}
+		}
+		return names
+	}
+	if f := failed(); len(f) != 0 {
+		t.Errorf("fresh config failed checks: %v", f)
+	}
+
+	// A node can't prompt for a passphrase, so an encrypted wallet fails
+	os.MkdirAll(dataDir, 0700)
+	w, _ := wallet.New()
+	if err := w.SaveEncrypted(filepath.Join(dataDir, "wallet.pem"), []byte("pw")); err != nil {
+		t.Fatal(err)
+	}
+	if f := failed(); len(f) != 1 || !strings.HasPrefix(f[0], "wallet:") {
+		t.Errorf("failed checks = %v, want just the wallet", f)
+	}
+
+	os.WriteFile(config, []byte("network = testnet\nmine-cpu = 0\n"), 0600)
+	if f := failed(); len(f) != 2 {
+		t.Errorf("failed checks = %v, want network and mining", f)
+	}
+
+	os.WriteFile(config, []byte("bogus = 1\n"), 0600)
+	if results := CheckConfig(config); len(results) != 1 || results[0].OK {
+		t.Errorf("CheckConfig(unknown setting) = %+v, want one failed file check", results)
+	}
+}
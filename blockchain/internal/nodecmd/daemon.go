@@ -0,0 +1,165 @@
+package nodecmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// daemonEnv marks the background copy of a node started by -daemon, so it
+// runs in the foreground of its own session rather than starting another
+const daemonEnv = "NODE_DAEMON_CHILD"
+
+// daemonStartTimeout is how long -daemon waits for the node to listen
+const daemonStartTimeout = 30 * time.Second
+
+// defaultPIDFile and defaultLogFile are the names -daemon uses in the data
+// directory when no -pidfile or -log-file is given
+const (
+	defaultPIDFile = "node.pid"
+	defaultLogFile = "node.log"
+)
+
+// DefaultPIDFile returns where a daemon with this data directory writes its
+// pidfile unless told otherwise
+func DefaultPIDFile(dataDir string) string {
+	return filepath.Join(dataDir, defaultPIDFile)
+}
+
+// startDaemon starts the same command again in the background, with its
+// output appended to a log file and its process ID in a pidfile, and returns
+// once the node is listening. args must be the tail of os.Args the command
+// was given, so the rest of the command line can be repeated.
+func startDaemon(args []string, o *options, logFile, listenAddr string) error {
+	if o.pidFile == "" && o.dataDir == "" {
+		return errors.New("-daemon needs -pidfile or -datadir for the pidfile")
+	}
+	pidFile := o.pidFile
+	if pidFile == "" {
+		pidFile = DefaultPIDFile(o.dataDir)
+	}
+	if logFile == "" {
+		if o.dataDir == "" {
+			return errors.New("-daemon needs -log-file or -datadir for the node's output")
+		}
+		logFile = filepath.Join(o.dataDir, defaultLogFile)
+	}
+	if pid, err := ReadPIDFile(pidFile); err == nil && processAlive(pid) {
+		return fmt.Errorf("a node is already running as pid %d (from %s)", pid, pidFile)
+	}
+
+	prefixLen := len(os.Args) - len(args)
+	if prefixLen < 1 {
+		return errors.New("-daemon can't repeat this command line")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if pidFile, err = filepath.Abs(pidFile); err != nil {
+		return err
+	}
+
+	if o.dataDir != "" {
+		if err := os.MkdirAll(o.dataDir, 0700); err != nil {
+			return err
+		}
+	}
+	logF, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer logF.Close()
+	logStart, _ := logF.Seek(0, io.SeekEnd)
+
+	childArgs := append(append([]string{}, os.Args[1:prefixLen]...), args...)
+	childArgs = append(childArgs, "-pidfile", pidFile)
+	cmd := exec.Command(exe, childArgs...)
+	cmd.Env = append(os.Environ(), daemonEnv+"=1")
+	cmd.Stdout = logF
+	cmd.Stderr = logF
+	cmd.SysProcAttr = detachedProcAttr()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	// Wait until the node has written its pidfile and answers on its port,
+	// or gives up starting
+	deadline := time.After(daemonStartTimeout)
+	tick := time.NewTicker(100 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		select {
+		case err := <-exited:
+			return fmt.Errorf("node exited while starting (%v):\n%s", err, logTail(logFile, logStart, 10))
+		case <-deadline:
+			fmt.Printf("Node started as pid %d but isn't listening on %s after %s yet; see %s\n",
+				cmd.Process.Pid, listenAddr, daemonStartTimeout, logFile)
+			return nil
+		case <-tick.C:
+			if pid, err := ReadPIDFile(pidFile); err != nil || pid != cmd.Process.Pid {
+				continue
+			}
+			conn, err := net.DialTimeout("tcp", listenAddr, time.Second)
+			if err != nil {
+				continue
+			}
+			conn.Close()
+			fmt.Printf("Node running in the background as pid %d on %s\n", cmd.Process.Pid, listenAddr)
+			fmt.Printf("Pidfile: %s\nLog:     %s\n", pidFile, logFile)
+			return nil
+		}
+	}
+}
+
+// logTail returns the last lines written to a log file since offset
+func logTail(name string, offset int64, lines int) string {
+	data, err := os.ReadFile(name)
+	if err != nil || offset > int64(len(data)) {
+		return ""
+	}
+	all := strings.Split(string(bytes.TrimRight(data[offset:], "\n")), "\n")
+	if len(all) > lines {
+		all = all[len(all)-lines:]
+	}
+	return strings.Join(all, "\n")
+}
+
+// StopDaemon asks the node named by a pidfile to shut down, waiting up to
+// timeout for it to save its state and exit. It returns the node's process
+// ID.
+func StopDaemon(pidFile string, timeout time.Duration) (int, error) {
+	pid, err := ReadPIDFile(pidFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, fmt.Errorf("no pidfile at %s; is the node running?", pidFile)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !processAlive(pid) {
+		os.Remove(pidFile)
+		return pid, fmt.Errorf("no node is running as pid %d; removed the stale %s", pid, pidFile)
+	}
+	if err := terminate(pid); err != nil {
+		return pid, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for processAlive(pid) {
+		if time.Now().After(deadline) {
+			return pid, fmt.Errorf("node (pid %d) is still running after %s", pid, timeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return pid, nil
+}
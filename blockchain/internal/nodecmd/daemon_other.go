@@ -0,0 +1,30 @@
+//go:build !linux && !darwin
+
+package nodecmd
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// detachedProcAttr leaves the daemon in this process's group, where it
+// can't outlive a closed console
+func detachedProcAttr() *syscall.SysProcAttr {
+	return nil
+}
+
+// processAlive reports whether a process with this ID exists
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
+
+// terminate can't stop a node cleanly here, since there is no SIGTERM
+func terminate(int) error {
+	return errors.New("stopping a node by pidfile isn't supported on this platform")
+}
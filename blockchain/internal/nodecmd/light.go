@@ -0,0 +1,73 @@
+package nodecmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/light"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+	"github.com/oksmith/home-server/pkg/httpserver"
+)
+
+// runLight runs a light client instead of a full node
+func runLight(address string, peers []string, difficulty int, dataDir string, syncInterval time.Duration) error {
+	if len(peers) == 0 {
+		return errors.New("-light requires at least one full peer in -peers")
+	}
+
+	w, err := lightWallet(dataDir)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	client := light.New(w, difficulty, peers)
+	if err := client.Sync(ctx); err != nil {
+		slog.Warn("initial light sync failed", "err", err)
+	}
+	if syncInterval > 0 {
+		client.StartSyncLoop(ctx, syncInterval)
+	}
+
+	fmt.Printf("\n=== LIGHT NODE INFO ===\n")
+	fmt.Printf("Address: %s\n", address)
+	fmt.Printf("Wallet Address: %s\n", w.Address())
+	fmt.Printf("Height: %d\n", client.Height())
+	fmt.Printf("Balance: %.2f coins\n", client.Balance())
+	fmt.Printf("Full Peers: %v\n\n", peers)
+
+	srv := &http.Server{Addr: address, Handler: client.Handler()}
+	return httpserver.ListenAndServe(ctx, srv, "", "")
+}
+
+// lightWallet loads the wallet from the data directory, creating it on first
+// run, or makes a throwaway one when no data directory is given
+func lightWallet(dataDir string) (*wallet.Wallet, error) {
+	if dataDir == "" {
+		return wallet.New()
+	}
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	filename := filepath.Join(dataDir, "wallet.pem")
+	w, err := wallet.LoadFromFile(filename)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return w, err
+	}
+	if w, err = wallet.New(); err != nil {
+		return nil, err
+	}
+	return w, w.SaveToFile(filename)
+}
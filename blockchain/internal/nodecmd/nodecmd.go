@@ -0,0 +1,447 @@
+// Package nodecmd runs a full or light node from command line flags. It backs
+// both cmd/node and "bchain node start".
+package nodecmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+	"github.com/oksmith/home-server/blockchain/pkg/logging"
+	"github.com/oksmith/home-server/blockchain/pkg/nat"
+	"github.com/oksmith/home-server/blockchain/pkg/node"
+	"github.com/oksmith/home-server/pkg/config"
+	"github.com/oksmith/home-server/pkg/notify"
+	"github.com/oksmith/home-server/pkg/registry"
+	"github.com/oksmith/home-server/pkg/sigauth"
+)
+
+// Run parses args as node flags and runs the node until it is interrupted.
+// Settings from -config apply where no flag overrides them. With -daemon, args
+// must be the tail of os.Args, which the node's background copy repeats.
+func Run(args []string) error {
+	fs, o, r := newRunFlagSet()
+	fs.Parse(args)
+	if r.version {
+		fmt.Println("node " + describeBuild(node.Build()))
+		return nil
+	}
+	given := givenFlags(fs)
+	var cfg *config.Config
+	if r.configFile != "" {
+		var err error
+		if cfg, err = loadConfig(fs, r.configFile); err != nil {
+			return err
+		}
+	}
+
+	logger, err := logging.New(os.Stderr, o.logLevel, o.logFormat)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+
+	regtest := false
+	switch o.network {
+	case "main":
+	case "regtest":
+		regtest = true
+		if !flagSet(fs, "difficulty") {
+			o.difficulty = node.MaxRegtestDifficulty
+		}
+	default:
+		return fmt.Errorf("unknown network %q (use main or regtest)", o.network)
+	}
+
+	// A genesis spec sets the chain's difficulty and reward
+	var genesis *chain.Genesis
+	if o.genesis != "" {
+		if genesis, err = chain.LoadGenesis(o.genesis); err != nil {
+			return err
+		}
+		o.difficulty, o.reward = genesis.Difficulty, genesis.MiningReward
+	}
+
+	listenAddr := o.listen
+	if listenAddr == "" {
+		listenAddr = fmt.Sprintf("localhost:%d", o.port)
+	}
+
+	if r.daemon && os.Getenv(daemonEnv) == "" {
+		return startDaemon(args, o, r.logFile, listenAddr)
+	}
+	if o.pidFile != "" {
+		release, err := writePIDFile(o.pidFile)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	if o.lightMode {
+		return runLight(listenAddr, parsePeers(o.peers), o.difficulty, o.dataDir, o.syncInterval)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Forward the listen port on the router, advertising the public address
+	// unless one was given explicitly
+	var natReleased <-chan struct{}
+	address := o.advertise
+	if o.natMethod != "none" {
+		external, released, err := mapPort(ctx, o.natMethod, listenAddr)
+		if err != nil {
+			slog.Warn("NAT port mapping failed", "method", o.natMethod, "err", err)
+		} else {
+			natReleased = released
+			if address == "" {
+				address = external
+			}
+		}
+	}
+	if address == "" {
+		if address, err = node.AdvertiseAddress(listenAddr); err != nil {
+			return err
+		}
+	}
+
+	// Create node, restoring its state from the data directory if one is given
+	var n *node.Node
+	if o.dataDir != "" {
+		n, err = node.Open(o.dataDir, address, o.difficulty, o.reward)
+	} else {
+		n, err = node.New(address, o.difficulty, o.reward)
+	}
+	if err != nil {
+		return err
+	}
+
+	if regtest {
+		if err := n.EnableRegtest(); err != nil {
+			return err
+		}
+	}
+	if genesis != nil {
+		if err := n.UseGenesis(genesis); err != nil {
+			return err
+		}
+	}
+	if o.halvingInterval != 0 || o.rewardCurve != "" {
+		curve, err := chain.ParseRewardCurve(o.rewardCurve)
+		if err != nil {
+			return err
+		}
+		if err := n.SetEmission(chain.Emission{HalvingInterval: o.halvingInterval, Curve: curve}); err != nil {
+			return err
+		}
+	}
+
+	if o.peerAllow != "" || o.peerDeny != "" || o.private {
+		err := n.SetPeerFilter(node.PeerFilter{
+			Allow:   strings.Split(o.peerAllow, ","),
+			Deny:    strings.Split(o.peerDeny, ","),
+			Private: o.private,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	n.SetListenAddress(listenAddr)
+	n.SetPeerClientConfig(node.PeerClientConfig{
+		Timeout: o.peerTimeout,
+		Retries: o.peerRetries,
+		Backoff: o.peerBackoff,
+	})
+
+	if o.corsOrigins != "" {
+		n.SetCORSOrigins(strings.Split(o.corsOrigins, ","))
+	}
+
+	n.SetAdminToken(o.adminToken)
+	keys, err := sigauth.LoadKeyring(o.authorizedKeys)
+	if err != nil {
+		return fmt.Errorf("-authorized-keys: %w", err)
+	}
+	n.SetAdminKeys(keys)
+
+	// Without a token, the node's wallet signs requests to other services
+	signer, err := n.Wallet.RequestSigner()
+	if err != nil {
+		return err
+	}
+	if events := notify.NewClient(o.notifyURL, notifySource, func() string { return o.notifyToken }, signer); events != nil {
+		n.SetEventHook(notifyEvents(events))
+		slog.Info("sending mined blocks and reorgs to the notification hub", "url", o.notifyURL)
+	}
+
+	if o.pool {
+		n.EnablePool(o.poolNonceRange)
+	}
+
+	if o.bootstrap != "" {
+		slog.Info("bootstrapping from snapshot", "node", address, "source", o.bootstrap)
+		if err := n.Bootstrap(o.bootstrap); err != nil {
+			slog.Warn("snapshot bootstrap failed", "node", address, "err", err)
+		}
+	}
+
+	// Keep WebSocket sessions open to peers as they are added
+	n.StartPeerSessions(ctx)
+
+	// Add peers
+	for _, peer := range parsePeers(o.peers) {
+		n.AddPeer(peer)
+	}
+
+	// Sync with peers on startup
+	if len(n.GetPeers()) > 0 {
+		slog.Info("syncing with peers", "node", address)
+		if err := n.SyncWithPeers(ctx); err != nil {
+			slog.Warn("initial sync failed", "node", address, "err", err)
+		}
+	}
+
+	if o.syncInterval > 0 {
+		n.StartSyncLoop(ctx, o.syncInterval)
+	}
+
+	// Pick up new peers and admin tokens from the config file as it changes
+	if cfg != nil {
+		cfg.OnReload(reloadConfig(cfg, n, given))
+		go cfg.Watch(ctx, config.DefaultPoll)
+	}
+
+	if err := n.SetMiningThrottle(block.ThrottleConfig{CPUPercent: o.mineCPU, MaxHashRate: o.mineHashRate}); err != nil {
+		return err
+	}
+	if o.mine {
+		if err := n.StartMining(o.mineInterval, o.mineEmptyInterval); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("\n=== NODE INFO ===\n")
+	fmt.Printf("Version: %s\n", describeBuild(node.Build()))
+	fmt.Printf("Network: %s\n", o.network)
+	fmt.Printf("Address: %s\n", address)
+	fmt.Printf("Listening On: %s\n", listenAddr)
+	fmt.Printf("Wallet Address: %s\n", n.Wallet.Address())
+	fmt.Printf("Chain Length: %d blocks\n", n.Chain.Length())
+	fmt.Printf("Balance: %.2f coins\n", n.Chain.GetBalance(n.Wallet.Address()))
+	fmt.Printf("Peers: %v\n\n", n.GetPeers())
+
+	// Register with the gateway while serving, withdrawing once stopped
+	var withdrawn chan struct{}
+	if o.gateway != "" {
+		withdrawn = make(chan struct{})
+		s := registry.Service{Name: o.gatewayName, URL: "http://" + address}
+		go func() {
+			registry.Announce(ctx, o.gateway, o.gatewayToken, signer, func() registry.Service {
+				s.Token = n.AdminToken()
+				return s
+			}, registry.DefaultTTL/3)
+			close(withdrawn)
+		}()
+	}
+
+	// Serve until interrupted, letting requests in flight finish
+	if err := n.Serve(ctx); err != nil {
+		return err
+	}
+	if withdrawn != nil {
+		<-withdrawn
+	}
+
+	slog.Info("shutting down, saving state", "node", address)
+	n.Shutdown()
+	n.StopMining()
+	if err := n.SaveState(); err != nil {
+		return err
+	}
+	if natReleased != nil {
+		<-natReleased
+	}
+	return nil
+}
+
+// Flags returns every flag Run accepts, e.g. for shell completion
+func Flags() *flag.FlagSet {
+	fs, _, _ := newRunFlagSet()
+	return fs
+}
+
+// describeBuild sums up build details in one line, e.g.
+// "0.1.0 (commit 092a473, go1.24.5), protocol 1 (min 1), chain rules 1"
+func describeBuild(b node.BuildInfo) string {
+	commit := b.Commit
+	if commit == "" {
+		commit = "unknown"
+	}
+	return fmt.Sprintf("%s (commit %s, %s), protocol %d (min %d), chain rules %d",
+		b.Version, commit, b.GoVersion, b.ProtocolVersion, b.MinProtocolVersion, b.ChainRulesVersion)
+}
+
+// runFlags holds the flags Run takes besides the node settings, which a
+// config file can't set
+type runFlags struct {
+	configFile string
+	daemon     bool
+	logFile    string
+	version    bool
+}
+
+// newRunFlagSet defines the node's settings and Run's own flags
+func newRunFlagSet() (*flag.FlagSet, *options, *runFlags) {
+	fs, o := newFlagSet()
+	r := &runFlags{}
+	fs.StringVar(&r.configFile, "config", "", "Config file of settings, one per line as name = value (flags override it)")
+	fs.BoolVar(&r.daemon, "daemon", false, "Run in the background, writing a pidfile (defaults to DATADIR/node.pid) and appending output to -log-file")
+	fs.StringVar(&r.logFile, "log-file", "", "File a -daemon node appends its output to (defaults to DATADIR/node.log)")
+	fs.BoolVar(&r.version, "version", false, "Print the node's version, commit and protocol and chain rule versions, then exit")
+	return fs, o, r
+}
+
+// options holds the node settings given by flags or a config file
+type options struct {
+	port              int
+	listen            string
+	advertise         string
+	peers             string
+	network           string
+	difficulty        int
+	reward            float64
+	halvingInterval   int64
+	rewardCurve       string
+	genesis           string
+	peerAllow         string
+	peerDeny          string
+	private           bool
+	peerTimeout       time.Duration
+	peerRetries       int
+	peerBackoff       time.Duration
+	syncInterval      time.Duration
+	mine              bool
+	mineInterval      time.Duration
+	mineEmptyInterval time.Duration
+	mineCPU           int
+	mineHashRate      float64
+	lightMode         bool
+	pool              bool
+	poolNonceRange    int64
+	dataDir           string
+	pidFile           string
+	corsOrigins       string
+	adminToken        string
+	authorizedKeys    string
+	gateway           string
+	gatewayToken      string
+	gatewayName       string
+	notifyURL         string
+	notifyToken       string
+	natMethod         string
+	bootstrap         string
+	logLevel          string
+	logFormat         string
+}
+
+// newFlagSet defines the node's flags, which are also the settings a config
+// file can hold
+func newFlagSet() (*flag.FlagSet, *options) {
+	fs := flag.NewFlagSet("node", flag.ExitOnError)
+	o := &options{}
+	fs.IntVar(&o.port, "port", 8080, "Port to run the node on")
+	fs.StringVar(&o.listen, "listen", "", "Address to bind to, e.g. 0.0.0.0:8080 or [::]:8080 (defaults to localhost:<port>)")
+	fs.StringVar(&o.advertise, "advertise", "", "Address peers should use to reach this node (defaults to the listen address, or this machine's LAN IP when listening on all interfaces)")
+	fs.StringVar(&o.peers, "peers", "", "Comma-separated list of peer addresses (e.g., localhost:8081,localhost:8082)")
+	fs.StringVar(&o.network, "network", "main", "Network mode: main, or regtest for local development (difficulty 1, shared genesis, POST /generate)")
+	fs.IntVar(&o.difficulty, "difficulty", 3, "Mining difficulty")
+	fs.Float64Var(&o.reward, "reward", 50.0, "Mining reward")
+	fs.Int64Var(&o.halvingInterval, "halving-interval", 0, "Halve the mining reward every this many blocks (0 never halves)")
+	fs.StringVar(&o.rewardCurve, "reward-curve", "", "Mining reward from given heights on, as HEIGHT:REWARD,... (instead of -halving-interval)")
+	fs.StringVar(&o.genesis, "genesis", "", "genesis.json giving the first block's timestamp, difficulty, reward and premined balances (overrides -difficulty and -reward)")
+	fs.StringVar(&o.peerAllow, "peer-allow", "", "Comma-separated IPs, CIDR ranges, hostnames or host:port pairs allowed as peers (empty allows any)")
+	fs.StringVar(&o.peerDeny, "peer-deny", "", "Comma-separated IPs, CIDR ranges, hostnames or host:port pairs never peered with or answered")
+	fs.BoolVar(&o.private, "private", false, "Refuse every API request not from localhost or -peer-allow")
+	fs.DurationVar(&o.peerTimeout, "peer-timeout", node.DefaultPeerClientConfig.Timeout, "Time limit for each request to a peer")
+	fs.IntVar(&o.peerRetries, "peer-retries", node.DefaultPeerClientConfig.Retries, "Extra attempts for peer requests that fail with network or server errors")
+	fs.DurationVar(&o.peerBackoff, "peer-backoff", node.DefaultPeerClientConfig.Backoff, "Wait before retrying a peer request, doubling after each attempt")
+	fs.DurationVar(&o.syncInterval, "sync-interval", 30*time.Second, "How often to reconcile with peers in the background (0 disables)")
+	fs.BoolVar(&o.mine, "mine", false, "Continuously mine blocks in the background")
+	fs.DurationVar(&o.mineInterval, "mine-interval", node.DefaultMiningInterval, "How often the miner checks the mempool for work")
+	fs.DurationVar(&o.mineEmptyInterval, "mine-empty-interval", 0, "Mine an empty block when the tip is older than this (0 only mines when there are transactions)")
+	fs.IntVar(&o.mineCPU, "mine-cpu", 100, "Percentage of one CPU core mining may use (1-100)")
+	fs.Float64Var(&o.mineHashRate, "mine-hashrate", 0, "Cap on hashes per second while mining (0 for no cap)")
+	fs.BoolVar(&o.lightMode, "light", false, "Run as a light client that keeps only headers and this wallet's transactions (requires -peers)")
+	fs.BoolVar(&o.pool, "pool", false, "Serve /work/get and /work/submit so worker processes can mine for this node")
+	fs.Int64Var(&o.poolNonceRange, "pool-nonce-range", node.DefaultNonceRange, "Nonces handed to a pool worker per work unit")
+	fs.StringVar(&o.dataDir, "datadir", "", "Directory to persist the chain, wallet and peers in (empty keeps everything in memory)")
+	fs.StringVar(&o.pidFile, "pidfile", "", "File to write the node's process ID to while it runs")
+	fs.StringVar(&o.corsOrigins, "cors-origins", "", "Comma-separated browser origins allowed to call read endpoints (\"*\" for any)")
+	fs.StringVar(&o.adminToken, "admin-token", os.Getenv("NODE_ADMIN_TOKEN"), "Bearer token for admin endpoints such as /chain/import and /shutdown (defaults to $NODE_ADMIN_TOKEN; empty disables them)")
+	fs.StringVar(&o.authorizedKeys, "authorized-keys", "", "File of wallet keys trusted to sign requests to admin endpoints, as well as -admin-token")
+	fs.StringVar(&o.gateway, "gateway", "", "Home-server gateway to register with, e.g. http://gateway.lan:8000, which then serves this node's API under /<gateway-name> using -admin-token")
+	fs.StringVar(&o.gatewayToken, "gateway-token", os.Getenv("GATEWAY_REGISTRY_TOKEN"), "The gateway's registry token (defaults to $GATEWAY_REGISTRY_TOKEN)")
+	fs.StringVar(&o.gatewayName, "gateway-name", "blockchain", "Name to register with the gateway as, which is also the path it serves the node under")
+	fs.StringVar(&o.notifyURL, "notify-url", "", "Home-server notify-service to tell about mined blocks and reorgs, e.g. http://nas.lan:8097")
+	fs.StringVar(&o.notifyToken, "notify-token", os.Getenv("NOTIFY_TOKEN"), "The notify-service's token (defaults to $NOTIFY_TOKEN; without one, the node's wallet signs its requests)")
+	fs.StringVar(&o.natMethod, "nat", "none", "Map the listen port on the router: none, upnp, pmp or auto")
+	fs.StringVar(&o.bootstrap, "bootstrap", "", "Chain snapshot file or URL to import on startup (e.g. http://peer:8080/chain/export)")
+	fs.StringVar(&o.logLevel, "log-level", "info", "Log level: debug, info, warn or error")
+	fs.StringVar(&o.logFormat, "log-format", "text", "Log format: text or json")
+	return fs, o
+}
+
+// mapPort discovers the router and forwards the listen port on it
+func mapPort(ctx context.Context, method, listenAddr string) (string, <-chan struct{}, error) {
+	_, portStr, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid listen address %q: %w", listenAddr, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid listen port %q: %w", portStr, err)
+	}
+
+	discoverCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	m, err := nat.Discover(discoverCtx, method)
+	if err != nil {
+		return "", nil, err
+	}
+	return nat.MapPort(ctx, m, port, nat.DefaultLifetime)
+}
+
+// flagSet reports whether a flag was given on the command line
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// parsePeers splits a comma-separated peer list, dropping blanks
+func parsePeers(list string) []string {
+	var peers []string
+	for _, peer := range strings.Split(list, ",") {
+		peer = strings.TrimSpace(peer)
+		if peer != "" {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
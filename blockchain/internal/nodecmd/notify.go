@@ -0,0 +1,44 @@
+package nodecmd
+
+import (
+	"fmt"
+
+	"github.com/oksmith/home-server/blockchain/pkg/node"
+	"github.com/oksmith/home-server/pkg/notify"
+)
+
+// notifySource is the source the node's notifications are sent as
+const notifySource = "node"
+
+// notifyEvents passes the node's events worth telling people about to the
+// notification hub: blocks it mines, as block_found, and reorgs
+func notifyEvents(c *notify.Client) func(node.Event) {
+	return func(e node.Event) {
+		if m, ok := eventMessage(e); ok {
+			c.Send(m)
+		}
+	}
+}
+
+// eventMessage describes an event as a notification, if it is one to send
+func eventMessage(e node.Event) (notify.Message, bool) {
+	fields := make(map[string]string, len(e.Fields))
+	for k, v := range e.Fields {
+		fields[k] = fmt.Sprint(v)
+	}
+	m := notify.Message{Fields: fields, Time: e.Time}
+	switch {
+	case e.Type == node.EventBlockAccepted && e.Fields["source"] == "mined":
+		m.Event = "block_found"
+		m.Title = "Mined block " + fields["height"]
+		m.Text = "hash " + fields["hash"]
+	case e.Type == node.EventReorg:
+		m.Event = node.EventReorg
+		m.Priority = notify.High
+		m.Title = fmt.Sprintf("Chain reorganised at height %s", fields["old_height"])
+		m.Text = fmt.Sprintf("dropped %s blocks; the tip is now at height %s", fields["dropped"], fields["new_height"])
+	default:
+		return m, false
+	}
+	return m, true
+}
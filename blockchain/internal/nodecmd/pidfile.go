@@ -0,0 +1,41 @@
+package nodecmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ReadPIDFile returns the process ID a node wrote to its pidfile
+func ReadPIDFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("%s: not a pidfile", path)
+	}
+	return pid, nil
+}
+
+// writePIDFile records this process's ID in path, refusing if it names
+// another process that is still running. A pidfile left behind by a node
+// that crashed is replaced. The returned function removes the file, unless
+// something else has taken it over since.
+func writePIDFile(path string) (func(), error) {
+	pid := os.Getpid()
+	if old, err := ReadPIDFile(path); err == nil && old != pid && processAlive(old) {
+		return nil, fmt.Errorf("a node is already running as pid %d (from %s)", old, path)
+	}
+
+	if err := os.WriteFile(path, []byte(strconv.Itoa(pid)+"\n"), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write pidfile: %w", err)
+	}
+	return func() {
+		if current, err := ReadPIDFile(path); err == nil && current == pid {
+			os.Remove(path)
+		}
+	}, nil
+}
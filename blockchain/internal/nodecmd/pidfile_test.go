@@ -0,0 +1,43 @@
+package nodecmd
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWritePIDFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.pid")
+
+	release, err := writePIDFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pid, err := ReadPIDFile(path); err != nil || pid != os.Getpid() {
+		t.Fatalf("ReadPIDFile = %d, %v, want %d", pid, err, os.Getpid())
+	}
+	release()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("pidfile still exists after release: %v", err)
+	}
+
+	// A running process's pidfile is refused, a garbled one replaced
+	os.WriteFile(path, []byte(strconv.Itoa(os.Getppid())+"\n"), 0644)
+	if _, err := writePIDFile(path); err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Errorf("writePIDFile over a live pid: %v, want already running", err)
+	}
+	os.WriteFile(path, []byte("garbage"), 0644)
+	release, err = writePIDFile(path)
+	if err != nil {
+		t.Fatalf("writePIDFile over a garbled pidfile: %v", err)
+	}
+
+	// release leaves a pidfile another node has since written alone
+	os.WriteFile(path, []byte("1\n"), 0644)
+	release()
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("release removed another node's pidfile: %v", err)
+	}
+}
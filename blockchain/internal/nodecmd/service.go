@@ -0,0 +1,119 @@
+package nodecmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Service describes a systemd unit that runs a node at boot
+type Service struct {
+	Name    string   // unit name, without .service
+	Binary  string   // absolute path of the bchain binary
+	User    string   // user the node runs as (empty for root)
+	DataDir string   // absolute path of the node's data directory
+	EnvFile string   // optional file of environment variables, e.g. NODE_ADMIN_TOKEN
+	Args    []string // node flags, not including -datadir
+}
+
+// stateDirRoot is where systemd's StateDirectory= creates directories
+const stateDirRoot = "/var/lib/"
+
+// Validate checks the service's settings, including that Args are node
+// flags a foreground node accepts
+func (s Service) Validate() error {
+	if s.Name == "" || strings.ContainsAny(s.Name, "/ \t\n") {
+		return fmt.Errorf("invalid service name %q", s.Name)
+	}
+	if strings.ContainsAny(s.User, " \t\n/:") {
+		return fmt.Errorf("invalid user %q", s.User)
+	}
+	for _, v := range append([]string{s.Binary, s.DataDir}, s.Args...) {
+		if strings.ContainsAny(v, "\n\r") {
+			return fmt.Errorf("%q can't contain a line break", v)
+		}
+	}
+	if !filepath.IsAbs(s.Binary) {
+		return fmt.Errorf("binary %q must be an absolute path", s.Binary)
+	}
+	if !filepath.IsAbs(s.DataDir) {
+		return fmt.Errorf("datadir %q must be an absolute path", s.DataDir)
+	}
+	if s.EnvFile != "" && (!filepath.IsAbs(s.EnvFile) || strings.ContainsAny(s.EnvFile, " \t\n\"'")) {
+		return fmt.Errorf("env file %q must be an absolute path without spaces or quotes", s.EnvFile)
+	}
+
+	fs, _ := newFlagSet()
+	fs.Init(fs.Name(), flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.String("config", "", "")
+	if err := fs.Parse(s.Args); err != nil {
+		return fmt.Errorf("node flags: %w", err)
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("node flags: unexpected argument %q", fs.Arg(0))
+	}
+	if flagSet(fs, "datadir") {
+		return errors.New("node flags: set the data directory with -datadir, not as a node flag")
+	}
+	return nil
+}
+
+// Unit returns the systemd unit file for the service. The node runs in the
+// foreground under systemd, which restarts it if it fails.
+func (s Service) Unit() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Written by bchain node install-service\n")
+	fmt.Fprintf(&b, "[Unit]\n")
+	fmt.Fprintf(&b, "Description=bchain node\n")
+	fmt.Fprintf(&b, "Wants=network-online.target\n")
+	fmt.Fprintf(&b, "After=network-online.target\n")
+	fmt.Fprintf(&b, "\n[Service]\n")
+	fmt.Fprintf(&b, "Type=simple\n")
+	if s.User != "" {
+		fmt.Fprintf(&b, "User=%s\n", s.User)
+	}
+	if s.EnvFile != "" {
+		fmt.Fprintf(&b, "EnvironmentFile=%s\n", strings.ReplaceAll(s.EnvFile, "%", "%%"))
+	}
+
+	args := append([]string{s.Binary, "node", "start"}, s.Args...)
+	args = append(args, "-datadir", s.DataDir)
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = systemdQuote(arg)
+	}
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(quoted, " "))
+
+	// Let systemd create the data directory, owned by User, when it can
+	rel, ok := strings.CutPrefix(filepath.Clean(s.DataDir), stateDirRoot)
+	if ok && rel != "" && systemdQuote(rel) == rel {
+		fmt.Fprintf(&b, "StateDirectory=%s\n", rel)
+		fmt.Fprintf(&b, "StateDirectoryMode=0700\n")
+	}
+	fmt.Fprintf(&b, "Restart=on-failure\n")
+	fmt.Fprintf(&b, "RestartSec=5\n")
+	// The node saves its chain on SIGTERM, which can take a while
+	fmt.Fprintf(&b, "TimeoutStopSec=60\n")
+	fmt.Fprintf(&b, "NoNewPrivileges=true\n")
+	fmt.Fprintf(&b, "PrivateTmp=true\n")
+	fmt.Fprintf(&b, "\n[Install]\n")
+	fmt.Fprintf(&b, "WantedBy=multi-user.target\n")
+	return b.String()
+}
+
+// systemdQuote quotes an ExecStart word or path if it needs it, escaping
+// the specifiers and variables systemd would otherwise expand
+func systemdQuote(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	s = strings.ReplaceAll(s, "$", "$$")
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\;") {
+		return s
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
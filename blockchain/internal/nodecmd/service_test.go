@@ -0,0 +1,81 @@
+package nodecmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestServiceUnit(t *testing.T) {
+	s := Service{
+		Name:    "bchain-node",
+		Binary:  "/usr/local/bin/bchain",
+		User:    "pi",
+		DataDir: "/var/lib/bchain-node",
+		EnvFile: "/etc/bchain/node.env",
+		Args:    []string{"-network", "regtest", "-port", "18080", "-cors-origins", "*", "-log-format", "a b"},
+	}
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	unit := s.Unit()
+	for _, want := range []string{
+		"User=pi\n",
+		"EnvironmentFile=/etc/bchain/node.env\n",
+		`ExecStart=/usr/local/bin/bchain node start -network regtest -port 18080 -cors-origins * -log-format "a b" -datadir /var/lib/bchain-node` + "\n",
+		"StateDirectory=bchain-node\n",
+		"Restart=on-failure\n",
+		"WantedBy=multi-user.target\n",
+	} {
+		if !strings.Contains(unit, want) {
+			t.Errorf("unit is missing %q:\n%s", want, unit)
+		}
+	}
+
+	// Outside /var/lib, the directory must already exist
+	s.DataDir = "/home/pi/chain"
+	if unit := s.Unit(); strings.Contains(unit, "StateDirectory") {
+		t.Errorf("unit for a home datadir has a StateDirectory:\n%s", unit)
+	}
+}
+
+func TestServiceValidate(t *testing.T) {
+	base := Service{Name: "bchain-node", Binary: "/usr/bin/bchain", DataDir: "/var/lib/bchain-node"}
+	tests := []struct {
+		name   string
+		modify func(*Service)
+		want   string
+	}{
+		{"relative binary", func(s *Service) { s.Binary = "bchain" }, "absolute"},
+		{"relative datadir", func(s *Service) { s.DataDir = "chain" }, "absolute"},
+		{"bad name", func(s *Service) { s.Name = "a/b" }, "invalid service name"},
+		{"unknown flag", func(s *Service) { s.Args = []string{"-frobnicate"} }, "not defined"},
+		{"daemon", func(s *Service) { s.Args = []string{"-daemon"} }, "not defined"},
+		{"datadir flag", func(s *Service) { s.Args = []string{"-datadir", "/x"} }, "-datadir"},
+		{"positional", func(s *Service) { s.Args = []string{"-mine", "extra"} }, "unexpected argument"},
+		{"line break", func(s *Service) { s.Args = []string{"-peers", "a\nExecStartPre=/bin/sh"} }, "line break"},
+	}
+	for _, tt := range tests {
+		s := base
+		tt.modify(&s)
+		if err := s.Validate(); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Validate error = %v, want one containing %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestSystemdQuote(t *testing.T) {
+	tests := map[string]string{
+		"plain":      "plain",
+		"a b":        `"a b"`,
+		`say "hi"`:   `"say \"hi\""`,
+		"100%":       "100%%",
+		"$HOME":      "$$HOME",
+		"":           `""`,
+		`back\slash`: `"back\\slash"`,
+	}
+	for in, want := range tests {
+		if got := systemdQuote(in); got != want {
+			t.Errorf("systemdQuote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
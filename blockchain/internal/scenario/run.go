@@ -0,0 +1,170 @@
+package scenario
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/oksmith/home-server/blockchain/pkg/client"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+// balanceTolerance absorbs float rounding when comparing balances
+const balanceTolerance = 1e-9
+
+// Result is the outcome of one step
+type Result struct {
+	Line   int    `json:"line"`
+	Step   string `json:"step"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Runner runs scenarios against a node
+type Runner struct {
+	Client *client.Client
+
+	// Wallet looks up a wallet the scenario didn't create, e.g. a saved one.
+	// Nil means only the scenario's own wallets can send.
+	Wallet func(ctx context.Context, name string) (*wallet.Wallet, error)
+	// Address resolves a name the scenario didn't create to an address. Nil
+	// treats it as an address already.
+	Address func(name string) (string, error)
+
+	wallets map[string]*wallet.Wallet
+	regtest bool
+}
+
+// Run runs each step in order, calling report after each one, and stops at
+// the first that fails
+func (r *Runner) Run(ctx context.Context, s *Scenario, report func(Result)) error {
+	st, err := r.Client.Status(ctx)
+	if err != nil {
+		return err
+	}
+	r.regtest = st.Regtest
+	r.wallets = make(map[string]*wallet.Wallet)
+
+	for _, step := range s.Steps {
+		detail, err := r.runStep(ctx, step)
+		result := Result{Line: step.Line, Step: step.String(), OK: err == nil, Detail: detail}
+		if err != nil {
+			result.Detail = err.Error()
+		}
+		report(result)
+		if err != nil {
+			return fmt.Errorf("line %d: %s: %w", step.Line, step, err)
+		}
+	}
+	return nil
+}
+
+// runStep runs one step, returning a note on what happened
+func (r *Runner) runStep(ctx context.Context, step Step) (string, error) {
+	switch step.Action {
+	case ActionWallet:
+		w, err := wallet.New()
+		if err != nil {
+			return "", err
+		}
+		r.wallets[step.Subject] = w
+		return w.Address(), nil
+
+	case ActionFund:
+		address, err := r.address(step.Subject)
+		if err != nil {
+			return "", err
+		}
+		result, err := r.Client.Faucet(ctx, address, step.Amount)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("txid %s at height %d", result.TxID, result.Height), nil
+
+	case ActionSend:
+		return r.send(ctx, step)
+
+	case ActionMine:
+		if r.regtest {
+			if _, err := r.Client.Generate(ctx, step.Count); err != nil {
+				return "", err
+			}
+		} else {
+			for i := 0; i < step.Count; i++ {
+				if err := r.Client.Mine(ctx); err != nil {
+					return "", err
+				}
+			}
+		}
+		st, err := r.Client.Status(ctx)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("height %d", st.Height), nil
+
+	case ActionBalance:
+		address, err := r.address(step.Subject)
+		if err != nil {
+			return "", err
+		}
+		balance, err := r.Client.Balance(ctx, address)
+		if err != nil {
+			return "", err
+		}
+		if math.Abs(balance-step.Amount) > balanceTolerance {
+			return "", fmt.Errorf("balance is %s, want %s", formatAmount(balance), formatAmount(step.Amount))
+		}
+		return "", nil
+
+	case ActionHeight:
+		st, err := r.Client.Status(ctx)
+		if err != nil {
+			return "", err
+		}
+		if st.Height != int64(step.Count) {
+			return "", fmt.Errorf("height is %d, want %d", st.Height, step.Count)
+		}
+		return "", nil
+	}
+	return "", fmt.Errorf("unknown action %q", step.Action)
+}
+
+// send signs a transfer and submits it to the node
+func (r *Runner) send(ctx context.Context, step Step) (string, error) {
+	w, ok := r.wallets[step.Subject]
+	if !ok {
+		if r.Wallet == nil {
+			return "", fmt.Errorf("no wallet %q (create it with a wallet step)", step.Subject)
+		}
+		var err error
+		if w, err = r.Wallet(ctx, step.Subject); err != nil {
+			return "", err
+		}
+	}
+	to, err := r.address(step.To)
+	if err != nil {
+		return "", err
+	}
+
+	tx := transaction.New(w.Address(), to, step.Amount)
+	if err := tx.Sign(w.PrivateKey); err != nil {
+		return "", fmt.Errorf("failed to sign transaction: %w", err)
+	}
+	resp, err := r.Client.SubmitTransaction(ctx, tx)
+	if err != nil {
+		return "", fmt.Errorf("rejected: %w", err)
+	}
+	return "txid " + resp.TxID, nil
+}
+
+// address resolves a scenario wallet name, or else falls back to Address
+func (r *Runner) address(name string) (string, error) {
+	if w, ok := r.wallets[name]; ok {
+		return w.Address(), nil
+	}
+	if r.Address == nil {
+		return name, nil
+	}
+	return r.Address(name)
+}
@@ -0,0 +1,80 @@
+package scenario
+
+import (
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/client"
+	"github.com/oksmith/home-server/blockchain/pkg/node"
+)
+
+// startRegtest serves a fresh regtest node and returns a runner pointed at it
+func startRegtest(t *testing.T) *Runner {
+	t.Helper()
+	n, err := node.New("localhost:9000", 1, 50.0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.EnableRegtest(); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(n.Handler())
+	t.Cleanup(srv.Close)
+	return &Runner{Client: client.New(srv.URL)}
+}
+
+func TestRunStory(t *testing.T) {
+	data, err := os.ReadFile("../../cmd/bchain/scenarios/story.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var results []Result
+	if err := startRegtest(t).Run(t.Context(), s, func(r Result) { results = append(results, r) }); err != nil {
+		t.Fatalf("story failed: %v\n%+v", err, results)
+	}
+	if len(results) != len(s.Steps) {
+		t.Errorf("got %d results for %d steps", len(results), len(s.Steps))
+	}
+}
+
+func TestRunStopsAtFailure(t *testing.T) {
+	s, err := Parse([]byte(`steps:
+  - wallet: alice
+  - fund: alice
+    amount: 10
+  - balance: alice
+    equals: 11
+  - mine: 1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var results []Result
+	err = startRegtest(t).Run(t.Context(), s, func(r Result) { results = append(results, r) })
+	if err == nil || !strings.Contains(err.Error(), "line 5") || !strings.Contains(err.Error(), "balance is 10, want 11") {
+		t.Errorf("Run error = %v, want the balance on line 5 to fail", err)
+	}
+	if len(results) != 3 || results[2].OK {
+		t.Errorf("results = %+v, want two passes then a failure", results)
+	}
+}
+
+func TestRunUnknownSender(t *testing.T) {
+	s, _ := Parse([]byte(`steps:
+  - send: alice
+    to: bob
+    amount: 1
+`))
+	err := startRegtest(t).Run(t.Context(), s, func(Result) {})
+	if err == nil || !strings.Contains(err.Error(), `no wallet "alice"`) {
+		t.Errorf("Run error = %v, want alice to be unknown", err)
+	}
+}
@@ -0,0 +1,175 @@
+// Package scenario runs scripted stories of wallets, transfers, mining and
+// balance checks against a node, for demos and end-to-end checks.
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Step actions. Each step has exactly one action key, whose value is the
+// step's subject.
+const (
+	ActionWallet  = "wallet"  // create a throwaway wallet with this name
+	ActionFund    = "fund"    // pay amount to a wallet from a regtest node's faucet
+	ActionSend    = "send"    // sign and submit amount from this wallet to another
+	ActionMine    = "mine"    // mine this many blocks
+	ActionBalance = "balance" // check a wallet's confirmed balance equals an amount
+	ActionHeight  = "height"  // check the chain is this high
+)
+
+// stepFields lists the keys each action allows besides its own
+var stepFields = map[string][]string{
+	ActionWallet:  nil,
+	ActionFund:    {"amount"},
+	ActionSend:    {"to", "amount"},
+	ActionMine:    nil,
+	ActionBalance: {"equals"},
+	ActionHeight:  nil,
+}
+
+// maxMineBlocks bounds a single mine step
+const maxMineBlocks = 1000
+
+// Scenario is a parsed scenario file
+type Scenario struct {
+	Name  string
+	Steps []Step
+}
+
+// Step is one checked step of a scenario
+type Step struct {
+	Line    int     // where the step starts in the file
+	Action  string  // one of the Action constants
+	Subject string  // the action key's value: a wallet name, address or count
+	To      string  // send recipient
+	Amount  float64 // fund and send amount, or the balance expected
+	Count   int     // blocks to mine, or the height expected
+}
+
+// Parse reads a scenario file and checks every step is complete, so a
+// mistake late in the file is caught before anything runs
+func Parse(data []byte) (*Scenario, error) {
+	doc, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	for key := range doc.top {
+		if key != "name" {
+			return nil, fmt.Errorf("unknown top-level key %q (use name and steps)", key)
+		}
+	}
+	if len(doc.steps) == 0 {
+		return nil, errors.New("no steps")
+	}
+
+	s := &Scenario{Name: doc.top["name"]}
+	wallets := make(map[string]bool)
+	for _, raw := range doc.steps {
+		step, err := parseStep(raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", raw.line, err)
+		}
+		if step.Action == ActionWallet {
+			if wallets[step.Subject] {
+				return nil, fmt.Errorf("line %d: wallet %q is already created", raw.line, step.Subject)
+			}
+			wallets[step.Subject] = true
+		}
+		s.Steps = append(s.Steps, step)
+	}
+	return s, nil
+}
+
+// parseStep checks a step's keys and values against its action
+func parseStep(raw rawStep) (Step, error) {
+	step := Step{Line: raw.line}
+	for key := range raw.fields {
+		if _, ok := stepFields[key]; ok {
+			if step.Action != "" {
+				return step, fmt.Errorf("step has two actions, %s and %s", step.Action, key)
+			}
+			step.Action = key
+		}
+	}
+	if step.Action == "" {
+		return step, fmt.Errorf("step has no action (use one of %s)", strings.Join(actionNames(), ", "))
+	}
+	for key := range raw.fields {
+		if key != step.Action && !slices.Contains(stepFields[step.Action], key) {
+			return step, fmt.Errorf("%s step doesn't take %q", step.Action, key)
+		}
+	}
+
+	step.Subject = raw.fields[step.Action]
+	if step.Subject == "" {
+		return step, fmt.Errorf("%s needs a value", step.Action)
+	}
+
+	var err error
+	switch step.Action {
+	case ActionFund:
+		step.Amount, err = positiveAmount(raw.fields, "amount")
+	case ActionSend:
+		if step.To = raw.fields["to"]; step.To == "" {
+			return step, errors.New("send needs to")
+		}
+		step.Amount, err = positiveAmount(raw.fields, "amount")
+	case ActionMine:
+		step.Count, err = strconv.Atoi(step.Subject)
+		if err == nil && (step.Count < 1 || step.Count > maxMineBlocks) {
+			err = fmt.Errorf("mine must be between 1 and %d blocks, got %d", maxMineBlocks, step.Count)
+		}
+	case ActionBalance:
+		v, ok := raw.fields["equals"]
+		if !ok {
+			return step, errors.New("balance needs equals")
+		}
+		step.Amount, err = strconv.ParseFloat(v, 64)
+	case ActionHeight:
+		step.Count, err = strconv.Atoi(step.Subject)
+	}
+	return step, err
+}
+
+// positiveAmount parses a required amount field
+func positiveAmount(fields map[string]string, key string) (float64, error) {
+	v, ok := fields[key]
+	if !ok {
+		return 0, fmt.Errorf("%s is required", key)
+	}
+	amount, err := strconv.ParseFloat(v, 64)
+	if err != nil || amount <= 0 {
+		return 0, fmt.Errorf("%s must be a positive number, got %q", key, v)
+	}
+	return amount, nil
+}
+
+// actionNames lists the actions in a stable order, for error messages
+func actionNames() []string {
+	return []string{ActionWallet, ActionFund, ActionSend, ActionMine, ActionBalance, ActionHeight}
+}
+
+// String describes a step, e.g. "send alice -> bob 15"
+func (s Step) String() string {
+	switch s.Action {
+	case ActionFund:
+		return fmt.Sprintf("fund %s %s", s.Subject, formatAmount(s.Amount))
+	case ActionSend:
+		return fmt.Sprintf("send %s -> %s %s", s.Subject, s.To, formatAmount(s.Amount))
+	case ActionMine:
+		return fmt.Sprintf("mine %d", s.Count)
+	case ActionBalance:
+		return fmt.Sprintf("balance %s = %s", s.Subject, formatAmount(s.Amount))
+	default:
+		return s.Action + " " + s.Subject
+	}
+}
+
+// formatAmount writes an amount without trailing zeros
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', -1, 64)
+}
@@ -0,0 +1,73 @@
+package scenario
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	data := []byte(`# a comment
+name: "demo # not a comment"
+steps:
+  - wallet: alice   # trailing comment
+  - fund: alice
+    amount: 50
+  -
+    send: alice
+    to: 'bob''s address'
+    amount: 1.5
+  - mine: 2
+  - balance: alice
+    equals: 50
+  - height: 3
+`)
+	s, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "demo # not a comment" {
+		t.Errorf("Name = %q", s.Name)
+	}
+	want := []Step{
+		{Line: 4, Action: ActionWallet, Subject: "alice"},
+		{Line: 5, Action: ActionFund, Subject: "alice", Amount: 50},
+		{Line: 7, Action: ActionSend, Subject: "alice", To: "bob's address", Amount: 1.5},
+		{Line: 11, Action: ActionMine, Subject: "2", Count: 2},
+		{Line: 12, Action: ActionBalance, Subject: "alice", Amount: 50},
+		{Line: 14, Action: ActionHeight, Subject: "3", Count: 3},
+	}
+	if len(s.Steps) != len(want) {
+		t.Fatalf("got %d steps, want %d: %+v", len(s.Steps), len(want), s.Steps)
+	}
+	for i := range want {
+		if s.Steps[i] != want[i] {
+			t.Errorf("step %d = %+v, want %+v", i, s.Steps[i], want[i])
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name, data, want string
+	}{
+		{"no steps", "name: x\n", "no steps"},
+		{"unknown top-level key", "node: x\nsteps:\n  - mine: 1\n", "unknown top-level key"},
+		{"no action", "steps:\n  - amount: 5\n", "line 2: step has no action"},
+		{"two actions", "steps:\n  - mine: 1\n    wallet: a\n", "two actions"},
+		{"extra field", "steps:\n  - mine: 1\n    to: bob\n", `doesn't take "to"`},
+		{"missing amount", "steps:\n  - send: a\n    to: b\n", "amount is required"},
+		{"negative amount", "steps:\n  - fund: a\n    amount: -1\n", "positive number"},
+		{"mine too many", "steps:\n  - mine: 5000\n", "between 1 and"},
+		{"duplicate wallet", "steps:\n  - wallet: a\n  - wallet: a\n", "line 3: wallet \"a\" is already created"},
+		{"duplicate field", "steps:\n  - fund: a\n    fund: b\n", "set twice"},
+		{"tabs", "steps:\n\t- mine: 1\n", "not tabs"},
+		{"flow syntax", "steps:\n  - wallet: [a, b]\n", "unsupported YAML"},
+		{"stray item", "name: x\n  - mine: 1\n", "line 2: unexpected"},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Parse error = %v, want one containing %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package scenario
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The scenario file format is a small subset of YAML, enough for a list of
+// steps without a YAML library:
+//
+//	name: a story        # top-level "key: value" pairs
+//	steps:               # then a list of mappings
+//	  - send: alice
+//	    to: bob
+//	    amount: 15
+//
+// Values are plain, or quoted with "double" (Go escapes) or 'single' quotes.
+// Comments start with # at the start of a line or after a space. Flow
+// syntax ({...}, [...]), anchors and multi-line strings aren't supported.
+
+// document is a parsed scenario file before its steps are checked
+type document struct {
+	top   map[string]string
+	steps []rawStep
+}
+
+// rawStep is one list item under steps
+type rawStep struct {
+	line   int
+	fields map[string]string
+}
+
+// parseYAML parses the subset of YAML scenario files are written in
+func parseYAML(data []byte) (*document, error) {
+	doc := &document{top: make(map[string]string)}
+	inSteps := false
+	dashIndent := -1 // indentation of the current step's "-"
+	for i, raw := range strings.Split(string(data), "\n") {
+		lineNo := i + 1
+		line := stripComment(strings.TrimRight(raw, " \t\r"))
+		text := strings.TrimLeft(line, " ")
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("line %d: indent with spaces, not tabs", lineNo)
+		}
+		indent := len(line) - len(text)
+
+		switch {
+		case indent == 0 && !strings.HasPrefix(text, "-"):
+			key, value, err := parsePair(text)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			if _, ok := doc.top[key]; ok || (key == "steps" && inSteps) {
+				return nil, fmt.Errorf("line %d: %s is set twice", lineNo, key)
+			}
+			inSteps = key == "steps"
+			if inSteps {
+				if value != "" {
+					return nil, fmt.Errorf("line %d: steps must be a list of steps on the lines below", lineNo)
+				}
+				continue
+			}
+			doc.top[key] = value
+
+		case inSteps && (text == "-" || strings.HasPrefix(text, "- ")):
+			dashIndent = indent
+			doc.steps = append(doc.steps, rawStep{line: lineNo, fields: make(map[string]string)})
+			if rest := strings.TrimLeft(strings.TrimPrefix(text, "-"), " "); rest != "" {
+				if err := addField(&doc.steps[len(doc.steps)-1], rest, lineNo); err != nil {
+					return nil, err
+				}
+			}
+
+		case inSteps && len(doc.steps) > 0 && indent > dashIndent:
+			if err := addField(&doc.steps[len(doc.steps)-1], text, lineNo); err != nil {
+				return nil, err
+			}
+
+		default:
+			return nil, fmt.Errorf("line %d: unexpected indentation or list item", lineNo)
+		}
+	}
+	return doc, nil
+}
+
+// addField adds a "key: value" line to a step
+func addField(step *rawStep, text string, lineNo int) error {
+	key, value, err := parsePair(text)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", lineNo, err)
+	}
+	if _, ok := step.fields[key]; ok {
+		return fmt.Errorf("line %d: %s is set twice in this step", lineNo, key)
+	}
+	step.fields[key] = value
+	return nil
+}
+
+// parsePair splits "key: value", unquoting the value
+func parsePair(text string) (string, string, error) {
+	key, value, ok := strings.Cut(text, ":")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" || strings.ContainsAny(key, " \"'") {
+		return "", "", fmt.Errorf("expected key: value, got %q", text)
+	}
+	value, err := unquote(strings.TrimSpace(value))
+	if err != nil {
+		return "", "", err
+	}
+	return key, value, nil
+}
+
+// unquote strips double or single quotes from a value
+func unquote(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		s, err := strconv.Unquote(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid quoted value %s", value)
+		}
+		return s, nil
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", fmt.Errorf("invalid quoted value %s", value)
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	case strings.HasPrefix(value, "[") || strings.HasPrefix(value, "{") ||
+		strings.HasPrefix(value, "&") || strings.HasPrefix(value, "*") ||
+		value == "|" || value == ">":
+		return "", fmt.Errorf("unsupported YAML value %s", value)
+	}
+	return value, nil
+}
+
+// stripComment removes a trailing # comment outside quotes. A quote only
+// opens a string at the start of a value, so "it's" stays plain text.
+func stripComment(line string) string {
+	var quote byte
+	escaped := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		startOfValue := i == 0 || line[i-1] == ' '
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && c == '\\':
+			escaped = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && startOfValue:
+			quote = c
+		case c == '#' && startOfValue:
+			return strings.TrimRight(line[:i], " ")
+		}
+	}
+	return line
+}
@@ -0,0 +1,197 @@
+package term
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// ErrInterrupted is returned by ReadLine when Ctrl-C is pressed
+var ErrInterrupted = errors.New("interrupted")
+
+// maxHistory is how many lines a LineEditor remembers
+const maxHistory = 500
+
+// Control keys handled by ReadLine
+const (
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyBackspace = 8
+	keyTab       = 9
+	keyCtrlU     = 21
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// LineEditor reads lines from a terminal in raw mode, echoing what is typed
+// and supporting backspace, Ctrl-U, history on the arrow keys and Tab
+// completion. Editing always happens at the end of the line.
+type LineEditor struct {
+	Prompt string
+	// Complete returns the possible completions of the whole line, if set
+	Complete func(line string) []string
+
+	in      *bufio.Reader
+	out     io.Writer
+	history []string
+}
+
+// NewLineEditor creates an editor reading keys from in and echoing to out
+func NewLineEditor(in io.Reader, out io.Writer) *LineEditor {
+	return &LineEditor{in: bufio.NewReader(in), out: out}
+}
+
+// History returns the remembered lines, oldest first
+func (e *LineEditor) History() []string {
+	return append([]string(nil), e.history...)
+}
+
+// ReadLine shows the prompt and returns the next line entered. Ctrl-D on an
+// empty line returns io.EOF.
+func (e *LineEditor) ReadLine() (string, error) {
+	var line []rune
+	browsing := len(e.history) // history index shown, len(history) for the line being typed
+	var draft []rune           // the line being typed, kept while browsing history
+	e.redraw(line)
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\n")
+			e.remember(string(line))
+			return string(line), nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\n")
+			return "", ErrInterrupted
+		case keyCtrlD:
+			if len(line) == 0 {
+				fmt.Fprint(e.out, "\n")
+				return "", io.EOF
+			}
+		case keyBackspace, keyDelete:
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+				e.redraw(line)
+			}
+		case keyCtrlU:
+			line = line[:0]
+			e.redraw(line)
+		case keyTab:
+			line = []rune(e.complete(string(line)))
+			e.redraw(line)
+		case keyEscape:
+			switch e.readEscape() {
+			case "[A", "OA": // up
+				if browsing == len(e.history) {
+					draft = line
+				}
+				if browsing > 0 {
+					browsing--
+					line = []rune(e.history[browsing])
+				}
+			case "[B", "OB": // down
+				if browsing < len(e.history) {
+					browsing++
+					line = draft
+					if browsing < len(e.history) {
+						line = []rune(e.history[browsing])
+					}
+				}
+			}
+			e.redraw(line)
+		default:
+			if unicode.IsPrint(r) {
+				line = append(line, r)
+				fmt.Fprint(e.out, string(r))
+			}
+		}
+	}
+}
+
+// redraw clears the current terminal line and writes the prompt and line
+func (e *LineEditor) redraw(line []rune) {
+	fmt.Fprintf(e.out, "\r\x1b[K%s%s", e.Prompt, string(line))
+}
+
+// readEscape reads the rest of an escape sequence, e.g. "[A" for the up arrow
+func (e *LineEditor) readEscape() string {
+	r, _, err := e.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return ""
+	}
+	seq := []rune{r}
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return ""
+		}
+		seq = append(seq, r)
+		// CSI sequences end with a byte from '@' to '~'
+		if r >= '@' && r <= '~' {
+			return string(seq)
+		}
+	}
+}
+
+// complete returns line extended as far as its completions agree, listing
+// them when there is more than one and none can be extended
+func (e *LineEditor) complete(line string) string {
+	if e.Complete == nil {
+		return line
+	}
+	candidates := e.Complete(line)
+	switch len(candidates) {
+	case 0:
+		fmt.Fprint(e.out, "\a")
+		return line
+	case 1:
+		return candidates[0]
+	}
+
+	prefix := commonPrefix(candidates)
+	if len(prefix) > len(line) {
+		return prefix
+	}
+
+	// List just the word being completed, not the whole line each time
+	start := strings.LastIndex(line, " ") + 1
+	words := make([]string, len(candidates))
+	for i, c := range candidates {
+		words[i] = c[min(start, len(c)):]
+	}
+	fmt.Fprintf(e.out, "\n%s\n", strings.Join(words, "  "))
+	return line
+}
+
+// remember adds a line to the history, skipping blanks and repeats
+func (e *LineEditor) remember(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if n := len(e.history); n > 0 && e.history[n-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+}
+
+// commonPrefix returns the longest prefix shared by every string
+func commonPrefix(strs []string) string {
+	prefix := strs[0]
+	for _, s := range strs[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,109 @@
+package term
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// readLines feeds keys to a new editor and returns every line it reads
+func readLines(t *testing.T, e *LineEditor, keys string) []string {
+	t.Helper()
+	e.in.Reset(strings.NewReader(keys))
+	var lines []string
+	for {
+		line, err := e.ReadLine()
+		if errors.Is(err, io.EOF) {
+			return lines
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestReadLineEditing(t *testing.T) {
+	tests := []struct {
+		name string
+		keys string
+		want []string
+	}{
+		{"plain", "status\r", []string{"status"}},
+		{"newline", "status\n", []string{"status"}},
+		{"backspace", "stx\x7fatus\r", []string{"status"}},
+		{"ctrl-u", "garbage\x15peers\r", []string{"peers"}},
+		{"unknown escape ignored", "pe\x1b[Cers\r", []string{"peers"}},
+		{"unicode", "send bob 1 ✓\r", []string{"send bob 1 ✓"}},
+		{"several", "a\rb\r", []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewLineEditor(nil, io.Discard)
+			got := readLines(t, e, tt.keys)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestReadLineHistory(t *testing.T) {
+	e := NewLineEditor(nil, io.Discard)
+	readLines(t, e, "status\rpeers\rpeers\r\r")
+	if got := e.History(); strings.Join(got, "|") != "status|peers" {
+		t.Fatalf("expected blanks and repeats skipped, got %q", got)
+	}
+
+	// Up twice reaches "status", down once comes back to "peers"
+	got := readLines(t, e, "\x1b[A\x1b[A\x1b[B\r")
+	if len(got) != 1 || got[0] != "peers" {
+		t.Errorf("expected peers from history, got %q", got)
+	}
+
+	// Going past the newest entry restores the draft
+	got = readLines(t, e, "mem\x1b[A\x1b[Bpool\r")
+	if len(got) != 1 || got[0] != "mempool" {
+		t.Errorf("expected the draft back, got %q", got)
+	}
+}
+
+func TestReadLineComplete(t *testing.T) {
+	e := NewLineEditor(nil, io.Discard)
+	e.Complete = func(line string) []string {
+		var out []string
+		for _, c := range []string{"mempool", "mine", "mining start", "mining stop"} {
+			if strings.HasPrefix(c, line) {
+				out = append(out, c)
+			}
+		}
+		return out
+	}
+
+	tests := []struct{ keys, want string }{
+		{"mem\t\r", "mempool"},    // one match
+		{"mini\t\r", "mining st"}, // extended to the common prefix
+		{"mining st\ta\t\r", "mining start"},
+		{"x\t\r", "x"}, // no match
+	}
+	for _, tt := range tests {
+		got := readLines(t, e, tt.keys)
+		if len(got) != 1 || got[0] != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.keys, tt.want, got)
+		}
+	}
+}
+
+func TestReadLineInterrupt(t *testing.T) {
+	e := NewLineEditor(strings.NewReader("half\x03"), io.Discard)
+	if _, err := e.ReadLine(); !errors.Is(err, ErrInterrupted) {
+		t.Errorf("expected ErrInterrupted, got %v", err)
+	}
+
+	e = NewLineEditor(strings.NewReader("half\x04\r"), io.Discard)
+	if line, err := e.ReadLine(); err != nil || line != "half" {
+		t.Errorf("Ctrl-D should be ignored mid-line, got %q, %v", line, err)
+	}
+}
@@ -0,0 +1,86 @@
+package term
+
+// Key is a key press read from a raw-mode terminal. Printable characters are
+// their own string; other keys use the names below.
+type Key string
+
+// Named keys
+const (
+	KeyUp        Key = "up"
+	KeyDown      Key = "down"
+	KeyLeft      Key = "left"
+	KeyRight     Key = "right"
+	KeyHome      Key = "home"
+	KeyEnd       Key = "end"
+	KeyPageUp    Key = "pgup"
+	KeyPageDown  Key = "pgdown"
+	KeyEnter     Key = "enter"
+	KeyTab       Key = "tab"
+	KeyBacktab   Key = "shift+tab"
+	KeyEscape    Key = "esc"
+	KeyBackspace Key = "backspace"
+	KeyCtrlC     Key = "ctrl+c"
+)
+
+// escapeKeys maps the escape sequences terminals send for special keys
+var escapeKeys = map[string]Key{
+	"[A": KeyUp, "OA": KeyUp,
+	"[B": KeyDown, "OB": KeyDown,
+	"[C": KeyRight, "OC": KeyRight,
+	"[D": KeyLeft, "OD": KeyLeft,
+	"[H": KeyHome, "OH": KeyHome, "[1~": KeyHome, "[7~": KeyHome,
+	"[F": KeyEnd, "OF": KeyEnd, "[4~": KeyEnd, "[8~": KeyEnd,
+	"[5~": KeyPageUp,
+	"[6~": KeyPageDown,
+	"[Z":  KeyBacktab,
+}
+
+// ParseKeys splits one read of terminal input into key presses. A lone
+// escape byte is the Escape key; unknown escape sequences are dropped.
+func ParseKeys(b []byte) []Key {
+	var keys []Key
+	s := string(b)
+	for len(s) > 0 {
+		switch c := s[0]; {
+		case c == keyEscape:
+			seq, rest := splitEscape(s[1:])
+			s = rest
+			if seq == "" {
+				keys = append(keys, KeyEscape)
+			} else if k, ok := escapeKeys[seq]; ok {
+				keys = append(keys, k)
+			}
+			continue
+		case c == '\r' || c == '\n':
+			keys = append(keys, KeyEnter)
+		case c == keyTab:
+			keys = append(keys, KeyTab)
+		case c == keyBackspace || c == keyDelete:
+			keys = append(keys, KeyBackspace)
+		case c == keyCtrlC:
+			keys = append(keys, KeyCtrlC)
+		case c >= ' ':
+			r := []rune(s)[0]
+			keys = append(keys, Key(string(r)))
+			s = s[len(string(r)):]
+			continue
+		}
+		s = s[1:]
+	}
+	return keys
+}
+
+// splitEscape takes the escape sequence off the front of s (after the escape
+// byte itself), returning "" if s doesn't start one
+func splitEscape(s string) (seq, rest string) {
+	if len(s) < 2 || (s[0] != '[' && s[0] != 'O') {
+		return "", s
+	}
+	for i := 1; i < len(s); i++ {
+		// Sequences end with a byte from '@' to '~'
+		if s[i] >= '@' && s[i] <= '~' {
+			return s[:i+1], s[i+1:]
+		}
+	}
+	return "", ""
+}
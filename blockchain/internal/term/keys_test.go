@@ -0,0 +1,32 @@
+package term
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []Key
+	}{
+		{"q", []Key{"q"}},
+		{"jk", []Key{"j", "k"}},
+		{"\x1b[A\x1b[B", []Key{KeyUp, KeyDown}},
+		{"\x1bOC", []Key{KeyRight}},
+		{"\x1b[5~\x1b[6~", []Key{KeyPageUp, KeyPageDown}},
+		{"\x1b", []Key{KeyEscape}},
+		{"\x1bq", []Key{KeyEscape, "q"}},
+		{"\t\x1b[Z", []Key{KeyTab, KeyBacktab}},
+		{"\r\x7f\x03", []Key{KeyEnter, KeyBackspace, KeyCtrlC}},
+		{"\x1b[99~x", []Key{"x"}}, // unknown sequence dropped
+		{"é", []Key{"é"}},
+		{"\x01", nil}, // other control keys ignored
+	}
+
+	for _, tt := range tests {
+		if got := ParseKeys([]byte(tt.in)); !slices.Equal(got, tt.want) {
+			t.Errorf("ParseKeys(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package term
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ttyPath is the controlling terminal on Unix-like systems
+const ttyPath = "/dev/tty"
+
+// ReadPassphrase shows prompt on the controlling terminal and reads a line
+// typed there without echo. Reading the terminal rather than stdin keeps
+// passphrases out of pipes and the command line, and lets the prompt work
+// while stdin and stdout are redirected. Cancelling ctx (e.g. on Ctrl-C)
+// abandons the prompt.
+func ReadPassphrase(ctx context.Context, prompt string) ([]byte, error) {
+	tty, err := os.OpenFile(ttyPath, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("no terminal to read a passphrase from: %w", err)
+	}
+	defer tty.Close()
+
+	fd := int(tty.Fd())
+	state, err := DisableEcho(fd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to turn off echo: %w", err)
+	}
+	defer Restore(fd, state)
+
+	fmt.Fprint(tty, prompt)
+	defer fmt.Fprintln(tty)
+	return readSecret(ctx, tty)
+}
+
+// readSecret reads one line from r without its line ending, giving up if ctx
+// is cancelled first
+func readSecret(ctx context.Context, r io.Reader) ([]byte, error) {
+	type result struct {
+		line []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		line, err := bufio.NewReader(r).ReadBytes('\n')
+		done <- result{line, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-done:
+		if res.err != nil && (!errors.Is(res.err, io.EOF) || len(res.line) == 0) {
+			return nil, res.err
+		}
+		return bytes.TrimRight(res.line, "\r\n"), nil
+	}
+}
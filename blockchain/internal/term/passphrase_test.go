@@ -0,0 +1,42 @@
+package term
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadSecret(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"hunter2\n", "hunter2"},
+		{"hunter2\r\n", "hunter2"},
+		{"no newline", "no newline"},
+		{"\n", ""},
+	}
+	for _, tt := range tests {
+		got, err := readSecret(context.Background(), strings.NewReader(tt.input))
+		if err != nil || string(got) != tt.want {
+			t.Errorf("%q: expected %q, got %q, %v", tt.input, tt.want, got, err)
+		}
+	}
+
+	if _, err := readSecret(context.Background(), strings.NewReader("")); !errors.Is(err, io.EOF) {
+		t.Errorf("expected EOF with no input, got %v", err)
+	}
+}
+
+func TestReadSecretCancelled(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := readSecret(ctx, r); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the read to be abandoned, got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package term
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// plainProgressInterval is how often a progress bar writing to something
+// other than a terminal prints a line
+const plainProgressInterval = 5 * time.Second
+
+// ProgressBar shows how far a long task has got. On a terminal it redraws one
+// line in place; written anywhere else, such as a log file, it prints a plain
+// line every few seconds instead.
+type ProgressBar struct {
+	out     io.Writer
+	tty     bool
+	width   int
+	start   time.Time
+	printed time.Time // when a plain line was last printed
+	drawn   bool      // a line is on screen awaiting Finish
+}
+
+// NewProgressBar creates a progress bar writing to f, usually os.Stderr
+func NewProgressBar(f *os.File) *ProgressBar {
+	p := &ProgressBar{out: f, tty: IsTerminal(int(f.Fd())), width: 80, start: time.Now()}
+	if width, _, err := Size(int(f.Fd())); err == nil && width > 0 {
+		p.width = width
+	}
+	return p
+}
+
+// Update shows done of total units, such as blocks, with label in front
+func (p *ProgressBar) Update(label string, done, total int64) {
+	line := formatProgress(label, done, total, time.Since(p.start), p.width)
+	if p.tty {
+		fmt.Fprintf(p.out, "\r\x1b[K%s", line)
+		p.drawn = true
+		return
+	}
+	if time.Since(p.printed) >= plainProgressInterval || done >= total {
+		fmt.Fprintln(p.out, line)
+		p.printed = time.Now()
+	}
+}
+
+// Finish ends the progress line so later output starts on a fresh one
+func (p *ProgressBar) Finish() {
+	if p.drawn {
+		fmt.Fprintln(p.out)
+		p.drawn = false
+	}
+}
+
+// formatProgress lays out a progress line to fit width columns:
+// the label, a bar, the counts, the percentage, the rate and time remaining
+func formatProgress(label string, done, total int64, elapsed time.Duration, width int) string {
+	pct := 100.0
+	if total > 0 {
+		pct = float64(done) / float64(total) * 100
+	}
+	stats := fmt.Sprintf(" %d/%d %3.0f%%", done, total, pct)
+	if secs := elapsed.Seconds(); secs >= 1 && done > 0 {
+		rate := float64(done) / secs
+		stats += fmt.Sprintf(" %.0f/s", rate)
+		if done < total {
+			remaining := time.Duration(float64(total-done) / rate * float64(time.Second))
+			stats += " ETA " + remaining.Round(time.Second).String()
+		}
+	}
+
+	barWidth := min(width-len(label)-len(stats)-3, 40)
+	if barWidth < 10 {
+		return label + stats
+	}
+	filled := barWidth
+	if total > 0 {
+		filled = int(int64(barWidth) * min(done, total) / total)
+	}
+	return fmt.Sprintf("%s [%s%s]%s", label, strings.Repeat("#", filled), strings.Repeat("-", barWidth-filled), stats)
+}
@@ -0,0 +1,45 @@
+package term
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatProgress(t *testing.T) {
+	tests := []struct {
+		done, total int64
+		elapsed     time.Duration
+		width       int
+		want        string
+	}{
+		{0, 100, 0, 80, "blocks [----------------------------------------] 0/100   0%"},
+		{50, 200, 10 * time.Second, 80, "blocks [##########------------------------------] 50/200  25% 5/s ETA 30s"},
+		{200, 200, 20 * time.Second, 80, "blocks [########################################] 200/200 100% 10/s"},
+		{5, 10, 0, 30, "blocks [#####------] 5/10  50%"},
+		{5, 10, 0, 20, "blocks 5/10  50%"}, // too narrow for a bar
+		{0, 0, 0, 30, "blocks [############] 0/0 100%"},
+	}
+	for _, tt := range tests {
+		if got := formatProgress("blocks", tt.done, tt.total, tt.elapsed, tt.width); got != tt.want {
+			t.Errorf("formatProgress(%d, %d, %s, %d) = %q, want %q", tt.done, tt.total, tt.elapsed, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestProgressBarPlain(t *testing.T) {
+	var out bytes.Buffer
+	p := &ProgressBar{out: &out, width: 80, start: time.Now()}
+
+	// Off a terminal, lines are printed now and then and always at the end
+	p.Update("blocks", 1, 3)
+	p.Update("blocks", 2, 3)
+	p.Update("blocks", 3, 3)
+	p.Finish()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "1/3") || !strings.Contains(lines[1], "3/3") {
+		t.Errorf("expected the first and last updates, got %q", out.String())
+	}
+}
@@ -0,0 +1,14 @@
+// Package term puts a terminal into raw mode, reads keys, edited lines and
+// passphrases from it and draws progress bars, using only the standard library
+package term
+
+import "errors"
+
+// ErrUnsupported is returned by MakeRaw and DisableEcho on platforms without
+// termios support
+var ErrUnsupported = errors.New("terminal modes are not supported on this platform")
+
+// State is a terminal's settings, saved so they can be restored
+type State struct {
+	termios termios
+}
@@ -0,0 +1,35 @@
+//go:build !linux && !darwin
+
+package term
+
+import "os"
+
+type termios struct{}
+
+// IsTerminal reports whether fd is a terminal, which is never on this platform
+func IsTerminal(fd int) bool {
+	return false
+}
+
+// MakeRaw always fails on this platform
+func MakeRaw(fd int) (*State, error) {
+	return nil, ErrUnsupported
+}
+
+// DisableEcho always fails on this platform
+func DisableEcho(fd int) (*State, error) {
+	return nil, ErrUnsupported
+}
+
+// Restore does nothing on this platform
+func Restore(fd int, s *State) error {
+	return nil
+}
+
+// Size always fails on this platform
+func Size(fd int) (width, height int, err error) {
+	return 0, 0, ErrUnsupported
+}
+
+// NotifyResize does nothing on this platform
+func NotifyResize(c chan<- os.Signal) {}
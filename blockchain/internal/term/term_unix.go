@@ -0,0 +1,92 @@
+//go:build linux || darwin
+
+package term
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+type termios = syscall.Termios
+
+// IsTerminal reports whether fd is a terminal
+func IsTerminal(fd int) bool {
+	_, err := getTermios(fd)
+	return err == nil
+}
+
+// MakeRaw disables line buffering, echo and signal keys on fd, returning the
+// previous settings for Restore. Output processing is left on so "\n" still
+// starts a new line.
+func MakeRaw(fd int) (*State, error) {
+	old, err := getTermios(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := old
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := setTermios(fd, &raw); err != nil {
+		return nil, err
+	}
+	return &State{termios: old}, nil
+}
+
+// DisableEcho stops fd echoing typed characters but otherwise leaves line
+// editing alone, for reading passphrases. It returns the previous settings
+// for Restore.
+func DisableEcho(fd int) (*State, error) {
+	old, err := getTermios(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	quiet := old
+	quiet.Lflag &^= syscall.ECHO
+	quiet.Lflag |= syscall.ICANON | syscall.ISIG
+	if err := setTermios(fd, &quiet); err != nil {
+		return nil, err
+	}
+	return &State{termios: old}, nil
+}
+
+// Restore puts back the settings MakeRaw or DisableEcho saved
+func Restore(fd int, s *State) error {
+	return setTermios(fd, &s.termios)
+}
+
+// Size returns the terminal's width and height in characters
+func Size(fd int) (width, height int, err error) {
+	var ws struct{ rows, cols, xpixel, ypixel uint16 }
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws))); errno != 0 {
+		return 0, 0, errno
+	}
+	return int(ws.cols), int(ws.rows), nil
+}
+
+// NotifyResize sends to c whenever the terminal is resized
+func NotifyResize(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGWINCH)
+}
+
+func getTermios(fd int) (termios, error) {
+	var t termios
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), ioctlGetTermios, uintptr(unsafe.Pointer(&t))); errno != 0 {
+		return t, errno
+	}
+	return t, nil
+}
+
+func setTermios(fd int, t *termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), ioctlSetTermios, uintptr(unsafe.Pointer(t))); errno != 0 {
+		return errno
+	}
+	return nil
+}
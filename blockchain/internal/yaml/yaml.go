@@ -0,0 +1,197 @@
+// Package yaml writes values as YAML, for the CLI's -output yaml. Values are
+// encoded as they would be to JSON, so json struct tags, omitempty and
+// MarshalJSON methods apply, and struct fields keep their order.
+package yaml
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Strings YAML 1.1 or 1.2 readers would turn into numbers or times
+var (
+	numberPattern    = regexp.MustCompile(`^[-+]?(0[xX][0-9a-fA-F_]+|0[oO]?[0-7_]+|[0-9][0-9_]*(\.[0-9_]*)?([eE][-+]?[0-9]+)?|\.[0-9_]+([eE][-+]?[0-9]+)?|[0-9][0-9_]*(:[0-5]?[0-9])+(\.[0-9_]*)?)$`)
+	timestampPattern = regexp.MustCompile(`^[0-9]{4}-[0-9]{1,2}-[0-9]{1,2}`)
+)
+
+// node is a decoded JSON value with object keys kept in order
+type node struct {
+	scalar string   // YAML text of a scalar
+	keys   []string // object keys, when object is set
+	values []*node  // object values or array items
+	object bool
+	array  bool
+}
+
+// Marshal returns the YAML encoding of v
+func Marshal(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	n, err := decode(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	switch {
+	case n.object && len(n.keys) > 0:
+		writeObject(&buf, n, "")
+	case n.array && len(n.values) > 0:
+		writeArray(&buf, n, "")
+	default:
+		buf.WriteString(inline(n) + "\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// Encode writes the YAML encoding of v to w
+func Encode(w io.Writer, v any) error {
+	data, err := Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// decode reads the next JSON value from dec
+func decode(dec *json.Decoder) (*node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		n := &node{object: t == '{', array: t == '['}
+		for dec.More() {
+			if n.object {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				n.keys = append(n.keys, key.(string))
+			}
+			v, err := decode(dec)
+			if err != nil {
+				return nil, err
+			}
+			n.values = append(n.values, v)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case string:
+		return &node{scalar: quote(t)}, nil
+	case json.Number:
+		return &node{scalar: t.String()}, nil
+	case bool:
+		return &node{scalar: fmt.Sprint(t)}, nil
+	case nil:
+		return &node{scalar: "null"}, nil
+	}
+	return nil, fmt.Errorf("unexpected JSON token %v", tok)
+}
+
+// writeObject writes a non-empty object's keys, one per line
+func writeObject(buf *bytes.Buffer, n *node, indent string) {
+	for i, key := range n.keys {
+		buf.WriteString(indent + quote(key) + ":")
+		writeValue(buf, n.values[i], indent)
+	}
+}
+
+// writeArray writes a non-empty array's items, one per line
+func writeArray(buf *bytes.Buffer, n *node, indent string) {
+	for _, item := range n.values {
+		buf.WriteString(indent + "-")
+		switch {
+		case item.object && len(item.keys) > 0:
+			// The first key shares the dash's line
+			var inner bytes.Buffer
+			writeObject(&inner, item, indent+"  ")
+			buf.WriteString(" " + strings.TrimPrefix(inner.String(), indent+"  "))
+		case item.array && len(item.values) > 0:
+			buf.WriteString("\n")
+			writeArray(buf, item, indent+"  ")
+		default:
+			buf.WriteString(" " + inline(item) + "\n")
+		}
+	}
+}
+
+// writeValue writes the value after a key, nested on the following lines
+// when it is a non-empty object or array
+func writeValue(buf *bytes.Buffer, v *node, indent string) {
+	switch {
+	case v.object && len(v.keys) > 0:
+		buf.WriteString("\n")
+		writeObject(buf, v, indent+"  ")
+	case v.array && len(v.values) > 0:
+		buf.WriteString("\n")
+		writeArray(buf, v, indent)
+	default:
+		buf.WriteString(" " + inline(v) + "\n")
+	}
+}
+
+// inline writes a scalar, or an empty object or array
+func inline(n *node) string {
+	switch {
+	case n.object:
+		return "{}"
+	case n.array:
+		return "[]"
+	}
+	return n.scalar
+}
+
+// quote leaves a string plain when YAML would read it back as the same
+// string, and double-quotes it otherwise
+func quote(s string) string {
+	if plain(s) {
+		return s
+	}
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// plain reports whether s can be written unquoted
+func plain(s string) bool {
+	if s == "" || strings.TrimSpace(s) != s {
+		return false
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "y", "n", "null", "~", ".nan", ".inf", "-.inf", "+.inf":
+		return false
+	}
+	if looksNumeric(s) {
+		return false
+	}
+	if strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") {
+		return false
+	}
+	if strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.HasSuffix(s, ":") {
+		return false
+	}
+	for _, r := range s {
+		if r < ' ' || r == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// looksNumeric reports whether a YAML reader might take s as a number or a
+// timestamp rather than a string
+func looksNumeric(s string) bool {
+	return numberPattern.MatchString(s) || timestampPattern.MatchString(s)
+}
@@ -0,0 +1,103 @@
+package yaml
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMarshal(t *testing.T) {
+	type peer struct {
+		Address string `json:"address"`
+		Height  int64  `json:"height"`
+	}
+	v := struct {
+		Name    string            `json:"name"`
+		OK      bool              `json:"ok"`
+		Amount  float64           `json:"amount"`
+		Hash    string            `json:"hash"`
+		Time    time.Time         `json:"time"`
+		Note    string            `json:"note,omitempty"`
+		Peers   []peer            `json:"peers"`
+		Tags    []string          `json:"tags"`
+		Empty   []string          `json:"empty"`
+		Nested  map[string]int    `json:"nested"`
+		Matrix  [][]int           `json:"matrix"`
+		Missing *peer             `json:"missing"`
+		Labels  map[string]string `json:"labels"`
+	}{
+		Name:   "node: one",
+		OK:     true,
+		Amount: 12.5,
+		Hash:   "0042ab",
+		Time:   time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Peers:  []peer{{"localhost:8081", 3}, {"[::1]:8082", 4}},
+		Tags:   []string{"plain", "yes", "", "- dash", "line\nbreak"},
+		Empty:  []string{},
+		Nested: map[string]int{"b": 2, "a": 1},
+		Matrix: [][]int{{1, 2}, {}},
+		Labels: map[string]string{},
+	}
+
+	got, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `name: "node: one"
+ok: true
+amount: 12.5
+hash: 0042ab
+time: "2026-01-02T03:04:05Z"
+peers:
+- address: localhost:8081
+  height: 3
+- address: "[::1]:8082"
+  height: 4
+tags:
+- plain
+- "yes"
+- ""
+- "- dash"
+- "line\nbreak"
+empty: []
+nested:
+  a: 1
+  b: 2
+matrix:
+-
+  - 1
+  - 2
+- []
+missing: null
+labels: {}
+`
+	if string(got) != want {
+		t.Errorf("Marshal =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestMarshalScalars(t *testing.T) {
+	tests := []struct {
+		v    any
+		want string
+	}{
+		{"hello world", "hello world\n"},
+		{"9f2c", "9f2c\n"},
+		{"0042", "\"0042\"\n"},
+		{"1e5", "\"1e5\"\n"},
+		{"12:30", "\"12:30\"\n"},
+		{"a #b", "\"a #b\"\n"},
+		{42, "42\n"},
+		{nil, "null\n"},
+		{[]int{}, "[]\n"},
+		{map[string]int{}, "{}\n"},
+	}
+	for _, tt := range tests {
+		got, err := Marshal(tt.v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("Marshal(%#v) = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
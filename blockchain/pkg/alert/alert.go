@@ -0,0 +1,156 @@
+// Package alert parses and evaluates alert rules such as
+// "balance(ADDRESS) < 10", which a node checks against each new block
+package alert
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+// Functions a rule can compare
+const (
+	FuncBalance  = "balance"  // an address's confirmed balance after the block
+	FuncReceived = "received" // how much an address was paid in the block
+	FuncSent     = "sent"     // how much an address paid out in the block
+	FuncTxs      = "txs"      // how many of the block's transactions touch an address
+	FuncMempool  = "mempool"  // how many transactions are waiting to be mined
+)
+
+// functions maps each function to whether it takes an address
+var functions = map[string]bool{
+	FuncBalance:  true,
+	FuncReceived: true,
+	FuncSent:     true,
+	FuncTxs:      true,
+	FuncMempool:  false,
+}
+
+// operators in the order they are matched, so "<=" is found before "<"
+var operators = []string{"<=", ">=", "==", "!=", "<", ">"}
+
+// Rule compares a function of the chain with a threshold
+type Rule struct {
+	Func      string
+	Address   string // "" for functions without one
+	Op        string
+	Threshold float64
+}
+
+// State is what a rule is evaluated against: a block just added to the
+// chain and the node's state after it
+type State struct {
+	Block   *block.Block
+	Balance func(address string) float64
+	Mempool int
+}
+
+// Parse reads a rule of the form FUNC(ADDRESS) OP NUMBER, e.g.
+// "balance(ab12...) < 10", "sent(ab12...) >= 100" or "mempool() > 50".
+// The parentheses may be left off functions without an address.
+func Parse(expr string) (Rule, error) {
+	var r Rule
+	lhs, rhs, ok := "", "", false
+	for _, op := range operators {
+		if lhs, rhs, ok = strings.Cut(expr, op); ok {
+			r.Op = op
+			break
+		}
+	}
+	if !ok {
+		return r, fmt.Errorf("rule %q has no comparison; use one of %s", expr, strings.Join(operators, " "))
+	}
+
+	threshold, err := strconv.ParseFloat(strings.TrimSpace(rhs), 64)
+	if err != nil {
+		return r, fmt.Errorf("rule %q must compare with a number, not %q", expr, strings.TrimSpace(rhs))
+	}
+	r.Threshold = threshold
+
+	lhs = strings.TrimSpace(lhs)
+	name, arg, hasArgs := strings.Cut(lhs, "(")
+	if hasArgs {
+		var closed bool
+		if arg, closed = strings.CutSuffix(arg, ")"); !closed {
+			return r, fmt.Errorf("rule %q is missing a closing parenthesis", expr)
+		}
+	}
+	r.Func = strings.ToLower(strings.TrimSpace(name))
+	r.Address = strings.TrimSpace(arg)
+
+	needsAddress, known := functions[r.Func]
+	switch {
+	case !known:
+		return r, fmt.Errorf("unknown function %q; use balance, received, sent, txs or mempool", r.Func)
+	case needsAddress && r.Address == "":
+		return r, fmt.Errorf("%s needs an address, e.g. %s(ADDRESS)", r.Func, r.Func)
+	case needsAddress && !wallet.ValidAddress(r.Address):
+		return r, fmt.Errorf("%q is not an address", r.Address)
+	case !needsAddress && r.Address != "":
+		return r, fmt.Errorf("%s takes no address", r.Func)
+	}
+	return r, nil
+}
+
+// String writes the rule back in the form Parse reads
+func (r Rule) String() string {
+	return fmt.Sprintf("%s(%s) %s %s", r.Func, r.Address, r.Op, strconv.FormatFloat(r.Threshold, 'f', -1, 64))
+}
+
+// Level reports whether the rule tests something that persists from block
+// to block, like a balance, rather than what happened in one block. Level
+// rules should fire when they become true, not on every block they stay true.
+func (r Rule) Level() bool {
+	return r.Func == FuncBalance || r.Func == FuncMempool
+}
+
+// Value works out the rule's function for a state
+func (r Rule) Value(s State) float64 {
+	switch r.Func {
+	case FuncBalance:
+		return s.Balance(r.Address)
+	case FuncMempool:
+		return float64(s.Mempool)
+	}
+
+	var value float64
+	for _, tx := range s.Block.Transactions {
+		switch {
+		case r.Func == FuncReceived && tx.To == r.Address:
+			value += tx.Amount
+		case r.Func == FuncSent && tx.From == r.Address:
+			value += tx.Amount
+		case r.Func == FuncTxs && (tx.From == r.Address || tx.To == r.Address):
+			value++
+		}
+	}
+	return value
+}
+
+// Holds reports whether a value satisfies the rule's comparison
+func (r Rule) Holds(value float64) bool {
+	switch r.Op {
+	case "<":
+		return value < r.Threshold
+	case "<=":
+		return value <= r.Threshold
+	case ">":
+		return value > r.Threshold
+	case ">=":
+		return value >= r.Threshold
+	case "==":
+		return value == r.Threshold
+	case "!=":
+		return value != r.Threshold
+	}
+	return false
+}
+
+// Eval works out the rule's value for a state and whether it holds
+func (r Rule) Eval(s State) (value float64, holds bool) {
+	value = r.Value(s)
+	return value, r.Holds(value)
+}
@@ -0,0 +1,91 @@
+package alert
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+)
+
+const (
+	alice = "41d2a52001398c93b7b40a7508254f0fe64dd1f341a2d6642836709235bb9593"
+	bob   = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expr string
+		want Rule
+	}{
+		{"balance(" + alice + ") < 10", Rule{FuncBalance, alice, "<", 10}},
+		{"  Sent( " + alice + " )>=2.5", Rule{FuncSent, alice, ">=", 2.5}},
+		{"txs(" + alice + ") != 0", Rule{FuncTxs, alice, "!=", 0}},
+		{"mempool() > 50", Rule{FuncMempool, "", ">", 50}},
+		{"mempool <= 5", Rule{FuncMempool, "", "<=", 5}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.expr)
+		if err != nil || got != tt.want {
+			t.Errorf("Parse(%q) = %+v, %v, want %+v", tt.expr, got, err, tt.want)
+			continue
+		}
+		// Rules survive being written out and read back
+		if again, err := Parse(got.String()); err != nil || again != got {
+			t.Errorf("Parse(%q) = %+v, %v, want %+v", got.String(), again, err, got)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"balance(" + alice + ")", "no comparison"},
+		{"balance(" + alice + ") < lots", "must compare with a number"},
+		{"balance(" + alice + " < 10", "closing parenthesis"},
+		{"height() > 10", "unknown function"},
+		{"received() > 10", "needs an address"},
+		{"received(alice) > 10", "not an address"},
+		{"mempool(" + alice + ") > 10", "takes no address"},
+	}
+	for _, tt := range tests {
+		if _, err := Parse(tt.expr); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) error = %v, want %q", tt.expr, err, tt.want)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	b := &block.Block{Transactions: []*transaction.Transaction{
+		{To: alice, Amount: 10},
+		{From: alice, To: bob, Amount: 3},
+		{From: alice, To: bob, Amount: 4},
+	}}
+	balances := map[string]float64{alice: 3, bob: 7}
+	s := State{Block: b, Balance: func(address string) float64 { return balances[address] }, Mempool: 12}
+
+	tests := []struct {
+		expr  string
+		value float64
+		holds bool
+	}{
+		{"balance(" + alice + ") < 5", 3, true},
+		{"balance(" + bob + ") < 5", 7, false},
+		{"received(" + bob + ") == 7", 7, true},
+		{"sent(" + alice + ") > 5", 7, true},
+		{"sent(" + bob + ") > 0", 0, false},
+		{"txs(" + alice + ") >= 3", 3, true},
+		{"mempool() > 20", 12, false},
+	}
+	for _, tt := range tests {
+		r, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", tt.expr, err)
+		}
+		if value, holds := r.Eval(s); value != tt.value || holds != tt.holds {
+			t.Errorf("%s: got %v, %v, want %v, %v", tt.expr, value, holds, tt.value, tt.holds)
+		}
+	}
+}
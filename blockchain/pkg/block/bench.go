@@ -0,0 +1,70 @@
+package block
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// benchBatch is how many nonces each Bench worker searches between updates
+const benchBatch = 1 << 14
+
+// BenchResult is the hash rate measured by Bench
+type BenchResult struct {
+	Workers  int     `json:"workers"`
+	Hashes   int64   `json:"hashes"`
+	Blocks   int64   `json:"blocks"`    // proofs of work found along the way
+	Seconds  float64 `json:"seconds"`   // how long the bench ran
+	HashRate float64 `json:"hash_rate"` // hashes per second
+}
+
+// Bench mines a throwaway block at difficulty on workers goroutines for the
+// given duration, or until ctx is cancelled, and reports the combined hash
+// rate. Finding a proof of work doesn't stop a worker; it counts the block
+// and carries on searching.
+func Bench(ctx context.Context, difficulty, workers int, duration time.Duration) BenchResult {
+	workers = max(workers, 1)
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	var hashes, blocks atomic.Int64
+	var wg sync.WaitGroup
+	started := time.Now()
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(start int64) {
+			defer wg.Done()
+			b := New(1, nil, strings.Repeat("0", 64))
+			for nonce := start; ctx.Err() == nil; {
+				found, _ := b.MineRange(ctx, difficulty, nonce, nonce+benchBatch)
+				if found {
+					blocks.Add(1)
+					hashes.Add(b.Nonce - nonce + 1)
+					nonce = b.Nonce + 1
+					continue
+				}
+				hashes.Add(b.Nonce - nonce)
+				nonce = b.Nonce
+			}
+		}(int64(i) * (math.MaxInt64 / int64(workers)))
+	}
+	wg.Wait()
+
+	elapsed := time.Since(started).Seconds()
+	return BenchResult{
+		Workers:  workers,
+		Hashes:   hashes.Load(),
+		Blocks:   blocks.Load(),
+		Seconds:  elapsed,
+		HashRate: float64(hashes.Load()) / elapsed,
+	}
+}
+
+// ExpectedHashes is how many hashes it takes on average to find a block at
+// difficulty, since each leading hex zero is a 1 in 16 chance
+func ExpectedHashes(difficulty int) float64 {
+	return math.Pow(16, float64(difficulty))
+}
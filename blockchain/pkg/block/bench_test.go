@@ -0,0 +1,40 @@
+package block
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBench(t *testing.T) {
+	result := Bench(context.Background(), 1, 2, 50*time.Millisecond)
+	if result.Workers != 2 || result.Hashes == 0 || result.HashRate <= 0 {
+		t.Fatalf("expected hashes from 2 workers, got %+v", result)
+	}
+	// One hash in 16 meets difficulty 1, so thousands of hashes find some blocks
+	if result.Blocks == 0 {
+		t.Errorf("expected blocks to be found at difficulty 1, got %+v", result)
+	}
+	if result.Seconds < 0.05 {
+		t.Errorf("expected the bench to run for its duration, got %vs", result.Seconds)
+	}
+}
+
+func TestBenchCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	Bench(ctx, 1, 1, time.Minute)
+	if time.Since(start) > time.Second {
+		t.Error("expected a cancelled bench to stop straight away")
+	}
+}
+
+func TestExpectedHashes(t *testing.T) {
+	if got := ExpectedHashes(0); got != 1 {
+		t.Errorf("expected 1 hash at difficulty 0, got %v", got)
+	}
+	if got := ExpectedHashes(3); got != 4096 {
+		t.Errorf("expected 4096 hashes at difficulty 3, got %v", got)
+	}
+}
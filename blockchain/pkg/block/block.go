@@ -1,12 +1,19 @@
 package block
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/oksmith/home-server/blockchain/pkg/clock"
 	"github.com/oksmith/home-server/blockchain/pkg/transaction"
 )
 
@@ -20,11 +27,30 @@ type Block struct {
 	Nonce        int64                      `json:"nonce"`
 }
 
+// cancelCheckInterval is how many nonces MineContext tries between context checks
+const cancelCheckInterval = 1024
+
+// Header is the lightweight summary of a block used to compare chains
+// without downloading every transaction
+type Header struct {
+	Index        int64     `json:"index"`
+	Timestamp    time.Time `json:"timestamp"`
+	PreviousHash string    `json:"previous_hash"`
+	Hash         string    `json:"hash"`
+	Nonce        int64     `json:"nonce"`
+	TxCount      int       `json:"tx_count"`
+}
+
 // New creates a new block with the given transactions
 func New(index int64, transactions []*transaction.Transaction, previousHash string) *Block {
+	return NewWithClock(clock.System, index, transactions, previousHash)
+}
+
+// NewWithClock creates a new block with the given transactions, timestamped by clk
+func NewWithClock(clk clock.Clock, index int64, transactions []*transaction.Transaction, previousHash string) *Block {
 	b := &Block{
 		Index:        index,
-		Timestamp:    time.Now(),
+		Timestamp:    clk.Now(),
 		Transactions: transactions,
 		PreviousHash: previousHash,
 		Nonce:        0,
@@ -32,43 +58,156 @@ func New(index int64, transactions []*transaction.Transaction, previousHash stri
 	return b
 }
 
+// recordBuffers holds the buffers blocks are serialised into for hashing.
+// Mining hashes the same block millions of times and validating a chain
+// hashes every block, so they are reused rather than allocated per hash.
+var recordBuffers = sync.Pool{
+	New: func() any { return new([]byte) },
+}
+
 // CalculateHash computes the SHA-256 hash of the block's contents
 func (b *Block) CalculateHash() string {
+	buf := recordBuffers.Get().(*[]byte)
+	defer recordBuffers.Put(buf)
+
 	// Include all transaction IDs in the hash
-	txData := ""
+	record := appendRecordStart((*buf)[:0], b.Index, b.Timestamp)
 	for _, tx := range b.Transactions {
-		txData += tx.ID
+		record = append(record, tx.ID...)
+	}
+	record = appendRecordEnd(record, b.PreviousHash, b.Nonce)
+	*buf = record
+	return hashHex(record)
+}
+
+// hashRecord hashes a block's fields in the order CalculateHash commits to
+// them, given its transaction IDs
+func hashRecord(index int64, timestamp time.Time, txIDs []string, previousHash string, nonce int64) string {
+	buf := recordBuffers.Get().(*[]byte)
+	defer recordBuffers.Put(buf)
+
+	record := appendRecordStart((*buf)[:0], index, timestamp)
+	for _, id := range txIDs {
+		record = append(record, id...)
 	}
+	record = appendRecordEnd(record, previousHash, nonce)
+	*buf = record
+	return hashHex(record)
+}
+
+// appendRecordStart appends the fields a block's record begins with, its
+// index and timestamp, as fmt's %d and RFC3339Nano would write them
+func appendRecordStart(record []byte, index int64, timestamp time.Time) []byte {
+	record = strconv.AppendInt(record, index, 10)
+	return timestamp.AppendFormat(record, time.RFC3339Nano)
+}
+
+// appendRecordEnd appends the fields that follow the transaction IDs
+func appendRecordEnd(record []byte, previousHash string, nonce int64) []byte {
+	record = append(record, previousHash...)
+	return strconv.AppendInt(record, nonce, 10)
+}
 
-	record := fmt.Sprintf("%d%s%s%s%d",
-		b.Index,
-		b.Timestamp.Format(time.RFC3339Nano),
-		txData,
-		b.PreviousHash,
-		b.Nonce,
-	)
-	hash := sha256.Sum256([]byte(record))
-	return hex.EncodeToString(hash[:])
+// hashHex returns the hex-encoded SHA-256 hash of record
+func hashHex(record []byte) string {
+	hash := sha256.Sum256(record)
+	var encoded [2 * sha256.Size]byte
+	hex.Encode(encoded[:], hash[:])
+	return string(encoded[:])
 }
 
 // Mine performs proof-of-work to find a valid hash with the specified difficulty
 // difficulty is the number of leading zeros required in the hash
 func (b *Block) Mine(difficulty int) {
-	target := make([]byte, difficulty)
-	for i := range target {
-		target[i] = '0'
-	}
-	targetStr := string(target)
+	b.MineContext(context.Background(), difficulty)
+}
+
+// MineContext performs proof-of-work like Mine, but gives up and returns the
+// context's error if ctx is cancelled first (e.g. because a peer found the
+// next block)
+func (b *Block) MineContext(ctx context.Context, difficulty int) error {
+	_, err := b.MineRange(ctx, difficulty, b.Nonce, math.MaxInt64)
+	return err
+}
+
+// MineRange searches nonces in [start, end) for a hash meeting the difficulty.
+// It reports whether one was found, leaving b.Nonce and b.Hash set to it.
+// Pool workers use this to search the slice of the nonce space they were given.
+// A Throttle attached with WithThrottle paces the search.
+func (b *Block) MineRange(ctx context.Context, difficulty int, start, end int64) (bool, error) {
+	targetStr := strings.Repeat("0", difficulty)
+	throttle := throttleFrom(ctx)
+	batchStart, batchNonce := time.Now(), start
+
+	for b.Nonce = start; b.Nonce < end; b.Nonce++ {
+		// Checking the context on every hash would slow mining down noticeably
+		if b.Nonce%cancelCheckInterval == 0 {
+			if throttle != nil {
+				if err := throttle.wait(ctx, int(b.Nonce-batchNonce), time.Since(batchStart)); err != nil {
+					return false, err
+				}
+				batchStart, batchNonce = time.Now(), b.Nonce
+			}
+			if err := ctx.Err(); err != nil {
+				return false, err
+			}
+		}
 
-	for {
 		b.Hash = b.CalculateHash()
 		if b.Hash[:difficulty] == targetStr {
-			fmt.Printf("Mined block %d with %d transactions (nonce: %d)\n",
-				b.Index, len(b.Transactions), b.Nonce)
-			return
+			slog.Debug("found proof-of-work",
+				"height", b.Index, "txs", len(b.Transactions), "nonce", b.Nonce)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Header returns the block's header
+func (b *Block) Header() Header {
+	return Header{
+		Index:        b.Index,
+		Timestamp:    b.Timestamp,
+		PreviousHash: b.PreviousHash,
+		Hash:         b.Hash,
+		Nonce:        b.Nonce,
+		TxCount:      len(b.Transactions),
+	}
+}
+
+// TxProof shows that a transaction is part of a block. Block hashes commit to
+// the concatenated transaction IDs rather than a merkle root, so the proof is
+// the block's full ID list: bigger than a merkle branch, but still only IDs,
+// and checkable against the header alone.
+type TxProof struct {
+	TxIDs    []string `json:"tx_ids"`
+	Position int      `json:"position"`
+}
+
+// Proof returns an inclusion proof for the transaction with the given ID
+func (b *Block) Proof(txID string) (*TxProof, bool) {
+	proof := &TxProof{TxIDs: make([]string, len(b.Transactions)), Position: -1}
+	for i, tx := range b.Transactions {
+		proof.TxIDs[i] = tx.ID
+		if tx.ID == txID {
+			proof.Position = i
 		}
-		b.Nonce++
 	}
+	if proof.Position < 0 {
+		return nil, false
+	}
+	return proof, true
+}
+
+// Verify reports whether the proof shows txID is included in the block with header h
+func (p *TxProof) Verify(h Header, txID string) bool {
+	if p.Position < 0 || p.Position >= len(p.TxIDs) || p.TxIDs[p.Position] != txID {
+		return false
+	}
+	if len(p.TxIDs) != h.TxCount {
+		return false
+	}
+	return hashRecord(h.Index, h.Timestamp, p.TxIDs, h.PreviousHash, h.Nonce) == h.Hash
 }
 
 // IsValid checks if the block's hash is correct
@@ -87,3 +226,18 @@ func (b *Block) MarshalJSON() ([]byte, error) {
 		Alias:     (*Alias)(b),
 	})
 }
+
+// UnmarshalJSON decodes a block, refusing null transactions: no block is
+// mined with them, and hashing or proving the block would trip over them
+func (b *Block) UnmarshalJSON(data []byte) error {
+	type Alias Block
+	if err := json.Unmarshal(data, (*Alias)(b)); err != nil {
+		return err
+	}
+	for i, tx := range b.Transactions {
+		if tx == nil {
+			return fmt.Errorf("block %d: transaction %d is null", b.Index, i)
+		}
+	}
+	return nil
+}
@@ -1,18 +1,24 @@
 package block
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/oksmith/home-server/blockchain/pkg/clock"
 	"github.com/oksmith/home-server/blockchain/pkg/transaction"
 )
 
 // createTestTransaction creates a simple test transaction
 func createTestTransaction(from, to string, amount float64) *transaction.Transaction {
-	tx := transaction.New(from, to, amount)
-	// Set a fixed timestamp for deterministic testing
-	tx.Timestamp = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// A fixed timestamp keeps the tests deterministic
+	tx := transaction.NewWithClock(clock.NewManual(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)), from, to, amount)
 	// Generate ID manually for testing
 	tx.ID = tx.Hash()
 	return tx
@@ -40,6 +46,23 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNewWithClock(t *testing.T) {
+	clk := clock.NewManual(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	b1 := NewWithClock(clk, 1, nil, "prev_hash")
+	clk.Advance(time.Second)
+	b2 := NewWithClock(clk, 1, nil, "prev_hash")
+
+	if !b1.Timestamp.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the clock's time, got %v", b1.Timestamp)
+	}
+	if b2.Timestamp.Sub(b1.Timestamp) != time.Second {
+		t.Errorf("expected blocks a second apart, got %v and %v", b1.Timestamp, b2.Timestamp)
+	}
+	if b1.CalculateHash() == b2.CalculateHash() {
+		t.Error("blocks made at different times should hash differently")
+	}
+}
+
 func TestCalculateHash(t *testing.T) {
 	tx := createTestTransaction("genesis", "alice", 100.0)
 	transactions := []*transaction.Transaction{tx}
@@ -68,6 +91,25 @@ func TestCalculateHash(t *testing.T) {
 	}
 }
 
+func TestCalculateHashRecord(t *testing.T) {
+	// The hash commits to the fields written out in this order, which nodes
+	// already on the network rely on staying the same
+	ts := time.Date(2024, 1, 1, 12, 30, 0, 123456789, time.UTC)
+	b := New(-7, []*transaction.Transaction{
+		createTestTransaction("COINBASE", "miner", 10),
+		createTestTransaction("alice", "bob", 2.5),
+	}, "prev_hash")
+	b.Timestamp = ts
+	b.Nonce = math.MaxInt64
+
+	record := fmt.Sprintf("%d%s%s%s%d", b.Index, ts.Format(time.RFC3339Nano),
+		b.Transactions[0].ID+b.Transactions[1].ID, b.PreviousHash, b.Nonce)
+	sum := sha256.Sum256([]byte(record))
+	if got, want := b.CalculateHash(), hex.EncodeToString(sum[:]); got != want {
+		t.Errorf("CalculateHash() = %s, want %s", got, want)
+	}
+}
+
 func TestMine(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -100,6 +142,56 @@ func TestMine(t *testing.T) {
 	}
 }
 
+func TestMineContextCancelled(t *testing.T) {
+	tx := createTestTransaction("alice", "bob", 10.0)
+	b := New(1, []*transaction.Transaction{tx}, "prev")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Difficulty 64 can never be met, so only cancellation can stop mining
+	err := b.MineContext(ctx, 64)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestMineContext(t *testing.T) {
+	tx := createTestTransaction("alice", "bob", 10.0)
+	b := New(1, []*transaction.Transaction{tx}, "prev")
+
+	if err := b.MineContext(context.Background(), 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(b.Hash, "00") || !b.IsValid() {
+		t.Errorf("expected a valid hash with 2 leading zeros, got %s", b.Hash)
+	}
+}
+
+func TestMineRange(t *testing.T) {
+	tx := createTestTransaction("alice", "bob", 10.0)
+	b := New(1, []*transaction.Transaction{tx}, "prev")
+
+	// Find the first valid nonce, then check ranges either side of it
+	if err := b.MineContext(context.Background(), 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	winner := b.Nonce
+
+	found, err := b.MineRange(context.Background(), 2, 0, winner)
+	if err != nil || found {
+		t.Errorf("expected no solution below nonce %d, got found=%v err=%v", winner, found, err)
+	}
+
+	found, err = b.MineRange(context.Background(), 2, winner, winner+1)
+	if err != nil || !found {
+		t.Fatalf("expected solution at nonce %d, got found=%v err=%v", winner, found, err)
+	}
+	if b.Nonce != winner || !b.IsValid() {
+		t.Errorf("expected block left at winning nonce %d, got %d", winner, b.Nonce)
+	}
+}
+
 func TestIsValid(t *testing.T) {
 	tx := createTestTransaction("alice", "bob", 10.0)
 	transactions := []*transaction.Transaction{tx}
@@ -175,6 +267,37 @@ func TestNonceImpactsHash(t *testing.T) {
 	}
 }
 
+func TestHeader(t *testing.T) {
+	tx := createTestTransaction("alice", "bob", 10.0)
+	b := New(3, []*transaction.Transaction{tx}, "prev")
+	b.Mine(1)
+
+	h := b.Header()
+	if h.Index != b.Index || h.Hash != b.Hash || h.PreviousHash != b.PreviousHash {
+		t.Errorf("header does not match block: %+v", h)
+	}
+	if h.Nonce != b.Nonce {
+		t.Errorf("expected nonce %d, got %d", b.Nonce, h.Nonce)
+	}
+	if h.TxCount != 1 {
+		t.Errorf("expected tx count 1, got %d", h.TxCount)
+	}
+}
+
+func BenchmarkCalculateHash(b *testing.B) {
+	transactions := make([]*transaction.Transaction, 100)
+	for i := range transactions {
+		transactions[i] = createTestTransaction("alice", "bob", float64(i))
+	}
+	block := New(10_000, transactions, strings.Repeat("0", 64))
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		block.Nonce = int64(i)
+		block.CalculateHash()
+	}
+}
+
 func BenchmarkMine(b *testing.B) {
 	// Benchmark mining at different difficulties
 	difficulties := []int{1, 2, 3, 4}
@@ -190,3 +313,35 @@ func BenchmarkMine(b *testing.B) {
 		})
 	}
 }
+
+func TestProof(t *testing.T) {
+	txs := []*transaction.Transaction{
+		createTestTransaction("COINBASE", "miner", 50.0),
+		createTestTransaction("alice", "bob", 10.0),
+		createTestTransaction("bob", "carol", 5.0),
+	}
+	b := New(1, txs, "prev_hash")
+	b.Mine(1)
+	h := b.Header()
+
+	proof, ok := b.Proof(txs[1].ID)
+	if !ok {
+		t.Fatal("expected proof for included transaction")
+	}
+	if !proof.Verify(h, txs[1].ID) {
+		t.Error("valid proof failed verification")
+	}
+	if proof.Verify(h, txs[2].ID) {
+		t.Error("proof should not verify a different transaction")
+	}
+
+	if _, ok := b.Proof("missing"); ok {
+		t.Error("expected no proof for a transaction not in the block")
+	}
+
+	// Swapping an ID breaks the link to the header hash
+	forged := &TxProof{TxIDs: []string{txs[0].ID, "forged", txs[2].ID}, Position: 1}
+	if forged.Verify(h, "forged") {
+		t.Error("forged proof should not verify")
+	}
+}
@@ -0,0 +1,51 @@
+package block
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+)
+
+func FuzzBlockJSON(f *testing.F) {
+	b := New(1, []*transaction.Transaction{
+		createTestTransaction("COINBASE", "miner", 10),
+		createTestTransaction("alice", "bob", 2.5),
+	}, "prev_hash")
+	b.Mine(1)
+	data, _ := json.Marshal(b)
+	f.Add(data)
+	f.Add([]byte(`{"index":1,"transactions":[null],"hash":"00"}`))
+	f.Add([]byte(`{"index":-1,"timestamp":"0000-01-01T00:00:00Z","transactions":[{}]}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var b Block
+		if err := json.Unmarshal(data, &b); err != nil {
+			return
+		}
+
+		// What a node does with a block a peer announces must not panic
+		valid := b.IsValid()
+		h := b.Header()
+		for _, tx := range b.Transactions {
+			if proof, ok := b.Proof(tx.ID); !ok {
+				t.Errorf("no proof for transaction %q of %q", tx.ID, data)
+			} else if valid && !proof.Verify(h, tx.ID) {
+				t.Errorf("proof of %q doesn't verify against the header of %q", tx.ID, data)
+			}
+		}
+
+		// Relaying it to another peer gives the same block
+		again, err := json.Marshal(&b)
+		if err != nil {
+			t.Fatalf("accepted %q but can't encode it again: %v", data, err)
+		}
+		var relayed Block
+		if err := json.Unmarshal(again, &relayed); err != nil {
+			t.Fatalf("accepted %q but not its re-encoding %q: %v", data, again, err)
+		}
+		if relayed.CalculateHash() != b.CalculateHash() || relayed.IsValid() != valid {
+			t.Errorf("%q hashes differently once re-encoded as %q", data, again)
+		}
+	})
+}
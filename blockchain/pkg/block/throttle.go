@@ -0,0 +1,108 @@
+package block
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ThrottleConfig limits how hard proof-of-work runs, so a miner on a shared
+// machine leaves CPU for other services
+type ThrottleConfig struct {
+	CPUPercent  int     `json:"cpu_percent"`   // share of one core to use, 1-100
+	MaxHashRate float64 `json:"max_hash_rate"` // hashes per second, 0 for no cap
+}
+
+// Unthrottled mines flat out
+var Unthrottled = ThrottleConfig{CPUPercent: 100}
+
+// Validate checks the limits are in range
+func (c ThrottleConfig) Validate() error {
+	if c.CPUPercent < 1 || c.CPUPercent > 100 {
+		return fmt.Errorf("cpu percent must be between 1 and 100, got %d", c.CPUPercent)
+	}
+	if c.MaxHashRate < 0 {
+		return fmt.Errorf("max hash rate can't be negative, got %g", c.MaxHashRate)
+	}
+	return nil
+}
+
+// Throttle paces proof-of-work by sleeping between batches of hashes. Its
+// limits can be changed while a block is being mined.
+type Throttle struct {
+	cfg ThrottleConfig
+	mu  sync.RWMutex
+}
+
+// NewThrottle creates a throttle with the given limits
+func NewThrottle(cfg ThrottleConfig) (*Throttle, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &Throttle{cfg: cfg}, nil
+}
+
+// Config returns the current limits
+func (t *Throttle) Config() ThrottleConfig {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.cfg
+}
+
+// Set changes the limits, taking effect from the next batch of hashes
+func (t *Throttle) Set(cfg ThrottleConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cfg = cfg
+	return nil
+}
+
+// pause returns how long to rest after spending busy computing hashes
+func (t *Throttle) pause(hashes int, busy time.Duration) time.Duration {
+	cfg := t.Config()
+
+	var rest time.Duration
+	if cfg.CPUPercent < 100 {
+		rest = busy * time.Duration(100-cfg.CPUPercent) / time.Duration(cfg.CPUPercent)
+	}
+	if cfg.MaxHashRate > 0 {
+		minimum := time.Duration(float64(hashes) / cfg.MaxHashRate * float64(time.Second))
+		rest = max(rest, minimum-busy)
+	}
+	return rest
+}
+
+// wait sleeps for the pause owed after a batch, returning early if ctx is cancelled
+func (t *Throttle) wait(ctx context.Context, hashes int, busy time.Duration) error {
+	rest := t.pause(hashes, busy)
+	if rest <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(rest)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type throttleKey struct{}
+
+// WithThrottle returns a context that makes MineContext and MineRange pace
+// themselves with t
+func WithThrottle(ctx context.Context, t *Throttle) context.Context {
+	return context.WithValue(ctx, throttleKey{}, t)
+}
+
+// throttleFrom returns the throttle attached to ctx, if any
+func throttleFrom(ctx context.Context) *Throttle {
+	t, _ := ctx.Value(throttleKey{}).(*Throttle)
+	return t
+}
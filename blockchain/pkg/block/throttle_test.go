@@ -0,0 +1,87 @@
+package block
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+)
+
+func TestThrottlePause(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  ThrottleConfig
+		want time.Duration
+	}{
+		{"unthrottled", Unthrottled, 0},
+		{"half a core", ThrottleConfig{CPUPercent: 50}, 10 * time.Millisecond},
+		{"a quarter of a core", ThrottleConfig{CPUPercent: 25}, 30 * time.Millisecond},
+		// 1000 hashes at 10000/s should take 100ms
+		{"hash rate cap", ThrottleConfig{CPUPercent: 100, MaxHashRate: 10000}, 90 * time.Millisecond},
+		{"stricter limit wins", ThrottleConfig{CPUPercent: 10, MaxHashRate: 10000}, 90 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			th, err := NewThrottle(tt.cfg)
+			if err != nil {
+				t.Fatalf("failed to create throttle: %v", err)
+			}
+			if got := th.pause(1000, 10*time.Millisecond); got != tt.want {
+				t.Errorf("expected pause %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestThrottleConfigValidate(t *testing.T) {
+	for _, cfg := range []ThrottleConfig{{CPUPercent: 0}, {CPUPercent: 101}, {CPUPercent: 50, MaxHashRate: -1}} {
+		if _, err := NewThrottle(cfg); err == nil {
+			t.Errorf("expected %+v to be rejected", cfg)
+		}
+	}
+
+	th, _ := NewThrottle(Unthrottled)
+	if err := th.Set(ThrottleConfig{CPUPercent: 200}); err == nil {
+		t.Error("expected Set to reject an invalid config")
+	}
+	if th.Config() != Unthrottled {
+		t.Errorf("rejected config shouldn't be applied, got %+v", th.Config())
+	}
+}
+
+func TestMineRangeThrottled(t *testing.T) {
+	tx := createTestTransaction("alice", "bob", 10.0)
+	b := New(1, []*transaction.Transaction{tx}, "prev")
+
+	// 4096 hashes at 20000/s take at least 150ms across the three full batches
+	th, _ := NewThrottle(ThrottleConfig{CPUPercent: 100, MaxHashRate: 20000})
+	start := time.Now()
+	if _, err := b.MineRange(WithThrottle(context.Background(), th), 64, 0, 4096); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("expected throttled mining to take at least 150ms, took %v", elapsed)
+	}
+}
+
+func TestMineRangeThrottledCancel(t *testing.T) {
+	tx := createTestTransaction("alice", "bob", 10.0)
+	b := New(1, []*transaction.Transaction{tx}, "prev")
+
+	// One hash a second would sleep for ages after the first batch
+	th, _ := NewThrottle(ThrottleConfig{CPUPercent: 100, MaxHashRate: 1})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := b.MineRange(WithThrottle(ctx, th), 64, 0, 1<<20)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to interrupt the pause, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("cancellation should cut the pause short, took %v", elapsed)
+	}
+}
@@ -0,0 +1,95 @@
+package chain
+
+import (
+	"fmt"
+
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/utxo"
+)
+
+// Accounting is how a chain keeps track of who owns which coins
+type Accounting string
+
+const (
+	// AccountingBalances keeps a balance per address, and a transfer may
+	// spend any part of its sender's balance
+	AccountingBalances Accounting = ""
+	// AccountingUTXO keeps the set of unspent transaction outputs, and a
+	// transfer names the outputs it spends, so ownership of each coin can be
+	// proven and a sender gets change back as an output of its own
+	AccountingUTXO Accounting = "utxo"
+)
+
+// ErrNotUTXO is returned by output queries on a chain keeping balances
+var ErrNotUTXO = fmt.Errorf("chain doesn't use %s accounting", AccountingUTXO)
+
+// SetAccounting switches the chain's accounting model. It can only be done
+// while the chain has nothing but its genesis block.
+func (c *Chain) SetAccounting(a Accounting) error {
+	if a != AccountingBalances && a != AccountingUTXO {
+		return fmt.Errorf("unknown accounting %q", a)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.Blocks) > 1 && a != c.Accounting {
+		return fmt.Errorf("can't change the accounting of a chain with %d blocks", len(c.Blocks))
+	}
+	// Rebuild rather than start empty, to keep any genesis allocations
+	c.Accounting = a
+	return c.rebuildState()
+}
+
+// Unspent returns the outputs address can spend, largest first
+func (c *Chain) Unspent(address string) ([]utxo.Entry, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.utxos == nil {
+		return nil, ErrNotUTXO
+	}
+	return c.utxos.Unspent(address), nil
+}
+
+// SelectInputs picks unspent outputs of address worth at least amount, for
+// a transfer of that amount to spend
+func (c *Chain) SelectInputs(address string, amount float64) ([]transaction.Input, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.utxos == nil {
+		return nil, ErrNotUTXO
+	}
+	return c.utxos.Select(address, amount)
+}
+
+// ledger applies transactions to account state under the chain's accounting,
+// refusing any its sender can't fund. Nothing changes until commit.
+type ledger interface {
+	apply(tx *transaction.Transaction) error
+	commit()
+}
+
+// newLedger returns a ledger over the chain's current state, or over empty
+// state if fresh is set, for replaying the chain from genesis. Callers must
+// hold the lock.
+func (c *Chain) newLedger(fresh bool) ledger {
+	if c.Accounting == AccountingUTXO {
+		set := c.utxos
+		if fresh || set == nil {
+			set = utxo.New()
+		}
+		return utxoLedger{set.View()}
+	}
+	balances := c.balances
+	if fresh {
+		balances = make(map[string]float64)
+	}
+	return newBalanceOverlay(balances)
+}
+
+// utxoLedger is a ledger over a view of the unspent outputs
+type utxoLedger struct {
+	view *utxo.View
+}
+
+func (l utxoLedger) apply(tx *transaction.Transaction) error { return l.view.Apply(tx) }
+func (l utxoLedger) commit()                                 { l.view.Commit() }
@@ -0,0 +1,218 @@
+package chain
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/utxo"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+// newUTXOChain returns a chain using UTXO accounting
+func newUTXOChain(t *testing.T) *Chain {
+	t.Helper()
+	c := New(1, 10.0)
+	if err := c.SetAccounting(AccountingUTXO); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// spendTx returns a transfer from w spending inputs, signed
+func spendTx(t *testing.T, w *wallet.Wallet, to string, amount float64, inputs []transaction.Input) *transaction.Transaction {
+	t.Helper()
+	tx := transaction.New(w.Address(), to, amount)
+	tx.Inputs = inputs
+	if err := tx.Sign(w.PrivateKey); err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestUTXOAccounting(t *testing.T) {
+	c := newUTXOChain(t)
+	alice, _ := wallet.New()
+	fundAddresses(c, alice.Address())
+
+	unspent, err := c.Unspent(alice.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unspent) != 1 || unspent[0].Amount != 10.0 || unspent[0].Index != 0 {
+		t.Fatalf("expected alice to have the 10.0 coinbase output, got %+v", unspent)
+	}
+
+	inputs, err := c.SelectInputs(alice.Address(), 4.0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pay := spendTx(t, alice, "bob", 4.0, inputs)
+	if err := c.AddBlock([]*transaction.Transaction{pay}, "miner"); err != nil {
+		t.Fatalf("expected spend with change to be accepted: %v", err)
+	}
+
+	unspent, _ = c.Unspent(alice.Address())
+	if len(unspent) != 1 || unspent[0].TxID != pay.ID || unspent[0].Index != 1 || unspent[0].Amount != 6.0 {
+		t.Errorf("expected alice to hold only her 6.0 change, got %+v", unspent)
+	}
+	if c.GetBalance(alice.Address()) != 6.0 || c.GetBalance("bob") != 4.0 {
+		t.Errorf("expected balances 6.0 and 4.0, got %f and %f", c.GetBalance(alice.Address()), c.GetBalance("bob"))
+	}
+	if report := c.Check(); report.Fault != nil {
+		t.Errorf("expected chain to pass its check: %v", report.Fault)
+	}
+
+	// A fee comes out of the change
+	change := []transaction.Input{{TxID: pay.ID, Index: 1}}
+	withFee := spendTx(t, alice, "carol", 1.0, change)
+	withFee.Fee = 0.5
+	if err := withFee.Sign(alice.PrivateKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddBlock([]*transaction.Transaction{withFee}, "miner"); err != nil {
+		t.Fatalf("expected spend with a fee to be accepted: %v", err)
+	}
+	unspent, _ = c.Unspent(alice.Address())
+	if len(unspent) != 1 || unspent[0].Amount != 4.5 {
+		t.Errorf("expected alice's change to be 4.5 after the fee, got %+v", unspent)
+	}
+	if miner, _ := c.Unspent("miner"); len(miner) != 2 || miner[0].Amount != 10.5 {
+		t.Errorf("expected the miner's coinbase to claim the fee, got %+v", miner)
+	}
+
+	// The coinbase output was spent, so spending it again is refused
+	again := spendTx(t, alice, "carol", 1.0, inputs)
+	if err := c.AddBlock([]*transaction.Transaction{again}, "miner"); !errors.Is(err, utxo.ErrMissingInput) {
+		t.Errorf("expected a double spend to be rejected, got %v", err)
+	}
+
+	// So is a transfer that doesn't say which outputs it spends
+	bare := spendTx(t, alice, "carol", 1.0, nil)
+	if err := c.AddBlock([]*transaction.Transaction{bare}, "miner"); !errors.Is(err, utxo.ErrNoInputs) {
+		t.Errorf("expected a transfer without inputs to be rejected, got %v", err)
+	}
+
+	// And two transfers in one block spending the same output
+	change = []transaction.Input{{TxID: withFee.ID, Index: 1}}
+	first := spendTx(t, alice, "carol", 1.0, change)
+	second := spendTx(t, alice, "dave", 1.0, change)
+	if err := c.AddBlock([]*transaction.Transaction{first, second}, "miner"); err == nil {
+		t.Error("expected a block spending one output twice to be rejected")
+	}
+	if c.Length() != 4 {
+		t.Errorf("expected rejected blocks to leave the chain at 4 blocks, got %d", c.Length())
+	}
+}
+
+func TestSetAccounting(t *testing.T) {
+	c := New(1, 10.0)
+	if _, err := c.Unspent("alice"); !errors.Is(err, ErrNotUTXO) {
+		t.Errorf("expected ErrNotUTXO from a balance chain, got %v", err)
+	}
+	if err := c.SetAccounting("ledger"); err == nil {
+		t.Error("expected unknown accounting to be rejected")
+	}
+
+	fundAddresses(c, "alice")
+	if err := c.SetAccounting(AccountingUTXO); err == nil {
+		t.Error("expected switching accounting after genesis to be rejected")
+	}
+
+	// Balance chains have no outputs to spend
+	w, _ := wallet.New()
+	fundAddresses(c, w.Address())
+	tx := spendTx(t, w, "bob", 1.0, []transaction.Input{{TxID: c.GetLatestBlock().Transactions[0].ID}})
+	if err := c.AddBlock([]*transaction.Transaction{tx}, "miner"); err == nil {
+		t.Error("expected a balance chain to reject a transfer with inputs")
+	}
+}
+
+func TestUTXOStateSurvivesReload(t *testing.T) {
+	c := newUTXOChain(t)
+	alice, _ := wallet.New()
+	fundAddresses(c, alice.Address(), alice.Address())
+	inputs, _ := c.SelectInputs(alice.Address(), 15.0)
+	if err := c.AddBlock([]*transaction.Transaction{spendTx(t, alice, "bob", 15.0, inputs)}, "miner"); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := c.Unspent(alice.Address())
+
+	path := filepath.Join(t.TempDir(), "chain.json")
+	if err := c.SaveToFile(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Accounting != AccountingUTXO {
+		t.Fatalf("expected accounting %q after reload, got %q", AccountingUTXO, loaded.Accounting)
+	}
+	if got, _ := loaded.Unspent(alice.Address()); len(got) != 1 || got[0] != want[0] {
+		t.Errorf("expected unspent outputs %+v after reload, got %+v", want, got)
+	}
+
+	// Rolling back and reapplying rebuilds the same outputs
+	blocks := c.BlockRange(0, c.Length())
+	if err := c.Truncate(2); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := c.Unspent(alice.Address()); len(got) != 1 || got[0].Amount != 10.0 {
+		t.Errorf("expected alice's first coinbase output only after truncating, got %+v", got)
+	}
+	if err := c.Extend(blocks[2:]); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := c.Unspent(alice.Address()); len(got) != 1 || got[0] != want[0] {
+		t.Errorf("expected unspent outputs %+v after extending, got %+v", want, got)
+	}
+
+	// A replacement chain brings its outputs with it
+	replaced := newUTXOChain(t)
+	if err := replaced.ReplaceWith(loaded); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := replaced.Unspent(alice.Address()); err != nil || len(got) != 1 || got[0] != want[0] {
+		t.Errorf("expected unspent outputs %+v after ReplaceWith, got %+v, %v", want, got, err)
+	}
+}
+
+func TestReplaceWithKeepsAccounting(t *testing.T) {
+	utxoChain := newUTXOChain(t)
+	alice, _ := wallet.New()
+	fundAddresses(utxoChain, alice.Address())
+	inputs, _ := utxoChain.SelectInputs(alice.Address(), 4.0)
+	if err := utxoChain.AddBlock([]*transaction.Transaction{spendTx(t, alice, "bob", 4.0, inputs)}, "miner"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another chain's accounting isn't taken on; its blocks are replayed under ours
+	c := New(1, 10.0)
+	if err := c.ReplaceWith(utxoChain); err != nil {
+		t.Fatal(err)
+	}
+	if c.Accounting != AccountingBalances || c.GetBalance("bob") != 4.0 {
+		t.Errorf("expected balances kept, got accounting %q and bob %.2f", c.Accounting, c.GetBalance("bob"))
+	}
+	if _, err := c.Unspent(alice.Address()); !errors.Is(err, ErrNotUTXO) {
+		t.Errorf("expected no outputs on a balance chain, got %v", err)
+	}
+
+	// Transfers without inputs can't be replayed as UTXO, so nothing changes
+	balances := New(1, 10.0)
+	fundAddresses(balances, alice.Address())
+	tx := transaction.New(alice.Address(), "bob", 4.0)
+	tx.Sign(alice.PrivateKey)
+	if err := balances.AddBlock([]*transaction.Transaction{tx}, "miner"); err != nil {
+		t.Fatal(err)
+	}
+	tip := utxoChain.GetLatestBlock()
+	if err := utxoChain.ReplaceWith(balances); err == nil {
+		t.Error("expected a chain that can't be replayed as UTXO to be refused")
+	}
+	if utxoChain.Accounting != AccountingUTXO || utxoChain.GetLatestBlock() != tip {
+		t.Errorf("expected the UTXO chain left alone, got accounting %q at height %d", utxoChain.Accounting, utxoChain.GetLatestBlock().Index)
+	}
+}
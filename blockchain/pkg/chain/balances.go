@@ -0,0 +1,58 @@
+package chain
+
+import (
+	"fmt"
+
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+)
+
+// balanceOverlay tracks balance changes on top of the chain's balances
+// without copying them, so checking a block's transfers costs as much as the
+// block rather than as much as every account on the chain
+type balanceOverlay struct {
+	base    map[string]float64 // left untouched until commit
+	changes map[string]float64 // address -> balance after the transfers so far
+}
+
+func newBalanceOverlay(base map[string]float64) *balanceOverlay {
+	return &balanceOverlay{base: base, changes: make(map[string]float64)}
+}
+
+// get returns address's balance with the changes applied
+func (o *balanceOverlay) get(address string) float64 {
+	if balance, ok := o.changes[address]; ok {
+		return balance
+	}
+	return o.base[address]
+}
+
+// add changes address's balance by amount
+func (o *balanceOverlay) add(address string, amount float64) {
+	o.changes[address] = o.get(address) + amount
+}
+
+// apply moves a transaction's amount from its sender to its recipient, taking
+// its fee too, or returns an error if the sender can't afford both. A coinbase
+// mints its amount.
+func (o *balanceOverlay) apply(tx *transaction.Transaction) error {
+	if len(tx.Inputs) > 0 {
+		return fmt.Errorf("transaction %s spends outputs, but the chain keeps balances", tx.ID)
+	}
+	if !tx.IsCoinbase() {
+		if balance := o.get(tx.From); balance < tx.Total() {
+			return fmt.Errorf("insufficient balance: address %s has %.2f but tried to send %.2f",
+				tx.From, balance, tx.Total())
+		}
+		o.add(tx.From, -tx.Total())
+	}
+	o.add(tx.To, tx.Amount)
+	return nil
+}
+
+// commit writes the changes into the base balances
+func (o *balanceOverlay) commit() {
+	for address, balance := range o.changes {
+		o.base[address] = balance
+	}
+	clear(o.changes)
+}
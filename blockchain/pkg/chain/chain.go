@@ -1,94 +1,210 @@
 package chain
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/clock"
 	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/utxo"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
 )
 
+// RulesVersion numbers the rules that decide whether a block is valid. Bump
+// it whenever they change, so nodes that disagree about blocks can tell why.
+const RulesVersion = 5
+
 // Chain represents the blockchain with account state
 type Chain struct {
 	Blocks       []*block.Block     `json:"blocks"`
 	Difficulty   int                `json:"difficulty"`
-	MiningReward float64            `json:"mining_reward"`
+	MiningReward float64            `json:"mining_reward"` // reward before Emission tapers it
+	Emission     Emission           `json:"emission,omitzero"`
+	Accounting   Accounting         `json:"accounting,omitempty"`
 	balances     map[string]float64 // Address -> Balance
+	utxos        *utxo.Set          // unspent outputs, with AccountingUTXO only
 	publicKeys   map[string]*ecdsa.PublicKey
+	index        *index                  // lookups by block hash, transaction ID and address
+	side         map[string]*block.Block // blocks on competing branches, by hash
+	orphans      []*block.Block          // blocks whose parent hasn't arrived, oldest first
+	clock        clock.Clock             // timestamps new blocks; nil means the system clock
+	mu           sync.RWMutex            // guards blocks and state against concurrent mining, syncing and API reads
 }
 
+// ErrStaleTip is returned when a block was mined on top of a tip that has since been replaced
+var ErrStaleTip = errors.New("chain tip changed while mining")
+
 // New creates a new blockchain with a genesis block
 func New(difficulty int, miningReward float64) *Chain {
-	c := &Chain{
+	return NewWithClock(difficulty, miningReward, clock.System)
+}
+
+// NewWithClock creates a new blockchain whose genesis block and the blocks it
+// builds later are timestamped by clk
+func NewWithClock(difficulty int, miningReward float64, clk clock.Clock) *Chain {
+	c := NewWithGenesis(difficulty, miningReward, clk.Now())
+	c.clock = clk
+	return c
+}
+
+// NewWithGenesis creates a new blockchain whose genesis block has the given
+// timestamp. Chains created with the same parameters have identical genesis
+// blocks, so separately started nodes share their history from the start.
+func NewWithGenesis(difficulty int, miningReward float64, genesisTime time.Time) *Chain {
+	c := newChain(difficulty, miningReward)
+	c.createGenesisBlock(genesisTime, []*transaction.Transaction{})
+	return c
+}
+
+// newChain creates a chain with no blocks yet
+func newChain(difficulty int, miningReward float64) *Chain {
+	return &Chain{
 		Blocks:       make([]*block.Block, 0),
 		Difficulty:   difficulty,
 		MiningReward: miningReward,
 		balances:     make(map[string]float64),
 		publicKeys:   make(map[string]*ecdsa.PublicKey),
+		index:        newIndex(1, 0),
 	}
-	c.createGenesisBlock()
-	return c
 }
 
-// createGenesisBlock creates the first block in the chain
-func (c *Chain) createGenesisBlock() {
-	genesis := block.New(0, []*transaction.Transaction{}, "0")
+// createGenesisBlock creates the first block in the chain, holding any
+// premine allocations
+func (c *Chain) createGenesisBlock(timestamp time.Time, allocations []*transaction.Transaction) {
+	genesis := block.New(0, allocations, "0")
+	genesis.Timestamp = timestamp
 	genesis.Mine(c.Difficulty)
 	c.Blocks = append(c.Blocks, genesis)
+	c.index.add(0, genesis)
+}
+
+// SetClock replaces the clock timestamping the blocks the chain builds
+func (c *Chain) SetClock(clk clock.Clock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clock = clk
 }
 
 // RegisterPublicKey associates a public key with an address
 // This is needed for signature verification
 func (c *Chain) RegisterPublicKey(address string, publicKey *ecdsa.PublicKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.publicKeys[address] = publicKey
 }
 
 // GetBalance returns the balance for an address
 func (c *Chain) GetBalance(address string) float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.balances[address]
 }
 
 // AddBlock mines a new block with the given transactions
 func (c *Chain) AddBlock(transactions []*transaction.Transaction, minerAddress string) error {
+	return c.AddBlockContext(context.Background(), transactions, minerAddress)
+}
+
+// AddBlockContext is like AddBlock but abandons mining if ctx is cancelled,
+// leaving the chain unchanged
+func (c *Chain) AddBlockContext(ctx context.Context, transactions []*transaction.Transaction, minerAddress string) error {
+	newBlock, err := c.NewBlockTemplate(transactions, minerAddress)
+	if err != nil {
+		return err
+	}
+
+	// Mine without holding the lock so the chain stays readable meanwhile
+	if err := newBlock.MineContext(ctx, c.Difficulty); err != nil {
+		return err
+	}
+
+	return c.AddMinedBlock(newBlock)
+}
+
+// NewBlockTemplate validates the transactions and builds an unmined block on
+// top of the current tip, with a coinbase paying the reward scheduled for its
+// height and the transactions' fees to minerAddress.
+// The template can be mined locally or handed out to pool workers.
+func (c *Chain) NewBlockTemplate(transactions []*transaction.Transaction, minerAddress string) (*block.Block, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	// Validate all transactions
 	if err := c.validateTransactions(transactions); err != nil {
-		return fmt.Errorf("transaction validation failed: %w", err)
+		return nil, fmt.Errorf("transaction validation failed: %w", err)
 	}
 
-	// Add coinbase transaction (mining reward)
-	coinbase := transaction.New("COINBASE", minerAddress, c.MiningReward)
+	// Add coinbase transaction (mining reward plus fees)
+	prevBlock := c.Blocks[len(c.Blocks)-1]
+	clk := clock.OrSystem(c.clock)
+	reward := c.rewardAt(prevBlock.Index+1) + totalFees(transactions)
+	coinbase := transaction.NewWithClock(clk, "COINBASE", minerAddress, reward)
 	coinbase.ID = coinbase.Hash()
-	allTransactions := append([]*transaction.Transaction{coinbase}, transactions...)
+	allTransactions := make([]*transaction.Transaction, 0, len(transactions)+1)
+	allTransactions = append(append(allTransactions, coinbase), transactions...)
 
-	prevBlock := c.Blocks[len(c.Blocks)-1]
-	newBlock := block.New(
+	return block.NewWithClock(
+		clk,
 		prevBlock.Index+1,
 		allTransactions,
 		prevBlock.Hash,
-	)
-	newBlock.Mine(c.Difficulty)
+	), nil
+}
 
+// AddMinedBlock appends a block built by NewBlockTemplate once its proof-of-work
+// has been found. The block is revalidated against the current state, and
+// ErrStaleTip is returned if the tip moved since the template was made.
+func (c *Chain) AddMinedBlock(newBlock *block.Block) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prevBlock := c.Blocks[len(c.Blocks)-1]
+	if newBlock.PreviousHash != prevBlock.Hash {
+		return ErrStaleTip
+	}
+
+	if len(newBlock.Transactions) == 0 || !newBlock.Transactions[0].IsCoinbase() {
+		return fmt.Errorf("block validation failed: first transaction must be the coinbase")
+	}
+	transactions := newBlock.Transactions[1:]
+	if allowed := c.rewardAt(prevBlock.Index+1) + totalFees(transactions); newBlock.Transactions[0].Amount > allowed {
+		return fmt.Errorf("block validation failed: coinbase pays %.2f, more than the %.2f reward and fees",
+			newBlock.Transactions[0].Amount, allowed)
+	}
+
+	if err := c.validateTransactions(transactions); err != nil {
+		return fmt.Errorf("transaction validation failed: %w", err)
+	}
 	if err := c.validateNewBlock(newBlock, prevBlock); err != nil {
 		return fmt.Errorf("block validation failed: %w", err)
 	}
 
-	c.Blocks = append(c.Blocks, newBlock)
-
 	// Apply transactions to update balances
-	c.applyTransactions(allTransactions)
+	if err := c.applyTransactions(newBlock.Transactions); err != nil {
+		return fmt.Errorf("transaction validation failed: %w", err)
+	}
+
+	c.Blocks = append(c.Blocks, newBlock)
+	c.index.add(len(c.Blocks)-1, newBlock)
+	c.pruneSide()
 
 	return nil
 }
 
-// validateTransactions checks if all transactions are valid
+// validateTransactions checks if all transactions are valid.
+// Callers must hold the lock.
 func (c *Chain) validateTransactions(transactions []*transaction.Transaction) error {
-	// Create a copy of current balances to simulate transaction application
-	tempBalances := make(map[string]float64)
-	for addr, balance := range c.balances {
-		tempBalances[addr] = balance
-	}
+	// Simulate applying the transactions on top of current state
+	state := c.newLedger(false)
 
 	for _, tx := range transactions {
 		// Basic validation
@@ -96,42 +212,71 @@ func (c *Chain) validateTransactions(transactions []*transaction.Transaction) er
 			return err
 		}
 
-		// Skip signature check for coinbase
+		// Only the block's own coinbase may mint coins
 		if tx.IsCoinbase() {
-			continue
+			return fmt.Errorf("transaction %s: coinbase transactions cannot be submitted", tx.ID)
 		}
 
 		// Verify signature
-		pubKey, exists := c.publicKeys[tx.From]
-		if !exists {
-			return fmt.Errorf("public key not registered for address %s", tx.From)
+		pubKey, err := c.signerKey(tx)
+		if err != nil {
+			return err
 		}
 
 		if !tx.Verify(pubKey) {
 			return fmt.Errorf("invalid signature for transaction %s", tx.ID)
 		}
 
-		// Check balance against simulated state (prevents double-spending in same block)
-		if tempBalances[tx.From] < tx.Amount {
-			return fmt.Errorf("insufficient balance: address %s has %.2f but tried to send %.2f",
-				tx.From, tempBalances[tx.From], tx.Amount)
+		// Check funds against simulated state (prevents double-spending in same block)
+		if err := state.apply(tx); err != nil {
+			return err
 		}
-
-		// Update simulated balances
-		tempBalances[tx.From] -= tx.Amount
-		tempBalances[tx.To] += tx.Amount
 	}
 	return nil
 }
 
-// applyTransactions updates account balances
-func (c *Chain) applyTransactions(transactions []*transaction.Transaction) {
+// signerKey returns the key to check a transaction's signature against: the
+// one registered for its sender, or else the one it carries, provided that
+// key hashes to the sender's address. Callers must hold the lock.
+func (c *Chain) signerKey(tx *transaction.Transaction) (*ecdsa.PublicKey, error) {
+	if pubKey, exists := c.publicKeys[tx.From]; exists {
+		return pubKey, nil
+	}
+	if len(tx.PublicKey) == 0 {
+		return nil, fmt.Errorf("public key not registered for address %s", tx.From)
+	}
+
+	pubKey, err := tx.SignerKey()
+	if err != nil {
+		return nil, fmt.Errorf("transaction %s: %w", tx.ID, err)
+	}
+	if wallet.PublicKeyToAddress(pubKey) != tx.From {
+		return nil, fmt.Errorf("transaction %s: public key doesn't match address %s", tx.ID, tx.From)
+	}
+	return pubKey, nil
+}
+
+// applyTransactions updates account balances and, with AccountingUTXO, the
+// unspent outputs, or changes nothing if a transaction can't be applied to
+// them. Callers must hold the write lock.
+func (c *Chain) applyTransactions(transactions []*transaction.Transaction) error {
+	if c.utxos != nil {
+		view := c.utxos.View()
+		for _, tx := range transactions {
+			if err := view.Apply(tx); err != nil {
+				return err
+			}
+		}
+		view.Commit()
+	}
+
 	for _, tx := range transactions {
 		if !tx.IsCoinbase() {
-			c.balances[tx.From] -= tx.Amount
+			c.balances[tx.From] -= tx.Total()
 		}
 		c.balances[tx.To] += tx.Amount
 	}
+	return nil
 }
 
 // validateNewBlock checks if a new block is valid
@@ -144,53 +289,100 @@ func (c *Chain) validateNewBlock(newBlock, prevBlock *block.Block) error {
 		return fmt.Errorf("invalid previous hash")
 	}
 
+	return c.validateProofOfWork(newBlock)
+}
+
+// validateProofOfWork checks a block's hash matches its contents and meets
+// the chain's difficulty, which needs nothing but the block itself
+func (c *Chain) validateProofOfWork(newBlock *block.Block) error {
+	if c.Difficulty < 0 || c.Difficulty > len(newBlock.Hash) {
+		return fmt.Errorf("invalid difficulty %d", c.Difficulty)
+	}
+
 	if !newBlock.IsValid() {
 		return fmt.Errorf("invalid hash")
 	}
 
 	// Verify proof-of-work
-	target := ""
 	for i := 0; i < c.Difficulty; i++ {
-		target += "0"
-	}
-	if newBlock.Hash[:c.Difficulty] != target {
-		return fmt.Errorf("insufficient proof-of-work")
+		if newBlock.Hash[i] != '0' {
+			return fmt.Errorf("insufficient proof-of-work")
+		}
 	}
 
 	return nil
 }
 
-// IsValid validates the entire blockchain
-func (c *Chain) IsValid() bool {
-	// Rebuild state from scratch
-	tempBalances := make(map[string]float64)
-
-	for i := 1; i < len(c.Blocks); i++ {
-		currentBlock := c.Blocks[i]
-		prevBlock := c.Blocks[i-1]
-
-		// Validate block structure
-		if err := c.validateNewBlock(currentBlock, prevBlock); err != nil {
-			fmt.Printf("Chain validation failed at block %d: %v\n", i, err)
-			return false
-		}
-
-		// Validate and apply transactions
-		for _, tx := range currentBlock.Transactions {
-			if !tx.IsCoinbase() {
-				if tempBalances[tx.From] < tx.Amount {
-					fmt.Printf("Invalid transaction in block %d: insufficient balance\n", i)
-					return false
-				}
-				tempBalances[tx.From] -= tx.Amount
+// validateBlockTransactions checks the shape of a block's transactions without
+// needing account state: exactly one coinbase, first, paying at most the reward
+// scheduled for the block's height plus its fees, and well-formed transfers
+// whose IDs match their contents
+func (c *Chain) validateBlockTransactions(b *block.Block) error {
+	if len(b.Transactions) == 0 || b.Transactions[0] == nil || !b.Transactions[0].IsCoinbase() {
+		return fmt.Errorf("first transaction must be the coinbase")
+	}
+
+	for i, tx := range b.Transactions {
+		if tx == nil {
+			return fmt.Errorf("missing transaction %d", i)
+		}
+		if tx.ID != tx.Hash() {
+			return fmt.Errorf("transaction %d: ID does not match contents", i)
+		}
+		if i == 0 {
+			// Once the reward has run out, a block without fees mints nothing
+			allowed := c.rewardAt(b.Index) + totalFees(b.Transactions[1:])
+			if tx.To == "" || !(tx.Amount > 0 || tx.Amount == 0 && allowed == 0) || tx.Amount > allowed {
+				return fmt.Errorf("coinbase pays %.2f, allowed reward and fees are %.2f", tx.Amount, allowed)
+			}
+			if tx.Fee != 0 {
+				return fmt.Errorf("coinbase pays a fee")
 			}
-			tempBalances[tx.To] += tx.Amount
+			continue
+		}
+		if tx.IsCoinbase() {
+			return fmt.Errorf("transaction %d: only one coinbase allowed", i)
+		}
+		if err := tx.IsValid(); err != nil {
+			return fmt.Errorf("transaction %d: %w", i, err)
 		}
 	}
+	return nil
+}
 
+// totalFees returns the fees transactions pay, which the coinbase of the block
+// confirming them may claim on top of the reward
+func totalFees(transactions []*transaction.Transaction) float64 {
+	fees := 0.0
+	for _, tx := range transactions {
+		if tx != nil {
+			fees += tx.Fee
+		}
+	}
+	return fees
+}
+
+// IsValid validates the entire blockchain, signatures included
+func (c *Chain) IsValid() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if report := c.check(); report.Fault != nil {
+		slog.Warn("chain validation failed", "height", report.Fault.Height, "err", report.Fault)
+		return false
+	}
 	return true
 }
 
+// MarshalJSON encodes the chain under the read lock
+func (c *Chain) MarshalJSON() ([]byte, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	type Alias Chain
+	return json.Marshal((*Alias)(c))
+}
+
 // SaveToFile persists the blockchain to a JSON file
 func (c *Chain) SaveToFile(filename string) error {
 	data, err := json.MarshalIndent(c, "", "  ")
@@ -220,34 +412,111 @@ func LoadFromFile(filename string) (*Chain, error) {
 	return &c, nil
 }
 
+// ReplaceWith adopts the blocks and state of another chain (e.g. a longer
+// chain from a peer) in place, so existing references to c see the new history.
+// Registered public keys, the clock and the accounting model are kept. If other
+// keeps accounts differently, its blocks are replayed under c's accounting,
+// and c is left as it was if they can't be.
+func (c *Chain) ReplaceWith(other *Chain) error {
+	other.mu.RLock()
+	accounting := other.Accounting
+	blocks := make([]*block.Block, len(other.Blocks))
+	copy(blocks, other.Blocks)
+	balances := make(map[string]float64, len(other.balances))
+	for addr, balance := range other.balances {
+		balances[addr] = balance
+	}
+	var utxos *utxo.Set
+	if other.utxos != nil {
+		utxos = other.utxos.Clone()
+	}
+	emission := Emission{HalvingInterval: other.Emission.HalvingInterval, Curve: slices.Clone(other.Emission.Curve)}
+	other.mu.RUnlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if accounting != c.Accounting {
+		replay := &Chain{Blocks: blocks, Accounting: c.Accounting}
+		if err := replay.rebuildState(); err != nil {
+			return fmt.Errorf("can't replay the chain under this chain's accounting: %w", err)
+		}
+		balances, utxos = replay.balances, replay.utxos
+	}
+	c.Blocks = blocks
+	c.Difficulty = other.Difficulty
+	c.MiningReward = other.MiningReward
+	c.Emission = emission
+	c.balances = balances
+	c.utxos = utxos
+	c.side = nil
+	c.reindex()
+	c.pruneOrphans()
+	return nil
+}
+
 // GetLatestBlock returns the most recent block
 func (c *Chain) GetLatestBlock() *block.Block {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.Blocks[len(c.Blocks)-1]
 }
 
+// Headers returns the headers of all blocks from the given index onwards
+func (c *Chain) Headers(from int) []block.Header {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if from < 0 {
+		from = 0
+	}
+	if from >= len(c.Blocks) {
+		return []block.Header{}
+	}
+
+	headers := make([]block.Header, 0, len(c.Blocks)-from)
+	for _, b := range c.Blocks[from:] {
+		headers = append(headers, b.Header())
+	}
+	return headers
+}
+
 // Length returns the number of blocks in the chain
 func (c *Chain) Length() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return len(c.Blocks)
 }
 
 // RebuildState reconstructs balances and public keys from the blockchain
 // This is needed when loading a chain from JSON or syncing from peers
 func (c *Chain) RebuildState() error {
-	// Initialize maps if they're nil
-	if c.balances == nil {
-		c.balances = make(map[string]float64)
-	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rebuildState()
+}
+
+// rebuildState is RebuildState for callers holding the write lock
+func (c *Chain) rebuildState() error {
+	// Start balances afresh, sized for as many accounts as before
+	c.balances = make(map[string]float64, len(c.balances))
 	if c.publicKeys == nil {
 		c.publicKeys = make(map[string]*ecdsa.PublicKey)
 	}
+	switch c.Accounting {
+	case AccountingBalances:
+		c.utxos = nil
+	case AccountingUTXO:
+		c.utxos = utxo.New()
+	default:
+		return fmt.Errorf("unknown accounting %q", c.Accounting)
+	}
+
+	c.reindex()
 
 	// Replay all transactions from all blocks to rebuild state
-	for _, block := range c.Blocks {
-		for _, tx := range block.Transactions {
-			if !tx.IsCoinbase() {
-				c.balances[tx.From] -= tx.Amount
-			}
-			c.balances[tx.To] += tx.Amount
+	for _, b := range c.Blocks {
+		if err := c.applyTransactions(b.Transactions); err != nil {
+			return fmt.Errorf("block %d: %w", b.Index, err)
 		}
 	}
 
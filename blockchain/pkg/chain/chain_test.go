@@ -1,15 +1,21 @@
 package chain
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/clock"
 	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
 )
 
 // createTestTransaction creates a simple test transaction
@@ -56,6 +62,60 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNewWithGenesis(t *testing.T) {
+	genesisTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := NewWithGenesis(1, 10.0, genesisTime)
+	b := NewWithGenesis(1, 10.0, genesisTime)
+
+	if a.Blocks[0].Hash != b.Blocks[0].Hash {
+		t.Errorf("chains with the same genesis time should share a genesis block")
+	}
+	if !a.Blocks[0].Timestamp.Equal(genesisTime) {
+		t.Errorf("expected genesis timestamp %s, got %s", genesisTime, a.Blocks[0].Timestamp)
+	}
+	if c := NewWithGenesis(2, 10.0, genesisTime); c.Blocks[0].Hash == a.Blocks[0].Hash {
+		t.Errorf("a different difficulty should give a different genesis block")
+	}
+}
+
+func TestNewWithClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	build := func() *Chain {
+		clk := clock.NewManual(start)
+		c := NewWithClock(1, 10.0, clk)
+		for range 3 {
+			clk.Advance(time.Minute)
+			if err := c.AddBlock(nil, "miner"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return c
+	}
+
+	// With time under the test's control, the same blocks come out every run
+	a, b := build(), build()
+	if a.GetLatestBlock().Hash != b.GetLatestBlock().Hash {
+		t.Error("chains built at the same clock times should be identical")
+	}
+	if got, want := a.GetLatestBlock().Timestamp, start.Add(3*time.Minute); !got.Equal(want) {
+		t.Errorf("expected the tip stamped %s, got %s", want, got)
+	}
+	if coinbase := a.GetLatestBlock().Transactions[0]; !coinbase.Timestamp.Equal(start.Add(3 * time.Minute)) {
+		t.Errorf("expected the coinbase stamped by the clock, got %s", coinbase.Timestamp)
+	}
+
+	// The clock stays with the chain when it adopts another's history
+	later := clock.NewManual(start.Add(time.Hour))
+	a.SetClock(later)
+	a.ReplaceWith(New(1, 10.0))
+	if err := a.AddBlock(nil, "miner"); err != nil {
+		t.Fatal(err)
+	}
+	if !a.GetLatestBlock().Timestamp.Equal(later.Now()) {
+		t.Errorf("expected the block stamped %s after ReplaceWith, got %s", later.Now(), a.GetLatestBlock().Timestamp)
+	}
+}
+
 func TestAddBlock(t *testing.T) {
 	c := New(2, 10.0)
 
@@ -91,6 +151,96 @@ func TestAddBlock(t *testing.T) {
 	}
 }
 
+func TestAddBlockWithCarriedPublicKey(t *testing.T) {
+	c := New(1, 10.0)
+	w, _ := wallet.New()
+	fundAddresses(c, w.Address())
+
+	// The sender's key was never registered, but the transaction carries it
+	tx := transaction.New(w.Address(), "bob", 5.0)
+	tx.Sign(w.PrivateKey)
+	if err := c.AddBlock([]*transaction.Transaction{tx}, "miner"); err != nil {
+		t.Fatalf("expected carried key to be accepted: %v", err)
+	}
+
+	// A key that doesn't hash to the sender's address proves nothing
+	fundAddresses(c, "alice")
+	forged := transaction.New("alice", "bob", 5.0)
+	forged.Sign(w.PrivateKey)
+	if err := c.AddBlock([]*transaction.Transaction{forged}, "miner"); err == nil {
+		t.Error("expected a key for another address to be rejected")
+	}
+}
+
+func TestTransactionFees(t *testing.T) {
+	c := New(1, 10.0)
+	w, _ := wallet.New()
+	fundAddresses(c, w.Address())
+
+	tx := transaction.New(w.Address(), "bob", 4.0)
+	tx.Fee = 1.0
+	tx.Sign(w.PrivateKey)
+	if err := c.AddBlock([]*transaction.Transaction{tx}, "miner"); err != nil {
+		t.Fatalf("failed to add block: %v", err)
+	}
+	if coinbase := c.GetLatestBlock().Transactions[0]; coinbase.Amount != 11.0 {
+		t.Errorf("expected the coinbase to pay the reward plus the fee, 11.0, got %f", coinbase.Amount)
+	}
+	if got := c.GetBalance(w.Address()); got != 5.0 {
+		t.Errorf("expected the sender to pay the amount and fee, leaving 5.0, got %f", got)
+	}
+	if c.GetBalance("bob") != 4.0 || c.GetBalance("miner") != 11.0 {
+		t.Errorf("expected bob 4.0 and miner 11.0, got %f and %f", c.GetBalance("bob"), c.GetBalance("miner"))
+	}
+
+	// The fee counts towards what the sender must afford
+	over := transaction.New(w.Address(), "bob", 5.0)
+	over.Fee = 0.5
+	over.Sign(w.PrivateKey)
+	if err := c.AddBlock([]*transaction.Transaction{over}, "miner"); err == nil {
+		t.Error("expected a transfer the sender can't afford with its fee to be rejected")
+	}
+
+	// A coinbase can't claim more than the reward and the block's fees
+	paid := transaction.New(w.Address(), "bob", 1.0)
+	paid.Fee = 0.5
+	paid.Sign(w.PrivateKey)
+	b, err := c.NewBlockTemplate([]*transaction.Transaction{paid}, "miner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Transactions[0].Amount += 0.5
+	b.Transactions[0].ID = b.Transactions[0].Hash()
+	b.Mine(c.Difficulty)
+	if err := c.AddMinedBlock(b); err == nil {
+		t.Error("expected a coinbase claiming more than the fees to be rejected")
+	}
+
+	// Nor can it pass the check once on the chain
+	c.Blocks = append(c.Blocks, b)
+	if report := c.Check(); report.Fault == nil || report.Fault.Height != 3 {
+		t.Errorf("expected the check to fault the overpaying block at height 3, got %+v", report.Fault)
+	}
+}
+
+func TestAddBlockContextCancelled(t *testing.T) {
+	c := New(2, 10.0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := c.AddBlockContext(ctx, []*transaction.Transaction{}, "miner")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if c.Length() != 1 {
+		t.Errorf("cancelled mining should not add a block, got length %d", c.Length())
+	}
+	if c.GetBalance("miner") != 0 {
+		t.Errorf("cancelled mining should not pay a reward")
+	}
+}
+
 func TestAddMultipleBlocks(t *testing.T) {
 	c := New(2, 10.0)
 
@@ -128,13 +278,15 @@ func TestAddMultipleBlocks(t *testing.T) {
 func TestIsValid(t *testing.T) {
 	c := New(2, 10.0)
 
-	fundAddresses(c, "alice", "bob")
-
-	tx1, pk1 := createTestTransaction("alice", "bob", 5.0)
-	tx2, pk2 := createTestTransaction("bob", "charlie", 3.0)
+	// Real wallets, whose transfers carry keys a reloaded chain can check
+	alice, _ := wallet.New()
+	bob, _ := wallet.New()
+	fundAddresses(c, alice.Address(), bob.Address())
 
-	c.RegisterPublicKey(tx1.From, pk1)
-	c.RegisterPublicKey(tx2.From, pk2)
+	tx1 := transaction.New(alice.Address(), bob.Address(), 5.0)
+	tx1.Sign(alice.PrivateKey)
+	tx2 := transaction.New(bob.Address(), "charlie", 3.0)
+	tx2.Sign(bob.PrivateKey)
 
 	c.AddBlock([]*transaction.Transaction{tx1}, "miner")
 	c.AddBlock([]*transaction.Transaction{tx2}, "miner")
@@ -147,13 +299,15 @@ func TestIsValid(t *testing.T) {
 func TestIsValidDetectsTampering(t *testing.T) {
 	c := New(2, 10.0)
 
-	fundAddresses(c, "alice", "bob")
+	// Real wallets, whose transfers carry keys a reloaded chain can check
+	alice, _ := wallet.New()
+	bob, _ := wallet.New()
+	fundAddresses(c, alice.Address(), bob.Address())
 
-	tx1, pk1 := createTestTransaction("alice", "bob", 5.0)
-	tx2, pk2 := createTestTransaction("bob", "charlie", 3.0)
-
-	c.RegisterPublicKey(tx1.From, pk1)
-	c.RegisterPublicKey(tx2.From, pk2)
+	tx1 := transaction.New(alice.Address(), bob.Address(), 5.0)
+	tx1.Sign(alice.PrivateKey)
+	tx2 := transaction.New(bob.Address(), "charlie", 3.0)
+	tx2.Sign(bob.PrivateKey)
 
 	c.AddBlock([]*transaction.Transaction{tx1}, "miner")
 	c.AddBlock([]*transaction.Transaction{tx2}, "miner")
@@ -169,13 +323,15 @@ func TestIsValidDetectsTampering(t *testing.T) {
 func TestIsValidDetectsHashTampering(t *testing.T) {
 	c := New(2, 10.0)
 
-	fundAddresses(c, "alice", "bob")
+	// Real wallets, whose transfers carry keys a reloaded chain can check
+	alice, _ := wallet.New()
+	bob, _ := wallet.New()
+	fundAddresses(c, alice.Address(), bob.Address())
 
-	tx1, pk1 := createTestTransaction("alice", "bob", 5.0)
-	tx2, pk2 := createTestTransaction("bob", "charlie", 3.0)
-
-	c.RegisterPublicKey(tx1.From, pk1)
-	c.RegisterPublicKey(tx2.From, pk2)
+	tx1 := transaction.New(alice.Address(), bob.Address(), 5.0)
+	tx1.Sign(alice.PrivateKey)
+	tx2 := transaction.New(bob.Address(), "charlie", 3.0)
+	tx2.Sign(bob.PrivateKey)
 
 	c.AddBlock([]*transaction.Transaction{tx1}, "miner")
 	c.AddBlock([]*transaction.Transaction{tx2}, "miner")
@@ -191,13 +347,15 @@ func TestIsValidDetectsHashTampering(t *testing.T) {
 func TestIsValidDetectsBrokenLinks(t *testing.T) {
 	c := New(2, 10.0)
 
-	fundAddresses(c, "alice", "bob")
-
-	tx1, pk1 := createTestTransaction("alice", "bob", 5.0)
-	tx2, pk2 := createTestTransaction("bob", "charlie", 3.0)
+	// Real wallets, whose transfers carry keys a reloaded chain can check
+	alice, _ := wallet.New()
+	bob, _ := wallet.New()
+	fundAddresses(c, alice.Address(), bob.Address())
 
-	c.RegisterPublicKey(tx1.From, pk1)
-	c.RegisterPublicKey(tx2.From, pk2)
+	tx1 := transaction.New(alice.Address(), bob.Address(), 5.0)
+	tx1.Sign(alice.PrivateKey)
+	tx2 := transaction.New(bob.Address(), "charlie", 3.0)
+	tx2.Sign(bob.PrivateKey)
 
 	c.AddBlock([]*transaction.Transaction{tx1}, "miner")
 	c.AddBlock([]*transaction.Transaction{tx2}, "miner")
@@ -281,13 +439,15 @@ func TestSaveAndLoadFromFile(t *testing.T) {
 	// Create a test chain
 	c := New(2, 10.0)
 
-	fundAddresses(c, "alice", "bob")
-
-	tx1, pk1 := createTestTransaction("alice", "bob", 5.0)
-	tx2, pk2 := createTestTransaction("bob", "charlie", 3.0)
+	// Real wallets, whose transfers carry keys a reloaded chain can check
+	alice, _ := wallet.New()
+	bob, _ := wallet.New()
+	fundAddresses(c, alice.Address(), bob.Address())
 
-	c.RegisterPublicKey(tx1.From, pk1)
-	c.RegisterPublicKey(tx2.From, pk2)
+	tx1 := transaction.New(alice.Address(), bob.Address(), 5.0)
+	tx1.Sign(alice.PrivateKey)
+	tx2 := transaction.New(bob.Address(), "charlie", 3.0)
+	tx2.Sign(bob.PrivateKey)
 
 	c.AddBlock([]*transaction.Transaction{tx1}, "miner")
 	c.AddBlock([]*transaction.Transaction{tx2}, "miner")
@@ -338,13 +498,15 @@ func TestSaveAndLoadFromFile(t *testing.T) {
 func TestGetLatestBlock(t *testing.T) {
 	c := New(2, 10.0)
 
-	fundAddresses(c, "alice", "bob")
+	// Real wallets, whose transfers carry keys a reloaded chain can check
+	alice, _ := wallet.New()
+	bob, _ := wallet.New()
+	fundAddresses(c, alice.Address(), bob.Address())
 
-	tx1, pk1 := createTestTransaction("alice", "bob", 5.0)
-	tx2, pk2 := createTestTransaction("bob", "charlie", 3.0)
-
-	c.RegisterPublicKey(tx1.From, pk1)
-	c.RegisterPublicKey(tx2.From, pk2)
+	tx1 := transaction.New(alice.Address(), bob.Address(), 5.0)
+	tx1.Sign(alice.PrivateKey)
+	tx2 := transaction.New(bob.Address(), "charlie", 3.0)
+	tx2.Sign(bob.PrivateKey)
 
 	c.AddBlock([]*transaction.Transaction{tx1}, "miner")
 	c.AddBlock([]*transaction.Transaction{tx2}, "miner")
@@ -374,6 +536,58 @@ func TestLength(t *testing.T) {
 	}
 }
 
+func TestHeaders(t *testing.T) {
+	c := New(1, 10.0)
+	fundAddresses(c, "alice", "bob")
+
+	headers := c.Headers(0)
+	if len(headers) != 3 {
+		t.Fatalf("expected 3 headers, got %d", len(headers))
+	}
+	for i, h := range headers {
+		if h.Hash != c.Blocks[i].Hash {
+			t.Errorf("header %d hash mismatch", i)
+		}
+	}
+
+	if got := len(c.Headers(2)); got != 1 {
+		t.Errorf("expected 1 header from index 2, got %d", got)
+	}
+	if got := len(c.Headers(10)); got != 0 {
+		t.Errorf("expected no headers past the tip, got %d", got)
+	}
+}
+
+func TestReplaceWith(t *testing.T) {
+	c := New(1, 10.0)
+	_, pk := createTestTransaction("alice", "bob", 1.0)
+	c.RegisterPublicKey("alice", pk)
+
+	longer := New(1, 10.0)
+	fundAddresses(longer, "bob", "bob")
+
+	c.ReplaceWith(longer)
+
+	if c.Length() != longer.Length() {
+		t.Errorf("expected length %d, got %d", longer.Length(), c.Length())
+	}
+	if c.GetLatestBlock().Hash != longer.GetLatestBlock().Hash {
+		t.Errorf("expected tip to match replacement chain")
+	}
+	if c.GetBalance("bob") != 20.0 {
+		t.Errorf("expected bob balance 20.0, got %f", c.GetBalance("bob"))
+	}
+	if c.publicKeys["alice"] != pk {
+		t.Errorf("registered public keys should survive replacement")
+	}
+
+	// Mutating the replacement afterwards must not affect c
+	fundAddresses(longer, "bob")
+	if c.Length() == longer.Length() {
+		t.Errorf("replaced chain should not share the block slice")
+	}
+}
+
 func TestChainIntegrity(t *testing.T) {
 	// This test verifies that you can't easily tamper with the chain
 	c := New(3, 10.0) // Higher difficulty for this test
@@ -403,3 +617,227 @@ func TestChainIntegrity(t *testing.T) {
 		t.Errorf("chain should detect tampering even with recalculated hash")
 	}
 }
+
+func TestProveTransactions(t *testing.T) {
+	c := New(1, 10.0)
+	fundAddresses(c, "alice", "bob")
+
+	proven := c.ProveTransactions("alice", 0)
+	if len(proven) != 1 {
+		t.Fatalf("expected 1 transaction for alice, got %d", len(proven))
+	}
+	p := proven[0]
+	if p.Height != 1 || p.Tx.To != "alice" {
+		t.Errorf("unexpected transaction %+v at height %d", p.Tx, p.Height)
+	}
+	if !p.Proof.Verify(c.Blocks[p.Height].Header(), p.Tx.ID) {
+		t.Error("proof should verify against the block header")
+	}
+
+	if got := c.ProveTransactions("alice", 2); len(got) != 0 {
+		t.Errorf("expected nothing for alice from height 2, got %d", len(got))
+	}
+	if got := c.ProveTransactions("alice", 100); len(got) != 0 {
+		t.Errorf("expected nothing beyond the tip, got %d", len(got))
+	}
+}
+
+func TestIndexedLookups(t *testing.T) {
+	c := New(1, 10.0)
+	fundAddresses(c, "alice", "bob", "alice")
+
+	tip := c.GetLatestBlock()
+	if b, ok := c.BlockByHash(tip.Hash); !ok || b != tip {
+		t.Errorf("expected to find the tip by hash")
+	}
+	if _, ok := c.BlockByHash("missing"); ok {
+		t.Errorf("unknown hash should not be found")
+	}
+	if b, ok := c.BlockByHeight(2); !ok || b.Index != 2 {
+		t.Errorf("expected block 2 by height")
+	}
+	if _, ok := c.BlockByHeight(4); ok {
+		t.Errorf("height beyond the tip should not be found")
+	}
+
+	recent := c.RecentBlocks(2)
+	if len(recent) != 2 || recent[0] != tip || recent[1].Index != 2 {
+		t.Errorf("expected the 2 newest blocks, newest first")
+	}
+	if got := c.RecentBlocks(100); len(got) != 4 {
+		t.Errorf("expected every block when limit exceeds length, got %d", len(got))
+	}
+
+	coinbase := tip.Transactions[0]
+	confirmed, ok := c.Transaction(coinbase.ID)
+	if !ok || confirmed.Height != 3 || confirmed.BlockHash != tip.Hash {
+		t.Errorf("unexpected lookup for coinbase: %+v, %v", confirmed, ok)
+	}
+
+	history := c.AddressHistory("alice", 10)
+	if len(history) != 2 || history[0].Height != 3 || history[1].Height != 1 {
+		t.Errorf("expected alice's 2 transactions newest first, got %+v", history)
+	}
+	if got := c.AddressHistory("alice", 1); len(got) != 1 || got[0].Height != 3 {
+		t.Errorf("limit should keep the newest transaction")
+	}
+}
+
+func TestGetTransaction(t *testing.T) {
+	c := New(1, 10.0)
+	fundAddresses(c, "alice")
+	coinbase := c.GetLatestBlock().Transactions[0]
+
+	tx, confirmations, ok := c.GetTransaction(coinbase.ID)
+	if !ok || tx.ID != coinbase.ID || confirmations != 1 {
+		t.Fatalf("expected the coinbase with 1 confirmation, got %v, %d, %v", tx, confirmations, ok)
+	}
+	fundAddresses(c, "bob", "carol")
+	if _, confirmations, _ := c.GetTransaction(coinbase.ID); confirmations != 3 {
+		t.Errorf("expected 3 confirmations after 2 more blocks, got %d", confirmations)
+	}
+	if _, _, ok := c.GetTransaction("missing"); ok {
+		t.Error("unknown transaction should not be found")
+	}
+
+	// A loaded chain is indexed as it is read
+	s := openStore(t, filepath.Join(t.TempDir(), "chain.db"))
+	if err := c.SaveTo(s); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, confirmations, ok := loaded.GetTransaction(coinbase.ID); !ok || confirmations != 3 {
+		t.Errorf("expected the loaded chain to find the coinbase with 3 confirmations, got %d, %v", confirmations, ok)
+	}
+
+	// and a truncated one forgets what it dropped
+	if err := c.Truncate(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := c.GetTransaction(coinbase.ID); ok {
+		t.Error("expected a transaction in a dropped block to be gone")
+	}
+}
+
+func TestIndexFollowsReplaceWith(t *testing.T) {
+	c := New(1, 10.0)
+	fundAddresses(c, "alice")
+	oldTip := c.GetLatestBlock()
+
+	other := New(1, 10.0)
+	fundAddresses(other, "bob", "bob")
+	c.ReplaceWith(other)
+
+	if _, ok := c.BlockByHash(oldTip.Hash); ok {
+		t.Errorf("replaced blocks should no longer be found")
+	}
+	if got := c.AddressHistory("alice", 10); len(got) != 0 {
+		t.Errorf("alice's replaced history should be gone, got %d", len(got))
+	}
+	if got := c.AddressHistory("bob", 10); len(got) != 2 {
+		t.Errorf("expected bob's 2 transactions, got %d", len(got))
+	}
+}
+
+func TestRebuildStateTwice(t *testing.T) {
+	c := New(1, 10.0)
+	fundAddresses(c, "alice", "alice")
+	for range 2 {
+		if err := c.RebuildState(); err != nil {
+			t.Fatal(err)
+		}
+		if got := c.GetBalance("alice"); got != 20.0 {
+			t.Fatalf("expected alice to have 20.00 after rebuilding, got %.2f", got)
+		}
+	}
+}
+
+// benchmarkChainLength is the chain size the benchmarks below measure against
+const benchmarkChainLength = 10_000
+
+// buildLargeChain builds a chain of length blocks without proof-of-work, each
+// paying its reward to a different miner so the balance map grows with the
+// chain, and the last paying funded instead
+func buildLargeChain(tb testing.TB, length int, funded string) *Chain {
+	tb.Helper()
+	clk := clock.NewManual(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	c := NewWithClock(0, 10.0, clk)
+	for i := 1; i < length; i++ {
+		miner := fmt.Sprintf("miner-%d", i)
+		if i == length-1 {
+			miner = funded
+		}
+		clk.Advance(time.Minute)
+		b, err := c.NewBlockTemplate(nil, miner)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		b.Hash = b.CalculateHash()
+		c.Blocks = append(c.Blocks, b)
+	}
+	if err := c.RebuildState(); err != nil {
+		tb.Fatal(err)
+	}
+	return c
+}
+
+func BenchmarkValidateTransactions(b *testing.B) {
+	w, _ := wallet.New()
+	c := buildLargeChain(b, benchmarkChainLength, w.Address())
+	c.RegisterPublicKey(w.Address(), w.PublicKey)
+	txs := make([]*transaction.Transaction, 5)
+	for i := range txs {
+		txs[i] = transaction.New(w.Address(), fmt.Sprintf("payee-%d", i), 1.0)
+		txs[i].Sign(w.PrivateKey)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := c.validateTransactions(txs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRebuildState(b *testing.B) {
+	c := buildLargeChain(b, benchmarkChainLength, "miner")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.RebuildState()
+	}
+}
+
+func BenchmarkIsValid(b *testing.B) {
+	c := buildLargeChain(b, benchmarkChainLength, "miner")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !c.IsValid() {
+			b.Fatal("chain should be valid")
+		}
+	}
+}
+
+func BenchmarkAddMinedBlock(b *testing.B) {
+	c := buildLargeChain(b, benchmarkChainLength, "miner")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		next, err := c.NewBlockTemplate(nil, "miner")
+		if err != nil {
+			b.Fatal(err)
+		}
+		next.Hash = next.CalculateHash()
+		if err := c.AddMinedBlock(next); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package chain
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+)
+
+// Fault describes the first invalid block in a chain
+type Fault struct {
+	Height int    `json:"height"`
+	Hash   string `json:"hash,omitempty"`
+	TxID   string `json:"txid,omitempty"` // the offending transaction, if one is to blame
+	Reason string `json:"reason"`
+}
+
+func (f *Fault) Error() string {
+	if f.TxID != "" {
+		return fmt.Sprintf("block %d: transaction %s: %s", f.Height, f.TxID, f.Reason)
+	}
+	return fmt.Sprintf("block %d: %s", f.Height, f.Reason)
+}
+
+// CheckReport is the result of a full chain check
+type CheckReport struct {
+	Blocks   int    `json:"blocks"`
+	Fault    *Fault `json:"fault,omitempty"` // nil when every block is valid
+	Verified int    `json:"verified"`        // transfers whose signature was checked
+}
+
+// Check validates every block and transaction as IsValid does, including each
+// transfer's signature against the sender's key: registered, or carried by the
+// transaction. It stops at the first fault.
+func (c *Chain) Check() CheckReport {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.check()
+}
+
+// check walks the chain from genesis, replaying balances, and reports the
+// first invalid block. Callers must hold the lock.
+func (c *Chain) check() CheckReport {
+	report := CheckReport{Blocks: len(c.Blocks)}
+	if len(c.Blocks) == 0 {
+		report.Fault = &Fault{Reason: "chain has no blocks"}
+		return report
+	}
+	genesis := c.Blocks[0]
+	if err := validateGenesis(genesis); err != nil {
+		report.Fault = &Fault{Reason: err.Error()}
+		return report
+	}
+
+	state := c.newLedger(true)
+	if fault := c.checkTransfers(0, genesis, state, &report); fault != nil {
+		report.Fault = fault
+		return report
+	}
+	for i := 1; i < len(c.Blocks); i++ {
+		current := c.Blocks[i]
+		if current == nil {
+			report.Fault = &Fault{Height: i, Reason: "missing block"}
+			return report
+		}
+
+		// Transactions first, hashing assumes they're well-formed
+		if err := c.validateBlockTransactions(current); err != nil {
+			report.Fault = &Fault{Height: i, Hash: current.Hash, Reason: err.Error()}
+			return report
+		}
+		if err := c.validateNewBlock(current, c.Blocks[i-1]); err != nil {
+			report.Fault = &Fault{Height: i, Hash: current.Hash, Reason: err.Error()}
+			return report
+		}
+
+		if fault := c.checkTransfers(i, current, state, &report); fault != nil {
+			report.Fault = fault
+			return report
+		}
+	}
+	return report
+}
+
+// checkTransfers applies a block's transactions to state, checking each
+// transfer is signed by its sender and that they could afford it. A transfer
+// whose sender's key is neither registered nor carried can't be checked, so
+// it is refused.
+func (c *Chain) checkTransfers(height int, b *block.Block, state ledger, report *CheckReport) *Fault {
+	for _, tx := range b.Transactions {
+		if tx.IsCoinbase() {
+			if err := state.apply(tx); err != nil {
+				return &Fault{Height: height, Hash: b.Hash, TxID: tx.ID, Reason: err.Error()}
+			}
+			continue
+		}
+
+		key, err := c.signerKey(tx)
+		if err == nil && !tx.Verify(key) {
+			err = fmt.Errorf("invalid signature")
+		}
+		if err != nil {
+			return &Fault{Height: height, Hash: b.Hash, TxID: tx.ID, Reason: err.Error()}
+		}
+		report.Verified++
+
+		if err := state.apply(tx); err != nil {
+			return &Fault{Height: height, Hash: b.Hash, TxID: tx.ID, Reason: err.Error()}
+		}
+	}
+	return nil
+}
+
+// Truncate drops every block from height onwards and rebuilds account state,
+// for cutting a corrupt chain back to its last valid block. Genesis can't be
+// removed.
+func (c *Chain) Truncate(height int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if height < 1 || height > len(c.Blocks) {
+		return fmt.Errorf("can't truncate a %d-block chain at height %d", len(c.Blocks), height)
+	}
+	// Rebuilt under the same lock, so nobody sees the shorter chain with the
+	// old state, or no state at all
+	c.Blocks = slices.Clip(c.Blocks[:height])
+	c.side = nil
+	c.orphans = nil
+	return c.rebuildState()
+}
+
+// Extend appends blocks that continue the chain from its tip, such as a batch
+// downloaded from a peer, checking each one as Check does. Blocks before the
+// first invalid one are kept, and the fault is returned.
+func (c *Chain) Extend(blocks []*block.Block) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	defer c.pruneSide()
+	for _, b := range blocks {
+		if err := c.extend(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extend appends one block that continues the chain from its tip, returning
+// a *Fault if it doesn't. Callers must hold the write lock.
+func (c *Chain) extend(b *block.Block) error {
+	height := len(c.Blocks)
+	if b == nil {
+		return &Fault{Height: height, Reason: "missing block"}
+	}
+	if err := c.validateBlockTransactions(b); err != nil {
+		return &Fault{Height: height, Hash: b.Hash, Reason: err.Error()}
+	}
+	if err := c.validateNewBlock(b, c.Blocks[height-1]); err != nil {
+		return &Fault{Height: height, Hash: b.Hash, Reason: err.Error()}
+	}
+
+	// Check the transfers in a ledger so a bad one leaves state untouched
+	var report CheckReport
+	if fault := c.checkTransfers(height, b, c.newLedger(false), &report); fault != nil {
+		return fault
+	}
+	if err := c.applyTransactions(b.Transactions); err != nil {
+		return &Fault{Height: height, Hash: b.Hash, Reason: err.Error()}
+	}
+	c.Blocks = append(c.Blocks, b)
+	c.index.add(height, b)
+	return nil
+}
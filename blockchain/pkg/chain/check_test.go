@@ -0,0 +1,154 @@
+package chain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+// reloaded copies a chain's blocks into a fresh chain with no registered keys,
+// as if read back from disk
+func reloaded(t *testing.T, c *Chain) *Chain {
+	t.Helper()
+	fresh := &Chain{Blocks: c.Blocks, Difficulty: c.Difficulty, MiningReward: c.MiningReward}
+	if err := fresh.RebuildState(); err != nil {
+		t.Fatal(err)
+	}
+	return fresh
+}
+
+func TestCheck(t *testing.T) {
+	c := New(1, 10.0)
+	w, _ := wallet.New()
+	fundAddresses(c, w.Address(), "alice")
+
+	carried := transaction.New(w.Address(), "bob", 4.0)
+	carried.Sign(w.PrivateKey)
+	if err := c.AddBlock([]*transaction.Transaction{carried}, "miner"); err != nil {
+		t.Fatalf("failed to add block: %v", err)
+	}
+
+	report := reloaded(t, c).Check()
+	if report.Fault != nil || report.Blocks != 4 || report.Verified != 1 {
+		t.Fatalf("expected a valid 4-block chain with 1 verified transfer, got %+v", report)
+	}
+
+	// Signatures aren't covered by block hashes, so only checking them notices this
+	carried.Signature[0] ^= 0xff
+	tampered := reloaded(t, c)
+	if tampered.IsValid() {
+		t.Error("expected a tampered signature to make the chain invalid")
+	}
+	fault := tampered.Check().Fault
+	if fault == nil || fault.Height != 3 || fault.TxID != carried.ID {
+		t.Errorf("expected a signature fault on block 3, got %+v", fault)
+	}
+}
+
+func TestCheckUnknownKey(t *testing.T) {
+	c := New(1, 10.0)
+	fundAddresses(c, "alice")
+
+	// A transfer without a key is checkable only where the key is registered
+	legacy, key := createTestTransaction("alice", "bob", 3.0)
+	legacy.PublicKey = nil
+	c.RegisterPublicKey("alice", key)
+	if err := c.AddBlock([]*transaction.Transaction{legacy}, "miner"); err != nil {
+		t.Fatalf("failed to add block: %v", err)
+	}
+	if report := c.Check(); report.Fault != nil || report.Verified != 1 {
+		t.Fatalf("expected the registered key to verify the transfer, got %+v", report)
+	}
+
+	unknown := reloaded(t, c)
+	if unknown.IsValid() {
+		t.Error("expected a transfer nobody can verify to make the chain invalid")
+	}
+	fault := unknown.Check().Fault
+	if fault == nil || fault.Height != 2 || fault.TxID != legacy.ID {
+		t.Errorf("expected an unknown key fault on block 2, got %+v", fault)
+	}
+}
+
+func TestCheckBrokenLink(t *testing.T) {
+	c := New(1, 10.0)
+	fundAddresses(c, "alice", "bob", "carol")
+	c.Blocks[2].PreviousHash = "bogus"
+
+	fault := c.Check().Fault
+	if fault == nil || fault.Height != 2 || fault.Hash != c.Blocks[2].Hash {
+		t.Errorf("expected a fault at height 2, got %+v", fault)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	c := New(1, 10.0)
+	fundAddresses(c, "alice", "bob", "alice")
+
+	if err := c.Truncate(2); err != nil {
+		t.Fatalf("truncate failed: %v", err)
+	}
+	if c.Length() != 2 || c.GetBalance("alice") != 10 || c.GetBalance("bob") != 0 {
+		t.Errorf("expected state rebuilt from 2 blocks, got length %d, alice %.2f, bob %.2f",
+			c.Length(), c.GetBalance("alice"), c.GetBalance("bob"))
+	}
+	if _, ok := c.BlockByHeight(2); ok {
+		t.Error("expected truncated blocks to be dropped from the index")
+	}
+
+	for _, height := range []int{0, 3} {
+		if err := c.Truncate(height); err == nil {
+			t.Errorf("expected truncating at %d to fail", height)
+		}
+	}
+}
+
+func TestExtend(t *testing.T) {
+	c := New(1, 10.0)
+	w, _ := wallet.New()
+	fundAddresses(c, w.Address(), "alice")
+	tx := transaction.New(w.Address(), "bob", 4.0)
+	tx.Sign(w.PrivateKey)
+	c.AddBlock([]*transaction.Transaction{tx}, "miner")
+
+	synced := reloaded(t, &Chain{Blocks: c.Blocks[:1], Difficulty: c.Difficulty, MiningReward: c.MiningReward})
+	if err := synced.Extend(c.Blocks[1:2]); err != nil {
+		t.Fatalf("extend failed: %v", err)
+	}
+
+	// Skipping a block breaks the link, and what came before is kept
+	err := synced.Extend([]*block.Block{c.Blocks[3]})
+	var fault *Fault
+	if !errors.As(err, &fault) || fault.Height != 2 {
+		t.Fatalf("expected a fault at height 2, got %v", err)
+	}
+	if synced.Length() != 2 {
+		t.Errorf("expected 2 blocks kept, got %d", synced.Length())
+	}
+
+	if err := synced.Extend(c.Blocks[2:]); err != nil {
+		t.Fatalf("extend failed: %v", err)
+	}
+	if synced.GetBalance(w.Address()) != 6 || synced.GetBalance("bob") != 4 {
+		t.Errorf("expected balances replayed, got %.2f and %.2f", synced.GetBalance(w.Address()), synced.GetBalance("bob"))
+	}
+	if got, ok := synced.Transaction(tx.ID); !ok || got.Height != 3 {
+		t.Errorf("expected the transfer indexed at height 3, got %+v", got)
+	}
+
+	// A block spending more than the sender has leaves the balances alone
+	overspend, _ := createTestTransaction("alice", "bob", 100)
+	bad := block.New(4, []*transaction.Transaction{transaction.New("COINBASE", "miner", 10), overspend}, c.Blocks[3].Hash)
+	bad.Transactions[0].ID = bad.Transactions[0].Hash()
+	bad.Mine(1)
+	if err := synced.Extend([]*block.Block{bad}); !errors.As(err, &fault) || fault.TxID != overspend.ID {
+		t.Fatalf("expected an overspend fault, got %v", err)
+	}
+	if synced.GetBalance("alice") != 10 || synced.GetBalance("miner") != 10 {
+		t.Errorf("expected balances unchanged by the bad block, got alice %.2f miner %.2f",
+			synced.GetBalance("alice"), synced.GetBalance("miner"))
+	}
+}
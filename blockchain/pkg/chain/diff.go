@@ -0,0 +1,80 @@
+package chain
+
+import "github.com/oksmith/home-server/blockchain/pkg/block"
+
+// DiffTx is a transaction confirmed on only one side of a fork
+type DiffTx struct {
+	TxID   string  `json:"txid"`
+	Height int64   `json:"height"`
+	From   string  `json:"from"`
+	To     string  `json:"to"`
+	Amount float64 `json:"amount"`
+}
+
+// ForkDiff compares the transactions two chains confirmed after their fork
+// point. Coinbases are left out, since each side's miners differ anyway.
+type ForkDiff struct {
+	OnlyA []DiffTx `json:"only_a"`
+	OnlyB []DiffTx `json:"only_b"`
+	Both  int      `json:"both"` // confirmed on both sides, maybe at different heights
+}
+
+// ForkPoint returns the index of the last block two chains share, given
+// their headers from genesis, or -1 if their genesis blocks differ. Blocks
+// link to their parents, so the chains match up to that index and differ
+// after it.
+func ForkPoint(a, b []block.Header) int64 {
+	fork := int64(-1)
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].Index != int64(i) || b[i].Index != int64(i) || a[i].Hash != b[i].Hash {
+			break
+		}
+		fork = int64(i)
+	}
+	return fork
+}
+
+// DiffBlocks compares the non-coinbase transactions in two chains' blocks
+// after their fork point
+func DiffBlocks(a, b []*block.Block) ForkDiff {
+	inA := confirmedTxs(a)
+	inB := confirmedTxs(b)
+
+	diff := ForkDiff{OnlyA: []DiffTx{}, OnlyB: []DiffTx{}}
+	for _, tx := range orderedTxs(a) {
+		if _, ok := inB[tx.TxID]; ok {
+			diff.Both++
+		} else {
+			diff.OnlyA = append(diff.OnlyA, tx)
+		}
+	}
+	for _, tx := range orderedTxs(b) {
+		if _, ok := inA[tx.TxID]; !ok {
+			diff.OnlyB = append(diff.OnlyB, tx)
+		}
+	}
+	return diff
+}
+
+// confirmedTxs indexes the non-coinbase transactions in blocks by ID
+func confirmedTxs(blocks []*block.Block) map[string]DiffTx {
+	txs := make(map[string]DiffTx)
+	for _, tx := range orderedTxs(blocks) {
+		txs[tx.TxID] = tx
+	}
+	return txs
+}
+
+// orderedTxs lists the non-coinbase transactions in blocks in chain order
+func orderedTxs(blocks []*block.Block) []DiffTx {
+	var txs []DiffTx
+	for _, b := range blocks {
+		for _, tx := range b.Transactions {
+			if tx.IsCoinbase() {
+				continue
+			}
+			txs = append(txs, DiffTx{TxID: tx.ID, Height: b.Index, From: tx.From, To: tx.To, Amount: tx.Amount})
+		}
+	}
+	return txs
+}
@@ -0,0 +1,68 @@
+package chain
+
+import (
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+)
+
+func TestForkPoint(t *testing.T) {
+	headers := func(hashes ...string) []block.Header {
+		var h []block.Header
+		for i, hash := range hashes {
+			h = append(h, block.Header{Index: int64(i), Hash: hash})
+		}
+		return h
+	}
+
+	tests := []struct {
+		name string
+		a, b []block.Header
+		want int64
+	}{
+		{"identical", headers("g", "1", "2"), headers("g", "1", "2"), 2},
+		{"b behind", headers("g", "1", "2"), headers("g", "1"), 1},
+		{"forked", headers("g", "1", "2a", "3a"), headers("g", "1", "2b"), 1},
+		{"different genesis", headers("g", "1"), headers("x", "1"), -1},
+		{"empty", nil, headers("g"), -1},
+	}
+	for _, tt := range tests {
+		if got := ForkPoint(tt.a, tt.b); got != tt.want {
+			t.Errorf("%s: ForkPoint = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDiffBlocks(t *testing.T) {
+	shared := transaction.New("alice", "bob", 1)
+	shared.ID = "shared"
+	onlyA := transaction.New("alice", "carol", 2)
+	onlyA.ID = "only-a"
+	onlyB := transaction.New("bob", "carol", 3)
+	onlyB.ID = "only-b"
+	coinbase := func(to string) *transaction.Transaction {
+		tx := transaction.New("COINBASE", to, 10)
+		tx.ID = "coinbase-" + to
+		return tx
+	}
+
+	a := []*block.Block{
+		block.New(2, []*transaction.Transaction{coinbase("miner-a"), shared, onlyA}, "h1"),
+	}
+	b := []*block.Block{
+		block.New(2, []*transaction.Transaction{coinbase("miner-b"), onlyB}, "h1"),
+		block.New(3, []*transaction.Transaction{coinbase("miner-b"), shared}, "h2b"),
+	}
+
+	diff := DiffBlocks(a, b)
+	if diff.Both != 1 {
+		t.Errorf("Both = %d, want 1", diff.Both)
+	}
+	if len(diff.OnlyA) != 1 || diff.OnlyA[0].TxID != "only-a" || diff.OnlyA[0].Height != 2 || diff.OnlyA[0].Amount != 2 {
+		t.Errorf("OnlyA = %+v, want only-a at height 2", diff.OnlyA)
+	}
+	if len(diff.OnlyB) != 1 || diff.OnlyB[0].TxID != "only-b" || diff.OnlyB[0].To != "carol" {
+		t.Errorf("OnlyB = %+v, want only-b", diff.OnlyB)
+	}
+}
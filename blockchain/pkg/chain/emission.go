@@ -0,0 +1,146 @@
+package chain
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxHalvings is past the point where halving any float64 reward leaves zero
+const maxHalvings = 1100
+
+// Emission schedules the mining reward by height, so the coins minted per
+// block can taper off. The zero Emission pays MiningReward at every height.
+type Emission struct {
+	// HalvingInterval halves the reward every this many blocks: heights below
+	// it pay MiningReward, heights below twice it half that, and so on. Zero
+	// never halves.
+	HalvingInterval int64 `json:"halving_interval,omitempty"`
+
+	// Curve, if set, gives the reward from each listed height onwards,
+	// instead of halving. Heights below the first step pay MiningReward.
+	Curve []RewardStep `json:"curve,omitempty"`
+}
+
+// RewardStep is a point on an emission curve
+type RewardStep struct {
+	Height int64   `json:"height"`
+	Reward float64 `json:"reward"`
+}
+
+// IsZero reports whether e pays a constant reward
+func (e Emission) IsZero() bool {
+	return e.HalvingInterval == 0 && len(e.Curve) == 0
+}
+
+// Equal reports whether e and other schedule the same rewards
+func (e Emission) Equal(other Emission) bool {
+	return e.HalvingInterval == other.HalvingInterval && slices.Equal(e.Curve, other.Curve)
+}
+
+// Validate checks the schedule: a non-negative interval, or a curve of
+// non-negative rewards at strictly increasing heights above genesis, not both
+func (e Emission) Validate() error {
+	if e.HalvingInterval < 0 {
+		return fmt.Errorf("halving interval must not be negative, got %d", e.HalvingInterval)
+	}
+	if e.HalvingInterval > 0 && len(e.Curve) > 0 {
+		return fmt.Errorf("set a halving interval or a reward curve, not both")
+	}
+	for i, step := range e.Curve {
+		if step.Height < 1 {
+			return fmt.Errorf("reward curve heights must be positive, got %d", step.Height)
+		}
+		if i > 0 && step.Height <= e.Curve[i-1].Height {
+			return fmt.Errorf("reward curve heights must increase, got %d after %d", step.Height, e.Curve[i-1].Height)
+		}
+		if !(step.Reward >= 0) || math.IsInf(step.Reward, 1) {
+			return fmt.Errorf("reward at height %d must be a non-negative number, got %v", step.Height, step.Reward)
+		}
+	}
+	return nil
+}
+
+// Reward returns what the coinbase of the block at height may mint, for a
+// chain whose reward starts at base
+func (e Emission) Reward(base float64, height int64) float64 {
+	if len(e.Curve) > 0 {
+		reward := base
+		for _, step := range e.Curve {
+			if step.Height > height {
+				break
+			}
+			reward = step.Reward
+		}
+		return reward
+	}
+	if e.HalvingInterval > 0 {
+		halvings := height / e.HalvingInterval
+		if halvings >= maxHalvings {
+			return 0
+		}
+		return math.Ldexp(base, -int(halvings))
+	}
+	return base
+}
+
+// ParseRewardCurve parses a reward curve written as comma-separated
+// HEIGHT:REWARD steps, e.g. "1000:25,2000:10,5000:0"
+func ParseRewardCurve(s string) ([]RewardStep, error) {
+	var curve []RewardStep
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		heightStr, rewardStr, ok := strings.Cut(field, ":")
+		if !ok {
+			return nil, fmt.Errorf("reward curve step %q isn't HEIGHT:REWARD", field)
+		}
+		height, err := strconv.ParseInt(heightStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("reward curve step %q has an invalid height", field)
+		}
+		reward, err := strconv.ParseFloat(rewardStr, 64)
+		if err != nil {
+			return nil, fmt.Errorf("reward curve step %q has an invalid reward", field)
+		}
+		curve = append(curve, RewardStep{Height: height, Reward: reward})
+	}
+	if err := (Emission{Curve: curve}).Validate(); err != nil {
+		return nil, err
+	}
+	return curve, nil
+}
+
+// RewardAt returns the mining reward of the block at height
+func (c *Chain) RewardAt(height int64) float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.rewardAt(height)
+}
+
+// rewardAt is RewardAt for callers holding the lock
+func (c *Chain) rewardAt(height int64) float64 {
+	return c.Emission.Reward(c.MiningReward, height)
+}
+
+// SetEmission changes the chain's reward schedule. The blocks already on the
+// chain must keep to the new schedule, or it is refused.
+func (c *Chain) SetEmission(e Emission) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	previous := c.Emission
+	c.Emission = e
+	if report := c.check(); report.Fault != nil {
+		c.Emission = previous
+		return fmt.Errorf("chain doesn't keep to the new emission schedule: %w", report.Fault)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package chain
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+func TestEmissionReward(t *testing.T) {
+	halving := Emission{HalvingInterval: 2}
+	curve := Emission{Curve: []RewardStep{{Height: 3, Reward: 4}, {Height: 5, Reward: 0}}}
+	tests := []struct {
+		name     string
+		emission Emission
+		height   int64
+		want     float64
+	}{
+		{"constant", Emission{}, 1_000_000, 10},
+		{"before the first halving", halving, 1, 10},
+		{"at the first halving", halving, 2, 5},
+		{"within the first halving", halving, 3, 5},
+		{"at the second halving", halving, 4, 2.5},
+		{"halved away", halving, 1 << 40, 0},
+		{"before the curve", curve, 2, 10},
+		{"on a step", curve, 3, 4},
+		{"between steps", curve, 4, 4},
+		{"past the last step", curve, 100, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.emission.Reward(10, tt.height); got != tt.want {
+			t.Errorf("%s: Reward(10, %d) = %v, want %v", tt.name, tt.height, got, tt.want)
+		}
+	}
+}
+
+func TestEmissionValidate(t *testing.T) {
+	valid := []Emission{
+		{},
+		{HalvingInterval: 100},
+		{Curve: []RewardStep{{Height: 1, Reward: 5}, {Height: 10, Reward: 0}}},
+	}
+	for _, e := range valid {
+		if err := e.Validate(); err != nil {
+			t.Errorf("%+v: unexpected error %v", e, err)
+		}
+	}
+
+	invalid := map[string]Emission{
+		"negative interval": {HalvingInterval: -1},
+		"both":              {HalvingInterval: 10, Curve: []RewardStep{{Height: 1, Reward: 5}}},
+		"genesis step":      {Curve: []RewardStep{{Height: 0, Reward: 5}}},
+		"unordered steps":   {Curve: []RewardStep{{Height: 5, Reward: 5}, {Height: 5, Reward: 1}}},
+		"negative reward":   {Curve: []RewardStep{{Height: 1, Reward: -1}}},
+	}
+	for name, e := range invalid {
+		if err := e.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestParseRewardCurve(t *testing.T) {
+	curve, err := ParseRewardCurve("1000:25, 2000:12.5,5000:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RewardStep{{Height: 1000, Reward: 25}, {Height: 2000, Reward: 12.5}, {Height: 5000, Reward: 0}}
+	if !slices.Equal(curve, want) {
+		t.Errorf("expected %+v, got %+v", want, curve)
+	}
+
+	if curve, err := ParseRewardCurve(""); err != nil || curve != nil {
+		t.Errorf("expected no curve from an empty string, got %+v, %v", curve, err)
+	}
+	for _, s := range []string{"1000", "x:1", "1000:x", "2000:1,1000:2", "10:-1"} {
+		if _, err := ParseRewardCurve(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestHalvingSchedule(t *testing.T) {
+	c := New(1, 10.0)
+	if err := c.SetEmission(Emission{HalvingInterval: 2}); err != nil {
+		t.Fatal(err)
+	}
+	w, _ := wallet.New()
+	fundAddresses(c, w.Address(), w.Address(), w.Address())
+
+	for height, want := range map[int]float64{1: 10, 2: 5, 3: 5} {
+		if got := c.Blocks[height].Transactions[0].Amount; got != want {
+			t.Errorf("expected the coinbase at height %d to pay %v, got %v", height, want, got)
+		}
+	}
+	if got := c.RewardAt(4); got != 2.5 {
+		t.Errorf("expected the reward at height 4 to be 2.5, got %v", got)
+	}
+
+	// Fees still go on top of the scheduled reward
+	tx := transaction.New(w.Address(), "bob", 1.0)
+	tx.Fee = 0.5
+	tx.Sign(w.PrivateKey)
+	b, err := c.NewBlockTemplate([]*transaction.Transaction{tx}, "miner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := b.Transactions[0].Amount; got != 3.0 {
+		t.Errorf("expected the coinbase at height 4 to pay 2.5 plus the 0.5 fee, got %v", got)
+	}
+
+	// A coinbase paying the unhalved reward is refused
+	b.Transactions[0].Amount = c.MiningReward
+	b.Transactions[0].ID = b.Transactions[0].Hash()
+	b.Mine(c.Difficulty)
+	if err := c.AddMinedBlock(b); err == nil {
+		t.Error("expected a coinbase paying more than the scheduled reward to be rejected")
+	}
+	if report := c.Check(); report.Fault != nil {
+		t.Errorf("expected the chain to pass its check: %v", report.Fault)
+	}
+
+	// The blocks already mined paid more than a shorter interval allows
+	if err := c.SetEmission(Emission{HalvingInterval: 1}); err == nil {
+		t.Error("expected a schedule the chain doesn't keep to to be refused")
+	}
+	if c.Emission.HalvingInterval != 2 {
+		t.Errorf("expected a refused schedule to leave the old one, got %+v", c.Emission)
+	}
+
+	// The schedule is saved with the chain and taken on by ReplaceWith
+	path := filepath.Join(t.TempDir(), "chain.json")
+	if err := c.SaveToFile(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Emission.Equal(c.Emission) {
+		t.Errorf("expected emission %+v after reload, got %+v", c.Emission, loaded.Emission)
+	}
+	replaced := New(1, 10.0)
+	replaced.ReplaceWith(loaded)
+	if replaced.RewardAt(4) != 2.5 {
+		t.Errorf("expected ReplaceWith to adopt the schedule, got %+v", replaced.Emission)
+	}
+}
+
+func TestEmissionRunsOut(t *testing.T) {
+	c := New(1, 10.0)
+	if err := c.SetEmission(Emission{Curve: []RewardStep{{Height: 2, Reward: 0}}}); err != nil {
+		t.Fatal(err)
+	}
+	w, _ := wallet.New()
+	fundAddresses(c, w.Address())
+
+	// With nothing left to mint, a block without fees has a coinbase paying nothing
+	if err := c.AddBlock(nil, "miner"); err != nil {
+		t.Fatalf("expected an empty block to be mined once the reward runs out: %v", err)
+	}
+	if got := c.GetLatestBlock().Transactions[0].Amount; got != 0 {
+		t.Errorf("expected a coinbase of 0, got %v", got)
+	}
+
+	// and a block with fees pays the miner just those
+	tx := transaction.New(w.Address(), "bob", 1.0)
+	tx.Fee = 0.25
+	tx.Sign(w.PrivateKey)
+	if err := c.AddBlock([]*transaction.Transaction{tx}, "miner"); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.GetBalance("miner"); got != 0.25 {
+		t.Errorf("expected the miner to have earned the 0.25 fee, got %v", got)
+	}
+	if report := c.Check(); report.Fault != nil {
+		t.Errorf("expected the chain to pass its check: %v", report.Fault)
+	}
+}
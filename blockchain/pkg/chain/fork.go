@@ -0,0 +1,251 @@
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+)
+
+// MaxSideDepth is how far below the tip a competing branch may fork and
+// still be tracked. Older side blocks are forgotten as the tip moves on.
+const MaxSideDepth = 100
+
+// BlockStatus says what AcceptBlock did with a block
+type BlockStatus string
+
+const (
+	BlockKnown    BlockStatus = "known"    // already on the main chain or a side branch
+	BlockExtended BlockStatus = "extended" // appended to the tip
+	BlockSide     BlockStatus = "side"     // kept on a side branch with no more work than the main chain
+	BlockReorg    BlockStatus = "reorg"    // its branch had more work, and replaced the blocks after the fork
+	BlockOrphan   BlockStatus = "orphan"   // its parent is unknown, so it is held until the parent arrives
+)
+
+// Acceptance is what AcceptBlock did with a block
+type Acceptance struct {
+	Status     BlockStatus
+	ForkHeight int64          // with BlockReorg, the last block both branches share
+	Dropped    []*block.Block // with BlockReorg, the blocks rolled back, lowest first
+	Added      []*block.Block // blocks added to the main chain, lowest first
+	Connected  []*block.Block // orphans held earlier that joined the chain or a side branch behind this block
+}
+
+// blockWork is the work a block mined at difficulty proves: the hashes it
+// takes on average, since each leading zero hex digit cuts the odds 16-fold
+func blockWork(difficulty int) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(4*max(difficulty, 0)))
+}
+
+// Work returns the chain's cumulative proof of work, which decides between
+// competing branches rather than their length
+func (c *Chain) Work() *big.Int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.work(len(c.Blocks))
+}
+
+// work returns the cumulative work of the first n blocks of a branch of this
+// chain. Callers must hold the lock.
+func (c *Chain) work(n int) *big.Int {
+	return new(big.Int).Mul(blockWork(c.Difficulty), big.NewInt(int64(n)))
+}
+
+// SideBlocks returns how many blocks are held on competing branches
+func (c *Chain) SideBlocks() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.side)
+}
+
+// AcceptBlock takes a block from a peer that builds on any block we know,
+// not only the tip. A block on the tip extends the chain. One building
+// elsewhere is kept on a side branch, and if that branch now has more work
+// than the main chain, the blocks after the fork are rolled back and the
+// branch applied in their place. Should a branch block then turn out invalid,
+// the chain is left as it was and the block and its descendants are dropped.
+// A block whose parent we don't know is held as an orphan, and any orphans
+// waiting on a block are connected once it is accepted.
+func (c *Chain) AcceptBlock(b *block.Block) (Acceptance, error) {
+	if b == nil {
+		return Acceptance{}, errors.New("missing block")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	before := c.Blocks
+	got, err := c.accept(b)
+	if err != nil || got.Status == BlockKnown || got.Status == BlockOrphan {
+		return got, err
+	}
+	connected := c.connectOrphans(b)
+	if len(connected) == 0 {
+		return got, nil
+	}
+
+	// The orphans may have extended the chain further or switched branches
+	// again, so report the change as a whole
+	fork := min(len(before), len(c.Blocks)) - 1
+	for before[fork].Hash != c.Blocks[fork].Hash {
+		fork--
+	}
+	result := Acceptance{
+		Status:     got.Status,
+		ForkHeight: got.ForkHeight,
+		Dropped:    slices.Clone(before[fork+1:]),
+		Added:      slices.Clone(c.Blocks[fork+1:]),
+		Connected:  connected,
+	}
+	switch {
+	case len(result.Dropped) > 0:
+		result.Status, result.ForkHeight = BlockReorg, int64(fork)
+	case len(result.Added) > 0:
+		result.Status = BlockExtended
+	}
+	return result, nil
+}
+
+// accept does AcceptBlock's work for one block. Callers must hold the write
+// lock.
+func (c *Chain) accept(b *block.Block) (Acceptance, error) {
+	if _, ok := c.index.blocks[b.Hash]; ok {
+		return Acceptance{Status: BlockKnown}, nil
+	}
+	if _, ok := c.side[b.Hash]; ok {
+		return Acceptance{Status: BlockKnown}, nil
+	}
+
+	tip := c.Blocks[len(c.Blocks)-1]
+	if b.PreviousHash == tip.Hash {
+		if err := c.extend(b); err != nil {
+			return Acceptance{}, err
+		}
+		c.pruneSide()
+		return Acceptance{Status: BlockExtended, Added: []*block.Block{b}}, nil
+	}
+	if b.Index <= tip.Index-MaxSideDepth {
+		return Acceptance{}, fmt.Errorf("block %d forks more than %d blocks below the tip at %d", b.Index, MaxSideDepth, tip.Index)
+	}
+
+	parent, ok := c.knownBlock(b.PreviousHash)
+	if !ok {
+		return c.holdOrphan(b)
+	}
+
+	// Check what can be checked without the branch's account state now; the
+	// transfers are checked if the branch is ever applied
+	if err := c.validateBlockTransactions(b); err != nil {
+		return Acceptance{}, err
+	}
+	if err := c.validateNewBlock(b, parent); err != nil {
+		return Acceptance{}, err
+	}
+	if c.side == nil {
+		c.side = make(map[string]*block.Block)
+	}
+	c.side[b.Hash] = b
+
+	fork, branch, ok := c.branchOf(b)
+	if !ok {
+		c.dropSide(b)
+		return Acceptance{}, fmt.Errorf("block %d %s: branch doesn't lead back to the main chain", b.Index, b.Hash)
+	}
+	if c.work(fork+1+len(branch)).Cmp(c.work(len(c.Blocks))) <= 0 {
+		return Acceptance{Status: BlockSide}, nil
+	}
+	return c.reorganize(fork, branch)
+}
+
+// knownBlock finds a block on the main chain or a side branch. Callers must
+// hold the lock.
+func (c *Chain) knownBlock(hash string) (*block.Block, bool) {
+	if height, ok := c.index.blocks[hash]; ok {
+		return c.Blocks[height], true
+	}
+	b, ok := c.side[hash]
+	return b, ok
+}
+
+// branchOf returns the height of the main chain block a side block's branch
+// forks from, and the branch's blocks from there up to b. Callers must hold
+// the lock.
+func (c *Chain) branchOf(b *block.Block) (int, []*block.Block, bool) {
+	var branch []*block.Block
+	for b != nil {
+		branch = append(branch, b)
+		if height, ok := c.index.blocks[b.PreviousHash]; ok {
+			slices.Reverse(branch)
+			return height, branch, true
+		}
+		b = c.side[b.PreviousHash]
+	}
+	return 0, nil, false
+}
+
+// reorganize rolls the chain back to the block at height fork and applies
+// branch on top, keeping the blocks it replaces as a side branch. Callers must
+// hold the write lock.
+func (c *Chain) reorganize(fork int, branch []*block.Block) (Acceptance, error) {
+	oldBlocks, oldBalances, oldUTXOs := c.Blocks, c.balances, c.utxos
+	restore := func() {
+		c.Blocks, c.balances, c.utxos = oldBlocks, oldBalances, oldUTXOs
+		c.reindex()
+	}
+
+	// Copy the shared blocks so appending the branch leaves oldBlocks intact
+	c.Blocks = slices.Clone(oldBlocks[:fork+1])
+	if err := c.rebuildState(); err != nil {
+		restore()
+		return Acceptance{}, err
+	}
+	for _, b := range branch {
+		if err := c.extend(b); err != nil {
+			restore()
+			c.dropSide(b)
+			return Acceptance{}, fmt.Errorf("branch forking at %d is invalid: %w", fork, err)
+		}
+	}
+
+	dropped := slices.Clone(oldBlocks[fork+1:])
+	for _, b := range dropped {
+		c.side[b.Hash] = b
+	}
+	for _, b := range branch {
+		delete(c.side, b.Hash)
+	}
+	c.pruneSide()
+	return Acceptance{Status: BlockReorg, ForkHeight: int64(fork), Dropped: dropped, Added: branch}, nil
+}
+
+// dropSide forgets a side block and every side block built on it. Callers
+// must hold the write lock.
+func (c *Chain) dropSide(b *block.Block) {
+	gone := map[string]bool{b.Hash: true}
+	delete(c.side, b.Hash)
+	for removed := true; removed; {
+		removed = false
+		for hash, s := range c.side {
+			if gone[s.PreviousHash] {
+				gone[hash] = true
+				delete(c.side, hash)
+				removed = true
+			}
+		}
+	}
+}
+
+// pruneSide forgets side blocks and orphans too far below the tip to ever
+// win, along with the side blocks built on them. Callers must hold the write
+// lock.
+func (c *Chain) pruneSide() {
+	floor := c.Blocks[len(c.Blocks)-1].Index - MaxSideDepth
+	for _, b := range c.side {
+		if b.Index <= floor {
+			c.dropSide(b)
+		}
+	}
+	c.orphans = slices.DeleteFunc(c.orphans, func(o *block.Block) bool { return o.Index <= floor })
+}
@@ -0,0 +1,158 @@
+package chain
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+var forkGenesis = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// rivalOf returns a chain sharing c's first n blocks, to mine a competing
+// branch on
+func rivalOf(t *testing.T, c *Chain, n int) *Chain {
+	t.Helper()
+	rival := NewWithGenesis(c.Difficulty, c.MiningReward, forkGenesis)
+	if err := rival.Extend(c.Blocks[1:n]); err != nil {
+		t.Fatal(err)
+	}
+	return rival
+}
+
+func TestAcceptBlockExtends(t *testing.T) {
+	c := NewWithGenesis(1, 10.0, forkGenesis)
+	rival := rivalOf(t, c, 1)
+	fundAddresses(rival, "alice")
+
+	got, err := c.AcceptBlock(rival.Blocks[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != BlockExtended || len(got.Added) != 1 || c.GetBalance("alice") != 10.0 {
+		t.Errorf("expected the block to extend the chain, got %+v", got)
+	}
+	if got, _ := c.AcceptBlock(rival.Blocks[1]); got.Status != BlockKnown {
+		t.Errorf("expected a block already on the chain to be known, got %s", got.Status)
+	}
+
+	orphan := block.New(5, rival.Blocks[1].Transactions, "feed")
+	orphan.Mine(1)
+	if got, err := c.AcceptBlock(orphan); err != nil || got.Status != BlockOrphan {
+		t.Errorf("expected a block with no known parent held as an orphan, got %+v, %v", got, err)
+	}
+}
+
+func TestReorgToBranchWithMoreWork(t *testing.T) {
+	c := NewWithGenesis(1, 10.0, forkGenesis)
+	fundAddresses(c, "alice", "bob")
+	rival := rivalOf(t, c, 2)
+	fundAddresses(rival, "carol", "dave")
+	work, bobs := c.Work(), c.Blocks[2]
+
+	// A branch with as much work as ours is kept to one side
+	got, err := c.AcceptBlock(rival.Blocks[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != BlockSide || c.SideBlocks() != 1 {
+		t.Fatalf("expected the block on a side branch, got %+v with %d side blocks", got, c.SideBlocks())
+	}
+	if c.GetLatestBlock().Hash == rival.Blocks[2].Hash || c.GetBalance("carol") != 0 {
+		t.Error("expected a side block not to touch the main chain")
+	}
+	if got, _ := c.AcceptBlock(rival.Blocks[2]); got.Status != BlockKnown {
+		t.Errorf("expected a side block seen again to be known, got %s", got.Status)
+	}
+
+	// Once it has more, the chain switches over
+	got, err = c.AcceptBlock(rival.Blocks[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != BlockReorg || got.ForkHeight != 1 {
+		t.Fatalf("expected a reorg from height 1, got %+v", got)
+	}
+	if len(got.Dropped) != 1 || got.Dropped[0].Hash != bobs.Hash {
+		t.Errorf("expected bob's block rolled back, got %+v", got.Dropped)
+	}
+	if len(got.Added) != 2 || got.Added[0].Hash != rival.Blocks[2].Hash || got.Added[1].Hash != rival.Blocks[3].Hash {
+		t.Errorf("expected the rival's two blocks applied, got %+v", got.Added)
+	}
+	if c.GetLatestBlock().Hash != rival.GetLatestBlock().Hash {
+		t.Error("expected the rival's tip to be ours")
+	}
+	if c.GetBalance("bob") != 0 || c.GetBalance("carol") != 10.0 || c.GetBalance("dave") != 10.0 {
+		t.Errorf("expected balances from the new branch, got bob %.2f carol %.2f", c.GetBalance("bob"), c.GetBalance("carol"))
+	}
+	if _, ok := c.BlockByHash(got.Dropped[0].Hash); ok {
+		t.Error("expected the rolled back block off the main chain")
+	}
+	if c.SideBlocks() != 1 {
+		t.Errorf("expected the rolled back block kept on a side branch, got %d side blocks", c.SideBlocks())
+	}
+	want := new(big.Int).Add(work, blockWork(1))
+	if c.Work().Cmp(want) != 0 {
+		t.Errorf("expected work %v, got %v", want, c.Work())
+	}
+	if report := c.Check(); report.Fault != nil {
+		t.Errorf("expected the reorganised chain to pass its check: %v", report.Fault)
+	}
+}
+
+func TestReorgToInvalidBranch(t *testing.T) {
+	c := NewWithGenesis(1, 10.0, forkGenesis)
+	fundAddresses(c, "alice", "bob")
+	rival := rivalOf(t, c, 2)
+	fundAddresses(rival, "carol")
+
+	// The branch's second block spends coins its sender doesn't have, which
+	// only shows once the branch is applied
+	broke, _ := wallet.New()
+	tx := transaction.New(broke.Address(), "mallory", 5.0)
+	tx.Sign(broke.PrivateKey)
+	coinbase := transaction.New("COINBASE", "mallory", 10.0)
+	coinbase.ID = coinbase.Hash()
+	bad := block.New(3, []*transaction.Transaction{coinbase, tx}, rival.Blocks[2].Hash)
+	bad.Mine(1)
+
+	if got, err := c.AcceptBlock(rival.Blocks[2]); err != nil || got.Status != BlockSide {
+		t.Fatalf("expected the first branch block on a side branch, got %+v, %v", got, err)
+	}
+	tip := c.GetLatestBlock().Hash
+	if _, err := c.AcceptBlock(bad); err == nil {
+		t.Fatal("expected the invalid branch to be refused")
+	}
+	if c.GetLatestBlock().Hash != tip || c.GetBalance("bob") != 10.0 || c.GetBalance("mallory") != 0 {
+		t.Error("expected a failed reorg to leave the chain as it was")
+	}
+	if c.SideBlocks() != 1 {
+		t.Errorf("expected only the invalid block dropped, got %d side blocks", c.SideBlocks())
+	}
+	if report := c.Check(); report.Fault != nil {
+		t.Errorf("expected the chain to pass its check: %v", report.Fault)
+	}
+}
+
+func TestSideBlocksPruned(t *testing.T) {
+	c := NewWithGenesis(1, 10.0, forkGenesis)
+	fundAddresses(c, "alice")
+	rival := rivalOf(t, c, 1)
+	fundAddresses(rival, "bob")
+	if got, err := c.AcceptBlock(rival.Blocks[1]); err != nil || got.Status != BlockSide {
+		t.Fatalf("expected a side block, got %+v, %v", got, err)
+	}
+
+	for range MaxSideDepth {
+		c.AddBlock(nil, "alice")
+	}
+	if c.SideBlocks() != 0 {
+		t.Errorf("expected a side block %d blocks below the tip to be forgotten, got %d", MaxSideDepth, c.SideBlocks())
+	}
+	if _, err := c.AcceptBlock(rival.Blocks[1]); err == nil {
+		t.Error("expected a block forking too far below the tip to be refused")
+	}
+}
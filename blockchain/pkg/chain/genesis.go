@@ -0,0 +1,122 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+)
+
+// Genesis specifies a chain's first block and the settings it starts with,
+// so test networks and demos can begin with funded accounts instead of
+// mining empty blocks for them. Nodes given the same Genesis build the same
+// genesis block.
+type Genesis struct {
+	Timestamp    time.Time `json:"timestamp"`
+	Difficulty   int       `json:"difficulty"`
+	MiningReward float64   `json:"mining_reward"`
+
+	// Alloc premines a balance for each address, paid by coinbase
+	// transactions in the genesis block
+	Alloc map[string]float64 `json:"alloc,omitempty"`
+}
+
+// LoadGenesis reads and validates a genesis spec from a JSON file such as
+// genesis.json
+func LoadGenesis(filename string) (*Genesis, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var g Genesis
+	if err := dec.Decode(&g); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if err := g.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return &g, nil
+}
+
+// Validate checks the spec: a timestamp, a difficulty a block hash can meet,
+// a non-negative reward and positive allocations to named addresses
+func (g *Genesis) Validate() error {
+	if g.Timestamp.IsZero() {
+		return fmt.Errorf("genesis timestamp is required")
+	}
+	if g.Difficulty < 0 || g.Difficulty > 64 {
+		return fmt.Errorf("difficulty must be between 0 and 64, got %d", g.Difficulty)
+	}
+	if !(g.MiningReward >= 0) || math.IsInf(g.MiningReward, 1) {
+		return fmt.Errorf("mining reward must be a non-negative number, got %v", g.MiningReward)
+	}
+	for address, amount := range g.Alloc {
+		if address == "" || address == "COINBASE" {
+			return fmt.Errorf("can't allocate to address %q", address)
+		}
+		if !(amount > 0) || math.IsInf(amount, 1) {
+			return fmt.Errorf("allocation to %s must be a positive number, got %v", address, amount)
+		}
+	}
+	return nil
+}
+
+// allocations returns the coinbase transactions paying out g.Alloc, ordered
+// by address and timestamped with the genesis block so every node hashes
+// them the same
+func (g *Genesis) allocations() []*transaction.Transaction {
+	addresses := make([]string, 0, len(g.Alloc))
+	for address := range g.Alloc {
+		addresses = append(addresses, address)
+	}
+	slices.Sort(addresses)
+
+	txs := make([]*transaction.Transaction, 0, len(addresses))
+	for _, address := range addresses {
+		tx := transaction.New("COINBASE", address, g.Alloc[address])
+		tx.Timestamp = g.Timestamp
+		tx.ID = tx.Hash()
+		txs = append(txs, tx)
+	}
+	return txs
+}
+
+// NewFromGenesis creates a new blockchain from a genesis spec, with its
+// allocations already in the balances
+func NewFromGenesis(g *Genesis) (*Chain, error) {
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+	c := newChain(g.Difficulty, g.MiningReward)
+	c.createGenesisBlock(g.Timestamp, g.allocations())
+	if err := c.rebuildState(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// validateGenesis checks a genesis block, which may only carry allocations:
+// coinbase transactions paying positive amounts, with IDs matching their
+// contents
+func validateGenesis(genesis *block.Block) error {
+	if genesis == nil || genesis.Index != 0 {
+		return fmt.Errorf("malformed genesis block")
+	}
+	for i, tx := range genesis.Transactions {
+		if tx == nil || !tx.IsCoinbase() || tx.To == "" || !(tx.Amount > 0) || math.IsInf(tx.Amount, 1) || tx.Fee != 0 {
+			return fmt.Errorf("genesis transaction %d is not an allocation", i)
+		}
+		if tx.ID != tx.Hash() {
+			return fmt.Errorf("genesis transaction %d: ID does not match contents", i)
+		}
+	}
+	return nil
+}
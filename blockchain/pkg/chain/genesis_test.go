@@ -0,0 +1,118 @@
+package chain
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+func TestNewFromGenesis(t *testing.T) {
+	w, _ := wallet.New()
+	g := &Genesis{
+		Timestamp:    time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+		Difficulty:   1,
+		MiningReward: 5.0,
+		Alloc:        map[string]float64{w.Address(): 100.0, "bob": 25.0},
+	}
+	c, err := NewFromGenesis(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Difficulty != 1 || c.MiningReward != 5.0 || c.Length() != 1 {
+		t.Errorf("expected a 1-block chain with the spec's settings, got %+v", c)
+	}
+	if c.GetBalance(w.Address()) != 100.0 || c.GetBalance("bob") != 25.0 {
+		t.Errorf("expected premined balances, got %.2f and %.2f", c.GetBalance(w.Address()), c.GetBalance("bob"))
+	}
+
+	// The same spec builds the same genesis block
+	again, _ := NewFromGenesis(g)
+	if again.Blocks[0].Hash != c.Blocks[0].Hash {
+		t.Error("expected the same spec to give the same genesis block")
+	}
+
+	// Premined coins can be spent straight away
+	tx := transaction.New(w.Address(), "carol", 40.0)
+	tx.Sign(w.PrivateKey)
+	c.RegisterPublicKey(w.Address(), w.PublicKey)
+	if err := c.AddBlock([]*transaction.Transaction{tx}, "miner"); err != nil {
+		t.Fatal(err)
+	}
+	if c.GetBalance("carol") != 40.0 || c.GetBalance(w.Address()) != 60.0 {
+		t.Errorf("expected the premine spent, got carol %.2f", c.GetBalance("carol"))
+	}
+	if report := c.Check(); report.Fault != nil {
+		t.Errorf("expected a premined chain to pass its check: %v", report.Fault)
+	}
+
+	// UTXO accounting keeps the allocations as outputs
+	u, _ := NewFromGenesis(g)
+	if err := u.SetAccounting(AccountingUTXO); err != nil {
+		t.Fatal(err)
+	}
+	if unspent, err := u.Unspent("bob"); err != nil || len(unspent) != 1 {
+		t.Errorf("expected bob's allocation as an output, got %v, %v", unspent, err)
+	}
+}
+
+func TestCheckGenesisAllocations(t *testing.T) {
+	c, err := NewFromGenesis(&Genesis{Timestamp: forkGenesis, Difficulty: 1, Alloc: map[string]float64{"alice": 10.0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A transfer in the genesis block would spend coins nobody had
+	transfer := transaction.New("alice", "mallory", 5.0)
+	transfer.ID = transfer.Hash()
+	c.Blocks[0].Transactions = append(c.Blocks[0].Transactions, transfer)
+	if report := c.Check(); report.Fault == nil {
+		t.Error("expected a genesis block with a transfer to fail its check")
+	}
+
+	c.Blocks[0].Transactions = c.Blocks[0].Transactions[:1]
+	c.Blocks[0].Transactions[0].Amount = 1000.0
+	if report := c.Check(); report.Fault == nil {
+		t.Error("expected an allocation not matching its ID to fail the check")
+	}
+}
+
+func TestLoadGenesis(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	g, err := LoadGenesis(write("genesis.json", `{
+		"timestamp": "2025-06-01T00:00:00Z",
+		"difficulty": 2,
+		"mining_reward": 50,
+		"alloc": {"alice": 1000, "bob": 250.5}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Difficulty != 2 || g.MiningReward != 50 || g.Alloc["bob"] != 250.5 {
+		t.Errorf("expected the spec read back, got %+v", g)
+	}
+
+	for name, data := range map[string]string{
+		"no-timestamp.json": `{"difficulty": 1, "mining_reward": 50}`,
+		"negative.json":     `{"timestamp": "2025-06-01T00:00:00Z", "alloc": {"alice": -5}}`,
+		"coinbase.json":     `{"timestamp": "2025-06-01T00:00:00Z", "alloc": {"COINBASE": 5}}`,
+		"difficulty.json":   `{"timestamp": "2025-06-01T00:00:00Z", "difficulty": 65}`,
+		"typo.json":         `{"timestamp": "2025-06-01T00:00:00Z", "allocs": {"alice": 5}}`,
+	} {
+		if _, err := LoadGenesis(write(name, data)); err == nil {
+			t.Errorf("%s: expected the spec to be refused", name)
+		}
+	}
+}
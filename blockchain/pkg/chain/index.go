@@ -0,0 +1,160 @@
+package chain
+
+import (
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+)
+
+// ConfirmedTx is a transaction together with the block that confirmed it
+type ConfirmedTx struct {
+	Tx            *transaction.Transaction `json:"tx"`
+	Height        int64                    `json:"height"`
+	BlockHash     string                   `json:"block_hash"`
+	Confirmations int64                    `json:"confirmations"` // 1 in the tip block, one more for each block since
+}
+
+// txLocation is where a transaction sits in the chain
+type txLocation struct {
+	height int
+	pos    int
+}
+
+// index maps block hashes, transaction IDs and addresses to their place in
+// the chain so lookups don't scan every block
+type index struct {
+	blocks    map[string]int          // block hash -> height
+	txs       map[string]txLocation   // transaction ID -> location
+	addresses map[string][]txLocation // address -> transactions sent or received, oldest first
+}
+
+// newIndex returns an empty index with room for the given number of blocks
+// and transactions
+func newIndex(blocks, txs int) *index {
+	return &index{
+		blocks:    make(map[string]int, blocks),
+		txs:       make(map[string]txLocation, txs),
+		addresses: make(map[string][]txLocation),
+	}
+}
+
+// add indexes a block appended at the given height
+func (idx *index) add(height int, b *block.Block) {
+	idx.blocks[b.Hash] = height
+	for pos, tx := range b.Transactions {
+		loc := txLocation{height: height, pos: pos}
+		idx.txs[tx.ID] = loc
+		idx.addresses[tx.To] = append(idx.addresses[tx.To], loc)
+		if tx.From != tx.To {
+			idx.addresses[tx.From] = append(idx.addresses[tx.From], loc)
+		}
+	}
+}
+
+// reindex rebuilds the index from scratch. Callers must hold the write lock.
+func (c *Chain) reindex() {
+	txs := 0
+	for _, b := range c.Blocks {
+		txs += len(b.Transactions)
+	}
+	c.index = newIndex(len(c.Blocks), txs)
+	for height, b := range c.Blocks {
+		c.index.add(height, b)
+	}
+}
+
+// BlockByHash returns the block with the given hash
+func (c *Chain) BlockByHash(hash string) (*block.Block, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	height, ok := c.index.blocks[hash]
+	if !ok {
+		return nil, false
+	}
+	return c.Blocks[height], true
+}
+
+// BlockByHeight returns the block at the given height
+func (c *Chain) BlockByHeight(height int) (*block.Block, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if height < 0 || height >= len(c.Blocks) {
+		return nil, false
+	}
+	return c.Blocks[height], true
+}
+
+// BlockRange returns up to limit blocks from height from onwards, oldest first
+func (c *Chain) BlockRange(from, limit int) []*block.Block {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	from = min(max(from, 0), len(c.Blocks))
+	end := min(from+max(limit, 0), len(c.Blocks))
+	blocks := make([]*block.Block, end-from)
+	copy(blocks, c.Blocks[from:end])
+	return blocks
+}
+
+// RecentBlocks returns up to limit blocks, newest first
+func (c *Chain) RecentBlocks(limit int) []*block.Block {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	limit = min(max(limit, 0), len(c.Blocks))
+	blocks := make([]*block.Block, 0, limit)
+	for i := len(c.Blocks) - 1; i >= len(c.Blocks)-limit; i-- {
+		blocks = append(blocks, c.Blocks[i])
+	}
+	return blocks
+}
+
+// Transaction returns a confirmed transaction by ID
+func (c *Chain) Transaction(id string) (ConfirmedTx, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	loc, ok := c.index.txs[id]
+	if !ok {
+		return ConfirmedTx{}, false
+	}
+	return c.confirmed(loc), true
+}
+
+// GetTransaction returns a confirmed transaction by ID and how many
+// confirmations it has, found through the index rather than by scanning
+// blocks. Transaction also gives the block that confirmed it.
+func (c *Chain) GetTransaction(id string) (*transaction.Transaction, int64, bool) {
+	confirmed, ok := c.Transaction(id)
+	if !ok {
+		return nil, 0, false
+	}
+	return confirmed.Tx, confirmed.Confirmations, true
+}
+
+// AddressHistory returns up to limit confirmed transactions sent or received
+// by address, newest first
+func (c *Chain) AddressHistory(address string, limit int) []ConfirmedTx {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	locs := c.index.addresses[address]
+	limit = min(max(limit, 0), len(locs))
+	history := make([]ConfirmedTx, 0, limit)
+	for i := len(locs) - 1; i >= len(locs)-limit; i-- {
+		history = append(history, c.confirmed(locs[i]))
+	}
+	return history
+}
+
+// confirmed resolves an index location. Callers must hold the lock.
+func (c *Chain) confirmed(loc txLocation) ConfirmedTx {
+	b := c.Blocks[loc.height]
+	return ConfirmedTx{
+		Tx:            b.Transactions[loc.pos],
+		Height:        b.Index,
+		BlockHash:     b.Hash,
+		Confirmations: int64(len(c.Blocks) - loc.height),
+	}
+}
@@ -0,0 +1,53 @@
+package chain
+
+import (
+	"iter"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+)
+
+// Iterator returns the chain's blocks from genesis to the tip, lowest first,
+// as they stood when it was called. The chain isn't locked while the loop
+// body runs, so the body may call back into the chain, and blocks added or
+// replaced meanwhile aren't seen.
+func (c *Chain) Iterator() iter.Seq[*block.Block] {
+	// Blocks below the tip are never overwritten in place: replacing them
+	// builds a new slice, and Truncate clips it so appending reallocates. So
+	// the slice as it is now stays intact without copying it.
+	c.mu.RLock()
+	blocks := c.Blocks
+	c.mu.RUnlock()
+
+	return func(yield func(*block.Block) bool) {
+		for _, b := range blocks {
+			if !yield(b) {
+				return
+			}
+		}
+	}
+}
+
+// ForEachBlock calls fn with each block from genesis to the tip, as Iterator
+// does, stopping at and returning the first error fn returns
+func (c *Chain) ForEachBlock(fn func(*block.Block) error) error {
+	for b := range c.Iterator() {
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StoredBlocks reads the blocks saved in s from height from onwards, one at
+// a time, so a chain can be walked without holding it in memory. Iteration
+// ends after the first error, which is yielded with a nil block.
+func StoredBlocks(s Store, from int) iter.Seq2[*block.Block, error] {
+	return func(yield func(*block.Block, error) bool) {
+		for height := max(from, 0); height < s.Len(); height++ {
+			b, err := s.Block(height)
+			if !yield(b, err) || err != nil {
+				return
+			}
+		}
+	}
+}
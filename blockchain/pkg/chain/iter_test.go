@@ -0,0 +1,126 @@
+package chain
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+)
+
+func TestIterator(t *testing.T) {
+	c := New(1, 10.0)
+	fundAddresses(c, "alice", "bob", "carol")
+	want := make([]string, len(c.Blocks))
+	for i, b := range c.Blocks {
+		want[i] = b.Hash
+	}
+
+	// The body can change the chain without deadlocking or seeing the change
+	var got []string
+	for b := range c.Iterator() {
+		got = append(got, b.Hash)
+		if b.Index == 1 {
+			if err := c.Truncate(2); err != nil {
+				t.Fatal(err)
+			}
+			fundAddresses(c, "dave", "erin")
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d blocks, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("block %d: expected the chain as it was, got %s", i, got[i])
+		}
+	}
+
+	// Breaking out stops it
+	count := 0
+	for range c.Iterator() {
+		count++
+		break
+	}
+	if count != 1 {
+		t.Errorf("expected to stop after 1 block, got %d", count)
+	}
+}
+
+func TestForEachBlock(t *testing.T) {
+	c := New(1, 10.0)
+	fundAddresses(c, "alice", "bob")
+
+	var heights []int64
+	if err := c.ForEachBlock(func(b *block.Block) error {
+		heights = append(heights, b.Index)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(heights) != 3 || heights[0] != 0 || heights[2] != 2 {
+		t.Errorf("expected heights 0 to 2, got %v", heights)
+	}
+
+	stop := errors.New("stop")
+	visited := 0
+	err := c.ForEachBlock(func(b *block.Block) error {
+		visited++
+		if b.Index == 1 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || visited != 2 {
+		t.Errorf("expected to stop at block 1 with its error, got %v after %d blocks", err, visited)
+	}
+}
+
+func TestStoredBlocks(t *testing.T) {
+	s := openStore(t, filepath.Join(t.TempDir(), "chain.db"))
+	c := New(1, 10.0)
+	fundAddresses(c, "alice", "bob", "carol")
+	if err := c.SaveTo(s); err != nil {
+		t.Fatal(err)
+	}
+
+	var heights []int64
+	for b, err := range StoredBlocks(s, 2) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		heights = append(heights, b.Index)
+	}
+	if len(heights) != 2 || heights[0] != 2 || heights[1] != 3 {
+		t.Errorf("expected blocks 2 and 3 read from the store, got %v", heights)
+	}
+
+	// A store that can't read a block ends with its error
+	failing := &failingStore{Store: s, height: 1}
+	var errs, blocks int
+	for b, err := range StoredBlocks(failing, 0) {
+		if err != nil {
+			errs++
+			continue
+		}
+		if b != nil {
+			blocks++
+		}
+	}
+	if blocks != 1 || errs != 1 {
+		t.Errorf("expected 1 block then an error, got %d blocks and %d errors", blocks, errs)
+	}
+}
+
+// failingStore is a Store that can't read the block at height
+type failingStore struct {
+	Store
+	height int
+}
+
+func (f *failingStore) Block(height int) (*block.Block, error) {
+	if height == f.height {
+		return nil, errors.New("unreadable")
+	}
+	return f.Store.Block(height)
+}
@@ -0,0 +1,76 @@
+package chain
+
+import (
+	"slices"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+)
+
+// MaxOrphans is how many blocks with an unknown parent AcceptBlock holds on
+// to. When the pool is full the one held longest makes way for a new one.
+const MaxOrphans = 100
+
+// OrphanBlocks returns how many blocks are waiting for their parent
+func (c *Chain) OrphanBlocks() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.orphans)
+}
+
+// holdOrphan keeps a block whose parent we don't know yet, after the checks
+// that need nothing but the block, so junk can't crowd out real blocks that
+// arrived out of order. Callers must hold the write lock.
+func (c *Chain) holdOrphan(b *block.Block) (Acceptance, error) {
+	if slices.ContainsFunc(c.orphans, func(o *block.Block) bool { return o.Hash == b.Hash }) {
+		return Acceptance{Status: BlockOrphan}, nil
+	}
+	if err := c.validateBlockTransactions(b); err != nil {
+		return Acceptance{}, err
+	}
+	if err := c.validateProofOfWork(b); err != nil {
+		return Acceptance{}, err
+	}
+
+	if len(c.orphans) >= MaxOrphans {
+		c.orphans = slices.Delete(c.orphans, 0, len(c.orphans)-MaxOrphans+1)
+	}
+	c.orphans = append(c.orphans, b)
+	return Acceptance{Status: BlockOrphan}, nil
+}
+
+// connectOrphans accepts the orphans waiting on b, then those waiting on
+// them, and returns the ones that joined the chain or a side branch, lowest
+// first. Orphans that turn out invalid are dropped. Callers must hold the
+// write lock.
+func (c *Chain) connectOrphans(b *block.Block) []*block.Block {
+	var connected []*block.Block
+	for queue := []string{b.Hash}; len(queue) > 0; queue = queue[1:] {
+		var children []*block.Block
+		c.orphans = slices.DeleteFunc(c.orphans, func(o *block.Block) bool {
+			if o.PreviousHash != queue[0] {
+				return false
+			}
+			children = append(children, o)
+			return true
+		})
+		for _, child := range children {
+			if got, err := c.accept(child); err == nil && got.Status != BlockKnown {
+				connected = append(connected, child)
+				queue = append(queue, child.Hash)
+			}
+		}
+	}
+	return connected
+}
+
+// pruneOrphans forgets orphans that are already known after the chain is
+// replaced wholesale, and those whose parent now is, as nothing is left to
+// connect them. Callers must hold the write lock.
+func (c *Chain) pruneOrphans() {
+	c.orphans = slices.DeleteFunc(c.orphans, func(o *block.Block) bool {
+		_, known := c.knownBlock(o.Hash)
+		_, parentKnown := c.knownBlock(o.PreviousHash)
+		return known || parentKnown
+	})
+	c.pruneSide()
+}
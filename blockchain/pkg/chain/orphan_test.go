@@ -0,0 +1,111 @@
+package chain
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+)
+
+func TestOrphansConnectWhenParentArrives(t *testing.T) {
+	c := NewWithGenesis(1, 10.0, forkGenesis)
+	rival := rivalOf(t, c, 1)
+	fundAddresses(rival, "alice", "bob", "carol")
+
+	for _, b := range []*block.Block{rival.Blocks[3], rival.Blocks[2]} {
+		if got, err := c.AcceptBlock(b); err != nil || got.Status != BlockOrphan {
+			t.Fatalf("expected block %d held as an orphan, got %+v, %v", b.Index, got, err)
+		}
+	}
+	if c.OrphanBlocks() != 2 || c.Length() != 1 {
+		t.Fatalf("expected 2 orphans and the chain untouched, got %d orphans and %d blocks", c.OrphanBlocks(), c.Length())
+	}
+
+	got, err := c.AcceptBlock(rival.Blocks[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != BlockExtended || len(got.Added) != 3 || len(got.Connected) != 2 {
+		t.Fatalf("expected the parent to bring both orphans in, got %+v", got)
+	}
+	if got.Connected[0].Hash != rival.Blocks[2].Hash || got.Connected[1].Hash != rival.Blocks[3].Hash {
+		t.Errorf("expected the orphans connected lowest first, got %+v", got.Connected)
+	}
+	if c.GetLatestBlock().Hash != rival.GetLatestBlock().Hash || c.GetBalance("carol") != 10.0 {
+		t.Error("expected the chain to reach the rival's tip")
+	}
+	if c.OrphanBlocks() != 0 {
+		t.Errorf("expected the pool emptied, got %d orphans", c.OrphanBlocks())
+	}
+}
+
+func TestOrphanCompletesBranchWithMoreWork(t *testing.T) {
+	c := NewWithGenesis(1, 10.0, forkGenesis)
+	fundAddresses(c, "alice", "bob")
+	rival := rivalOf(t, c, 2)
+	fundAddresses(rival, "carol", "dave")
+	bobs := c.Blocks[2]
+
+	if got, err := c.AcceptBlock(rival.Blocks[3]); err != nil || got.Status != BlockOrphan {
+		t.Fatalf("expected an orphan, got %+v, %v", got, err)
+	}
+
+	// Its parent alone only ties with our branch, but the two together win
+	got, err := c.AcceptBlock(rival.Blocks[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != BlockReorg || got.ForkHeight != 1 || len(got.Connected) != 1 {
+		t.Fatalf("expected the orphan to complete a reorg from height 1, got %+v", got)
+	}
+	if len(got.Dropped) != 1 || got.Dropped[0].Hash != bobs.Hash {
+		t.Errorf("expected bob's block rolled back, got %+v", got.Dropped)
+	}
+	if len(got.Added) != 2 || got.Added[1].Hash != rival.Blocks[3].Hash {
+		t.Errorf("expected both rival blocks applied, got %+v", got.Added)
+	}
+	if c.GetBalance("bob") != 0 || c.GetBalance("dave") != 10.0 {
+		t.Errorf("expected balances from the new branch, got bob %.2f dave %.2f", c.GetBalance("bob"), c.GetBalance("dave"))
+	}
+}
+
+func TestOrphanPool(t *testing.T) {
+	c := NewWithGenesis(1, 10.0, forkGenesis)
+	rival := rivalOf(t, c, 1)
+	fundAddresses(rival, "alice")
+	txs := rival.Blocks[1].Transactions
+
+	forged := block.New(2, txs, "feed")
+	forged.Mine(1)
+	forged.Nonce++
+	if _, err := c.AcceptBlock(forged); err == nil {
+		t.Error("expected an orphan whose hash doesn't match to be refused")
+	}
+
+	var first *block.Block
+	for i := range MaxOrphans + 1 {
+		b := block.New(2, txs, fmt.Sprintf("%064x", i+1))
+		b.Mine(1)
+		if _, err := c.AcceptBlock(b); err != nil {
+			t.Fatal(err)
+		}
+		if first == nil {
+			first = b
+		}
+	}
+	if c.OrphanBlocks() != MaxOrphans {
+		t.Errorf("expected the pool capped at %d, got %d", MaxOrphans, c.OrphanBlocks())
+	}
+	for _, o := range c.orphans {
+		if o.Hash == first.Hash {
+			t.Error("expected the orphan held longest to make way")
+		}
+	}
+
+	if err := c.Truncate(1); err != nil {
+		t.Fatal(err)
+	}
+	if c.OrphanBlocks() != 0 {
+		t.Errorf("expected truncating to drop orphans, got %d", c.OrphanBlocks())
+	}
+}
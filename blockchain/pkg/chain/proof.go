@@ -0,0 +1,38 @@
+package chain
+
+import (
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+)
+
+// ProvenTx is a transaction together with the proof that it is in the block at Height
+type ProvenTx struct {
+	Height int64                    `json:"height"`
+	Tx     *transaction.Transaction `json:"tx"`
+	Proof  *block.TxProof           `json:"proof"`
+}
+
+// ProveTransactions returns every transaction sent or received by address in
+// blocks from the given index onwards, each with an inclusion proof, so light
+// clients can verify their history against block headers alone
+func (c *Chain) ProveTransactions(address string, from int) []ProvenTx {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if from < 0 {
+		from = 0
+	}
+
+	proven := []ProvenTx{}
+	for i := from; i < len(c.Blocks); i++ {
+		b := c.Blocks[i]
+		for _, tx := range b.Transactions {
+			if tx.From != address && tx.To != address {
+				continue
+			}
+			proof, _ := b.Proof(tx.ID)
+			proven = append(proven, ProvenTx{Height: b.Index, Tx: tx, Proof: proof})
+		}
+	}
+	return proven
+}
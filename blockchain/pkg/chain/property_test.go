@@ -0,0 +1,272 @@
+package chain
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/clock"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+// The tests in this file drive a chain through random sequences of payments,
+// mining, bad blocks and reorgs, and check the consensus invariants after
+// every step. Each run is seeded, and a failure names its seed: rerun it with
+// go test -run 'TestProperties/seed=N' ./pkg/chain. Wallet keys and
+// signatures still come from crypto/rand, so hashes differ between reruns, but
+// the sequence of steps is the same.
+
+// propertyRuns is how many random histories are checked, and propertySteps
+// how long each one is
+const (
+	propertyRuns  = 25
+	propertySteps = 60
+)
+
+// history is a chain under test, with the wallets that trade on it and the
+// payments accepted but not mined yet
+type history struct {
+	t       *testing.T
+	rng     *rand.Rand
+	clock   *clock.Manual
+	chain   *Chain
+	wallets []*wallet.Wallet
+	pending []*transaction.Transaction
+	minted  float64 // total of every mining reward on the chain; fees only move coins
+}
+
+func TestProperties(t *testing.T) {
+	wallets := make([]*wallet.Wallet, 4)
+	for i := range wallets {
+		wallets[i], _ = wallet.New()
+	}
+
+	runs := propertyRuns
+	if testing.Short() {
+		runs = 5
+	}
+	for seed := range uint64(runs) {
+		t.Run(fmt.Sprintf("seed=%d", seed), func(t *testing.T) {
+			clk := clock.NewManual(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+			h := &history{
+				t:       t,
+				rng:     rand.New(rand.NewPCG(seed, seed)),
+				clock:   clk,
+				chain:   NewWithClock(1, 10.0, clk),
+				wallets: wallets,
+			}
+			for step := range propertySteps {
+				h.clock.Advance(time.Second)
+				switch op := h.rng.IntN(10); {
+				case op < 4:
+					h.pay()
+				case op < 7:
+					h.mine()
+				case op < 8:
+					h.mineOverspend()
+				case op < 9:
+					h.extendOverpaid()
+				default:
+					h.reorg()
+				}
+				h.checkInvariants(step)
+			}
+		})
+	}
+}
+
+// pay submits a random payment, sometimes with a fee, which the chain accepts
+// for the next block exactly when the sender can afford both on top of what's
+// already pending
+func (h *history) pay() {
+	from := h.wallets[h.rng.IntN(len(h.wallets))]
+	to := h.wallets[h.rng.IntN(len(h.wallets))].Address()
+	if h.rng.IntN(4) == 0 {
+		to = fmt.Sprintf("stranger-%d", h.rng.IntN(100))
+	}
+
+	// Aim around what the sender can spend, so both outcomes come up
+	spendable := h.chain.GetBalance(from.Address())
+	for _, tx := range h.pending {
+		if tx.From == from.Address() {
+			spendable -= tx.Total()
+		}
+		if tx.To == from.Address() {
+			spendable += tx.Amount
+		}
+	}
+	amount := math.Round((h.rng.Float64()*1.5*spendable+0.01)*100) / 100
+	fee := 0.0
+	if h.rng.IntN(2) == 0 {
+		fee = math.Round(h.rng.Float64()*100) / 100
+	}
+
+	tx := transaction.NewWithClock(h.clock, from.Address(), to, amount)
+	tx.Fee = fee
+	if err := tx.Sign(from.PrivateKey); err != nil {
+		h.t.Fatal(err)
+	}
+	candidate := append(append([]*transaction.Transaction{}, h.pending...), tx)
+	_, err := h.chain.NewBlockTemplate(candidate, "miner")
+	if affordable := amount+fee <= spendable; affordable != (err == nil) {
+		h.t.Fatalf("payment of %.2f with a %.2f fee and %.2f spendable: got err %v", amount, fee, spendable, err)
+	}
+	if err == nil {
+		h.pending = candidate
+	}
+}
+
+// mine mines the pending payments into a block paying a random wallet
+func (h *history) mine() {
+	miner := h.wallets[h.rng.IntN(len(h.wallets))].Address()
+	if err := h.chain.AddBlock(h.pending, miner); err != nil {
+		h.t.Fatalf("mining %d accepted payments: %v", len(h.pending), err)
+	}
+	h.minted += h.chain.MiningReward
+	h.pending = nil
+}
+
+// mineOverspend mines a block in which a wallet spends more than it has, as a
+// dishonest miner might, and checks the chain refuses it untouched
+func (h *history) mineOverspend() {
+	from := h.wallets[h.rng.IntN(len(h.wallets))]
+	tx := transaction.NewWithClock(h.clock, from.Address(), "thief", h.chain.GetBalance(from.Address())+1)
+	if err := tx.Sign(from.PrivateKey); err != nil {
+		h.t.Fatal(err)
+	}
+
+	b, err := h.chain.NewBlockTemplate(nil, "thief")
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	b.Transactions = append(b.Transactions, tx)
+	b.Mine(h.chain.Difficulty)
+
+	h.refused("an overspending block", func() error { return h.chain.AddMinedBlock(b) })
+}
+
+// extendOverpaid offers a block whose coinbase pays more than the reward, as
+// a peer's batch would arrive, and checks the chain refuses it untouched
+func (h *history) extendOverpaid() {
+	b, err := h.chain.NewBlockTemplate(nil, "thief")
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	b.Transactions[0].Amount = h.chain.MiningReward * 2
+	b.Transactions[0].ID = b.Transactions[0].Hash()
+	b.Mine(h.chain.Difficulty)
+
+	h.refused("an overpaying coinbase", func() error { return h.chain.Extend([]*block.Block{b}) })
+}
+
+// refused checks that add returns an error and leaves the chain as it was
+func (h *history) refused(what string, add func() error) {
+	tip, balances := h.chain.GetLatestBlock().Hash, h.balances()
+	if err := add(); err == nil {
+		h.t.Fatalf("accepted %s", what)
+	}
+	if h.chain.GetLatestBlock().Hash != tip {
+		h.t.Fatalf("refusing %s moved the tip", what)
+	}
+	h.sameBalances(balances, "refusing "+what)
+}
+
+// reorg rolls the chain back to a random height and reapplies the blocks it
+// dropped, both as a peer's batch and by swapping whole chains, and checks
+// that either way the chain ends up where it started
+func (h *history) reorg() {
+	length := h.chain.Length()
+	height := 1 + h.rng.IntN(length)
+	blocks := h.chain.BlockRange(0, length)
+	tip, balances := h.chain.GetLatestBlock().Hash, h.balances()
+
+	if err := h.chain.Truncate(height); err != nil {
+		h.t.Fatal(err)
+	}
+	if err := h.chain.Extend(blocks[height:]); err != nil {
+		h.t.Fatalf("reapplying blocks %d to %d: %v", height, length-1, err)
+	}
+	if h.chain.GetLatestBlock().Hash != tip {
+		h.t.Fatalf("truncating to %d and extending again changed the tip", height)
+	}
+	h.sameBalances(balances, fmt.Sprintf("truncating to %d and extending again", height))
+
+	fork := &Chain{Blocks: blocks[:height], Difficulty: h.chain.Difficulty, MiningReward: h.chain.MiningReward}
+	original := &Chain{Blocks: blocks, Difficulty: h.chain.Difficulty, MiningReward: h.chain.MiningReward}
+	for _, c := range []*Chain{fork, original} {
+		if err := c.RebuildState(); err != nil {
+			h.t.Fatal(err)
+		}
+	}
+	h.chain.ReplaceWith(fork)
+	h.chain.ReplaceWith(original)
+	if h.chain.GetLatestBlock().Hash != tip {
+		h.t.Fatalf("replacing with a fork at %d and back changed the tip", height)
+	}
+	h.sameBalances(balances, fmt.Sprintf("replacing with a fork at %d and back", height))
+	for _, b := range blocks[1:] {
+		for _, tx := range b.Transactions {
+			if confirmed, ok := h.chain.Transaction(tx.ID); !ok || confirmed.BlockHash != b.Hash {
+				h.t.Fatalf("transaction %s lost from the index after the reorg", tx.ID)
+			}
+		}
+	}
+
+	// Payments still pending were checked against the same state, so stay valid
+	if _, err := h.chain.NewBlockTemplate(h.pending, "miner"); err != nil {
+		h.t.Fatalf("pending payments became invalid after the reorg: %v", err)
+	}
+}
+
+// checkInvariants checks what must hold after every step
+func (h *history) checkInvariants(step int) {
+	h.t.Helper()
+	if report := h.chain.Check(); report.Fault != nil {
+		h.t.Fatalf("step %d: chain fails its check: %v", step, report.Fault)
+	}
+	if !h.chain.IsValid() {
+		h.t.Fatalf("step %d: chain is invalid", step)
+	}
+
+	supply := 0.0
+	for address, balance := range h.balances() {
+		if balance < 0 {
+			h.t.Fatalf("step %d: %s has a negative balance of %f", step, address, balance)
+		}
+		supply += balance
+	}
+	if math.Abs(supply-h.minted) > 1e-6 {
+		h.t.Fatalf("step %d: %.6f coins exist but mining rewards minted %.6f", step, supply, h.minted)
+	}
+}
+
+// balances returns a copy of every balance on the chain
+func (h *history) balances() map[string]float64 {
+	h.chain.mu.RLock()
+	defer h.chain.mu.RUnlock()
+	balances := make(map[string]float64, len(h.chain.balances))
+	for address, balance := range h.chain.balances {
+		balances[address] = balance
+	}
+	return balances
+}
+
+// sameBalances fails unless the chain's balances equal want
+func (h *history) sameBalances(want map[string]float64, after string) {
+	h.t.Helper()
+	got := h.balances()
+	for address := range got {
+		if _, ok := want[address]; !ok {
+			want[address] = 0
+		}
+	}
+	for address, balance := range want {
+		if math.Abs(got[address]-balance) > 1e-9 {
+			h.t.Fatalf("%s changed %s's balance from %f to %f", after, address, balance, got[address])
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package chain
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrTooManyBlocks is returned by Decode when a chain exceeds the block limit
+	ErrTooManyBlocks = errors.New("chain exceeds block limit")
+
+	// ErrInvalidChain is returned by Decode when a chain fails validation
+	ErrInvalidChain = errors.New("chain failed validation")
+)
+
+// WriteSnapshot streams the chain to w as gzip-compressed JSON
+func (c *Chain) WriteSnapshot(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	if err := json.NewEncoder(gz).Encode(c); err != nil {
+		gz.Close()
+		return err
+	}
+	return gz.Close()
+}
+
+// ReadSnapshot decodes a chain snapshot written by WriteSnapshot (plain JSON
+// is accepted too), rebuilds its state and rejects it unless it is fully valid
+func ReadSnapshot(r io.Reader) (*Chain, error) {
+	br := bufio.NewReader(r)
+
+	// gzip streams start with the magic bytes 0x1f 0x8b
+	var src io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("invalid snapshot compression: %w", err)
+		}
+		defer gz.Close()
+		src = gz
+	}
+
+	c, err := Decode(src, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %w", err)
+	}
+	return c, nil
+}
+
+// Decode reads a JSON-encoded chain from an untrusted source such as a peer.
+// It rejects chains with more than maxBlocks blocks (0 means no limit) and
+// chains that fail full validation, and only then rebuilds account state.
+func Decode(r io.Reader, maxBlocks int) (*Chain, error) {
+	var c Chain
+	if err := json.NewDecoder(r).Decode(&c); err != nil {
+		return nil, fmt.Errorf("malformed chain: %w", err)
+	}
+	if len(c.Blocks) == 0 {
+		return nil, fmt.Errorf("chain has no blocks")
+	}
+	if maxBlocks > 0 && len(c.Blocks) > maxBlocks {
+		return nil, fmt.Errorf("%w: %d blocks, limit is %d", ErrTooManyBlocks, len(c.Blocks), maxBlocks)
+	}
+
+	// Validate before touching state so malformed blocks are never replayed
+	if !c.IsValid() {
+		return nil, ErrInvalidChain
+	}
+	if err := c.RebuildState(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
@@ -0,0 +1,128 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	c := New(1, 10.0)
+	fundAddresses(c, "alice", "bob")
+
+	var buf bytes.Buffer
+	if err := c.WriteSnapshot(&buf); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+
+	loaded, err := ReadSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("failed to read snapshot: %v", err)
+	}
+	if loaded.Length() != c.Length() {
+		t.Errorf("expected %d blocks, got %d", c.Length(), loaded.Length())
+	}
+	if loaded.GetBalance("alice") != 10.0 {
+		t.Errorf("expected rebuilt balance 10.0, got %f", loaded.GetBalance("alice"))
+	}
+}
+
+func TestReadSnapshotPlainJSON(t *testing.T) {
+	c := New(1, 10.0)
+	fundAddresses(c, "alice")
+
+	data, _ := json.Marshal(c)
+	loaded, err := ReadSnapshot(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to read plain JSON snapshot: %v", err)
+	}
+	if loaded.Length() != 2 {
+		t.Errorf("expected 2 blocks, got %d", loaded.Length())
+	}
+}
+
+func TestReadSnapshotRejectsInvalid(t *testing.T) {
+	c := New(1, 10.0)
+	fundAddresses(c, "alice")
+	c.Blocks[1].Transactions[0].Amount = 1000.0
+	c.Blocks[1].Transactions[0].ID = c.Blocks[1].Transactions[0].Hash()
+
+	var buf bytes.Buffer
+	c.WriteSnapshot(&buf)
+
+	if _, err := ReadSnapshot(&buf); err == nil {
+		t.Error("expected tampered snapshot to be rejected")
+	}
+	if _, err := ReadSnapshot(bytes.NewReader([]byte(`{"blocks":[]}`))); err == nil {
+		t.Error("expected empty snapshot to be rejected")
+	}
+}
+
+func TestDecodeBlockLimit(t *testing.T) {
+	c := New(1, 10.0)
+	fundAddresses(c, "alice", "bob")
+	data, _ := json.Marshal(c)
+
+	if _, err := Decode(bytes.NewReader(data), 2); !errors.Is(err, ErrTooManyBlocks) {
+		t.Errorf("expected ErrTooManyBlocks, got %v", err)
+	}
+	if _, err := Decode(bytes.NewReader(data), 3); err != nil {
+		t.Errorf("chain within the limit rejected: %v", err)
+	}
+}
+
+func TestDecodeRejectsMintedCoins(t *testing.T) {
+	c := New(1, 10.0)
+	fundAddresses(c, "alice")
+
+	// A correctly re-mined block that pays itself more than the reward
+	b := c.Blocks[1]
+	b.Transactions[0].Amount = 1000.0
+	b.Transactions[0].ID = b.Transactions[0].Hash()
+	b.Nonce = 0
+	b.Mine(c.Difficulty)
+
+	data, _ := json.Marshal(c)
+	if _, err := Decode(bytes.NewReader(data), 0); !errors.Is(err, ErrInvalidChain) {
+		t.Errorf("expected ErrInvalidChain, got %v", err)
+	}
+}
+
+func TestDecodeRejectsMalformed(t *testing.T) {
+	inputs := []string{
+		`not json`,
+		`{"blocks":[null]}`,
+		`{"blocks":[{"index":0},null]}`,
+		`{"blocks":[{"index":0},{"index":1,"transactions":[null]}]}`,
+		`{"blocks":[{"index":0},{"index":1,"hash":"00"}],"difficulty":64}`,
+		`{"blocks":[{"index":0},{"index":1}],"difficulty":-1}`,
+	}
+	for _, input := range inputs {
+		if _, err := Decode(bytes.NewReader([]byte(input)), 0); err == nil {
+			t.Errorf("expected %s to be rejected", input)
+		}
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	c := New(1, 10.0)
+	fundAddresses(c, "alice")
+	data, _ := json.Marshal(c)
+	f.Add(data)
+	f.Add([]byte(`{"blocks":[{"index":0},{"index":1,"transactions":[null]}]}`))
+	f.Add([]byte(`{"blocks":[null],"difficulty":-5}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		decoded, err := Decode(bytes.NewReader(data), 100)
+		if err != nil {
+			return
+		}
+		if !decoded.IsValid() {
+			t.Errorf("Decode accepted an invalid chain")
+		}
+		if decoded.Length() > 100 {
+			t.Errorf("Decode accepted %d blocks over the limit", decoded.Length())
+		}
+	})
+}
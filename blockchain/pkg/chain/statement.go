@@ -0,0 +1,57 @@
+package chain
+
+import "time"
+
+// Kinds of StatementEntry
+const (
+	EntryMined    = "mined"    // a coinbase paid to the address
+	EntryReceived = "received" // a transfer from another address
+	EntrySent     = "sent"     // a transfer to another address
+	EntrySelf     = "self"     // a transfer from the address to itself
+)
+
+// StatementEntry is one confirmed transaction's effect on an address
+type StatementEntry struct {
+	Time         time.Time `json:"time"` // when the confirming block was mined
+	Height       int64     `json:"height"`
+	BlockHash    string    `json:"block_hash"`
+	TxID         string    `json:"txid"`
+	Kind         string    `json:"kind"`
+	Counterparty string    `json:"counterparty,omitempty"`
+	Credit       float64   `json:"credit"`
+	Debit        float64   `json:"debit"`         // including any fee
+	Fee          float64   `json:"fee,omitempty"` // paid to the miner, on sent and self entries
+	Balance      float64   `json:"balance"`       // after this entry
+}
+
+// Statement returns every confirmed transaction sent or received by address,
+// oldest first, with the running balance after each one
+func (c *Chain) Statement(address string) []StatementEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	locs := c.index.addresses[address]
+	entries := make([]StatementEntry, 0, len(locs))
+	var balance float64
+	for _, loc := range locs {
+		b := c.Blocks[loc.height]
+		tx := b.Transactions[loc.pos]
+		e := StatementEntry{Time: b.Timestamp, Height: b.Index, BlockHash: b.Hash, TxID: tx.ID}
+
+		switch {
+		case tx.IsCoinbase():
+			e.Kind, e.Credit = EntryMined, tx.Amount
+		case tx.From == tx.To:
+			e.Kind, e.Credit, e.Debit, e.Fee = EntrySelf, tx.Amount, tx.Total(), tx.Fee
+		case tx.To == address:
+			e.Kind, e.Counterparty, e.Credit = EntryReceived, tx.From, tx.Amount
+		default:
+			e.Kind, e.Counterparty, e.Debit, e.Fee = EntrySent, tx.To, tx.Total(), tx.Fee
+		}
+
+		balance += e.Credit - e.Debit
+		e.Balance = balance
+		entries = append(entries, e)
+	}
+	return entries
+}
@@ -0,0 +1,92 @@
+package chain
+
+import (
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+func TestStatement(t *testing.T) {
+	c := New(1, 10.0)
+	w, _ := wallet.New()
+	fundAddresses(c, w.Address())
+
+	sent := transaction.New(w.Address(), "bob", 4.0)
+	sent.Sign(w.PrivateKey)
+	self := transaction.New(w.Address(), w.Address(), 1.0)
+	self.Sign(w.PrivateKey)
+	if err := c.AddBlock([]*transaction.Transaction{sent, self}, "bob"); err != nil {
+		t.Fatalf("failed to add block: %v", err)
+	}
+
+	entries := c.Statement(w.Address())
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %+v", entries)
+	}
+	want := []struct {
+		kind          string
+		credit, debit float64
+		balance       float64
+		counterparty  string
+		height        int64
+	}{
+		{EntryMined, 10, 0, 10, "", 1},
+		{EntrySent, 0, 4, 6, "bob", 2},
+		{EntrySelf, 1, 1, 6, "", 2},
+	}
+	for i, exp := range want {
+		e := entries[i]
+		if e.Kind != exp.kind || e.Credit != exp.credit || e.Debit != exp.debit || e.Balance != exp.balance ||
+			e.Counterparty != exp.counterparty || e.Height != exp.height {
+			t.Errorf("entry %d: expected %+v, got %+v", i, exp, e)
+		}
+	}
+	if entries[1].TxID != sent.ID || !entries[1].Time.Equal(c.Blocks[2].Timestamp) {
+		t.Errorf("expected the sent entry to carry its ID and block time, got %+v", entries[1])
+	}
+	if got := entries[2].Balance; got != c.GetBalance(w.Address()) {
+		t.Errorf("final balance %v doesn't match the chain's %v", got, c.GetBalance(w.Address()))
+	}
+
+	bob := c.Statement("bob")
+	if len(bob) != 2 || bob[1].Kind != EntryReceived || bob[1].Counterparty != w.Address() || bob[1].Balance != 14 {
+		t.Errorf("expected bob to mine 10 then receive 4, got %+v", bob)
+	}
+	if got := c.Statement("nobody"); len(got) != 0 {
+		t.Errorf("expected no entries for an unknown address, got %+v", got)
+	}
+}
+
+func TestStatementWithFees(t *testing.T) {
+	c := New(1, 10.0)
+	w, _ := wallet.New()
+	fundAddresses(c, w.Address())
+
+	sent := transaction.New(w.Address(), "bob", 4.0)
+	sent.Fee = 0.5
+	sent.Sign(w.PrivateKey)
+	self := transaction.New(w.Address(), w.Address(), 1.0)
+	self.Fee = 0.25
+	self.Sign(w.PrivateKey)
+	if err := c.AddBlock([]*transaction.Transaction{sent, self}, "miner"); err != nil {
+		t.Fatalf("failed to add block: %v", err)
+	}
+
+	entries := c.Statement(w.Address())
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %+v", entries)
+	}
+	if e := entries[1]; e.Debit != 4.5 || e.Fee != 0.5 || e.Balance != 5.5 {
+		t.Errorf("expected the sent entry to debit 4.5 including a 0.5 fee, got %+v", e)
+	}
+	if e := entries[2]; e.Credit != 1 || e.Debit != 1.25 || e.Fee != 0.25 || e.Balance != 5.25 {
+		t.Errorf("expected the self entry to cost its 0.25 fee, got %+v", e)
+	}
+	if got := entries[2].Balance; got != c.GetBalance(w.Address()) {
+		t.Errorf("final balance %v doesn't match the chain's %v", got, c.GetBalance(w.Address()))
+	}
+	if miner := c.Statement("miner"); len(miner) != 1 || miner[0].Credit != 10.75 {
+		t.Errorf("expected the miner to be credited the reward and both fees, got %+v", miner)
+	}
+}
@@ -0,0 +1,255 @@
+package chain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/kv"
+)
+
+// ErrEmptyStore is returned by Load for a store with no chain in it yet
+var ErrEmptyStore = errors.New("store holds no chain")
+
+// Params are the settings a chain keeps to, saved alongside its blocks
+type Params struct {
+	Difficulty   int        `json:"difficulty"`
+	MiningReward float64    `json:"mining_reward"`
+	Emission     Emission   `json:"emission,omitzero"`
+	Accounting   Accounting `json:"accounting,omitempty"`
+}
+
+// equal reports whether p and other are the same settings
+func (p Params) equal(other Params) bool {
+	return p.Difficulty == other.Difficulty && p.MiningReward == other.MiningReward &&
+		p.Emission.Equal(other.Emission) && p.Accounting == other.Accounting
+}
+
+// Store keeps a chain on disk block by block, so a new block costs a write
+// of that block rather than of the whole chain
+type Store interface {
+	// Params returns the saved settings, or the zero Params if there are none
+	Params() (Params, error)
+	// Len returns how many blocks are saved
+	Len() int
+	// Hash returns the hash of the saved block at height
+	Hash(height int) (string, error)
+	// Block reads the saved block at height
+	Block(height int) (*block.Block, error)
+	// Save records params and replaces the blocks from height from onwards
+	// with blocks, all at once
+	Save(params Params, from int, blocks []*block.Block) error
+}
+
+// Load reads a chain from s a block at a time and rebuilds its state. The
+// chain it returns holds every block in memory, as chains do; StoredBlocks
+// walks a store without loading it.
+func Load(s Store) (*Chain, error) {
+	params, err := s.Params()
+	if err != nil {
+		return nil, err
+	}
+	if s.Len() == 0 {
+		return nil, ErrEmptyStore
+	}
+
+	c := &Chain{
+		Blocks:       make([]*block.Block, 0, s.Len()),
+		Difficulty:   params.Difficulty,
+		MiningReward: params.MiningReward,
+		Emission:     params.Emission,
+		Accounting:   params.Accounting,
+	}
+	for b, err := range StoredBlocks(s, 0) {
+		if err != nil {
+			return nil, err
+		}
+		c.Blocks = append(c.Blocks, b)
+	}
+
+	if err := c.RebuildState(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SaveTo brings s up to date with the chain, writing only the blocks s
+// doesn't have: the new ones after it last saved, or those after a fork it
+// has since been replaced from.
+func (c *Chain) SaveTo(s Store) error {
+	// Holding the read lock throughout means saves running side by side see
+	// the same chain, so they write the same thing whichever goes first
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	params := Params{Difficulty: c.Difficulty, MiningReward: c.MiningReward, Emission: c.Emission, Accounting: c.Accounting}
+	saved, err := s.Params()
+	if err != nil {
+		return err
+	}
+
+	from := min(s.Len(), len(c.Blocks))
+	for from > 0 {
+		hash, err := s.Hash(from - 1)
+		if err != nil {
+			return err
+		}
+		if hash == c.Blocks[from-1].Hash {
+			break
+		}
+		from--
+	}
+	if from == len(c.Blocks) && from == s.Len() && params.equal(saved) {
+		return nil
+	}
+	return s.Save(params, from, c.Blocks[from:])
+}
+
+// storeMeta is saved under metaKey, and is written with every change
+type storeMeta struct {
+	Params
+	Blocks int `json:"blocks"`
+}
+
+const metaKey = "meta"
+
+func blockKey(height int) string { return fmt.Sprintf("block/%016x", height) }
+func hashKey(height int) string  { return fmt.Sprintf("hash/%016x", height) }
+
+// KVStore is a Store kept in a kv file. Blocks are read from the file as
+// they're asked for, not held in memory.
+type KVStore struct {
+	db   *kv.DB
+	mu   sync.RWMutex
+	meta storeMeta
+}
+
+// OpenStore opens the block store in path, creating it if it doesn't exist.
+// A store damaged partway through opens with the blocks before the damage;
+// see Damaged.
+func OpenStore(path string) (*KVStore, error) {
+	db, err := kv.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &KVStore{db: db}
+	data, err := db.Get(metaKey)
+	switch {
+	case errors.Is(err, kv.ErrNotFound):
+	case err != nil:
+		db.Close()
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, &s.meta); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("store metadata doesn't decode: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// Damaged returns why the store could only be read up to some block, or nil
+// if it was read to the end. A damaged store refuses writes until Repair.
+func (s *KVStore) Damaged() error {
+	return s.db.Damaged()
+}
+
+// Repair drops whatever follows the damage, keeping the blocks that could be
+// read, so the store can be written again
+func (s *KVStore) Repair() error {
+	return s.db.Repair()
+}
+
+// Close closes the store's file
+func (s *KVStore) Close() error {
+	return s.db.Close()
+}
+
+// Params returns the saved settings
+func (s *KVStore) Params() (Params, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	params := s.meta.Params
+	params.Emission.Curve = slices.Clone(params.Emission.Curve)
+	return params, nil
+}
+
+// Len returns how many blocks are saved
+func (s *KVStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.meta.Blocks
+}
+
+// Hash returns the hash of the saved block at height, without reading the
+// block
+func (s *KVStore) Hash(height int) (string, error) {
+	data, err := s.get(height, hashKey(height))
+	return string(data), err
+}
+
+// Block reads the saved block at height
+func (s *KVStore) Block(height int) (*block.Block, error) {
+	data, err := s.get(height, blockKey(height))
+	if err != nil {
+		return nil, err
+	}
+	var b *block.Block
+	if err := json.Unmarshal(data, &b); err != nil || b == nil {
+		if err == nil {
+			err = errors.New("block is null")
+		}
+		return nil, fmt.Errorf("block %d doesn't decode: %w", height, err)
+	}
+	return b, nil
+}
+
+func (s *KVStore) get(height int, key string) ([]byte, error) {
+	if height < 0 || height >= s.Len() {
+		return nil, fmt.Errorf("no block %d in a store of %d", height, s.Len())
+	}
+	data, err := s.db.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("block %d: %w", height, err)
+	}
+	return data, nil
+}
+
+// Save records params and replaces the blocks from height from onwards with
+// blocks, in one write
+func (s *KVStore) Save(params Params, from int, blocks []*block.Block) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if from < 0 || from > s.meta.Blocks {
+		return fmt.Errorf("can't save blocks from height %d in a store of %d", from, s.meta.Blocks)
+	}
+
+	var batch kv.Batch
+	meta := storeMeta{Params: params, Blocks: from + len(blocks)}
+	for height := meta.Blocks; height < s.meta.Blocks; height++ {
+		batch.Delete(blockKey(height))
+		batch.Delete(hashKey(height))
+	}
+	for i, b := range blocks {
+		data, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+		batch.Put(blockKey(from+i), data)
+		batch.Put(hashKey(from+i), []byte(b.Hash))
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	batch.Put(metaKey, data)
+
+	if err := s.db.Write(&batch); err != nil {
+		return err
+	}
+	s.meta = meta
+	return nil
+}
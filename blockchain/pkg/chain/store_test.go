@@ -0,0 +1,162 @@
+package chain
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/kv"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+// saveRecorder is a Store noting the heights each Save starts from and how
+// many blocks it writes
+type saveRecorder struct {
+	Store
+	saves [][2]int
+}
+
+func (r *saveRecorder) Save(params Params, from int, blocks []*block.Block) error {
+	r.saves = append(r.saves, [2]int{from, len(blocks)})
+	return r.Store.Save(params, from, blocks)
+}
+
+// openStore opens a block store in a temporary directory, closing it when
+// the test ends
+func openStore(t *testing.T, path string) *KVStore {
+	t.Helper()
+	s, err := OpenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestStoreSavesIncrementally(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chain.db")
+	s := &saveRecorder{Store: openStore(t, path)}
+	if _, err := Load(s); !errors.Is(err, ErrEmptyStore) {
+		t.Fatalf("expected ErrEmptyStore from a new store, got %v", err)
+	}
+
+	c := New(1, 10.0)
+	if err := c.SetEmission(Emission{HalvingInterval: 100}); err != nil {
+		t.Fatal(err)
+	}
+	w, _ := wallet.New()
+	fundAddresses(c, w.Address(), "bob")
+	if err := c.SaveTo(s); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := transaction.New(w.Address(), "carol", 4.0)
+	tx.Sign(w.PrivateKey)
+	c.AddBlock([]*transaction.Transaction{tx}, "miner")
+	if err := c.SaveTo(s); err != nil {
+		t.Fatal(err)
+	}
+	// Saving an unchanged chain writes nothing
+	if err := c.SaveTo(s); err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]int{{0, 3}, {3, 1}}
+	if len(s.saves) != len(want) || s.saves[0] != want[0] || s.saves[1] != want[1] {
+		t.Errorf("expected saves of %v, got %v", want, s.saves)
+	}
+
+	s.Store.(*KVStore).Close()
+	loaded, err := Load(openStore(t, path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Length() != 4 || loaded.GetLatestBlock().Hash != c.GetLatestBlock().Hash {
+		t.Errorf("expected the 4-block chain back, got %d blocks", loaded.Length())
+	}
+	if !loaded.Emission.Equal(c.Emission) || loaded.Difficulty != 1 || loaded.MiningReward != 10.0 {
+		t.Errorf("expected the chain's settings back, got %+v", loaded)
+	}
+	if loaded.GetBalance("carol") != 4.0 || loaded.GetBalance(w.Address()) != 6.0 {
+		t.Errorf("expected balances to be rebuilt, got carol %.2f", loaded.GetBalance("carol"))
+	}
+}
+
+func TestStoreSavesFromFork(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chain.db")
+	s := &saveRecorder{Store: openStore(t, path)}
+	c := New(1, 10.0)
+	fundAddresses(c, "alice", "bob", "carol")
+	if err := c.SaveTo(s); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace the last two blocks with a longer branch of three
+	if err := c.Truncate(2); err != nil {
+		t.Fatal(err)
+	}
+	fundAddresses(c, "dave", "erin", "frank")
+	if err := c.SaveTo(s); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.saves[len(s.saves)-1]; got != [2]int{2, 3} {
+		t.Errorf("expected the save to start from the fork at 2 and write 3 blocks, got %v", got)
+	}
+
+	// and cut it back
+	if err := c.Truncate(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SaveTo(s); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.saves[len(s.saves)-1]; got != [2]int{3, 0} {
+		t.Errorf("expected truncating to save nothing from 3, got %v", got)
+	}
+
+	loaded, err := Load(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Length() != 3 || loaded.GetLatestBlock().Hash != c.GetLatestBlock().Hash {
+		t.Errorf("expected the 3-block chain back, got %d blocks", loaded.Length())
+	}
+	if loaded.GetBalance("dave") != 10.0 || loaded.GetBalance("erin") != 0 || loaded.GetBalance("carol") != 0 {
+		t.Error("expected balances from the branch kept")
+	}
+	if _, err := s.Block(3); err == nil {
+		t.Error("expected blocks past the saved length to be gone")
+	}
+}
+
+func TestStoreUndecodableBlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chain.db")
+	s := openStore(t, path)
+	c := New(1, 10.0)
+	fundAddresses(c, "alice", "bob")
+	if err := c.SaveTo(s); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	db, err := kv.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put(blockKey(1), []byte(`{"index": "garbage"}`)); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	s = openStore(t, path)
+	if _, err := s.Block(1); err == nil {
+		t.Error("expected a garbled block not to decode")
+	}
+	if _, err := Load(s); err == nil {
+		t.Error("expected a chain with a garbled block not to load")
+	}
+	if hash, err := s.Hash(1); err != nil || hash != c.Blocks[1].Hash {
+		t.Errorf("expected block 1's hash to still be readable, got %q, %v", hash, err)
+	}
+}
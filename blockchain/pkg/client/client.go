@@ -0,0 +1,346 @@
+// Package client talks to a running node over its HTTP API
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+	"github.com/oksmith/home-server/blockchain/pkg/node"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+)
+
+// DefaultTimeout bounds each request unless the caller's context is shorter
+const DefaultTimeout = 30 * time.Second
+
+// Error is a non-2xx response from the node
+type Error struct {
+	Status  int
+	Code    string // machine-readable code, for endpoints that return one
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("node returned %d (%s): %s", e.Status, e.Code, e.Message)
+	}
+	return fmt.Sprintf("node returned %d: %s", e.Status, e.Message)
+}
+
+// IsNotFound reports whether err is a 404 from the node
+func IsNotFound(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound
+}
+
+// Client calls one node's versioned API
+type Client struct {
+	baseURL    string
+	http       *http.Client
+	adminToken string
+}
+
+// New creates a client for the node at address, either host:port or a full
+// http(s) URL
+func New(address string) *Client {
+	base := strings.TrimRight(address, "/")
+	if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+	return &Client{
+		baseURL: base + node.APIPrefix,
+		http:    &http.Client{Timeout: DefaultTimeout},
+	}
+}
+
+// SetHTTPClient replaces the client used for requests, for example to route
+// them to an in-process handler in tests
+func (c *Client) SetHTTPClient(client *http.Client) {
+	c.http = client
+}
+
+// SetAdminToken sends token as the bearer token the node's admin endpoints
+// require
+func (c *Client) SetAdminToken(token string) {
+	c.adminToken = token
+}
+
+// Status returns the node's status summary
+func (c *Client) Status(ctx context.Context) (node.Status, error) {
+	var st node.Status
+	err := c.getJSON(ctx, "/status", nil, &st)
+	return st, err
+}
+
+// Balance returns an address's confirmed balance
+func (c *Client) Balance(ctx context.Context, address string) (float64, error) {
+	var resp struct {
+		Balance float64 `json:"balance"`
+	}
+	err := c.getJSON(ctx, "/balance", url.Values{"address": {address}}, &resp)
+	return resp.Balance, err
+}
+
+// Transaction looks up a confirmed or pending transaction by ID
+func (c *Client) Transaction(ctx context.Context, id string) (node.TxInfo, error) {
+	var info node.TxInfo
+	err := c.getJSON(ctx, "/tx", url.Values{"id": {id}}, &info)
+	return info, err
+}
+
+// SubmitTransaction sends a signed transaction to the node's mempool. A
+// rejection returns the node's response along with an *Error carrying its code.
+func (c *Client) SubmitTransaction(ctx context.Context, tx *transaction.Transaction) (node.TransactionResponse, error) {
+	body, err := json.Marshal(tx)
+	if err != nil {
+		return node.TransactionResponse{}, err
+	}
+
+	// Rejections come back as a TransactionResponse too, so keep the body whatever the status
+	resp, err := c.send(ctx, http.MethodPost, "/transaction", nil, bytes.NewReader(body))
+	if err != nil {
+		return node.TransactionResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var result node.TransactionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return result, &Error{Status: resp.StatusCode, Message: fmt.Sprintf("invalid response: %v", err)}
+	}
+	if result.Error != nil {
+		return result, &Error{Status: resp.StatusCode, Code: result.Error.Code, Message: result.Error.Message}
+	}
+	return result, nil
+}
+
+// RecentBlocks returns the newest block headers, newest first
+func (c *Client) RecentBlocks(ctx context.Context, limit int) ([]block.Header, error) {
+	var headers []block.Header
+	err := c.getJSON(ctx, "/blocks", url.Values{"limit": {strconv.Itoa(limit)}}, &headers)
+	return headers, err
+}
+
+// Headers returns the headers of the node's blocks from index from onwards
+func (c *Client) Headers(ctx context.Context, from int64) ([]block.Header, error) {
+	var headers []block.Header
+	err := c.getJSON(ctx, "/headers", url.Values{"from": {strconv.FormatInt(from, 10)}}, &headers)
+	return headers, err
+}
+
+// BlockByHeight returns the block at a height on the node's chain
+func (c *Client) BlockByHeight(ctx context.Context, height int64) (*block.Block, error) {
+	var b block.Block
+	err := c.getJSON(ctx, "/blocks/get", url.Values{"height": {strconv.FormatInt(height, 10)}}, &b)
+	return &b, err
+}
+
+// BlockRange returns up to limit blocks from height from onwards, oldest
+// first. Nodes cap limit at 500.
+func (c *Client) BlockRange(ctx context.Context, from int64, limit int) ([]*block.Block, error) {
+	var blocks []*block.Block
+	query := url.Values{"from": {strconv.FormatInt(from, 10)}, "limit": {strconv.Itoa(limit)}}
+	err := c.getJSON(ctx, "/blocks/range", query, &blocks)
+	return blocks, err
+}
+
+// BlockByHash returns a block on the node's chain by its hash
+func (c *Client) BlockByHash(ctx context.Context, hash string) (*block.Block, error) {
+	var b block.Block
+	err := c.getJSON(ctx, "/blocks/get", url.Values{"hash": {hash}}, &b)
+	return &b, err
+}
+
+// Proofs returns the confirmed transactions sent or received by address in
+// blocks from height from onwards, each with its inclusion proof
+func (c *Client) Proofs(ctx context.Context, address string, from int64) ([]chain.ProvenTx, error) {
+	var proven []chain.ProvenTx
+	query := url.Values{"address": {address}, "from": {strconv.FormatInt(from, 10)}}
+	err := c.getJSON(ctx, "/proofs", query, &proven)
+	return proven, err
+}
+
+// Mempool returns up to limit pending transactions, next to be mined first
+func (c *Client) Mempool(ctx context.Context, limit int) ([]*transaction.Transaction, error) {
+	var txs []*transaction.Transaction
+	err := c.getJSON(ctx, "/mempool", url.Values{"limit": {strconv.Itoa(limit)}}, &txs)
+	return txs, err
+}
+
+// Peers returns the node's peer addresses
+func (c *Client) Peers(ctx context.Context) ([]string, error) {
+	var peers []string
+	err := c.getJSON(ctx, "/peers", nil, &peers)
+	return peers, err
+}
+
+// Mine asks the node to mine one block from its mempool
+func (c *Client) Mine(ctx context.Context) error {
+	return c.post(ctx, "/mine")
+}
+
+// Generate mines blocks straight away on a regtest node and returns their
+// hashes
+func (c *Client) Generate(ctx context.Context, blocks int) ([]string, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/generate", url.Values{"blocks": {strconv.Itoa(blocks)}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Hashes []string `json:"hashes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid response from /generate: %w", err)
+	}
+	return result.Hashes, nil
+}
+
+// StartMining starts the node's continuous mining loop with its default interval
+func (c *Client) StartMining(ctx context.Context) error {
+	return c.post(ctx, "/mining/start")
+}
+
+// StopMining stops the node's continuous mining loop
+func (c *Client) StopMining(ctx context.Context) error {
+	return c.post(ctx, "/mining/stop")
+}
+
+// Faucet asks a regtest node to pay amount to address from its wallet and
+// mine the payment into a block
+func (c *Client) Faucet(ctx context.Context, address string, amount float64) (node.FaucetResult, error) {
+	var result node.FaucetResult
+	query := url.Values{"address": {address}, "amount": {strconv.FormatFloat(amount, 'f', -1, 64)}}
+	resp, err := c.do(ctx, http.MethodPost, "/faucet", query, nil)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return result, fmt.Errorf("invalid response from /faucet: %w", err)
+	}
+	return result, nil
+}
+
+// Alerts returns the node's alert rules, oldest first. Where each notifies is
+// only filled in with the admin token.
+func (c *Client) Alerts(ctx context.Context) ([]node.Alert, error) {
+	var alerts []node.Alert
+	err := c.getJSON(ctx, "/alerts", nil, &alerts)
+	return alerts, err
+}
+
+// AddAlert registers an alert rule on the node, which needs the admin token
+func (c *Client) AddAlert(ctx context.Context, req node.AlertRequest) (node.Alert, error) {
+	var a node.Alert
+	body, err := json.Marshal(req)
+	if err != nil {
+		return a, err
+	}
+	resp, err := c.do(ctx, http.MethodPost, "/alerts", nil, bytes.NewReader(body))
+	if err != nil {
+		return a, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&a); err != nil {
+		return a, fmt.Errorf("invalid response from /alerts: %w", err)
+	}
+	return a, nil
+}
+
+// RemoveAlert deletes an alert rule from the node, which needs the admin token
+func (c *Client) RemoveAlert(ctx context.Context, id string) error {
+	resp, err := c.do(ctx, http.MethodDelete, "/alerts", url.Values{"id": {id}}, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Chain downloads the node's full chain and validates it
+func (c *Client) Chain(ctx context.Context) (*chain.Chain, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/chain", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return chain.Decode(resp.Body, 0)
+}
+
+// ExportChain streams the node's gzip-compressed chain snapshot to w
+func (c *Client) ExportChain(ctx context.Context, w io.Writer) error {
+	resp, err := c.do(ctx, http.MethodGet, "/chain/export", nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// getJSON GETs a path and decodes the JSON response into v
+func (c *Client) getJSON(ctx context.Context, path string, query url.Values, v any) error {
+	resp, err := c.do(ctx, http.MethodGet, path, query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", path, err)
+	}
+	return nil
+}
+
+// post sends an empty POST to a path, discarding the response body
+func (c *Client) post(ctx context.Context, path string) error {
+	resp, err := c.do(ctx, http.MethodPost, path, nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// do sends a request and turns responses other than 2xx into an *Error
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Response, error) {
+	resp, err := c.send(ctx, method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return nil, &Error{Status: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+}
+
+// send sends a request and returns whatever response comes back
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Response, error) {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.adminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.adminToken)
+	}
+
+	return c.http.Do(req)
+}
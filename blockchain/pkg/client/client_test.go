@@ -0,0 +1,209 @@
+package client
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/node"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+// startNode serves a fresh node and returns it with a client pointed at it
+func startNode(t *testing.T) (*node.Node, *Client) {
+	t.Helper()
+	n, err := node.New("localhost:9000", 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	srv := httptest.NewServer(n.Handler())
+	t.Cleanup(srv.Close)
+	return n, New(srv.URL)
+}
+
+func TestStatusAndBalance(t *testing.T) {
+	n, c := startNode(t)
+	n.Mine()
+
+	st, err := c.Status(t.Context())
+	if err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+	if st.Height != 1 || st.WalletAddress != n.Wallet.Address() {
+		t.Errorf("unexpected status %+v", st)
+	}
+
+	balance, err := c.Balance(t.Context(), n.Wallet.Address())
+	if err != nil || balance != 10 {
+		t.Errorf("expected balance 10, got %v, %v", balance, err)
+	}
+}
+
+func TestSubmitAndLookUpTransaction(t *testing.T) {
+	_, c := startNode(t)
+	w, _ := wallet.New()
+
+	tx := transaction.New(w.Address(), "bob", 5.0)
+	tx.Sign(w.PrivateKey)
+	resp, err := c.SubmitTransaction(t.Context(), tx)
+	if err != nil || !resp.Accepted || resp.TxID != tx.ID {
+		t.Fatalf("expected transaction to be accepted, got %+v, %v", resp, err)
+	}
+
+	info, err := c.Transaction(t.Context(), tx.ID)
+	if err != nil || info.Status != "pending" {
+		t.Errorf("expected pending transaction, got %+v, %v", info, err)
+	}
+
+	if _, err := c.Transaction(t.Context(), "missing"); !IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
+
+func TestSubmitTransactionRejected(t *testing.T) {
+	_, c := startNode(t)
+
+	resp, err := c.SubmitTransaction(t.Context(), transaction.New("alice", "bob", 5.0))
+	apiErr, ok := err.(*Error)
+	if !ok || apiErr.Code != node.ErrCodeInvalidTransaction || resp.Accepted {
+		t.Errorf("expected an invalid_transaction error, got %+v, %v", resp, err)
+	}
+}
+
+func TestChainAndExport(t *testing.T) {
+	n, c := startNode(t)
+	n.Mine()
+
+	got, err := c.Chain(t.Context())
+	if err != nil {
+		t.Fatalf("chain failed: %v", err)
+	}
+	if got.Length() != 2 || got.GetLatestBlock().Hash != n.Chain.GetLatestBlock().Hash {
+		t.Errorf("expected the node's 2-block chain, got %d blocks", got.Length())
+	}
+
+	var snapshot bytes.Buffer
+	if err := c.ExportChain(t.Context(), &snapshot); err != nil || snapshot.Len() == 0 {
+		t.Errorf("expected a snapshot, got %d bytes, %v", snapshot.Len(), err)
+	}
+}
+
+func TestBlocksAndMining(t *testing.T) {
+	n, c := startNode(t)
+
+	if err := c.Mine(t.Context()); err != nil {
+		t.Fatalf("mine failed: %v", err)
+	}
+	headers, err := c.RecentBlocks(t.Context(), 10)
+	if err != nil || len(headers) != 2 || headers[0].Index != 1 {
+		t.Fatalf("expected 2 headers, newest first, got %+v, %v", headers, err)
+	}
+
+	all, err := c.Headers(t.Context(), 1)
+	if err != nil || len(all) != 1 || all[0].Hash != headers[0].Hash {
+		t.Errorf("expected headers from 1 to hold just block 1, got %+v, %v", all, err)
+	}
+
+	byHeight, err := c.BlockByHeight(t.Context(), 1)
+	if err != nil || byHeight.Hash != headers[0].Hash {
+		t.Errorf("expected block 1 by height, got %v", err)
+	}
+	byHash, err := c.BlockByHash(t.Context(), headers[1].Hash)
+	if err != nil || byHash.Index != 0 {
+		t.Errorf("expected genesis by hash, got %v", err)
+	}
+	if _, err := c.BlockByHeight(t.Context(), 5); !IsNotFound(err) {
+		t.Errorf("expected not found past the tip, got %v", err)
+	}
+
+	blocks, err := c.BlockRange(t.Context(), 0, 10)
+	if err != nil || len(blocks) != 2 || blocks[1].Hash != headers[0].Hash {
+		t.Errorf("expected both blocks oldest first, got %v", err)
+	}
+	if blocks, err := c.BlockRange(t.Context(), 5, 10); err != nil || len(blocks) != 0 {
+		t.Errorf("expected no blocks past the tip, got %d, %v", len(blocks), err)
+	}
+
+	if err := c.StartMining(t.Context()); err != nil {
+		t.Fatalf("start mining failed: %v", err)
+	}
+	if st, _ := c.Status(t.Context()); !st.Mining.Enabled {
+		t.Error("expected mining to be enabled")
+	}
+	if err := c.StopMining(t.Context()); err != nil || n.MiningEnabled() {
+		t.Errorf("expected mining to stop, got %v", err)
+	}
+}
+
+func TestFaucet(t *testing.T) {
+	n, c := startNode(t)
+	if _, err := c.Faucet(t.Context(), "alice", 5); err == nil {
+		t.Error("expected the faucet to be refused outside regtest")
+	}
+
+	n.EnableRegtest()
+	result, err := c.Faucet(t.Context(), "alice", 5)
+	if err != nil || result.TxID == "" || result.Height != 2 {
+		t.Fatalf("expected a payment confirmed at height 2, got %+v, %v", result, err)
+	}
+	if balance, _ := c.Balance(t.Context(), "alice"); balance != 5 {
+		t.Errorf("expected alice to have 5, got %v", balance)
+	}
+
+	proven, err := c.Proofs(t.Context(), "alice", 0)
+	if err != nil || len(proven) != 1 || proven[0].Tx.ID != result.TxID {
+		t.Fatalf("expected a proof of the payment, got %+v, %v", proven, err)
+	}
+	b, err := c.BlockByHeight(t.Context(), proven[0].Height)
+	if err != nil || !proven[0].Proof.Verify(b.Header(), result.TxID) {
+		t.Errorf("expected the proof to check out against block %d, got %v", proven[0].Height, err)
+	}
+	if proven, _ := c.Proofs(t.Context(), "alice", 3); len(proven) != 0 {
+		t.Errorf("expected no proofs past the payment, got %+v", proven)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	n, c := startNode(t)
+	if _, err := c.Generate(t.Context(), 1); err == nil {
+		t.Error("expected generate to be refused outside regtest")
+	}
+
+	n.EnableRegtest()
+	hashes, err := c.Generate(t.Context(), 3)
+	if err != nil || len(hashes) != 3 || n.Chain.GetLatestBlock().Hash != hashes[2] {
+		t.Errorf("expected 3 blocks ending at the tip, got %v, %v", hashes, err)
+	}
+}
+
+func TestAlerts(t *testing.T) {
+	n, c := startNode(t)
+	n.SetAdminToken("secret")
+	rule := "balance(" + n.Wallet.Address() + ") < 5"
+
+	webhook := node.AlertRequest{Rule: rule, Notify: node.NotifyWebhook, URL: "http://phone.lan/hook"}
+	if _, err := c.AddAlert(t.Context(), webhook); err == nil {
+		t.Error("expected adding an alert to need the admin token")
+	}
+	c.SetAdminToken("secret")
+	a, err := c.AddAlert(t.Context(), webhook)
+	if err != nil || a.ID == "" || a.Rule != rule {
+		t.Fatalf("expected the alert to be added, got %+v, %v", a, err)
+	}
+	command := node.AlertRequest{Rule: rule, Notify: node.NotifyCommand, Command: "true"}
+	if _, err := c.AddAlert(t.Context(), command); err != nil {
+		t.Errorf("expected a command alert with the admin token, got %v", err)
+	}
+
+	alerts, err := c.Alerts(t.Context())
+	if err != nil || len(alerts) != 2 || alerts[0].ID != a.ID || alerts[0].URL != webhook.URL {
+		t.Errorf("expected 2 alerts, got %+v, %v", alerts, err)
+	}
+	if err := c.RemoveAlert(t.Context(), a.ID); err != nil {
+		t.Errorf("remove failed: %v", err)
+	}
+	if err := c.RemoveAlert(t.Context(), a.ID); !IsNotFound(err) {
+		t.Errorf("expected a second remove to 404, got %v", err)
+	}
+}
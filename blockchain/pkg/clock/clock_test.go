@@ -0,0 +1,35 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestManual(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewManual(start)
+	if !c.Now().Equal(start) {
+		t.Fatalf("Now() = %v, want %v", c.Now(), start)
+	}
+	if got := c.Advance(time.Minute); !got.Equal(start.Add(time.Minute)) || !c.Now().Equal(got) {
+		t.Errorf("Advance(1m) = %v, Now() = %v", got, c.Now())
+	}
+	c.Set(start.Add(-time.Hour))
+	if !c.Now().Equal(start.Add(-time.Hour)) {
+		t.Errorf("after Set, Now() = %v", c.Now())
+	}
+}
+
+func TestOrSystem(t *testing.T) {
+	if OrSystem(nil) != System {
+		t.Error("nil clock didn't fall back to System")
+	}
+	m := NewManual(time.Time{})
+	if OrSystem(m) != m {
+		t.Error("a set clock was replaced")
+	}
+	before := time.Now()
+	if now := OrSystem(nil).Now(); now.Before(before) {
+		t.Errorf("System.Now() = %v, earlier than %v", now, before)
+	}
+}
@@ -0,0 +1,417 @@
+// Package kv is a small embedded key-value store kept in a single
+// append-only file, for data that changes a little at a time and must
+// survive a crash.
+//
+// Every write appends one frame to the file: a checksum, a length and a batch
+// of puts and deletes, applied all or nothing. Opening the file replays the
+// frames to index where each live value sits; values themselves are only read
+// when asked for. A frame cut short by a crash mid-write is dropped on open.
+// Once superseded writes make up over half the file, it is rewritten without
+// them.
+package kv
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// ErrNotFound is returned by Get for a key that has no value
+var ErrNotFound = errors.New("key not found")
+
+// ErrCorrupt is wrapped by the error Damaged returns for a file whose frames
+// stop making sense before its end
+var ErrCorrupt = errors.New("store is corrupt")
+
+// compactMin is how many superseded bytes a file must hold before it is
+// worth rewriting
+const compactMin = 1 << 20
+
+// frameHeader is the checksum and length in front of every frame
+const frameHeader = 8
+
+// maxFrame caps a frame's length, so a damaged length can't make Open
+// allocate gigabytes
+const maxFrame = 1 << 30
+
+const (
+	opPut byte = iota + 1
+	opDelete
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// location is where a live value sits in the file
+type location struct {
+	offset int64
+	size   int
+	span   int // bytes its put takes up in the frame, key and all
+}
+
+// DB is an open store. It is safe for concurrent use, but only one DB
+// should have a file open at a time.
+type DB struct {
+	mu      sync.RWMutex
+	path    string
+	f       *os.File
+	index   map[string]location
+	size    int64 // bytes of valid frames, where the next one is written
+	garbage int64 // bytes of puts and deletes since superseded
+	damaged error // the frame replay stopped at, if it wasn't a torn tail
+}
+
+// Open opens the store in path, creating it if it doesn't exist. A file
+// damaged partway through opens with what came before the damage, reported
+// by Damaged; writes are refused until Repair.
+func Open(path string) (*DB, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{path: path, f: f, index: make(map[string]location)}
+	if err := db.replay(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// replay indexes the frames in the file, stopping at the first bad one
+func (db *DB) replay() error {
+	info, err := db.f.Stat()
+	if err != nil {
+		return err
+	}
+	end := info.Size()
+
+	r := bufio.NewReader(io.NewSectionReader(db.f, 0, end))
+	var header [frameHeader]byte
+	for db.size < end {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			break // torn header
+		}
+		sum := binary.LittleEndian.Uint32(header[:4])
+		length := int64(binary.LittleEndian.Uint32(header[4:]))
+		if length > maxFrame {
+			db.damaged = fmt.Errorf("%w: frame at offset %d claims %d bytes", ErrCorrupt, db.size, length)
+			return nil
+		}
+		if db.size+frameHeader+length > end {
+			break // torn body
+		}
+		frame := make([]byte, length)
+		if _, err := io.ReadFull(r, frame); err != nil {
+			return err
+		}
+		if crc32.Checksum(frame, crcTable) != sum {
+			db.damaged = fmt.Errorf("%w: frame at offset %d fails its checksum", ErrCorrupt, db.size)
+			return nil
+		}
+		if err := db.apply(frame, db.size+frameHeader); err != nil {
+			db.damaged = fmt.Errorf("%w: frame at offset %d: %v", ErrCorrupt, db.size, err)
+			return nil
+		}
+		db.size += frameHeader + length
+	}
+
+	// Drop a frame a crash left half written, so the next one follows on
+	if db.size < end {
+		return db.f.Truncate(db.size)
+	}
+	return nil
+}
+
+// apply indexes the operations in a frame whose body starts at offset
+func (db *DB) apply(frame []byte, offset int64) error {
+	ops, err := decodeOps(frame)
+	if err != nil {
+		return err
+	}
+	for _, op := range ops {
+		if old, ok := db.index[op.key]; ok {
+			db.garbage += int64(old.span)
+			delete(db.index, op.key)
+		}
+		if op.kind == opPut {
+			db.index[op.key] = location{offset: offset + int64(op.valueAt), size: len(op.value), span: op.span}
+		} else {
+			db.garbage += int64(op.span)
+		}
+	}
+	return nil
+}
+
+// Damaged returns why replaying the file stopped early, or nil if all of it
+// was read. The error wraps ErrCorrupt.
+func (db *DB) Damaged() error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.damaged
+}
+
+// Repair cuts a damaged file back to the frames before the damage, losing
+// the rest, so the store can be written again
+func (db *DB) Repair() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.damaged == nil {
+		return nil
+	}
+	if err := db.f.Truncate(db.size); err != nil {
+		return err
+	}
+	if err := db.f.Sync(); err != nil {
+		return err
+	}
+	db.damaged = nil
+	return nil
+}
+
+// Get returns the value of key, read from the file
+func (db *DB) Get(key string) ([]byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	loc, ok := db.index[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	value := make([]byte, loc.size)
+	if _, err := db.f.ReadAt(value, loc.offset); err != nil {
+		return nil, fmt.Errorf("failed to read %q: %w", key, err)
+	}
+	return value, nil
+}
+
+// Has reports whether key has a value
+func (db *DB) Has(key string) bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	_, ok := db.index[key]
+	return ok
+}
+
+// Len returns how many keys have values
+func (db *DB) Len() int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return len(db.index)
+}
+
+// Put sets key to value
+func (db *DB) Put(key string, value []byte) error {
+	var b Batch
+	b.Put(key, value)
+	return db.Write(&b)
+}
+
+// Delete removes key
+func (db *DB) Delete(key string) error {
+	var b Batch
+	b.Delete(key)
+	return db.Write(&b)
+}
+
+// Write applies a batch as one frame, synced to disk before returning. A
+// crash leaves either all of the batch or none of it.
+func (db *DB) Write(b *Batch) error {
+	if len(b.ops) == 0 {
+		return nil
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.damaged != nil {
+		return db.damaged
+	}
+
+	body := encodeOps(b.ops)
+	if len(body) > maxFrame {
+		return fmt.Errorf("batch of %d bytes is too large", len(body))
+	}
+	frame := make([]byte, frameHeader, frameHeader+len(body))
+	binary.LittleEndian.PutUint32(frame[:4], crc32.Checksum(body, crcTable))
+	binary.LittleEndian.PutUint32(frame[4:], uint32(len(body)))
+	frame = append(frame, body...)
+
+	if _, err := db.f.WriteAt(frame, db.size); err != nil {
+		// Leave nothing half written for the next frame to follow, or if
+		// that fails too, refuse writes until Repair gets rid of it
+		if terr := db.f.Truncate(db.size); terr != nil {
+			db.damaged = fmt.Errorf("%w: a failed write at offset %d couldn't be cut back: %v", ErrCorrupt, db.size, terr)
+		}
+		return err
+	}
+	if err := db.f.Sync(); err != nil {
+		return err
+	}
+	if err := db.apply(body, db.size+frameHeader); err != nil {
+		return err
+	}
+	db.size += int64(len(frame))
+
+	if db.garbage > compactMin && db.garbage > db.size/2 {
+		return db.compact()
+	}
+	return nil
+}
+
+// Compact rewrites the file with only the live values
+func (db *DB) Compact() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.damaged != nil {
+		return db.damaged
+	}
+	return db.compact()
+}
+
+// compact is Compact for callers holding the lock. The new file replaces
+// the old by rename, so a crash leaves one or the other.
+func (db *DB) compact() error {
+	var b Batch
+	for key, loc := range db.index {
+		value := make([]byte, loc.size)
+		if _, err := db.f.ReadAt(value, loc.offset); err != nil {
+			return fmt.Errorf("failed to read %q: %w", key, err)
+		}
+		b.Put(key, value)
+	}
+
+	tmp := db.path + ".compact"
+	os.Remove(tmp)
+	fresh, err := Open(tmp)
+	if err != nil {
+		return err
+	}
+	if err := fresh.Write(&b); err != nil {
+		fresh.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, db.path); err != nil {
+		fresh.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	db.f.Close()
+	db.f, db.index, db.size, db.garbage = fresh.f, fresh.index, fresh.size, 0
+	// Until the directory is synced, a crash could bring the old file back
+	// after writes to the new one
+	return syncDir(filepath.Dir(db.path))
+}
+
+// syncDir makes a rename in dir durable. Windows can't sync a directory, and
+// makes renames durable by itself.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Size returns how many bytes the file holds
+func (db *DB) Size() int64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.size
+}
+
+// Close closes the file
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.f.Close()
+}
+
+// Batch collects puts and deletes to apply together
+type Batch struct {
+	ops []op
+}
+
+type op struct {
+	kind    byte
+	key     string
+	value   []byte
+	valueAt int // offset of the value within its frame, when decoded
+	span    int // bytes the operation takes up in its frame, when decoded
+}
+
+// Put sets key to value when the batch is written
+func (b *Batch) Put(key string, value []byte) {
+	b.ops = append(b.ops, op{kind: opPut, key: key, value: value})
+}
+
+// Delete removes key when the batch is written
+func (b *Batch) Delete(key string) {
+	b.ops = append(b.ops, op{kind: opDelete, key: key})
+}
+
+// Len returns how many operations the batch holds
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// encodeOps lays out a frame body: for each operation its kind, then its key
+// and, for puts, its value, both prefixed by their length as a uvarint
+func encodeOps(ops []op) []byte {
+	var buf []byte
+	for _, o := range ops {
+		buf = append(buf, o.kind)
+		buf = binary.AppendUvarint(buf, uint64(len(o.key)))
+		buf = append(buf, o.key...)
+		if o.kind == opPut {
+			buf = binary.AppendUvarint(buf, uint64(len(o.value)))
+			buf = append(buf, o.value...)
+		}
+	}
+	return buf
+}
+
+func decodeOps(frame []byte) ([]op, error) {
+	var ops []op
+	pos := 0
+	field := func() ([]byte, int, error) {
+		n, size := binary.Uvarint(frame[pos:])
+		if size <= 0 || n > uint64(len(frame)-pos-size) {
+			return nil, 0, errors.New("truncated field")
+		}
+		start := pos + size
+		pos = start + int(n)
+		return frame[start:pos], start, nil
+	}
+
+	for pos < len(frame) {
+		start := pos
+		kind := frame[pos]
+		pos++
+		key, _, err := field()
+		if err != nil {
+			return nil, err
+		}
+		o := op{kind: kind, key: string(key)}
+		switch kind {
+		case opPut:
+			if o.value, o.valueAt, err = field(); err != nil {
+				return nil, err
+			}
+		case opDelete:
+		default:
+			return nil, fmt.Errorf("unknown operation %d", kind)
+		}
+		o.span = pos - start
+		ops = append(ops, o)
+	}
+	return ops, nil
+}
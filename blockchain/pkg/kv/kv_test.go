@@ -0,0 +1,256 @@
+package kv
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// open opens a store in a temporary directory, closing it when the test ends
+func open(t *testing.T, path string) *DB {
+	t.Helper()
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// want checks key holds value, or has none if value is nil
+func want(t *testing.T, db *DB, key string, value []byte) {
+	t.Helper()
+	got, err := db.Get(key)
+	if value == nil {
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) = %q, %v; want ErrNotFound", key, got, err)
+		}
+		return
+	}
+	if err != nil || !bytes.Equal(got, value) {
+		t.Errorf("Get(%q) = %q, %v; want %q", key, got, err, value)
+	}
+}
+
+func TestPutGetDelete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := open(t, path)
+
+	if err := db.Put("a", []byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("b", []byte("two")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("a", []byte("three")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+	want(t, db, "a", []byte("three"))
+	want(t, db, "b", nil)
+	if db.Len() != 1 || !db.Has("a") || db.Has("b") {
+		t.Errorf("expected only a to be set, got %d keys", db.Len())
+	}
+
+	// Empty values and batches are fine
+	if err := db.Put("empty", nil); err != nil {
+		t.Fatal(err)
+	}
+	want(t, db, "empty", []byte{})
+	if err := db.Write(&Batch{}); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Close()
+	reopened := open(t, path)
+	want(t, reopened, "a", []byte("three"))
+	want(t, reopened, "b", nil)
+	want(t, reopened, "empty", []byte{})
+}
+
+func TestBatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := open(t, path)
+	if err := db.Put("gone", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+
+	var b Batch
+	b.Put("a", []byte("1"))
+	b.Put("b", []byte("2"))
+	b.Delete("gone")
+	b.Put("a", []byte("later"))
+	if err := db.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	want(t, db, "a", []byte("later"))
+	want(t, db, "b", []byte("2"))
+	want(t, db, "gone", nil)
+}
+
+func TestTornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := open(t, path)
+	if err := db.Put("kept", []byte("yes")); err != nil {
+		t.Fatal(err)
+	}
+	size := db.Size()
+	var b Batch
+	b.Put("a", []byte("1"))
+	b.Put("b", []byte("2"))
+	if err := db.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// A crash partway through the batch leaves some of its frame behind
+	if err := os.Truncate(path, size+5); err != nil {
+		t.Fatal(err)
+	}
+	db = open(t, path)
+	if err := db.Damaged(); err != nil {
+		t.Errorf("expected a torn write not to count as damage, got %v", err)
+	}
+	want(t, db, "kept", []byte("yes"))
+	want(t, db, "a", nil)
+	want(t, db, "b", nil)
+	if db.Size() != size {
+		t.Errorf("expected the torn frame to be dropped, leaving %d bytes, got %d", size, db.Size())
+	}
+
+	// and the next write carries on from the last whole frame
+	if err := db.Put("c", []byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	db = open(t, path)
+	want(t, db, "kept", []byte("yes"))
+	want(t, db, "c", []byte("3"))
+}
+
+func TestDamaged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := open(t, path)
+	for _, kv := range [][2]string{{"a", "first"}, {"b", "second"}, {"c", "third"}} {
+		if err := db.Put(kv[0], []byte(kv[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[bytes.Index(data, []byte("second"))] ^= 0xff
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db = open(t, path)
+	if err := db.Damaged(); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected a flipped byte to be found, got %v", err)
+	}
+	want(t, db, "a", []byte("first"))
+	want(t, db, "b", nil)
+	want(t, db, "c", nil)
+	if err := db.Put("d", []byte("x")); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("expected writes to a damaged store to be refused, got %v", err)
+	}
+
+	if err := db.Repair(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("d", []byte("fourth")); err != nil {
+		t.Fatalf("expected a repaired store to take writes: %v", err)
+	}
+	db.Close()
+	db = open(t, path)
+	if err := db.Damaged(); err != nil {
+		t.Errorf("expected the repaired store to open cleanly, got %v", err)
+	}
+	want(t, db, "a", []byte("first"))
+	want(t, db, "d", []byte("fourth"))
+}
+
+func TestFailedWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := open(t, path)
+	if err := db.Put("a", []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A file that can neither be written nor cut back may now hold part of
+	// a frame, so nothing more may follow it
+	rw := db.f
+	readOnly, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.f = readOnly
+	if err := db.Put("b", []byte("second")); err == nil {
+		t.Fatal("expected the write to fail")
+	}
+	if err := db.Damaged(); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected the store marked damaged, got %v", err)
+	}
+	db.f = rw
+	readOnly.Close()
+	if err := db.Put("c", []byte("third")); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("expected writes refused until Repair, got %v", err)
+	}
+
+	if err := db.Repair(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("c", []byte("third")); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	db = open(t, path)
+	want(t, db, "a", []byte("first"))
+	want(t, db, "b", nil)
+	want(t, db, "c", []byte("third"))
+}
+
+func TestCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := open(t, path)
+	value := bytes.Repeat([]byte("x"), 64<<10)
+
+	// Rewriting one key over and over leaves the file mostly superseded values,
+	// which compaction gets rid of along the way
+	for i := range 64 {
+		value[0] = byte(i)
+		if err := db.Put("key", value); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Put("other", []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if db.Size() > 2*compactMin {
+		t.Errorf("expected the file to have been compacted, but it holds %d bytes", db.Size())
+	}
+	want(t, db, "key", value)
+	want(t, db, "other", []byte{63})
+
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if db.Size() > int64(len(value))+64 {
+		t.Errorf("expected only the live values after Compact, got %d bytes", db.Size())
+	}
+	db.Close()
+
+	db = open(t, path)
+	want(t, db, "key", value)
+	want(t, db, "other", []byte{63})
+	if _, err := os.Stat(path + ".compact"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no compaction file left behind, got %v", err)
+	}
+}
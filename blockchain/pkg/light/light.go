@@ -0,0 +1,307 @@
+package light
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+const (
+	// requestTimeout bounds each request to a full peer
+	requestTimeout = 30 * time.Second
+
+	// maxResponseSize caps how much of a peer response is read
+	maxResponseSize = 16 << 20
+)
+
+// ErrNoPeers is returned when no full peer could be reached
+var ErrNoPeers = errors.New("no full peers reachable")
+
+// Client is a light (SPV) node. It keeps only block headers plus the
+// transactions involving its own wallet, each checked against a header with
+// an inclusion proof from a full peer, so it runs happily on small devices.
+//
+// Headers are checked for linkage and proof-of-work but can't be rehashed
+// without their transactions, and a peer can withhold transactions, so a
+// light client trusts its peers more than a full node does.
+type Client struct {
+	Wallet     *wallet.Wallet
+	Difficulty int
+	peers      []string
+	headers    []block.Header
+	txs        []chain.ProvenTx // verified transactions involving the wallet
+	httpClient *http.Client
+	mu         sync.RWMutex
+	logger     *slog.Logger
+}
+
+// New creates a light client that follows the given full peers
+func New(w *wallet.Wallet, difficulty int, peers []string) *Client {
+	return &Client{
+		Wallet:     w,
+		Difficulty: difficulty,
+		peers:      peers,
+		httpClient: &http.Client{Timeout: requestTimeout},
+		logger:     slog.Default().With("light", w.Address()),
+	}
+}
+
+// Height returns the index of the latest known header, or -1 before the first sync
+func (c *Client) Height() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return int64(len(c.headers)) - 1
+}
+
+// Headers returns the known headers from the given index onwards
+func (c *Client) Headers(from int) []block.Header {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if from < 0 {
+		from = 0
+	}
+	if from >= len(c.headers) {
+		return []block.Header{}
+	}
+	headers := make([]block.Header, len(c.headers)-from)
+	copy(headers, c.headers[from:])
+	return headers
+}
+
+// Transactions returns the verified transactions involving the wallet
+func (c *Client) Transactions() []chain.ProvenTx {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	txs := make([]chain.ProvenTx, len(c.txs))
+	copy(txs, c.txs)
+	return txs
+}
+
+// Balance returns the wallet balance implied by its verified transactions
+func (c *Client) Balance() float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	address := c.Wallet.Address()
+	balance := 0.0
+	for _, p := range c.txs {
+		if p.Tx.To == address {
+			balance += p.Tx.Amount
+		}
+		if p.Tx.From == address {
+			balance -= p.Tx.Total()
+		}
+	}
+	return balance
+}
+
+// Sync catches up with the first reachable peer: new headers, then proofs
+// for the wallet's transactions in the new blocks
+func (c *Client) Sync(ctx context.Context) error {
+	var lastErr error = ErrNoPeers
+	for _, peer := range c.peers {
+		if err := c.syncFrom(ctx, peer); err != nil {
+			c.logger.Warn("light sync failed", "peer", peer, "err", err)
+			lastErr = err
+			continue
+		}
+		return nil
+	}
+	return lastErr
+}
+
+// syncFrom extends (or, after a reorg, replaces) the header chain from one peer
+func (c *Client) syncFrom(ctx context.Context, peer string) error {
+	c.mu.RLock()
+	from := max(len(c.headers)-1, 0)
+	var tip *block.Header
+	if len(c.headers) > 0 {
+		tip = &c.headers[len(c.headers)-1]
+	}
+	c.mu.RUnlock()
+
+	var headers []block.Header
+	if err := c.get(ctx, peer, fmt.Sprintf("/headers?from=%d", from), &headers); err != nil {
+		return err
+	}
+	if len(headers) == 0 {
+		// The peer is behind us
+		return nil
+	}
+
+	// The peer's chain no longer contains our tip, so start over from its genesis
+	reorg := tip != nil && headers[0].Hash != tip.Hash
+	if reorg {
+		from = 0
+		if err := c.get(ctx, peer, "/headers?from=0", &headers); err != nil {
+			return err
+		}
+		if int64(len(headers))-1 <= tip.Index {
+			return fmt.Errorf("peer chain forked from ours and is not longer")
+		}
+	}
+	if err := c.checkHeaders(headers); err != nil {
+		return err
+	}
+	if !reorg && tip != nil && len(headers) == 1 {
+		return nil
+	}
+
+	// Fetch proofs for the blocks we haven't seen before
+	proofsFrom := from
+	if !reorg && tip != nil {
+		proofsFrom = from + 1
+	}
+	var proven []chain.ProvenTx
+	path := fmt.Sprintf("/proofs?address=%s&from=%d", c.Wallet.Address(), proofsFrom)
+	if err := c.get(ctx, peer, path, &proven); err != nil {
+		return err
+	}
+	if err := c.checkProofs(headers, proven, proofsFrom-from); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if reorg {
+		c.headers = headers
+		c.txs = proven
+		c.logger.Info("light client reorganised", "peer", peer, "height", len(headers)-1)
+		return nil
+	}
+	if tip == nil {
+		c.headers = headers
+	} else {
+		c.headers = append(c.headers, headers[1:]...)
+	}
+	c.txs = append(c.txs, proven...)
+	c.logger.Info("light client synced", "peer", peer, "height", len(c.headers)-1, "txs", len(c.txs))
+	return nil
+}
+
+// checkHeaders makes sure headers form a chain with enough proof-of-work
+func (c *Client) checkHeaders(headers []block.Header) error {
+	target := strings.Repeat("0", c.Difficulty)
+	for i, h := range headers {
+		if i == 0 {
+			continue
+		}
+		prev := headers[i-1]
+		if h.Index != prev.Index+1 || h.PreviousHash != prev.Hash {
+			return fmt.Errorf("header %d does not link to its predecessor", h.Index)
+		}
+		if !strings.HasPrefix(h.Hash, target) {
+			return fmt.Errorf("header %d has insufficient proof-of-work", h.Index)
+		}
+	}
+	return nil
+}
+
+// checkProofs verifies every proven transaction against the header it claims
+// to be in; offset is where proof heights start within headers
+func (c *Client) checkProofs(headers []block.Header, proven []chain.ProvenTx, offset int) error {
+	if len(headers) == 0 {
+		return nil
+	}
+	base := headers[0].Index
+	address := c.Wallet.Address()
+	for _, p := range proven {
+		i := p.Height - base
+		if p.Tx == nil || p.Proof == nil || i < int64(offset) || i >= int64(len(headers)) {
+			return fmt.Errorf("proof for unknown block %d", p.Height)
+		}
+		if p.Tx.From != address && p.Tx.To != address {
+			return fmt.Errorf("transaction %s does not involve this wallet", p.Tx.ID)
+		}
+		if p.Tx.ID != p.Tx.Hash() || !p.Proof.Verify(headers[i], p.Tx.ID) {
+			return fmt.Errorf("invalid proof for transaction %s", p.Tx.ID)
+		}
+	}
+	return nil
+}
+
+// SubmitTransaction relays a signed transaction to the full peers
+func (c *Client) SubmitTransaction(ctx context.Context, tx *transaction.Transaction) error {
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error = ErrNoPeers
+	accepted := false
+	for _, peer := range c.peers {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s/transaction", peer), bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			lastErr = fmt.Errorf("peer %s rejected transaction: %s", peer, bytes.TrimSpace(body))
+			continue
+		}
+		accepted = true
+	}
+	if !accepted {
+		return lastErr
+	}
+	return nil
+}
+
+// StartSyncLoop syncs every interval until ctx is cancelled
+func (c *Client) StartSyncLoop(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.Sync(ctx)
+			}
+		}
+	}()
+}
+
+// get fetches a path from a peer and decodes the JSON response into v
+func (c *Client) get(ctx context.Context, peer, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s%s", peer, path), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("peer %s returned status %d", peer, resp.StatusCode)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v); err != nil {
+		return fmt.Errorf("malformed response from %s: %w", peer, err)
+	}
+	return nil
+}
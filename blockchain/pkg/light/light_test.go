@@ -0,0 +1,149 @@
+package light
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+// fullPeer serves the headers and proofs endpoints of a full node backed by c.
+// tamper, if set, can modify proofs before they are sent.
+type fullPeer struct {
+	c      *chain.Chain
+	tamper func([]chain.ProvenTx)
+	mu     sync.Mutex
+}
+
+func (p *fullPeer) serve(t *testing.T) string {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/headers", func(w http.ResponseWriter, r *http.Request) {
+		from, _ := strconv.Atoi(r.URL.Query().Get("from"))
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		json.NewEncoder(w).Encode(p.c.Headers(from))
+	})
+	mux.HandleFunc("/proofs", func(w http.ResponseWriter, r *http.Request) {
+		from, _ := strconv.Atoi(r.URL.Query().Get("from"))
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		proven := p.c.ProveTransactions(r.URL.Query().Get("address"), from)
+		if p.tamper != nil {
+			p.tamper(proven)
+		}
+		json.NewEncoder(w).Encode(proven)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+func newTestClient(t *testing.T, peers ...string) *Client {
+	t.Helper()
+	w, err := wallet.New()
+	if err != nil {
+		t.Fatalf("failed to create wallet: %v", err)
+	}
+	return New(w, 1, peers)
+}
+
+func TestSync(t *testing.T) {
+	full := &fullPeer{c: chain.New(1, 10.0)}
+	client := newTestClient(t, full.serve(t))
+
+	full.c.AddBlock(nil, client.Wallet.Address())
+	full.c.AddBlock(nil, "someone-else")
+
+	if err := client.Sync(t.Context()); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if client.Height() != 2 {
+		t.Errorf("expected height 2, got %d", client.Height())
+	}
+	if client.Balance() != 10.0 {
+		t.Errorf("expected balance 10.0, got %f", client.Balance())
+	}
+
+	// Incremental sync only picks up the new blocks
+	full.c.AddBlock(nil, client.Wallet.Address())
+	if err := client.Sync(t.Context()); err != nil {
+		t.Fatalf("second sync failed: %v", err)
+	}
+	if client.Height() != 3 || client.Balance() != 20.0 || len(client.Transactions()) != 2 {
+		t.Errorf("expected height 3 with 2 txs totalling 20.0, got height %d, %d txs, %f",
+			client.Height(), len(client.Transactions()), client.Balance())
+	}
+
+	// Nothing new is a no-op
+	if err := client.Sync(t.Context()); err != nil || len(client.Transactions()) != 2 {
+		t.Errorf("idle sync should change nothing, got %d txs, %v", len(client.Transactions()), err)
+	}
+}
+
+func TestSyncRejectsForgedProof(t *testing.T) {
+	full := &fullPeer{c: chain.New(1, 10.0)}
+	client := newTestClient(t, full.serve(t))
+	full.c.AddBlock(nil, client.Wallet.Address())
+
+	// The peer inflates the coinbase and fixes up the ID, but can't fix the block hash
+	full.tamper = func(proven []chain.ProvenTx) {
+		for i := range proven {
+			tx := *proven[i].Tx
+			tx.Amount = 1000
+			tx.ID = tx.Hash()
+			proven[i].Tx = &tx
+			proven[i].Proof.TxIDs[proven[i].Proof.Position] = tx.ID
+		}
+	}
+
+	if err := client.Sync(t.Context()); err == nil {
+		t.Fatal("expected forged proof to be rejected")
+	}
+	if client.Balance() != 0 || client.Height() != -1 {
+		t.Errorf("rejected sync should not change state, got height %d balance %f", client.Height(), client.Balance())
+	}
+}
+
+func TestSyncReorg(t *testing.T) {
+	full := &fullPeer{c: chain.New(1, 10.0)}
+	client := newTestClient(t, full.serve(t))
+	full.c.AddBlock(nil, client.Wallet.Address())
+
+	if err := client.Sync(t.Context()); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	// The peer switches to a longer chain that never paid us
+	longer := chain.New(1, 10.0)
+	for i := 0; i < 3; i++ {
+		longer.AddBlock(nil, "someone-else")
+	}
+	full.mu.Lock()
+	full.c = longer
+	full.mu.Unlock()
+
+	if err := client.Sync(t.Context()); err != nil {
+		t.Fatalf("sync after reorg failed: %v", err)
+	}
+	if client.Height() != 3 {
+		t.Errorf("expected height 3 after reorg, got %d", client.Height())
+	}
+	if client.Balance() != 0 {
+		t.Errorf("transactions from the abandoned chain should be dropped, balance %f", client.Balance())
+	}
+}
+
+func TestSyncNoPeers(t *testing.T) {
+	client := newTestClient(t)
+	if err := client.Sync(t.Context()); !errors.Is(err, ErrNoPeers) {
+		t.Errorf("expected ErrNoPeers, got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package light
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+)
+
+// Status summarises a light client for healthchecks and dashboards
+type Status struct {
+	Mode          string  `json:"mode"`
+	WalletAddress string  `json:"wallet_address"`
+	Height        int64   `json:"height"`
+	BestBlockHash string  `json:"best_block_hash"`
+	PeerCount     int     `json:"peer_count"`
+	Balance       float64 `json:"balance"`
+	TxCount       int     `json:"tx_count"`
+}
+
+// Status returns the client's current state
+func (c *Client) Status() Status {
+	headers := c.Headers(int(c.Height()))
+	status := Status{
+		Mode:          "light",
+		WalletAddress: c.Wallet.Address(),
+		Height:        c.Height(),
+		PeerCount:     len(c.peers),
+		Balance:       c.Balance(),
+		TxCount:       len(c.Transactions()),
+	}
+	if len(headers) > 0 {
+		status.BestBlockHash = headers[len(headers)-1].Hash
+	}
+	return status
+}
+
+// Handler returns the light client's HTTP API, a subset of the full node's
+func (c *Client) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", c.handleStatus)
+	mux.HandleFunc("/headers", c.handleHeaders)
+	mux.HandleFunc("/balance", c.handleBalance)
+	mux.HandleFunc("/transactions", c.handleTransactions)
+	mux.HandleFunc("/transaction", c.handleTransaction)
+	return mux
+}
+
+// handleStatus returns the client's status
+func (c *Client) handleStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c.Status())
+}
+
+// handleHeaders returns known headers starting at the optional "from" index
+func (c *Client) handleHeaders(w http.ResponseWriter, r *http.Request) {
+	from := 0
+	if v := r.URL.Query().Get("from"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 0 {
+			http.Error(w, "from must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c.Headers(from))
+}
+
+// handleBalance returns the wallet's balance; light clients don't know anyone else's
+func (c *Client) handleBalance(w http.ResponseWriter, r *http.Request) {
+	if address := r.URL.Query().Get("address"); address != "" && address != c.Wallet.Address() {
+		http.Error(w, "light nodes only track their own wallet", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]float64{"balance": c.Balance()})
+}
+
+// handleTransactions returns the wallet's verified transactions
+func (c *Client) handleTransactions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c.Transactions())
+}
+
+// handleTransaction relays a signed transaction to the full peers
+func (c *Client) handleTransaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var tx transaction.Transaction
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&tx); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := c.SubmitTransaction(r.Context(), &tx); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
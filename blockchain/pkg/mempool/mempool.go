@@ -1,29 +1,57 @@
 package mempool
 
 import (
+	"errors"
 	"fmt"
 	"sync"
+	"time"
 
+	"github.com/oksmith/home-server/blockchain/pkg/clock"
 	"github.com/oksmith/home-server/blockchain/pkg/transaction"
 )
 
+// Errors returned by Add, so callers can tell rejection reasons apart
+var (
+	ErrInvalidTransaction = errors.New("invalid transaction")
+	ErrDuplicate          = errors.New("already in mempool")
+)
+
 // Mempool holds pending transactions waiting to be mined
 type Mempool struct {
 	transactions map[string]*transaction.Transaction
+	arrivals     map[string]uint64    // transaction ID -> arrival sequence number
+	addedAt      map[string]time.Time // transaction ID -> when it arrived
+	nextArrival  uint64
+	clock        clock.Clock
 	mu           sync.RWMutex // a lock that prevents data races when multiple goroutines access the same data
 }
 
 // New creates a new mempool
 func New() *Mempool {
+	return NewWithClock(clock.System)
+}
+
+// NewWithClock creates a new mempool that times arrivals by clk
+func NewWithClock(clk clock.Clock) *Mempool {
 	return &Mempool{
 		transactions: make(map[string]*transaction.Transaction),
+		arrivals:     make(map[string]uint64),
+		addedAt:      make(map[string]time.Time),
+		clock:        clk,
 	}
 }
 
+// SetClock replaces the clock timing arrivals
+func (m *Mempool) SetClock(clk clock.Clock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clock = clk
+}
+
 // Add adds a transaction to the mempool
 func (m *Mempool) Add(tx *transaction.Transaction) error {
 	if err := tx.IsValid(); err != nil {
-		return fmt.Errorf("invalid transaction: %w", err)
+		return fmt.Errorf("%w: %w", ErrInvalidTransaction, err)
 	}
 
 	m.mu.Lock()
@@ -31,10 +59,13 @@ func (m *Mempool) Add(tx *transaction.Transaction) error {
 
 	// Check if transaction already exists
 	if _, exists := m.transactions[tx.ID]; exists {
-		return fmt.Errorf("transaction %s already in mempool", tx.ID)
+		return fmt.Errorf("transaction %s %w", tx.ID, ErrDuplicate)
 	}
 
 	m.transactions[tx.ID] = tx
+	m.arrivals[tx.ID] = m.nextArrival
+	m.addedAt[tx.ID] = m.clock.Now()
+	m.nextArrival++
 	return nil
 }
 
@@ -43,6 +74,8 @@ func (m *Mempool) Remove(txID string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	delete(m.transactions, txID)
+	delete(m.arrivals, txID)
+	delete(m.addedAt, txID)
 }
 
 // Get retrieves a transaction by ID
@@ -70,7 +103,7 @@ func (m *Mempool) GetN(n int) []*transaction.Transaction {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	txs := make([]*transaction.Transaction, 0, n)
+	txs := make([]*transaction.Transaction, 0, min(n, len(m.transactions)))
 	count := 0
 	for _, tx := range m.transactions {
 		if count >= n {
@@ -82,6 +115,26 @@ func (m *Mempool) GetN(n int) []*transaction.Transaction {
 	return txs
 }
 
+// Position returns a transaction's 1-based place in the mempool by arrival
+// order (1 = oldest pending), and false if it isn't in the mempool
+func (m *Mempool) Position(txID string) (int, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	arrival, exists := m.arrivals[txID]
+	if !exists {
+		return 0, false
+	}
+
+	position := 1
+	for _, other := range m.arrivals {
+		if other < arrival {
+			position++
+		}
+	}
+	return position, true
+}
+
 // Size returns the number of transactions in the mempool
 func (m *Mempool) Size() int {
 	m.mu.RLock()
@@ -94,6 +147,8 @@ func (m *Mempool) Clear() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.transactions = make(map[string]*transaction.Transaction)
+	m.arrivals = make(map[string]uint64)
+	m.addedAt = make(map[string]time.Time)
 }
 
 // RemoveTransactions removes multiple transactions (used after mining a block)
@@ -103,5 +158,27 @@ func (m *Mempool) RemoveTransactions(txs []*transaction.Transaction) {
 
 	for _, tx := range txs {
 		delete(m.transactions, tx.ID)
+		delete(m.arrivals, tx.ID)
+		delete(m.addedAt, tx.ID)
+	}
+}
+
+// Expire removes and returns the transactions that have been pending for
+// longer than maxAge, such as payments that can never be mined because their
+// sender's balance was spent elsewhere
+func (m *Mempool) Expire(maxAge time.Duration) []*transaction.Transaction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.clock.Now()
+	var expired []*transaction.Transaction
+	for id, added := range m.addedAt {
+		if now.Sub(added) > maxAge {
+			expired = append(expired, m.transactions[id])
+			delete(m.transactions, id)
+			delete(m.arrivals, id)
+			delete(m.addedAt, id)
+		}
 	}
+	return expired
 }
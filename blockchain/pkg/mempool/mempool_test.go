@@ -4,10 +4,13 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/oksmith/home-server/blockchain/pkg/clock"
 	"github.com/oksmith/home-server/blockchain/pkg/transaction"
 )
 
@@ -329,3 +332,78 @@ func TestConcurrentAccess(t *testing.T) {
 		t.Errorf("size should not exceed initial count, got %d", finalSize)
 	}
 }
+
+func TestAddErrors(t *testing.T) {
+	m := New()
+	tx := createSignedTransaction("alice", "bob", 10.0)
+	m.Add(tx)
+
+	if err := m.Add(tx); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("expected ErrDuplicate, got %v", err)
+	}
+
+	unsigned := transaction.New("alice", "bob", 10.0)
+	if err := m.Add(unsigned); !errors.Is(err, ErrInvalidTransaction) {
+		t.Errorf("expected ErrInvalidTransaction, got %v", err)
+	}
+}
+
+func TestPosition(t *testing.T) {
+	m := New()
+	tx1 := createSignedTransaction("alice", "bob", 1.0)
+	tx2 := createSignedTransaction("alice", "bob", 2.0)
+	tx3 := createSignedTransaction("alice", "bob", 3.0)
+	m.Add(tx1)
+	m.Add(tx2)
+	m.Add(tx3)
+
+	for i, tx := range []*transaction.Transaction{tx1, tx2, tx3} {
+		pos, ok := m.Position(tx.ID)
+		if !ok || pos != i+1 {
+			t.Errorf("expected tx%d at position %d, got %d (found %v)", i+1, i+1, pos, ok)
+		}
+	}
+
+	// Removing the oldest moves everyone up
+	m.Remove(tx1.ID)
+	if pos, _ := m.Position(tx3.ID); pos != 2 {
+		t.Errorf("expected tx3 at position 2 after removal, got %d", pos)
+	}
+	if _, ok := m.Position(tx1.ID); ok {
+		t.Error("removed transaction should have no position")
+	}
+}
+
+func TestExpire(t *testing.T) {
+	clk := clock.NewManual(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	m := NewWithClock(clk)
+	old := createSignedTransaction("alice", "bob", 10.0)
+	m.Add(old)
+	clk.Advance(30 * time.Minute)
+	recent := createSignedTransaction("carol", "dave", 5.0)
+	m.Add(recent)
+
+	if expired := m.Expire(time.Hour); len(expired) != 0 {
+		t.Errorf("nothing is an hour old yet, but %d expired", len(expired))
+	}
+
+	clk.Advance(31 * time.Minute)
+	expired := m.Expire(time.Hour)
+	if len(expired) != 1 || expired[0].ID != old.ID {
+		t.Fatalf("expected only the older transaction to expire, got %v", expired)
+	}
+	if _, ok := m.Get(old.ID); ok {
+		t.Error("expired transaction is still pending")
+	}
+	if pos, ok := m.Position(recent.ID); !ok || pos != 1 {
+		t.Errorf("expected the remaining transaction first in line, got %d, %v", pos, ok)
+	}
+
+	// A transaction that leaves and comes back starts its wait over
+	m.Remove(recent.ID)
+	clk.Advance(time.Hour)
+	m.Add(recent)
+	if expired := m.Expire(time.Hour); len(expired) != 0 {
+		t.Errorf("re-added transaction expired at once")
+	}
+}
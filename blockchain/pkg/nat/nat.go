@@ -0,0 +1,118 @@
+// Package nat maps a node's port on the home router so peers outside the
+// LAN can connect without manual port forwarding. It speaks UPnP IGD and
+// NAT-PMP, the two protocols consumer routers commonly support.
+package nat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"time"
+)
+
+// DefaultLifetime is how long mappings are requested for; MapPort renews them at half-life
+const DefaultLifetime = time.Hour
+
+// ErrNotFound is returned when no router answering the requested protocol was found
+var ErrNotFound = errors.New("no NAT gateway found")
+
+// Mapper talks to a router that can forward ports
+type Mapper interface {
+	// ExternalIP returns the router's public address
+	ExternalIP(ctx context.Context) (net.IP, error)
+	// AddMapping forwards TCP externalPort on the router to internalPort on
+	// this machine and returns the external port actually mapped
+	AddMapping(ctx context.Context, internalPort, externalPort int, lifetime time.Duration) (int, error)
+	// DeleteMapping removes a mapping made by AddMapping
+	DeleteMapping(ctx context.Context, internalPort, externalPort int) error
+	// String names the protocol and gateway
+	String() string
+}
+
+// Discover finds the router using the given method: "upnp", "pmp" or "auto"
+// (UPnP first, then NAT-PMP)
+func Discover(ctx context.Context, method string) (Mapper, error) {
+	switch method {
+	case "upnp":
+		return discoverUPnP(ctx)
+	case "pmp":
+		return discoverPMP()
+	case "auto":
+		if m, err := discoverUPnP(ctx); err == nil {
+			return m, nil
+		}
+		return discoverPMP()
+	default:
+		return nil, fmt.Errorf("unknown NAT method %q (use upnp, pmp or auto)", method)
+	}
+}
+
+// discoverUPnP and discoverPMP return a nil interface, not a typed nil, on failure
+func discoverUPnP(ctx context.Context) (Mapper, error) {
+	m, err := DiscoverUPnP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func discoverPMP() (Mapper, error) {
+	m, err := DiscoverPMP()
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// MapPort forwards port on the router and keeps the mapping alive until ctx
+// is cancelled, when it is removed again. It returns the externally reachable
+// host:port and a channel that is closed once the mapping has been removed.
+func MapPort(ctx context.Context, m Mapper, port int, lifetime time.Duration) (string, <-chan struct{}, error) {
+	external, err := m.AddMapping(ctx, port, port, lifetime)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to map port %d via %s: %w", port, m, err)
+	}
+	ip, err := m.ExternalIP(ctx)
+	if err != nil {
+		m.DeleteMapping(context.Background(), port, external)
+		return "", nil, fmt.Errorf("failed to get external address via %s: %w", m, err)
+	}
+	slog.Info("mapped port on router", "gateway", m.String(), "external", net.JoinHostPort(ip.String(), strconv.Itoa(external)), "internal_port", port)
+
+	released := make(chan struct{})
+	go func() {
+		defer close(released)
+		ticker := time.NewTicker(lifetime / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				cleanup, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				if err := m.DeleteMapping(cleanup, port, external); err != nil {
+					slog.Warn("failed to remove port mapping", "gateway", m.String(), "err", err)
+				}
+				cancel()
+				return
+			case <-ticker.C:
+				if _, err := m.AddMapping(ctx, port, external, lifetime); err != nil {
+					slog.Warn("failed to renew port mapping", "gateway", m.String(), "err", err)
+				}
+			}
+		}
+	}()
+
+	return net.JoinHostPort(ip.String(), strconv.Itoa(external)), released, nil
+}
+
+// localIPFor returns this machine's address on the route to the gateway
+func localIPFor(gateway string) (net.IP, error) {
+	conn, err := net.Dial("udp", gateway)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
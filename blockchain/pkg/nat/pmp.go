@@ -0,0 +1,141 @@
+package nat
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// pmpPort is the UDP port NAT-PMP gateways listen on
+	pmpPort = 5351
+
+	// pmpRetries is how many times a request is sent before giving up,
+	// starting at 250ms and doubling as RFC 6886 suggests
+	pmpRetries = 4
+)
+
+// PMP is a NAT-PMP (RFC 6886) client
+type PMP struct {
+	gateway string // host:port
+}
+
+// NewPMP creates a NAT-PMP client for the gateway at host:port
+func NewPMP(gateway string) *PMP {
+	return &PMP{gateway: gateway}
+}
+
+// DiscoverPMP creates a NAT-PMP client for the default gateway
+func DiscoverPMP() (*PMP, error) {
+	gw, err := defaultGateway()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	return NewPMP(net.JoinHostPort(gw.String(), fmt.Sprint(pmpPort))), nil
+}
+
+func (p *PMP) String() string {
+	return "NAT-PMP " + p.gateway
+}
+
+// ExternalIP asks the gateway for its public address
+func (p *PMP) ExternalIP(ctx context.Context) (net.IP, error) {
+	resp, err := p.call(ctx, []byte{0, 0}, 12)
+	if err != nil {
+		return nil, err
+	}
+	return net.IPv4(resp[8], resp[9], resp[10], resp[11]), nil
+}
+
+// AddMapping requests a TCP mapping
+func (p *PMP) AddMapping(ctx context.Context, internalPort, externalPort int, lifetime time.Duration) (int, error) {
+	req := make([]byte, 12)
+	req[1] = 2 // map TCP
+	binary.BigEndian.PutUint16(req[4:], uint16(internalPort))
+	binary.BigEndian.PutUint16(req[6:], uint16(externalPort))
+	binary.BigEndian.PutUint32(req[8:], uint32(lifetime.Seconds()))
+
+	resp, err := p.call(ctx, req, 16)
+	if err != nil {
+		return 0, err
+	}
+	return int(binary.BigEndian.Uint16(resp[10:])), nil
+}
+
+// DeleteMapping removes a mapping by requesting it with a zero lifetime
+func (p *PMP) DeleteMapping(ctx context.Context, internalPort, externalPort int) error {
+	_, err := p.AddMapping(ctx, internalPort, 0, 0)
+	return err
+}
+
+// call sends a request and waits for a response of the given size, retrying on timeout
+func (p *PMP) call(ctx context.Context, req []byte, size int) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", p.gateway)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	wait := 250 * time.Millisecond
+	resp := make([]byte, 16)
+	for attempt := 0; attempt < pmpRetries; attempt++ {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+
+		deadline := time.Now().Add(wait)
+		if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+		conn.SetReadDeadline(deadline)
+
+		n, err := conn.Read(resp)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() && ctx.Err() == nil {
+				wait *= 2
+				continue
+			}
+			return nil, err
+		}
+		if n < size || resp[0] != 0 || resp[1] != req[1]+128 {
+			return nil, fmt.Errorf("malformed NAT-PMP response")
+		}
+		if code := binary.BigEndian.Uint16(resp[2:]); code != 0 {
+			return nil, fmt.Errorf("NAT-PMP gateway returned result code %d", code)
+		}
+		return resp[:n], nil
+	}
+	return nil, fmt.Errorf("%w: no answer from %s", ErrNotFound, p.gateway)
+}
+
+// defaultGateway reads the IPv4 default route from /proc/net/route (Linux only)
+func defaultGateway() (net.IP, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return nil, fmt.Errorf("can't find default gateway: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// Iface Destination Gateway ...; the default route has destination 0
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		raw, err := hex.DecodeString(fields[2])
+		if err != nil || len(raw) != 4 {
+			continue
+		}
+		// The kernel prints the address in host (little-endian) byte order
+		return net.IPv4(raw[3], raw[2], raw[1], raw[0]), nil
+	}
+	return nil, fmt.Errorf("no default route")
+}
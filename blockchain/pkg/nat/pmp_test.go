@@ -0,0 +1,113 @@
+package nat
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakePMPGateway answers NAT-PMP requests on a local UDP port, mapping every
+// request to external port 40000 and recording the lifetimes asked for
+func fakePMPGateway(t *testing.T) (string, chan uint32) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	lifetimes := make(chan uint32, 10)
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			switch {
+			case n == 2 && buf[1] == 0:
+				resp := []byte{0, 128, 0, 0, 0, 0, 0, 1, 203, 0, 113, 7}
+				conn.WriteTo(resp, addr)
+			case n == 12 && buf[1] == 2:
+				lifetimes <- binary.BigEndian.Uint32(buf[8:])
+				resp := make([]byte, 16)
+				resp[1] = 130
+				copy(resp[8:10], buf[4:6])
+				binary.BigEndian.PutUint16(resp[10:], 40000)
+				copy(resp[12:16], buf[8:12])
+				conn.WriteTo(resp, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String(), lifetimes
+}
+
+func TestPMP(t *testing.T) {
+	gateway, lifetimes := fakePMPGateway(t)
+	p := NewPMP(gateway)
+
+	ip, err := p.ExternalIP(t.Context())
+	if err != nil {
+		t.Fatalf("ExternalIP failed: %v", err)
+	}
+	if !ip.Equal(net.IPv4(203, 0, 113, 7)) {
+		t.Errorf("expected 203.0.113.7, got %s", ip)
+	}
+
+	external, err := p.AddMapping(t.Context(), 8080, 8080, time.Hour)
+	if err != nil {
+		t.Fatalf("AddMapping failed: %v", err)
+	}
+	if external != 40000 {
+		t.Errorf("expected the gateway's chosen port 40000, got %d", external)
+	}
+	if got := <-lifetimes; got != 3600 {
+		t.Errorf("expected a 3600s lifetime, got %d", got)
+	}
+
+	if err := p.DeleteMapping(t.Context(), 8080, external); err != nil {
+		t.Fatalf("DeleteMapping failed: %v", err)
+	}
+	if got := <-lifetimes; got != 0 {
+		t.Errorf("deleting should request a zero lifetime, got %d", got)
+	}
+}
+
+func TestPMPNoGateway(t *testing.T) {
+	// Nothing listens here, so every retry times out or is refused
+	conn, _ := net.ListenPacket("udp4", "127.0.0.1:0")
+	addr := conn.LocalAddr().String()
+	conn.Close()
+
+	if _, err := NewPMP(addr).ExternalIP(t.Context()); err == nil {
+		t.Error("expected an error with no gateway")
+	}
+}
+
+func TestMapPort(t *testing.T) {
+	gateway, lifetimes := fakePMPGateway(t)
+	ctx, cancel := context.WithCancel(t.Context())
+
+	external, released, err := MapPort(ctx, NewPMP(gateway), 8080, time.Hour)
+	if err != nil {
+		t.Fatalf("MapPort failed: %v", err)
+	}
+	if external != "203.0.113.7:40000" {
+		t.Errorf("expected 203.0.113.7:40000, got %s", external)
+	}
+	<-lifetimes
+
+	// Cancelling removes the mapping
+	cancel()
+	select {
+	case got := <-lifetimes:
+		if got != 0 {
+			t.Errorf("expected a delete request, got lifetime %d", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("mapping was not removed after cancel")
+	}
+	<-released
+}
@@ -0,0 +1,277 @@
+package nat
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ssdpAddr is the multicast address UPnP devices listen on for discovery
+const ssdpAddr = "239.255.255.250:1900"
+
+// wanServiceTypes are the IGD services that can add port mappings, in order of preference
+var wanServiceTypes = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:2",
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+}
+
+// UPnP is a UPnP Internet Gateway Device client
+type UPnP struct {
+	controlURL  string
+	serviceType string
+	localIP     net.IP // this machine's address as seen by the router
+	client      *http.Client
+}
+
+// DiscoverUPnP finds an Internet Gateway Device on the LAN with SSDP
+func DiscoverUPnP(ctx context.Context) (*UPnP, error) {
+	location, err := ssdpSearch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewUPnP(ctx, location)
+}
+
+// NewUPnP creates a client from a gateway's device description URL
+func NewUPnP(ctx context.Context, location string) (*UPnP, error) {
+	u := &UPnP{client: &http.Client{Timeout: 5 * time.Second}}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch device description: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var root struct {
+		URLBase string     `xml:"URLBase"`
+		Device  upnpDevice `xml:"device"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&root); err != nil {
+		return nil, fmt.Errorf("invalid device description: %w", err)
+	}
+
+	base, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	if root.URLBase != "" {
+		if base, err = url.Parse(root.URLBase); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, serviceType := range wanServiceTypes {
+		if svc := root.Device.find(serviceType); svc != nil {
+			control, err := base.Parse(svc.ControlURL)
+			if err != nil {
+				return nil, err
+			}
+			u.controlURL = control.String()
+			u.serviceType = serviceType
+			break
+		}
+	}
+	if u.controlURL == "" {
+		return nil, fmt.Errorf("%w: %s has no WAN connection service", ErrNotFound, location)
+	}
+
+	host := base.Host
+	if base.Port() == "" {
+		host = net.JoinHostPort(base.Hostname(), "80")
+	}
+	if u.localIP, err = localIPFor(host); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// upnpDevice is a device in an IGD description, with its nested devices
+type upnpDevice struct {
+	Services []upnpService `xml:"serviceList>service"`
+	Devices  []upnpDevice  `xml:"deviceList>device"`
+}
+
+type upnpService struct {
+	ServiceType string `xml:"serviceType"`
+	ControlURL  string `xml:"controlURL"`
+}
+
+// find searches the device tree for a service of the given type
+func (d *upnpDevice) find(serviceType string) *upnpService {
+	for i := range d.Services {
+		if d.Services[i].ServiceType == serviceType {
+			return &d.Services[i]
+		}
+	}
+	for i := range d.Devices {
+		if svc := d.Devices[i].find(serviceType); svc != nil {
+			return svc
+		}
+	}
+	return nil
+}
+
+func (u *UPnP) String() string {
+	return "UPnP " + u.controlURL
+}
+
+// ExternalIP asks the gateway for its public address
+func (u *UPnP) ExternalIP(ctx context.Context) (net.IP, error) {
+	resp, err := u.call(ctx, "GetExternalIPAddress", nil)
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(resp["NewExternalIPAddress"])
+	if ip == nil {
+		return nil, fmt.Errorf("gateway returned invalid external address %q", resp["NewExternalIPAddress"])
+	}
+	return ip, nil
+}
+
+// AddMapping forwards a TCP port to this machine
+func (u *UPnP) AddMapping(ctx context.Context, internalPort, externalPort int, lifetime time.Duration) (int, error) {
+	_, err := u.call(ctx, "AddPortMapping", [][2]string{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(externalPort)},
+		{"NewProtocol", "TCP"},
+		{"NewInternalPort", strconv.Itoa(internalPort)},
+		{"NewInternalClient", u.localIP.String()},
+		{"NewEnabled", "1"},
+		{"NewPortMappingDescription", "home-server blockchain node"},
+		{"NewLeaseDuration", strconv.Itoa(int(lifetime.Seconds()))},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return externalPort, nil
+}
+
+// DeleteMapping removes a TCP port mapping
+func (u *UPnP) DeleteMapping(ctx context.Context, internalPort, externalPort int) error {
+	_, err := u.call(ctx, "DeletePortMapping", [][2]string{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(externalPort)},
+		{"NewProtocol", "TCP"},
+	})
+	return err
+}
+
+// call invokes a SOAP action on the WAN service and returns the response arguments
+func (u *UPnP) call(ctx context.Context, action string, args [][2]string) (map[string]string, error) {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`)
+	fmt.Fprintf(&body, `<u:%s xmlns:u="%s">`, action, u.serviceType)
+	for _, arg := range args {
+		fmt.Fprintf(&body, "<%s>", arg[0])
+		xml.EscapeText(&body, []byte(arg[1]))
+		fmt.Fprintf(&body, "</%s>", arg[0])
+	}
+	fmt.Fprintf(&body, "</u:%s></s:Body></s:Envelope>", action)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.controlURL, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", fmt.Sprintf(`"%s#%s"`, u.serviceType, action))
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s failed with status %d", action, resp.StatusCode)
+	}
+	return soapValues(data)
+}
+
+// soapValues collects the text of every leaf element in a SOAP response by local name
+func soapValues(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var current string
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid SOAP response: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			current = t.Name.Local
+		case xml.CharData:
+			if current != "" {
+				values[current] += string(t)
+			}
+		case xml.EndElement:
+			current = ""
+		}
+	}
+}
+
+// ssdpSearch multicasts an M-SEARCH for gateways and returns the first
+// responder's description URL
+func ssdpSearch(ctx context.Context) (string, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	dst, err := net.ResolveUDPAddr("udp4", ssdpAddr)
+	if err != nil {
+		return "", err
+	}
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + ssdpAddr + "\r\n" +
+		"ST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n\r\n"
+	if _, err := conn.WriteTo([]byte(search), dst); err != nil {
+		return "", err
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetReadDeadline(deadline)
+
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return "", fmt.Errorf("%w: no UPnP gateway answered (%v)", ErrNotFound, err)
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if location := resp.Header.Get("Location"); location != "" && strings.HasPrefix(location, "http") {
+			return location, nil
+		}
+	}
+}
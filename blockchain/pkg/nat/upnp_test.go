@@ -0,0 +1,125 @@
+package nat
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testDescription = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+    <deviceList>
+      <device>
+        <deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+        <deviceList>
+          <device>
+            <deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+            <serviceList>
+              <service>
+                <serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+                <controlURL>/ctl/IPConn</controlURL>
+              </service>
+            </serviceList>
+          </device>
+        </deviceList>
+      </device>
+    </deviceList>
+  </device>
+</root>`
+
+// fakeIGD serves a gateway description and answers SOAP actions, recording them
+func fakeIGD(t *testing.T) (string, func() []string) {
+	t.Helper()
+	var (
+		mu      sync.Mutex
+		actions []string
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rootDesc.xml", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, testDescription)
+	})
+	mux.HandleFunc("/ctl/IPConn", func(w http.ResponseWriter, r *http.Request) {
+		action := r.Header.Get("SOAPAction")
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		actions = append(actions, action)
+		mu.Unlock()
+
+		switch {
+		case strings.HasSuffix(action, `#GetExternalIPAddress"`):
+			io.WriteString(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>`+
+				`<u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">`+
+				`<NewExternalIPAddress>198.51.100.4</NewExternalIPAddress>`+
+				`</u:GetExternalIPAddressResponse></s:Body></s:Envelope>`)
+		case strings.HasSuffix(action, `#AddPortMapping"`):
+			if !strings.Contains(string(body), "<NewExternalPort>8080</NewExternalPort>") {
+				http.Error(w, "bad request", http.StatusInternalServerError)
+				return
+			}
+			io.WriteString(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body/></s:Envelope>`)
+		default:
+			io.WriteString(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body/></s:Envelope>`)
+		}
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return srv.URL + "/rootDesc.xml", func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), actions...)
+	}
+}
+
+func TestUPnP(t *testing.T) {
+	location, actions := fakeIGD(t)
+
+	u, err := NewUPnP(t.Context(), location)
+	if err != nil {
+		t.Fatalf("failed to read device description: %v", err)
+	}
+	if !strings.HasSuffix(u.controlURL, "/ctl/IPConn") {
+		t.Errorf("expected the nested WANIPConnection control URL, got %s", u.controlURL)
+	}
+
+	ip, err := u.ExternalIP(t.Context())
+	if err != nil || ip.String() != "198.51.100.4" {
+		t.Errorf("expected 198.51.100.4, got %v, %v", ip, err)
+	}
+
+	external, err := u.AddMapping(t.Context(), 8080, 8080, time.Hour)
+	if err != nil || external != 8080 {
+		t.Errorf("expected mapping on 8080, got %d, %v", external, err)
+	}
+	if err := u.DeleteMapping(t.Context(), 8080, 8080); err != nil {
+		t.Errorf("DeleteMapping failed: %v", err)
+	}
+
+	got := actions()
+	want := []string{"GetExternalIPAddress", "AddPortMapping", "DeletePortMapping"}
+	if len(got) != len(want) {
+		t.Fatalf("expected actions %v, got %v", want, got)
+	}
+	for i := range want {
+		if !strings.HasSuffix(got[i], "#"+want[i]+`"`) {
+			t.Errorf("action %d: expected %s, got %s", i, want[i], got[i])
+		}
+	}
+}
+
+func TestUPnPWithoutWANService(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<root><device><deviceType>printer</deviceType></device></root>`)
+	}))
+	defer srv.Close()
+
+	if _, err := NewUPnP(t.Context(), srv.URL); err == nil {
+		t.Error("expected an error for a device without a WAN connection service")
+	}
+}
@@ -0,0 +1,64 @@
+package node
+
+import (
+	"fmt"
+	"net"
+)
+
+// SetListenAddress sets the address the HTTP server binds to, when it differs
+// from the address advertised to peers (e.g. "[::]:8080" behind "192.168.1.20:8080")
+func (n *Node) SetListenAddress(address string) {
+	n.listenAddr = address
+}
+
+// listenAddress returns the bind address, defaulting to the advertised address
+func (n *Node) listenAddress() string {
+	if n.listenAddr != "" {
+		return n.listenAddr
+	}
+	return n.Address
+}
+
+// AdvertiseAddress picks the address to tell peers for a node bound to listen.
+// A specific host is advertised as-is; a wildcard bind ("", 0.0.0.0 or ::) is
+// replaced with this machine's first non-loopback IP so other hosts can reach it.
+func AdvertiseAddress(listen string) (string, error) {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "", fmt.Errorf("invalid listen address %q: %w", listen, err)
+	}
+
+	if ip := net.ParseIP(host); host != "" && (ip == nil || !ip.IsUnspecified()) {
+		return net.JoinHostPort(host, port), nil
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "", fmt.Errorf("failed to list network interfaces: %w", err)
+	}
+	wantIPv6 := host != "" && net.ParseIP(host).To4() == nil
+	var fallback net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if (ipNet.IP.To4() == nil) == wantIPv6 {
+			return net.JoinHostPort(ipNet.IP.String(), port), nil
+		}
+		if fallback == nil {
+			fallback = ipNet.IP
+		}
+	}
+	if fallback != nil {
+		return net.JoinHostPort(fallback.String(), port), nil
+	}
+	return "", fmt.Errorf("no non-loopback address found to advertise for %q, use -advertise", listen)
+}
+
+// validPeerAddress reports whether a peer address is a host:port pair,
+// with IPv6 hosts in brackets ("[fd00::2]:8080")
+func validPeerAddress(address string) bool {
+	host, port, err := net.SplitHostPort(address)
+	return err == nil && host != "" && port != ""
+}
@@ -0,0 +1,58 @@
+package node
+
+import (
+	"net"
+	"testing"
+)
+
+func TestAdvertiseAddress(t *testing.T) {
+	tests := []struct {
+		listen string
+		want   string
+	}{
+		{"localhost:8080", "localhost:8080"},
+		{"192.168.1.20:8080", "192.168.1.20:8080"},
+		{"[fd00::20]:8080", "[fd00::20]:8080"},
+		{"pi.local:9000", "pi.local:9000"},
+	}
+	for _, tt := range tests {
+		got, err := AdvertiseAddress(tt.listen)
+		if err != nil || got != tt.want {
+			t.Errorf("AdvertiseAddress(%q) = %q, %v; want %q", tt.listen, got, err, tt.want)
+		}
+	}
+
+	if _, err := AdvertiseAddress("fd00::20:8080"); err == nil {
+		t.Error("expected unbracketed IPv6 address to be rejected")
+	}
+}
+
+func TestAdvertiseAddressWildcard(t *testing.T) {
+	for _, listen := range []string{":8080", "0.0.0.0:8080", "[::]:8080"} {
+		got, err := AdvertiseAddress(listen)
+		if err != nil {
+			t.Skipf("no usable network interface: %v", err)
+		}
+		host, port, err := net.SplitHostPort(got)
+		if err != nil || port != "8080" {
+			t.Errorf("AdvertiseAddress(%q) = %q, want a dialable host:8080", listen, got)
+			continue
+		}
+		if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() || ip.IsLoopback() {
+			t.Errorf("AdvertiseAddress(%q) = %q, want a concrete non-loopback IP", listen, got)
+		}
+	}
+}
+
+func TestAddPeerValidatesAddress(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	n.addPeer("[fd00::2]:8080")
+	n.addPeer("fd00::2")
+	n.addPeer("no-port")
+	n.addPeer("localhost:9000")
+
+	peers := n.GetPeers()
+	if len(peers) != 1 || peers[0] != "[fd00::2]:8080" {
+		t.Errorf("expected only the bracketed IPv6 peer, got %v", peers)
+	}
+}
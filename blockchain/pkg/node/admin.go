@@ -0,0 +1,72 @@
+package node
+
+import (
+	"net/http"
+
+	"github.com/oksmith/home-server/pkg/httpserver"
+	"github.com/oksmith/home-server/pkg/sigauth"
+)
+
+// SetAdminToken sets the bearer token required by admin endpoints. It may
+// be changed while the node runs. With no token set, admin endpoints are
+// disabled.
+func (n *Node) SetAdminToken(token string) {
+	n.adminMutex.Lock()
+	defer n.adminMutex.Unlock()
+	n.adminToken = token
+}
+
+// AdminToken returns the admin token, "" if there is none
+func (n *Node) AdminToken() string {
+	n.adminMutex.RLock()
+	defer n.adminMutex.RUnlock()
+	return n.adminToken
+}
+
+// SetAdminKeys sets the wallet keys, besides the admin token, that may sign
+// requests to admin endpoints, as package sigauth describes. nil trusts none.
+func (n *Node) SetAdminKeys(keys *sigauth.Keyring) {
+	n.adminMutex.Lock()
+	defer n.adminMutex.Unlock()
+	n.adminKeys = keys
+}
+
+// adminEnabled reports whether anyone can use the admin endpoints
+func (n *Node) adminEnabled() bool {
+	n.adminMutex.RLock()
+	defer n.adminMutex.RUnlock()
+	return n.adminToken != "" || n.adminKeys.Len() > 0
+}
+
+// requireAdmin wraps a handler so it only runs for requests carrying the
+// admin bearer token or signed with an admin key. Clients are rate limited,
+// and locked out after repeated bad tokens or signatures.
+func (n *Node) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return n.adminGuard.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !n.adminEnabled() {
+			http.Error(w, "Admin endpoints are disabled (no admin token configured)", http.StatusForbidden)
+			return
+		}
+		if !n.isAdmin(r) {
+			n.adminGuard.Failed(r)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		n.adminGuard.Succeeded(r)
+		next(w, r)
+	})).ServeHTTP
+}
+
+// isAdmin reports whether a request carries the admin bearer token, which
+// is never the case with no token set, or is signed with an admin key
+func (n *Node) isAdmin(r *http.Request) bool {
+	if sigauth.Signed(r) {
+		n.adminMutex.RLock()
+		keys := n.adminKeys
+		n.adminMutex.RUnlock()
+		_, err := keys.Verify(r)
+		return err == nil
+	}
+	token, ok := httpserver.BearerToken(r)
+	return ok && httpserver.TokenMatches(token, n.AdminToken())
+}
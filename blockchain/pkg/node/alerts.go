@@ -0,0 +1,303 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/alert"
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/pkg/httpserver"
+)
+
+// Ways an alert notifies when its rule fires
+const (
+	NotifyWebhook = "webhook" // POST an AlertEvent to a URL
+	NotifyCommand = "command" // run a shell command on the node's machine
+)
+
+// alertCommandTimeout bounds how long an alert's command may run
+const alertCommandTimeout = 30 * time.Second
+
+// Alert is a rule checked against each new block, with how to notify when it
+// fires. Rules on balances and the mempool fire when they become true;
+// rules on a block's transactions fire on every block they match.
+type Alert struct {
+	ID        string     `json:"id"`
+	Rule      string     `json:"rule"`
+	Notify    string     `json:"notify"`
+	URL       string     `json:"url,omitempty"`     // for webhook alerts
+	Command   string     `json:"command,omitempty"` // for command alerts, run with sh -c
+	CreatedAt time.Time  `json:"created_at"`
+	Firing    bool       `json:"firing"` // the rule held at the last block
+	LastFired *time.Time `json:"last_fired,omitempty"`
+
+	rule alert.Rule
+}
+
+// AlertRequest is the body of POST /alerts
+type AlertRequest struct {
+	Rule    string `json:"rule"`
+	Notify  string `json:"notify"`
+	URL     string `json:"url,omitempty"`
+	Command string `json:"command,omitempty"`
+}
+
+// AlertEvent is the JSON body POSTed to a webhook alert's URL, and written
+// to a command alert's standard input
+type AlertEvent struct {
+	AlertID     string    `json:"alert_id"`
+	Rule        string    `json:"rule"`
+	Value       float64   `json:"value"`
+	BlockHeight int64     `json:"block_height"`
+	BlockHash   string    `json:"block_hash"`
+	Time        time.Time `json:"time"`
+}
+
+// AddAlert registers an alert rule
+func (n *Node) AddAlert(req AlertRequest) (Alert, error) {
+	rule, err := alert.Parse(req.Rule)
+	if err != nil {
+		return Alert{}, err
+	}
+
+	switch req.Notify {
+	case NotifyWebhook:
+		u, err := url.Parse(req.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return Alert{}, fmt.Errorf("url must be an absolute http(s) URL")
+		}
+		req.Command = ""
+	case NotifyCommand:
+		if req.Command == "" {
+			return Alert{}, fmt.Errorf("command is required")
+		}
+		req.URL = ""
+	default:
+		return Alert{}, fmt.Errorf("notify must be %q or %q", NotifyWebhook, NotifyCommand)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Alert{}, err
+	}
+	a := Alert{
+		ID:        hex.EncodeToString(id),
+		Rule:      rule.String(),
+		Notify:    req.Notify,
+		URL:       req.URL,
+		Command:   req.Command,
+		CreatedAt: time.Now().UTC(),
+		rule:      rule,
+	}
+
+	n.alertsMutex.Lock()
+	n.alerts[a.ID] = &a
+	n.alertsMutex.Unlock()
+
+	n.logger.Info("added alert", "alert", a.ID, "rule", a.Rule, "notify", a.Notify)
+	n.persistAlerts()
+	return a, nil
+}
+
+// RemoveAlert deletes an alert, reporting whether it existed
+func (n *Node) RemoveAlert(id string) bool {
+	n.alertsMutex.Lock()
+	_, exists := n.alerts[id]
+	delete(n.alerts, id)
+	n.alertsMutex.Unlock()
+
+	if exists {
+		n.persistAlerts()
+	}
+	return exists
+}
+
+// GetAlert returns one alert by ID
+func (n *Node) GetAlert(id string) (Alert, bool) {
+	n.alertsMutex.RLock()
+	defer n.alertsMutex.RUnlock()
+
+	a, ok := n.alerts[id]
+	if !ok {
+		return Alert{}, false
+	}
+	return *a, true
+}
+
+// GetAlerts returns all alerts, oldest first
+func (n *Node) GetAlerts() []Alert {
+	n.alertsMutex.RLock()
+	defer n.alertsMutex.RUnlock()
+
+	alerts := make([]Alert, 0, len(n.alerts))
+	for _, a := range n.alerts {
+		alerts = append(alerts, *a)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].CreatedAt.Before(alerts[j].CreatedAt)
+	})
+	return alerts
+}
+
+// checkAlerts evaluates every alert against a newly connected block and
+// notifies those that fire
+func (n *Node) checkAlerts(b *block.Block) {
+	state := alert.State{Block: b, Balance: n.Chain.GetBalance, Mempool: n.Mempool.Size()}
+	now := time.Now().UTC()
+	changed := false
+
+	n.alertsMutex.Lock()
+	for _, a := range n.alerts {
+		value, holds := a.rule.Eval(state)
+		fire := holds && (!a.rule.Level() || !a.Firing)
+		if holds != a.Firing {
+			a.Firing = holds
+			changed = true
+		}
+		if !fire {
+			continue
+		}
+
+		fired := now
+		a.LastFired = &fired
+		changed = true
+
+		event := AlertEvent{AlertID: a.ID, Rule: a.Rule, Value: value, BlockHeight: b.Index, BlockHash: b.Hash, Time: now}
+		n.logger.Info("alert fired", "alert", a.ID, "rule", a.Rule, "value", value, "height", b.Index)
+		n.recordEvent(EventAlertFired, map[string]any{"alert": a.ID, "rule": a.Rule, "value": value, "height": b.Index})
+		switch a.Notify {
+		case NotifyWebhook:
+			go n.postAlertEvent(a.URL, event)
+		case NotifyCommand:
+			go n.runAlertCommand(a.Command, event)
+		}
+	}
+	n.alertsMutex.Unlock()
+
+	if changed {
+		n.persistAlerts()
+	}
+}
+
+// postAlertEvent delivers a fired alert to its webhook
+func (n *Node) postAlertEvent(callbackURL string, event AlertEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		n.logger.Error("failed to encode alert event", "alert", event.AlertID, "err", err)
+		return
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post(callbackURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		n.logger.Warn("alert webhook failed", "alert", event.AlertID, "err", err)
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		n.logger.Warn("alert webhook rejected event", "alert", event.AlertID, "status", resp.StatusCode)
+	}
+}
+
+// runAlertCommand runs a fired alert's command through the shell, with the
+// event as JSON on standard input and its fields in the environment
+func (n *Node) runAlertCommand(command string, event AlertEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		n.logger.Error("failed to encode alert event", "alert", event.AlertID, "err", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(n.ctx, alertCommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Env = append(os.Environ(),
+		"ALERT_ID="+event.AlertID,
+		"ALERT_RULE="+event.Rule,
+		"ALERT_VALUE="+strconv.FormatFloat(event.Value, 'f', -1, 64),
+		"BLOCK_HEIGHT="+strconv.FormatInt(event.BlockHeight, 10),
+		"BLOCK_HASH="+event.BlockHash,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		n.logger.Warn("alert command failed", "alert", event.AlertID, "err", err, "output", string(bytes.TrimSpace(out)))
+	}
+}
+
+// restoreAlerts adds alerts loaded from the data directory, dropping any
+// whose rule no longer parses
+func (n *Node) restoreAlerts(alerts []Alert) {
+	n.alertsMutex.Lock()
+	defer n.alertsMutex.Unlock()
+
+	for _, a := range alerts {
+		rule, err := alert.Parse(a.Rule)
+		if err != nil {
+			n.logger.Warn("dropping saved alert", "alert", a.ID, "err", err)
+			continue
+		}
+		a.rule = rule
+		n.alerts[a.ID] = &a
+	}
+}
+
+// handleAlerts lists (GET), adds (POST AlertRequest) or removes (DELETE ?id=)
+// alerts. Alerts make the node run commands or send requests from inside the
+// network, so adding and removing them needs the admin token, and where each
+// one notifies is only listed for admins.
+func (n *Node) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		alerts := n.GetAlerts()
+		if !n.isAdmin(r) {
+			for i := range alerts {
+				alerts[i].URL, alerts[i].Command = "", ""
+			}
+		}
+		httpserver.WriteJSON(w, http.StatusOK, alerts)
+
+	case http.MethodPost, http.MethodDelete:
+		r.Body = http.MaxBytesReader(w, r.Body, maxMessageSize)
+		n.requireAdmin(n.changeAlerts)(w, r)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// changeAlerts adds or removes an alert for handleAlerts, once the request is
+// known to come from an admin
+func (n *Node) changeAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		if !n.RemoveAlert(r.URL.Query().Get("id")) {
+			http.Error(w, "alert not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var req AlertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	a, err := n.AddAlert(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	httpserver.WriteJSON(w, http.StatusCreated, a)
+}
@@ -0,0 +1,206 @@
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAlertsFire(t *testing.T) {
+	events := make(chan AlertEvent, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event AlertEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+	}))
+	defer hook.Close()
+
+	n, err := Open(t.TempDir(), "localhost:9000", 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to open node: %v", err)
+	}
+	address := n.Wallet.Address()
+	rich, err := n.AddAlert(AlertRequest{Rule: "balance(" + address + ") >= 20", Notify: NotifyWebhook, URL: hook.URL})
+	if err != nil {
+		t.Fatalf("failed to add alert: %v", err)
+	}
+	paid, err := n.AddAlert(AlertRequest{Rule: "received(" + address + ") > 0", Notify: NotifyWebhook, URL: hook.URL})
+	if err != nil {
+		t.Fatalf("failed to add alert: %v", err)
+	}
+
+	// Each block pays a reward, so the received rule fires every time but
+	// the balance rule only once, when the balance reaches 20
+	fired := map[string]int{}
+	for height := int64(1); height <= 3; height++ {
+		if err := n.Mine(); err != nil {
+			t.Fatalf("failed to mine: %v", err)
+		}
+		want := 1
+		if height == 2 {
+			want = 2
+		}
+		for range want {
+			event := waitForAlert(t, events)
+			if event.BlockHeight != height {
+				t.Errorf("expected an event for block %d, got %+v", height, event)
+			}
+			fired[event.AlertID]++
+		}
+	}
+	if fired[rich.ID] != 1 || fired[paid.ID] != 3 {
+		t.Errorf("expected the balance rule to fire once and the received rule 3 times, got %v", fired)
+	}
+
+	// Firing state survives a restart, so the balance rule doesn't fire again
+	reopened, err := Open(n.dataDir, "localhost:9000", 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to reopen node: %v", err)
+	}
+	restored, ok := reopened.GetAlert(rich.ID)
+	if !ok || !restored.Firing || restored.LastFired == nil {
+		t.Errorf("expected a firing alert after reopening, got %+v", restored)
+	}
+}
+
+func TestAlertCommand(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	n.SetAdminToken("secret")
+	handler := n.Handler()
+
+	out := filepath.Join(t.TempDir(), "alert.out")
+	body := `{"rule": "mempool() < 1", "notify": "command", "command": "echo \"$BLOCK_HEIGHT $ALERT_VALUE\" > ` + out + `"}`
+
+	// Commands run on the node's machine, so need the admin token
+	req := httptest.NewRequest(http.MethodPost, APIPrefix+"/alerts", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without the admin token, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, APIPrefix+"/alerts", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 with the admin token, got %d: %s", rec.Code, rec.Body)
+	}
+
+	if err := n.Mine(); err != nil {
+		t.Fatalf("failed to mine: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(out)
+		if string(data) == "1 0\n" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the command to write \"1 0\", got %q", data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAlertsNeedAdmin(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	handler := n.Handler()
+	send := func(method, target, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, APIPrefix+target, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	body := `{"rule": "mempool() > 5", "notify": "webhook", "url": "http://192.168.1.1/admin"}`
+
+	// With no admin token set, nobody can add alerts
+	if rec := send(http.MethodPost, "/alerts", "", body); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 with no admin token set, got %d", rec.Code)
+	}
+
+	n.SetAdminToken("secret")
+	if rec := send(http.MethodPost, "/alerts", "", body); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a webhook alert without the admin token, got %d", rec.Code)
+	}
+	if rec := send(http.MethodPost, "/alerts", "secret", `{"rule": "`+strings.Repeat("x", maxMessageSize)+`"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected an oversized body refused, got %d", rec.Code)
+	}
+	rec := send(http.MethodPost, "/alerts", "secret", body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 with the admin token, got %d: %s", rec.Code, rec.Body)
+	}
+	var a Alert
+	json.Unmarshal(rec.Body.Bytes(), &a)
+
+	// Anyone can see the rules, but only admins where they notify
+	var listed []Alert
+	json.Unmarshal(send(http.MethodGet, "/alerts", "", "").Body.Bytes(), &listed)
+	if len(listed) != 1 || listed[0].ID != a.ID || listed[0].URL != "" {
+		t.Errorf("expected the alert listed without its URL, got %+v", listed)
+	}
+	json.Unmarshal(send(http.MethodGet, "/alerts", "secret", "").Body.Bytes(), &listed)
+	if len(listed) != 1 || listed[0].URL != "http://192.168.1.1/admin" {
+		t.Errorf("expected admins to see the URL, got %+v", listed)
+	}
+
+	if rec := send(http.MethodDelete, "/alerts?id="+a.ID, "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 removing an alert without the admin token, got %d", rec.Code)
+	}
+	if rec := send(http.MethodDelete, "/alerts?id="+a.ID, "secret", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204 with the admin token, got %d", rec.Code)
+	}
+	if rec := send(http.MethodDelete, "/alerts?id="+a.ID, "secret", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 removing it again, got %d", rec.Code)
+	}
+}
+
+func TestAddAlertValidation(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	address := n.Wallet.Address()
+
+	tests := []struct {
+		req  AlertRequest
+		want string
+	}{
+		{AlertRequest{Rule: "balance(alice) < 1", Notify: NotifyWebhook, URL: "http://phone.lan/hook"}, "not an address"},
+		{AlertRequest{Rule: "balance(" + address + ") < 1", Notify: NotifyWebhook, URL: "ftp://phone.lan/hook"}, "http(s) URL"},
+		{AlertRequest{Rule: "balance(" + address + ") < 1", Notify: NotifyCommand}, "command is required"},
+		{AlertRequest{Rule: "balance(" + address + ") < 1", Notify: "email"}, "notify must be"},
+	}
+	for _, tt := range tests {
+		if _, err := n.AddAlert(tt.req); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("AddAlert(%+v) error = %v, want %q", tt.req, err, tt.want)
+		}
+	}
+
+	a, err := n.AddAlert(AlertRequest{Rule: "balance( " + address + " )<1", Notify: NotifyWebhook, URL: "http://phone.lan/hook"})
+	if err != nil {
+		t.Fatalf("failed to add alert: %v", err)
+	}
+	if a.Rule != "balance("+address+") < 1" {
+		t.Errorf("expected the rule to be tidied, got %q", a.Rule)
+	}
+	if !n.RemoveAlert(a.ID) || n.RemoveAlert(a.ID) {
+		t.Error("expected alert to be removed exactly once")
+	}
+}
+
+func waitForAlert(t *testing.T, events <-chan AlertEvent) AlertEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for alert webhook")
+		return AlertEvent{}
+	}
+}
@@ -0,0 +1,121 @@
+package node
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// compressMinSize is the smallest request body worth compressing for a peer
+const compressMinSize = 1024
+
+// gzipPeers remembers which peers accept gzip-encoded request bodies. Peers
+// advertise it with an Accept-Encoding response header (RFC 7694), so older
+// peers keep getting plain JSON.
+type gzipPeers struct {
+	peers map[string]bool
+	mu    sync.Mutex
+}
+
+func newGzipPeers() *gzipPeers {
+	return &gzipPeers{peers: make(map[string]bool)}
+}
+
+// observe records whether a peer's response advertised gzip request bodies
+func (g *gzipPeers) observe(peer string, resp *http.Response) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.peers[peer] = acceptsGzip(resp.Header)
+}
+
+// accepts reports whether gzip bodies can be sent to peer
+func (g *gzipPeers) accepts(peer string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.peers[peer]
+}
+
+// acceptsGzip reports whether an Accept-Encoding header lists gzip
+func acceptsGzip(h http.Header) bool {
+	for _, value := range h.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(value, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(coding), ";")
+			if strings.EqualFold(strings.TrimSpace(name), "gzip") && strings.ReplaceAll(params, " ", "") != "q=0" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// gzipBytes compresses data
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// gzipResponseWriter compresses everything written through it
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz *gzip.Writer
+}
+
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	return w.gz.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// compressResponse gzips a handler's response for clients that accept it
+func compressResponse(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r.Header) {
+			next(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		next(&gzipResponseWriter{ResponseWriter: w, gz: gz}, r)
+	}
+}
+
+// decompressRequests accepts gzip-encoded request bodies and advertises that
+// it does, so peers know they can compress broadcasts to this node
+func decompressRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Encoding", "gzip")
+
+		switch encoding := strings.ToLower(r.Header.Get("Content-Encoding")); encoding {
+		case "", "identity":
+		case "gzip":
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, "invalid gzip body: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			defer gz.Close()
+			r.Body = gz
+			r.Header.Del("Content-Encoding")
+			r.ContentLength = -1
+		default:
+			http.Error(w, "unsupported Content-Encoding "+encoding, http.StatusUnsupportedMediaType)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,122 @@
+package node
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+)
+
+func TestChainResponseCompression(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	n.Mine()
+	h := n.Handler()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/chain", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected a gzip response, got headers %v", rec.Header())
+	}
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("invalid gzip body: %v", err)
+	}
+	var decoded struct {
+		Blocks []json.RawMessage `json:"blocks"`
+	}
+	if err := json.NewDecoder(gz).Decode(&decoded); err != nil || len(decoded.Blocks) != 2 {
+		t.Errorf("expected 2 blocks in the decompressed chain, got %d (%v)", len(decoded.Blocks), err)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/chain", nil))
+	if rec.Header().Get("Content-Encoding") != "" || !json.Valid(rec.Body.Bytes()) {
+		t.Error("clients that don't ask for gzip should get plain JSON")
+	}
+}
+
+func TestCompressedRequestBody(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	n.Mine()
+	h := n.Handler()
+
+	tx := transaction.New(n.Wallet.Address(), "bob", 1)
+	tx.Sign(n.Wallet.PrivateKey)
+	data, _ := json.Marshal(tx)
+	body, _ := gzipBytes(data)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/transaction", bytes.NewReader(body))
+	req.Header.Set("Content-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected a gzip body to be accepted, got %d: %s", rec.Code, rec.Body)
+	}
+	if !acceptsGzip(rec.Header()) {
+		t.Error("responses should advertise gzip request bodies")
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/transaction", bytes.NewReader(data))
+	req.Header.Set("Content-Encoding", "br")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected 415 for an unsupported encoding, got %d", rec.Code)
+	}
+}
+
+func TestRequestPeerCompressesForCapablePeers(t *testing.T) {
+	var encodings []string
+	peerAPI := decompressRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encodings = append(encodings, r.Header.Get("Content-Encoding"))
+		peerAPI.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	peer := strings.TrimPrefix(srv.URL, "http://")
+
+	n, _ := New("localhost:9001", 1, 10.0)
+	large := strings.Repeat("x", compressMinSize)
+	for _, body := range []string{large, large, "small"} {
+		if _, err := n.postToPeer(t.Context(), peer, "/block", body, 1024); err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+	}
+
+	// Plain until the peer advertises gzip, then compressed unless the body is small
+	want := []string{"", "gzip", ""}
+	if strings.Join(encodings, ",") != strings.Join(want, ",") {
+		t.Errorf("expected encodings %q, got %q", want, encodings)
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := map[string]bool{
+		"gzip":              true,
+		"br, gzip;q=0.8":    true,
+		"GZIP":              true,
+		"gzip;q=0":          false,
+		"deflate, identity": false,
+		"":                  false,
+	}
+	for value, want := range tests {
+		h := http.Header{}
+		if value != "" {
+			h.Set("Accept-Encoding", value)
+		}
+		if got := acceptsGzip(h); got != want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
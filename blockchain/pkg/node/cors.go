@@ -0,0 +1,56 @@
+package node
+
+import (
+	"net/http"
+	"strings"
+)
+
+// SetCORSOrigins sets which browser origins may call the node's read endpoints,
+// e.g. a block explorer served from another machine on the LAN.
+// "*" allows any origin; an empty list disables CORS headers entirely.
+func (n *Node) SetCORSOrigins(origins []string) {
+	cleaned := make([]string, 0, len(origins))
+	for _, origin := range origins {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin != "" {
+			cleaned = append(cleaned, origin)
+		}
+	}
+	n.corsOrigins = cleaned
+}
+
+// allowedOrigin returns the value for Access-Control-Allow-Origin, or "" if
+// the origin isn't allowed
+func (n *Node) allowedOrigin(origin string) string {
+	for _, allowed := range n.corsOrigins {
+		if allowed == "*" {
+			return "*"
+		}
+		if strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// cors wraps a read-only handler with CORS headers and answers preflight
+// OPTIONS requests, so browsers on allowed origins can call it directly
+func (n *Node) cors(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if allowed := n.allowedOrigin(origin); allowed != "" {
+				w.Header().Set("Access-Control-Allow-Origin", allowed)
+				w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+				w.Header().Set("Access-Control-Max-Age", "600")
+			}
+			w.Header().Add("Vary", "Origin")
+		}
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,61 @@
+package node
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	n := &Node{}
+	n.SetCORSOrigins([]string{"http://explorer.lan:3000/", " "})
+
+	called := false
+	handler := n.cors(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	tests := []struct {
+		name        string
+		method      string
+		origin      string
+		allowOrigin string
+		wantCalled  bool
+	}{
+		{"allowed origin", http.MethodGet, "http://explorer.lan:3000", "http://explorer.lan:3000", true},
+		{"disallowed origin", http.MethodGet, "http://evil.example", "", true},
+		{"no origin", http.MethodGet, "", "", true},
+		{"preflight", http.MethodOptions, "http://explorer.lan:3000", "http://explorer.lan:3000", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called = false
+			req := httptest.NewRequest(tt.method, "/chain", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+				t.Errorf("expected Access-Control-Allow-Origin %q, got %q", tt.allowOrigin, got)
+			}
+			if called != tt.wantCalled {
+				t.Errorf("expected handler called %v, got %v", tt.wantCalled, called)
+			}
+			if tt.method == http.MethodOptions && rec.Code != http.StatusNoContent {
+				t.Errorf("expected preflight status 204, got %d", rec.Code)
+			}
+		})
+	}
+}
+
+func TestCORSWildcard(t *testing.T) {
+	n := &Node{}
+	n.SetCORSOrigins([]string{"*"})
+
+	if got := n.allowedOrigin("http://anything.lan"); got != "*" {
+		t.Errorf("expected wildcard origin, got %q", got)
+	}
+}
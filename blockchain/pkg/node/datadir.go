@@ -0,0 +1,316 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+// Files kept inside a node's data directory
+const (
+	chainFile   = "chain.db"
+	legacyFile  = "chain.json" // the whole chain as JSON, as older versions kept it
+	walletFile  = "wallet.pem"
+	peersFile   = "peers.json"
+	watchesFile = "watches.json"
+	alertsFile  = "alerts.json"
+	eventsFile  = "events.jsonl"
+)
+
+// migratedSuffix is appended to a legacy chain file's name once its blocks
+// have been moved into the store
+const migratedSuffix = ".migrated"
+
+// ChainPath is where a node keeps its chain store inside dataDir
+func ChainPath(dataDir string) string {
+	return filepath.Join(dataDir, chainFile)
+}
+
+// OpenChain opens the chain store in dataDir and loads the chain saved in it,
+// which is nil if there is none yet. A chain.json left by an older version is
+// moved into the store first. A damaged store is refused, pointing at fsck.
+func OpenChain(dataDir string) (*chain.KVStore, *chain.Chain, error) {
+	s, err := chain.OpenStore(ChainPath(dataDir))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.Damaged(); err != nil {
+		s.Close()
+		return nil, nil, fmt.Errorf("chain store is damaged, run `bchain chain fsck -repair -datadir %s`: %w", dataDir, err)
+	}
+
+	c, err := chain.Load(s)
+	if errors.Is(err, chain.ErrEmptyStore) {
+		c, err = migrateLegacyChain(dataDir, s)
+	}
+	if err != nil {
+		s.Close()
+		return nil, nil, err
+	}
+	return s, c, nil
+}
+
+// migrateLegacyChain moves the blocks of a chain.json into s, renaming the
+// file afterwards so it is only done once. It returns a nil chain if there is
+// no such file.
+func migrateLegacyChain(dataDir string, s chain.Store) (*chain.Chain, error) {
+	filename := filepath.Join(dataDir, legacyFile)
+	c, err := chain.LoadFromFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", legacyFile, err)
+	}
+	if err := c.SaveTo(s); err != nil {
+		return nil, fmt.Errorf("failed to move %s into the chain store: %w", legacyFile, err)
+	}
+	if err := os.Rename(filename, filename+migratedSuffix); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Open creates a node backed by a data directory. The chain, wallet and peer
+// list are loaded from dataDir if present (difficulty and miningReward only
+// apply to a brand new chain) and are written back as they change, so
+// restarting the node doesn't reset the blockchain or wallet. Only the blocks
+// that changed are written, so saving costs the same however long the chain.
+func Open(dataDir, address string, difficulty int, miningReward float64) (*Node, error) {
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	w, err := loadOrCreateWallet(filepath.Join(dataDir, walletFile))
+	if err != nil {
+		return nil, err
+	}
+
+	store, c, err := OpenChain(dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chain: %w", err)
+	}
+	if c == nil {
+		c = chain.New(difficulty, miningReward)
+	}
+
+	n := newNode(address, w, c)
+	n.dataDir = dataDir
+	n.store = store
+
+	if err := n.events.open(filepath.Join(dataDir, eventsFile)); err != nil {
+		return nil, fmt.Errorf("failed to load events: %w", err)
+	}
+
+	peers, err := loadPeers(filepath.Join(dataDir, peersFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load peers: %w", err)
+	}
+	for _, peer := range peers {
+		n.addPeer(peer)
+	}
+
+	watches, err := loadWatches(filepath.Join(dataDir, watchesFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load watches: %w", err)
+	}
+	for _, w := range watches {
+		n.watches[w.ID] = w
+	}
+
+	alerts, err := loadAlerts(filepath.Join(dataDir, alertsFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load alerts: %w", err)
+	}
+	n.restoreAlerts(alerts)
+
+	n.logger.Info("opened data directory",
+		"datadir", dataDir, "height", c.GetLatestBlock().Index, "peers", len(peers))
+
+	// Make sure a freshly created chain exists on disk straight away
+	if err := n.SaveState(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// SaveState writes the chain and peer list to the data directory.
+// It is a no-op for nodes created without one.
+func (n *Node) SaveState() error {
+	if n.dataDir == "" {
+		return nil
+	}
+
+	if err := n.Chain.SaveTo(n.store); err != nil {
+		return fmt.Errorf("failed to save chain: %w", err)
+	}
+	if err := n.savePeers(); err != nil {
+		return fmt.Errorf("failed to save peers: %w", err)
+	}
+	if err := n.saveWatches(); err != nil {
+		return fmt.Errorf("failed to save watches: %w", err)
+	}
+	if err := n.saveAlerts(); err != nil {
+		return fmt.Errorf("failed to save alerts: %w", err)
+	}
+	return nil
+}
+
+// persistChain saves the blocks that changed, logging rather than failing
+func (n *Node) persistChain() {
+	if n.dataDir == "" {
+		return
+	}
+	if err := n.Chain.SaveTo(n.store); err != nil {
+		n.logger.Error("failed to persist chain", "err", err)
+	}
+}
+
+// persistPeers saves the peer list after it changes, logging rather than failing
+func (n *Node) persistPeers() {
+	if n.dataDir == "" {
+		return
+	}
+	if err := n.savePeers(); err != nil {
+		n.logger.Error("failed to persist peers", "err", err)
+	}
+}
+
+func (n *Node) savePeers() error {
+	return writeFileAtomic(filepath.Join(n.dataDir, peersFile), func(filename string) error {
+		data, err := json.MarshalIndent(n.GetPeers(), "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filename, data, 0644)
+	})
+}
+
+// persistWatches saves the watch list after it changes, logging rather than failing
+func (n *Node) persistWatches() {
+	if n.dataDir == "" {
+		return
+	}
+	if err := n.saveWatches(); err != nil {
+		n.logger.Error("failed to persist watches", "err", err)
+	}
+}
+
+func (n *Node) saveWatches() error {
+	return writeFileAtomic(filepath.Join(n.dataDir, watchesFile), func(filename string) error {
+		data, err := json.MarshalIndent(n.GetWatches(), "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filename, data, 0644)
+	})
+}
+
+// persistAlerts saves the alerts after they change or fire, logging rather than failing
+func (n *Node) persistAlerts() {
+	if n.dataDir == "" {
+		return
+	}
+	if err := n.saveAlerts(); err != nil {
+		n.logger.Error("failed to persist alerts", "err", err)
+	}
+}
+
+func (n *Node) saveAlerts() error {
+	return writeFileAtomic(filepath.Join(n.dataDir, alertsFile), func(filename string) error {
+		data, err := json.MarshalIndent(n.GetAlerts(), "", "  ")
+		if err != nil {
+			return err
+		}
+		// Command alerts run on this machine, so keep them private
+		return os.WriteFile(filename, data, 0600)
+	})
+}
+
+// loadOrCreateWallet loads the node's wallet, generating and saving a new one on first run
+func loadOrCreateWallet(filename string) (*wallet.Wallet, error) {
+	w, err := wallet.LoadFromFile(filename)
+	if err == nil {
+		return w, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to load wallet: %w", err)
+	}
+
+	w, err = wallet.New()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.SaveToFile(filename); err != nil {
+		return nil, fmt.Errorf("failed to save wallet: %w", err)
+	}
+	return w, nil
+}
+
+// loadPeers reads a saved peer list, returning none if it doesn't exist yet
+func loadPeers(filename string) ([]string, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var peers []string
+	if err := json.Unmarshal(data, &peers); err != nil {
+		return nil, err
+	}
+	return peers, nil
+}
+
+// loadWatches reads saved address watches, returning none if they don't exist yet
+func loadWatches(filename string) ([]Watch, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var watches []Watch
+	if err := json.Unmarshal(data, &watches); err != nil {
+		return nil, err
+	}
+	return watches, nil
+}
+
+// loadAlerts reads saved alerts, returning none if they don't exist yet
+func loadAlerts(filename string) ([]Alert, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var alerts []Alert
+	if err := json.Unmarshal(data, &alerts); err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+// writeFileAtomic writes via a temporary file and rename so a crash mid-write
+// never leaves a truncated file behind
+func writeFileAtomic(filename string, write func(string) error) error {
+	tmp := filename + ".tmp"
+	if err := write(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
@@ -0,0 +1,85 @@
+package node
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+)
+
+func TestOpenRestoresState(t *testing.T) {
+	dir := t.TempDir()
+
+	n, err := Open(dir, "localhost:9000", 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to open node: %v", err)
+	}
+	n.AddPeer("localhost:9001")
+	if err := n.Mine(); err != nil {
+		t.Fatalf("failed to mine: %v", err)
+	}
+
+	reopened, err := Open(dir, "localhost:9000", 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to reopen node: %v", err)
+	}
+
+	if reopened.Wallet.Address() != n.Wallet.Address() {
+		t.Errorf("wallet should be restored from the data directory")
+	}
+	if reopened.Chain.Length() != 2 {
+		t.Errorf("expected chain length 2, got %d", reopened.Chain.Length())
+	}
+	if reopened.Chain.GetBalance(n.Wallet.Address()) != 10.0 {
+		t.Errorf("expected restored balance 10.0, got %f", reopened.Chain.GetBalance(n.Wallet.Address()))
+	}
+	peers := reopened.GetPeers()
+	if len(peers) != 1 || peers[0] != "localhost:9001" {
+		t.Errorf("expected peers [localhost:9001], got %v", peers)
+	}
+}
+
+func TestOpenMovesLegacyChainFile(t *testing.T) {
+	dir := t.TempDir()
+	c := chain.New(1, 10.0)
+	c.AddBlock(nil, "miner")
+	legacy := filepath.Join(dir, legacyFile)
+	if err := c.SaveToFile(legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := Open(dir, "localhost:9000", 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to open node: %v", err)
+	}
+	if n.Chain.Length() != 2 || n.Chain.GetBalance("miner") != 10.0 {
+		t.Fatalf("expected the chain from %s, got %d blocks", legacyFile, n.Chain.Length())
+	}
+	if _, err := os.Stat(legacy); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected %s to be renamed once moved, got %v", legacyFile, err)
+	}
+	if _, err := os.Stat(legacy + migratedSuffix); err != nil {
+		t.Errorf("expected the old file kept as %s%s: %v", legacyFile, migratedSuffix, err)
+	}
+
+	if err := n.Mine(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := Open(dir, "localhost:9000", 1, 10.0)
+	if err != nil || reopened.Chain.Length() != 3 {
+		t.Errorf("expected the chain store to carry on from the moved chain, got %v", err)
+	}
+}
+
+func TestSaveStateWithoutDataDir(t *testing.T) {
+	n, err := New("localhost:9000", 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	if err := n.SaveState(); err != nil {
+		t.Errorf("in-memory node should save without error, got %v", err)
+	}
+}
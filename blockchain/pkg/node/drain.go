@@ -0,0 +1,39 @@
+package node
+
+import (
+	"net/http"
+
+	"github.com/oksmith/home-server/pkg/httpserver"
+)
+
+// Drain gets the node ready for the machine to power off: mining stops, so
+// no block is left half-mined, and the chain, peers, watches and alerts are
+// written to the data directory. The node keeps serving requests, and
+// anything that changes afterwards is persisted as usual.
+func (n *Node) Drain() error {
+	n.StopMining()
+	if err := n.SaveState(); err != nil {
+		return err
+	}
+	n.logger.Info("drained for shutdown", "height", n.Chain.GetLatestBlock().Index)
+	return nil
+}
+
+// handleShutdown drains the node, replying once its state is on disk
+func (n *Node) handleShutdown(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := n.Drain(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	httpserver.WriteJSON(w, http.StatusOK, map[string]any{
+		"drained":   true,
+		"height":    n.Chain.GetLatestBlock().Index,
+		"persisted": n.dataDir != "",
+	})
+}
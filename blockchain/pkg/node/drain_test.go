@@ -0,0 +1,54 @@
+package node
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestShutdownDrainsNode(t *testing.T) {
+	dir := t.TempDir()
+	n, err := Open(dir, "localhost:9000", 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to open node: %v", err)
+	}
+	n.SetAdminToken("secret")
+	if err := n.StartMining(time.Hour, 0); err != nil {
+		t.Fatalf("failed to start mining: %v", err)
+	}
+	// Added straight to the chain, so only the drain puts it on disk
+	if err := n.Chain.AddBlock(nil, n.Wallet.Address()); err != nil {
+		t.Fatalf("failed to add block: %v", err)
+	}
+	handler := n.Handler()
+
+	// Without the admin token nothing happens
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, APIPrefix+"/shutdown", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without token, got %d", rec.Code)
+	}
+	if !n.MiningEnabled() {
+		t.Errorf("mining should still run after an unauthorized drain")
+	}
+
+	req := httptest.NewRequest(http.MethodPost, APIPrefix+"/shutdown", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if n.MiningEnabled() {
+		t.Errorf("mining should stop when the node is drained")
+	}
+
+	reopened, err := Open(dir, "localhost:9000", 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to reopen node: %v", err)
+	}
+	if reopened.Chain.Length() != 2 {
+		t.Errorf("expected drained chain length 2 on disk, got %d", reopened.Chain.Length())
+	}
+}
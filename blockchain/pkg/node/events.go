@@ -0,0 +1,205 @@
+package node
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/oksmith/home-server/pkg/httpserver"
+)
+
+// maxEvents is how many events the node keeps, in memory and on disk
+const maxEvents = 1000
+
+// Event types recorded in the node's event log
+const (
+	EventBlockAccepted = "block_accepted" // fields: height, hash, source ("mined" or "peer")
+	EventBlockRejected = "block_rejected" // fields: reason, and peer or hash when known
+	EventReorg         = "reorg"          // fields: old_height, new_height, dropped
+	EventWalletReorg   = "wallet_reorg"   // fields: txid, height, amount (net for the wallet), outcome ("pending" or "dropped")
+	EventPeerPenalized = "peer_penalized" // fields: peer, reason
+	EventPeerBanned    = "peer_banned"    // fields: peer, duration
+	EventPeerRejected  = "peer_rejected"  // fields: peer, reason
+	EventMiningStarted = "mining_started" // fields: interval, empty_interval
+	EventMiningStopped = "mining_stopped"
+	EventAlertFired    = "alert_fired" // fields: alert, rule, value, height
+)
+
+// Event is a significant thing that happened to the node, kept for debugging
+// why nodes disagree
+type Event struct {
+	Seq    uint64         `json:"seq"`
+	Time   time.Time      `json:"time"`
+	Type   string         `json:"type"`
+	Fields map[string]any `json:"fields,omitempty"`
+}
+
+// eventLog keeps the most recent events and, with a data directory, appends
+// them to a file so they survive restarts
+type eventLog struct {
+	events    []Event // oldest first, at most maxEvents
+	seq       uint64  // sequence number of the latest event
+	filename  string  // "" keeps events in memory only
+	fileLines int     // events in the file, which is compacted when it grows past twice maxEvents
+	mu        sync.Mutex
+}
+
+// newEventLog creates an empty in-memory event log
+func newEventLog() *eventLog {
+	return &eventLog{}
+}
+
+// open loads saved events from filename and appends new ones to it
+func (l *eventLog) open(filename string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.filename = filename
+	f, err := os.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Event
+		// Skip a line torn by a crash mid-write rather than losing the whole log
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			continue
+		}
+		l.fileLines++
+		l.append(e)
+	}
+	return scanner.Err()
+}
+
+// Record adds an event, returning it with its sequence number and time filled in
+func (l *eventLog) Record(eventType string, fields map[string]any) (Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e := Event{Seq: l.seq + 1, Time: time.Now().UTC(), Type: eventType, Fields: fields}
+	l.append(e)
+	return e, l.persist(e)
+}
+
+// append adds an event to the buffer, dropping the oldest once it is full.
+// Callers must hold the lock.
+func (l *eventLog) append(e Event) {
+	l.events = append(l.events, e)
+	if len(l.events) > maxEvents {
+		l.events = append(l.events[:0], l.events[len(l.events)-maxEvents:]...)
+	}
+	l.seq = max(l.seq, e.Seq)
+}
+
+// persist appends an event to the file, rewriting it with only the buffered
+// events once it holds too many. Callers must hold the lock.
+func (l *eventLog) persist(e Event) error {
+	if l.filename == "" {
+		return nil
+	}
+
+	if l.fileLines >= 2*maxEvents {
+		err := writeFileAtomic(l.filename, func(filename string) error {
+			return writeEvents(filename, l.events)
+		})
+		if err == nil {
+			l.fileLines = len(l.events)
+		}
+		return err
+	}
+
+	f, err := os.OpenFile(l.filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	l.fileLines++
+	return nil
+}
+
+// writeEvents writes events to a file, one JSON object per line
+func writeEvents(filename string, events []Event) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// Since returns the buffered events with a sequence number above seq, oldest first
+func (l *eventLog) Since(seq uint64) []Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	events := []Event{}
+	for _, e := range l.events {
+		if e.Seq > seq {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// recordEvent adds an event to the node's log, logging rather than failing if it can't be saved
+func (n *Node) recordEvent(eventType string, fields map[string]any) {
+	e, err := n.events.Record(eventType, fields)
+	if err != nil {
+		n.logger.Error("failed to persist event", "type", eventType, "err", err)
+	}
+	if n.eventHook != nil {
+		n.eventHook(e)
+	}
+}
+
+// SetEventHook has fn called with each event as the node records it, such as
+// to pass some on as notifications. It must be set before the node starts,
+// and fn must not block, as it runs wherever the event happened.
+func (n *Node) SetEventHook(fn func(Event)) {
+	n.eventHook = fn
+}
+
+// Events returns the node's recorded events after the given sequence number
+func (n *Node) Events(since uint64) []Event {
+	return n.events.Since(since)
+}
+
+// handleEvents returns events after the optional "since" sequence number
+func (n *Node) handleEvents(w http.ResponseWriter, r *http.Request) {
+	var since uint64
+	if v := r.URL.Query().Get("since"); v != "" {
+		parsed, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			http.Error(w, "since must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+	httpserver.WriteJSON(w, http.StatusOK, n.Events(since))
+}
@@ -0,0 +1,157 @@
+package node
+
+import (
+	"bufio"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+)
+
+func TestEventLogSince(t *testing.T) {
+	l := newEventLog()
+	for i := 0; i < 3; i++ {
+		l.Record(EventMiningStarted, nil)
+	}
+
+	if got := l.Since(0); len(got) != 3 || got[0].Seq != 1 || got[2].Seq != 3 {
+		t.Errorf("expected events 1-3 oldest first, got %+v", got)
+	}
+	if got := l.Since(2); len(got) != 1 || got[0].Seq != 3 {
+		t.Errorf("expected only event 3, got %+v", got)
+	}
+	if got := l.Since(3); len(got) != 0 {
+		t.Errorf("expected no events after the latest, got %d", len(got))
+	}
+}
+
+func TestEventLogKeepsMostRecent(t *testing.T) {
+	l := newEventLog()
+	for i := 0; i < maxEvents+10; i++ {
+		l.Record(EventMiningStopped, nil)
+	}
+
+	got := l.Since(0)
+	if len(got) != maxEvents {
+		t.Fatalf("expected %d events, got %d", maxEvents, len(got))
+	}
+	if got[0].Seq != 11 {
+		t.Errorf("expected the oldest events to be dropped, first is %d", got[0].Seq)
+	}
+}
+
+func TestEventLogPersists(t *testing.T) {
+	dir := t.TempDir()
+	n, err := Open(dir, "localhost:9000", 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to open node: %v", err)
+	}
+	n.Mine()
+
+	reopened, err := Open(dir, "localhost:9000", 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to reopen node: %v", err)
+	}
+	events := reopened.Events(0)
+	if len(events) != 1 || events[0].Type != EventBlockAccepted || events[0].Fields["source"] != "mined" {
+		t.Fatalf("expected the mined block event to survive a restart, got %+v", events)
+	}
+
+	// Sequence numbers carry on from the saved log
+	reopened.StartMining(DefaultMiningInterval, 0)
+	reopened.StopMining()
+	if got := reopened.Events(1); len(got) != 2 || got[0].Seq != 2 {
+		t.Errorf("expected new events numbered after the saved ones, got %+v", got)
+	}
+}
+
+func TestEventLogCompactsFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), eventsFile)
+	l := newEventLog()
+	if err := l.open(filename); err != nil {
+		t.Fatalf("failed to open event log: %v", err)
+	}
+	for i := 0; i < 2*maxEvents+1; i++ {
+		if _, err := l.Record(EventMiningStopped, nil); err != nil {
+			t.Fatalf("failed to record event: %v", err)
+		}
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatalf("failed to open events file: %v", err)
+	}
+	defer f.Close()
+	lines := 0
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		lines++
+	}
+	if lines != maxEvents {
+		t.Errorf("expected the file to be compacted to %d events, got %d", maxEvents, lines)
+	}
+}
+
+func TestReorgEvent(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	n.Mine()
+
+	// A longer chain that doesn't contain our block
+	other := chain.New(1, 10.0)
+	other.AddBlock(nil, "someone")
+	other.AddBlock(nil, "someone")
+	other.Blocks[0] = n.Chain.Blocks[0]
+	n.adoptChain(other)
+
+	var reorgs, accepted int
+	for _, e := range n.Events(0) {
+		switch e.Type {
+		case EventReorg:
+			reorgs++
+			if e.Fields["dropped"] != 1 {
+				t.Errorf("expected 1 dropped block, got %v", e.Fields["dropped"])
+			}
+		case EventBlockAccepted:
+			accepted++
+		}
+	}
+	if reorgs != 1 {
+		t.Errorf("expected a reorg event, got %d", reorgs)
+	}
+	// Our mined block plus the two from the other chain
+	if accepted != 3 {
+		t.Errorf("expected 3 accepted blocks, got %d", accepted)
+	}
+}
+
+func TestEventHook(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	var got []Event
+	n.SetEventHook(func(e Event) { got = append(got, e) })
+	n.Mine()
+
+	if len(got) != 1 || got[0].Type != EventBlockAccepted || got[0].Fields["source"] != "mined" {
+		t.Fatalf("expected the mined block's event, got %+v", got)
+	}
+	if got[0].Seq != n.Events(0)[0].Seq {
+		t.Errorf("expected the hook to get the recorded event, got seq %d", got[0].Seq)
+	}
+}
+
+func TestHandleEvents(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	n.penalizePeer("localhost:9001", os.ErrInvalid)
+	h := n.Handler()
+
+	var events []Event
+	if code := getJSON(t, h, "/api/v1/events?since=0", &events); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if len(events) != 1 || events[0].Type != EventPeerPenalized || events[0].Fields["peer"] != "localhost:9001" {
+		t.Errorf("expected the penalty event, got %+v", events)
+	}
+	if code := getJSON(t, h, "/api/v1/events?since=-1", nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad since, got %d", code)
+	}
+}
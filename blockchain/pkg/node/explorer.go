@@ -0,0 +1,184 @@
+package node
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"strconv"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/pkg/httpserver"
+)
+
+const (
+	// defaultExplorerLimit is how many items list endpoints return by default
+	defaultExplorerLimit = 20
+
+	// maxExplorerLimit caps the limit parameter of list endpoints
+	maxExplorerLimit = 500
+)
+
+//go:embed explorer
+var explorerFiles embed.FS
+
+// explorerHandler serves the embedded block explorer UI under /explorer/
+func explorerHandler() http.Handler {
+	files, _ := fs.Sub(explorerFiles, "explorer")
+	return http.StripPrefix("/explorer/", http.FileServerFS(files))
+}
+
+// TxInfo is a transaction lookup result, confirmed or still pending
+type TxInfo struct {
+	Tx            *transaction.Transaction `json:"tx"`
+	Status        string                   `json:"status"` // "confirmed" or "pending"
+	Height        int64                    `json:"height,omitempty"`
+	BlockHash     string                   `json:"block_hash,omitempty"`
+	Confirmations int64                    `json:"confirmations,omitempty"`
+}
+
+// AddressInfo summarises an address for the explorer
+type AddressInfo struct {
+	Address      string                     `json:"address"`
+	Balance      float64                    `json:"balance"`
+	Transactions []chain.ConfirmedTx        `json:"transactions"` // newest first
+	Pending      []*transaction.Transaction `json:"pending"`
+}
+
+// queryLimit parses the optional "limit" parameter
+func queryLimit(r *http.Request) (int, bool) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return defaultExplorerLimit, true
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit < 1 {
+		return 0, false
+	}
+	return min(limit, maxExplorerLimit), true
+}
+
+// handleRecentBlocks returns the newest block headers, newest first
+func (n *Node) handleRecentBlocks(w http.ResponseWriter, r *http.Request) {
+	limit, ok := queryLimit(r)
+	if !ok {
+		http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+		return
+	}
+
+	blocks := n.Chain.RecentBlocks(limit)
+	headers := make([]block.Header, 0, len(blocks))
+	for _, b := range blocks {
+		headers = append(headers, b.Header())
+	}
+	httpserver.WriteJSON(w, http.StatusOK, headers)
+}
+
+// handleBlockLookup returns a full block by "hash" or "height"
+func (n *Node) handleBlockLookup(w http.ResponseWriter, r *http.Request) {
+	var (
+		b     *block.Block
+		found bool
+	)
+	query := r.URL.Query()
+	switch {
+	case query.Get("hash") != "":
+		b, found = n.Chain.BlockByHash(query.Get("hash"))
+	case query.Get("height") != "":
+		height, err := strconv.Atoi(query.Get("height"))
+		if err != nil {
+			http.Error(w, "height must be an integer", http.StatusBadRequest)
+			return
+		}
+		b, found = n.Chain.BlockByHeight(height)
+	default:
+		http.Error(w, "hash or height parameter required", http.StatusBadRequest)
+		return
+	}
+
+	if !found {
+		http.Error(w, "block not found", http.StatusNotFound)
+		return
+	}
+	httpserver.WriteJSON(w, http.StatusOK, b)
+}
+
+// handleBlockRange returns up to "limit" full blocks from height "from"
+// onwards, oldest first, for clients downloading the chain in batches
+func (n *Node) handleBlockRange(w http.ResponseWriter, r *http.Request) {
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil || from < 0 {
+		http.Error(w, "from must be a non-negative integer", http.StatusBadRequest)
+		return
+	}
+	limit, ok := queryLimit(r)
+	if !ok {
+		http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+		return
+	}
+	httpserver.WriteJSON(w, http.StatusOK, n.Chain.BlockRange(from, limit))
+}
+
+// handleTxLookup returns a transaction by "id", from the chain or the mempool
+func (n *Node) handleTxLookup(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "id parameter required", http.StatusBadRequest)
+		return
+	}
+
+	if confirmed, ok := n.Chain.Transaction(id); ok {
+		httpserver.WriteJSON(w, http.StatusOK, TxInfo{
+			Tx:            confirmed.Tx,
+			Status:        "confirmed",
+			Height:        confirmed.Height,
+			BlockHash:     confirmed.BlockHash,
+			Confirmations: confirmed.Confirmations,
+		})
+		return
+	}
+	if tx, ok := n.Mempool.Get(id); ok {
+		httpserver.WriteJSON(w, http.StatusOK, TxInfo{Tx: tx, Status: "pending"})
+		return
+	}
+	http.Error(w, "transaction not found", http.StatusNotFound)
+}
+
+// handleAddress returns an address's balance, recent history and pending transactions
+func (n *Node) handleAddress(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	if address == "" {
+		http.Error(w, "address parameter required", http.StatusBadRequest)
+		return
+	}
+	limit, ok := queryLimit(r)
+	if !ok {
+		http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+		return
+	}
+
+	pending := []*transaction.Transaction{}
+	for _, tx := range n.Mempool.GetAll() {
+		if tx.From == address || tx.To == address {
+			pending = append(pending, tx)
+		}
+	}
+
+	httpserver.WriteJSON(w, http.StatusOK, AddressInfo{
+		Address:      address,
+		Balance:      n.Chain.GetBalance(address),
+		Transactions: n.Chain.AddressHistory(address, limit),
+		Pending:      pending,
+	})
+}
+
+// handleMempool returns up to limit pending transactions
+func (n *Node) handleMempool(w http.ResponseWriter, r *http.Request) {
+	limit, ok := queryLimit(r)
+	if !ok {
+		http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+		return
+	}
+	httpserver.WriteJSON(w, http.StatusOK, n.Mempool.GetN(limit))
+}
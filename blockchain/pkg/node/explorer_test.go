@@ -0,0 +1,112 @@
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+)
+
+// getJSON requests a path from the handler and decodes a 200 response into v
+func getJSON(t *testing.T, h http.Handler, path string, v any) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if rec.Code == http.StatusOK && v != nil {
+		if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", path, err)
+		}
+	}
+	return rec.Code
+}
+
+func TestExplorerLookups(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	n.Mine()
+	n.Mine()
+	h := n.Handler()
+	tip := n.Chain.GetLatestBlock()
+
+	var headers []block.Header
+	if code := getJSON(t, h, "/api/v1/blocks?limit=2", &headers); code != http.StatusOK {
+		t.Fatalf("expected 200 for recent blocks, got %d", code)
+	}
+	if len(headers) != 2 || headers[0].Hash != tip.Hash {
+		t.Errorf("expected the 2 newest headers, newest first, got %+v", headers)
+	}
+
+	var b block.Block
+	if code := getJSON(t, h, "/api/v1/blocks/get?hash="+tip.Hash, &b); code != http.StatusOK || b.Index != tip.Index {
+		t.Errorf("expected block %d by hash, got %d (status %d)", tip.Index, b.Index, code)
+	}
+	if code := getJSON(t, h, "/api/v1/blocks/get?height=1", &b); code != http.StatusOK || b.Index != 1 {
+		t.Errorf("expected block 1 by height, got %d (status %d)", b.Index, code)
+	}
+	if code := getJSON(t, h, "/api/v1/blocks/get?hash=nope", nil); code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown block, got %d", code)
+	}
+
+	var info TxInfo
+	coinbase := tip.Transactions[0]
+	if code := getJSON(t, h, "/api/v1/tx?id="+coinbase.ID, &info); code != http.StatusOK {
+		t.Fatalf("expected 200 for confirmed tx, got %d", code)
+	}
+	if info.Status != "confirmed" || info.BlockHash != tip.Hash || info.Confirmations != 1 {
+		t.Errorf("unexpected tx info %+v", info)
+	}
+
+	var addr AddressInfo
+	getJSON(t, h, "/api/v1/address?address="+n.Wallet.Address(), &addr)
+	if len(addr.Transactions) != 2 || addr.Balance != 20 {
+		t.Errorf("expected 2 rewards totalling 20, got %d transactions and balance %.2f", len(addr.Transactions), addr.Balance)
+	}
+}
+
+func TestExplorerPendingTransaction(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	n.Mine()
+	tx := transaction.New(n.Wallet.Address(), "bob", 1)
+	tx.Sign(n.Wallet.PrivateKey)
+	if err := n.Mempool.Add(tx); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	h := n.Handler()
+
+	var info TxInfo
+	getJSON(t, h, "/api/v1/tx?id="+tx.ID, &info)
+	if info.Status != "pending" {
+		t.Errorf("expected a pending transaction, got %q", info.Status)
+	}
+
+	var addr AddressInfo
+	getJSON(t, h, "/api/v1/address?address=bob", &addr)
+	if len(addr.Pending) != 1 || len(addr.Transactions) != 0 {
+		t.Errorf("expected bob to have 1 pending and no confirmed transactions, got %+v", addr)
+	}
+}
+
+func TestExplorerRoutesAreVersionedOnly(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	h := n.Handler()
+
+	if code := getJSON(t, h, "/blocks", nil); code != http.StatusNotFound {
+		t.Errorf("new routes should not get an unversioned alias, got %d", code)
+	}
+	if code := getJSON(t, h, "/api/v1/blocks?limit=x", nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad limit, got %d", code)
+	}
+}
+
+func TestExplorerUI(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	rec := httptest.NewRecorder()
+	n.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/explorer/", nil))
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Block Explorer") {
+		t.Errorf("expected the explorer page, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,144 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+// corruptSuffix is appended to the chain store's name for the copy Fsck
+// keeps before repairing it
+const corruptSuffix = ".corrupt"
+
+// FsckReport is the result of checking the chain in a data directory
+type FsckReport struct {
+	chain.CheckReport
+	Repaired bool   `json:"repaired"`
+	Height   int    `json:"height"`           // tip height after any repair
+	Backup   string `json:"backup,omitempty"` // copy of the chain store taken before repairing
+}
+
+// Fsck checks the chain saved in a data directory block by block, including
+// every transfer's signature. A block that no longer decodes,
+// or a store damaged past some block, counts as a fault too. With repair, a
+// faulty chain is cut back to the last valid block and saved, keeping the
+// original store alongside. The node using dataDir must be stopped first.
+func Fsck(dataDir string, repair bool) (FsckReport, error) {
+	filename := ChainPath(dataDir)
+	if _, err := os.Stat(filename); errors.Is(err, fs.ErrNotExist) {
+		if _, legacyErr := os.Stat(filepath.Join(dataDir, legacyFile)); legacyErr == nil {
+			return FsckReport{}, fmt.Errorf("%s hasn't been moved into %s yet; start the node once to do so", legacyFile, chainFile)
+		}
+		return FsckReport{}, err
+	}
+	s, err := chain.OpenStore(filename)
+	if err != nil {
+		return FsckReport{}, err
+	}
+	defer s.Close()
+
+	c, fault, err := readStore(s)
+	if err != nil {
+		return FsckReport{}, err
+	}
+
+	// The node's own transfers may predate carried public keys
+	if w, err := wallet.LoadFromFile(filepath.Join(dataDir, walletFile)); err == nil {
+		c.RegisterPublicKey(w.Address(), w.PublicKey)
+	}
+
+	report := FsckReport{CheckReport: c.Check()}
+	report.Blocks = s.Len()
+	if report.Fault == nil {
+		report.Fault = fault
+	}
+	report.Height = max(s.Len()-1, 0)
+	if report.Fault == nil || !repair {
+		return report, nil
+	}
+
+	if report.Fault.Height == 0 {
+		return report, errors.New("the genesis block is corrupt, so there is nothing valid to keep; restore from a snapshot or a peer")
+	}
+	report.Backup = filename + corruptSuffix
+	if err := copyFile(filename, report.Backup); err != nil {
+		return report, fmt.Errorf("failed to back up chain: %w", err)
+	}
+	if err := s.Repair(); err != nil {
+		return report, fmt.Errorf("failed to repair chain store: %w", err)
+	}
+	if report.Fault.Height < c.Length() {
+		if err := c.Truncate(report.Fault.Height); err != nil {
+			return report, err
+		}
+	}
+	if err := c.SaveTo(s); err != nil {
+		return report, fmt.Errorf("failed to save repaired chain: %w", err)
+	}
+	report.Repaired = true
+	report.Height = report.Fault.Height - 1
+	return report, nil
+}
+
+// readStore reads a saved chain one block at a time, stopping at the first
+// block that doesn't decode and describing it as a fault. Damage to the store
+// after its last readable block is a fault at the height that follows, and a
+// block whose transactions can't be applied is a fault at its own height.
+func readStore(s *chain.KVStore) (*chain.Chain, *chain.Fault, error) {
+	params, err := s.Params()
+	if err != nil {
+		return nil, nil, err
+	}
+	if s.Len() == 0 {
+		return nil, nil, errors.New("chain store holds no blocks")
+	}
+
+	c := &chain.Chain{Difficulty: params.Difficulty, MiningReward: params.MiningReward, Emission: params.Emission, Accounting: params.Accounting}
+	var fault *chain.Fault
+	for b, err := range chain.StoredBlocks(s, 0) {
+		if err != nil {
+			fault = &chain.Fault{Height: len(c.Blocks), Reason: err.Error()}
+			break
+		}
+		c.Blocks = append(c.Blocks, b)
+	}
+	if err := s.Damaged(); fault == nil && err != nil {
+		fault = &chain.Fault{Height: s.Len(), Reason: fmt.Sprintf("store is damaged after the last block: %v", err)}
+	}
+
+	// Under UTXO accounting a transaction spending coins that aren't there
+	// stops the state being rebuilt at all, so find the block as Check does
+	// and report it, as a bad balance would be, rather than give up
+	if err := c.RebuildState(); err != nil {
+		report := c.Check()
+		if report.Fault == nil {
+			return nil, nil, err
+		}
+		fault = report.Fault
+	}
+	return c, fault, nil
+}
+
+// copyFile copies src to dst, replacing it
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
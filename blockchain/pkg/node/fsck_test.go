@@ -0,0 +1,221 @@
+package node
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+)
+
+// openMined opens a node in a temporary data directory and mines blocks on it
+func openMined(t *testing.T, blocks int) (*Node, string) {
+	t.Helper()
+	dir := t.TempDir()
+	n, err := Open(dir, "localhost:9000", 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to open node: %v", err)
+	}
+	for range blocks {
+		if err := n.Mine(); err != nil {
+			t.Fatalf("failed to mine: %v", err)
+		}
+	}
+	return n, dir
+}
+
+// tamperBlock changes the saved block at height with edit, leaving the blocks
+// after it as they were
+func tamperBlock(t *testing.T, dir string, height int, edit func(*block.Block)) {
+	t.Helper()
+	s, err := chain.OpenStore(ChainPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	params, _ := s.Params()
+	var blocks []*block.Block
+	for h := height; h < s.Len(); h++ {
+		b, err := s.Block(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, b)
+	}
+	edit(blocks[0])
+	if err := s.Save(params, height, blocks); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// flipByte damages the chain store at the first occurrence of marker
+func flipByte(t *testing.T, dir, marker string) {
+	t.Helper()
+	filename := ChainPath(dir)
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := bytes.Index(data, []byte(marker))
+	if i < 0 {
+		t.Fatalf("%q not found in chain store", marker)
+	}
+	data[i] ^= 0xff
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFsckValidChain(t *testing.T) {
+	n, dir := openMined(t, 2)
+	tx := transaction.New(n.Wallet.Address(), "bob", 4.0)
+	tx.Sign(n.Wallet.PrivateKey)
+	if err := n.Mempool.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+	n.Mine()
+
+	report, err := Fsck(dir, false)
+	if err != nil {
+		t.Fatalf("fsck failed: %v", err)
+	}
+	if report.Fault != nil || report.Blocks != 4 || report.Height != 3 {
+		t.Errorf("expected a clean 4-block chain, got %+v", report)
+	}
+	if report.Verified != 1 {
+		t.Errorf("expected the node's transfer to be verified, got %+v", report)
+	}
+}
+
+func TestFsckRepair(t *testing.T) {
+	_, dir := openMined(t, 3)
+	tamperBlock(t, dir, 2, func(b *block.Block) { b.Nonce++ })
+
+	report, err := Fsck(dir, false)
+	if err != nil {
+		t.Fatalf("fsck failed: %v", err)
+	}
+	if report.Fault == nil || report.Fault.Height != 2 || report.Repaired {
+		t.Fatalf("expected an unrepaired fault at height 2, got %+v", report)
+	}
+
+	report, err = Fsck(dir, true)
+	if err != nil {
+		t.Fatalf("repair failed: %v", err)
+	}
+	if !report.Repaired || report.Height != 1 {
+		t.Errorf("expected the chain cut back to height 1, got %+v", report)
+	}
+	if _, err := os.Stat(report.Backup); err != nil {
+		t.Errorf("expected a backup of the corrupt chain: %v", err)
+	}
+
+	report, err = Fsck(dir, false)
+	if err != nil || report.Fault != nil || report.Blocks != 2 {
+		t.Errorf("expected the repaired chain to pass, got %+v, %v", report, err)
+	}
+	reopened, err := Open(dir, "localhost:9000", 1, 10.0)
+	if err != nil || reopened.Chain.Length() != 2 || !reopened.Chain.IsValid() {
+		t.Errorf("expected the repaired chain to reopen, got %v", err)
+	}
+}
+
+func TestFsckDamagedStore(t *testing.T) {
+	n, dir := openMined(t, 2)
+	// Block 2's hash first appears in the frame that saved it
+	flipByte(t, dir, n.Chain.Blocks[2].Hash)
+
+	if _, err := Open(dir, "localhost:9000", 1, 10.0); err == nil || !strings.Contains(err.Error(), "fsck") {
+		t.Errorf("expected a damaged store to be refused, pointing at fsck, got %v", err)
+	}
+
+	report, err := Fsck(dir, false)
+	if err != nil {
+		t.Fatalf("fsck failed: %v", err)
+	}
+	if report.Fault == nil || report.Fault.Height != 2 || !strings.Contains(report.Fault.Reason, "damaged") {
+		t.Errorf("expected damage found at height 2, got %+v", report.Fault)
+	}
+	if report.Blocks != 2 {
+		t.Errorf("expected the 2 blocks before the damage counted, got %d", report.Blocks)
+	}
+
+	report, err = Fsck(dir, true)
+	if err != nil || !report.Repaired || report.Height != 1 {
+		t.Fatalf("expected the damage cut away, got %+v, %v", report, err)
+	}
+	reopened, err := Open(dir, "localhost:9000", 1, 10.0)
+	if err != nil || reopened.Chain.Length() != 2 {
+		t.Fatalf("expected the repaired chain to reopen, got %v", err)
+	}
+	if err := reopened.Mine(); err != nil {
+		t.Errorf("expected the repaired store to take new blocks: %v", err)
+	}
+}
+
+func TestFsckUTXOChain(t *testing.T) {
+	dir := t.TempDir()
+	c := chain.New(1, 10.0)
+	if err := c.SetAccounting(chain.AccountingUTXO); err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		if err := c.AddBlock(nil, "miner"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := chain.OpenStore(ChainPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SaveTo(s); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	// Spending coins nobody has stops the UTXO set being rebuilt
+	tamperBlock(t, dir, 2, func(b *block.Block) {
+		tx := transaction.New("mallory", "bob", 1000.0)
+		tx.ID = tx.Hash()
+		b.Transactions = append(b.Transactions, tx)
+	})
+	report, err := Fsck(dir, false)
+	if err != nil {
+		t.Fatalf("fsck failed: %v", err)
+	}
+	if report.Fault == nil || report.Fault.Height != 2 || report.Repaired {
+		t.Fatalf("expected an unrepaired fault at height 2, got %+v", report)
+	}
+
+	report, err = Fsck(dir, true)
+	if err != nil || !report.Repaired || report.Height != 1 {
+		t.Fatalf("expected the bad block cut away, got %+v, %v", report, err)
+	}
+	s, err = chain.OpenStore(ChainPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	loaded, err := chain.Load(s)
+	if err != nil || loaded.Length() != 2 || loaded.Accounting != chain.AccountingUTXO {
+		t.Errorf("expected the repaired UTXO chain to load, got %v", err)
+	}
+}
+
+func TestFsckCorruptGenesis(t *testing.T) {
+	_, dir := openMined(t, 1)
+	tamperBlock(t, dir, 0, func(b *block.Block) {
+		b.Transactions = append(b.Transactions, transaction.New("COINBASE", "x", 1))
+	})
+
+	report, err := Fsck(dir, true)
+	if err == nil || !strings.Contains(err.Error(), "genesis") {
+		t.Errorf("expected a corrupt genesis block to be unrepairable, got %v", err)
+	}
+	if report.Fault == nil || report.Fault.Height != 0 || report.Repaired {
+		t.Errorf("expected an unrepaired fault at genesis, got %+v", report)
+	}
+}
@@ -0,0 +1,72 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+)
+
+// fuzzPeer is a peer in memory answering /headers and /chain with whatever
+// the fuzzer gives it, and anything else with an empty object
+type fuzzPeer struct {
+	headers []byte
+	chain   []byte
+}
+
+func (p fuzzPeer) RoundTrip(r *http.Request) (*http.Response, error) {
+	body := []byte("{}")
+	switch r.URL.Path {
+	case "/headers":
+		body = p.headers
+	case "/chain":
+		body = p.chain
+	}
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(bytes.NewReader(body)), Request: r}, nil
+}
+
+func FuzzPeerChain(f *testing.F) {
+	// A longer chain with a payment in it, as an honest peer would send it
+	source, _ := New("localhost:9000", 1, 10.0)
+	source.Chain.AddBlock(nil, source.Wallet.Address())
+	tx := transaction.New(source.Wallet.Address(), "bob", 2.5)
+	tx.Sign(source.Wallet.PrivateKey)
+	source.Chain.AddBlock([]*transaction.Transaction{tx}, source.Wallet.Address())
+	headers, _ := json.Marshal(source.Chain.Headers(0))
+	peerChain, _ := json.Marshal(source.Chain)
+	f.Add(headers, peerChain)
+	f.Add(headers, []byte(`{"blocks":[null]}`))
+	f.Add(headers, bytes.Replace(peerChain, []byte(`"amount":2.5`), []byte(`"amount":2500`), 1))
+	f.Add([]byte(`[{"index":0},{"index":99}]`), []byte(`{"blocks":[{"index":0}],"difficulty":0}`))
+
+	f.Fuzz(func(t *testing.T, headers, chain []byte) {
+		n, err := New("localhost:9001", 1, 10.0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer n.Shutdown()
+		n.logger = slog.New(slog.DiscardHandler)
+		n.SetHTTPClient(&http.Client{Transport: fuzzPeer{headers: headers, chain: chain}})
+		n.Peers = []string{"peer.test:8080"}
+		before, tip := n.Chain.Length(), n.Chain.GetLatestBlock().Hash
+
+		// Whatever the peer sends, the node keeps a valid chain, and only
+		// gives up its own for a longer one mined under the same rules
+		n.syncRound(t.Context())
+		if !n.Chain.IsValid() {
+			t.Fatalf("adopted an invalid chain from headers %q and chain %q", headers, chain)
+		}
+		if n.Chain.GetLatestBlock().Hash != tip {
+			if n.Chain.Length() <= before {
+				t.Errorf("gave up its chain for one no longer, from %q", chain)
+			}
+			if n.Chain.Difficulty != 1 || n.Chain.MiningReward != 10.0 {
+				t.Errorf("adopted a chain with difficulty %d and reward %.2f from %q", n.Chain.Difficulty, n.Chain.MiningReward, chain)
+			}
+		}
+	})
+}
@@ -0,0 +1,37 @@
+package node
+
+import (
+	"fmt"
+
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+)
+
+// UseGenesis starts the node's chain from a genesis spec, with its premined
+// balances, in place of the genesis block the node mined itself. A chain
+// that already has blocks must have started from the same genesis block.
+// From then on peers on another genesis block are refused, even before
+// either side has mined anything.
+func (n *Node) UseGenesis(g *chain.Genesis) error {
+	if n.regtest && g.Difficulty > MaxRegtestDifficulty {
+		return fmt.Errorf("regtest difficulty must be at most %d, got %d", MaxRegtestDifficulty, g.Difficulty)
+	}
+	c, err := chain.NewFromGenesis(g)
+	if err != nil {
+		return err
+	}
+
+	genesis := c.GetLatestBlock()
+	if n.Chain.Length() > 1 {
+		if ours, _ := n.Chain.BlockByHeight(0); ours.Hash != genesis.Hash {
+			return fmt.Errorf("the chain starts from genesis block %s, not %s from the genesis spec", ours.Hash, genesis.Hash)
+		}
+	} else {
+		if err := n.Chain.ReplaceWith(c); err != nil {
+			return err
+		}
+		n.persistChain()
+	}
+	n.fixedGenesis = true
+	n.logger.Info("using genesis spec", "hash", genesis.Hash, "allocations", len(g.Alloc))
+	return nil
+}
@@ -0,0 +1,51 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+)
+
+func TestUseGenesis(t *testing.T) {
+	dir := t.TempDir()
+	n, err := Open(dir, "localhost:9000", 3, 50.0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := &chain.Genesis{
+		Timestamp:    time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+		Difficulty:   1,
+		MiningReward: 10.0,
+		Alloc:        map[string]float64{n.Wallet.Address(): 500.0},
+	}
+	if err := n.UseGenesis(spec); err != nil {
+		t.Fatal(err)
+	}
+	if n.Chain.Difficulty != 1 || n.Chain.GetBalance(n.Wallet.Address()) != 500.0 {
+		t.Fatalf("expected the spec's difficulty and premine, got difficulty %d balance %.2f",
+			n.Chain.Difficulty, n.Chain.GetBalance(n.Wallet.Address()))
+	}
+	if err := n.Mine(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Restarting with the same spec carries on from the saved chain
+	reopened, err := Open(dir, "localhost:9000", 3, 50.0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.UseGenesis(spec); err != nil {
+		t.Fatalf("expected the saved chain to match its spec: %v", err)
+	}
+	if reopened.Chain.Length() != 2 || reopened.Chain.GetBalance(n.Wallet.Address()) != 510.0 {
+		t.Errorf("expected the saved chain kept, got %d blocks", reopened.Chain.Length())
+	}
+
+	// but a different spec doesn't fit it
+	other := *spec
+	other.Alloc = map[string]float64{"mallory": 1000.0}
+	if err := reopened.UseGenesis(&other); err == nil {
+		t.Error("expected a chain from another genesis block to be refused")
+	}
+}
@@ -0,0 +1,171 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+	"github.com/oksmith/home-server/pkg/httpserver"
+)
+
+// ProtocolVersion is the version of the peer protocol this node speaks.
+// Bump it when peers need to change how they talk to each other.
+const ProtocolVersion = 1
+
+// MinProtocolVersion is the oldest protocol version this node still talks to
+const MinProtocolVersion = 1
+
+// Network IDs exchanged in the handshake
+const (
+	NetworkMain    = "main"
+	NetworkRegtest = "regtest"
+)
+
+// handshakeTimeout bounds the handshake made before adding a peer
+const handshakeTimeout = 5 * time.Second
+
+// maxHandshakeSize caps a handshake body in either direction
+const maxHandshakeSize = 4 << 10
+
+// ErrIncompatiblePeer is returned when a peer is on another network or
+// speaks a protocol version this node doesn't support
+var ErrIncompatiblePeer = errors.New("incompatible peer")
+
+// Handshake is what two nodes tell each other before they exchange any data
+type Handshake struct {
+	Version            string `json:"version"`
+	ProtocolVersion    int    `json:"protocol_version"`
+	MinProtocolVersion int    `json:"min_protocol_version"`
+	ChainRulesVersion  int    `json:"chain_rules_version,omitempty"` // 0 from nodes older than the field
+	Network            string `json:"network"`
+	GenesisHash        string `json:"genesis_hash"`
+	BestHeight         int    `json:"best_height"`
+	Address            string `json:"address,omitempty"`
+}
+
+// Network returns the ID of the network this node is on
+func (n *Node) Network() string {
+	if n.regtest {
+		return NetworkRegtest
+	}
+	return NetworkMain
+}
+
+// localHandshake describes this node to a peer
+func (n *Node) localHandshake() Handshake {
+	genesis, _ := n.Chain.BlockByHeight(0)
+	return Handshake{
+		Version:            Version,
+		ProtocolVersion:    ProtocolVersion,
+		MinProtocolVersion: MinProtocolVersion,
+		ChainRulesVersion:  chain.RulesVersion,
+		Network:            n.Network(),
+		GenesisHash:        genesis.Hash,
+		BestHeight:         n.Chain.Length() - 1,
+		Address:            n.Address,
+	}
+}
+
+// checkHandshake reports why a peer can't be talked to, if it can't.
+// Separately started nodes each mine their own genesis block until one adopts
+// the other's chain, so genesis blocks only have to match once both sides
+// have history of their own, or straight away for a node started from a
+// genesis spec.
+func (n *Node) checkHandshake(h Handshake) error {
+	local := n.localHandshake()
+	switch {
+	case h.Network != local.Network:
+		return fmt.Errorf("%w: network %q, want %q", ErrIncompatiblePeer, h.Network, local.Network)
+	case h.ProtocolVersion < MinProtocolVersion || h.MinProtocolVersion > ProtocolVersion:
+		return fmt.Errorf("%w: protocol version %d (min %d), we speak %d (min %d)",
+			ErrIncompatiblePeer, h.ProtocolVersion, h.MinProtocolVersion, ProtocolVersion, MinProtocolVersion)
+	case h.GenesisHash != local.GenesisHash && (n.fixedGenesis || h.BestHeight > 0 && local.BestHeight > 0):
+		return fmt.Errorf("%w: genesis block %s, want %s", ErrIncompatiblePeer, h.GenesisHash, local.GenesisHash)
+	}
+	return nil
+}
+
+// handshake exchanges handshakes with a peer. It returns a nil handshake and
+// no error for peers too old to know the handshake, which are still trusted
+// to sort themselves out as they always have.
+func (n *Node) handshake(ctx context.Context, peer string) (*Handshake, error) {
+	body, err := json.Marshal(n.localHandshake())
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := n.requestPeerOnce(ctx, peer, http.MethodPost, APIPrefix+"/handshake", body, maxHandshakeSize)
+	var statusErr *peerStatusError
+	switch {
+	case errors.As(err, &statusErr) && statusErr.status == http.StatusNotFound:
+		return nil, nil
+	case errors.As(err, &statusErr) && statusErr.status == http.StatusConflict:
+		return nil, fmt.Errorf("%w: peer %s rejected our handshake", ErrIncompatiblePeer, peer)
+	case err != nil:
+		return nil, err
+	}
+
+	var remote Handshake
+	if err := json.Unmarshal(data, &remote); err != nil || remote.ProtocolVersion == 0 {
+		return nil, fmt.Errorf("invalid handshake from %s", peer)
+	}
+	if err := n.checkHandshake(remote); err != nil {
+		return nil, err
+	}
+	return &remote, nil
+}
+
+// greetPeer handshakes with a new peer and reports whether it may be added.
+// Only a definite incompatibility keeps it out: peers that are unreachable
+// right now are added as before and may come online later.
+func (n *Node) greetPeer(peer string) bool {
+	ctx, cancel := context.WithTimeout(n.ctx, handshakeTimeout)
+	defer cancel()
+
+	remote, err := n.handshake(ctx, peer)
+	switch {
+	case errors.Is(err, ErrIncompatiblePeer):
+		n.logger.Warn("rejected peer", "peer", peer, "err", err)
+		n.recordEvent(EventPeerRejected, map[string]any{"peer": peer, "reason": err.Error()})
+		return false
+	case err != nil:
+		n.logger.Debug("handshake failed", "peer", peer, "err", err)
+	case remote != nil:
+		n.logger.Debug("handshake complete", "peer", peer, "version", remote.Version,
+			"protocol", remote.ProtocolVersion, "best_height", remote.BestHeight)
+		// Peers on other chain rules still talk to us, but may reject our
+		// blocks or send ones we reject until both are upgraded
+		if remote.ChainRulesVersion != 0 && remote.ChainRulesVersion != chain.RulesVersion {
+			n.logger.Warn("peer follows different chain rules", "peer", peer, "version", remote.Version,
+				"chain_rules_version", remote.ChainRulesVersion, "ours", chain.RulesVersion)
+		}
+	}
+	return true
+}
+
+// handleHandshake returns this node's handshake. A POST carries the caller's
+// handshake and is refused with 409 Conflict when the two are incompatible.
+func (n *Node) handleHandshake(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var remote Handshake
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxHandshakeSize)).Decode(&remote); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := n.checkHandshake(remote); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	httpserver.WriteJSON(w, http.StatusOK, n.localHandshake())
+}
@@ -0,0 +1,91 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+)
+
+func TestHandshakeAddsCompatiblePeer(t *testing.T) {
+	a := startTestNode(t)
+	b := startTestNode(t)
+	b.Chain.AddBlock(nil, b.Wallet.Address())
+
+	// a is still on its own genesis block, so it can join b's chain
+	a.AddPeer(b.Address)
+	if peers := a.GetPeers(); len(peers) != 1 || peers[0] != b.Address {
+		t.Errorf("expected compatible peer to be added, got %v", peers)
+	}
+
+	var h Handshake
+	if status := getJSON(t, b.Handler(), APIPrefix+"/handshake", &h); status != http.StatusOK {
+		t.Fatalf("expected 200, got %d", status)
+	}
+	if h.Network != NetworkMain || h.ProtocolVersion != ProtocolVersion || h.BestHeight != 1 || h.Address != b.Address {
+		t.Errorf("unexpected handshake %+v", h)
+	}
+}
+
+func TestHandshakeRejectsIncompatiblePeers(t *testing.T) {
+	tests := map[string]func(a, b *Node){
+		"other network": func(a, b *Node) {
+			b.EnableRegtest()
+		},
+		"diverged genesis": func(a, b *Node) {
+			a.Chain.AddBlock(nil, a.Wallet.Address())
+			b.Chain.AddBlock(nil, b.Wallet.Address())
+		},
+		"other genesis spec": func(a, b *Node) {
+			a.UseGenesis(&chain.Genesis{Timestamp: time.Now(), Difficulty: 1, Alloc: map[string]float64{"alice": 10.0}})
+		},
+	}
+
+	for name, setup := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := startTestNode(t)
+			b := startTestNode(t)
+			setup(a, b)
+
+			a.AddPeer(b.Address)
+			if peers := a.GetPeers(); len(peers) != 0 {
+				t.Errorf("expected incompatible peer to be rejected, got %v", peers)
+			}
+			events := a.Events(0)
+			if len(events) == 0 || events[len(events)-1].Type != EventPeerRejected {
+				t.Errorf("expected a %s event, got %+v", EventPeerRejected, events)
+			}
+		})
+	}
+}
+
+func TestHandleHandshakeRejectsProtocolVersion(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	h := n.localHandshake()
+	h.ProtocolVersion, h.MinProtocolVersion = ProtocolVersion+2, ProtocolVersion+1
+	body, _ := json.Marshal(h)
+
+	rec := httptest.NewRecorder()
+	n.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, APIPrefix+"/handshake", bytes.NewReader(body)))
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "protocol version") {
+		t.Errorf("expected 409 for an unsupported protocol, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandshakeAcceptsLegacyPeer(t *testing.T) {
+	// Nodes from before the handshake answer 404
+	srv := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(srv.Close)
+	peer := strings.TrimPrefix(srv.URL, "http://")
+
+	n, _ := New("localhost:9000", 1, 10.0)
+	n.AddPeer(peer)
+	if len(n.GetPeers()) != 1 {
+		t.Errorf("expected peer without a handshake endpoint to be added")
+	}
+}
@@ -0,0 +1,159 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/oksmith/home-server/blockchain/pkg/mempool"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/pkg/httpserver"
+)
+
+const (
+	// maxMempoolResponseSize caps how much of a peer's mempool response is read
+	maxMempoolResponseSize = 16 << 20
+
+	// mempoolBatchSize is how many transactions are requested from a peer at once
+	mempoolBatchSize = 500
+)
+
+// mempoolRequest is the body of POST /mempool/get
+type mempoolRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// SyncMempool fetches the pending transactions a peer has that we don't,
+// so a freshly started node doesn't have to wait for them to be rebroadcast.
+// It returns the number of transactions added.
+func (n *Node) SyncMempool(ctx context.Context, peer string) (int, error) {
+	data, err := n.fetchFromPeer(ctx, peer, "/mempool/ids", maxMempoolResponseSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []string
+	if err := json.Unmarshal(data, &ids); err != nil {
+		err = fmt.Errorf("malformed mempool IDs: %w", err)
+		n.penalizePeer(peer, err)
+		return 0, err
+	}
+
+	missing := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if _, exists := n.Mempool.Get(id); !exists {
+			missing = append(missing, id)
+		}
+	}
+
+	added := 0
+	for start := 0; start < len(missing); start += mempoolBatchSize {
+		batch := missing[start:min(start+mempoolBatchSize, len(missing))]
+		txs, err := n.fetchTransactions(ctx, peer, batch)
+		if err != nil {
+			return added, err
+		}
+		for _, tx := range txs {
+			if n.acceptTransaction(tx) == nil {
+				added++
+			}
+		}
+	}
+
+	if added > 0 {
+		n.logger.Info("synced mempool from peer", "peer", peer, "added", added)
+	}
+	return added, nil
+}
+
+// fetchTransactions requests the given pending transactions from a peer,
+// discarding any it sends that weren't asked for
+func (n *Node) fetchTransactions(ctx context.Context, peer string, ids []string) ([]*transaction.Transaction, error) {
+	data, err := n.postToPeer(ctx, peer, "/mempool/get", mempoolRequest{IDs: ids}, maxMempoolResponseSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var txs []*transaction.Transaction
+	if err := json.Unmarshal(data, &txs); err != nil {
+		err = fmt.Errorf("malformed mempool transactions: %w", err)
+		n.penalizePeer(peer, err)
+		return nil, err
+	}
+
+	requested := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		requested[id] = true
+	}
+	wanted := txs[:0]
+	for _, tx := range txs {
+		if tx != nil && requested[tx.ID] && tx.ID == tx.Hash() {
+			wanted = append(wanted, tx)
+		}
+	}
+	return wanted, nil
+}
+
+// handleMempoolIDs lists the IDs of all pending transactions
+func (n *Node) handleMempoolIDs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	txs := n.Mempool.GetAll()
+	ids := make([]string, 0, len(txs))
+	for _, tx := range txs {
+		ids = append(ids, tx.ID)
+	}
+	httpserver.WriteJSON(w, http.StatusOK, ids)
+}
+
+// handleMempoolGet returns the pending transactions with the requested IDs,
+// skipping any that are no longer in the mempool
+func (n *Node) handleMempoolGet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req mempoolRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMessageSize)).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) > mempoolBatchSize {
+		http.Error(w, fmt.Sprintf("at most %d IDs per request", mempoolBatchSize), http.StatusBadRequest)
+		return
+	}
+
+	txs := make([]*transaction.Transaction, 0, len(req.IDs))
+	for _, id := range req.IDs {
+		if tx, exists := n.Mempool.Get(id); exists {
+			txs = append(txs, tx)
+		}
+	}
+	httpserver.WriteJSON(w, http.StatusOK, txs)
+}
+
+// acceptTransaction adds a transaction to the mempool without relaying it,
+// marking it seen so a later broadcast of the same transaction is ignored
+func (n *Node) acceptTransaction(tx *transaction.Transaction) error {
+	if n.seenTxs.MarkSeen(tx.ID) {
+		return fmt.Errorf("transaction %s %w", tx.ID, mempool.ErrDuplicate)
+	}
+
+	if err := n.Mempool.Add(tx); err != nil {
+		// Don't let a rejected transaction block a later valid one with the same ID
+		n.seenTxs.Forget(tx.ID)
+		if !errors.Is(err, mempool.ErrDuplicate) {
+			n.logger.Debug("rejected transaction from peer mempool", "txid", tx.ID, "err", err)
+		}
+		return err
+	}
+
+	n.notifyTransaction(tx, nil)
+	return nil
+}
@@ -0,0 +1,92 @@
+package node
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+	"github.com/oksmith/home-server/pkg/httpserver"
+)
+
+// mempoolPeer serves a node's mempool endpoints over HTTP
+func mempoolPeer(t *testing.T, n *Node) string {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mempool/ids", n.handleMempoolIDs)
+	mux.HandleFunc("/mempool/get", n.handleMempoolGet)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+func TestSyncMempool(t *testing.T) {
+	source, _ := New("localhost:9000", 1, 10.0)
+	target, _ := New("localhost:9001", 1, 10.0)
+	sender, _ := wallet.New()
+
+	var shared *transaction.Transaction
+	for _, amount := range []float64{1, 2, 3} {
+		tx := transaction.New(sender.Address(), "bob", amount)
+		tx.Sign(sender.PrivateKey)
+		source.Mempool.Add(tx)
+		shared = tx
+	}
+	target.Mempool.Add(shared)
+
+	added, err := target.SyncMempool(t.Context(), mempoolPeer(t, source))
+	if err != nil {
+		t.Fatalf("mempool sync failed: %v", err)
+	}
+	if added != 2 {
+		t.Errorf("expected 2 missing transactions to be fetched, got %d", added)
+	}
+	if target.Mempool.Size() != 3 {
+		t.Errorf("expected 3 pending transactions, got %d", target.Mempool.Size())
+	}
+
+	// Synced transactions count as seen, so their later broadcast isn't relayed again
+	for _, tx := range source.Mempool.GetAll() {
+		if tx != shared && !target.seenTxs.MarkSeen(tx.ID) {
+			t.Errorf("synced transaction %s should be marked seen", tx.ID)
+		}
+	}
+
+	added, err = target.SyncMempool(t.Context(), mempoolPeer(t, source))
+	if err != nil || added != 0 {
+		t.Errorf("second sync should be a no-op, got %d added, %v", added, err)
+	}
+}
+
+func TestSyncMempoolIgnoresUnrequested(t *testing.T) {
+	sender, _ := wallet.New()
+	tx := transaction.New(sender.Address(), "bob", 1)
+	tx.Sign(sender.PrivateKey)
+	extra := transaction.New(sender.Address(), "mallory", 100)
+	extra.Sign(sender.PrivateKey)
+
+	// A peer that advertises one transaction but slips another into the response
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mempool/ids", func(w http.ResponseWriter, r *http.Request) {
+		httpserver.WriteJSON(w, http.StatusOK, []string{tx.ID})
+	})
+	mux.HandleFunc("/mempool/get", func(w http.ResponseWriter, r *http.Request) {
+		httpserver.WriteJSON(w, http.StatusOK, []*transaction.Transaction{tx, extra})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	n, _ := New("localhost:9001", 1, 10.0)
+	added, err := n.SyncMempool(t.Context(), strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatalf("mempool sync failed: %v", err)
+	}
+	if added != 1 {
+		t.Errorf("expected only the requested transaction, got %d", added)
+	}
+	if _, exists := n.Mempool.Get(extra.ID); exists {
+		t.Error("unrequested transaction should be discarded")
+	}
+}
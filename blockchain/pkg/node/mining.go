@@ -0,0 +1,160 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+	"github.com/oksmith/home-server/pkg/httpserver"
+)
+
+// DefaultMiningInterval is how often the mining loop checks for work when no interval is given
+const DefaultMiningInterval = 10 * time.Second
+
+// minerState tracks a running continuous mining loop
+type minerState struct {
+	stop          context.CancelFunc
+	interval      time.Duration
+	emptyInterval time.Duration
+}
+
+// StartMining continuously mines blocks until StopMining is called.
+// Every interval the node mines a block if the mempool has pending transactions.
+// If emptyInterval is positive, an empty block is also mined whenever the chain
+// tip is older than emptyInterval, keeping the chain moving on a quiet network.
+// A block in progress is abandoned as soon as a peer supplies a new tip.
+func (n *Node) StartMining(interval, emptyInterval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("mining interval must be positive")
+	}
+
+	n.miningMutex.Lock()
+	defer n.miningMutex.Unlock()
+
+	if n.miner != nil {
+		return fmt.Errorf("mining already running")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n.miner = &minerState{
+		stop:          cancel,
+		interval:      interval,
+		emptyInterval: emptyInterval,
+	}
+	go n.miningLoop(ctx, interval, emptyInterval)
+
+	n.logger.Info("mining started", "interval", interval, "empty_interval", emptyInterval)
+	n.recordEvent(EventMiningStarted, map[string]any{"interval": interval.String(), "empty_interval": emptyInterval.String()})
+	return nil
+}
+
+// StopMining stops the continuous mining loop and abandons any block in progress.
+// It reports whether mining was running.
+func (n *Node) StopMining() bool {
+	n.miningMutex.Lock()
+	defer n.miningMutex.Unlock()
+
+	if n.miner == nil {
+		return false
+	}
+	n.miner.stop()
+	n.miner = nil
+	if n.cancelBlock != nil {
+		n.cancelBlock()
+	}
+
+	n.logger.Info("mining stopped")
+	n.recordEvent(EventMiningStopped, nil)
+	return true
+}
+
+// MiningEnabled reports whether the continuous mining loop is running
+func (n *Node) MiningEnabled() bool {
+	n.miningMutex.Lock()
+	defer n.miningMutex.Unlock()
+	return n.miner != nil
+}
+
+// miningLoop mines blocks on every tick until ctx is cancelled
+func (n *Node) miningLoop(ctx context.Context, interval, emptyInterval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !n.shouldMine(emptyInterval) {
+			continue
+		}
+		// Losing a race to a peer's block is routine, not worth a warning
+		err := n.Mine()
+		if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, chain.ErrStaleTip) {
+			n.logger.Warn("mining failed", "err", err)
+		}
+	}
+}
+
+// shouldMine reports whether there is work worth mining a block for
+func (n *Node) shouldMine(emptyInterval time.Duration) bool {
+	if n.Mempool.Size() > 0 {
+		return true
+	}
+	return emptyInterval > 0 && n.clock.Now().Sub(n.Chain.GetLatestBlock().Timestamp) >= emptyInterval
+}
+
+// abortBlock abandons the block currently being mined, if any
+func (n *Node) abortBlock() {
+	n.miningMutex.Lock()
+	defer n.miningMutex.Unlock()
+
+	if n.cancelBlock != nil {
+		n.cancelBlock()
+	}
+}
+
+// SetMiningThrottle limits how much CPU mining uses. It applies straight
+// away, including to a block already being mined.
+func (n *Node) SetMiningThrottle(cfg block.ThrottleConfig) error {
+	if err := n.throttle.Set(cfg); err != nil {
+		return err
+	}
+	n.logger.Info("mining throttle set", "cpu_percent", cfg.CPUPercent, "max_hash_rate", cfg.MaxHashRate)
+	return nil
+}
+
+// MiningThrottle returns the current mining limits
+func (n *Node) MiningThrottle() block.ThrottleConfig {
+	return n.throttle.Config()
+}
+
+// handleMiningThrottle returns the mining limits, or on POST changes them.
+// Fields left out of the body keep their current values.
+func (n *Node) handleMiningThrottle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		cfg := n.MiningThrottle()
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMessageSize)).Decode(&cfg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := n.SetMiningThrottle(cfg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	httpserver.WriteJSON(w, http.StatusOK, n.MiningThrottle())
+}
@@ -0,0 +1,109 @@
+package node
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/clock"
+)
+
+func TestStartStopMining(t *testing.T) {
+	n, err := New("localhost:9000", 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+
+	// An empty interval of 1ns makes every tick mine an empty block
+	if err := n.StartMining(5*time.Millisecond, time.Nanosecond); err != nil {
+		t.Fatalf("failed to start mining: %v", err)
+	}
+	if err := n.StartMining(5*time.Millisecond, 0); err == nil {
+		t.Errorf("starting mining twice should fail")
+	}
+	if !n.MiningEnabled() {
+		t.Errorf("mining should be enabled")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for n.Chain.Length() < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n.Chain.Length() < 3 {
+		t.Fatalf("expected empty blocks to be mined, chain length is %d", n.Chain.Length())
+	}
+
+	if !n.StopMining() {
+		t.Errorf("StopMining should report mining was running")
+	}
+	if n.StopMining() {
+		t.Errorf("second StopMining should report mining was not running")
+	}
+	if n.MiningEnabled() {
+		t.Errorf("mining should be disabled")
+	}
+}
+
+func TestShouldMine(t *testing.T) {
+	n, err := New("localhost:9000", 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+
+	clk := clock.NewManual(n.Chain.GetLatestBlock().Timestamp)
+	n.SetClock(clk)
+
+	if n.shouldMine(0) {
+		t.Errorf("should not mine with an empty mempool and no empty interval")
+	}
+	if n.shouldMine(time.Minute) {
+		t.Errorf("should not mine an empty block while the tip is fresh")
+	}
+	clk.Advance(time.Minute)
+	if !n.shouldMine(time.Minute) {
+		t.Errorf("should mine an empty block once the tip is as old as the empty interval")
+	}
+	if n.shouldMine(time.Hour) {
+		t.Errorf("should not mine an empty block while the tip is younger than the interval")
+	}
+}
+
+func TestHandleMiningThrottle(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+
+	var cfg block.ThrottleConfig
+	if status := getJSON(t, n.Handler(), APIPrefix+"/mining/throttle", &cfg); status != http.StatusOK || cfg != block.Unthrottled {
+		t.Fatalf("expected unthrottled mining by default, got %d %+v", status, cfg)
+	}
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		n.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, APIPrefix+"/mining/throttle", strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := post(`{"cpu_percent": 25}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", rec.Code, rec.Body.String())
+	}
+	// Fields left out keep their values
+	if rec := post(`{"max_hash_rate": 5000}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", rec.Code, rec.Body.String())
+	}
+	want := block.ThrottleConfig{CPUPercent: 25, MaxHashRate: 5000}
+	if got := n.MiningThrottle(); got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+	if got := n.Status().Mining.Throttle; got != want {
+		t.Errorf("expected status to report %+v, got %+v", want, got)
+	}
+
+	if rec := post(`{"cpu_percent": 0}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid limit, got %d", rec.Code)
+	}
+	if got := n.MiningThrottle(); got != want {
+		t.Errorf("invalid limits shouldn't be applied, got %+v", got)
+	}
+}
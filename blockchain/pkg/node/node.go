@@ -1,29 +1,75 @@
 package node
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/oksmith/home-server/blockchain/pkg/block"
 	"github.com/oksmith/home-server/blockchain/pkg/chain"
+	"github.com/oksmith/home-server/blockchain/pkg/clock"
 	"github.com/oksmith/home-server/blockchain/pkg/mempool"
 	"github.com/oksmith/home-server/blockchain/pkg/transaction"
 	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+	"github.com/oksmith/home-server/pkg/httpserver"
+	"github.com/oksmith/home-server/pkg/sigauth"
 )
 
 // Node represents a blockchain node with networking capabilities
 type Node struct {
-	Chain       *chain.Chain
-	Mempool     *mempool.Mempool
-	Wallet      *wallet.Wallet
-	Address     string   // This node's address (e.g., "localhost:8080")
-	Peers       []string // List of peer addresses
-	peersMutex  sync.RWMutex
-	isMining    bool
-	miningMutex sync.Mutex
+	Chain         *chain.Chain
+	Mempool       *mempool.Mempool
+	Wallet        *wallet.Wallet
+	Address       string   // This node's address as advertised to peers (e.g., "localhost:8080")
+	Peers         []string // List of peer addresses
+	peersMutex    sync.RWMutex
+	watches       map[string]Watch // Watch ID -> address webhook
+	watchesMutex  sync.RWMutex
+	alerts        map[string]*Alert // Alert ID -> rule checked on each block
+	alertsMutex   sync.RWMutex
+	isMining      bool
+	miningMutex   sync.Mutex
+	cancelBlock   context.CancelFunc      // aborts the block currently being mined
+	throttle      *block.Throttle         // CPU and hash rate limits for mining
+	miner         *minerState             // continuous mining loop, nil when stopped
+	pool          *pool                   // pool coordinator, nil unless pool mode is enabled
+	syncMutex     sync.Mutex              // serialises chain syncs from the sync loop and incoming blocks
+	seenTxs       *seenCache              // recently relayed transaction IDs
+	seenBlocks    *seenCache              // recently received block hashes
+	penalties     *peerPenalties          // strikes and bans for peers sending bad data
+	peerHealth    *peerHealth             // outcome of recent requests and broadcasts to peers
+	events        *eventLog               // recent significant events, for debugging
+	eventHook     func(Event)             // told of each event as it is recorded, if set
+	sessions      map[string]*peerSession // open WebSocket sessions by peer
+	sessionsCtx   context.Context         // set once StartPeerSessions runs
+	sessionsMutex sync.RWMutex
+	metrics       *httpserver.Metrics // per-route API request statistics
+	adminGuard    *httpserver.Guard   // locks out clients guessing the admin token
+	peerClient    PeerClientConfig
+	httpClient    *http.Client    // for requests to peers
+	gzipPeers     *gzipPeers      // peers that accept compressed request bodies
+	ctx           context.Context // cancelled by Shutdown
+	cancel        context.CancelFunc
+	adminMutex    sync.RWMutex
+	adminKeys     *sigauth.Keyring
+	listenAddr    string      // address the server binds to ("" uses Address)
+	dataDir       string      // where chain, wallet and peers are persisted ("" keeps everything in memory)
+	store         chain.Store // the chain's blocks on disk, with dataDir
+	corsOrigins   []string    // browser origins allowed to call read endpoints
+	adminToken    string      // bearer token for admin endpoints ("" disables them)
+	regtest       bool        // blocks can be generated on demand
+	fixedGenesis  bool        // the genesis block came from a genesis spec, and peers must share it
+	filter        *peerFilter // allow/deny rules for peers, nil allows everyone
+	startedAt     time.Time
+	clock         clock.Clock // the chain's and mempool's clock, also timing when to mine empty blocks
+	syncState     syncTracker
+	logger        *slog.Logger
 }
 
 // New creates a new blockchain node
@@ -33,35 +79,115 @@ func New(address string, difficulty int, miningReward float64) (*Node, error) {
 		return nil, err
 	}
 
-	c := chain.New(difficulty, miningReward)
+	return newNode(address, w, chain.New(difficulty, miningReward)), nil
+}
+
+// newNode wires a node around an existing wallet and chain
+func newNode(address string, w *wallet.Wallet, c *chain.Chain) *Node {
 	c.RegisterPublicKey(w.Address(), w.PublicKey)
 
+	throttle, _ := block.NewThrottle(block.Unthrottled)
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Node{
-		Chain:   c,
-		Mempool: mempool.New(),
-		Wallet:  w,
-		Address: address,
-		Peers:   make([]string, 0),
-	}, nil
+		Chain:      c,
+		Mempool:    mempool.New(),
+		Wallet:     w,
+		Address:    address,
+		Peers:      make([]string, 0),
+		watches:    make(map[string]Watch),
+		alerts:     make(map[string]*Alert),
+		seenTxs:    newSeenCache(seenTTL),
+		seenBlocks: newSeenCache(seenTTL),
+		penalties:  newPeerPenalties(),
+		peerHealth: newPeerHealth(),
+		events:     newEventLog(),
+		throttle:   throttle,
+		sessions:   make(map[string]*peerSession),
+		metrics:    httpserver.NewMetrics(),
+		adminGuard: httpserver.NewGuard(httpserver.DefaultLimits),
+		peerClient: DefaultPeerClientConfig,
+		httpClient: http.DefaultClient,
+		gzipPeers:  newGzipPeers(),
+		ctx:        ctx,
+		cancel:     cancel,
+		logger:     slog.Default().With("node", address),
+		startedAt:  time.Now(),
+		clock:      clock.System,
+	}
+}
+
+// SetClock replaces the clock timestamping the node's blocks and transactions
+// and timing its mempool, for example to control time in tests
+func (n *Node) SetClock(clk clock.Clock) {
+	n.clock = clk
+	n.Chain.SetClock(clk)
+	n.Mempool.SetClock(clk)
+}
+
+// SetEmission sets the chain's reward schedule, which the blocks already on
+// it must keep to, and saves the chain so the schedule survives a restart
+func (n *Node) SetEmission(e chain.Emission) error {
+	if err := n.Chain.SetEmission(e); err != nil {
+		return err
+	}
+	n.persistChain()
+	return nil
 }
 
-// AddPeer adds a peer to the node's peer list
+// AddPeer adds a peer to the node's peer list, after a handshake that keeps
+// out peers on another network or speaking an incompatible protocol
 func (n *Node) AddPeer(peerAddress string) {
+	if !n.isNewPeer(peerAddress) || !n.greetPeer(peerAddress) || !n.addPeer(peerAddress) {
+		return
+	}
+
+	n.logger.Info("added peer", "peer", peerAddress)
+	n.persistPeers()
+
+	n.startSession(peerAddress)
+
+	// Pick up whatever the new peer has pending rather than waiting for rebroadcasts
+	go func() {
+		if _, err := n.SyncMempool(n.ctx, peerAddress); err != nil {
+			n.logger.Debug("mempool sync failed", "peer", peerAddress, "err", err)
+		}
+	}()
+}
+
+// addPeer appends a peer under the lock and reports whether it was new
+func (n *Node) addPeer(peerAddress string) bool {
 	n.peersMutex.Lock()
 	defer n.peersMutex.Unlock()
 
-	// Don't add self or duplicates
-	if peerAddress == n.Address {
-		return
+	if !n.acceptsPeer(peerAddress) {
+		return false
+	}
+	n.Peers = append(n.Peers, peerAddress)
+	return true
+}
+
+// isNewPeer reports whether a peer would be added, so known peers aren't greeted again
+func (n *Node) isNewPeer(peerAddress string) bool {
+	n.peersMutex.RLock()
+	defer n.peersMutex.RUnlock()
+	return n.acceptsPeer(peerAddress)
+}
+
+// acceptsPeer reports whether a peer can join the list. The caller holds peersMutex.
+func (n *Node) acceptsPeer(peerAddress string) bool {
+	// Don't add self, duplicates, filtered peers or addresses we couldn't dial
+	if peerAddress == n.Address || !validPeerAddress(peerAddress) {
+		return false
+	}
+	if n.filter != nil && !n.filter.allowsPeer(peerAddress) {
+		return false
 	}
 	for _, peer := range n.Peers {
 		if peer == peerAddress {
-			return
+			return false
 		}
 	}
-
-	n.Peers = append(n.Peers, peerAddress)
-	fmt.Printf("[%s] Added peer: %s\n", n.Address, peerAddress)
+	return true
 }
 
 // GetPeers returns a copy of the peer list
@@ -74,102 +200,197 @@ func (n *Node) GetPeers() []string {
 	return peers
 }
 
-// BroadcastTransaction sends a transaction to all peers
-func (n *Node) BroadcastTransaction(tx *transaction.Transaction) {
-	peers := n.GetPeers()
-	for _, peer := range peers {
-		go func(peerAddr string) {
-			url := fmt.Sprintf("http://%s/transaction", peerAddr)
-			data, _ := json.Marshal(tx)
+// BroadcastTransaction sends a transaction to all peers, over their session
+// where one is open and HTTP otherwise. The report says how it went with each
+// peer, and the error joins those of the peers it failed to reach.
+func (n *Node) BroadcastTransaction(ctx context.Context, tx *transaction.Transaction) (BroadcastReport, error) {
+	return n.broadcast(ctx, MsgTx, "/transaction", tx)
+}
 
-			req, _ := http.NewRequest("POST", url, bytes.NewBuffer(data))
-			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("X-Node-Address", n.Address)
+// BroadcastBlock sends the latest block to all peers the same way
+func (n *Node) BroadcastBlock(ctx context.Context) (BroadcastReport, error) {
+	return n.broadcast(ctx, MsgBlock, "/block", n.Chain.GetLatestBlock())
+}
 
-			client := &http.Client{Timeout: 5 * time.Second}
-			client.Do(req)
-		}(peer)
+// broadcast delivers a message to every peer concurrently and waits for all
+// of them. The report is kept for GET /peers/status.
+func (n *Node) broadcast(ctx context.Context, msgType, path string, v any) (BroadcastReport, error) {
+	report := BroadcastReport{Type: msgType, Time: time.Now().UTC()}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return report, fmt.Errorf("encoding %s: %w", msgType, err)
 	}
-}
 
-// BroadcastBlock sends a block to all peers
-func (n *Node) BroadcastBlock() {
-	latestBlock := n.Chain.GetLatestBlock()
 	peers := n.GetPeers()
+	report.Peers = make([]PeerResult, len(peers))
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := PeerResult{Peer: peer, Via: "session"}
+			if s := n.session(peer); s != nil {
+				err := s.send(msgType, v)
+				if err == nil {
+					n.peerHealth.record(peer, nil)
+					report.Peers[i] = result
+					return
+				}
+				n.logger.Debug("peer session send failed, falling back to HTTP", "peer", peer, "type", msgType, "err", err)
+			}
 
-	for _, peer := range peers {
-		go func(peerAddr string) {
-			url := fmt.Sprintf("http://%s/block", peerAddr)
-			data, _ := json.Marshal(latestBlock)
+			result.Via = "http"
+			if _, err := n.requestPeer(ctx, peer, http.MethodPost, path, data, maxMessageSize); err != nil {
+				result.err = fmt.Errorf("%s: %w", peer, err)
+				result.Error = err.Error()
+				n.logger.Debug("broadcast to peer failed", "peer", peer, "type", msgType, "err", err)
+			}
+			report.Peers[i] = result
+		}()
+	}
+	wg.Wait()
 
-			req, _ := http.NewRequest("POST", url, bytes.NewBuffer(data))
-			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("X-Node-Address", n.Address)
+	n.peerHealth.recordBroadcast(report)
+	return report, report.Err()
+}
 
-			client := &http.Client{Timeout: 5 * time.Second}
-			client.Do(req)
-		}(peer)
+// relay broadcasts in the background for the node's lifetime, logging
+// failures: a warning when no peer could be reached, which may mean the node
+// is cut off from the network
+func (n *Node) relay(what string, broadcast func(context.Context) (BroadcastReport, error)) {
+	go func() {
+		report, err := broadcast(n.ctx)
+		if err == nil || n.ctx.Err() != nil {
+			return
+		}
+		if len(report.Peers) > 0 && report.Delivered() == 0 {
+			n.logger.Warn("failed to relay "+what+" to any peer", "peers", len(report.Peers), "err", err)
+			return
+		}
+		n.logger.Info("failed to relay "+what+" to some peers",
+			"delivered", report.Delivered(), "peers", len(report.Peers), "err", err)
+	}()
+}
+
+// announceTo tells a peer our address so it adds us to its peer list
+func (n *Node) announceTo(ctx context.Context, peer string) {
+	if _, err := n.postToPeer(ctx, peer, "/peers", map[string]string{"peer": n.Address}, maxMessageSize); err != nil {
+		n.logger.Debug("failed to announce to peer", "peer", peer, "err", err)
 	}
 }
 
-// SyncWithPeers synchronizes the chain with peers
-func (n *Node) SyncWithPeers() error {
-	peers := n.GetPeers()
+// SyncWithPeers synchronizes the chain with peers, giving up on any that are
+// still unreachable after retries or when ctx is cancelled
+func (n *Node) SyncWithPeers(ctx context.Context) error {
+	n.syncMutex.Lock()
+	defer n.syncMutex.Unlock()
+
+	n.syncState.begin()
+	defer n.syncState.end(nil)
+
+	peers := n.syncPeers()
 	if len(peers) == 0 {
 		return nil
 	}
 
 	// Announce ourselves to peers (helps establish bidirectional connections)
 	for _, peer := range peers {
-		go func(peerAddr string) {
-			url := fmt.Sprintf("http://%s/peers", peerAddr)
-			data := map[string]string{"peer": n.Address}
-			jsonData, _ := json.Marshal(data)
-			http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-		}(peer)
+		go n.announceTo(ctx, peer)
 	}
 
-	var longestChain *chain.Chain
-	maxLength := n.Chain.Length()
+	var bestChain *chain.Chain
+	bestWork := n.Chain.Work()
 
 	for _, peer := range peers {
-		url := fmt.Sprintf("http://%s/chain", peer)
-		resp, err := http.Get(url)
+		peerChain, err := n.fetchChain(ctx, peer)
 		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			n.logger.Debug("failed to fetch chain from peer", "peer", peer, "err", err)
 			continue
 		}
 
-		var peerChain chain.Chain
-		if err := json.NewDecoder(resp.Body).Decode(&peerChain); err != nil {
-			resp.Body.Close()
-			continue
+		// Check if peer's chain has more work (fetchChain has already fully validated it)
+		if work := peerChain.Work(); work.Cmp(bestWork) > 0 {
+			bestWork = work
+			bestChain = peerChain
 		}
-		resp.Body.Close()
+	}
 
-		// Rebuild the chain state (balances and public keys from blocks)
-		if err := peerChain.RebuildState(); err != nil {
-			continue
-		}
+	// Replace chain if a valid chain with more work was found
+	if bestChain != nil {
+		n.logger.Info("replacing chain with one with more work",
+			"height", bestChain.GetLatestBlock().Index, "work", bestWork.String())
+		return n.adoptChain(bestChain)
+	}
+
+	return nil
+}
+
+// adoptChain replaces the node's chain with a better one and reacts to the
+// blocks that are new to us. Callers must hold syncMutex.
+func (n *Node) adoptChain(better *chain.Chain) error {
+	oldTip := n.Chain.GetLatestBlock()
+	known := make(map[string]bool, n.Chain.Length())
+	for _, b := range n.Chain.Headers(0) {
+		known[b.Hash] = true
+	}
 
-		// Check if peer's chain is longer and valid
-		if peerChain.Length() > maxLength && peerChain.IsValid() {
-			maxLength = peerChain.Length()
-			longestChain = &peerChain
+	// Any of our blocks missing from the better chain are being rolled back
+	kept := make(map[string]bool, better.Length())
+	for b := range better.Iterator() {
+		kept[b.Hash] = true
+	}
+	var dropped []*block.Block
+	for hash := range known {
+		if !kept[hash] {
+			if b, ok := n.Chain.BlockByHash(hash); ok {
+				dropped = append(dropped, b)
+			}
 		}
 	}
+	sort.Slice(dropped, func(i, j int) bool { return dropped[i].Index < dropped[j].Index })
 
-	// Replace chain if a longer valid chain was found
-	if longestChain != nil {
-		fmt.Printf("[%s] Replacing chain with longer chain (length: %d)\n", n.Address, maxLength)
-		// Re-register our own public key with the new chain
-		longestChain.RegisterPublicKey(n.Wallet.Address(), n.Wallet.PublicKey)
-		n.Chain = longestChain
-		return nil
+	// Replace in place so registered public keys (including our own) are kept
+	if err := n.Chain.ReplaceWith(better); err != nil {
+		return err
 	}
 
+	var added []*block.Block
+	for b := range better.Iterator() {
+		if !known[b.Hash] {
+			added = append(added, b)
+		}
+	}
+	n.chainChanged(oldTip, dropped, added)
 	return nil
 }
 
+// chainChanged reacts to blocks from peers joining the chain, and to any a
+// reorg rolled back to make way for them. Callers must hold syncMutex.
+func (n *Node) chainChanged(oldTip *block.Block, dropped, added []*block.Block) {
+	if len(dropped) > 0 {
+		n.logger.Warn("chain reorganisation", "old_height", oldTip.Index, "dropped", len(dropped))
+		n.recordEvent(EventReorg, map[string]any{
+			"old_height": oldTip.Index,
+			"new_height": n.Chain.GetLatestBlock().Index,
+			"dropped":    len(dropped),
+		})
+	}
+	n.persistChain()
+
+	// Whatever we were mining now builds on a stale tip
+	n.abortBlock()
+
+	for _, b := range added {
+		n.Mempool.RemoveTransactions(b.Transactions)
+		n.recordEvent(EventBlockAccepted, map[string]any{"height": b.Index, "hash": b.Hash, "source": "peer"})
+		n.notifyBlock(b)
+	}
+	n.recoverOrphans(dropped)
+}
+
 // Mine attempts to mine a block with pending transactions
 func (n *Node) Mine() error {
 	n.miningMutex.Lock()
@@ -177,66 +398,121 @@ func (n *Node) Mine() error {
 		n.miningMutex.Unlock()
 		return fmt.Errorf("already mining")
 	}
+	ctx, cancel := context.WithCancel(block.WithThrottle(context.Background(), n.throttle))
 	n.isMining = true
+	n.cancelBlock = cancel
 	n.miningMutex.Unlock()
 
 	defer func() {
 		n.miningMutex.Lock()
 		n.isMining = false
+		n.cancelBlock = nil
 		n.miningMutex.Unlock()
+		cancel()
 	}()
 
 	// Get transactions from mempool
 	transactions := n.Mempool.GetAll()
 
-	fmt.Printf("[%s] Mining block with %d transactions...\n", n.Address, len(transactions))
+	n.logger.Info("mining block", "txs", len(transactions))
 
 	// Add block to chain
-	if err := n.Chain.AddBlock(transactions, n.Wallet.Address()); err != nil {
+	if err := n.Chain.AddBlockContext(ctx, transactions, n.Wallet.Address()); err != nil {
+		if errors.Is(err, context.Canceled) {
+			n.logger.Info("mining aborted")
+		}
 		return err
 	}
 
-	// Remove mined transactions from mempool
-	n.Mempool.RemoveTransactions(transactions)
-
-	// Broadcast the new block
-	n.BroadcastBlock()
-
-	fmt.Printf("[%s] Mined block %d!\n", n.Address, n.Chain.GetLatestBlock().Index)
-
+	n.blockMined(n.Chain.GetLatestBlock())
 	return nil
 }
 
-// StartMining continuously mines blocks
-func (n *Node) StartMining(interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	go func() {
-		for range ticker.C {
-			if n.Mempool.Size() > 0 {
-				n.Mine()
-			}
-		}
-	}()
+// blockMined finishes up after this node (or its pool) extends the chain
+func (n *Node) blockMined(b *block.Block) {
+	// Remove mined transactions from mempool
+	n.Mempool.RemoveTransactions(b.Transactions)
+	n.persistChain()
+
+	// Broadcast the new block, remembering it so peers echoing it back don't trigger a sync
+	n.seenBlocks.MarkSeen(b.Hash)
+	n.relay("block", n.BroadcastBlock)
+
+	n.logger.Info("mined block", "height", b.Index, "hash", b.Hash)
+	n.recordEvent(EventBlockAccepted, map[string]any{"height": b.Index, "hash": b.Hash, "source": "mined"})
+	n.notifyBlock(b)
 }
 
 // ReceiveTransaction handles incoming transactions from peers
 func (n *Node) ReceiveTransaction(tx *transaction.Transaction) error {
+	// Ignore transactions we've already relayed, otherwise peers bounce them back and forth
+	if n.seenTxs.MarkSeen(tx.ID) {
+		return nil
+	}
+
 	// Add to mempool
 	if err := n.Mempool.Add(tx); err != nil {
+		// Don't let a rejected transaction block a later valid one with the same ID
+		n.seenTxs.Forget(tx.ID)
 		return err
 	}
 
-	fmt.Printf("[%s] Received transaction: %s -> %s (%.2f coins)\n",
-		n.Address, tx.From[:8], tx.To[:8], tx.Amount)
+	n.logger.Info("received transaction", "txid", tx.ID, "from", tx.From, "to", tx.To, "amount", tx.Amount)
+	n.notifyTransaction(tx, nil)
 
 	// Relay to other peers
-	n.BroadcastTransaction(tx)
+	n.relay("transaction", func(ctx context.Context) (BroadcastReport, error) {
+		return n.BroadcastTransaction(ctx, tx)
+	})
 
 	return nil
 }
 
-// ReceiveBlock handles incoming blocks from peers
+// ReceiveBlock handles incoming blocks from peers. A block building on one
+// we know goes straight onto the chain or a side branch, switching to that
+// branch if it now has more work. A block whose parent we lack is held until
+// the parent arrives, and the node syncs with peers in case it never does.
 func (n *Node) ReceiveBlock(newBlock []byte) error {
-	// Sync with peers to get the full chain
-	return n.SyncWithPeers()
+	var b block.Block
+	if err := json.Unmarshal(newBlock, &b); err != nil {
+		return err
+	}
+
+	// Several peers usually announce the same block; only handle it once
+	if n.seenBlocks.MarkSeen(b.Hash) {
+		return nil
+	}
+
+	n.syncMutex.Lock()
+	oldTip := n.Chain.GetLatestBlock()
+	accepted, err := n.Chain.AcceptBlock(&b)
+	if err != nil {
+		n.syncMutex.Unlock()
+		n.recordEvent(EventBlockRejected, map[string]any{"hash": b.Hash, "reason": err.Error()})
+		n.seenBlocks.Forget(b.Hash)
+		return err
+	}
+	switch accepted.Status {
+	case chain.BlockSide:
+		n.logger.Info("block on a side branch", "height", b.Index, "hash", b.Hash)
+	case chain.BlockOrphan:
+		n.logger.Info("holding orphan block until its parent arrives", "height", b.Index, "hash", b.Hash)
+	}
+	if len(accepted.Connected) > 0 {
+		n.logger.Info("connected orphan blocks", "count", len(accepted.Connected))
+	}
+	if len(accepted.Added) > 0 {
+		n.chainChanged(oldTip, accepted.Dropped, accepted.Added)
+	}
+	n.syncMutex.Unlock()
+	if accepted.Status != chain.BlockOrphan {
+		return nil
+	}
+
+	// We're missing its parent, so see if the peers' chains have it. The
+	// block stays held either way, so a failed sync doesn't reject it.
+	if err := n.SyncWithPeers(n.ctx); err != nil {
+		n.logger.Debug("sync for an orphan block's parent failed", "hash", b.Hash, "err", err)
+	}
+	return nil
 }
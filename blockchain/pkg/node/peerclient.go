@@ -0,0 +1,151 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// PeerClientConfig controls how the node's HTTP requests to peers behave
+type PeerClientConfig struct {
+	Timeout time.Duration // limit for each attempt
+	Retries int           // further attempts after a failed one
+	Backoff time.Duration // wait before the first retry, doubling after each
+}
+
+// DefaultPeerClientConfig is used unless SetPeerClientConfig is called
+var DefaultPeerClientConfig = PeerClientConfig{
+	Timeout: 30 * time.Second,
+	Retries: 2,
+	Backoff: 500 * time.Millisecond,
+}
+
+// peerStatusError is returned when a peer answers with a non-200 status
+type peerStatusError struct {
+	peer   string
+	status int
+}
+
+func (e *peerStatusError) Error() string {
+	return fmt.Sprintf("peer %s returned status %d", e.peer, e.status)
+}
+
+// SetPeerClientConfig sets timeouts and retries for requests to peers.
+// Call it before the node starts talking to peers.
+func (n *Node) SetPeerClientConfig(cfg PeerClientConfig) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultPeerClientConfig.Timeout
+	}
+	n.peerClient = cfg
+}
+
+// SetHTTPClient replaces the client used for requests to peers, for example
+// to route them over an in-memory network in tests
+func (n *Node) SetHTTPClient(client *http.Client) {
+	n.httpClient = client
+}
+
+// Shutdown cancels every in-flight and future request to peers, so
+// broadcasts and syncs don't hold up the process exiting
+func (n *Node) Shutdown() {
+	n.cancel()
+}
+
+// requestPeer sends a request to a peer and reads at most limit bytes of the
+// response. Network errors and server errors are retried with backoff; the
+// request is abandoned when ctx is cancelled or the node shuts down.
+func (n *Node) requestPeer(ctx context.Context, peer, method, path string, body []byte, limit int64) ([]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(n.ctx, cancel)
+	defer stop()
+
+	backoff := n.peerClient.Backoff
+	for attempt := 0; ; attempt++ {
+		data, err := n.requestPeerOnce(ctx, peer, method, path, body, limit)
+		if err == nil || attempt >= n.peerClient.Retries || !retryable(err) || ctx.Err() != nil {
+			n.recordPeerResult(ctx, peer, err)
+			return data, err
+		}
+
+		n.logger.Debug("peer request failed, retrying", "peer", peer, "path", path, "err", err, "retry_in", backoff)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(jitter(backoff)):
+		}
+		backoff *= 2
+	}
+}
+
+// requestPeerOnce makes a single attempt at a peer request
+func (n *Node) requestPeerOnce(ctx context.Context, peer, method, path string, body []byte, limit int64) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, n.peerClient.Timeout)
+	defer cancel()
+
+	compressed := len(body) >= compressMinSize && n.gzipPeers.accepts(peer)
+	if compressed {
+		gz, err := gzipBytes(body)
+		if err != nil {
+			return nil, err
+		}
+		body = gz
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("http://%s%s", peer, path), reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if compressed {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	req.Header.Set("X-Node-Address", n.Address)
+
+	// The transport asks for gzip responses and decompresses them itself,
+	// so the size limit below applies to the decompressed data
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	n.gzipPeers.observe(peer, resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &peerStatusError{peer: peer, status: resp.StatusCode}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		err := fmt.Errorf("%w: %s over %d bytes", errResponseTooLarge, path, limit)
+		n.penalizePeer(peer, err)
+		return nil, err
+	}
+	return data, nil
+}
+
+// retryable reports whether a failed peer request is worth another attempt.
+// Rejections and oversized responses will fail the same way again.
+func retryable(err error) bool {
+	if errors.Is(err, errResponseTooLarge) {
+		return false
+	}
+	var statusErr *peerStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.status >= 500 || statusErr.status == http.StatusTooManyRequests
+	}
+	return true
+}
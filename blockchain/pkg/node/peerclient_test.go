@@ -0,0 +1,174 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+)
+
+// statusServer starts a fake peer that answers each request with the next status in the list
+func statusServer(t *testing.T, statuses ...int) (string, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := int(requests.Add(1)) - 1
+		w.WriteHeader(statuses[min(i, len(statuses)-1)])
+	}))
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://"), &requests
+}
+
+func fastRetries(n *Node) {
+	n.SetPeerClientConfig(PeerClientConfig{Timeout: time.Second, Retries: 2, Backoff: time.Millisecond})
+}
+
+func TestRequestPeerRetriesServerErrors(t *testing.T) {
+	peer, requests := statusServer(t, http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK)
+
+	n, _ := New("localhost:9001", 1, 10.0)
+	fastRetries(n)
+	if _, err := n.fetchFromPeer(t.Context(), peer, "/chain", 1024); err != nil {
+		t.Fatalf("expected success on the third attempt, got %v", err)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("expected 3 attempts, got %d", got)
+	}
+}
+
+func TestRequestPeerDoesNotRetryRejections(t *testing.T) {
+	peer, requests := statusServer(t, http.StatusBadRequest)
+
+	n, _ := New("localhost:9001", 1, 10.0)
+	fastRetries(n)
+	_, err := n.fetchFromPeer(t.Context(), peer, "/chain", 1024)
+
+	var statusErr *peerStatusError
+	if !errors.As(err, &statusErr) || statusErr.status != http.StatusBadRequest {
+		t.Errorf("expected a 400 status error, got %v", err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("a rejected request should not be retried, got %d attempts", got)
+	}
+}
+
+func TestRequestPeerGivesUpAfterRetries(t *testing.T) {
+	peer, requests := statusServer(t, http.StatusInternalServerError)
+
+	n, _ := New("localhost:9001", 1, 10.0)
+	fastRetries(n)
+	if _, err := n.fetchFromPeer(t.Context(), peer, "/chain", 1024); err == nil {
+		t.Error("expected an error once retries run out")
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("expected 1 attempt plus 2 retries, got %d", got)
+	}
+}
+
+func TestShutdownCancelsPeerRequests(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	n, _ := New("localhost:9001", 1, 10.0)
+	done := make(chan error, 1)
+	go func() {
+		_, err := n.fetchFromPeer(context.Background(), strings.TrimPrefix(srv.URL, "http://"), "/chain", 1024)
+		done <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	n.Shutdown()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the request to be cancelled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request still running after shutdown")
+	}
+}
+
+func TestBroadcastTransactionReportsFailures(t *testing.T) {
+	good, goodRequests := statusServer(t, http.StatusOK)
+	bad, _ := statusServer(t, http.StatusBadRequest)
+
+	n, _ := New("localhost:9001", 1, 10.0)
+	fastRetries(n)
+	n.addPeer(good)
+	n.addPeer(bad)
+
+	tx := transaction.New("alice", "bob", 1)
+	report, err := n.BroadcastTransaction(t.Context(), tx)
+	if err == nil || !strings.Contains(err.Error(), bad) {
+		t.Errorf("expected an error naming the failing peer, got %v", err)
+	}
+	if strings.Contains(err.Error(), good) {
+		t.Errorf("the reachable peer should not be reported: %v", err)
+	}
+	if goodRequests.Load() != 1 {
+		t.Errorf("expected the transaction to reach the good peer once")
+	}
+
+	if report.Type != MsgTx || len(report.Peers) != 2 || report.Delivered() != 1 {
+		t.Fatalf("expected a tx report delivered to 1 of 2 peers, got %+v", report)
+	}
+	for _, p := range report.Peers {
+		if p.Via != "http" || (p.Peer == bad) != (p.Error != "") {
+			t.Errorf("unexpected result for %s: %+v", p.Peer, p)
+		}
+	}
+}
+
+func TestPeersStatus(t *testing.T) {
+	good, _ := statusServer(t, http.StatusOK)
+	down, _ := statusServer(t, http.StatusServiceUnavailable)
+
+	n, _ := New("localhost:9001", 1, 10.0)
+	fastRetries(n)
+	n.addPeer(good)
+	n.addPeer(down)
+	n.BroadcastBlock(t.Context())
+	n.BroadcastBlock(t.Context())
+
+	var status PeersStatus
+	if code := getJSON(t, n.Handler(), APIPrefix+"/peers/status", &status); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if len(status.Peers) != 2 {
+		t.Fatalf("expected both peers, got %+v", status.Peers)
+	}
+	for _, p := range status.Peers {
+		switch p.Peer {
+		case good:
+			if p.LastSuccess == nil || p.LastFailure != nil || p.ConsecutiveFailures != 0 {
+				t.Errorf("expected the good peer healthy, got %+v", p)
+			}
+		case down:
+			if p.LastSuccess != nil || p.ConsecutiveFailures != 2 || !strings.Contains(p.LastError, "503") {
+				t.Errorf("expected the down peer to have failed twice with a 503, got %+v", p)
+			}
+		}
+	}
+
+	block, ok := status.LastBroadcasts[MsgBlock]
+	if !ok || len(block.Peers) != 2 || block.Delivered() != 1 {
+		t.Errorf("expected the last block broadcast delivered to 1 of 2 peers, got %+v", status.LastBroadcasts)
+	}
+	if _, ok := status.LastBroadcasts[MsgTx]; ok {
+		t.Error("no transaction was broadcast, so there should be no tx report")
+	}
+}
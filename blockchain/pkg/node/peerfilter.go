@@ -0,0 +1,204 @@
+package node
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// PeerFilter restricts which machines the node talks to. Entries are IPs,
+// CIDR ranges ("192.168.1.0/24"), hostnames, or host:port pairs that only
+// match that port.
+type PeerFilter struct {
+	Allow   []string // if set, only these may be peers
+	Deny    []string // never peer with or answer these
+	Private bool     // refuse every API request not from loopback or Allow
+}
+
+// peerRule is one parsed PeerFilter entry
+type peerRule struct {
+	host string       // hostname or IP as written
+	port string       // "" matches any port
+	nets []*net.IPNet // addresses the entry covers
+}
+
+// peerFilter is the parsed form of a PeerFilter
+type peerFilter struct {
+	allow   []peerRule
+	deny    []peerRule
+	private bool
+}
+
+// SetPeerFilter restricts peers to the allowlist, if any, and blocks the
+// denylist, dropping existing peers that no longer pass. Hostnames are
+// resolved once, here. Call it before the node starts serving.
+func (n *Node) SetPeerFilter(f PeerFilter) error {
+	filter, err := f.parse()
+	if err != nil {
+		return err
+	}
+	n.filter = filter
+
+	n.peersMutex.Lock()
+	kept := n.Peers[:0]
+	for _, peer := range n.Peers {
+		if n.filter.allowsPeer(peer) {
+			kept = append(kept, peer)
+		} else {
+			n.logger.Info("dropping filtered peer", "peer", peer)
+		}
+	}
+	n.Peers = kept
+	n.peersMutex.Unlock()
+	return nil
+}
+
+// Validate checks every entry parses and every hostname resolves, as
+// SetPeerFilter would
+func (f PeerFilter) Validate() error {
+	_, err := f.parse()
+	return err
+}
+
+// parse parses both lists of the filter
+func (f PeerFilter) parse() (*peerFilter, error) {
+	allow, err := parsePeerRules(f.Allow)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allowlist: %w", err)
+	}
+	deny, err := parsePeerRules(f.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("invalid denylist: %w", err)
+	}
+	return &peerFilter{allow: allow, deny: deny, private: f.Private}, nil
+}
+
+// parsePeerRules parses filter entries, skipping blanks
+func parsePeerRules(entries []string) ([]peerRule, error) {
+	var rules []peerRule
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			rules = append(rules, peerRule{host: entry, nets: []*net.IPNet{ipNet}})
+			continue
+		}
+
+		rule := peerRule{host: entry}
+		if host, port, err := net.SplitHostPort(entry); err == nil {
+			rule.host, rule.port = host, port
+		}
+		if ip := net.ParseIP(rule.host); ip != nil {
+			rule.nets = []*net.IPNet{singleIP(ip)}
+		} else if strings.ContainsAny(rule.host, "/[]") || rule.host == "" {
+			return nil, fmt.Errorf("%q is not an IP, CIDR range, hostname or host:port", entry)
+		} else if ips, err := net.LookupIP(rule.host); err == nil {
+			// Unresolvable names still match peers added by that name
+			for _, ip := range ips {
+				rule.nets = append(rule.nets, singleIP(ip))
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// singleIP returns a network containing just ip
+func singleIP(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// matchesPeer reports whether a rule covers a host:port peer address
+func (r peerRule) matchesPeer(host, port string) bool {
+	if r.port != "" && r.port != port {
+		return false
+	}
+	if strings.EqualFold(r.host, host) {
+		return true
+	}
+	return r.matchesIP(net.ParseIP(host))
+}
+
+// matchesIP reports whether a rule covers an IP, ignoring its port
+func (r peerRule) matchesIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range r.nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsPeer reports whether the node may peer with a host:port address
+func (f *peerFilter) allowsPeer(address string) bool {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	for _, r := range f.deny {
+		if r.matchesPeer(host, port) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, r := range f.allow {
+		if r.matchesPeer(host, port) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsRequest reports whether a request from ip may be served.
+// Peer requests are those that announce a node address or open a session.
+func (f *peerFilter) allowsRequest(ip net.IP, peer bool) bool {
+	for _, r := range f.deny {
+		if r.matchesIP(ip) {
+			return false
+		}
+	}
+	if ip.IsLoopback() || (!f.private && (!peer || len(f.allow) == 0)) {
+		return true
+	}
+	for _, r := range f.allow {
+		if r.matchesIP(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterRequests refuses requests from denied addresses and, with an
+// allowlist, peer traffic from anywhere else (all traffic in private mode)
+func (n *Node) filterRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n.filter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		peer := r.Header.Get("X-Node-Address") != "" || strings.HasSuffix(r.URL.Path, "/peer/ws")
+		if !n.filter.allowsRequest(net.ParseIP(host), peer) {
+			n.logger.Debug("refused filtered request", "remote", r.RemoteAddr, "path", r.URL.Path)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,97 @@
+package node
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPeerFilterAllowlist(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	n.AddPeer("10.0.0.9:8080")
+	err := n.SetPeerFilter(PeerFilter{Allow: []string{"192.168.1.0/24", "10.0.0.5:8080", "pi.local"}})
+	if err != nil {
+		t.Fatalf("failed to set filter: %v", err)
+	}
+
+	if len(n.GetPeers()) != 0 {
+		t.Errorf("existing peers outside the allowlist should be dropped, got %v", n.GetPeers())
+	}
+
+	tests := map[string]bool{
+		"192.168.1.20:8080": true,
+		"192.168.2.20:8080": false,
+		"10.0.0.5:8080":     true,
+		"10.0.0.5:9090":     false, // port doesn't match
+		"pi.local:8080":     true,
+		"example.com:8080":  false,
+	}
+	for peer, want := range tests {
+		if got := n.filter.allowsPeer(peer); got != want {
+			t.Errorf("allowsPeer(%s) = %v, want %v", peer, got, want)
+		}
+	}
+}
+
+func TestPeerFilterDenylist(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	n.SetPeerFilter(PeerFilter{Deny: []string{"203.0.113.0/24"}})
+
+	n.AddPeer("203.0.113.7:8080")
+	n.AddPeer("192.168.1.20:8080")
+	if peers := n.GetPeers(); len(peers) != 1 || peers[0] != "192.168.1.20:8080" {
+		t.Errorf("expected only the undenied peer, got %v", peers)
+	}
+}
+
+func TestPeerFilterInvalidEntry(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	if err := n.SetPeerFilter(PeerFilter{Allow: []string{"10.0.0.0/99"}}); err == nil {
+		t.Error("expected an error for a malformed CIDR range")
+	}
+}
+
+func TestPeerFilterValidate(t *testing.T) {
+	if err := (PeerFilter{Allow: []string{"192.168.1.0/24", "localhost:8080"}, Deny: []string{"10.0.0.5"}}).Validate(); err != nil {
+		t.Errorf("Validate() = %v, want nil", err)
+	}
+	if err := (PeerFilter{Deny: []string{"10.0.0.0/99"}}).Validate(); err == nil {
+		t.Error("expected an error for a malformed CIDR range")
+	}
+}
+
+func TestFilterRequests(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter PeerFilter
+		remote string
+		peer   bool
+		want   int
+	}{
+		{"denied client", PeerFilter{Deny: []string{"203.0.113.7"}}, "203.0.113.7:5000", false, http.StatusForbidden},
+		{"client outside allowlist", PeerFilter{Allow: []string{"192.168.1.0/24"}}, "203.0.113.7:5000", false, http.StatusOK},
+		{"peer outside allowlist", PeerFilter{Allow: []string{"192.168.1.0/24"}}, "203.0.113.7:5000", true, http.StatusForbidden},
+		{"peer in allowlist", PeerFilter{Allow: []string{"192.168.1.0/24"}}, "192.168.1.4:5000", true, http.StatusOK},
+		{"private mode client", PeerFilter{Allow: []string{"192.168.1.0/24"}, Private: true}, "203.0.113.7:5000", false, http.StatusForbidden},
+		{"private mode loopback", PeerFilter{Private: true}, "127.0.0.1:5000", false, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, _ := New("localhost:9000", 1, 10.0)
+			if err := n.SetPeerFilter(tt.filter); err != nil {
+				t.Fatalf("failed to set filter: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/status", nil)
+			req.RemoteAddr = tt.remote
+			if tt.peer {
+				req.Header.Set("X-Node-Address", "192.168.1.4:8080")
+			}
+			rec := httptest.NewRecorder()
+			n.Handler().ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/oksmith/home-server/pkg/httpserver"
+)
+
+// PeerResult is how delivering a broadcast to one peer went
+type PeerResult struct {
+	Peer  string `json:"peer"`
+	Via   string `json:"via"`             // "session" or "http"
+	Error string `json:"error,omitempty"` // empty if the peer got the message
+	err   error
+}
+
+// BroadcastReport is the outcome of sending one message to every peer
+type BroadcastReport struct {
+	Type  string       `json:"type"` // MsgTx or MsgBlock
+	Time  time.Time    `json:"time"`
+	Peers []PeerResult `json:"peers"`
+}
+
+// Delivered returns how many peers got the message
+func (r BroadcastReport) Delivered() int {
+	delivered := 0
+	for _, p := range r.Peers {
+		if p.Error == "" {
+			delivered++
+		}
+	}
+	return delivered
+}
+
+// Err joins the errors of the peers the message didn't reach, or returns nil
+// if it reached every one
+func (r BroadcastReport) Err() error {
+	var errs []error
+	for _, p := range r.Peers {
+		if p.err != nil {
+			errs = append(errs, p.err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PeerStatus is what the node knows about reaching a peer, so a peer that
+// quietly stopped answering shows up before the chains drift apart
+type PeerStatus struct {
+	Peer                string     `json:"peer"`
+	Session             bool       `json:"session"` // connected over a WebSocket session
+	Banned              bool       `json:"banned,omitempty"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	LastFailure         *time.Time `json:"last_failure,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+}
+
+// PeersStatus is served by GET /peers/status
+type PeersStatus struct {
+	Peers          []PeerStatus               `json:"peers"`
+	LastBroadcasts map[string]BroadcastReport `json:"last_broadcasts"` // by message type
+}
+
+// peerHealth records the outcome of requests to each peer
+type peerHealth struct {
+	peers      map[string]*peerRecord
+	broadcasts map[string]BroadcastReport // latest by message type
+	mu         sync.Mutex
+}
+
+type peerRecord struct {
+	lastSuccess time.Time
+	lastFailure time.Time
+	lastErr     error
+	failures    int // since the last success
+}
+
+func newPeerHealth() *peerHealth {
+	return &peerHealth{peers: make(map[string]*peerRecord), broadcasts: make(map[string]BroadcastReport)}
+}
+
+// record notes how a request to peer went
+func (h *peerHealth) record(peer string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	rec := h.peers[peer]
+	if rec == nil {
+		rec = &peerRecord{}
+		h.peers[peer] = rec
+	}
+	if err == nil {
+		rec.lastSuccess = time.Now()
+		rec.failures = 0
+		return
+	}
+	rec.lastFailure = time.Now()
+	rec.lastErr = err
+	rec.failures++
+}
+
+// recordBroadcast keeps report as the latest of its type
+func (h *peerHealth) recordBroadcast(report BroadcastReport) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.broadcasts[report.Type] = report
+}
+
+// status fills in what has been recorded about peer
+func (h *peerHealth) status(st *PeerStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	rec := h.peers[st.Peer]
+	if rec == nil {
+		return
+	}
+	if !rec.lastSuccess.IsZero() {
+		lastSuccess := rec.lastSuccess
+		st.LastSuccess = &lastSuccess
+	}
+	if !rec.lastFailure.IsZero() {
+		lastFailure := rec.lastFailure
+		st.LastFailure = &lastFailure
+		st.LastError = rec.lastErr.Error()
+	}
+	st.ConsecutiveFailures = rec.failures
+}
+
+// lastBroadcasts returns a copy of the latest broadcast of each type
+func (h *peerHealth) lastBroadcasts() map[string]BroadcastReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	broadcasts := make(map[string]BroadcastReport, len(h.broadcasts))
+	for msgType, report := range h.broadcasts {
+		broadcasts[msgType] = report
+	}
+	return broadcasts
+}
+
+// recordPeerResult notes how a request to a peer went, unless it was cut
+// short by ctx or the node shutting down, which says nothing about the peer
+func (n *Node) recordPeerResult(ctx context.Context, peer string, err error) {
+	if err != nil && (ctx.Err() != nil || n.ctx.Err() != nil) {
+		return
+	}
+	n.peerHealth.record(peer, err)
+}
+
+// PeersStatus returns the reachability of every peer and the outcome of the
+// latest transaction and block broadcasts
+func (n *Node) PeersStatus() PeersStatus {
+	peers := n.GetPeers()
+	status := PeersStatus{
+		Peers:          make([]PeerStatus, len(peers)),
+		LastBroadcasts: n.peerHealth.lastBroadcasts(),
+	}
+	for i, peer := range peers {
+		st := PeerStatus{Peer: peer, Session: n.session(peer) != nil, Banned: n.penalties.IsBanned(peer)}
+		n.peerHealth.status(&st)
+		status.Peers[i] = st
+	}
+	return status
+}
+
+// handlePeersStatus serves PeersStatus
+func (n *Node) handlePeersStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	httpserver.WriteJSON(w, http.StatusOK, n.PeersStatus())
+}
@@ -0,0 +1,82 @@
+package node
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// maxPeerStrikes is how many protocol violations a peer may commit before it is ignored
+	maxPeerStrikes = 3
+
+	// peerBanDuration is how long a misbehaving peer is ignored for
+	peerBanDuration = 30 * time.Minute
+)
+
+// peerPenalties tracks peers that sent malformed, oversized or invalid data,
+// so a faulty or hostile peer can't make us download and validate junk forever
+type peerPenalties struct {
+	strikes     map[string]int       // peer -> violations since last ban
+	bannedUntil map[string]time.Time // peer -> end of ban
+	mu          sync.Mutex
+}
+
+// newPeerPenalties creates an empty penalty tracker
+func newPeerPenalties() *peerPenalties {
+	return &peerPenalties{
+		strikes:     make(map[string]int),
+		bannedUntil: make(map[string]time.Time),
+	}
+}
+
+// Penalize records a violation and reports whether it got the peer banned
+func (p *peerPenalties) Penalize(peer string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.strikes[peer]++
+	if p.strikes[peer] < maxPeerStrikes {
+		return false
+	}
+	delete(p.strikes, peer)
+	p.bannedUntil[peer] = time.Now().Add(peerBanDuration)
+	return true
+}
+
+// IsBanned reports whether the peer is currently being ignored
+func (p *peerPenalties) IsBanned(peer string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	until, exists := p.bannedUntil[peer]
+	if !exists {
+		return false
+	}
+	if time.Now().After(until) {
+		delete(p.bannedUntil, peer)
+		return false
+	}
+	return true
+}
+
+// penalizePeer logs a peer's protocol violation and bans it after repeated offences
+func (n *Node) penalizePeer(peer string, err error) {
+	n.logger.Warn("peer sent bad data", "peer", peer, "err", err)
+	n.recordEvent(EventPeerPenalized, map[string]any{"peer": peer, "reason": err.Error()})
+	if n.penalties.Penalize(peer) {
+		n.logger.Warn("ignoring misbehaving peer", "peer", peer, "for", peerBanDuration)
+		n.recordEvent(EventPeerBanned, map[string]any{"peer": peer, "duration": peerBanDuration.String()})
+	}
+}
+
+// syncPeers returns the peers that aren't currently banned
+func (n *Node) syncPeers() []string {
+	peers := n.GetPeers()
+	allowed := peers[:0]
+	for _, peer := range peers {
+		if !n.penalties.IsBanned(peer) {
+			allowed = append(allowed, peer)
+		}
+	}
+	return allowed
+}
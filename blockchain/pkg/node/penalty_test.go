@@ -0,0 +1,31 @@
+package node
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeerPenalties(t *testing.T) {
+	p := newPeerPenalties()
+
+	for i := 1; i < maxPeerStrikes; i++ {
+		if p.Penalize("peer:1") {
+			t.Fatalf("peer banned after only %d strikes", i)
+		}
+	}
+	if !p.Penalize("peer:1") {
+		t.Fatalf("peer should be banned after %d strikes", maxPeerStrikes)
+	}
+	if !p.IsBanned("peer:1") {
+		t.Error("expected peer to be banned")
+	}
+	if p.IsBanned("peer:2") {
+		t.Error("other peers should not be affected")
+	}
+
+	// Bans expire
+	p.bannedUntil["peer:1"] = time.Now().Add(-time.Second)
+	if p.IsBanned("peer:1") {
+		t.Error("expected ban to have expired")
+	}
+}
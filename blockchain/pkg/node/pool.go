@@ -0,0 +1,192 @@
+package node
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+	"github.com/oksmith/home-server/pkg/httpserver"
+)
+
+const (
+	// DefaultNonceRange is how many nonces each pool worker is asked to search per work unit
+	DefaultNonceRange = 1 << 20
+
+	// templateMaxAge is how long a block template is reused before it is rebuilt
+	// to pick up new mempool transactions
+	templateMaxAge = 30 * time.Second
+)
+
+// ErrStaleWork is returned when a share is submitted for a template that no longer builds on the tip
+var ErrStaleWork = errors.New("work is stale")
+
+// Work is a unit of mining work handed to a pool worker: a block template and
+// the slice of the nonce space [NonceStart, NonceEnd) the worker should search
+type Work struct {
+	WorkID     string       `json:"work_id"`
+	Block      *block.Block `json:"block"`
+	Difficulty int          `json:"difficulty"`
+	NonceStart int64        `json:"nonce_start"`
+	NonceEnd   int64        `json:"nonce_end"`
+}
+
+// WorkSubmission is a worker's claim to have found a valid nonce
+type WorkSubmission struct {
+	WorkID string `json:"work_id"`
+	Nonce  int64  `json:"nonce"`
+	Worker string `json:"worker,omitempty"`
+}
+
+// pool coordinates workers mining cooperatively toward this node's wallet
+type pool struct {
+	nonceRange int64
+	template   *block.Block
+	builtAt    time.Time
+	nextNonce  int64
+	work       map[string]*Work // outstanding work units by ID
+	mu         sync.Mutex
+}
+
+// EnablePool turns on the /work endpoints so worker processes can mine for
+// this node, each searching nonceRange nonces per request
+func (n *Node) EnablePool(nonceRange int64) {
+	if nonceRange <= 0 {
+		nonceRange = DefaultNonceRange
+	}
+	n.pool = &pool{
+		nonceRange: nonceRange,
+		work:       make(map[string]*Work),
+	}
+}
+
+// GetWork hands out the next slice of nonces for the current block template,
+// building a fresh template when the tip moved or the old one got stale
+func (n *Node) GetWork() (*Work, error) {
+	if n.pool == nil {
+		return nil, fmt.Errorf("pool mode is not enabled")
+	}
+	p := n.pool
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tip := n.Chain.GetLatestBlock()
+	if p.template == nil || p.template.PreviousHash != tip.Hash || time.Since(p.builtAt) > templateMaxAge {
+		template, err := n.Chain.NewBlockTemplate(n.Mempool.GetAll(), n.Wallet.Address())
+		if err != nil {
+			return nil, err
+		}
+		p.template = template
+		p.builtAt = time.Now()
+		p.nextNonce = 0
+
+		// Work for older templates can no longer win
+		for id, w := range p.work {
+			if w.Block.PreviousHash != tip.Hash {
+				delete(p.work, id)
+			}
+		}
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	w := &Work{
+		WorkID:     hex.EncodeToString(id),
+		Block:      p.template,
+		Difficulty: n.Chain.Difficulty,
+		NonceStart: p.nextNonce,
+		NonceEnd:   p.nextNonce + p.nonceRange,
+	}
+	p.nextNonce = w.NonceEnd
+	p.work[w.WorkID] = w
+	return w, nil
+}
+
+// SubmitWork checks a worker's nonce against its work unit and, if it solves
+// the block, adds the block to the chain and broadcasts it
+func (n *Node) SubmitWork(sub WorkSubmission) (*block.Block, error) {
+	if n.pool == nil {
+		return nil, fmt.Errorf("pool mode is not enabled")
+	}
+	p := n.pool
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	w, exists := p.work[sub.WorkID]
+	if !exists {
+		return nil, ErrStaleWork
+	}
+	if sub.Nonce < w.NonceStart || sub.Nonce >= w.NonceEnd {
+		return nil, fmt.Errorf("nonce %d outside assigned range [%d, %d)", sub.Nonce, w.NonceStart, w.NonceEnd)
+	}
+
+	// Work on a copy so a bad share can't corrupt the shared template
+	candidate := *w.Block
+	candidate.Nonce = sub.Nonce
+	candidate.Hash = candidate.CalculateHash()
+
+	if err := n.Chain.AddMinedBlock(&candidate); err != nil {
+		if errors.Is(err, chain.ErrStaleTip) {
+			delete(p.work, sub.WorkID)
+			return nil, ErrStaleWork
+		}
+		return nil, err
+	}
+
+	// The template is solved; everyone needs new work
+	p.template = nil
+	p.work = make(map[string]*Work)
+
+	n.logger.Info("pool worker solved block", "worker", sub.Worker, "height", candidate.Index)
+	n.abortBlock()
+	n.blockMined(&candidate)
+	return &candidate, nil
+}
+
+// handleWorkGet hands a work unit to a pool worker
+func (n *Node) handleWorkGet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	work, err := n.GetWork()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	httpserver.WriteJSON(w, http.StatusOK, work)
+}
+
+// handleWorkSubmit accepts a solved share from a pool worker
+func (n *Node) handleWorkSubmit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var sub WorkSubmission
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	b, err := n.SubmitWork(sub)
+	if errors.Is(err, ErrStaleWork) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	httpserver.WriteJSON(w, http.StatusOK, map[string]any{"accepted": true, "height": b.Index, "hash": b.Hash})
+}
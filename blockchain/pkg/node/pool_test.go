@@ -0,0 +1,124 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// solveWork searches a work unit the way a remote worker would, from its JSON form
+func solveWork(t *testing.T, w *Work) (int64, bool) {
+	t.Helper()
+	data, err := json.Marshal(w)
+	if err != nil {
+		t.Fatalf("failed to encode work: %v", err)
+	}
+	var received Work
+	if err := json.Unmarshal(data, &received); err != nil {
+		t.Fatalf("failed to decode work: %v", err)
+	}
+
+	found, err := received.Block.MineRange(context.Background(), received.Difficulty, received.NonceStart, received.NonceEnd)
+	if err != nil {
+		t.Fatalf("mining failed: %v", err)
+	}
+	return received.Block.Nonce, found
+}
+
+func TestPoolGetAndSubmitWork(t *testing.T) {
+	n, err := New("localhost:9000", 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	n.EnablePool(1000)
+
+	w1, err := n.GetWork()
+	if err != nil {
+		t.Fatalf("failed to get work: %v", err)
+	}
+	w2, err := n.GetWork()
+	if err != nil {
+		t.Fatalf("failed to get work: %v", err)
+	}
+	if w1.Block != w2.Block {
+		t.Errorf("workers should share the same template")
+	}
+	if w2.NonceStart != w1.NonceEnd {
+		t.Errorf("expected consecutive nonce ranges, got [%d,%d) then [%d,%d)",
+			w1.NonceStart, w1.NonceEnd, w2.NonceStart, w2.NonceEnd)
+	}
+
+	nonce, found := solveWork(t, w1)
+	if !found {
+		t.Fatalf("difficulty 1 should be solvable within 1000 nonces")
+	}
+
+	if _, err := n.SubmitWork(WorkSubmission{WorkID: w2.WorkID, Nonce: nonce}); err == nil {
+		t.Errorf("nonce outside the assigned range should be rejected")
+	}
+
+	b, err := n.SubmitWork(WorkSubmission{WorkID: w1.WorkID, Nonce: nonce, Worker: "pi"})
+	if err != nil {
+		t.Fatalf("valid share rejected: %v", err)
+	}
+	if b.Index != 1 || n.Chain.Length() != 2 {
+		t.Errorf("expected block 1 to be added, chain length %d", n.Chain.Length())
+	}
+	if n.Chain.GetBalance(n.Wallet.Address()) != 10.0 {
+		t.Errorf("pool rewards should go to the node's wallet")
+	}
+
+	// Everything handed out for the old tip is now stale
+	if _, err := n.SubmitWork(WorkSubmission{WorkID: w2.WorkID, Nonce: w2.NonceStart}); !errors.Is(err, ErrStaleWork) {
+		t.Errorf("expected ErrStaleWork, got %v", err)
+	}
+
+	w3, err := n.GetWork()
+	if err != nil {
+		t.Fatalf("failed to get work: %v", err)
+	}
+	if w3.Block.PreviousHash != b.Hash {
+		t.Errorf("new work should build on the new tip")
+	}
+}
+
+func TestPoolRejectsBadShare(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	n.EnablePool(1000)
+
+	w, err := n.GetWork()
+	if err != nil {
+		t.Fatalf("failed to get work: %v", err)
+	}
+
+	templateHash := w.Block.Hash
+
+	// Find a nonce in range that does NOT meet the difficulty
+	candidate := *w.Block
+	var bad int64 = -1
+	for nonce := w.NonceStart; nonce < w.NonceEnd; nonce++ {
+		candidate.Nonce = nonce
+		if candidate.CalculateHash()[0] != '0' {
+			bad = nonce
+			break
+		}
+	}
+
+	if _, err := n.SubmitWork(WorkSubmission{WorkID: w.WorkID, Nonce: bad}); err == nil {
+		t.Errorf("share without proof-of-work should be rejected")
+	}
+	if n.Chain.Length() != 1 {
+		t.Errorf("bad share should not extend the chain")
+	}
+	if w.Block.Nonce != 0 || w.Block.Hash != templateHash {
+		t.Errorf("bad share should not modify the shared template")
+	}
+}
+
+func TestPoolDisabled(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	if _, err := n.GetWork(); err == nil {
+		t.Error("expected error when pool mode is disabled")
+	}
+}
@@ -0,0 +1,177 @@
+package node
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/pkg/httpserver"
+)
+
+// RegtestGenesisTime is the genesis timestamp every regtest node uses, so
+// nodes started separately with the same difficulty and reward share a genesis block
+var RegtestGenesisTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// MaxRegtestDifficulty is the highest difficulty allowed in regtest mode
+const MaxRegtestDifficulty = 1
+
+// maxGenerateBlocks caps how many blocks one /generate call mines
+const maxGenerateBlocks = 1000
+
+// EnableRegtest switches the node to regtest mode for local development and
+// CI: POST /generate mines blocks on demand, and a chain that only has its
+// genesis block is replaced by the deterministic regtest genesis.
+func (n *Node) EnableRegtest() error {
+	if n.Chain.Difficulty > MaxRegtestDifficulty {
+		return fmt.Errorf("regtest difficulty must be at most %d, got %d", MaxRegtestDifficulty, n.Chain.Difficulty)
+	}
+	n.regtest = true
+
+	if n.Chain.Length() == 1 {
+		if err := n.Chain.ReplaceWith(chain.NewWithGenesis(n.Chain.Difficulty, n.Chain.MiningReward, RegtestGenesisTime)); err != nil {
+			return err
+		}
+		n.persistChain()
+	}
+	return nil
+}
+
+// Generate mines count blocks straight away, the first including any pending
+// transactions, and returns their hashes
+func (n *Node) Generate(count int) ([]string, error) {
+	if !n.regtest {
+		return nil, fmt.Errorf("generate is only available in regtest mode")
+	}
+
+	hashes := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		if err := n.Mine(); err != nil {
+			return hashes, err
+		}
+		hashes = append(hashes, n.Chain.GetLatestBlock().Hash)
+	}
+	return hashes, nil
+}
+
+// handleGenerate mines the number of blocks given by "blocks" (default 1) in regtest mode
+func (n *Node) handleGenerate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !n.regtest {
+		http.Error(w, "generate is only available in regtest mode", http.StatusForbidden)
+		return
+	}
+
+	count := 1
+	if v := r.URL.Query().Get("blocks"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > maxGenerateBlocks {
+			http.Error(w, fmt.Sprintf("blocks must be between 1 and %d", maxGenerateBlocks), http.StatusBadRequest)
+			return
+		}
+		count = parsed
+	}
+
+	hashes, err := n.Generate(count)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	httpserver.WriteJSON(w, http.StatusOK, map[string]any{"hashes": hashes, "height": n.Chain.GetLatestBlock().Index})
+}
+
+// FaucetResult reports a regtest faucet payment
+type FaucetResult struct {
+	TxID    string   `json:"txid"`
+	Address string   `json:"address"`
+	Amount  float64  `json:"amount"`
+	Hashes  []string `json:"hashes"` // blocks mined, the last confirming the payment
+	Height  int64    `json:"height"`
+}
+
+// Faucet pays amount from the node's wallet to address and mines the payment
+// straight into a block, first generating as many blocks as the wallet needs
+// to afford it. Only available in regtest mode.
+func (n *Node) Faucet(address string, amount float64) (FaucetResult, error) {
+	if !n.regtest {
+		return FaucetResult{}, fmt.Errorf("faucet is only available in regtest mode")
+	}
+	if address == "" || !(amount > 0) || math.IsInf(amount, 1) {
+		return FaucetResult{}, fmt.Errorf("an address and a positive amount are required")
+	}
+
+	// Pending spends from the wallet are mined alongside the payment, so cover them too
+	own := n.Wallet.Address()
+	needed := amount - n.Chain.GetBalance(own)
+	for _, tx := range n.Mempool.GetAll() {
+		if tx.From == own {
+			needed += tx.Total()
+		}
+	}
+
+	// Count the blocks whose scheduled rewards cover what's needed
+	blocks := 0
+	tip := n.Chain.GetLatestBlock().Index
+	for covered := 0.0; covered < needed; blocks++ {
+		if blocks == maxGenerateBlocks {
+			return FaucetResult{}, fmt.Errorf("paying %.2f would take more than the %d blocks allowed", amount, maxGenerateBlocks)
+		}
+		covered += n.Chain.RewardAt(tip + int64(blocks) + 1)
+	}
+	hashes, err := n.Generate(blocks)
+	if err != nil {
+		return FaucetResult{}, fmt.Errorf("failed to fund the faucet: %w", err)
+	}
+
+	tx := transaction.NewWithClock(n.clock, own, address, amount)
+	if err := tx.Sign(n.Wallet.PrivateKey); err != nil {
+		return FaucetResult{}, err
+	}
+	if err := n.ReceiveTransaction(tx); err != nil {
+		return FaucetResult{}, fmt.Errorf("failed to submit payment: %w", err)
+	}
+	confirmed, err := n.Generate(1)
+	if err != nil {
+		return FaucetResult{}, fmt.Errorf("failed to mine payment: %w", err)
+	}
+
+	return FaucetResult{
+		TxID:    tx.ID,
+		Address: address,
+		Amount:  amount,
+		Hashes:  append(hashes, confirmed...),
+		Height:  n.Chain.GetLatestBlock().Index,
+	}, nil
+}
+
+// handleFaucet pays the "amount" query parameter to "address" in regtest mode
+func (n *Node) handleFaucet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !n.regtest {
+		http.Error(w, "faucet is only available in regtest mode", http.StatusForbidden)
+		return
+	}
+
+	address := r.URL.Query().Get("address")
+	amount, err := strconv.ParseFloat(r.URL.Query().Get("amount"), 64)
+	if address == "" || err != nil || !(amount > 0) || math.IsInf(amount, 1) {
+		http.Error(w, "address and a positive amount are required", http.StatusBadRequest)
+		return
+	}
+
+	result, err := n.Faucet(address, amount)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	httpserver.WriteJSON(w, http.StatusOK, result)
+}
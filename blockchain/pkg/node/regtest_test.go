@@ -0,0 +1,153 @@
+package node
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+)
+
+func TestRegtestSharedGenesis(t *testing.T) {
+	a, _ := New("localhost:9000", 1, 10.0)
+	b, _ := New("localhost:9001", 1, 10.0)
+	if err := a.EnableRegtest(); err != nil {
+		t.Fatalf("failed to enable regtest: %v", err)
+	}
+	b.EnableRegtest()
+
+	if a.Chain.Blocks[0].Hash != b.Chain.Blocks[0].Hash {
+		t.Error("regtest nodes should share a genesis block")
+	}
+	if !a.Status().Regtest {
+		t.Error("status should report regtest mode")
+	}
+}
+
+func TestRegtestRejectsHighDifficulty(t *testing.T) {
+	n, _ := New("localhost:9000", 3, 10.0)
+	if err := n.EnableRegtest(); err == nil {
+		t.Error("expected an error enabling regtest at difficulty 3")
+	}
+}
+
+func TestRegtestKeepsExistingChain(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	n.Mine()
+	tip := n.Chain.GetLatestBlock().Hash
+
+	n.EnableRegtest()
+	if n.Chain.GetLatestBlock().Hash != tip {
+		t.Error("enabling regtest should not discard mined blocks")
+	}
+}
+
+func TestHandleGenerate(t *testing.T) {
+	n, _ := New("localhost:9000", 0, 10.0)
+	h := n.Handler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/generate?blocks=2", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 outside regtest, got %d", rec.Code)
+	}
+
+	n.EnableRegtest()
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/generate?blocks=5", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if n.Chain.Length() != 6 {
+		t.Errorf("expected 5 generated blocks on top of genesis, got %d blocks", n.Chain.Length())
+	}
+	if got := n.Chain.GetBalance(n.Wallet.Address()); got != 50 {
+		t.Errorf("expected 50 in rewards, got %.2f", got)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/generate?blocks=0", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for zero blocks, got %d", rec.Code)
+	}
+}
+
+func TestFaucet(t *testing.T) {
+	n, _ := New("localhost:9000", 0, 10.0)
+	if _, err := n.Faucet("alice", 5); err == nil {
+		t.Error("expected the faucet to be refused outside regtest")
+	}
+
+	n.EnableRegtest()
+	result, err := n.Faucet("alice", 25)
+	if err != nil {
+		t.Fatalf("faucet failed: %v", err)
+	}
+	// Three blocks fund the 25, and a fourth confirms the payment
+	if len(result.Hashes) != 4 || result.Height != 4 || n.Chain.Length() != 5 {
+		t.Errorf("expected 4 blocks mined, got %+v", result)
+	}
+	if got := n.Chain.GetBalance("alice"); got != 25 {
+		t.Errorf("expected alice to have 25, got %.2f", got)
+	}
+	if _, ok := n.Chain.Transaction(result.TxID); !ok {
+		t.Error("expected the payment to be confirmed")
+	}
+
+	// The wallet has 15 left from the rewards, so a small payment mines just one block
+	result, err = n.Faucet("bob", 5)
+	if err != nil || len(result.Hashes) != 1 {
+		t.Errorf("expected only the confirming block, got %+v, %v", result, err)
+	}
+}
+
+func TestFaucetFollowsEmission(t *testing.T) {
+	n, _ := New("localhost:9000", 0, 10.0)
+	n.EnableRegtest()
+	if err := n.SetEmission(chain.Emission{HalvingInterval: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Blocks 1 to 3 mint 10, 5 and 5, so the 18 takes all three
+	result, err := n.Faucet("alice", 18)
+	if err != nil {
+		t.Fatalf("faucet failed: %v", err)
+	}
+	if len(result.Hashes) != 4 {
+		t.Errorf("expected 3 funding blocks and a confirming one, got %+v", result)
+	}
+	if got := n.Chain.GetBalance("alice"); got != 18 {
+		t.Errorf("expected alice to have 18, got %.2f", got)
+	}
+
+	// Once the reward has run out, no number of blocks pays
+	if err := n.SetEmission(chain.Emission{Curve: []chain.RewardStep{{Height: 6, Reward: 0}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.Faucet("bob", 100); err == nil {
+		t.Error("expected the faucet to refuse a payment no reward can fund")
+	}
+}
+
+func TestHandleFaucet(t *testing.T) {
+	n, _ := New("localhost:9000", 0, 10.0)
+	n.EnableRegtest()
+	h := n.Handler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/faucet?address=alice&amount=2.5", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if got := n.Chain.GetBalance("alice"); got != 2.5 {
+		t.Errorf("expected alice to have 2.5, got %.2f", got)
+	}
+
+	for _, query := range []string{"address=alice", "address=alice&amount=-1", "address=alice&amount=NaN", "amount=1"} {
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/faucet?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, rec.Code)
+		}
+	}
+}
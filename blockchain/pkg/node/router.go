@@ -0,0 +1,111 @@
+package node
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/oksmith/home-server/pkg/httpserver"
+)
+
+// APIPrefix is where the versioned API is served. The same routes are still
+// served at their original unversioned paths as deprecated aliases.
+const APIPrefix = "/api/v1"
+
+// route is one API endpoint and the middleware it needs
+type route struct {
+	path     string
+	handler  http.HandlerFunc
+	cors     bool // readable from allowed browser origins
+	admin    bool // requires the admin token
+	noAlias  bool // added after versioning, so only served under APIPrefix
+	compress bool // large responses, gzipped for clients that accept it
+}
+
+// routes lists every API endpoint, relative to APIPrefix
+func (n *Node) routes() []route {
+	return []route{
+		{path: "/chain", handler: n.handleGetChain, cors: true, compress: true},
+		{path: "/chain/export", handler: n.handleChainExport},
+		{path: "/chain/import", handler: n.handleChainImport, admin: true},
+		{path: "/shutdown", handler: n.handleShutdown, admin: true, noAlias: true},
+		{path: "/headers", handler: n.handleHeaders, cors: true, compress: true},
+		{path: "/transaction", handler: n.handleTransaction},
+		{path: "/transaction/raw", handler: n.handleRawTransaction, noAlias: true},
+		{path: "/block", handler: n.handleBlock},
+		{path: "/mempool/ids", handler: n.handleMempoolIDs},
+		{path: "/mempool/get", handler: n.handleMempoolGet, compress: true},
+		{path: "/peers", handler: n.handlePeers, cors: true},
+		{path: "/peers/status", handler: n.handlePeersStatus, cors: true, noAlias: true},
+		{path: "/balance", handler: n.handleBalance, cors: true},
+		{path: "/proofs", handler: n.handleProofs, cors: true, compress: true},
+		{path: "/watch", handler: n.handleWatch},
+		{path: "/alerts", handler: n.handleAlerts, noAlias: true},
+		{path: "/status", handler: n.handleStatus, cors: true},
+		{path: "/mine", handler: n.handleMine},
+		{path: "/mining/start", handler: n.handleMiningStart},
+		{path: "/mining/stop", handler: n.handleMiningStop},
+		{path: "/mining/throttle", handler: n.handleMiningThrottle, noAlias: true},
+		{path: "/work/get", handler: n.handleWorkGet},
+		{path: "/work/submit", handler: n.handleWorkSubmit},
+		{path: "/metrics", handler: n.handleMetrics, cors: true},
+		{path: "/peer/ws", handler: n.handlePeerWS},
+		{path: "/blocks", handler: n.handleRecentBlocks, cors: true, noAlias: true, compress: true},
+		{path: "/blocks/get", handler: n.handleBlockLookup, cors: true, noAlias: true, compress: true},
+		{path: "/blocks/range", handler: n.handleBlockRange, cors: true, noAlias: true, compress: true},
+		{path: "/tx", handler: n.handleTxLookup, cors: true, noAlias: true},
+		{path: "/address", handler: n.handleAddress, cors: true, noAlias: true},
+		{path: "/mempool", handler: n.handleMempool, cors: true, noAlias: true},
+		{path: "/events", handler: n.handleEvents, cors: true, noAlias: true},
+		{path: "/generate", handler: n.handleGenerate, noAlias: true},
+		{path: "/faucet", handler: n.handleFaucet, noAlias: true},
+		{path: "/handshake", handler: n.handleHandshake, noAlias: true},
+		{path: "/wallet", handler: n.handleWallet, cors: true, noAlias: true},
+		{path: "/wallet/unconfirmed", handler: n.handleWalletUnconfirmed, cors: true, noAlias: true},
+	}
+}
+
+// Handler returns the node's HTTP API. Every route is served under APIPrefix
+// and, for older clients and peers, at its unversioned path with deprecation headers.
+func (n *Node) Handler() http.Handler {
+	mux := http.NewServeMux()
+	for _, rt := range n.routes() {
+		h := rt.handler
+		if rt.compress {
+			h = compressResponse(h)
+		}
+		if rt.admin {
+			h = n.requireAdmin(h)
+		}
+		if rt.cors {
+			h = n.cors(h)
+		}
+		mux.Handle(APIPrefix+rt.path, n.instrument(rt.path, false, h))
+		if !rt.noAlias {
+			mux.Handle(rt.path, n.instrument(rt.path, true, deprecated(rt.path, h)))
+		}
+	}
+	mux.Handle("/explorer/", n.instrument("/explorer", false, explorerHandler()))
+	return n.filterRequests(decompressRequests(mux))
+}
+
+// deprecated marks responses from an unversioned alias and points at its replacement
+func deprecated(path string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", APIPrefix, path))
+		next(w, r)
+	}
+}
+
+// RouteMetrics counts requests to one API route
+type RouteMetrics = httpserver.RouteMetrics
+
+// instrument logs each request and records it in the node's API metrics
+func (n *Node) instrument(path string, legacy bool, next http.Handler) http.Handler {
+	return httpserver.Instrument(n.metrics, n.logger, path, legacy, next)
+}
+
+// handleMetrics returns per-route request statistics
+func (n *Node) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	httpserver.WriteJSON(w, http.StatusOK, n.metrics.Snapshot())
+}
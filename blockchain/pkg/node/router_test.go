@@ -0,0 +1,96 @@
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandlerVersionedAndLegacyRoutes(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	h := n.Handler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 from versioned route, got %d", rec.Code)
+	}
+	if rec.Header().Get("Deprecation") != "" {
+		t.Error("versioned route should not be marked deprecated")
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 from legacy route, got %d", rec.Code)
+	}
+	if rec.Header().Get("Deprecation") != "true" {
+		t.Error("legacy route should carry a Deprecation header")
+	}
+	if got := rec.Header().Get("Link"); got != `</api/v1/status>; rel="successor-version"` {
+		t.Errorf("unexpected Link header %q", got)
+	}
+}
+
+func TestHandlerAdminRoutes(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	n.SetAdminToken("secret")
+	h := n.Handler()
+
+	for _, path := range []string{"/api/v1/chain/import", "/chain/import"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401 without token, got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestHandlerMetrics(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	h := n.Handler()
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/chain", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/chain", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/balance", nil))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/metrics", nil))
+
+	var metrics map[string]RouteMetrics
+	if err := json.NewDecoder(rec.Body).Decode(&metrics); err != nil {
+		t.Fatalf("failed to decode metrics: %v", err)
+	}
+	if chain := metrics["/chain"]; chain.Requests != 2 || chain.LegacyRequests != 1 {
+		t.Errorf("expected 2 /chain requests, 1 legacy, got %+v", chain)
+	}
+	if balance := metrics["/balance"]; balance.ClientErrors != 1 {
+		t.Errorf("expected /balance without address to count as a client error, got %+v", balance)
+	}
+}
+
+func TestHandlerAdminLockout(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	n.SetAdminToken("secret")
+	h := n.Handler()
+
+	codes := make([]int, 0, 6)
+	for range 6 {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/chain/import", nil)
+		req.Header.Set("Authorization", "Bearer guess")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+	if codes[4] != http.StatusUnauthorized || codes[5] != http.StatusTooManyRequests {
+		t.Errorf("expected a lockout after 5 bad tokens, got %v", codes)
+	}
+
+	// Other routes aren't affected
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status to still answer, got %d", rec.Code)
+	}
+}
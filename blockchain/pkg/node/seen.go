@@ -0,0 +1,64 @@
+package node
+
+import (
+	"sync"
+	"time"
+)
+
+// seenTTL is how long relayed transaction and block IDs are remembered
+const seenTTL = 10 * time.Minute
+
+// seenCache remembers recently relayed IDs so the same transaction or block
+// isn't broadcast back and forth between peers forever
+type seenCache struct {
+	ttl     time.Duration
+	entries map[string]time.Time // ID -> time first seen
+	mu      sync.Mutex
+}
+
+// newSeenCache creates an empty cache whose entries expire after ttl
+func newSeenCache(ttl time.Duration) *seenCache {
+	return &seenCache{
+		ttl:     ttl,
+		entries: make(map[string]time.Time),
+	}
+}
+
+// MarkSeen records the ID and reports whether it had already been seen
+// within the TTL
+func (c *seenCache) MarkSeen(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.prune(now)
+
+	if seenAt, exists := c.entries[id]; exists && now.Sub(seenAt) < c.ttl {
+		return true
+	}
+	c.entries[id] = now
+	return false
+}
+
+// Forget removes an ID so it can be processed again
+func (c *seenCache) Forget(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, id)
+}
+
+// Size returns the number of remembered IDs
+func (c *seenCache) Size() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// prune drops expired entries; callers must hold the lock
+func (c *seenCache) prune(now time.Time) {
+	for id, seenAt := range c.entries {
+		if now.Sub(seenAt) >= c.ttl {
+			delete(c.entries, id)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package node
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeenCacheMarkSeen(t *testing.T) {
+	c := newSeenCache(time.Minute)
+
+	if c.MarkSeen("tx1") {
+		t.Errorf("first sighting should not be reported as seen")
+	}
+	if !c.MarkSeen("tx1") {
+		t.Errorf("second sighting should be reported as seen")
+	}
+	if c.MarkSeen("tx2") {
+		t.Errorf("different ID should not be reported as seen")
+	}
+	if c.Size() != 2 {
+		t.Errorf("expected 2 entries, got %d", c.Size())
+	}
+}
+
+func TestSeenCacheExpiry(t *testing.T) {
+	c := newSeenCache(10 * time.Millisecond)
+
+	c.MarkSeen("tx1")
+	time.Sleep(20 * time.Millisecond)
+
+	if c.MarkSeen("tx1") {
+		t.Errorf("expired entry should not be reported as seen")
+	}
+	if c.Size() != 1 {
+		t.Errorf("expected expired entries to be pruned, got %d entries", c.Size())
+	}
+}
+
+func TestSeenCacheForget(t *testing.T) {
+	c := newSeenCache(time.Minute)
+
+	c.MarkSeen("tx1")
+	c.Forget("tx1")
+
+	if c.MarkSeen("tx1") {
+		t.Errorf("forgotten entry should not be reported as seen")
+	}
+}
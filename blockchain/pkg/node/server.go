@@ -1,26 +1,62 @@
 package node
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/mempool"
 	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/pkg/httpserver"
 )
 
+// maxMessageSize caps the body of transactions and blocks pushed to us by peers
+const maxMessageSize = 1 << 20
+
+// Error codes returned in JSON error responses
+const (
+	ErrCodeInvalidJSON        = "invalid_json"
+	ErrCodeInvalidTransaction = "invalid_transaction"
+	ErrCodeDuplicate          = "duplicate_transaction"
+	ErrCodeRejected           = "rejected"
+	ErrCodeInvalidEncoding    = "invalid_encoding"
+)
+
+// APIError is a machine-readable error returned by the API
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// TransactionResponse is returned by POST /transaction
+type TransactionResponse struct {
+	Accepted        bool      `json:"accepted"`
+	TxID            string    `json:"txid,omitempty"`
+	MempoolPosition int       `json:"mempool_position,omitempty"` // 1 = next in line, 0 if not pending
+	MempoolSize     int       `json:"mempool_size"`
+	Error           *APIError `json:"error,omitempty"`
+}
+
 // StartServer starts the HTTP server for the node
 func (n *Node) StartServer() error {
-	http.HandleFunc("/chain", n.handleGetChain)
-	http.HandleFunc("/transaction", n.handleTransaction)
-	http.HandleFunc("/block", n.handleBlock)
-	http.HandleFunc("/peers", n.handlePeers)
-	http.HandleFunc("/balance", n.handleBalance)
-	http.HandleFunc("/mine", n.handleMine)
+	n.logger.Info("starting server", "listen", n.listenAddress())
+	return http.ListenAndServe(n.listenAddress(), n.Handler())
+}
 
-	fmt.Printf("[%s] Starting server...\n", n.Address)
-	return http.ListenAndServe(n.Address, nil)
+// Serve runs the HTTP server until ctx is done, then lets requests in flight
+// finish before returning
+func (n *Node) Serve(ctx context.Context) error {
+	n.logger.Info("starting server", "listen", n.listenAddress())
+	srv := &http.Server{Addr: n.listenAddress(), Handler: n.Handler()}
+	return httpserver.ListenAndServe(ctx, srv, "", "")
 }
 
 // handleGetChain returns the full blockchain
@@ -29,6 +65,22 @@ func (n *Node) handleGetChain(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(n.Chain)
 }
 
+// handleHeaders returns block headers starting at the optional "from" index
+func (n *Node) handleHeaders(w http.ResponseWriter, r *http.Request) {
+	from := 0
+	if v := r.URL.Query().Get("from"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 0 {
+			http.Error(w, "from must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(n.Chain.Headers(from))
+}
+
 // handleTransaction handles incoming transactions
 func (n *Node) handleTransaction(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -42,19 +94,94 @@ func (n *Node) handleTransaction(w http.ResponseWriter, r *http.Request) {
 		n.AddPeer(senderAddr)
 	}
 
+	r.Body = http.MaxBytesReader(w, r.Body, maxMessageSize)
+
 	var tx transaction.Transaction
 	if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		httpserver.WriteJSON(w, http.StatusBadRequest, TransactionResponse{
+			Error: &APIError{Code: ErrCodeInvalidJSON, Message: err.Error()},
+		})
 		return
 	}
 
-	if err := n.ReceiveTransaction(&tx); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	n.submitTransaction(w, &tx)
+}
+
+// RawTransactionRequest carries a canonical binary transaction as hex or base64
+type RawTransactionRequest struct {
+	Hex    string `json:"hex,omitempty"`
+	Base64 string `json:"base64,omitempty"`
+}
+
+// handleRawTransaction accepts a pre-signed transaction in its canonical binary encoding
+func (n *Node) handleRawTransaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "Transaction received")
+	r.Body = http.MaxBytesReader(w, r.Body, maxMessageSize)
+
+	var req RawTransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpserver.WriteJSON(w, http.StatusBadRequest, TransactionResponse{
+			Error: &APIError{Code: ErrCodeInvalidJSON, Message: err.Error()},
+		})
+		return
+	}
+
+	var data []byte
+	var err error
+	switch {
+	case req.Hex != "" && req.Base64 != "":
+		err = fmt.Errorf("set only one of hex or base64")
+	case req.Hex != "":
+		data, err = hex.DecodeString(req.Hex)
+	case req.Base64 != "":
+		data, err = base64.StdEncoding.Strict().DecodeString(req.Base64)
+	default:
+		err = fmt.Errorf("hex or base64 is required")
+	}
+
+	var tx transaction.Transaction
+	if err == nil {
+		err = tx.UnmarshalBinary(data)
+	}
+	if err != nil {
+		httpserver.WriteJSON(w, http.StatusBadRequest, TransactionResponse{
+			Error: &APIError{Code: ErrCodeInvalidEncoding, Message: err.Error()},
+		})
+		return
+	}
+
+	n.submitTransaction(w, &tx)
+}
+
+// submitTransaction adds a decoded transaction to the mempool and writes the outcome
+func (n *Node) submitTransaction(w http.ResponseWriter, tx *transaction.Transaction) {
+	if err := n.ReceiveTransaction(tx); err != nil {
+		code, status := ErrCodeRejected, http.StatusBadRequest
+		switch {
+		case errors.Is(err, mempool.ErrDuplicate):
+			code, status = ErrCodeDuplicate, http.StatusConflict
+		case errors.Is(err, mempool.ErrInvalidTransaction):
+			code = ErrCodeInvalidTransaction
+		}
+		httpserver.WriteJSON(w, status, TransactionResponse{
+			TxID:        tx.ID,
+			MempoolSize: n.Mempool.Size(),
+			Error:       &APIError{Code: code, Message: err.Error()},
+		})
+		return
+	}
+
+	position, _ := n.Mempool.Position(tx.ID)
+	httpserver.WriteJSON(w, http.StatusOK, TransactionResponse{
+		Accepted:        true,
+		TxID:            tx.ID,
+		MempoolPosition: position,
+		MempoolSize:     n.Mempool.Size(),
+	})
 }
 
 // handleBlock handles incoming blocks
@@ -70,9 +197,14 @@ func (n *Node) handleBlock(w http.ResponseWriter, r *http.Request) {
 		n.AddPeer(senderAddr)
 	}
 
-	body, err := io.ReadAll(r.Body)
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMessageSize))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), status)
 		return
 	}
 
@@ -128,6 +260,35 @@ func (n *Node) handleBalance(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]float64{"balance": balance})
 }
 
+// handleProofs returns an address's transactions from the optional "from"
+// height onwards, with inclusion proofs for light clients
+func (n *Node) handleProofs(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	if address == "" {
+		http.Error(w, "address parameter required", http.StatusBadRequest)
+		return
+	}
+
+	from := 0
+	if v := r.URL.Query().Get("from"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 0 {
+			http.Error(w, "from must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(n.Chain.ProveTransactions(address, from))
+}
+
+// handleStatus returns a summary of the node for healthchecks and dashboards
+func (n *Node) handleStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(n.Status())
+}
+
 // handleMine triggers mining of a new block
 func (n *Node) handleMine(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -143,3 +304,52 @@ func (n *Node) handleMine(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, "Block mined successfully")
 }
+
+// handleMiningStart starts continuous mining, with optional "interval" and
+// "empty_interval" duration query parameters (e.g. ?interval=5s&empty_interval=10m)
+func (n *Node) handleMiningStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	interval := DefaultMiningInterval
+	var emptyInterval time.Duration
+	if v := r.URL.Query().Get("interval"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			http.Error(w, "invalid interval: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		interval = d
+	}
+	if v := r.URL.Query().Get("empty_interval"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			http.Error(w, "invalid empty_interval: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		emptyInterval = d
+	}
+
+	if err := n.StartMining(interval, emptyInterval); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"mining": true})
+}
+
+// handleMiningStop stops continuous mining
+func (n *Node) handleMiningStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	n.StopMining()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"mining": false})
+}
@@ -0,0 +1,167 @@
+package node
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+// postTransaction submits a JSON body to handleTransaction and decodes the response
+func postTransaction(t *testing.T, n *Node, body []byte) (int, TransactionResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	n.handleTransaction(rec, httptest.NewRequest(http.MethodPost, "/transaction", bytes.NewReader(body)))
+
+	var resp TransactionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return rec.Code, resp
+}
+
+func TestHandleTransaction(t *testing.T) {
+	n, err := New("localhost:9000", 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	sender, _ := wallet.New()
+
+	tx := transaction.New(sender.Address(), "bob", 5.0)
+	tx.Sign(sender.PrivateKey)
+	body, _ := json.Marshal(tx)
+
+	status, resp := postTransaction(t, n, body)
+	if status != http.StatusOK || !resp.Accepted {
+		t.Fatalf("expected transaction to be accepted, got %d %+v", status, resp)
+	}
+	if resp.TxID != tx.ID {
+		t.Errorf("expected txid %s, got %s", tx.ID, resp.TxID)
+	}
+	if resp.MempoolPosition != 1 || resp.MempoolSize != 1 {
+		t.Errorf("expected position 1 of 1, got %d of %d", resp.MempoolPosition, resp.MempoolSize)
+	}
+
+	// The relayed signature must survive the JSON round trip
+	pending, _ := n.Mempool.Get(tx.ID)
+	if !pending.Verify(sender.PublicKey) {
+		t.Errorf("submitted transaction signature should verify")
+	}
+}
+
+func TestHandleTransactionRejections(t *testing.T) {
+	n, err := New("localhost:9000", 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+
+	unsigned, _ := json.Marshal(transaction.New("alice", "bob", 5.0))
+
+	tests := []struct {
+		name       string
+		body       []byte
+		wantStatus int
+		wantCode   string
+	}{
+		{"malformed JSON", []byte("{"), http.StatusBadRequest, ErrCodeInvalidJSON},
+		{"unsigned transaction", unsigned, http.StatusBadRequest, ErrCodeInvalidTransaction},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, resp := postTransaction(t, n, tt.body)
+			if status != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, status)
+			}
+			if resp.Accepted || resp.Error == nil || resp.Error.Code != tt.wantCode {
+				t.Errorf("expected rejection with code %s, got %+v", tt.wantCode, resp)
+			}
+		})
+	}
+}
+
+// postRawTransaction submits a RawTransactionRequest to handleRawTransaction
+func postRawTransaction(t *testing.T, n *Node, req RawTransactionRequest) (int, TransactionResponse) {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	rec := httptest.NewRecorder()
+	n.handleRawTransaction(rec, httptest.NewRequest(http.MethodPost, "/transaction/raw", bytes.NewReader(body)))
+
+	var resp TransactionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return rec.Code, resp
+}
+
+func TestHandleRawTransaction(t *testing.T) {
+	n, err := New("localhost:9000", 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	sender, _ := wallet.New()
+
+	first := transaction.New(sender.Address(), "bob", 5.0)
+	first.Sign(sender.PrivateKey)
+	data, _ := first.MarshalBinary()
+
+	status, resp := postRawTransaction(t, n, RawTransactionRequest{Hex: hex.EncodeToString(data)})
+	if status != http.StatusOK || !resp.Accepted || resp.TxID != first.ID {
+		t.Fatalf("expected hex transaction %s to be accepted, got %d %+v", first.ID, status, resp)
+	}
+
+	second := transaction.New(sender.Address(), "carol", 2.0)
+	second.Sign(sender.PrivateKey)
+	data, _ = second.MarshalBinary()
+
+	status, resp = postRawTransaction(t, n, RawTransactionRequest{Base64: base64.StdEncoding.EncodeToString(data)})
+	if status != http.StatusOK || !resp.Accepted || resp.MempoolSize != 2 {
+		t.Fatalf("expected base64 transaction to be accepted, got %d %+v", status, resp)
+	}
+
+	// Resubmitting the same bytes decodes to the same ID and doesn't add a second copy
+	postRawTransaction(t, n, RawTransactionRequest{Hex: hex.EncodeToString(data)})
+	if n.Mempool.Size() != 2 {
+		t.Errorf("expected 2 pending transactions, got %d", n.Mempool.Size())
+	}
+}
+
+func TestHandleRawTransactionRejections(t *testing.T) {
+	n, err := New("localhost:9000", 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	sender, _ := wallet.New()
+	tx := transaction.New(sender.Address(), "bob", 5.0)
+	tx.Sign(sender.PrivateKey)
+	data, _ := tx.MarshalBinary()
+
+	tests := []struct {
+		name string
+		req  RawTransactionRequest
+	}{
+		{"empty", RawTransactionRequest{}},
+		{"both encodings", RawTransactionRequest{Hex: hex.EncodeToString(data), Base64: base64.StdEncoding.EncodeToString(data)}},
+		{"bad hex", RawTransactionRequest{Hex: "zz"}},
+		{"trailing bytes", RawTransactionRequest{Hex: hex.EncodeToString(append(data, 0))}},
+		{"truncated", RawTransactionRequest{Base64: base64.StdEncoding.EncodeToString(data[:len(data)-10])}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, resp := postRawTransaction(t, n, tt.req)
+			if status != http.StatusBadRequest || resp.Error == nil || resp.Error.Code != ErrCodeInvalidEncoding {
+				t.Errorf("expected invalid_encoding rejection, got %d %+v", status, resp)
+			}
+		})
+	}
+	if n.Mempool.Size() != 0 {
+		t.Errorf("expected empty mempool, got %d", n.Mempool.Size())
+	}
+}
@@ -0,0 +1,287 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/websocket"
+)
+
+const (
+	// peerPingInterval is how often an idle session is pinged
+	peerPingInterval = 30 * time.Second
+
+	// peerIdleTimeout closes a session that has sent nothing for this long
+	peerIdleTimeout = 3 * peerPingInterval
+
+	// peerWriteTimeout bounds each message write on a session
+	peerWriteTimeout = 5 * time.Second
+
+	// maxReconnectBackoff caps the wait between attempts to re-open a session
+	maxReconnectBackoff = time.Minute
+)
+
+// Peer message types
+const (
+	MsgTx      = "tx"      // data: a transaction
+	MsgBlock   = "block"   // data: a newly mined block
+	MsgPing    = "ping"    // no data; answered with pong
+	MsgPong    = "pong"    // no data
+	MsgHeaders = "headers" // data: the sender's tip header, sent on connect
+)
+
+// PeerMessage is a typed message exchanged over a peer session
+type PeerMessage struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// peerSession is an open WebSocket channel to a peer
+type peerSession struct {
+	peer string
+	conn *websocket.Conn
+}
+
+// send writes a message to the peer
+func (s *peerSession) send(msgType string, v any) error {
+	msg := PeerMessage{Type: msgType}
+	if v != nil {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		msg.Data = data
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	s.conn.SetWriteDeadline(time.Now().Add(peerWriteTimeout))
+	return s.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// StartPeerSessions keeps a persistent WebSocket session open to every peer,
+// current and future, until ctx is cancelled. Transactions and blocks are
+// pushed over sessions instead of one HTTP request each; peers without a
+// session still get them over HTTP.
+func (n *Node) StartPeerSessions(ctx context.Context) {
+	n.sessionsMutex.Lock()
+	n.sessionsCtx = ctx
+	n.sessionsMutex.Unlock()
+
+	for _, peer := range n.GetPeers() {
+		go n.maintainSession(ctx, peer)
+	}
+}
+
+// startSession starts maintaining a session to a newly added peer, if sessions are enabled
+func (n *Node) startSession(peer string) {
+	n.sessionsMutex.RLock()
+	ctx := n.sessionsCtx
+	n.sessionsMutex.RUnlock()
+
+	if ctx != nil {
+		go n.maintainSession(ctx, peer)
+	}
+}
+
+// maintainSession dials a peer and re-dials with backoff whenever the session drops.
+// Only the node with the lower address dials, so a pair of peers never opens two
+// sessions; the other side just makes sure the peer knows about it.
+func (n *Node) maintainSession(ctx context.Context, peer string) {
+	if n.Address > peer {
+		n.announceTo(ctx, peer)
+		return
+	}
+
+	backoff := time.Second
+	for ctx.Err() == nil {
+		if n.session(peer) == nil && !n.penalties.IsBanned(peer) {
+			if err := n.dialSession(ctx, peer); err != nil {
+				n.logger.Debug("peer session failed", "peer", peer, "err", err, "retry_in", backoff)
+				backoff = min(backoff*2, maxReconnectBackoff)
+			} else {
+				backoff = time.Second
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(jitter(backoff)):
+		}
+	}
+}
+
+// dialSession opens a session to a peer and serves it until it closes
+func (n *Node) dialSession(ctx context.Context, peer string) error {
+	dialCtx, cancel := context.WithTimeout(ctx, n.peerClient.Timeout)
+	defer cancel()
+
+	header := http.Header{"X-Node-Address": {n.Address}}
+	conn, err := websocket.Dial(dialCtx, fmt.Sprintf("ws://%s%s/peer/ws", peer, APIPrefix), header)
+	if err != nil {
+		return err
+	}
+	return n.runSession(ctx, peer, conn)
+}
+
+// handlePeerWS accepts a session opened by a peer
+func (n *Node) handlePeerWS(w http.ResponseWriter, r *http.Request) {
+	peer := r.Header.Get("X-Node-Address")
+	if !validPeerAddress(peer) || peer == n.Address {
+		http.Error(w, "X-Node-Address header with a host:port is required", http.StatusBadRequest)
+		return
+	}
+	if n.penalties.IsBanned(peer) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	n.AddPeer(peer)
+	n.runSession(r.Context(), peer, conn)
+}
+
+// runSession registers a session, pings it while idle and dispatches its
+// messages until the connection fails or ctx is cancelled
+func (n *Node) runSession(ctx context.Context, peer string, conn *websocket.Conn) error {
+	defer conn.Close()
+	conn.SetReadLimit(maxMessageSize)
+
+	s := &peerSession{peer: peer, conn: conn}
+	if !n.registerSession(s) {
+		// A stale session is still registered; the peer will redial once it times out
+		return nil
+	}
+	defer n.unregisterSession(s)
+	n.logger.Info("peer session opened", "peer", peer)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		ticker := time.NewTicker(peerPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				conn.Close()
+				return
+			case <-ticker.C:
+				if s.send(MsgPing, nil) != nil {
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	if err := s.send(MsgHeaders, n.Chain.GetLatestBlock().Header()); err != nil {
+		return err
+	}
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(peerIdleTimeout))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if !errors.Is(err, websocket.ErrClosed) {
+				n.logger.Info("peer session closed", "peer", peer, "err", err)
+			}
+			return err
+		}
+
+		var msg PeerMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			n.penalizePeer(peer, fmt.Errorf("malformed session message: %w", err))
+			continue
+		}
+		n.handlePeerMessage(s, msg)
+	}
+}
+
+// handlePeerMessage acts on one message from a peer session
+func (n *Node) handlePeerMessage(s *peerSession, msg PeerMessage) {
+	switch msg.Type {
+	case MsgPing:
+		s.send(MsgPong, nil)
+
+	case MsgPong:
+
+	case MsgTx:
+		var tx transaction.Transaction
+		if err := json.Unmarshal(msg.Data, &tx); err != nil {
+			n.penalizePeer(s.peer, fmt.Errorf("malformed transaction: %w", err))
+			return
+		}
+		if err := n.ReceiveTransaction(&tx); err != nil {
+			n.logger.Debug("rejected transaction from peer session", "peer", s.peer, "txid", tx.ID, "err", err)
+		}
+
+	case MsgBlock:
+		// Syncing can take a while; don't hold up the session's other messages
+		go func() {
+			if err := n.ReceiveBlock(msg.Data); err != nil {
+				n.logger.Debug("failed to process block from peer session", "peer", s.peer, "err", err)
+			}
+		}()
+
+	case MsgHeaders:
+		var h block.Header
+		if err := json.Unmarshal(msg.Data, &h); err != nil {
+			n.penalizePeer(s.peer, fmt.Errorf("malformed header: %w", err))
+			return
+		}
+		if h.Index > n.Chain.GetLatestBlock().Index {
+			go n.SyncWithPeers(n.ctx)
+		}
+
+	default:
+		// Newer peers may send types we don't know yet
+		n.logger.Debug("ignoring unknown peer message", "peer", s.peer, "type", msg.Type)
+	}
+}
+
+// registerSession records a session unless the peer already has one
+func (n *Node) registerSession(s *peerSession) bool {
+	n.sessionsMutex.Lock()
+	defer n.sessionsMutex.Unlock()
+
+	if _, exists := n.sessions[s.peer]; exists {
+		return false
+	}
+	n.sessions[s.peer] = s
+	return true
+}
+
+// unregisterSession forgets a session once it has closed
+func (n *Node) unregisterSession(s *peerSession) {
+	n.sessionsMutex.Lock()
+	defer n.sessionsMutex.Unlock()
+
+	if n.sessions[s.peer] == s {
+		delete(n.sessions, s.peer)
+	}
+}
+
+// session returns the open session to a peer, if any
+func (n *Node) session(peer string) *peerSession {
+	n.sessionsMutex.RLock()
+	defer n.sessionsMutex.RUnlock()
+	return n.sessions[peer]
+}
+
+// sessionCount returns how many peer sessions are open
+func (n *Node) sessionCount() int {
+	n.sessionsMutex.RLock()
+	defer n.sessionsMutex.RUnlock()
+	return len(n.sessions)
+}
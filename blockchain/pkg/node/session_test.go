@@ -0,0 +1,92 @@
+package node
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+// startTestNode runs a node's API on a local listener, with the node's
+// address set to the listener so peers can dial it
+func startTestNode(t *testing.T) *Node {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(nil)
+	n, err := New(srv.Listener.Addr().String(), 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	srv.Config.Handler = n.Handler()
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return n
+}
+
+// waitFor polls cond until it holds or the deadline passes
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPeerSessionRelaysTransactions(t *testing.T) {
+	a := startTestNode(t)
+	b := startTestNode(t)
+
+	// Only the lower address dials, so start sessions on both sides
+	a.StartPeerSessions(t.Context())
+	b.StartPeerSessions(t.Context())
+	a.AddPeer(b.Address)
+
+	waitFor(t, "sessions to open", func() bool {
+		return a.session(b.Address) != nil && b.session(a.Address) != nil
+	})
+
+	sender, _ := wallet.New()
+	tx := transaction.New(sender.Address(), "bob", 5.0)
+	tx.Sign(sender.PrivateKey)
+	if err := a.ReceiveTransaction(tx); err != nil {
+		t.Fatalf("failed to submit transaction: %v", err)
+	}
+
+	waitFor(t, "transaction to reach the peer", func() bool {
+		_, ok := b.Mempool.Get(tx.ID)
+		return ok
+	})
+	if got := b.metrics.Snapshot()["/transaction"].Requests; got != 0 {
+		t.Errorf("transaction should travel over the session, not HTTP (%d HTTP requests)", got)
+	}
+}
+
+func TestPeerSessionTriggersSyncOnLongerTip(t *testing.T) {
+	a := startTestNode(t)
+	b := startTestNode(t)
+	b.Chain.AddBlock(nil, b.Wallet.Address())
+
+	a.StartPeerSessions(t.Context())
+	b.StartPeerSessions(t.Context())
+	a.AddPeer(b.Address)
+	b.AddPeer(a.Address)
+
+	// The tip header exchanged on connect tells the shorter side to sync
+	waitFor(t, "shorter node to catch up", func() bool {
+		return a.Chain.Length() == 2 && b.Chain.Length() == 2
+	})
+}
+
+func TestPeerWSRequiresAddress(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	rec := httptest.NewRecorder()
+	n.handlePeerWS(rec, httptest.NewRequest("GET", "/api/v1/peer/ws", strings.NewReader("")))
+	if rec.Code != 400 {
+		t.Errorf("expected 400 without X-Node-Address, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,206 @@
+// Package simnet runs a network of nodes inside one process. Nodes reach each
+// other through an in-memory transport instead of real ports, and tests can
+// partition the network or add latency to exercise consensus and sync.
+package simnet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+	"github.com/oksmith/home-server/blockchain/pkg/node"
+)
+
+// ErrUnreachable is returned for requests between nodes that are partitioned
+// from each other, or to addresses that aren't in the network
+var ErrUnreachable = errors.New("simnet: host unreachable")
+
+// Network is a set of in-process nodes connected by a simulated network
+type Network struct {
+	Nodes    []*node.Node
+	handlers map[string]http.Handler // node address -> API
+	groups   map[string]int          // node address -> partition group
+	latency  time.Duration
+	mu       sync.RWMutex
+}
+
+// New creates size nodes sharing one genesis block and peered with each other.
+// Node i is reachable at "node<i>:8080".
+func New(size, difficulty int, miningReward float64) (*Network, error) {
+	genesis := chain.New(difficulty, miningReward)
+	nw := &Network{
+		handlers: make(map[string]http.Handler),
+		groups:   make(map[string]int),
+	}
+
+	for i := 0; i < size; i++ {
+		address := fmt.Sprintf("node%d:8080", i)
+		n, err := node.New(address, difficulty, miningReward)
+		if err != nil {
+			nw.Close()
+			return nil, err
+		}
+		// Nodes normally mine their own genesis block; share one so chains line up
+		if err := n.Chain.ReplaceWith(genesis); err != nil {
+			nw.Close()
+			return nil, err
+		}
+		n.SetHTTPClient(&http.Client{Transport: &transport{nw: nw, from: address}})
+		// Unreachable peers fail instantly here, so retrying them only slows tests down
+		n.SetPeerClientConfig(node.PeerClientConfig{Timeout: 5 * time.Second})
+
+		nw.Nodes = append(nw.Nodes, n)
+		nw.handlers[address] = n.Handler()
+	}
+
+	for _, n := range nw.Nodes {
+		for _, peer := range nw.Nodes {
+			n.AddPeer(peer.Address)
+		}
+	}
+	return nw, nil
+}
+
+// Close shuts every node down, cancelling their in-flight requests
+func (nw *Network) Close() {
+	for _, n := range nw.Nodes {
+		n.StopMining()
+		n.Shutdown()
+	}
+}
+
+// SetLatency delays every request and response between nodes by d
+func (nw *Network) SetLatency(d time.Duration) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	nw.latency = d
+}
+
+// Partition splits the network so nodes can only reach others in the same
+// group. Groups list node indexes; nodes left out form a group of their own.
+func (nw *Network) Partition(groups ...[]int) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+
+	nw.groups = make(map[string]int)
+	for i, group := range groups {
+		for _, idx := range group {
+			nw.groups[nw.Nodes[idx].Address] = i + 1
+		}
+	}
+}
+
+// Heal removes all partitions
+func (nw *Network) Heal() {
+	nw.Partition()
+}
+
+// reachable reports whether from can currently send to to
+func (nw *Network) reachable(from, to string) bool {
+	nw.mu.RLock()
+	defer nw.mu.RUnlock()
+	return nw.groups[from] == nw.groups[to]
+}
+
+// SyncAll has each node sync with its peers in turn, in index order
+func (nw *Network) SyncAll(ctx context.Context) error {
+	for _, n := range nw.Nodes {
+		if err := n.SyncWithPeers(ctx); err != nil {
+			return fmt.Errorf("%s: %w", n.Address, err)
+		}
+	}
+	return nil
+}
+
+// Converged reports whether every node has the same chain tip
+func (nw *Network) Converged() bool {
+	tip := nw.Nodes[0].Chain.GetLatestBlock().Hash
+	for _, n := range nw.Nodes[1:] {
+		if n.Chain.GetLatestBlock().Hash != tip {
+			return false
+		}
+	}
+	return true
+}
+
+// WaitFor polls cond until it holds or ctx is done. Broadcasts are delivered
+// in the background, so tests wait for their effects rather than sleeping.
+func (nw *Network) WaitFor(ctx context.Context, cond func() bool) error {
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+	for !cond() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// transport delivers a node's HTTP requests straight to the addressed node's handler
+type transport struct {
+	nw   *Network
+	from string
+}
+
+// RoundTrip serves req with the target node's handler, applying latency and partitions
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		defer req.Body.Close()
+	}
+
+	t.nw.mu.RLock()
+	handler, exists := t.nw.handlers[req.URL.Host]
+	latency := t.nw.latency
+	t.nw.mu.RUnlock()
+
+	if !exists || !t.nw.reachable(t.from, req.URL.Host) {
+		return nil, fmt.Errorf("%w: %s", ErrUnreachable, req.URL.Host)
+	}
+	if err := sleep(req.Context(), latency); err != nil {
+		return nil, err
+	}
+
+	serverReq := req.Clone(req.Context())
+	serverReq.RequestURI = req.URL.RequestURI()
+	serverReq.RemoteAddr = t.from
+	if serverReq.Body == nil {
+		serverReq.Body = http.NoBody
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, serverReq)
+
+	// A partition that formed while the request was in flight drops the response
+	if !t.nw.reachable(req.URL.Host, t.from) {
+		return nil, fmt.Errorf("%w: %s", ErrUnreachable, req.URL.Host)
+	}
+	if err := sleep(req.Context(), latency); err != nil {
+		return nil, err
+	}
+
+	resp := rec.Result()
+	resp.Request = req
+	return resp, nil
+}
+
+// sleep waits for d unless ctx is done first
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
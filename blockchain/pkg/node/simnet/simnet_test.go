@@ -0,0 +1,107 @@
+package simnet
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+)
+
+func newNetwork(t *testing.T, size int) *Network {
+	t.Helper()
+	nw, err := New(size, 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to create network: %v", err)
+	}
+	t.Cleanup(nw.Close)
+	return nw
+}
+
+func waitFor(t *testing.T, nw *Network, what string, cond func() bool) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	defer cancel()
+	if err := nw.WaitFor(ctx, cond); err != nil {
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+func TestNetworkSharesGenesis(t *testing.T) {
+	nw := newNetwork(t, 3)
+	if !nw.Converged() {
+		t.Error("new nodes should start on the same genesis block")
+	}
+	if got := len(nw.Nodes[0].GetPeers()); got != 2 {
+		t.Errorf("expected each node to peer with the other 2, got %d", got)
+	}
+}
+
+func TestMinedBlockPropagates(t *testing.T) {
+	nw := newNetwork(t, 3)
+	if err := nw.Nodes[0].Mine(); err != nil {
+		t.Fatalf("failed to mine: %v", err)
+	}
+
+	waitFor(t, nw, "the block to reach every node", func() bool {
+		return nw.Converged() && nw.Nodes[2].Chain.Length() == 2
+	})
+}
+
+func TestPartitionHealsToLongestChain(t *testing.T) {
+	nw := newNetwork(t, 3)
+	nw.Partition([]int{0, 1}, []int{2})
+
+	// The majority side mines one block, the isolated node mines two
+	nw.Nodes[0].Mine()
+	nw.Nodes[2].Mine()
+	nw.Nodes[2].Mine()
+
+	waitFor(t, nw, "the majority side to agree", func() bool {
+		return nw.Nodes[1].Chain.Length() == 2
+	})
+	if nw.Converged() {
+		t.Fatal("partitioned sides should not have converged")
+	}
+
+	nw.Heal()
+	if err := nw.SyncAll(t.Context()); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if !nw.Converged() {
+		t.Fatal("nodes should converge once the partition heals")
+	}
+	if got := nw.Nodes[0].Chain.Length(); got != 3 {
+		t.Errorf("expected the longer 3-block chain to win, got %d blocks", got)
+	}
+}
+
+func TestPartitionedRequestsFail(t *testing.T) {
+	nw := newNetwork(t, 2)
+	nw.Partition([]int{0}, []int{1})
+
+	_, err := nw.Nodes[0].BroadcastTransaction(t.Context(), transaction.New("alice", "bob", 1))
+	if !errors.Is(err, ErrUnreachable) {
+		t.Errorf("expected ErrUnreachable across a partition, got %v", err)
+	}
+}
+
+func TestLatencyRespectsTimeouts(t *testing.T) {
+	nw := newNetwork(t, 2)
+	nw.SetLatency(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := nw.Nodes[0].BroadcastBlock(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the slow request to time out, got %v", err)
+	}
+
+	start := time.Now()
+	if _, err := nw.Nodes[0].BroadcastBlock(t.Context()); err != nil {
+		t.Fatalf("broadcast failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expected at least a 100ms round trip, took %s", elapsed)
+	}
+}
@@ -0,0 +1,104 @@
+package node
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+	"github.com/oksmith/home-server/pkg/httpserver"
+)
+
+// maxSnapshotSize bounds how much compressed data a snapshot import will read
+const maxSnapshotSize = 512 << 20
+
+// ImportChain replaces the node's chain with a validated snapshot. Unless force
+// is set, the snapshot must be longer than the current chain, like a peer sync.
+func (n *Node) ImportChain(snapshot *chain.Chain, force bool) error {
+	n.syncMutex.Lock()
+	defer n.syncMutex.Unlock()
+
+	if !force && snapshot.Length() <= n.Chain.Length() {
+		return fmt.Errorf("snapshot has %d blocks, not longer than current chain (%d blocks)",
+			snapshot.Length(), n.Chain.Length())
+	}
+
+	if err := n.adoptChain(snapshot); err != nil {
+		return err
+	}
+
+	n.logger.Info("imported chain snapshot", "height", snapshot.GetLatestBlock().Index)
+	return nil
+}
+
+// Bootstrap imports a trusted snapshot from a file path or http(s) URL,
+// typically before the node first syncs with peers
+func (n *Node) Bootstrap(source string) error {
+	var r io.Reader
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		client := &http.Client{Timeout: 5 * time.Minute}
+		resp, err := client.Get(source)
+		if err != nil {
+			return fmt.Errorf("failed to download snapshot: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("failed to download snapshot: status %d", resp.StatusCode)
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(source)
+		if err != nil {
+			return fmt.Errorf("failed to open snapshot: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	snapshot, err := chain.ReadSnapshot(io.LimitReader(r, maxSnapshotSize))
+	if err != nil {
+		return err
+	}
+	return n.ImportChain(snapshot, false)
+}
+
+// handleChainExport streams the chain as a gzip-compressed JSON snapshot
+func (n *Node) handleChainExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	height := n.Chain.GetLatestBlock().Index
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=chain-%d.json.gz", height))
+	if err := n.Chain.WriteSnapshot(w); err != nil {
+		n.logger.Warn("chain export failed", "err", err)
+	}
+}
+
+// handleChainImport replaces the chain with an uploaded snapshot (admin only).
+// Pass ?force=true to import a snapshot that isn't longer than the current chain.
+func (n *Node) handleChainImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	snapshot, err := chain.ReadSnapshot(http.MaxBytesReader(w, r.Body, maxSnapshotSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	force := r.URL.Query().Get("force") == "true"
+	if err := n.ImportChain(snapshot, force); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	httpserver.WriteJSON(w, http.StatusOK, map[string]int64{"height": n.Chain.GetLatestBlock().Index})
+}
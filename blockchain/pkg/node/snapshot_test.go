@@ -0,0 +1,97 @@
+package node
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportImportChain(t *testing.T) {
+	source, err := New("localhost:9000", 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	source.Chain.AddBlock(nil, source.Wallet.Address())
+	source.Chain.AddBlock(nil, source.Wallet.Address())
+
+	rec := httptest.NewRecorder()
+	source.handleChainExport(rec, httptest.NewRequest(http.MethodGet, "/chain/export", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export failed with status %d", rec.Code)
+	}
+	snapshot := rec.Body.Bytes()
+
+	target, err := New("localhost:9001", 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	target.SetAdminToken("secret")
+	handler := target.requireAdmin(target.handleChainImport)
+
+	// Without the admin token the import is refused
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/chain/import", bytes.NewReader(snapshot)))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without token, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/chain/import", bytes.NewReader(snapshot))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected import to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if target.Chain.Length() != 3 {
+		t.Errorf("expected imported chain length 3, got %d", target.Chain.Length())
+	}
+	if target.Chain.GetBalance(source.Wallet.Address()) != 20.0 {
+		t.Errorf("expected imported balances to be rebuilt")
+	}
+
+	// Re-importing the same snapshot isn't longer, so it needs force
+	req = httptest.NewRequest(http.MethodPost, "/chain/import", bytes.NewReader(snapshot))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 for non-longer snapshot, got %d", rec.Code)
+	}
+}
+
+func TestAdminDisabledWithoutToken(t *testing.T) {
+	n := &Node{}
+	rec := httptest.NewRecorder()
+	n.requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not run")
+	})(rec, httptest.NewRequest(http.MethodPost, "/chain/import", nil))
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 with no admin token configured, got %d", rec.Code)
+	}
+}
+
+func TestBootstrapFromFile(t *testing.T) {
+	source, _ := New("localhost:9000", 1, 10.0)
+	source.Chain.AddBlock(nil, source.Wallet.Address())
+
+	filename := filepath.Join(t.TempDir(), "chain.json.gz")
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source.Chain.WriteSnapshot(f)
+	f.Close()
+
+	target, _ := New("localhost:9001", 1, 10.0)
+	if err := target.Bootstrap(filename); err != nil {
+		t.Fatalf("bootstrap failed: %v", err)
+	}
+	if target.Chain.GetLatestBlock().Hash != source.Chain.GetLatestBlock().Hash {
+		t.Errorf("expected bootstrapped tip to match snapshot")
+	}
+}
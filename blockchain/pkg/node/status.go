@@ -0,0 +1,128 @@
+package node
+
+import (
+	"sync"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+)
+
+// Status is a point-in-time summary of the node, served by GET /status
+type Status struct {
+	BuildInfo
+	Regtest       bool           `json:"regtest,omitempty"`
+	Address       string         `json:"address"`
+	WalletAddress string         `json:"wallet_address"`
+	UptimeSeconds int64          `json:"uptime_seconds"`
+	Height        int64          `json:"height"`
+	BestBlockHash string         `json:"best_block_hash"`
+	Difficulty    int            `json:"difficulty"`
+	MiningReward  float64        `json:"mining_reward"`
+	Emission      chain.Emission `json:"emission,omitzero"`
+	NextReward    float64        `json:"next_reward"`   // what the next block's coinbase may mint, before fees
+	ChainWork     string         `json:"chain_work"`    // cumulative proof of work, in expected hashes
+	SideBlocks    int            `json:"side_blocks"`   // blocks held on competing branches
+	OrphanBlocks  int            `json:"orphan_blocks"` // blocks held until their parent arrives
+	PeerCount     int            `json:"peer_count"`
+	PeerSessions  int            `json:"peer_sessions"` // peers connected over a WebSocket session
+	MempoolSize   int            `json:"mempool_size"`
+	Mining        MiningStatus   `json:"mining"`
+	Sync          SyncStatus     `json:"sync"`
+}
+
+// MiningStatus describes the node's mining activity
+type MiningStatus struct {
+	Enabled       bool                 `json:"enabled"`                  // continuous mining loop running
+	Active        bool                 `json:"active"`                   // a block is being mined right now
+	Interval      string               `json:"interval,omitempty"`       // continuous mining check interval
+	EmptyInterval string               `json:"empty_interval,omitempty"` // empty block interval, if any
+	Throttle      block.ThrottleConfig `json:"throttle"`
+}
+
+// SyncStatus describes the node's most recent chain sync
+type SyncStatus struct {
+	Syncing   bool       `json:"syncing"`
+	LastSync  *time.Time `json:"last_sync,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// syncTracker records sync progress for status reporting
+type syncTracker struct {
+	syncing  bool
+	lastSync time.Time
+	lastErr  error
+	mu       sync.Mutex
+}
+
+// begin marks a sync as in progress
+func (s *syncTracker) begin() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.syncing = true
+}
+
+// end marks a sync as finished with the given result
+func (s *syncTracker) end(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.syncing = false
+	s.lastErr = err
+	if err == nil {
+		s.lastSync = time.Now()
+	}
+}
+
+// status returns a snapshot of the tracked sync state
+func (s *syncTracker) status() SyncStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := SyncStatus{Syncing: s.syncing}
+	if !s.lastSync.IsZero() {
+		lastSync := s.lastSync
+		st.LastSync = &lastSync
+	}
+	if s.lastErr != nil {
+		st.LastError = s.lastErr.Error()
+	}
+	return st
+}
+
+// Status returns the node's current status
+func (n *Node) Status() Status {
+	tip := n.Chain.GetLatestBlock()
+
+	n.miningMutex.Lock()
+	mining := MiningStatus{Active: n.isMining, Throttle: n.throttle.Config()}
+	if n.miner != nil {
+		mining.Enabled = true
+		mining.Interval = n.miner.interval.String()
+		if n.miner.emptyInterval > 0 {
+			mining.EmptyInterval = n.miner.emptyInterval.String()
+		}
+	}
+	n.miningMutex.Unlock()
+
+	return Status{
+		BuildInfo:     Build(),
+		Regtest:       n.regtest,
+		Address:       n.Address,
+		WalletAddress: n.Wallet.Address(),
+		UptimeSeconds: int64(time.Since(n.startedAt).Seconds()),
+		Height:        tip.Index,
+		BestBlockHash: tip.Hash,
+		Difficulty:    n.Chain.Difficulty,
+		MiningReward:  n.Chain.MiningReward,
+		Emission:      n.Chain.Emission,
+		NextReward:    n.Chain.RewardAt(tip.Index + 1),
+		ChainWork:     n.Chain.Work().String(),
+		SideBlocks:    n.Chain.SideBlocks(),
+		OrphanBlocks:  n.Chain.OrphanBlocks(),
+		PeerCount:     len(n.GetPeers()),
+		PeerSessions:  n.sessionCount(),
+		MempoolSize:   n.Mempool.Size(),
+		Mining:        mining,
+		Sync:          n.syncState.status(),
+	}
+}
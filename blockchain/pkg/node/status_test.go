@@ -0,0 +1,78 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+)
+
+func TestStatus(t *testing.T) {
+	n, err := New("localhost:9000", 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	n.AddPeer("localhost:9001")
+	if err := n.Chain.AddBlock(nil, n.Wallet.Address()); err != nil {
+		t.Fatalf("failed to add block: %v", err)
+	}
+
+	st := n.Status()
+	if st.Version != Version || st.GoVersion == "" {
+		t.Errorf("expected version %s and a Go version, got %+v", Version, st.BuildInfo)
+	}
+	if st.ProtocolVersion != ProtocolVersion || st.ChainRulesVersion != chain.RulesVersion {
+		t.Errorf("expected protocol %d and chain rules %d, got %+v", ProtocolVersion, chain.RulesVersion, st.BuildInfo)
+	}
+	if st.Height != 1 {
+		t.Errorf("expected height 1, got %d", st.Height)
+	}
+	if st.BestBlockHash != n.Chain.GetLatestBlock().Hash {
+		t.Errorf("best block hash mismatch")
+	}
+	if st.PeerCount != 1 {
+		t.Errorf("expected 1 peer, got %d", st.PeerCount)
+	}
+	if st.Mining.Enabled || st.Mining.Active {
+		t.Errorf("expected mining to be idle, got %+v", st.Mining)
+	}
+	if st.Sync.LastSync != nil {
+		t.Errorf("expected no sync yet, got %v", st.Sync.LastSync)
+	}
+
+	// Status is served as JSON
+	rec := httptest.NewRecorder()
+	n.handleStatus(rec, httptest.NewRequest("GET", "/status", nil))
+	var decoded Status
+	if err := json.NewDecoder(rec.Body).Decode(&decoded); err != nil {
+		t.Fatalf("failed to decode status: %v", err)
+	}
+	if decoded.WalletAddress != n.Wallet.Address() {
+		t.Errorf("expected wallet address in status response")
+	}
+}
+
+func TestSyncTracker(t *testing.T) {
+	var s syncTracker
+
+	s.begin()
+	if !s.status().Syncing {
+		t.Errorf("expected syncing after begin")
+	}
+
+	s.end(errors.New("no peers reachable"))
+	st := s.status()
+	if st.Syncing || st.LastError != "no peers reachable" || st.LastSync != nil {
+		t.Errorf("unexpected status after failed sync: %+v", st)
+	}
+
+	before := time.Now()
+	s.end(nil)
+	st = s.status()
+	if st.LastError != "" || st.LastSync == nil || st.LastSync.Before(before) {
+		t.Errorf("unexpected status after successful sync: %+v", st)
+	}
+}
@@ -0,0 +1,182 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+)
+
+const (
+	// maxSyncBackoff caps how long the sync loop waits after repeated failures
+	maxSyncBackoff = 5 * time.Minute
+
+	// maxChainResponseSize caps how much of a peer's /chain response is read
+	maxChainResponseSize = 64 << 20
+
+	// maxHeadersResponseSize caps how much of a peer's /headers response is read
+	maxHeadersResponseSize = 16 << 20
+
+	// maxPeerBlocks is the most blocks or headers accepted in one peer response
+	maxPeerBlocks = 100_000
+)
+
+// errResponseTooLarge is returned when a peer's response exceeds its size limit
+var errResponseTooLarge = errors.New("response too large")
+
+// StartSyncLoop periodically reconciles the chain with peers until ctx is cancelled,
+// so a node that missed broadcasts while offline catches up automatically.
+// Each round compares peer headers first and only downloads full chains when a
+// peer is ahead. Failed rounds back off exponentially, and every wait is jittered
+// so nodes started together don't all sync in lockstep.
+func (n *Node) StartSyncLoop(ctx context.Context, interval time.Duration) {
+	go func() {
+		wait := interval
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(jitter(wait)):
+			}
+
+			err := n.syncRound(ctx)
+			n.syncState.end(err)
+			if err != nil {
+				wait = min(wait*2, maxSyncBackoff)
+				n.logger.Warn("sync round failed", "err", err, "retry_in", wait)
+				continue
+			}
+			wait = interval
+		}
+	}()
+}
+
+// syncRound checks peer headers and syncs the full chain if any peer is ahead
+func (n *Node) syncRound(ctx context.Context) error {
+	peers := n.syncPeers()
+	if len(peers) == 0 {
+		return nil
+	}
+
+	tip := n.Chain.GetLatestBlock()
+	reachable := 0
+	for _, peer := range peers {
+		headers, err := n.fetchHeaders(ctx, peer, tip.Index)
+		if err != nil {
+			continue
+		}
+		reachable++
+
+		// Headers start at our tip, so anything beyond the first means the peer is ahead
+		if len(headers) > 1 {
+			n.logger.Info("peer is ahead, syncing",
+				"peer", peer, "peer_height", headers[len(headers)-1].Index, "height", tip.Index)
+			return n.SyncWithPeers(ctx)
+		}
+	}
+
+	if reachable == 0 {
+		return fmt.Errorf("no peers reachable")
+	}
+	return nil
+}
+
+// fetchHeaders requests a peer's block headers starting at the given index.
+// Oversized or malformed responses count against the peer.
+func (n *Node) fetchHeaders(ctx context.Context, peer string, from int64) ([]block.Header, error) {
+	data, err := n.fetchFromPeer(ctx, peer, fmt.Sprintf("/headers?from=%d", from), maxHeadersResponseSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var headers []block.Header
+	if err := json.Unmarshal(data, &headers); err != nil {
+		err = fmt.Errorf("malformed headers: %w", err)
+		n.penalizePeer(peer, err)
+		return nil, err
+	}
+	if len(headers) > maxPeerBlocks {
+		err := fmt.Errorf("%d headers, limit is %d", len(headers), maxPeerBlocks)
+		n.penalizePeer(peer, err)
+		return nil, err
+	}
+	return headers, nil
+}
+
+// fetchChain downloads a peer's full chain and only returns it if it passes
+// full validation under our own consensus rules. Bad chains count against the peer.
+func (n *Node) fetchChain(ctx context.Context, peer string) (*chain.Chain, error) {
+	data, err := n.fetchFromPeer(ctx, peer, "/chain", maxChainResponseSize)
+	if err != nil {
+		return nil, err
+	}
+
+	peerChain, err := chain.Decode(bytes.NewReader(data), maxPeerBlocks)
+	if err != nil {
+		n.recordEvent(EventBlockRejected, map[string]any{"peer": peer, "reason": err.Error()})
+		n.penalizePeer(peer, err)
+		return nil, err
+	}
+
+	// The peer's chain must have been mined under our rules, not ones it chose itself
+	if peerChain.Difficulty != n.Chain.Difficulty || peerChain.MiningReward != n.Chain.MiningReward {
+		err := fmt.Errorf("consensus mismatch: difficulty %d reward %.2f, want difficulty %d reward %.2f",
+			peerChain.Difficulty, peerChain.MiningReward, n.Chain.Difficulty, n.Chain.MiningReward)
+		n.recordEvent(EventBlockRejected, map[string]any{"peer": peer, "reason": err.Error()})
+		n.penalizePeer(peer, err)
+		return nil, err
+	}
+	if !peerChain.Emission.Equal(n.Chain.Emission) {
+		err := fmt.Errorf("consensus mismatch: peer's chain follows a different emission schedule")
+		n.recordEvent(EventBlockRejected, map[string]any{"peer": peer, "reason": err.Error()})
+		n.penalizePeer(peer, err)
+		return nil, err
+	}
+	if peerChain.Accounting != n.Chain.Accounting {
+		err := fmt.Errorf("consensus mismatch: peer's chain keeps accounts differently")
+		n.recordEvent(EventBlockRejected, map[string]any{"peer": peer, "reason": err.Error()})
+		n.penalizePeer(peer, err)
+		return nil, err
+	}
+	genesis, _ := n.Chain.BlockByHeight(0)
+	if peerGenesis, _ := peerChain.BlockByHeight(0); n.fixedGenesis && peerGenesis.Hash != genesis.Hash {
+		err := fmt.Errorf("consensus mismatch: peer's chain starts from genesis block %s, want %s", peerGenesis.Hash, genesis.Hash)
+		n.recordEvent(EventBlockRejected, map[string]any{"peer": peer, "reason": err.Error()})
+		n.penalizePeer(peer, err)
+		return nil, err
+	}
+	return peerChain, nil
+}
+
+// fetchFromPeer GETs a path from a peer, reading at most limit bytes. Exceeding the limit counts against the peer; network errors don't.
+func (n *Node) fetchFromPeer(ctx context.Context, peer, path string, limit int64) ([]byte, error) {
+	return n.requestPeer(ctx, peer, http.MethodGet, path, nil, limit)
+}
+
+// postToPeer POSTs a JSON body to a peer with the same limits as fetchFromPeer
+func (n *Node) postToPeer(ctx context.Context, peer, path string, v any, limit int64) ([]byte, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return n.requestPeer(ctx, peer, http.MethodPost, path, body, limit)
+}
+
+// jitter randomises a duration by up to ±20%
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	spread := int64(d) / 5
+	if spread == 0 {
+		return d
+	}
+	return d + time.Duration(rand.Int64N(2*spread)-spread)
+}
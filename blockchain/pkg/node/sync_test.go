@@ -0,0 +1,288 @@
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+// peerServer starts a fake peer that serves body for /chain
+func peerServer(t *testing.T, body func(w http.ResponseWriter)) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/chain" {
+			http.NotFound(w, r)
+			return
+		}
+		body(w)
+	}))
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+func TestSyncAdoptsLongerValidChain(t *testing.T) {
+	source, _ := New("localhost:9000", 1, 10.0)
+	source.Chain.AddBlock(nil, source.Wallet.Address())
+	source.Chain.AddBlock(nil, source.Wallet.Address())
+
+	peer := peerServer(t, func(w http.ResponseWriter) {
+		json.NewEncoder(w).Encode(source.Chain)
+	})
+
+	n, _ := New("localhost:9001", 1, 10.0)
+	n.AddPeer(peer)
+	if err := n.SyncWithPeers(t.Context()); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if n.Chain.Length() != 3 {
+		t.Errorf("expected to adopt the 3-block chain, got %d blocks", n.Chain.Length())
+	}
+}
+
+func TestSyncRejectsEasierChain(t *testing.T) {
+	// A peer mining at difficulty 0 could produce a long chain for free
+	cheap, _ := New("localhost:9000", 0, 10.0)
+	for i := 0; i < 5; i++ {
+		cheap.Chain.AddBlock(nil, cheap.Wallet.Address())
+	}
+	peer := peerServer(t, func(w http.ResponseWriter) {
+		json.NewEncoder(w).Encode(cheap.Chain)
+	})
+
+	n, _ := New("localhost:9001", 1, 10.0)
+	n.AddPeer(peer)
+	n.SyncWithPeers(t.Context())
+
+	if n.Chain.Length() != 1 {
+		t.Errorf("chain mined under different rules should be rejected")
+	}
+	if n.penalties.strikes[peer] != 1 {
+		t.Errorf("expected peer to be penalized once, got %d strikes", n.penalties.strikes[peer])
+	}
+}
+
+func TestSyncRejectsOtherAccounting(t *testing.T) {
+	// A longer chain mustn't switch the node between balances and UTXO
+	source, _ := New("localhost:9000", 1, 10.0)
+	if err := source.Chain.SetAccounting(chain.AccountingUTXO); err != nil {
+		t.Fatal(err)
+	}
+	source.Chain.AddBlock(nil, source.Wallet.Address())
+	source.Chain.AddBlock(nil, source.Wallet.Address())
+	peer := peerServer(t, func(w http.ResponseWriter) {
+		json.NewEncoder(w).Encode(source.Chain)
+	})
+
+	n, _ := New("localhost:9001", 1, 10.0)
+	n.AddPeer(peer)
+	n.SyncWithPeers(t.Context())
+	if n.Chain.Length() != 1 || n.Chain.Accounting != chain.AccountingBalances {
+		t.Errorf("expected the UTXO chain rejected, got %d blocks with accounting %q", n.Chain.Length(), n.Chain.Accounting)
+	}
+	if n.penalties.strikes[peer] != 1 {
+		t.Errorf("expected peer to be penalized once, got %d strikes", n.penalties.strikes[peer])
+	}
+}
+
+func TestSyncRejectsForgedTransfer(t *testing.T) {
+	victim, _ := New("localhost:9002", 1, 10.0)
+	thief, _ := wallet.New()
+
+	tests := []struct {
+		name  string
+		forge func(tx *transaction.Transaction)
+	}{
+		// Signed by the thief, claiming to carry the victim's key
+		{"wrong signature", func(tx *transaction.Transaction) {
+			tx.Sign(thief.PrivateKey)
+			signed := transaction.New(victim.Wallet.Address(), thief.Address(), 0)
+			signed.Sign(victim.Wallet.PrivateKey)
+			tx.PublicKey = signed.PublicKey
+		}},
+		// Carrying no key at all, so nobody could check it
+		{"no key", func(tx *transaction.Transaction) {
+			tx.Sign(thief.PrivateKey)
+			tx.PublicKey = nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, _ := New("localhost:9001", 1, 10.0)
+			source, _ := New("localhost:9000", 1, 10.0)
+			source.Chain.ReplaceWith(n.Chain)
+			source.Chain.AddBlock(nil, victim.Wallet.Address())
+
+			// Mined by hand, since the source's own chain would refuse it
+			forged := transaction.New(victim.Wallet.Address(), thief.Address(), 10.0)
+			tt.forge(forged)
+			tip := source.Chain.GetLatestBlock()
+			coinbase := transaction.New("COINBASE", thief.Address(), 10.0)
+			coinbase.ID = coinbase.Hash()
+			b := block.New(tip.Index+1, []*transaction.Transaction{coinbase, forged}, tip.Hash)
+			b.Mine(1)
+			source.Chain.Blocks = append(source.Chain.Blocks, b)
+
+			peer := peerServer(t, func(w http.ResponseWriter) {
+				json.NewEncoder(w).Encode(source.Chain)
+			})
+			n.AddPeer(peer)
+			n.SyncWithPeers(t.Context())
+			if n.Chain.Length() != 1 || n.Chain.GetBalance(thief.Address()) != 0 {
+				t.Errorf("expected the forged chain rejected, got %d blocks", n.Chain.Length())
+			}
+			if n.penalties.strikes[peer] != 1 {
+				t.Errorf("expected peer to be penalized once, got %d strikes", n.penalties.strikes[peer])
+			}
+
+			// Nor is the block taken on its own
+			data, _ := json.Marshal(source.Chain.Blocks[1])
+			if err := n.ReceiveBlock(data); err != nil {
+				t.Fatalf("block 1 refused: %v", err)
+			}
+			data, _ = json.Marshal(b)
+			if err := n.ReceiveBlock(data); err == nil || n.Chain.Length() != 2 {
+				t.Errorf("expected the forged block refused, got %v with %d blocks", err, n.Chain.Length())
+			}
+		})
+	}
+}
+
+func TestSyncBansMisbehavingPeer(t *testing.T) {
+	requests := 0
+	peer := peerServer(t, func(w http.ResponseWriter) {
+		requests++
+		w.Write([]byte(`{"blocks":[null]}`))
+	})
+
+	n, _ := New("localhost:9001", 1, 10.0)
+	n.AddPeer(peer)
+	for i := 0; i < maxPeerStrikes+2; i++ {
+		n.SyncWithPeers(t.Context())
+	}
+
+	if !n.penalties.IsBanned(peer) {
+		t.Errorf("peer should be banned after %d bad responses", maxPeerStrikes)
+	}
+	if requests != maxPeerStrikes {
+		t.Errorf("expected banned peer to stop being contacted after %d requests, got %d", maxPeerStrikes, requests)
+	}
+	if len(n.GetPeers()) != 1 {
+		t.Errorf("banned peers should stay in the peer list so the ban can expire")
+	}
+}
+
+func TestFetchFromPeerSizeLimit(t *testing.T) {
+	peer := peerServer(t, func(w http.ResponseWriter) {
+		w.Write([]byte(strings.Repeat("x", 2048)))
+	})
+
+	n, _ := New("localhost:9001", 1, 10.0)
+	if _, err := n.fetchFromPeer(t.Context(), peer, "/chain", 1024); err == nil {
+		t.Error("expected oversized response to be rejected")
+	}
+	if n.penalties.strikes[peer] != 1 {
+		t.Errorf("oversized response should count against the peer")
+	}
+	if data, err := n.fetchFromPeer(t.Context(), peer, "/chain", 2048); err != nil || len(data) != 2048 {
+		t.Errorf("response at the limit should be accepted, got %d bytes, %v", len(data), err)
+	}
+}
+
+func TestReceiveBlockSwitchesToBranchWithMoreWork(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	rival, _ := New("localhost:9001", 1, 10.0)
+	rival.Chain.ReplaceWith(n.Chain)
+	if err := n.Mine(); err != nil {
+		t.Fatal(err)
+	}
+	ours := n.Chain.GetLatestBlock()
+	rival.Mine()
+	rival.Mine()
+
+	receive := func(height int) {
+		t.Helper()
+		data, _ := json.Marshal(rival.Chain.Blocks[height])
+		if err := n.ReceiveBlock(data); err != nil {
+			t.Fatalf("block %d refused: %v", height, err)
+		}
+	}
+
+	// A block as far along as our tip waits on a side branch
+	receive(1)
+	if n.Chain.GetLatestBlock() != ours {
+		t.Fatal("expected a branch with no more work to leave our tip alone")
+	}
+	if st := n.Status(); st.SideBlocks != 1 || st.ChainWork != "32" {
+		t.Errorf("expected 1 side block and work 32, got %d and %s", st.SideBlocks, st.ChainWork)
+	}
+
+	// The next one gives its branch more work, so the node switches to it
+	receive(2)
+	if n.Chain.GetLatestBlock().Hash != rival.Chain.GetLatestBlock().Hash {
+		t.Fatalf("expected to switch to the rival's branch, tip is at %d", n.Chain.GetLatestBlock().Index)
+	}
+	if n.Chain.GetBalance(n.Wallet.Address()) != 0 {
+		t.Error("expected our rolled back reward to be gone")
+	}
+	var reorgs, accepted int
+	for _, e := range n.Events(0) {
+		switch {
+		case e.Type == EventReorg:
+			reorgs++
+		case e.Type == EventBlockAccepted && e.Fields["source"] == "peer":
+			accepted++
+		}
+	}
+	if reorgs != 1 || accepted != 2 {
+		t.Errorf("expected a reorg and 2 blocks accepted from the peer, got %d and %d", reorgs, accepted)
+	}
+	if st := n.Status(); st.SideBlocks != 1 || st.ChainWork != "48" {
+		t.Errorf("expected our old block on a side branch and work 48, got %d and %s", st.SideBlocks, st.ChainWork)
+	}
+}
+
+func TestReceiveBlockHoldsOrphanUntilParentArrives(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	peer, _ := New("localhost:9001", 1, 10.0)
+	peer.Chain.ReplaceWith(n.Chain)
+	peer.Mine()
+	peer.Mine()
+
+	receive := func(height int) {
+		t.Helper()
+		data, _ := json.Marshal(peer.Chain.Blocks[height])
+		if err := n.ReceiveBlock(data); err != nil {
+			t.Fatalf("block %d refused: %v", height, err)
+		}
+	}
+
+	// Block 2 overtakes block 1 on the way here
+	receive(2)
+	if st := n.Status(); st.Height != 0 || st.OrphanBlocks != 1 {
+		t.Fatalf("expected the block held as an orphan, got height %d and %d orphans", st.Height, st.OrphanBlocks)
+	}
+
+	receive(1)
+	if n.Chain.GetLatestBlock().Hash != peer.Chain.GetLatestBlock().Hash {
+		t.Fatalf("expected the orphan connected behind its parent, tip is at %d", n.Chain.GetLatestBlock().Index)
+	}
+	if st := n.Status(); st.OrphanBlocks != 0 {
+		t.Errorf("expected no orphans left, got %d", st.OrphanBlocks)
+	}
+	accepted := 0
+	for _, e := range n.Events(0) {
+		if e.Type == EventBlockAccepted && e.Fields["source"] == "peer" {
+			accepted++
+		}
+	}
+	if accepted != 2 {
+		t.Errorf("expected both blocks accepted from the peer, got %d", accepted)
+	}
+}
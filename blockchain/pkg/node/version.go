@@ -0,0 +1,67 @@
+package node
+
+import (
+	"runtime"
+	"runtime/debug"
+
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+)
+
+// Build details, set at build time with
+//
+//	go build -ldflags "-X github.com/oksmith/home-server/blockchain/pkg/node.Version=v1.2.0 \
+//	  -X github.com/oksmith/home-server/blockchain/pkg/node.Commit=$(git rev-parse --short HEAD)"
+//
+// Without -ldflags, Commit comes from the version control details go build
+// records when run inside a git checkout.
+var (
+	Version   = "0.1.0"
+	Commit    = ""
+	BuildTime = "" // e.g. $(date -u +%Y-%m-%dT%H:%M:%SZ)
+)
+
+// BuildInfo identifies the software a node or client runs and the versions
+// of the protocol and chain rules it follows
+type BuildInfo struct {
+	Version            string `json:"version"`
+	Commit             string `json:"commit,omitempty"`
+	BuildTime          string `json:"build_time,omitempty"`
+	GoVersion          string `json:"go_version"`
+	ProtocolVersion    int    `json:"protocol_version"`
+	MinProtocolVersion int    `json:"min_protocol_version"`
+	ChainRulesVersion  int    `json:"chain_rules_version"`
+}
+
+// Build returns this binary's build details
+func Build() BuildInfo {
+	info := BuildInfo{
+		Version:            Version,
+		Commit:             Commit,
+		BuildTime:          BuildTime,
+		GoVersion:          runtime.Version(),
+		ProtocolVersion:    ProtocolVersion,
+		MinProtocolVersion: MinProtocolVersion,
+		ChainRulesVersion:  chain.RulesVersion,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		vcs := map[string]string{}
+		for _, s := range bi.Settings {
+			vcs[s.Key] = s.Value
+		}
+		if info.Commit == "" && vcs["vcs.revision"] != "" {
+			info.Commit = shortCommit(vcs["vcs.revision"])
+			if vcs["vcs.modified"] == "true" {
+				info.Commit += "-dirty"
+			}
+		}
+	}
+	return info
+}
+
+// shortCommit cuts a full commit hash down to 12 characters, plenty to find it
+func shortCommit(rev string) string {
+	if len(rev) > 12 {
+		return rev[:12]
+	}
+	return rev
+}
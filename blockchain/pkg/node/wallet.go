@@ -0,0 +1,227 @@
+package node
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/chain"
+	"github.com/oksmith/home-server/blockchain/pkg/qr"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+	"github.com/oksmith/home-server/pkg/httpserver"
+)
+
+// SafeConfirmations is how deep a block must be before GET /wallet/unconfirmed
+// counts its funds as confirmed rather than at risk of a reorg
+const SafeConfirmations = 6
+
+// maxConfirmations caps the confirmations parameter of /wallet/unconfirmed
+const maxConfirmations = 1000
+
+// Pixels per QR code module in GET /wallet?format=png, by default and at most
+const (
+	defaultQRScale = 8
+	maxQRScale     = 32
+)
+
+// Outcomes for wallet transactions rolled back by a reorg
+const (
+	ReorgTxPending = "pending" // returned to the mempool to be mined again
+	ReorgTxDropped = "dropped" // coinbase rewards, and spends no longer covered by the balance
+)
+
+// WalletTx is a confirmed wallet transaction, with how deep its block is
+type WalletTx struct {
+	chain.ConfirmedTx
+}
+
+// WalletFunds splits the node wallet's funds by how settled they are
+type WalletFunds struct {
+	Address         string                     `json:"address"`
+	Confirmations   int                        `json:"confirmations"` // depth needed to count as confirmed
+	Balance         float64                    `json:"balance"`       // confirmed + at_risk
+	Confirmed       float64                    `json:"confirmed"`
+	AtRisk          float64                    `json:"at_risk"` // net change from shallower blocks, undone if they are reorged out
+	PendingIncoming float64                    `json:"pending_incoming"`
+	PendingOutgoing float64                    `json:"pending_outgoing"`
+	AtRiskTxs       []WalletTx                 `json:"at_risk_transactions"` // newest first
+	Pending         []*transaction.Transaction `json:"pending"`
+}
+
+// WalletFunds reports the wallet's balance, treating blocks with fewer than
+// confirmations confirmations as at risk
+func (n *Node) WalletFunds(confirmations int) WalletFunds {
+	address := n.Wallet.Address()
+	funds := WalletFunds{
+		Address:       address,
+		Confirmations: confirmations,
+		Balance:       n.Chain.GetBalance(address),
+		AtRiskTxs:     []WalletTx{},
+		Pending:       []*transaction.Transaction{},
+	}
+
+	for _, confirmed := range n.Chain.AddressHistory(address, math.MaxInt) {
+		if confirmed.Confirmations >= int64(confirmations) {
+			break
+		}
+		funds.AtRisk += netAmount(confirmed.Tx, address)
+		funds.AtRiskTxs = append(funds.AtRiskTxs, WalletTx{ConfirmedTx: confirmed})
+	}
+	funds.Confirmed = funds.Balance - funds.AtRisk
+
+	for _, tx := range n.Mempool.GetAll() {
+		if tx.From != address && tx.To != address {
+			continue
+		}
+		if tx.To == address {
+			funds.PendingIncoming += tx.Amount
+		}
+		if tx.From == address {
+			funds.PendingOutgoing += tx.Total()
+		}
+		funds.Pending = append(funds.Pending, tx)
+	}
+	return funds
+}
+
+// netAmount is how much a transaction changes an address's balance
+func netAmount(tx *transaction.Transaction, address string) float64 {
+	var net float64
+	if tx.To == address {
+		net += tx.Amount
+	}
+	if tx.From == address && !tx.IsCoinbase() {
+		net -= tx.Total()
+	}
+	return net
+}
+
+// WalletInfo is the node wallet's address and balance, with a payment URI
+// asking for coins to be sent to it
+type WalletInfo struct {
+	Address string  `json:"address"`
+	Balance float64 `json:"balance"`
+	URI     string  `json:"uri"`
+}
+
+// handleWallet returns the wallet's address, balance and payment URI. The
+// optional "amount" and "label" parameters go into the URI. With
+// "format=png" the URI is returned as a QR code for a phone to scan, with
+// "scale" pixels per module.
+func (n *Node) handleWallet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	uri := wallet.PaymentURI{Address: n.Wallet.Address(), Label: q.Get("label")}
+	if v := q.Get("amount"); v != "" {
+		amount, err := strconv.ParseFloat(v, 64)
+		if err != nil || amount <= 0 || math.IsInf(amount, 0) {
+			http.Error(w, "amount must be a positive number", http.StatusBadRequest)
+			return
+		}
+		uri.Amount = amount
+	}
+
+	switch q.Get("format") {
+	case "", "json":
+		httpserver.WriteJSON(w, http.StatusOK, WalletInfo{
+			Address: uri.Address,
+			Balance: n.Chain.GetBalance(uri.Address),
+			URI:     uri.String(),
+		})
+	case "png":
+		scale := defaultQRScale
+		if v := q.Get("scale"); v != "" {
+			parsed, err := strconv.Atoi(v)
+			if err != nil || parsed < 1 || parsed > maxQRScale {
+				http.Error(w, fmt.Sprintf("scale must be between 1 and %d", maxQRScale), http.StatusBadRequest)
+				return
+			}
+			scale = parsed
+		}
+		code, err := qr.Encode([]byte(uri.String()), qr.M)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest) // only a label too long to fit
+			return
+		}
+		img, err := code.PNG(scale)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(img)
+	default:
+		http.Error(w, "format must be json or png", http.StatusBadRequest)
+	}
+}
+
+// handleWalletUnconfirmed returns the wallet's confirmed and at-risk funds.
+// The optional "confirmations" parameter overrides SafeConfirmations.
+func (n *Node) handleWalletUnconfirmed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	confirmations := SafeConfirmations
+	if v := r.URL.Query().Get("confirmations"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > maxConfirmations {
+			http.Error(w, fmt.Sprintf("confirmations must be between 1 and %d", maxConfirmations), http.StatusBadRequest)
+			return
+		}
+		confirmations = parsed
+	}
+
+	httpserver.WriteJSON(w, http.StatusOK, n.WalletFunds(confirmations))
+}
+
+// recoverOrphans handles the transactions in blocks a reorg rolled back.
+// Those the new chain doesn't include go back in the mempool if the sender can
+// still afford them; the rest are gone. Wallet transactions are recorded as
+// events and watchers are told either way.
+func (n *Node) recoverOrphans(dropped []*block.Block) {
+	address := n.Wallet.Address()
+	spending := make(map[string]float64)
+	for _, tx := range n.Mempool.GetAll() {
+		spending[tx.From] += tx.Total()
+	}
+
+	for _, b := range dropped {
+		for _, tx := range b.Transactions {
+			if _, ok := n.Chain.Transaction(tx.ID); ok {
+				continue
+			}
+
+			outcome := ReorgTxDropped
+			if _, ok := n.Mempool.Get(tx.ID); ok {
+				outcome = ReorgTxPending
+			} else if !tx.IsCoinbase() && n.Chain.GetBalance(tx.From)-spending[tx.From] >= tx.Total() {
+				if err := n.Mempool.Add(tx); err == nil {
+					spending[tx.From] += tx.Total()
+					outcome = ReorgTxPending
+				}
+			}
+
+			n.notifyReorg(tx, b, outcome)
+			if tx.From != address && tx.To != address {
+				continue
+			}
+			n.logger.Warn("wallet transaction rolled back by reorg", "txid", tx.ID, "height", b.Index, "outcome", outcome)
+			n.recordEvent(EventWalletReorg, map[string]any{
+				"txid":    tx.ID,
+				"height":  b.Index,
+				"amount":  netAmount(tx, address),
+				"outcome": outcome,
+			})
+		}
+	}
+}
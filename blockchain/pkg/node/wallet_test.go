@@ -0,0 +1,131 @@
+package node
+
+import (
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+)
+
+func TestReorgReturnsWalletTransactions(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	if err := n.Mine(); err != nil {
+		t.Fatalf("failed to mine: %v", err)
+	}
+
+	// A rival starts from the shared first block
+	rival, _ := New("localhost:9001", 1, 10.0)
+	rival.Chain.ReplaceWith(n.Chain)
+
+	// Our next block spends 5 of the first reward
+	tx := transaction.New(n.Wallet.Address(), "bob", 5.0)
+	tx.Sign(n.Wallet.PrivateKey)
+	if err := n.ReceiveTransaction(tx); err != nil {
+		t.Fatalf("failed to submit transaction: %v", err)
+	}
+	if err := n.Mine(); err != nil {
+		t.Fatalf("failed to mine: %v", err)
+	}
+	lostReward := n.Chain.GetLatestBlock().Transactions[0]
+
+	// The rival's longer branch replaces it
+	rival.Mine()
+	rival.Mine()
+	n.adoptChain(rival.Chain)
+
+	if _, ok := n.Mempool.Get(tx.ID); !ok {
+		t.Errorf("rolled back spend should be back in the mempool")
+	}
+
+	outcomes := make(map[string]string)
+	for _, e := range n.Events(0) {
+		if e.Type == EventWalletReorg {
+			outcomes[e.Fields["txid"].(string)] = e.Fields["outcome"].(string)
+		}
+	}
+	if outcomes[tx.ID] != ReorgTxPending || outcomes[lostReward.ID] != ReorgTxDropped {
+		t.Errorf("expected the spend pending and the reward dropped, got %v", outcomes)
+	}
+
+	// Only the first block's reward is left, two blocks deep
+	var funds WalletFunds
+	if status := getJSON(t, n.Handler(), APIPrefix+"/wallet/unconfirmed", &funds); status != http.StatusOK {
+		t.Fatalf("expected 200, got %d", status)
+	}
+	if funds.Balance != 10 || funds.AtRisk != 10 || funds.Confirmed != 0 || funds.PendingOutgoing != 5 {
+		t.Errorf("unexpected funds %+v", funds)
+	}
+	if len(funds.AtRiskTxs) != 1 || funds.AtRiskTxs[0].Confirmations != 3 {
+		t.Errorf("expected one at-risk transaction with 3 confirmations, got %+v", funds.AtRiskTxs)
+	}
+
+	getJSON(t, n.Handler(), APIPrefix+"/wallet/unconfirmed?confirmations=3", &funds)
+	if funds.Confirmed != 10 || funds.AtRisk != 0 {
+		t.Errorf("expected all funds confirmed at depth 3, got %+v", funds)
+	}
+}
+
+func TestReorgClearsConfirmedFromMempool(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	n.Mine()
+	rival, _ := New("localhost:9001", 1, 10.0)
+	rival.Chain.ReplaceWith(n.Chain)
+	rival.Chain.RegisterPublicKey(n.Wallet.Address(), n.Wallet.PublicKey)
+
+	// Both nodes see the transaction, but only the rival mines it
+	tx := transaction.New(n.Wallet.Address(), "bob", 5.0)
+	tx.Sign(n.Wallet.PrivateKey)
+	n.ReceiveTransaction(tx)
+	rival.ReceiveTransaction(tx)
+	if err := rival.Mine(); err != nil {
+		t.Fatalf("failed to mine: %v", err)
+	}
+
+	n.adoptChain(rival.Chain)
+	if n.Mempool.Size() != 0 {
+		t.Errorf("transaction confirmed by the adopted chain should leave the mempool")
+	}
+}
+
+func TestWalletUnconfirmedInvalidConfirmations(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	if status := getJSON(t, n.Handler(), APIPrefix+"/wallet/unconfirmed?confirmations=0", nil); status != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", status)
+	}
+}
+
+func TestWalletInfo(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+	n.Mine()
+
+	var info WalletInfo
+	if status := getJSON(t, n.Handler(), APIPrefix+"/wallet?amount=2.5&label=Tips", &info); status != http.StatusOK {
+		t.Fatalf("expected 200, got %d", status)
+	}
+	want := "homechain:" + n.Wallet.Address() + "?amount=2.5&label=Tips"
+	if info.Address != n.Wallet.Address() || info.Balance != 10 || info.URI != want {
+		t.Errorf("unexpected wallet info %+v", info)
+	}
+
+	rec := httptest.NewRecorder()
+	n.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, APIPrefix+"/wallet?format=png&scale=2", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("expected a PNG, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	img, err := png.Decode(rec.Body)
+	if err != nil {
+		t.Fatalf("failed to decode PNG: %v", err)
+	}
+	// The 74-character URI needs a version 5 code: 37 modules and a 4-module quiet zone each side
+	if side := img.Bounds().Dx(); side != (37+8)*2 {
+		t.Errorf("expected a %d pixel image, got %d", (37+8)*2, side)
+	}
+
+	for _, query := range []string{"amount=0", "amount=x", "format=gif", "format=png&scale=100"} {
+		if status := getJSON(t, n.Handler(), APIPrefix+"/wallet?"+query, nil); status != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, status)
+		}
+	}
+}
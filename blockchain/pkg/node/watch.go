@@ -0,0 +1,215 @@
+package node
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/block"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/pkg/httpserver"
+)
+
+// Watch events sent to webhooks
+const (
+	WatchEventMempool = "mempool" // a transaction touching the address entered the mempool
+	WatchEventBlock   = "block"   // a transaction touching the address was included in a block
+	WatchEventReorg   = "reorg"   // a block with a transaction touching the address was rolled back
+)
+
+// Watch registers a webhook that is called whenever an address appears in a transaction
+type Watch struct {
+	ID          string    `json:"id"`
+	Address     string    `json:"address"`
+	CallbackURL string    `json:"callback_url"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// WatchEvent is the JSON body POSTed to a watch's callback URL
+type WatchEvent struct {
+	WatchID     string                   `json:"watch_id"`
+	Event       string                   `json:"event"`
+	Address     string                   `json:"address"`
+	Transaction *transaction.Transaction `json:"transaction"`
+	BlockHeight int64                    `json:"block_height,omitempty"`
+	BlockHash   string                   `json:"block_hash,omitempty"`
+	Outcome     string                   `json:"outcome,omitempty"` // for reorg events: "pending" or "dropped"
+}
+
+// AddWatch registers a webhook for an address
+func (n *Node) AddWatch(address, callbackURL string) (Watch, error) {
+	if address == "" {
+		return Watch{}, fmt.Errorf("address is required")
+	}
+	u, err := url.Parse(callbackURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Watch{}, fmt.Errorf("callback_url must be an absolute http(s) URL")
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Watch{}, err
+	}
+	w := Watch{
+		ID:          hex.EncodeToString(id),
+		Address:     address,
+		CallbackURL: callbackURL,
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	n.watchesMutex.Lock()
+	n.watches[w.ID] = w
+	n.watchesMutex.Unlock()
+
+	n.logger.Info("added watch", "watch", w.ID, "address", address)
+	n.persistWatches()
+	return w, nil
+}
+
+// RemoveWatch deletes a watch, reporting whether it existed
+func (n *Node) RemoveWatch(id string) bool {
+	n.watchesMutex.Lock()
+	_, exists := n.watches[id]
+	delete(n.watches, id)
+	n.watchesMutex.Unlock()
+
+	if exists {
+		n.persistWatches()
+	}
+	return exists
+}
+
+// GetWatches returns all registered watches, oldest first
+func (n *Node) GetWatches() []Watch {
+	n.watchesMutex.RLock()
+	defer n.watchesMutex.RUnlock()
+
+	watches := make([]Watch, 0, len(n.watches))
+	for _, w := range n.watches {
+		watches = append(watches, w)
+	}
+	sort.Slice(watches, func(i, j int) bool {
+		return watches[i].CreatedAt.Before(watches[j].CreatedAt)
+	})
+	return watches
+}
+
+// notifyBlock fires watch webhooks for every transaction in a newly connected
+// block, then checks alert rules against it
+func (n *Node) notifyBlock(b *block.Block) {
+	for _, tx := range b.Transactions {
+		n.notifyTransaction(tx, b)
+	}
+	n.checkAlerts(b)
+}
+
+// notifyTransaction fires webhooks for watches on the transaction's sender or
+// recipient. b is the containing block, or nil for a mempool transaction.
+func (n *Node) notifyTransaction(tx *transaction.Transaction, b *block.Block) {
+	n.watchesMutex.RLock()
+	defer n.watchesMutex.RUnlock()
+
+	for _, w := range n.watches {
+		if w.Address != tx.From && w.Address != tx.To {
+			continue
+		}
+
+		event := WatchEvent{
+			WatchID:     w.ID,
+			Event:       WatchEventMempool,
+			Address:     w.Address,
+			Transaction: tx,
+		}
+		if b != nil {
+			event.Event = WatchEventBlock
+			event.BlockHeight = b.Index
+			event.BlockHash = b.Hash
+		}
+		go n.postWatchEvent(w.CallbackURL, event)
+	}
+}
+
+// notifyReorg fires webhooks for watches on a transaction whose block b was
+// rolled back, saying whether it went back to the mempool
+func (n *Node) notifyReorg(tx *transaction.Transaction, b *block.Block, outcome string) {
+	n.watchesMutex.RLock()
+	defer n.watchesMutex.RUnlock()
+
+	for _, w := range n.watches {
+		if w.Address != tx.From && w.Address != tx.To {
+			continue
+		}
+		go n.postWatchEvent(w.CallbackURL, WatchEvent{
+			WatchID:     w.ID,
+			Event:       WatchEventReorg,
+			Address:     w.Address,
+			Transaction: tx,
+			BlockHeight: b.Index,
+			BlockHash:   b.Hash,
+			Outcome:     outcome,
+		})
+	}
+}
+
+// postWatchEvent delivers a watch event to its webhook
+func (n *Node) postWatchEvent(callbackURL string, event WatchEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		n.logger.Error("failed to encode watch event", "watch", event.WatchID, "err", err)
+		return
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post(callbackURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		n.logger.Warn("watch webhook failed", "watch", event.WatchID, "txid", event.Transaction.ID, "err", err)
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		n.logger.Warn("watch webhook rejected event",
+			"watch", event.WatchID, "txid", event.Transaction.ID, "status", resp.StatusCode)
+	}
+}
+
+// handleWatch lists (GET), adds (POST {address, callback_url}) or removes
+// (DELETE ?id=) address watches
+func (n *Node) handleWatch(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		httpserver.WriteJSON(w, http.StatusOK, n.GetWatches())
+
+	case http.MethodPost:
+		var req struct {
+			Address     string `json:"address"`
+			CallbackURL string `json:"callback_url"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		watch, err := n.AddWatch(req.Address, req.CallbackURL)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		httpserver.WriteJSON(w, http.StatusCreated, watch)
+
+	case http.MethodDelete:
+		if !n.RemoveWatch(r.URL.Query().Get("id")) {
+			http.Error(w, "watch not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,88 @@
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+func TestWatchWebhooks(t *testing.T) {
+	events := make(chan WatchEvent, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event WatchEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+	}))
+	defer hook.Close()
+
+	n, err := New("localhost:9000", 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	watch, err := n.AddWatch(n.Wallet.Address(), hook.URL)
+	if err != nil {
+		t.Fatalf("failed to add watch: %v", err)
+	}
+
+	// A pending payment to the watched address
+	sender, _ := wallet.New()
+	tx := transaction.New(sender.Address(), n.Wallet.Address(), 1.0)
+	tx.Sign(sender.PrivateKey)
+	if err := n.ReceiveTransaction(tx); err != nil {
+		t.Fatalf("failed to receive transaction: %v", err)
+	}
+
+	event := waitForEvent(t, events)
+	if event.Event != WatchEventMempool || event.WatchID != watch.ID || event.Transaction.ID != tx.ID {
+		t.Errorf("unexpected mempool event: %+v", event)
+	}
+
+	// Mining pays the watched address a reward (the unfunded payment is dropped)
+	n.Mempool.Clear()
+	if err := n.Mine(); err != nil {
+		t.Fatalf("failed to mine: %v", err)
+	}
+
+	event = waitForEvent(t, events)
+	if event.Event != WatchEventBlock || event.BlockHeight != 1 || !event.Transaction.IsCoinbase() {
+		t.Errorf("unexpected block event: %+v", event)
+	}
+}
+
+func TestAddWatchValidation(t *testing.T) {
+	n, _ := New("localhost:9000", 1, 10.0)
+
+	if _, err := n.AddWatch("", "http://phone.lan/hook"); err == nil {
+		t.Error("expected error for missing address")
+	}
+	if _, err := n.AddWatch("abc", "ftp://phone.lan/hook"); err == nil {
+		t.Error("expected error for non-http callback")
+	}
+
+	w, err := n.AddWatch("abc", "http://phone.lan/hook")
+	if err != nil {
+		t.Fatalf("failed to add watch: %v", err)
+	}
+	if len(n.GetWatches()) != 1 {
+		t.Errorf("expected 1 watch, got %d", len(n.GetWatches()))
+	}
+	if !n.RemoveWatch(w.ID) || n.RemoveWatch(w.ID) {
+		t.Error("expected watch to be removed exactly once")
+	}
+}
+
+func waitForEvent(t *testing.T, events <-chan WatchEvent) WatchEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for webhook")
+		return WatchEvent{}
+	}
+}
@@ -0,0 +1,411 @@
+// Package qr encodes data as QR codes (ISO/IEC 18004) for addresses, payment
+// URIs and paper wallets, and draws them as images, SVG or terminal text.
+// Data is always encoded in byte mode, which any scanner reads back exactly.
+package qr
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Level is an error correction level: the higher, the more of the code can
+// be damaged or covered and still scan, at the cost of a bigger code
+type Level int
+
+// Error correction levels, recovering about 7%, 15%, 25% and 30% damage
+const (
+	L Level = iota
+	M
+	Q
+	H
+)
+
+// String returns the level's letter
+func (l Level) String() string {
+	if l < L || l > H {
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+	return "LMQH"[l : l+1]
+}
+
+// Version limits
+const (
+	minVersion = 1
+	maxVersion = 40
+)
+
+// ErrTooLong is returned for data that doesn't fit in the largest QR code
+var ErrTooLong = errors.New("qr: data too long")
+
+// Code is an encoded QR code: a square of dark and light modules, without
+// the quiet zone around it
+type Code struct {
+	Size    int // modules per side, 21 to 177
+	Version int
+	Level   Level
+
+	modules    [][]bool // dark modules, indexed [y][x]
+	isFunction [][]bool // finder, timing, alignment, format and version modules
+}
+
+// Dark reports whether the module at x, y is dark. Modules outside the code
+// are light, like the quiet zone.
+func (c *Code) Dark(x, y int) bool {
+	return x >= 0 && y >= 0 && x < c.Size && y < c.Size && c.modules[y][x]
+}
+
+// Encode encodes data in the smallest QR code that holds it at level
+func Encode(data []byte, level Level) (*Code, error) {
+	if level < L || level > H {
+		return nil, fmt.Errorf("qr: invalid level %d", int(level))
+	}
+	version := 0
+	for v := minVersion; v <= maxVersion; v++ {
+		if 4+charCountBits(v)+8*len(data) <= numDataCodewords(v, level)*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("%w: %d bytes (at most %d at level %s)", ErrTooLong, len(data), maxBytes(level), level)
+	}
+
+	// Byte mode indicator, length, data, then terminator and padding
+	var bits bitBuffer
+	bits.append(0b0100, 4)
+	bits.append(len(data), charCountBits(version))
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	capacity := numDataCodewords(version, level) * 8
+	bits.append(0, min(4, capacity-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	c := &Code{Size: version*4 + 17, Version: version, Level: level}
+	c.modules = newGrid(c.Size)
+	c.isFunction = newGrid(c.Size)
+	c.drawFunctionPatterns()
+	c.drawCodewords(c.addECCAndInterleave(bits.bytes()))
+
+	// Keep the mask that leaves the fewest scanner-confusing patterns
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		if p := c.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		c.applyMask(mask) // masks undo themselves
+	}
+	c.applyMask(best)
+	c.drawFormatBits(best)
+	return c, nil
+}
+
+// maxBytes is the most data a QR code holds at level
+func maxBytes(level Level) int {
+	return (numDataCodewords(maxVersion, level)*8 - 4 - charCountBits(maxVersion)) / 8
+}
+
+// charCountBits is the width of the byte mode length field
+func charCountBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// newGrid makes a size by size grid of light modules
+func newGrid(size int) [][]bool {
+	grid := make([][]bool, size)
+	for i := range grid {
+		grid[i] = make([]bool, size)
+	}
+	return grid
+}
+
+// setFunction sets a function module, which masks and data leave alone
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.isFunction[y][x] = true
+}
+
+// drawFunctionPatterns draws the finder, timing and alignment patterns and
+// reserves the format and version areas
+func (c *Code) drawFunctionPatterns() {
+	for i := 0; i < c.Size; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	c.drawFinder(3, 3)
+	c.drawFinder(c.Size-4, 3)
+	c.drawFinder(3, c.Size-4)
+
+	align := alignmentPositions(c.Version)
+	n := len(align)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			// Except where the finders are
+			if i == 0 && j == 0 || i == 0 && j == n-1 || i == n-1 && j == 0 {
+				continue
+			}
+			c.drawAlignment(align[i], align[j])
+		}
+	}
+
+	c.drawFormatBits(0)
+	c.drawVersion()
+}
+
+// drawFinder draws a finder pattern and its light separator centred on x, y
+func (c *Code) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || yy < 0 || xx >= c.Size || yy >= c.Size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			c.setFunction(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+// drawAlignment draws an alignment pattern centred on x, y
+func (c *Code) drawAlignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// alignmentPositions returns the centres of a version's alignment patterns
+// along each axis
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	numAlign := version/7 + 2
+	step := (version*8 + numAlign*3 + 5) / (numAlign*4 - 4) * 2
+	positions := make([]int, numAlign)
+	positions[0] = 6
+	for i, pos := numAlign-1, version*4+10; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+// formatLevelBits are each level's bits in the format information
+var formatLevelBits = [...]int{L: 1, M: 0, Q: 3, H: 2}
+
+// drawFormatBits draws both copies of the level and mask, protected by a
+// BCH code
+func (c *Code) drawFormatBits(mask int) {
+	data := formatLevelBits[c.Level]<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+
+	// Around the top left finder
+	for i := 0; i <= 5; i++ {
+		c.setFunction(8, i, bit(bits, i))
+	}
+	c.setFunction(8, 7, bit(bits, 6))
+	c.setFunction(8, 8, bit(bits, 7))
+	c.setFunction(7, 8, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(bits, i))
+	}
+
+	// Split between the other two
+	for i := 0; i < 8; i++ {
+		c.setFunction(c.Size-1-i, 8, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.Size-15+i, bit(bits, i))
+	}
+	c.setFunction(8, c.Size-8, true)
+}
+
+// drawVersion draws both copies of the version, from version 7 up
+func (c *Code) drawVersion() {
+	if c.Version < 7 {
+		return
+	}
+	rem := c.Version
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	bits := c.Version<<12 | rem
+	for i := 0; i < 18; i++ {
+		a, b := c.Size-11+i%3, i/3
+		c.setFunction(a, b, bit(bits, i))
+		c.setFunction(b, a, bit(bits, i))
+	}
+}
+
+// drawCodewords fills the data area in the zigzag order scanners read it
+func (c *Code) drawCodewords(data []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // skip the vertical timing pattern
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if upward {
+					y = c.Size - 1 - vert
+				}
+				if !c.isFunction[y][x] && i < len(data)*8 {
+					c.modules[y][x] = bit(int(data[i>>3]), 7-i&7)
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask flips the data modules the mask selects
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			var flip bool
+			switch mask {
+			case 0:
+				flip = (x+y)%2 == 0
+			case 1:
+				flip = y%2 == 0
+			case 2:
+				flip = x%3 == 0
+			case 3:
+				flip = (x+y)%3 == 0
+			case 4:
+				flip = (x/3+y/2)%2 == 0
+			case 5:
+				flip = x*y%2+x*y%3 == 0
+			case 6:
+				flip = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				flip = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if flip && !c.isFunction[y][x] {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores how hard the code is to scan: long runs, solid blocks,
+// finder-like patterns and an uneven dark/light balance all cost
+func (c *Code) penalty() int {
+	total := 0
+	dark := 0
+	for i := 0; i < c.Size; i++ {
+		rowRun, colRun := 1, 1
+		for j := 0; j < c.Size; j++ {
+			if c.modules[i][j] {
+				dark++
+			}
+			if j > 0 {
+				rowRun, total = runPenalty(c.modules[i][j] == c.modules[i][j-1], rowRun, total)
+				colRun, total = runPenalty(c.modules[j][i] == c.modules[j-1][i], colRun, total)
+			}
+			if i > 0 && j > 0 {
+				m := c.modules[i][j]
+				if m == c.modules[i-1][j] && m == c.modules[i][j-1] && m == c.modules[i-1][j-1] {
+					total += 3
+				}
+			}
+		}
+		total += finderLikePenalty(func(j int) bool { return c.Dark(j, i) }, c.Size)
+		total += finderLikePenalty(func(j int) bool { return c.Dark(i, j) }, c.Size)
+	}
+
+	cells := c.Size * c.Size
+	k := (abs(dark*20-cells*10)+cells-1)/cells - 1
+	return total + k*10
+}
+
+// runPenalty extends or ends a run of same-coloured modules, charging for
+// each module past the fifth
+func runPenalty(same bool, run, total int) (int, int) {
+	if !same {
+		return 1, total
+	}
+	run++
+	if run == 5 {
+		total += 3
+	} else if run > 5 {
+		total++
+	}
+	return run, total
+}
+
+// finderPatterns are dark:light 1:1:3:1:1 with four light modules on one side
+var finderPatterns = [2][11]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+// finderLikePenalty charges for each finder-like pattern in a line, treating
+// the quiet zone as light
+func finderLikePenalty(dark func(int) bool, size int) int {
+	total := 0
+	for start := -4; start+11 <= size+4; start++ {
+		for _, pattern := range finderPatterns {
+			match := true
+			for k, want := range pattern {
+				if dark(start+k) != want {
+					match = false
+					break
+				}
+			}
+			if match {
+				total += 40
+			}
+		}
+	}
+	return total
+}
+
+// bit reports whether bit i of x is set
+func bit(x, i int) bool {
+	return x>>i&1 != 0
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// bitBuffer collects bits most significant first
+type bitBuffer []bool
+
+// append adds the low n bits of v
+func (b *bitBuffer) append(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, bit(v, i))
+	}
+}
+
+// bytes packs the bits, whose length is a multiple of 8, into bytes
+func (b bitBuffer) bytes() []byte {
+	out := make([]byte, len(b)/8)
+	for i, set := range b {
+		if set {
+			out[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return out
+}
@@ -0,0 +1,192 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// decode reads a code's data back, checking its format information and
+// every block's error correction on the way
+func decode(t *testing.T, c *Code) []byte {
+	t.Helper()
+
+	// Both copies of the format information must agree
+	var first, second int
+	for i := 0; i <= 5; i++ {
+		first |= b2i(c.Dark(8, i)) << i
+	}
+	first |= b2i(c.Dark(8, 7))<<6 | b2i(c.Dark(8, 8))<<7 | b2i(c.Dark(7, 8))<<8
+	for i := 9; i < 15; i++ {
+		first |= b2i(c.Dark(14-i, 8)) << i
+	}
+	for i := 0; i < 8; i++ {
+		second |= b2i(c.Dark(c.Size-1-i, 8)) << i
+	}
+	for i := 8; i < 15; i++ {
+		second |= b2i(c.Dark(8, c.Size-15+i)) << i
+	}
+	if first != second {
+		t.Fatalf("format copies differ: %015b and %015b", first, second)
+	}
+	format := (first ^ 0x5412) >> 10
+	if format>>3 != formatLevelBits[c.Level] {
+		t.Fatalf("format level bits %02b, want level %s", format>>3, c.Level)
+	}
+
+	// Unmask and read the codewords in placement order
+	r := &Code{Size: c.Size, Version: c.Version, Level: c.Level, modules: newGrid(c.Size), isFunction: newGrid(c.Size)}
+	r.drawFunctionPatterns()
+	for y := range c.modules {
+		copy(r.modules[y], c.modules[y])
+	}
+	r.applyMask(format & 7)
+	var bits bitBuffer
+	for right := r.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < r.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = r.Size - 1 - vert
+				}
+				if !r.isFunction[y][x] {
+					bits = append(bits, r.modules[y][x])
+				}
+			}
+		}
+	}
+	raw := numRawDataModules(r.Version) / 8
+	codewords := bits[:raw*8].bytes()
+
+	// Undo the interleaving and check each block
+	numBlocks := numErrorCorrectionBlocks[r.Level][r.Version]
+	eccLen := eccCodewordsPerBlock[r.Level][r.Version]
+	numShort := numBlocks - raw%numBlocks
+	shortLen := raw / numBlocks
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := 0; i <= shortLen; i++ {
+		for j := range blocks {
+			if i == shortLen-eccLen && j < numShort {
+				continue
+			}
+			blocks[j] = append(blocks[j], codewords[k])
+			k++
+		}
+	}
+	var data bitBuffer
+	for i, block := range blocks {
+		n := len(block) - eccLen
+		if !bytes.Equal(rsRemainder(block[:n], rsDivisor(eccLen)), block[n:]) {
+			t.Fatalf("block %d fails its error correction", i)
+		}
+		for _, b := range block[:n] {
+			data.append(int(b), 8)
+		}
+	}
+
+	read := func(n int) int {
+		v := 0
+		for _, set := range data[:n] {
+			v = v<<1 | b2i(set)
+		}
+		data = data[n:]
+		return v
+	}
+	if mode := read(4); mode != 0b0100 {
+		t.Fatalf("mode %04b, want byte mode", mode)
+	}
+	out := make([]byte, read(charCountBits(r.Version)))
+	for i := range out {
+		out[i] = byte(read(8))
+	}
+	return out
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	for _, level := range []Level{L, M, Q, H} {
+		for _, n := range []int{0, 1, 17, 64, 150, 450, 1000, 1273} {
+			data := []byte(strings.Repeat("homechain:9f2c?amount=1.5&", n/26+1)[:n])
+			c, err := Encode(data, level)
+			if err != nil {
+				t.Fatalf("Encode(%d bytes, %s): %v", n, level, err)
+			}
+			if c.Size != c.Version*4+17 {
+				t.Errorf("size %d for version %d", c.Size, c.Version)
+			}
+			if got := decode(t, c); !bytes.Equal(got, data) {
+				t.Errorf("%d bytes at %s (version %d) decoded to %q", n, level, c.Version, got)
+			}
+		}
+	}
+}
+
+func TestEncodeVersion(t *testing.T) {
+	tests := []struct {
+		n       int
+		level   Level
+		version int
+	}{
+		{17, L, 1},
+		{18, L, 2},
+		{14, M, 1},
+		{53, L, 3},
+		{54, L, 4},
+		{2953, L, 40},
+		{1273, H, 40},
+	}
+	for _, tt := range tests {
+		c, err := Encode(make([]byte, tt.n), tt.level)
+		if err != nil {
+			t.Fatalf("Encode(%d bytes, %s): %v", tt.n, tt.level, err)
+		}
+		if c.Version != tt.version {
+			t.Errorf("Encode(%d bytes, %s) is version %d, want %d", tt.n, tt.level, c.Version, tt.version)
+		}
+	}
+
+	if _, err := Encode(make([]byte, 2954), L); !errors.Is(err, ErrTooLong) {
+		t.Errorf("Encode(2954 bytes) error = %v, want ErrTooLong", err)
+	}
+	if _, err := Encode(nil, Level(7)); err == nil {
+		t.Error("Encode accepted an invalid level")
+	}
+}
+
+func TestRSRemainder(t *testing.T) {
+	// "HELLO WORLD" at 1-M, from the ISO/IEC 18004 worked example
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := rsRemainder(data, rsDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("rsRemainder = %v, want %v", got, want)
+	}
+}
+
+func TestFinderPatterns(t *testing.T) {
+	c, err := Encode([]byte("finder"), M)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each corner's 7x7 finder: dark ring, light ring, dark 3x3 centre
+	for _, corner := range [][2]int{{0, 0}, {c.Size - 7, 0}, {0, c.Size - 7}} {
+		for dy := 0; dy < 7; dy++ {
+			for dx := 0; dx < 7; dx++ {
+				dist := max(abs(dx-3), abs(dy-3))
+				if want := dist != 2; c.Dark(corner[0]+dx, corner[1]+dy) != want {
+					t.Fatalf("finder at %v: module %d,%d dark = %t", corner, dx, dy, !want)
+				}
+			}
+		}
+	}
+}
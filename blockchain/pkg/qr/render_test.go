@@ -0,0 +1,68 @@
+package qr
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestPNG(t *testing.T) {
+	c, err := Encode([]byte("homechain:9f2c"), M)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := c.PNG(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	side := (c.Size + 2*QuietZone) * 3
+	if b := img.Bounds(); b.Dx() != side || b.Dy() != side {
+		t.Fatalf("image is %v, want %dx%d", b, side, side)
+	}
+	for _, p := range [][2]int{{0, 0}, {QuietZone*3 - 1, QuietZone * 3}} {
+		if r, _, _, _ := img.At(p[0], p[1]).RGBA(); r == 0 {
+			t.Errorf("quiet zone pixel %v is dark", p)
+		}
+	}
+	// The top left finder's corner module
+	if r, _, _, _ := img.At(QuietZone*3, QuietZone*3).RGBA(); r != 0 {
+		t.Error("finder corner pixel is light")
+	}
+}
+
+func TestSVGAndText(t *testing.T) {
+	c, err := Encode([]byte("abc"), L)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svg := c.SVG()
+	if !strings.HasPrefix(svg, "<svg") || !strings.Contains(svg, `viewBox="0 0 29 29"`) {
+		t.Errorf("SVG = %.80s...", svg)
+	}
+	// The first run is the top left finder's top edge
+	if !strings.Contains(svg, `d="M4 4h7v1h-7z`) {
+		t.Errorf("SVG doesn't start with the finder's top edge: %.160s", svg)
+	}
+
+	text := c.Text(false)
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if len(lines) != 15 {
+		t.Errorf("Text has %d lines, want 15", len(lines))
+	}
+	for _, line := range lines {
+		if n := len([]rune(line)); n != 29 {
+			t.Fatalf("Text line is %d wide, want 29: %q", n, line)
+		}
+	}
+	if strings.TrimSpace(lines[0]) != "" {
+		t.Errorf("first line should be quiet zone: %q", lines[0])
+	}
+	if inverted := c.Text(true); inverted == text || !strings.HasPrefix(inverted, "████") {
+		t.Errorf("inverted text should draw the quiet zone as blocks: %.40q", inverted)
+	}
+}
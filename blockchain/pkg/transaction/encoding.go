@@ -0,0 +1,275 @@
+package transaction
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+	"unicode/utf8"
+)
+
+// Versions of the canonical binary encoding, given by its first byte
+const (
+	EncodingVersion        = 1 // without the signer's public key
+	EncodingVersionWithKey = 2 // with the signer's public key after the signature
+	EncodingVersionInputs  = 3 // with the public key, possibly empty, and the outputs spent
+	EncodingVersionFee     = 4 // with the public key and outputs spent, either possibly empty, and the fee
+)
+
+// maxFieldLength caps the length of each variable-length field in the binary encoding
+const maxFieldLength = 512
+
+// ErrMalformed is returned when binary-encoded transaction data isn't canonical
+var ErrMalformed = errors.New("malformed transaction encoding")
+
+// MarshalBinary encodes a signed transaction in its canonical binary form:
+//
+//	version    1 byte (EncodingVersion, EncodingVersionWithKey, EncodingVersionInputs
+//	           or EncodingVersionFee)
+//	from       uvarint length + UTF-8 bytes
+//	to         uvarint length + UTF-8 bytes
+//	amount     8 bytes, big-endian IEEE 754
+//	timestamp  uvarint length + RFC 3339 (nanosecond) text, exactly as signed
+//	signature  64 bytes (r || s)
+//	public key uvarint length + PKIX DER bytes (every version but
+//	           EncodingVersion; empty is allowed from EncodingVersionInputs)
+//	inputs     uvarint count, then for each a 32-byte transaction ID and
+//	           uvarint output index (EncodingVersionInputs, where the count is
+//	           at least 1, and EncodingVersionFee)
+//	fee        8 bytes, big-endian IEEE 754 (EncodingVersionFee only)
+//
+// The ID isn't included; it is recomputed from the other fields when decoding.
+// Transactions carrying their signer's key use EncodingVersionWithKey, those
+// spending outputs EncodingVersionInputs, and those paying a fee
+// EncodingVersionFee.
+func (tx *Transaction) MarshalBinary() ([]byte, error) {
+	if len(tx.Signature) != 64 {
+		return nil, fmt.Errorf("transaction must be signed")
+	}
+
+	version := byte(EncodingVersion)
+	if tx.Fee != 0 {
+		version = EncodingVersionFee
+	} else if len(tx.Inputs) > 0 {
+		version = EncodingVersionInputs
+	} else if len(tx.PublicKey) > 0 {
+		version = EncodingVersionWithKey
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(version)
+	writeField(&buf, tx.From)
+	writeField(&buf, tx.To)
+	binary.Write(&buf, binary.BigEndian, math.Float64bits(tx.Amount))
+	writeField(&buf, tx.Timestamp.Format(time.RFC3339Nano))
+	buf.Write(tx.Signature)
+	if version != EncodingVersion {
+		writeBytes(&buf, tx.PublicKey)
+	}
+	if version == EncodingVersionInputs || version == EncodingVersionFee {
+		if len(tx.Inputs) > MaxInputs {
+			return nil, fmt.Errorf("spends %d outputs, limit is %d", len(tx.Inputs), MaxInputs)
+		}
+		buf.Write(binary.AppendUvarint(nil, uint64(len(tx.Inputs))))
+		for _, in := range tx.Inputs {
+			id, err := hex.DecodeString(in.TxID)
+			if err != nil || !isTxID(in.TxID) || in.Index < 0 {
+				return nil, fmt.Errorf("input %q is not a transaction ID and output index", in)
+			}
+			buf.Write(id)
+			buf.Write(binary.AppendUvarint(nil, uint64(in.Index)))
+		}
+	}
+	if version == EncodingVersionFee {
+		binary.Write(&buf, binary.BigEndian, math.Float64bits(tx.Fee))
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes the canonical binary form strictly: unknown
+// versions, oversized or non-UTF-8 fields, non-finite amounts, fees that
+// aren't positive, timestamps not in canonical RFC 3339 form and trailing
+// bytes are all rejected.
+func (tx *Transaction) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+
+	version, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("%w: empty", ErrMalformed)
+	}
+	if version < EncodingVersion || version > EncodingVersionFee {
+		return fmt.Errorf("%w: unknown version %d", ErrMalformed, version)
+	}
+
+	from, err := readField(r, "from")
+	if err != nil {
+		return err
+	}
+	to, err := readField(r, "to")
+	if err != nil {
+		return err
+	}
+
+	var bits uint64
+	if err := binary.Read(r, binary.BigEndian, &bits); err != nil {
+		return fmt.Errorf("%w: truncated amount", ErrMalformed)
+	}
+	amount := math.Float64frombits(bits)
+	if math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return fmt.Errorf("%w: amount is not a finite number", ErrMalformed)
+	}
+
+	stamp, err := readField(r, "timestamp")
+	if err != nil {
+		return err
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, stamp)
+	if err != nil || timestamp.Format(time.RFC3339Nano) != stamp {
+		return fmt.Errorf("%w: timestamp %q is not canonical RFC 3339", ErrMalformed, stamp)
+	}
+
+	if r.Len() < 64 {
+		return fmt.Errorf("%w: truncated signature", ErrMalformed)
+	}
+	signature := make([]byte, 64)
+	r.Read(signature)
+
+	var publicKey []byte
+	if version != EncodingVersion {
+		if publicKey, err = readBytes(r, "public key"); err != nil {
+			return err
+		}
+		if len(publicKey) == 0 {
+			if version == EncodingVersionWithKey {
+				return fmt.Errorf("%w: empty public key", ErrMalformed)
+			}
+			publicKey = nil
+		}
+	}
+	var inputs []Input
+	switch version {
+	case EncodingVersionInputs:
+		inputs, err = readInputs(r, 1)
+	case EncodingVersionFee:
+		inputs, err = readInputs(r, 0)
+	}
+	if err != nil {
+		return err
+	}
+	var fee float64
+	if version == EncodingVersionFee {
+		if err := binary.Read(r, binary.BigEndian, &bits); err != nil {
+			return fmt.Errorf("%w: truncated fee", ErrMalformed)
+		}
+		// A zero fee would have been encoded in an earlier version
+		if fee = math.Float64frombits(bits); !(fee > 0) || math.IsInf(fee, 1) {
+			return fmt.Errorf("%w: fee is not a positive number", ErrMalformed)
+		}
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrMalformed, r.Len())
+	}
+
+	*tx = Transaction{
+		From:      from,
+		To:        to,
+		Amount:    amount,
+		Fee:       fee,
+		Timestamp: timestamp,
+		Signature: signature,
+		PublicKey: publicKey,
+		Inputs:    inputs,
+	}
+	tx.ID = tx.Hash()
+	return nil
+}
+
+// readInputs reads the outputs a transaction spends, of which there must be
+// at least atLeast
+func readInputs(r *bytes.Reader, atLeast uint64) ([]Input, error) {
+	count, err := readUvarint(r, "input count")
+	if err != nil {
+		return nil, err
+	}
+	if count < atLeast || count > MaxInputs {
+		return nil, fmt.Errorf("%w: %d inputs, must be %d to %d", ErrMalformed, count, atLeast, MaxInputs)
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	inputs := make([]Input, count)
+	for i := range inputs {
+		if r.Len() < sha256.Size {
+			return nil, fmt.Errorf("%w: truncated input %d", ErrMalformed, i)
+		}
+		id := make([]byte, sha256.Size)
+		r.Read(id)
+		index, err := readUvarint(r, "input index")
+		if err != nil {
+			return nil, err
+		}
+		if index > math.MaxInt32 {
+			return nil, fmt.Errorf("%w: input %d index %d is out of range", ErrMalformed, i, index)
+		}
+		inputs[i] = Input{TxID: hex.EncodeToString(id), Index: int(index)}
+	}
+	return inputs, nil
+}
+
+// readUvarint reads a minimally encoded uvarint
+func readUvarint(r *bytes.Reader, name string) (uint64, error) {
+	before := r.Len()
+	v, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, fmt.Errorf("%w: truncated %s", ErrMalformed, name)
+	}
+	if before-r.Len() != len(binary.AppendUvarint(nil, v)) {
+		return 0, fmt.Errorf("%w: non-minimal %s", ErrMalformed, name)
+	}
+	return v, nil
+}
+
+// writeField writes a length-prefixed string
+func writeField(buf *bytes.Buffer, s string) {
+	writeBytes(buf, []byte(s))
+}
+
+// writeBytes writes a length-prefixed byte slice
+func writeBytes(buf *bytes.Buffer, b []byte) {
+	buf.Write(binary.AppendUvarint(nil, uint64(len(b))))
+	buf.Write(b)
+}
+
+// readField reads a length-prefixed UTF-8 string
+func readField(r *bytes.Reader, name string) (string, error) {
+	field, err := readBytes(r, name)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(field) {
+		return "", fmt.Errorf("%w: %s is not valid UTF-8", ErrMalformed, name)
+	}
+	return string(field), nil
+}
+
+// readBytes reads a length-prefixed byte slice
+func readBytes(r *bytes.Reader, name string) ([]byte, error) {
+	// Only the shortest length encoding is canonical
+	length, err := readUvarint(r, name+" length")
+	if err != nil {
+		return nil, err
+	}
+	if length > maxFieldLength {
+		return nil, fmt.Errorf("%w: %s is %d bytes, limit is %d", ErrMalformed, name, length, maxFieldLength)
+	}
+	if uint64(r.Len()) < length {
+		return nil, fmt.Errorf("%w: truncated %s", ErrMalformed, name)
+	}
+	field := make([]byte, length)
+	r.Read(field)
+	return field, nil
+}
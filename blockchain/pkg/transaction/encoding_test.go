@@ -0,0 +1,189 @@
+package transaction
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestBinaryRoundTrip(t *testing.T) {
+	privateKey, err := createTestWallet()
+	if err != nil {
+		t.Fatalf("failed to create wallet: %v", err)
+	}
+	tx := New("alice", "bob", 10.5)
+	tx.Sign(privateKey)
+
+	data, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	var decoded Transaction
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if decoded.ID != tx.ID {
+		t.Errorf("expected ID %s to be recomputed, got %s", tx.ID, decoded.ID)
+	}
+	if !decoded.Verify(&privateKey.PublicKey) {
+		t.Error("decoded transaction signature should verify")
+	}
+
+	again, _ := decoded.MarshalBinary()
+	if !bytes.Equal(again, data) {
+		t.Error("re-encoding should give identical bytes")
+	}
+	if data[0] != EncodingVersionWithKey || !bytes.Equal(decoded.PublicKey, tx.PublicKey) {
+		t.Error("signer's public key should survive the round trip")
+	}
+}
+
+func TestBinaryWithoutPublicKey(t *testing.T) {
+	privateKey, _ := createTestWallet()
+	tx := New("alice", "bob", 10.5)
+	tx.Sign(privateKey)
+	tx.PublicKey = nil
+
+	data, _ := tx.MarshalBinary()
+	if data[0] != EncodingVersion {
+		t.Errorf("expected version %d without a key, got %d", EncodingVersion, data[0])
+	}
+	var decoded Transaction
+	if err := decoded.UnmarshalBinary(data); err != nil || decoded.PublicKey != nil || decoded.ID != tx.ID {
+		t.Errorf("expected keyless round trip, got %+v, %v", decoded, err)
+	}
+}
+
+func TestBinaryWithInputs(t *testing.T) {
+	privateKey, _ := createTestWallet()
+	funding := New("COINBASE", "alice", 10)
+	funding.ID = funding.Hash()
+	tx := New("alice", "bob", 4)
+	tx.Inputs = []Input{{TxID: funding.ID, Index: 0}, {TxID: funding.ID, Index: 300}}
+	tx.Sign(privateKey)
+
+	for _, key := range [][]byte{tx.PublicKey, nil} {
+		tx.PublicKey = key
+		data, err := tx.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data[0] != EncodingVersionInputs {
+			t.Errorf("expected version %d with inputs, got %d", EncodingVersionInputs, data[0])
+		}
+		var decoded Transaction
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("failed to unmarshal: %v", err)
+		}
+		if decoded.ID != tx.ID || len(decoded.Inputs) != 2 || decoded.Inputs[1] != tx.Inputs[1] || !bytes.Equal(decoded.PublicKey, key) {
+			t.Errorf("expected inputs and key to survive the round trip, got %+v", decoded)
+		}
+		if !decoded.Verify(&privateKey.PublicKey) {
+			t.Error("decoded transaction signature should verify")
+		}
+	}
+
+	// The inputs are signed, so swapping one breaks the signature
+	tx.Inputs[0].Index = 1
+	if tx.Verify(&privateKey.PublicKey) {
+		t.Error("changing an input should invalidate the signature")
+	}
+}
+
+func TestBinaryWithFee(t *testing.T) {
+	privateKey, _ := createTestWallet()
+	funding := New("COINBASE", "alice", 10)
+	funding.ID = funding.Hash()
+	tx := New("alice", "bob", 4)
+	tx.Fee = 0.25
+	tx.Sign(privateKey)
+
+	for _, inputs := range [][]Input{nil, {{TxID: funding.ID, Index: 0}}} {
+		tx.Inputs = inputs
+		tx.ID = tx.Hash()
+		data, err := tx.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data[0] != EncodingVersionFee {
+			t.Errorf("expected version %d with a fee, got %d", EncodingVersionFee, data[0])
+		}
+		var decoded Transaction
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("failed to unmarshal: %v", err)
+		}
+		if decoded.ID != tx.ID || decoded.Fee != 0.25 || len(decoded.Inputs) != len(inputs) {
+			t.Errorf("expected fee and inputs to survive the round trip, got %+v", decoded)
+		}
+	}
+
+	// The fee is signed, so lowering it breaks the signature
+	tx.Inputs = nil
+	if !tx.Verify(&privateKey.PublicKey) {
+		t.Fatal("expected the signature to verify")
+	}
+	tx.Fee = 0.1
+	if tx.Verify(&privateKey.PublicKey) {
+		t.Error("changing the fee should invalidate the signature")
+	}
+}
+
+func TestMarshalBinaryRequiresSignature(t *testing.T) {
+	if _, err := New("alice", "bob", 1).MarshalBinary(); err == nil {
+		t.Error("expected an error for an unsigned transaction")
+	}
+}
+
+func TestUnmarshalBinaryRejectsMalformed(t *testing.T) {
+	privateKey, _ := createTestWallet()
+	tx := New("alice", "bob", 1)
+	tx.Sign(privateKey)
+	valid, _ := tx.MarshalBinary()
+	withInputs := append([]byte{EncodingVersionInputs}, valid[1:]...)
+	withFee := func(fee float64) []byte {
+		data := append(append([]byte{EncodingVersionFee}, valid[1:]...), 0)
+		return binary.BigEndian.AppendUint64(data, math.Float64bits(fee))
+	}
+
+	tests := map[string][]byte{
+		"empty":            {},
+		"unknown version":  append([]byte{5}, valid[1:]...),
+		"zero fee":         withFee(0),
+		"negative fee":     withFee(-1),
+		"NaN fee":          withFee(math.NaN()),
+		"truncated fee":    withFee(1)[:len(valid)+4],
+		"no inputs":        append(append([]byte{}, withInputs...), 0),
+		"truncated input":  append(append([]byte{}, withInputs...), 1, 0xab),
+		"missing index":    append(append(append([]byte{}, withInputs...), 1), make([]byte, 32)...),
+		"empty public key": append(append([]byte{}, valid[:len(valid)-len(tx.PublicKey)-1]...), 0),
+		"truncated":        valid[:len(valid)-1],
+		"trailing bytes":   append(append([]byte{}, valid...), 0),
+		"non-minimal":      append([]byte{1, 0x85, 0x00}, valid[2:]...),
+		"oversized field":  {1, 0xff, 0xff, 0x03},
+		"invalid utf-8":    {1, 1, 0xff},
+		"bad timestamp":    withTimestamp(valid, "2024-01-01 00:00:00"),
+		"padded timestamp": withTimestamp(valid, "2024-01-01T00:00:00.100Z"),
+	}
+	for name, data := range tests {
+		var decoded Transaction
+		if err := decoded.UnmarshalBinary(data); !errors.Is(err, ErrMalformed) {
+			t.Errorf("%s: expected ErrMalformed, got %v", name, err)
+		}
+	}
+}
+
+// withTimestamp re-encodes a valid "alice" -> "bob" transaction with a different timestamp string
+func withTimestamp(valid []byte, stamp string) []byte {
+	// version + "alice" + "bob" + amount
+	prefix := 1 + 6 + 4 + 8
+	rest := valid[prefix:]
+	stampLen := int(rest[0])
+	var buf bytes.Buffer
+	buf.Write(valid[:prefix])
+	writeField(&buf, stamp)
+	buf.Write(rest[1+stampLen:])
+	return buf.Bytes()
+}
@@ -0,0 +1,102 @@
+package transaction
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// fuzzSeeds returns signed transactions with and without their signer's key,
+// spending outputs and paying a fee
+func fuzzSeeds(f *testing.F) []*Transaction {
+	privateKey, err := createTestWallet()
+	if err != nil {
+		f.Fatal(err)
+	}
+	withKey := New("alice", "bob", 10.5)
+	withKey.Sign(privateKey)
+	withoutKey := New("carol", "dave", 0.000001)
+	withoutKey.Sign(privateKey)
+	withoutKey.PublicKey = nil
+	spending := New("alice", "bob", 3)
+	spending.Inputs = []Input{{TxID: withKey.ID, Index: 1}, {TxID: withoutKey.ID, Index: 0}}
+	spending.Sign(privateKey)
+	withFee := New("alice", "bob", 2)
+	withFee.Fee = 0.01
+	withFee.Sign(privateKey)
+	return []*Transaction{withKey, withoutKey, spending, withFee}
+}
+
+// exercise runs what a node does with a decoded transaction, which must not panic
+func exercise(tx *Transaction) {
+	tx.IsValid()
+	tx.IsCoinbase()
+	if key, err := tx.SignerKey(); err == nil {
+		tx.Verify(key)
+	}
+}
+
+func FuzzTransactionJSON(f *testing.F) {
+	for _, tx := range fuzzSeeds(f) {
+		data, _ := json.Marshal(tx)
+		f.Add(data)
+	}
+	f.Add([]byte(`{"id":"x","from":"COINBASE","to":"bob","amount":10,"timestamp":"2024-01-01T00:00:00Z","signature":""}`))
+	f.Add([]byte(`{"signature":"zz"}`))
+	f.Add([]byte(`{"public_key":"3059","amount":-1e308}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var tx Transaction
+		if err := json.Unmarshal(data, &tx); err != nil {
+			return
+		}
+		exercise(&tx)
+
+		// Whatever is accepted survives being passed on to the next peer
+		again, err := json.Marshal(&tx)
+		if err != nil {
+			t.Fatalf("accepted %q but can't encode it again: %v", data, err)
+		}
+		var relayed Transaction
+		if err := json.Unmarshal(again, &relayed); err != nil {
+			t.Fatalf("accepted %q but not its re-encoding %q: %v", data, again, err)
+		}
+		if relayed.ID != tx.ID || relayed.From != tx.From || relayed.To != tx.To || relayed.Amount != tx.Amount ||
+			!relayed.Timestamp.Equal(tx.Timestamp) || !bytes.Equal(relayed.Signature, tx.Signature) ||
+			!bytes.Equal(relayed.PublicKey, tx.PublicKey) {
+			t.Errorf("%q changed when re-encoded as %q", data, again)
+		}
+		if relayed.Hash() != tx.Hash() {
+			t.Errorf("%q hashes differently once re-encoded as %q", data, again)
+		}
+	})
+}
+
+func FuzzTransactionBinary(f *testing.F) {
+	for _, tx := range fuzzSeeds(f) {
+		data, _ := tx.MarshalBinary()
+		f.Add(data)
+	}
+	f.Add([]byte{EncodingVersion})
+	f.Add([]byte{EncodingVersionWithKey, 0xff, 0xff, 0xff, 0xff, 0x0f})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var tx Transaction
+		if err := tx.UnmarshalBinary(data); err != nil {
+			return
+		}
+		exercise(&tx)
+
+		// The encoding is canonical: one transaction, one encoding
+		again, err := tx.MarshalBinary()
+		if err != nil {
+			t.Fatalf("accepted %x but can't encode it again: %v", data, err)
+		}
+		if !bytes.Equal(again, data) {
+			t.Errorf("accepted %x, which re-encodes as %x", data, again)
+		}
+		if tx.ID != tx.Hash() {
+			t.Errorf("decoded ID %s isn't the transaction's hash %s", tx.ID, tx.Hash())
+		}
+	})
+}
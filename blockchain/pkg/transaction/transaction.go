@@ -4,11 +4,17 @@ import (
 	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/x509"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"math"
 	"math/big"
+	"strconv"
+	"sync"
 	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/clock"
 )
 
 // Transaction represents a transfer of value between addresses
@@ -17,42 +23,88 @@ type Transaction struct {
 	From      string    `json:"from"`
 	To        string    `json:"to"`
 	Amount    float64   `json:"amount"`
+	Fee       float64   `json:"fee,omitempty"` // paid to the miner of the block that confirms it
 	Timestamp time.Time `json:"timestamp"`
 	Signature []byte    `json:"signature"`
+	PublicKey []byte    `json:"public_key,omitempty"` // signer's key (PKIX DER), so nodes can check wallets they've never seen
+	Inputs    []Input   `json:"inputs,omitempty"`     // outputs spent, on chains using UTXO accounting
+}
+
+// Input names an output of an earlier transaction for a transaction to spend:
+// output 0 pays the recipient, and output 1, if any, returns the change of a
+// transaction that spent more than its amount to the sender
+type Input struct {
+	TxID  string `json:"txid"`
+	Index int    `json:"index"`
 }
 
+// String returns the input as TXID:INDEX
+func (in Input) String() string {
+	return in.TxID + ":" + strconv.Itoa(in.Index)
+}
+
+// MaxInputs caps how many outputs a transaction may spend
+const MaxInputs = 256
+
 // New creates a new unsigned transaction
 func New(from, to string, amount float64) *Transaction {
+	return NewWithClock(clock.System, from, to, amount)
+}
+
+// NewWithClock creates a new unsigned transaction timestamped by clk
+func NewWithClock(clk clock.Clock, from, to string, amount float64) *Transaction {
 	tx := &Transaction{
 		From:      from,
 		To:        to,
 		Amount:    amount,
-		Timestamp: time.Now(),
+		Timestamp: clk.Now(),
 	}
 	return tx
 }
 
+// dataBuffers holds the buffers transactions are serialised into for hashing
+// and signature checks, which validating a chain does for every transaction
+var dataBuffers = sync.Pool{
+	New: func() any { return new([]byte) },
+}
+
 // Hash generates a unique identifier for the transaction
 func (tx *Transaction) Hash() string {
-	data := fmt.Sprintf("%s%s%f%s",
-		tx.From,
-		tx.To,
-		tx.Amount,
-		tx.Timestamp.Format(time.RFC3339Nano),
-	)
-	hash := sha256.Sum256([]byte(data))
-	return hex.EncodeToString(hash[:])
+	buf := dataBuffers.Get().(*[]byte)
+	defer dataBuffers.Put(buf)
+
+	*buf = tx.appendDataToSign((*buf)[:0])
+	hash := sha256.Sum256(*buf)
+	var encoded [2 * sha256.Size]byte
+	hex.Encode(encoded[:], hash[:])
+	return string(encoded[:])
 }
 
 // DataToSign returns the transaction data that should be signed
 func (tx *Transaction) DataToSign() []byte {
-	data := fmt.Sprintf("%s%s%f%s",
-		tx.From,
-		tx.To,
-		tx.Amount,
-		tx.Timestamp.Format(time.RFC3339Nano),
-	)
-	return []byte(data)
+	return tx.appendDataToSign(nil)
+}
+
+// appendDataToSign appends the signed data to data: the sender, recipient,
+// amount as fmt's %f writes it, and RFC3339Nano timestamp, followed by any
+// inputs as TXID:INDEX; and any fee as fee=%f (transactions without inputs or
+// a fee sign what they always have)
+func (tx *Transaction) appendDataToSign(data []byte) []byte {
+	data = append(data, tx.From...)
+	data = append(data, tx.To...)
+	data = strconv.AppendFloat(data, tx.Amount, 'f', 6, 64)
+	data = tx.Timestamp.AppendFormat(data, time.RFC3339Nano)
+	for _, in := range tx.Inputs {
+		data = append(data, in.TxID...)
+		data = append(data, ':')
+		data = strconv.AppendInt(data, int64(in.Index), 10)
+		data = append(data, ';')
+	}
+	if tx.Fee != 0 {
+		data = append(data, "fee="...)
+		data = strconv.AppendFloat(data, tx.Fee, 'f', 6, 64)
+	}
+	return data
 }
 
 // Sign signs the transaction with the given private key
@@ -73,17 +125,43 @@ func (tx *Transaction) Sign(privateKey *ecdsa.PrivateKey) error {
 	copy(signature[64-len(sBytes):64], sBytes)
 	tx.Signature = signature
 	tx.ID = tx.Hash()
+
+	publicKey, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return fmt.Errorf("failed to encode public key: %w", err)
+	}
+	tx.PublicKey = publicKey
 	return nil
 }
 
+// SignerKey parses the public key the transaction carries. It says nothing
+// about whether the key belongs to the sender; callers check it against the
+// From address.
+func (tx *Transaction) SignerKey() (*ecdsa.PublicKey, error) {
+	if len(tx.PublicKey) == 0 {
+		return nil, fmt.Errorf("transaction carries no public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(tx.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	publicKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is not an ECDSA key")
+	}
+	return publicKey, nil
+}
+
 // Verify checks if the transaction signature is valid
 func (tx *Transaction) Verify(publicKey *ecdsa.PublicKey) bool {
 	if len(tx.Signature) != 64 {
 		return false
 	}
 
-	dataToSign := tx.DataToSign()
-	hash := sha256.Sum256(dataToSign)
+	buf := dataBuffers.Get().(*[]byte)
+	*buf = tx.appendDataToSign((*buf)[:0])
+	hash := sha256.Sum256(*buf)
+	dataBuffers.Put(buf)
 
 	// Split signature into r and s
 	r := new(big.Int).SetBytes(tx.Signature[:32])
@@ -103,15 +181,45 @@ func (tx *Transaction) IsValid() error {
 	if tx.Amount <= 0 {
 		return fmt.Errorf("amount must be positive")
 	}
+	if !(tx.Fee >= 0) || math.IsInf(tx.Fee, 1) {
+		return fmt.Errorf("fee must be zero or positive")
+	}
 	if len(tx.Signature) == 0 {
 		return fmt.Errorf("transaction must be signed")
 	}
 	if tx.ID == "" {
 		return fmt.Errorf("transaction must have an ID")
 	}
+	if len(tx.Inputs) > MaxInputs {
+		return fmt.Errorf("spends %d outputs, limit is %d", len(tx.Inputs), MaxInputs)
+	}
+	for _, in := range tx.Inputs {
+		if !isTxID(in.TxID) || in.Index < 0 {
+			return fmt.Errorf("input %q is not a transaction ID and output index", in)
+		}
+	}
 	return nil
 }
 
+// isTxID reports whether s looks like a transaction ID: 64 lowercase hex digits
+func isTxID(s string) bool {
+	if len(s) != 2*sha256.Size {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !('0' <= s[i] && s[i] <= '9' || 'a' <= s[i] && s[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Total returns what the transaction takes from its sender: its amount plus
+// its fee
+func (tx *Transaction) Total() float64 {
+	return tx.Amount + tx.Fee
+}
+
 // IsCoinbase checks if this is a coinbase transaction (mining reward)
 func (tx *Transaction) IsCoinbase() bool {
 	return tx.From == "COINBASE"
@@ -123,10 +231,42 @@ func (tx *Transaction) MarshalJSON() ([]byte, error) {
 	return json.Marshal(&struct {
 		Timestamp string `json:"timestamp"`
 		Signature string `json:"signature"`
+		PublicKey string `json:"public_key,omitempty"`
 		*Alias
 	}{
 		Timestamp: tx.Timestamp.Format(time.RFC3339Nano),
 		Signature: hex.EncodeToString(tx.Signature),
+		PublicKey: hex.EncodeToString(tx.PublicKey),
 		Alias:     (*Alias)(tx),
 	})
 }
+
+// UnmarshalJSON implements custom JSON unmarshaling, accepting the hex
+// signature produced by MarshalJSON
+func (tx *Transaction) UnmarshalJSON(data []byte) error {
+	type Alias Transaction
+	aux := &struct {
+		Signature string `json:"signature"`
+		PublicKey string `json:"public_key"`
+		*Alias
+	}{
+		Alias: (*Alias)(tx),
+	}
+	if err := json.Unmarshal(data, aux); err != nil {
+		return err
+	}
+
+	signature, err := hex.DecodeString(aux.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	tx.Signature = signature
+
+	tx.PublicKey = nil
+	if aux.PublicKey != "" {
+		if tx.PublicKey, err = hex.DecodeString(aux.PublicKey); err != nil {
+			return fmt.Errorf("invalid public key encoding: %w", err)
+		}
+	}
+	return nil
+}
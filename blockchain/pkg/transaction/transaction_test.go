@@ -4,8 +4,15 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
 	"testing"
 	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/clock"
 )
 
 func createTestWallet() (*ecdsa.PrivateKey, error) {
@@ -35,6 +42,24 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNewWithClock(t *testing.T) {
+	clk := clock.NewManual(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	tx1 := NewWithClock(clk, "alice", "bob", 10.0)
+	tx2 := NewWithClock(clk, "alice", "bob", 10.0)
+
+	if !tx1.Timestamp.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the clock's time, got %v", tx1.Timestamp)
+	}
+	// The same payment at the same instant is the same transaction
+	if tx1.Hash() != tx2.Hash() {
+		t.Error("transactions made at the same time should hash the same")
+	}
+	clk.Advance(time.Nanosecond)
+	if NewWithClock(clk, "alice", "bob", 10.0).Hash() == tx1.Hash() {
+		t.Error("a later payment should hash differently")
+	}
+}
+
 func TestHash(t *testing.T) {
 	tx := New("alice", "bob", 10.0)
 	tx.Timestamp = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
@@ -171,6 +196,36 @@ func TestIsValid(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "with fee",
+			setup: func() *Transaction {
+				tx := New("alice", "bob", 10.0)
+				tx.Fee = 0.5
+				tx.Sign(privateKey)
+				return tx
+			},
+			wantErr: false,
+		},
+		{
+			name: "negative fee",
+			setup: func() *Transaction {
+				tx := New("alice", "bob", 10.0)
+				tx.Fee = -0.5
+				tx.Sign(privateKey)
+				return tx
+			},
+			wantErr: true,
+		},
+		{
+			name: "NaN fee",
+			setup: func() *Transaction {
+				tx := New("alice", "bob", 10.0)
+				tx.Fee = math.NaN()
+				tx.Sign(privateKey)
+				return tx
+			},
+			wantErr: true,
+		},
 		{
 			name: "missing signature",
 			setup: func() *Transaction {
@@ -232,3 +287,87 @@ func TestDataToSign(t *testing.T) {
 		t.Error("changing transaction should change DataToSign")
 	}
 }
+
+func TestDataToSignFormat(t *testing.T) {
+	// Signatures and IDs already on the chain commit to the fields written out
+	// like this, so the encoding must never drift from it
+	ts := time.Date(2024, 1, 1, 12, 30, 0, 123456789, time.FixedZone("", 3600))
+	for _, amount := range []float64{10, 2.5, 1e-7, 1e300, math.Copysign(0, -1), math.Inf(1), math.NaN()} {
+		tx := &Transaction{From: "alice", To: "bob", Amount: amount, Timestamp: ts}
+		want := fmt.Sprintf("%s%s%f%s", tx.From, tx.To, tx.Amount, ts.Format(time.RFC3339Nano))
+		if got := string(tx.DataToSign()); got != want {
+			t.Errorf("DataToSign() = %q, want %q", got, want)
+		}
+		if sum := sha256.Sum256([]byte(want)); tx.Hash() != hex.EncodeToString(sum[:]) {
+			t.Errorf("Hash() of %q isn't the SHA-256 of its signed data", want)
+		}
+	}
+
+	// A fee is signed after everything else
+	tx := &Transaction{From: "alice", To: "bob", Amount: 10, Fee: 0.25, Timestamp: ts}
+	want := fmt.Sprintf("alicebob%f%sfee=%f", tx.Amount, ts.Format(time.RFC3339Nano), tx.Fee)
+	if got := string(tx.DataToSign()); got != want {
+		t.Errorf("DataToSign() = %q, want %q", got, want)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	privateKey, err := createTestWallet()
+	if err != nil {
+		t.Fatalf("failed to create wallet: %v", err)
+	}
+
+	tx := New("alice", "bob", 10.0)
+	if err := tx.Sign(privateKey); err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+
+	data, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	var decoded Transaction
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+
+	if decoded.ID != tx.ID || decoded.From != tx.From || decoded.To != tx.To || decoded.Amount != tx.Amount {
+		t.Errorf("decoded transaction mismatch: %+v", decoded)
+	}
+	if !decoded.Timestamp.Equal(tx.Timestamp) {
+		t.Errorf("expected timestamp %v, got %v", tx.Timestamp, decoded.Timestamp)
+	}
+	if !decoded.Verify(&privateKey.PublicKey) {
+		t.Error("decoded transaction signature should verify")
+	}
+
+	// The carried key is enough to verify without knowing the sender
+	signer, err := decoded.SignerKey()
+	if err != nil || !decoded.Verify(signer) {
+		t.Errorf("carried public key should verify the signature, got %v", err)
+	}
+}
+
+func TestSignerKeyMissing(t *testing.T) {
+	if _, err := New("alice", "bob", 1).SignerKey(); err == nil {
+		t.Error("expected an error for a transaction without a public key")
+	}
+}
+
+func TestUnmarshalJSONInvalidSignature(t *testing.T) {
+	var tx Transaction
+	err := json.Unmarshal([]byte(`{"from":"alice","to":"bob","amount":1,"signature":"not-hex"}`), &tx)
+	if err == nil {
+		t.Error("expected error for non-hex signature")
+	}
+}
+
+func BenchmarkHash(b *testing.B) {
+	tx := New("alice", "bob", 10.0)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		tx.Hash()
+	}
+}
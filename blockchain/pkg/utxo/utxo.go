@@ -0,0 +1,240 @@
+// Package utxo keeps the set of unspent transaction outputs, for chains that
+// account for coins by output rather than by address balance.
+//
+// Every transaction creates output 0, paying its amount to its recipient. A
+// transfer names the outputs it spends in its Inputs, all of which must belong
+// to its sender, and whatever they hold beyond the amount and fee comes back
+// to the sender as output 1, its change. The fee goes to the block's miner
+// through the coinbase, which spends nothing.
+package utxo
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+)
+
+// Errors returned when a transaction can't be applied
+var (
+	ErrNoInputs     = errors.New("spends no outputs")
+	ErrMissingInput = errors.New("spends an output that doesn't exist or is already spent")
+	ErrNotOwner     = errors.New("spends an output that belongs to someone else")
+	ErrInsufficient = errors.New("spends outputs worth less than its amount and fee")
+	ErrDuplicate    = errors.New("creates outputs that already exist")
+)
+
+// Output is an amount paid to an address
+type Output struct {
+	Address string  `json:"address"`
+	Amount  float64 `json:"amount"`
+}
+
+// Entry is an unspent output and where to find it
+type Entry struct {
+	transaction.Input
+	Output
+}
+
+// Set is the set of unspent outputs. It is not safe for concurrent use; the
+// chain holding it guards it with its own lock.
+type Set struct {
+	outputs   map[transaction.Input]Output
+	byAddress map[string]map[transaction.Input]struct{}
+}
+
+// New returns an empty set
+func New() *Set {
+	return &Set{
+		outputs:   make(map[transaction.Input]Output),
+		byAddress: make(map[string]map[transaction.Input]struct{}),
+	}
+}
+
+// Get returns an unspent output
+func (s *Set) Get(in transaction.Input) (Output, bool) {
+	out, ok := s.outputs[in]
+	return out, ok
+}
+
+// Len returns how many outputs are unspent
+func (s *Set) Len() int {
+	return len(s.outputs)
+}
+
+// Unspent returns the outputs address can spend, largest first
+func (s *Set) Unspent(address string) []Entry {
+	entries := make([]Entry, 0, len(s.byAddress[address]))
+	for in := range s.byAddress[address] {
+		entries = append(entries, Entry{Input: in, Output: s.outputs[in]})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Amount != entries[j].Amount {
+			return entries[i].Amount > entries[j].Amount
+		}
+		if entries[i].TxID != entries[j].TxID {
+			return entries[i].TxID < entries[j].TxID
+		}
+		return entries[i].Index < entries[j].Index
+	})
+	return entries
+}
+
+// Balance returns the total of the outputs address can spend
+func (s *Set) Balance(address string) float64 {
+	total := 0.0
+	for _, e := range s.Unspent(address) {
+		total += e.Amount
+	}
+	return total
+}
+
+// Select picks outputs of address worth at least amount to spend, largest
+// first so transactions need as few inputs as possible
+func (s *Set) Select(address string, amount float64) ([]transaction.Input, error) {
+	var inputs []transaction.Input
+	total := 0.0
+	for _, e := range s.Unspent(address) {
+		if total >= amount || len(inputs) == transaction.MaxInputs {
+			break
+		}
+		inputs = append(inputs, e.Input)
+		total += e.Amount
+	}
+	if total < amount {
+		return nil, fmt.Errorf("%s can spend %.2f of the %.2f needed: %w", address, total, amount, ErrInsufficient)
+	}
+	return inputs, nil
+}
+
+// Clone returns a copy of the set
+func (s *Set) Clone() *Set {
+	clone := New()
+	for in, out := range s.outputs {
+		clone.add(in, out)
+	}
+	return clone
+}
+
+// Apply checks a transaction against the set and, if it is valid, spends its
+// inputs and adds its outputs. An invalid transaction leaves the set untouched.
+func (s *Set) Apply(tx *transaction.Transaction) error {
+	v := s.View()
+	if err := v.Apply(tx); err != nil {
+		return err
+	}
+	v.Commit()
+	return nil
+}
+
+func (s *Set) add(in transaction.Input, out Output) {
+	s.outputs[in] = out
+	owned := s.byAddress[out.Address]
+	if owned == nil {
+		owned = make(map[transaction.Input]struct{})
+		s.byAddress[out.Address] = owned
+	}
+	owned[in] = struct{}{}
+}
+
+func (s *Set) remove(in transaction.Input) {
+	out, ok := s.outputs[in]
+	if !ok {
+		return
+	}
+	delete(s.outputs, in)
+	delete(s.byAddress[out.Address], in)
+	if len(s.byAddress[out.Address]) == 0 {
+		delete(s.byAddress, out.Address)
+	}
+}
+
+// View applies transactions on top of a set without changing it until
+// Commit, so a block can be checked transaction by transaction and thrown
+// away if any is invalid
+type View struct {
+	base    *Set
+	spent   map[transaction.Input]struct{}
+	created map[transaction.Input]Output
+}
+
+// View returns an empty view of s
+func (s *Set) View() *View {
+	return &View{
+		base:    s,
+		spent:   make(map[transaction.Input]struct{}),
+		created: make(map[transaction.Input]Output),
+	}
+}
+
+// get returns an output unspent as far as the view is concerned
+func (v *View) get(in transaction.Input) (Output, bool) {
+	if _, spent := v.spent[in]; spent {
+		return Output{}, false
+	}
+	if out, ok := v.created[in]; ok {
+		return out, true
+	}
+	return v.base.Get(in)
+}
+
+// Apply checks tx against the view and applies it, or returns why it can't
+// be, leaving the view as it was
+func (v *View) Apply(tx *transaction.Transaction) error {
+	total := 0.0
+	if !tx.IsCoinbase() {
+		if len(tx.Inputs) == 0 {
+			return fmt.Errorf("transaction %s %w", tx.ID, ErrNoInputs)
+		}
+		seen := make(map[transaction.Input]bool, len(tx.Inputs))
+		for _, in := range tx.Inputs {
+			out, ok := v.get(in)
+			if !ok || seen[in] {
+				return fmt.Errorf("transaction %s %w: %s", tx.ID, ErrMissingInput, in)
+			}
+			if out.Address != tx.From {
+				return fmt.Errorf("transaction %s %w: %s", tx.ID, ErrNotOwner, in)
+			}
+			seen[in] = true
+			total += out.Amount
+		}
+		if total < tx.Total() {
+			return fmt.Errorf("transaction %s %w: %.2f in, %.2f out", tx.ID, ErrInsufficient, total, tx.Total())
+		}
+	} else if len(tx.Inputs) > 0 {
+		return fmt.Errorf("coinbase %s spends outputs", tx.ID)
+	}
+
+	outputs := []Output{{Address: tx.To, Amount: tx.Amount}}
+	if change := total - tx.Total(); change > 0 {
+		outputs = append(outputs, Output{Address: tx.From, Amount: change})
+	}
+	for i := range outputs {
+		if _, exists := v.get(transaction.Input{TxID: tx.ID, Index: i}); exists {
+			return fmt.Errorf("transaction %s %w", tx.ID, ErrDuplicate)
+		}
+	}
+
+	for _, in := range tx.Inputs {
+		v.spent[in] = struct{}{}
+	}
+	for i, out := range outputs {
+		v.created[transaction.Input{TxID: tx.ID, Index: i}] = out
+	}
+	return nil
+}
+
+// Commit writes the view's changes to its set
+func (v *View) Commit() {
+	for in := range v.spent {
+		v.base.remove(in)
+	}
+	for in, out := range v.created {
+		if _, spent := v.spent[in]; !spent {
+			v.base.add(in, out)
+		}
+	}
+	clear(v.spent)
+	clear(v.created)
+}
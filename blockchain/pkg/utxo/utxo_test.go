@@ -0,0 +1,212 @@
+package utxo
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+)
+
+// spend returns a transfer from from to to spending inputs, with its ID set
+// as signing would
+func spend(from, to string, amount float64, inputs ...transaction.Input) *transaction.Transaction {
+	tx := transaction.New(from, to, amount)
+	tx.Inputs = inputs
+	tx.ID = tx.Hash()
+	return tx
+}
+
+// coinbase returns a mining reward paying to
+func coinbase(to string, amount float64) *transaction.Transaction {
+	return spend("COINBASE", to, amount)
+}
+
+// withFee sets tx's fee, updating its ID
+func withFee(tx *transaction.Transaction, fee float64) *transaction.Transaction {
+	tx.Fee = fee
+	tx.ID = tx.Hash()
+	return tx
+}
+
+func out(tx *transaction.Transaction, index int) transaction.Input {
+	return transaction.Input{TxID: tx.ID, Index: index}
+}
+
+func TestApply(t *testing.T) {
+	s := New()
+	reward := coinbase("alice", 10)
+	if err := s.Apply(reward); err != nil {
+		t.Fatalf("coinbase: %v", err)
+	}
+	if got := s.Balance("alice"); got != 10 {
+		t.Fatalf("alice has %.2f after the coinbase, want 10", got)
+	}
+
+	// Alice pays Bob 4 from her 10 and gets 6 back as change
+	pay := spend("alice", "bob", 4, out(reward, 0))
+	if err := s.Apply(pay); err != nil {
+		t.Fatalf("payment: %v", err)
+	}
+	if _, ok := s.Get(out(reward, 0)); ok {
+		t.Error("spent output is still unspent")
+	}
+	if got, ok := s.Get(out(pay, 0)); !ok || got != (Output{Address: "bob", Amount: 4}) {
+		t.Errorf("output 0 = %+v, %v; want 4 to bob", got, ok)
+	}
+	if got, ok := s.Get(out(pay, 1)); !ok || got != (Output{Address: "alice", Amount: 6}) {
+		t.Errorf("output 1 = %+v, %v; want 6 change to alice", got, ok)
+	}
+	if s.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", s.Len())
+	}
+
+	// Spending an output exactly leaves no change
+	exact := spend("bob", "carol", 4, out(pay, 0))
+	if err := s.Apply(exact); err != nil {
+		t.Fatalf("exact payment: %v", err)
+	}
+	if _, ok := s.Get(out(exact, 1)); ok {
+		t.Error("exact payment created a change output")
+	}
+	if s.Balance("bob") != 0 || s.Balance("carol") != 4 || s.Balance("alice") != 6 {
+		t.Errorf("balances alice=%.2f bob=%.2f carol=%.2f, want 6, 0, 4",
+			s.Balance("alice"), s.Balance("bob"), s.Balance("carol"))
+	}
+}
+
+func TestApplyRejects(t *testing.T) {
+	reward := coinbase("alice", 10)
+	spent := spend("alice", "bob", 10, out(reward, 0))
+	missing := transaction.Input{TxID: reward.ID, Index: 5}
+
+	tests := []struct {
+		name string
+		tx   *transaction.Transaction
+		want error
+	}{
+		{"no inputs", spend("alice", "bob", 1), ErrNoInputs},
+		{"missing output", spend("alice", "bob", 1, missing), ErrMissingInput},
+		{"spent output", spend("alice", "bob", 1, out(reward, 0)), ErrMissingInput},
+		{"someone else's output", spend("mallory", "bob", 1, out(spent, 0)), ErrNotOwner},
+		{"same output twice", spend("bob", "carol", 15, out(spent, 0), out(spent, 0)), ErrMissingInput},
+		{"more than the inputs", spend("bob", "carol", 11, out(spent, 0)), ErrInsufficient},
+		{"fee on top of the inputs", withFee(spend("bob", "carol", 10, out(spent, 0)), 0.5), ErrInsufficient},
+		{"replayed", spent, ErrMissingInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New()
+			for _, tx := range []*transaction.Transaction{reward, spent} {
+				if err := s.Apply(tx); err != nil {
+					t.Fatal(err)
+				}
+			}
+			before := s.Clone()
+
+			if err := s.Apply(tt.tx); !errors.Is(err, tt.want) {
+				t.Fatalf("Apply() = %v, want %v", err, tt.want)
+			}
+			if s.Len() != before.Len() || s.Balance("bob") != before.Balance("bob") {
+				t.Error("a rejected transaction changed the set")
+			}
+		})
+	}
+
+	t.Run("outputs already unspent", func(t *testing.T) {
+		s := New()
+		if err := s.Apply(reward); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Apply(reward); !errors.Is(err, ErrDuplicate) {
+			t.Fatalf("Apply() = %v, want %v", err, ErrDuplicate)
+		}
+	})
+
+	t.Run("coinbase with inputs", func(t *testing.T) {
+		s := New()
+		if err := s.Apply(reward); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Apply(spend("COINBASE", "alice", 10, out(reward, 0))); err == nil {
+			t.Fatal("coinbase spending an output was accepted")
+		}
+	})
+}
+
+func TestView(t *testing.T) {
+	s := New()
+	reward := coinbase("alice", 10)
+	if err := s.Apply(reward); err != nil {
+		t.Fatal(err)
+	}
+
+	// Within a view, a transaction can spend an output created earlier in it,
+	// and an output spent earlier can't be spent again
+	v := s.View()
+	first := spend("alice", "bob", 3, out(reward, 0))
+	if err := v.Apply(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Apply(spend("alice", "carol", 3, out(reward, 0))); !errors.Is(err, ErrMissingInput) {
+		t.Fatalf("double spend within a view: got %v", err)
+	}
+	second := spend("alice", "carol", 7, out(first, 1))
+	if err := v.Apply(second); err != nil {
+		t.Fatalf("spending change within a view: %v", err)
+	}
+
+	if s.Balance("alice") != 10 || s.Len() != 1 {
+		t.Fatal("view changed its set before Commit")
+	}
+	v.Commit()
+	if s.Balance("alice") != 0 || s.Balance("bob") != 3 || s.Balance("carol") != 7 {
+		t.Errorf("after Commit alice=%.2f bob=%.2f carol=%.2f, want 0, 3, 7",
+			s.Balance("alice"), s.Balance("bob"), s.Balance("carol"))
+	}
+	if _, ok := s.Get(out(first, 1)); ok {
+		t.Error("change created and spent within the view ended up in the set")
+	}
+}
+
+func TestSelect(t *testing.T) {
+	s := New()
+	var rewards []*transaction.Transaction
+	for _, amount := range []float64{2, 5, 1} {
+		reward := coinbase("alice", amount)
+		if err := s.Apply(reward); err != nil {
+			t.Fatal(err)
+		}
+		rewards = append(rewards, reward)
+	}
+
+	inputs, err := s.Select("alice", 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []transaction.Input{out(rewards[1], 0), out(rewards[0], 0)}
+	if len(inputs) != len(want) || inputs[0] != want[0] || inputs[1] != want[1] {
+		t.Errorf("Select(6) = %v, want the 5 then the 2: %v", inputs, want)
+	}
+
+	if _, err := s.Select("alice", 8.5); !errors.Is(err, ErrInsufficient) {
+		t.Errorf("Select(8.5) = %v, want ErrInsufficient", err)
+	}
+	if _, err := s.Select("nobody", 1); !errors.Is(err, ErrInsufficient) {
+		t.Errorf("Select for an address with nothing = %v, want ErrInsufficient", err)
+	}
+}
+
+func TestClone(t *testing.T) {
+	s := New()
+	reward := coinbase("alice", 10)
+	if err := s.Apply(reward); err != nil {
+		t.Fatal(err)
+	}
+	clone := s.Clone()
+	if err := clone.Apply(spend("alice", "bob", 10, out(reward, 0))); err != nil {
+		t.Fatal(err)
+	}
+	if s.Balance("alice") != 10 || s.Balance("bob") != 0 {
+		t.Error("spending from a clone changed the original")
+	}
+}
@@ -0,0 +1,28 @@
+package wallet
+
+import (
+	"strings"
+
+	"github.com/oksmith/home-server/pkg/sigauth"
+)
+
+// RequestSigner returns a signer for requests to the other home-server
+// services, so the wallet's key can stand in for a shared token. Its key ID
+// is the wallet's address.
+func (w *Wallet) RequestSigner() (*sigauth.Signer, error) {
+	return sigauth.NewSigner(w.PrivateKey)
+}
+
+// AuthorizedKey returns a line for a service's authorized keys file trusting
+// the wallet's signatures as name, granted scopes if the service has any
+func (w *Wallet) AuthorizedKey(name string, scopes ...string) (string, error) {
+	pub, err := sigauth.EncodePublicKey(w.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	line := name + " " + pub
+	if len(scopes) > 0 {
+		line += " " + strings.Join(scopes, ",")
+	}
+	return line, nil
+}
@@ -0,0 +1,56 @@
+package wallet
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/oksmith/home-server/pkg/sigauth"
+)
+
+func TestRequestSigner(t *testing.T) {
+	w, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := w.RequestSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.ID() != w.Address() {
+		t.Errorf("key ID %s isn't the address %s", signer.ID(), w.Address())
+	}
+
+	// A saved wallet signs the same, as services load it
+	filename := filepath.Join(t.TempDir(), "gateway.pem")
+	if err := w.SaveToFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := sigauth.LoadSigner(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ID() != w.Address() {
+		t.Errorf("loaded key ID %s isn't the address %s", loaded.ID(), w.Address())
+	}
+
+	line, err := w.AuthorizedKey("gateway", "wake", "hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := sigauth.ParseKeys([]byte(line))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "http://nas:8080/wake", nil)
+	if err := loaded.Sign(r); err != nil {
+		t.Fatal(err)
+	}
+	key, err := sigauth.NewKeyring(keys...).Verify(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Name != "gateway" || key.ID != w.Address() || !key.Allows("hosts") {
+		t.Errorf("got %+v", key)
+	}
+}
@@ -0,0 +1,226 @@
+package wallet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// PEM block types for key files
+const (
+	KeyType          = "EC PRIVATE KEY"       // unencrypted, as written by SaveToFile
+	EncryptedKeyType = "BCHAIN ENCRYPTED KEY" // protected by a passphrase
+)
+
+// Key derivation and cipher recorded in the headers of an encrypted key
+const (
+	keyKDF    = "pbkdf2-sha256"
+	keyCipher = "aes-256-gcm"
+	saltSize  = 16
+)
+
+// keyIterations is the PBKDF2 work factor for newly encrypted keys. Tests
+// lower it to stay fast.
+var keyIterations = 600_000
+
+// maxKeyIterations stops a crafted key file from tying up the CPU
+const maxKeyIterations = 10_000_000
+
+var (
+	// ErrPassphraseRequired is returned when loading an encrypted key without a passphrase
+	ErrPassphraseRequired = errors.New("key is encrypted and needs a passphrase")
+	// ErrWrongPassphrase is returned when an encrypted key fails to decrypt
+	ErrWrongPassphrase = errors.New("wrong passphrase, or the key file is damaged")
+)
+
+// KeyInfo describes a key file without decrypting it
+type KeyInfo struct {
+	Address    string `json:"address"`
+	Encrypted  bool   `json:"encrypted"`
+	KDF        string `json:"kdf,omitempty"`
+	Iterations int    `json:"iterations,omitempty"`
+	Cipher     string `json:"cipher,omitempty"`
+}
+
+// EncodePEM returns the wallet's private key as an unencrypted PEM block
+func (w *Wallet) EncodePEM() ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(w.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: KeyType, Bytes: der}), nil
+}
+
+// EncodeEncryptedPEM returns the wallet's private key encrypted under
+// passphrase. The address is left readable in a header so the key can be
+// listed without the passphrase, and is authenticated so it can't be swapped.
+func (w *Wallet) EncodeEncryptedPEM(passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase is empty")
+	}
+	der, err := x509.MarshalECPrivateKey(w.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode key: %w", err)
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, err := keyCipherFor(passphrase, salt, keyIterations)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	address := w.Address()
+	return pem.EncodeToMemory(&pem.Block{
+		Type: EncryptedKeyType,
+		Headers: map[string]string{
+			"Address":    address,
+			"KDF":        keyKDF,
+			"Iterations": strconv.Itoa(keyIterations),
+			"Salt":       hex.EncodeToString(salt),
+			"Cipher":     keyCipher,
+			"Nonce":      hex.EncodeToString(nonce),
+		},
+		Bytes: gcm.Seal(nil, nonce, der, []byte(address)),
+	}), nil
+}
+
+// DecodePEM parses a key file's contents, decrypting it with passphrase if it
+// is encrypted
+func DecodePEM(data, passphrase []byte) (*Wallet, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM key found")
+	}
+
+	der := block.Bytes
+	switch block.Type {
+	case KeyType:
+	case EncryptedKeyType:
+		if len(passphrase) == 0 {
+			return nil, ErrPassphraseRequired
+		}
+		var err error
+		if der, err = decryptKey(block, passphrase); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", block.Type)
+	}
+
+	privateKey, err := x509.ParseECPrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key: %w", err)
+	}
+	return &Wallet{PrivateKey: privateKey, PublicKey: &privateKey.PublicKey}, nil
+}
+
+// InspectPEM reports a key file's address and protection without needing
+// its passphrase
+func InspectPEM(data []byte) (KeyInfo, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return KeyInfo{}, errors.New("no PEM key found")
+	}
+	if block.Type != EncryptedKeyType {
+		w, err := DecodePEM(data, nil)
+		if err != nil {
+			return KeyInfo{}, err
+		}
+		return KeyInfo{Address: w.Address()}, nil
+	}
+
+	iterations, _ := strconv.Atoi(block.Headers["Iterations"])
+	return KeyInfo{
+		Address:    block.Headers["Address"],
+		Encrypted:  true,
+		KDF:        block.Headers["KDF"],
+		Iterations: iterations,
+		Cipher:     block.Headers["Cipher"],
+	}, nil
+}
+
+// SaveEncrypted writes the wallet's private key, encrypted under passphrase,
+// to a file readable only by the owner
+func (w *Wallet) SaveEncrypted(filename string, passphrase []byte) error {
+	data, err := w.EncodeEncryptedPEM(passphrase)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0600)
+}
+
+// LoadWithPassphrase loads a wallet from a key file, decrypting it with
+// passphrase if it is encrypted
+func LoadWithPassphrase(filename string, passphrase []byte) (*Wallet, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	w, err := DecodePEM(data, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return w, nil
+}
+
+// decryptKey checks an encrypted block's headers and returns the DER key
+func decryptKey(block *pem.Block, passphrase []byte) ([]byte, error) {
+	h := block.Headers
+	if h["KDF"] != keyKDF || h["Cipher"] != keyCipher {
+		return nil, fmt.Errorf("unsupported key encryption %s/%s", h["KDF"], h["Cipher"])
+	}
+	iterations, err := strconv.Atoi(h["Iterations"])
+	if err != nil || iterations < 1 || iterations > maxKeyIterations {
+		return nil, fmt.Errorf("invalid iteration count %q", h["Iterations"])
+	}
+	salt, err := hex.DecodeString(h["Salt"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %w", err)
+	}
+	nonce, err := hex.DecodeString(h["Nonce"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid nonce: %w", err)
+	}
+
+	gcm, err := keyCipherFor(passphrase, salt, iterations)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce length %d", len(nonce))
+	}
+	der, err := gcm.Open(nil, nonce, block.Bytes, []byte(h["Address"]))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return der, nil
+}
+
+// keyCipherFor derives the AES-GCM cipher for a passphrase and salt
+func keyCipherFor(passphrase, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, string(passphrase), salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(c)
+}
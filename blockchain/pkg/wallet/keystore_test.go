@@ -0,0 +1,88 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/pem"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// fastKeys lowers the key derivation work factor for the rest of a test
+func fastKeys(t *testing.T) {
+	old := keyIterations
+	keyIterations = 1000
+	t.Cleanup(func() { keyIterations = old })
+}
+
+func TestEncryptedKeyRoundTrip(t *testing.T) {
+	fastKeys(t)
+	w, _ := New()
+	filename := filepath.Join(t.TempDir(), "alice.pem")
+	if err := w.SaveEncrypted(filename, []byte("correct horse")); err != nil {
+		t.Fatalf("failed to save encrypted key: %v", err)
+	}
+
+	if _, err := LoadFromFile(filename); !errors.Is(err, ErrPassphraseRequired) {
+		t.Errorf("expected ErrPassphraseRequired without a passphrase, got %v", err)
+	}
+	if _, err := LoadWithPassphrase(filename, []byte("wrong")); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("expected ErrWrongPassphrase, got %v", err)
+	}
+	loaded, err := LoadWithPassphrase(filename, []byte("correct horse"))
+	if err != nil || loaded.Address() != w.Address() {
+		t.Fatalf("expected the original key back, got %v", err)
+	}
+}
+
+func TestEncryptedKeyRejectsEmptyPassphrase(t *testing.T) {
+	w, _ := New()
+	if _, err := w.EncodeEncryptedPEM(nil); err == nil {
+		t.Error("expected an empty passphrase to be refused")
+	}
+}
+
+func TestInspectPEM(t *testing.T) {
+	fastKeys(t)
+	w, _ := New()
+
+	plain, _ := w.EncodePEM()
+	info, err := InspectPEM(plain)
+	if err != nil || info.Encrypted || info.Address != w.Address() {
+		t.Errorf("unexpected info for a plain key: %+v, %v", info, err)
+	}
+
+	encrypted, _ := w.EncodeEncryptedPEM([]byte("secret"))
+	info, err = InspectPEM(encrypted)
+	if err != nil || !info.Encrypted || info.Address != w.Address() || info.Iterations != 1000 || info.KDF != keyKDF {
+		t.Errorf("unexpected info for an encrypted key: %+v, %v", info, err)
+	}
+
+	if _, err := InspectPEM([]byte("not a key")); err == nil {
+		t.Error("expected an error for a file with no key")
+	}
+}
+
+func TestEncryptedKeyDetectsTampering(t *testing.T) {
+	fastKeys(t)
+	w, _ := New()
+	other, _ := New()
+	data, _ := w.EncodeEncryptedPEM([]byte("secret"))
+
+	// Swapping the readable address must not go unnoticed
+	block, _ := pem.Decode(data)
+	block.Headers["Address"] = other.Address()
+	if _, err := DecodePEM(pem.EncodeToMemory(block), []byte("secret")); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("expected a swapped address to fail decryption, got %v", err)
+	}
+
+	block, _ = pem.Decode(data)
+	block.Headers["Iterations"] = "999999999"
+	if _, err := DecodePEM(pem.EncodeToMemory(block), []byte("secret")); err == nil || errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("expected an absurd iteration count to be refused up front, got %v", err)
+	}
+
+	if !bytes.Contains(data, []byte(w.Address())) {
+		t.Error("expected the address to be readable in the header")
+	}
+}
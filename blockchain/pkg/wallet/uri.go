@@ -0,0 +1,90 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// URIScheme is the scheme of payment URIs, e.g. homechain:ADDRESS?amount=5
+const URIScheme = "homechain"
+
+// ErrNotPaymentURI is returned when parsing a string that isn't a payment URI
+var ErrNotPaymentURI = errors.New("not a " + URIScheme + ": payment URI")
+
+// PaymentURI asks for a payment to an address, in a form a phone can scan
+// from a QR code
+type PaymentURI struct {
+	Address string
+	Amount  float64 // zero leaves the amount to the payer
+	Label   string  // who is being paid, shown to the payer
+}
+
+// String encodes the URI as homechain:ADDRESS?amount=N&label=TEXT, leaving
+// out an unset amount or label
+func (u PaymentURI) String() string {
+	q := url.Values{}
+	if u.Amount > 0 {
+		q.Set("amount", strconv.FormatFloat(u.Amount, 'f', -1, 64))
+	}
+	if u.Label != "" {
+		q.Set("label", u.Label)
+	}
+	s := URIScheme + ":" + u.Address
+	if len(q) > 0 {
+		s += "?" + q.Encode()
+	}
+	return s
+}
+
+// IsPaymentURI reports whether s looks like a payment URI rather than an
+// address or wallet name
+func IsPaymentURI(s string) bool {
+	return len(s) > len(URIScheme) && strings.EqualFold(s[:len(URIScheme)+1], URIScheme+":")
+}
+
+// ParsePaymentURI decodes a payment URI, checking its address and amount.
+// Scanners that add "//" after the scheme are accepted too. Parameters
+// other than amount and label are ignored.
+func ParsePaymentURI(s string) (PaymentURI, error) {
+	if !IsPaymentURI(s) {
+		return PaymentURI{}, ErrNotPaymentURI
+	}
+	parsed, err := url.Parse(s)
+	if err != nil {
+		return PaymentURI{}, fmt.Errorf("invalid payment URI: %w", err)
+	}
+
+	u := PaymentURI{Address: parsed.Opaque}
+	if u.Address == "" {
+		u.Address = parsed.Host // homechain://ADDRESS
+	}
+	u.Address = strings.ToLower(u.Address)
+	if !ValidAddress(u.Address) {
+		return PaymentURI{}, fmt.Errorf("invalid payment URI: %q is not an address", u.Address)
+	}
+
+	q := parsed.Query()
+	if v := q.Get("amount"); v != "" {
+		u.Amount, err = strconv.ParseFloat(v, 64)
+		if err != nil || u.Amount <= 0 || math.IsInf(u.Amount, 0) {
+			return PaymentURI{}, fmt.Errorf("invalid payment URI: bad amount %q", v)
+		}
+	}
+	u.Label = q.Get("label")
+	return u, nil
+}
+
+// ValidAddress reports whether s has the form of an address: the hex
+// SHA-256 of a public key
+func ValidAddress(s string) bool {
+	if len(s) != 64 || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
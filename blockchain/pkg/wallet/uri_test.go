@@ -0,0 +1,72 @@
+package wallet
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testAddress = "41d2a52001398c93b7b40a7508254f0fe64dd1f341a2d6642836709235bb9593"
+
+func TestPaymentURIString(t *testing.T) {
+	tests := []struct {
+		uri  PaymentURI
+		want string
+	}{
+		{PaymentURI{Address: testAddress}, "homechain:" + testAddress},
+		{PaymentURI{Address: testAddress, Amount: 2.5}, "homechain:" + testAddress + "?amount=2.5"},
+		{PaymentURI{Address: testAddress, Amount: 0.00000001}, "homechain:" + testAddress + "?amount=0.00000001"},
+		{PaymentURI{Address: testAddress, Amount: 5, Label: "Bob's café"}, "homechain:" + testAddress + "?amount=5&label=Bob%27s+caf%C3%A9"},
+	}
+	for _, tt := range tests {
+		if got := tt.uri.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestParsePaymentURI(t *testing.T) {
+	want := PaymentURI{Address: testAddress, Amount: 5, Label: "Bob's café"}
+	got, err := ParsePaymentURI(want.String())
+	if err != nil {
+		t.Fatalf("ParsePaymentURI: %v", err)
+	}
+	if got != want {
+		t.Errorf("round trip = %+v, want %+v", got, want)
+	}
+
+	// Scanners vary the case of the scheme and address, and some add "//"
+	for _, s := range []string{
+		"HOMECHAIN:" + strings.ToUpper(testAddress) + "?amount=5",
+		"homechain://" + testAddress + "?amount=5&extra=1",
+	} {
+		got, err := ParsePaymentURI(s)
+		if err != nil {
+			t.Errorf("ParsePaymentURI(%q): %v", s, err)
+			continue
+		}
+		if got.Address != testAddress || got.Amount != 5 {
+			t.Errorf("ParsePaymentURI(%q) = %+v", s, got)
+		}
+	}
+}
+
+func TestParsePaymentURIRejects(t *testing.T) {
+	for _, s := range []string{
+		"homechain:" + testAddress[:63],
+		"homechain:" + testAddress + "?amount=-1",
+		"homechain:" + testAddress + "?amount=lots",
+		"homechain:" + testAddress + "?amount=Inf",
+		"homechain:",
+	} {
+		if _, err := ParsePaymentURI(s); err == nil {
+			t.Errorf("ParsePaymentURI(%q) succeeded, want an error", s)
+		}
+	}
+
+	for _, s := range []string{testAddress, "alice", "bitcoin:" + testAddress} {
+		if _, err := ParsePaymentURI(s); !errors.Is(err, ErrNotPaymentURI) {
+			t.Errorf("ParsePaymentURI(%q) = %v, want ErrNotPaymentURI", s, err)
+		}
+	}
+}
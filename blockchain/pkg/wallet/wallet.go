@@ -8,6 +8,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"math/big"
+	"os"
 )
 
 // Wallet represents a blockchain wallet with public/private key pair
@@ -29,6 +30,22 @@ func New() (*Wallet, error) {
 	}, nil
 }
 
+// SaveToFile writes the wallet's private key to a PEM file readable only by the owner
+func (w *Wallet) SaveToFile(filename string) error {
+	data, err := w.EncodePEM()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0600)
+}
+
+// LoadFromFile loads a wallet from an unencrypted PEM file written by
+// SaveToFile. Encrypted keys fail with ErrPassphraseRequired; use
+// LoadWithPassphrase for those.
+func LoadFromFile(filename string) (*Wallet, error) {
+	return LoadWithPassphrase(filename, nil)
+}
+
 // Address returns the wallet's public address (derived from public key)
 func (w *Wallet) Address() string {
 	// In production, this would use more sophisticated address derivation
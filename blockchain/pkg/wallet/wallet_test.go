@@ -1,6 +1,8 @@
 package wallet
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -143,3 +145,53 @@ func TestPublicKeyToAddress(t *testing.T) {
 		t.Error("PublicKeyToAddress should match Address method")
 	}
 }
+
+func TestSaveAndLoadFromFile(t *testing.T) {
+	w, err := New()
+	if err != nil {
+		t.Fatalf("failed to create wallet: %v", err)
+	}
+
+	filename := filepath.Join(t.TempDir(), "wallet.pem")
+	if err := w.SaveToFile(filename); err != nil {
+		t.Fatalf("failed to save wallet: %v", err)
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("failed to stat wallet file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected file mode 0600, got %o", info.Mode().Perm())
+	}
+
+	loaded, err := LoadFromFile(filename)
+	if err != nil {
+		t.Fatalf("failed to load wallet: %v", err)
+	}
+
+	if loaded.Address() != w.Address() {
+		t.Errorf("loaded wallet address mismatch")
+	}
+
+	// Loaded key should produce signatures the original public key accepts
+	data := []byte("hello")
+	sig, err := loaded.Sign(data)
+	if err != nil {
+		t.Fatalf("failed to sign with loaded wallet: %v", err)
+	}
+	if !VerifySignature(w.PublicKey, data, sig) {
+		t.Error("signature from loaded wallet should verify with original public key")
+	}
+}
+
+func TestLoadFromFileInvalid(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "wallet.pem")
+	if err := os.WriteFile(filename, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadFromFile(filename); err == nil {
+		t.Error("expected error loading invalid wallet file")
+	}
+}
@@ -0,0 +1,124 @@
+package websocket
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// echoServer upgrades every request and echoes messages back until the client closes
+func echoServer(t *testing.T) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(messageType, data); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func TestEcho(t *testing.T) {
+	conn, err := Dial(t.Context(), echoServer(t), nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	// Cover the 7-bit, 16-bit and 64-bit payload length encodings
+	for _, size := range []int{0, 5, 125, 126, 1000, 70000} {
+		payload := bytes.Repeat([]byte("x"), size)
+		if err := conn.WriteMessage(BinaryMessage, payload); err != nil {
+			t.Fatalf("write of %d bytes failed: %v", size, err)
+		}
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read of %d bytes failed: %v", size, err)
+		}
+		if messageType != BinaryMessage || !bytes.Equal(data, payload) {
+			t.Errorf("echo of %d bytes came back as %d bytes of type %d", size, len(data), messageType)
+		}
+	}
+}
+
+func TestPingAnsweredWhileReading(t *testing.T) {
+	conn, err := Dial(t.Context(), echoServer(t), nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteMessage(PingMessage, []byte("hi"))
+	conn.WriteMessage(TextMessage, []byte("hello"))
+
+	// The server answers the ping with a pong, which ReadMessage skips
+	_, data, err := conn.ReadMessage()
+	if err != nil || string(data) != "hello" {
+		t.Errorf("expected hello after the pong, got %q, %v", data, err)
+	}
+}
+
+func TestReadLimit(t *testing.T) {
+	conn, err := Dial(t.Context(), echoServer(t), nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadLimit(10)
+	conn.WriteMessage(TextMessage, []byte("this is longer than ten bytes"))
+	if _, _, err := conn.ReadMessage(); !errors.Is(err, ErrReadLimit) {
+		t.Errorf("expected ErrReadLimit, got %v", err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	conn, err := Dial(t.Context(), echoServer(t), nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	// The server echoes our close frame back, which reads as ErrClosed
+	conn.WriteMessage(CloseMessage, nil)
+	if _, _, err := conn.ReadMessage(); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestUpgradeRejectsPlainRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Upgrade(w, r)
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for a non-upgrade request, got %d", resp.StatusCode)
+	}
+}
+
+func TestAcceptKey(t *testing.T) {
+	// Example from RFC 6455 section 1.3
+	if got := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("unexpected accept key %q", got)
+	}
+}
@@ -0,0 +1,345 @@
+package household
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/client"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+// DefaultValue is what a point is worth in coins unless set otherwise
+const DefaultValue = 0.01
+
+// Errors from a Bank
+var (
+	ErrNotFound = errors.New("not found")
+	ErrDecided  = errors.New("already decided")
+	ErrTooFew   = errors.New("not enough points")
+	ErrNode     = errors.New("the node failed")
+)
+
+// Bank pays out points from the household wallet and watches for kids
+// paying them back
+type Bank struct {
+	household *Household
+	store     *Store
+	node      *client.Client
+	wallet    *wallet.Wallet
+	value     float64
+	mu        sync.Mutex // held while paying, so balance checks count every payment
+}
+
+// New returns a Bank paying points worth value each from w through node, and
+// keeping its ledger in store
+func New(h *Household, store *Store, node *client.Client, w *wallet.Wallet, value float64) *Bank {
+	return &Bank{household: h, store: store, node: node, wallet: w, value: value}
+}
+
+// Household returns who the bank pays
+func (b *Bank) Household() *Household {
+	return b.household
+}
+
+// Address returns the household wallet's address, which pays points and
+// which kids pay to spend them
+func (b *Bank) Address() string {
+	return b.wallet.Address()
+}
+
+// Amount returns what some points are worth in coins
+func (b *Bank) Amount(points int64) float64 {
+	return float64(points) * b.value
+}
+
+// Points returns how many whole points an amount of coins is worth
+func (b *Bank) Points(amount float64) int64 {
+	// Allow for the amount not being an exact multiple in floating point
+	return int64(math.Floor(amount/b.value + 1e-6))
+}
+
+// Balance returns how many points a member's wallet holds on the chain
+func (b *Bank) Balance(ctx context.Context, m Member) (int64, error) {
+	balance, err := b.node.Balance(ctx, m.Address)
+	if err != nil {
+		return 0, err
+	}
+	return b.Points(balance), nil
+}
+
+// Claim records that a kid did a chore, for a parent to approve or reject
+func (b *Bank) Claim(kid, chore string) (Entry, error) {
+	if _, err := b.household.Kid(kid); err != nil {
+		return Entry{}, err
+	}
+	c, ok := b.household.Chore(chore)
+	if !ok {
+		return Entry{}, fmt.Errorf("%w: no chore %s", ErrNotFound, chore)
+	}
+	return b.store.add(Entry{Kind: Claim, Member: kid, Points: c.Points, For: c.Name, Status: Pending, Created: time.Now().UTC()})
+}
+
+// Approve has a parent accept a pending claim and pays its points. A payment
+// that fails is recorded on the entry and tried again by Sync.
+func (b *Bank) Approve(ctx context.Context, id int64, parent string) (Entry, error) {
+	if err := b.decide(id, parent, Paying); err != nil {
+		return Entry{}, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.pay(ctx, id)
+}
+
+// Reject has a parent turn down a pending claim
+func (b *Bank) Reject(id int64, parent string) (Entry, error) {
+	if err := b.decide(id, parent, Rejected); err != nil {
+		return Entry{}, err
+	}
+	e, _ := b.store.Entry(id)
+	return e, nil
+}
+
+// decide moves a pending claim to status on a parent's say-so
+func (b *Bank) decide(id int64, parent, status string) error {
+	var err error
+	if uerr := b.store.update(func(st *state) {
+		e := st.find(id)
+		switch {
+		case e == nil || e.Kind != Claim:
+			err = fmt.Errorf("%w: no claim %d", ErrNotFound, id)
+		case e.Status != Pending:
+			err = fmt.Errorf("%w: claim %d is %s", ErrDecided, id, e.Status)
+		default:
+			e.Status, e.By = status, parent
+		}
+	}); uerr != nil {
+		return uerr
+	}
+	return err
+}
+
+// Grant has a parent give a kid points for a reason of their own and pays them
+func (b *Bank) Grant(ctx context.Context, kid string, points int64, reason, parent string) (Entry, error) {
+	if _, err := b.household.Kid(kid); err != nil {
+		return Entry{}, err
+	}
+	if points < 1 {
+		return Entry{}, errors.New("a grant must be at least one point")
+	}
+	e, err := b.store.add(Entry{Kind: Grant, Member: kid, Points: points, For: reason, Status: Paying, Created: time.Now().UTC(), By: parent})
+	if err != nil {
+		return e, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.pay(ctx, e.ID)
+}
+
+// Redeem records that a kid wants a reward and returns the payment that
+// spends its points, for the kid to make from their own wallet. The
+// redemption is marked paid when Sync finds the payment on the chain.
+func (b *Bank) Redeem(ctx context.Context, kid, reward string) (Entry, wallet.PaymentURI, error) {
+	m, err := b.household.Kid(kid)
+	if err != nil {
+		return Entry{}, wallet.PaymentURI{}, err
+	}
+	r, ok := b.household.Reward(reward)
+	if !ok {
+		return Entry{}, wallet.PaymentURI{}, fmt.Errorf("%w: no reward %s", ErrNotFound, reward)
+	}
+	points, err := b.Balance(ctx, m)
+	if err != nil {
+		return Entry{}, wallet.PaymentURI{}, fmt.Errorf("%w: %v", ErrNode, err)
+	}
+	if points < r.Points {
+		return Entry{}, wallet.PaymentURI{}, fmt.Errorf("%w: %s has %d and %s costs %d", ErrTooFew, kid, points, reward, r.Points)
+	}
+	e, err := b.store.add(Entry{Kind: Redemption, Member: kid, Points: r.Points, For: r.Name, Status: Pending, Created: time.Now().UTC()})
+	uri := wallet.PaymentURI{Address: b.Address(), Amount: b.Amount(r.Points), Label: kid + ": " + r.Name}
+	return e, uri, err
+}
+
+// pay sends an entry's points to its kid, unless it is already on its way.
+// Callers must hold b.mu.
+func (b *Bank) pay(ctx context.Context, id int64) (Entry, error) {
+	e, ok := b.store.Entry(id)
+	if !ok || e.Status != Paying || e.TxID != "" {
+		return e, nil
+	}
+	m, ok := b.household.Member(e.Member)
+	if !ok {
+		return e, fmt.Errorf("%w: no member %s", ErrNotFound, e.Member)
+	}
+
+	txID, err := b.send(ctx, m.Address, b.Amount(e.Points))
+	if uerr := b.store.update(func(st *state) {
+		s := st.find(id)
+		if err != nil {
+			s.Error = err.Error()
+			return
+		}
+		s.TxID, s.Error = txID, ""
+	}); uerr != nil {
+		return e, uerr
+	}
+	e, _ = b.store.Entry(id)
+	if err == nil {
+		log.Printf("paying %s %d points for %s in transaction %s", e.Member, e.Points, e.For, txID)
+	}
+	return e, err
+}
+
+// send pays amount to address from the household wallet, after checking
+// its balance covers that and the payments not yet mined
+func (b *Bank) send(ctx context.Context, address string, amount float64) (string, error) {
+	balance, err := b.node.Balance(ctx, b.Address())
+	if err != nil {
+		return "", err
+	}
+	for _, e := range b.store.Entries("") {
+		if e.Status == Paying && e.TxID != "" {
+			balance -= b.Amount(e.Points)
+		}
+	}
+	if balance < amount {
+		return "", fmt.Errorf("the household wallet %s has %g, not enough to pay %g", b.Address(), max(balance, 0), amount)
+	}
+	tx := transaction.New(b.Address(), address, amount)
+	if err := tx.Sign(b.wallet.PrivateKey); err != nil {
+		return "", err
+	}
+	if _, err := b.node.SubmitTransaction(ctx, tx); err != nil {
+		return "", err
+	}
+	return tx.ID, nil
+}
+
+// Run syncs with the chain straight away and then every interval until ctx
+// is done, calling redeemed with each redemption found paid
+func (b *Bank) Run(ctx context.Context, interval time.Duration, redeemed func(Entry)) {
+	for {
+		found, err := b.Sync(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("sync failed: %v", err)
+		}
+		for _, e := range found {
+			redeemed(e)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Sync checks on the points being paid, marking those mined as paid and
+// sending again any that failed or that the node dropped, then looks for
+// kids' payments to the household wallet. Each payment settles the kid's
+// oldest pending redemption of the same points, or otherwise is recorded as
+// a redemption of its own. Sync returns the redemptions it found paid.
+func (b *Bank) Sync(ctx context.Context) ([]Entry, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, e := range b.store.Entries("") {
+		if e.Status != Paying {
+			continue
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err := b.confirm(ctx, e); err != nil {
+			log.Printf("payment of entry %d: %v", e.ID, err)
+		}
+	}
+	return b.collect(ctx)
+}
+
+// confirm checks on a payment, sending it if it has no transaction yet or
+// its transaction was dropped
+func (b *Bank) confirm(ctx context.Context, e Entry) error {
+	if e.TxID != "" {
+		info, err := b.node.Transaction(ctx, e.TxID)
+		switch {
+		case client.IsNotFound(err):
+			log.Printf("transaction %s paying entry %d was dropped; sending another", e.TxID, e.ID)
+			if err := b.store.update(func(st *state) { st.find(e.ID).TxID = "" }); err != nil {
+				return err
+			}
+		case err != nil || info.Status != "confirmed":
+			return err
+		default:
+			return b.store.update(func(st *state) {
+				s := st.find(e.ID)
+				s.Status, s.Height = Paid, info.Height
+			})
+		}
+	}
+	_, err := b.pay(ctx, e.ID)
+	return err
+}
+
+// collect records kids' payments to the household wallet mined since the
+// last look
+func (b *Bank) collect(ctx context.Context) ([]Entry, error) {
+	b.store.mu.Lock()
+	from := b.store.state.Scanned
+	b.store.mu.Unlock()
+	proven, err := b.node.Proofs(ctx, b.Address(), from)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []Entry
+	err = b.store.update(func(st *state) {
+		for _, p := range proven {
+			st.Scanned = max(st.Scanned, p.Height+1)
+			tx := p.Tx
+			if tx == nil || tx.To != b.Address() || st.paidBy(tx.ID) {
+				continue
+			}
+			m, ok := b.household.ByAddress(tx.From)
+			if !ok || m.Role != Kid {
+				continue
+			}
+			points := b.Points(tx.Amount)
+			e := st.pendingRedemption(m.Name, points)
+			if e == nil {
+				e = &Entry{ID: st.Next, Kind: Redemption, Member: m.Name, Points: points, Created: tx.Timestamp.UTC()}
+				st.Next++
+				st.Entries = append(st.Entries, e)
+			}
+			e.Status, e.TxID, e.Height = Paid, tx.ID, p.Height
+			found = append(found, *e)
+		}
+	})
+	return found, err
+}
+
+// paidBy reports whether a transaction already settled an entry
+func (st *state) paidBy(txID string) bool {
+	for _, e := range st.Entries {
+		if e.TxID == txID {
+			return true
+		}
+	}
+	return false
+}
+
+// pendingRedemption returns a kid's oldest redemption of some points still
+// waiting for payment, or nil
+func (st *state) pendingRedemption(kid string, points int64) *Entry {
+	for _, e := range st.Entries {
+		if e.Kind == Redemption && e.Status == Pending && e.Member == kid && e.Points == points {
+			return e
+		}
+	}
+	return nil
+}
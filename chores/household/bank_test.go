@@ -0,0 +1,134 @@
+package household
+
+import (
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/client"
+	"github.com/oksmith/home-server/blockchain/pkg/node"
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+// setup serves a regtest node and returns a Bank with a funded household
+// wallet paying sam, whose wallet is returned, along with the node's client
+func setup(t *testing.T) (*Bank, *wallet.Wallet, *client.Client) {
+	t.Helper()
+	n, err := node.New("localhost:9000", 1, 10.0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.EnableRegtest()
+	srv := httptest.NewServer(n.Handler())
+	t.Cleanup(srv.Close)
+	c := client.New(srv.URL)
+
+	w, _ := wallet.New()
+	if _, err := c.Faucet(t.Context(), w.Address(), 1); err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := wallet.New()
+	h := &Household{
+		Members: []Member{{Name: "alex", Role: Parent, Address: parentAddr}, {Name: "sam", Role: Kid, Address: kid.Address()}},
+		Chores:  []Chore{{Name: "dishes", Points: 5}},
+		Rewards: []Reward{{Name: "sweets", Points: 3}, {Name: "film-night", Points: 40}},
+	}
+	store, err := OpenStore(filepath.Join(t.TempDir(), "ledger.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(h, store, c, w, DefaultValue), kid, c
+}
+
+func TestClaim(t *testing.T) {
+	b, kid, c := setup(t)
+	sam, _ := b.household.Member("sam")
+
+	e, err := b.Claim("sam", "dishes")
+	if err != nil || e.Status != Pending || e.Points != 5 {
+		t.Fatalf("got %+v, %v", e, err)
+	}
+	if _, err := b.Claim("alex", "dishes"); err == nil {
+		t.Error("expected a parent's claim to be refused")
+	}
+	if _, err := b.Claim("sam", "hoovering"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected an unknown chore not to be found, got %v", err)
+	}
+
+	e, err = b.Approve(t.Context(), e.ID, "alex")
+	if err != nil || e.Status != Paying || e.TxID == "" || e.By != "alex" {
+		t.Fatalf("got %+v, %v", e, err)
+	}
+	if _, err := b.Approve(t.Context(), e.ID, "alex"); !errors.Is(err, ErrDecided) {
+		t.Errorf("expected a second approval to be refused, got %v", err)
+	}
+	c.Generate(t.Context(), 1)
+	if _, err := b.Sync(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if e, _ = b.store.Entry(e.ID); e.Status != Paid || e.Height == 0 {
+		t.Errorf("expected the payment to be mined, got %+v", e)
+	}
+	if points, err := b.Balance(t.Context(), sam); err != nil || points != 5 {
+		t.Errorf("expected sam to have 5 points, got %d, %v", points, err)
+	}
+
+	// A rejected claim pays nothing
+	e, _ = b.Claim("sam", "dishes")
+	if e, err = b.Reject(e.ID, "alex"); err != nil || e.Status != Rejected {
+		t.Errorf("got %+v, %v", e, err)
+	}
+	if _, err := b.Approve(t.Context(), e.ID, "alex"); !errors.Is(err, ErrDecided) {
+		t.Errorf("expected a rejected claim not to be approved, got %v", err)
+	}
+
+	// Spending points
+	if _, _, err := b.Redeem(t.Context(), "sam", "film-night"); !errors.Is(err, ErrTooFew) {
+		t.Errorf("expected film night to cost too much, got %v", err)
+	}
+	r, uri, err := b.Redeem(t.Context(), "sam", "sweets")
+	if err != nil || r.Status != Pending || uri.Address != b.Address() || uri.Amount != b.Amount(3) {
+		t.Fatalf("got %+v, %+v, %v", r, uri, err)
+	}
+	tx := transaction.New(kid.Address(), uri.Address, uri.Amount)
+	tx.Sign(kid.PrivateKey)
+	if _, err := c.SubmitTransaction(t.Context(), tx); err != nil {
+		t.Fatal(err)
+	}
+	c.Generate(t.Context(), 1)
+	found, err := b.Sync(t.Context())
+	if err != nil || len(found) != 1 || found[0].ID != r.ID || found[0].Status != Paid || found[0].TxID != tx.ID {
+		t.Fatalf("expected the redemption to be paid, got %+v, %v", found, err)
+	}
+	if points, _ := b.Balance(t.Context(), sam); points != 2 {
+		t.Errorf("expected sam to have 2 points left, got %d", points)
+	}
+	if found, _ := b.Sync(t.Context()); len(found) != 0 {
+		t.Errorf("expected the payment to be counted once, got %+v", found)
+	}
+}
+
+func TestGrantUnfunded(t *testing.T) {
+	b, _, c := setup(t)
+	funded := b.wallet
+	b.wallet, _ = wallet.New()
+
+	e, err := b.Grant(t.Context(), "sam", 2, "tidy room", "alex")
+	if err == nil || !strings.Contains(e.Error, "not enough") || e.TxID != "" || e.Status != Paying {
+		t.Fatalf("expected the grant to wait for funds, got %+v, %v", e, err)
+	}
+
+	// Once there is money, Sync pays it
+	b.wallet = funded
+	if _, err := b.Sync(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	c.Generate(t.Context(), 1)
+	b.Sync(t.Context())
+	if e, _ = b.store.Entry(e.ID); e.Status != Paid || e.Error != "" {
+		t.Errorf("expected the grant to be paid, got %+v", e)
+	}
+}
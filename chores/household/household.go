@@ -0,0 +1,171 @@
+// Package household runs a points system for chores on the blockchain.
+// Parents grant points for chores done, paid to each kid's own wallet from a
+// household wallet, and kids spend them on rewards by paying them back. The
+// chain has a single currency, so points are coins: each is worth a fixed
+// amount, and a kid's points are their wallet's balance in those units.
+package household
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+// Roles a member may have
+const (
+	Parent = "parent"
+	Kid    = "kid"
+)
+
+// Member is someone in the household with a wallet on the chain
+type Member struct {
+	Name    string `json:"name"`
+	Role    string `json:"role"`    // Parent or Kid
+	Address string `json:"address"` // of their wallet, which points are paid to or, for parents, which signs their requests
+}
+
+// Chore is a job worth some points
+type Chore struct {
+	Name   string `json:"name"`
+	Points int64  `json:"points"`
+}
+
+// Reward is something points can buy
+type Reward struct {
+	Name   string `json:"name"`
+	Points int64  `json:"points"`
+}
+
+// Household is who is in the household, the chores they do and what points buy
+type Household struct {
+	Members []Member `json:"members"`
+	Chores  []Chore  `json:"chores"`
+	Rewards []Reward `json:"rewards"`
+}
+
+// Parse reads and checks a household file, a JSON object such as
+//
+//	{"members": [{"name": "alex", "role": "parent", "address": "..."},
+//	             {"name": "sam", "role": "kid", "address": "..."}],
+//	 "chores": [{"name": "dishes", "points": 5}],
+//	 "rewards": [{"name": "film-night", "points": 40}]}
+//
+// Names are unique within each list and may not hold slashes or spaces, and
+// every chore and reward is worth at least one point.
+func Parse(data []byte) (*Household, error) {
+	var h Household
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	addresses := map[string]bool{}
+	kids := 0
+	for _, m := range h.Members {
+		if err := checkName("member", m.Name, names); err != nil {
+			return nil, err
+		}
+		switch m.Role {
+		case Kid:
+			kids++
+		case Parent:
+		default:
+			return nil, fmt.Errorf("member %s: role must be %s or %s", m.Name, Parent, Kid)
+		}
+		if !wallet.ValidAddress(m.Address) {
+			return nil, fmt.Errorf("member %s: %q is not a wallet address", m.Name, m.Address)
+		}
+		if addresses[m.Address] {
+			return nil, fmt.Errorf("member %s: address %s is someone else's", m.Name, m.Address)
+		}
+		addresses[m.Address] = true
+	}
+	if kids == 0 || kids == len(h.Members) {
+		return nil, fmt.Errorf("the household needs at least one %s and one %s", Parent, Kid)
+	}
+
+	names = map[string]bool{}
+	for _, c := range h.Chores {
+		if err := checkName("chore", c.Name, names); err != nil {
+			return nil, err
+		}
+		if c.Points < 1 {
+			return nil, fmt.Errorf("chore %s must be worth at least one point", c.Name)
+		}
+	}
+	names = map[string]bool{}
+	for _, r := range h.Rewards {
+		if err := checkName("reward", r.Name, names); err != nil {
+			return nil, err
+		}
+		if r.Points < 1 {
+			return nil, fmt.Errorf("reward %s must cost at least one point", r.Name)
+		}
+	}
+	return &h, nil
+}
+
+// checkName checks that a name is usable in a URL and not in seen, adding it
+func checkName(kind, name string, seen map[string]bool) error {
+	if name == "" || strings.ContainsAny(name, "/ ") {
+		return fmt.Errorf("%s %q needs a name without slashes or spaces", kind, name)
+	}
+	if seen[name] {
+		return fmt.Errorf("%s %s is listed twice", kind, name)
+	}
+	seen[name] = true
+	return nil
+}
+
+// Member returns the member with a name
+func (h *Household) Member(name string) (Member, bool) {
+	for _, m := range h.Members {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return Member{}, false
+}
+
+// ByAddress returns the member whose wallet has an address
+func (h *Household) ByAddress(address string) (Member, bool) {
+	for _, m := range h.Members {
+		if m.Address == address {
+			return m, true
+		}
+	}
+	return Member{}, false
+}
+
+// Kid returns the kid with a name
+func (h *Household) Kid(name string) (Member, error) {
+	m, ok := h.Member(name)
+	switch {
+	case !ok:
+		return m, fmt.Errorf("%w: no member %s", ErrNotFound, name)
+	case m.Role != Kid:
+		return m, fmt.Errorf("%s is not a %s", name, Kid)
+	}
+	return m, nil
+}
+
+// Chore returns the chore with a name
+func (h *Household) Chore(name string) (Chore, bool) {
+	for _, c := range h.Chores {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Chore{}, false
+}
+
+// Reward returns the reward with a name
+func (h *Household) Reward(name string) (Reward, bool) {
+	for _, r := range h.Rewards {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return Reward{}, false
+}
@@ -0,0 +1,53 @@
+package household
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	parentAddr = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	kidAddr    = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+)
+
+func TestParse(t *testing.T) {
+	h, err := Parse([]byte(`{
+		"members": [{"name": "alex", "role": "parent", "address": "` + parentAddr + `"},
+		            {"name": "sam", "role": "kid", "address": "` + kidAddr + `"}],
+		"chores": [{"name": "dishes", "points": 5}],
+		"rewards": [{"name": "film-night", "points": 40}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := h.ByAddress(kidAddr); !ok || m.Name != "sam" {
+		t.Errorf("got %+v", m)
+	}
+	if _, err := h.Kid("alex"); err == nil {
+		t.Error("expected a parent not to count as a kid")
+	}
+	if c, ok := h.Chore("dishes"); !ok || c.Points != 5 {
+		t.Errorf("got %+v", c)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	parent := `{"name": "alex", "role": "parent", "address": "` + parentAddr + `"}`
+	kid := `{"name": "sam", "role": "kid", "address": "` + kidAddr + `"}`
+	for _, tc := range []struct {
+		name, data, want string
+	}{
+		{"no kids", `{"members": [` + parent + `]}`, "at least one"},
+		{"bad role", `{"members": [` + parent + `, {"name": "sam", "role": "dog", "address": "` + kidAddr + `"}]}`, "role"},
+		{"bad address", `{"members": [` + parent + `, {"name": "sam", "role": "kid", "address": "nope"}]}`, "not a wallet address"},
+		{"shared address", `{"members": [` + parent + `, {"name": "sam", "role": "kid", "address": "` + parentAddr + `"}]}`, "someone else's"},
+		{"twice", `{"members": [` + parent + `, ` + kid + `, ` + kid + `]}`, "listed twice"},
+		{"free chore", `{"members": [` + parent + `, ` + kid + `], "chores": [{"name": "bed", "points": 0}]}`, "at least one point"},
+		{"spaced reward", `{"members": [` + parent + `, ` + kid + `], "rewards": [{"name": "ice cream", "points": 3}]}`, "without slashes"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tc.data)); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("expected an error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
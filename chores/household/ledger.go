@@ -0,0 +1,148 @@
+package household
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Kinds of entry
+const (
+	Claim      = "claim"      // a kid says they did a chore
+	Grant      = "grant"      // a parent gives points of their own accord
+	Redemption = "redemption" // a kid spends points
+)
+
+// Statuses of an entry
+const (
+	Pending  = "pending"  // a claim waiting for a parent, or a redemption waiting for the kid's payment
+	Rejected = "rejected" // a claim a parent turned down
+	Paying   = "paying"   // points being paid to the kid
+	Paid     = "paid"     // the payment is on the chain
+)
+
+// Entry is a line in the household's ledger
+type Entry struct {
+	ID      int64     `json:"id"`
+	Kind    string    `json:"kind"`
+	Member  string    `json:"member"` // the kid
+	Points  int64     `json:"points"`
+	For     string    `json:"for,omitempty"` // the chore or reward, or a parent's reason for a grant
+	Status  string    `json:"status"`
+	Created time.Time `json:"created"`
+	By      string    `json:"by,omitempty"` // the parent who approved, rejected or granted it
+	TxID    string    `json:"tx_id,omitempty"`
+	Height  int64     `json:"height,omitempty"` // of the block holding the payment, once it is mined
+	Error   string    `json:"error,omitempty"`  // why the last payment failed
+}
+
+// state is what the store saves
+type state struct {
+	Next    int64    `json:"next"`    // ID for the next entry
+	Scanned int64    `json:"scanned"` // height of the next block to look in for kids' payments
+	Entries []*Entry `json:"entries"`
+}
+
+// Store keeps the ledger in a JSON file
+type Store struct {
+	filename string
+	state    state
+	mu       sync.Mutex
+}
+
+// OpenStore loads the ledger saved in filename, if there is one
+func OpenStore(filename string) (*Store, error) {
+	s := &Store{filename: filename, state: state{Next: 1}}
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.state); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Entries returns the ledger, newest first, only for member if it is set
+func (s *Store) Entries(member string) []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := []Entry{}
+	for _, e := range slices.Backward(s.state.Entries) {
+		if member == "" || e.Member == member {
+			list = append(list, *e)
+		}
+	}
+	return list
+}
+
+// Entry returns the entry with an ID
+func (s *Store) Entry(id int64) (Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e := s.state.find(id); e != nil {
+		return *e, true
+	}
+	return Entry{}, false
+}
+
+// find returns the entry with an ID, or nil
+func (st *state) find(id int64) *Entry {
+	for _, e := range st.Entries {
+		if e.ID == id {
+			return e
+		}
+	}
+	return nil
+}
+
+// add gives e the next ID and saves it
+func (s *Store) add(e Entry) (Entry, error) {
+	err := s.update(func(st *state) {
+		e.ID = st.Next
+		st.Next++
+		st.Entries = append(st.Entries, &e)
+	})
+	return e, err
+}
+
+// update changes the store and saves it
+func (s *Store) update(change func(*state)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	change(&s.state)
+	return s.save()
+}
+
+// save writes the store via a temporary file so a crash never leaves it half
+// written. Callers must hold the lock.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.filename), ".ledger-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.filename)
+}
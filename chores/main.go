@@ -0,0 +1,389 @@
+// Command chores runs the household's points for chores on the blockchain.
+// Kids say when they have done a chore, parents approve it and its points are
+// paid to the kid's own wallet from a household wallet; kids spend points on
+// rewards by paying them back from their wallet, for instance with bchain tx
+// send.
+//
+// HOUSEHOLD_FILE lists the members, each a parent or a kid with a wallet
+// address, the chores with what they are worth and the rewards with what they
+// cost; see household.Parse for the format. Kids' wallets can be made with
+// bchain wallet new. The chain has a single currency, so a point is
+// POINT_VALUE coins (default 0.01) and a kid's points are their wallet's
+// balance in those units. HOUSEHOLD_WALLET is the wallet key file that pays
+// them, encrypted with HOUSEHOLD_WALLET_PASSPHRASE or not, and needs a balance
+// on the chain; payments wait, retried every SYNC_INTERVAL (default 30s),
+// until it has one. NODE_URL is the node to send them to (default
+// http://localhost:8080). The ledger of claims, grants and redemptions is kept
+// in LEDGER_FILE (default chores-ledger.json beside HOUSEHOLD_FILE).
+//
+// GET / serves a page for all of this. GET /api/v1/household gives the
+// members with each kid's points, the chores and the rewards, and GET
+// /api/v1/entries the ledger, newest first, only for ?member=NAME if given.
+// POST /api/v1/chores/CHORE/done?member=NAME claims a chore for a kid.
+// POST /api/v1/rewards/REWARD/redeem?member=NAME answers with the payment
+// URI that spends the reward's points; the redemption is marked paid once
+// that payment is mined. Any payment a kid makes to the household wallet is
+// recorded as a redemption, matched to one they asked for if its points are
+// the same.
+//
+// Parents approve or reject a claim with POST /api/v1/entries/ID/approve or
+// reject, and give points for anything else with POST /api/v1/grants and a
+// JSON body {"member": NAME, "points": N, "reason": TEXT}. These need a
+// request signed by a parent's wallet key, listed in AUTHORIZED_KEYS (bchain
+// key authorize prints the line), or PARENT_TOKEN as a bearer token, naming
+// the parent with ?parent=NAME. Without either they are refused.
+//
+// NOTIFY_URL, the address of notify-service, has it tell parents when a
+// chore is claimed, as event chore_claimed, and when a reward is paid for, as
+// event reward_redeemed. NOTIFY_TOKEN is the hub's token.
+//
+// Otherwise it serves as package httpserver describes, on LISTEN_ADDR
+// (default :8100) with CHORES_TOKEN as its token, and registers with the
+// gateway as chores by default. PARENT_TOKEN reloads without a restart too.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/oksmith/home-server/blockchain/pkg/client"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+	"github.com/oksmith/home-server/chores/household"
+	"github.com/oksmith/home-server/pkg/config"
+	"github.com/oksmith/home-server/pkg/httpserver"
+	"github.com/oksmith/home-server/pkg/notify"
+	"github.com/oksmith/home-server/pkg/registry"
+	"github.com/oksmith/home-server/pkg/sigauth"
+)
+
+// settings are the service's settings
+var settings = []config.Field{
+	{Name: "HOUSEHOLD_FILE", Required: true},
+	{Name: "LEDGER_FILE"},
+	{Name: "HOUSEHOLD_WALLET", Required: true},
+	{Name: "HOUSEHOLD_WALLET_PASSPHRASE", Secret: true},
+	{Name: "POINT_VALUE", Default: "0.01", Check: config.NumberBetween(0.000001, 1000)},
+	{Name: "NODE_URL", Default: "http://localhost:8080", Check: config.HTTPURL},
+	{Name: "SYNC_INTERVAL", Default: "30s", Check: config.PositiveDuration},
+	{Name: "LISTEN_ADDR", Default: ":8100", Check: config.HostPort},
+	{Name: "CHORES_TOKEN", Secret: true, Reload: true},
+	{Name: "PARENT_TOKEN", Secret: true, Reload: true},
+	{Name: "NOTIFY_URL", Check: config.HTTPURL},
+	{Name: "NOTIFY_TOKEN", Secret: true, Reload: true},
+	{Name: "TLS_CERT"},
+	{Name: "TLS_KEY"},
+	{Name: "GATEWAY_URL", Check: config.HTTPURL},
+	{Name: "GATEWAY_REGISTRY_TOKEN", Secret: true},
+	{Name: "GATEWAY_NAME", Default: "chores"},
+	{Name: "GATEWAY_SERVICE_URL", Check: config.HTTPURL},
+	{Name: "AUTHORIZED_KEYS"},
+	{Name: "SERVICE_KEY"},
+}
+
+// maxGrant bounds the body of a grant request
+const maxGrant = 4 << 10
+
+// parentHandler handles a request made by the named parent
+type parentHandler func(w http.ResponseWriter, r *http.Request, parent string)
+
+// requireParent wraps a handler so it only runs for requests signed with the
+// wallet key of a parent in the household, or carrying the parent token and
+// naming a parent with ?parent. Unlike httpserver.RequireAuth, it refuses
+// everything while neither is set up.
+func requireParent(token func() string, keys *sigauth.Keyring, h *household.Household, g *httpserver.Guard, next parentHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if sigauth.Signed(r) {
+			key, err := keys.Verify(r)
+			if err != nil {
+				g.Failed(r)
+				http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+				return
+			}
+			g.Succeeded(r)
+			m, ok := h.ByAddress(key.ID)
+			if !ok || m.Role != household.Parent {
+				http.Error(w, fmt.Sprintf("Key %s is not a parent's wallet", key.Name), http.StatusForbidden)
+				return
+			}
+			next(w, r, m.Name)
+			return
+		}
+		got, ok := httpserver.BearerToken(r)
+		if want := token(); !ok || want == "" || !httpserver.TokenMatches(got, want) {
+			if r.Header.Get("Authorization") != "" {
+				g.Failed(r)
+			}
+			http.Error(w, "Only parents may do that, with PARENT_TOKEN or a signed request", http.StatusForbidden)
+			return
+		}
+		g.Succeeded(r)
+		name := r.URL.Query().Get("parent")
+		if m, ok := h.Member(name); !ok || m.Role != household.Parent {
+			http.Error(w, "parent must name a parent in the household", http.StatusBadRequest)
+			return
+		}
+		next(w, r, name)
+	}
+}
+
+// writeError sends the status that suits an error from the bank
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, household.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, household.ErrDecided):
+		status = http.StatusConflict
+	case errors.Is(err, household.ErrTooFew):
+		status = http.StatusUnprocessableEntity
+	case errors.Is(err, household.ErrNode):
+		status = http.StatusBadGateway
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// member is a member of the household as the API shows them
+type member struct {
+	household.Member
+	Points *int64 `json:"points,omitempty"` // a kid's, unless the node couldn't say
+	Error  string `json:"error,omitempty"`
+}
+
+// householdHandler gives the household with each kid's points
+func householdHandler(bank *household.Bank, value float64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h := bank.Household()
+		members := make([]member, 0, len(h.Members))
+		for _, m := range h.Members {
+			mm := member{Member: m}
+			if m.Role == household.Kid {
+				if points, err := bank.Balance(r.Context(), m); err != nil {
+					mm.Error = err.Error()
+				} else {
+					mm.Points = &points
+				}
+			}
+			members = append(members, mm)
+		}
+		httpserver.WriteJSON(w, http.StatusOK, map[string]any{
+			"wallet": bank.Address(), "point_value": value,
+			"members": members, "chores": h.Chores, "rewards": h.Rewards,
+		})
+	}
+}
+
+// claimHandler records that a kid did a chore and tells the parents
+func claimHandler(bank *household.Bank, events *notify.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		e, err := bank.Claim(r.URL.Query().Get("member"), r.PathValue("chore"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		log.Printf("%s did %s", e.Member, e.For)
+		events.Send(notify.Message{Event: "chore_claimed",
+			Title: fmt.Sprintf("%s did %s", e.Member, e.For),
+			Text:  fmt.Sprintf("Approve claim %d to pay %d points.", e.ID, e.Points),
+			Fields: map[string]string{"member": e.Member, "chore": e.For,
+				"points": strconv.FormatInt(e.Points, 10), "id": strconv.FormatInt(e.ID, 10)}})
+		httpserver.WriteJSON(w, http.StatusCreated, e)
+	}
+}
+
+// decideHandler approves or rejects a claim
+func decideHandler(bank *household.Bank, approve bool) parentHandler {
+	return func(w http.ResponseWriter, r *http.Request, parent string) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid entry ID", http.StatusBadRequest)
+			return
+		}
+		var e household.Entry
+		verb := "approved"
+		if approve {
+			e, err = bank.Approve(r.Context(), id, parent)
+		} else {
+			e, err = bank.Reject(id, parent)
+			verb = "rejected"
+		}
+		switch {
+		case err == nil:
+			log.Printf("%s %s claim %d", parent, verb, id)
+			httpserver.WriteJSON(w, http.StatusOK, e)
+		case e.ID != 0:
+			// Approved, but the payment failed and will be tried again
+			httpserver.WriteJSON(w, http.StatusAccepted, e)
+		default:
+			writeError(w, err)
+		}
+	}
+}
+
+// grantHandler has a parent give a kid points
+func grantHandler(bank *household.Bank) parentHandler {
+	return func(w http.ResponseWriter, r *http.Request, parent string) {
+		var req struct {
+			Member string `json:"member"`
+			Points int64  `json:"points"`
+			Reason string `json:"reason"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGrant)).Decode(&req); err != nil {
+			http.Error(w, "invalid grant: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		e, err := bank.Grant(r.Context(), req.Member, req.Points, req.Reason, parent)
+		switch {
+		case err == nil:
+			log.Printf("%s granted %s %d points", parent, e.Member, e.Points)
+			httpserver.WriteJSON(w, http.StatusCreated, e)
+		case e.ID != 0:
+			httpserver.WriteJSON(w, http.StatusAccepted, e)
+		default:
+			writeError(w, err)
+		}
+	}
+}
+
+// redeemHandler answers with the payment that spends a reward's points
+func redeemHandler(bank *household.Bank) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		e, uri, err := bank.Redeem(r.Context(), r.URL.Query().Get("member"), r.PathValue("reward"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		httpserver.WriteJSON(w, http.StatusCreated, map[string]any{"entry": e, "uri": uri.String(), "address": uri.Address, "amount": uri.Amount})
+	}
+}
+
+// reportRedeemed logs a paid redemption and tells the parents
+func reportRedeemed(events *notify.Client) func(household.Entry) {
+	return func(e household.Entry) {
+		title := fmt.Sprintf("%s spent %d points", e.Member, e.Points)
+		if e.For != "" {
+			title = fmt.Sprintf("%s spent %d points on %s", e.Member, e.Points, e.For)
+		}
+		log.Print(title)
+		events.Send(notify.Message{Event: "reward_redeemed", Title: title,
+			Fields: map[string]string{"member": e.Member, "reward": e.For,
+				"points": strconv.FormatInt(e.Points, 10), "tx_id": e.TxID}})
+	}
+}
+
+func main() {
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"), settings...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	householdFile := cfg.Get("HOUSEHOLD_FILE")
+	data, err := os.ReadFile(householdFile)
+	if err != nil {
+		log.Fatalf("HOUSEHOLD_FILE: %v", err)
+	}
+	h, err := household.Parse(data)
+	if err != nil {
+		log.Fatalf("HOUSEHOLD_FILE: %v", err)
+	}
+	ledgerFile := cfg.Get("LEDGER_FILE")
+	if ledgerFile == "" {
+		ledgerFile = filepath.Join(filepath.Dir(householdFile), "chores-ledger.json")
+	}
+	store, err := household.OpenStore(ledgerFile)
+	if err != nil {
+		log.Fatalf("LEDGER_FILE: %v", err)
+	}
+	w, err := wallet.LoadWithPassphrase(cfg.Get("HOUSEHOLD_WALLET"), []byte(cfg.Get("HOUSEHOLD_WALLET_PASSPHRASE")))
+	if err != nil {
+		log.Fatalf("HOUSEHOLD_WALLET: %v", err)
+	}
+	if _, ok := h.ByAddress(w.Address()); ok {
+		log.Fatal("HOUSEHOLD_WALLET must not be a member's own wallet")
+	}
+	value := cfg.Float("POINT_VALUE")
+	bank := household.New(h, store, client.New(cfg.Get("NODE_URL")), w, value)
+	addr := cfg.Get("LISTEN_ADDR")
+
+	keys, err := sigauth.LoadKeyring(cfg.Get("AUTHORIZED_KEYS"))
+	if err != nil {
+		log.Fatalf("AUTHORIZED_KEYS: %v", err)
+	}
+	signer, err := sigauth.LoadSigner(cfg.Get("SERVICE_KEY"))
+	if err != nil {
+		log.Fatalf("SERVICE_KEY: %v", err)
+	}
+	events := notify.NewClient(cfg.Get("NOTIFY_URL"), "chores", func() string { return cfg.Get("NOTIFY_TOKEN") }, signer)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go cfg.Watch(ctx, config.DefaultPoll)
+	go bank.Run(ctx, cfg.Duration("SYNC_INTERVAL"), reportRedeemed(events))
+	log.Printf("paying points worth %g from wallet %s through %s", value, bank.Address(), cfg.Get("NODE_URL"))
+
+	token := func() string { return cfg.Get("CHORES_TOKEN") }
+	parentToken := func() string { return cfg.Get("PARENT_TOKEN") }
+	g := httpserver.NewGuard(httpserver.DefaultLimits)
+	auth := func(next http.HandlerFunc) http.Handler {
+		return httpserver.RequireAuth("chores", token, keys, g, next)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.Handle("GET /{$}", auth(uiHandler))
+	mux.Handle("GET /api/v1/household", auth(householdHandler(bank, value)))
+	mux.Handle("GET /api/v1/entries", auth(func(w http.ResponseWriter, r *http.Request) {
+		httpserver.WriteJSON(w, http.StatusOK, store.Entries(r.URL.Query().Get("member")))
+	}))
+	mux.Handle("POST /api/v1/chores/{chore}/done", auth(claimHandler(bank, events)))
+	mux.Handle("POST /api/v1/rewards/{reward}/redeem", auth(redeemHandler(bank)))
+	mux.HandleFunc("POST /api/v1/entries/{id}/approve", requireParent(parentToken, keys, h, g, decideHandler(bank, true)))
+	mux.HandleFunc("POST /api/v1/entries/{id}/reject", requireParent(parentToken, keys, h, g, decideHandler(bank, false)))
+	mux.HandleFunc("POST /api/v1/grants", requireParent(parentToken, keys, h, g, grantHandler(bank)))
+	metrics := httpserver.NewMetrics()
+	server := &http.Server{Addr: addr, Handler: g.Middleware(httpserver.InstrumentMux(metrics, slog.Default(), mux))}
+
+	certFile, keyFile := cfg.Get("TLS_CERT"), cfg.Get("TLS_KEY")
+	switch {
+	case certFile == "" && keyFile == "":
+		log.Printf("chores starting on %s", addr)
+	case certFile == "" || keyFile == "":
+		log.Fatal("TLS_CERT and TLS_KEY must be set together")
+	default:
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		log.Printf("chores starting on %s with TLS", addr)
+	}
+
+	var withdrawn chan struct{}
+	if gateway := cfg.Get("GATEWAY_URL"); gateway != "" {
+		s, err := registry.Local(cfg.Get("GATEWAY_NAME"), cfg.Get("GATEWAY_SERVICE_URL"), addr, server.TLSConfig != nil)
+		if err != nil {
+			log.Fatalf("GATEWAY_URL: %v", err)
+		}
+		withdrawn = make(chan struct{})
+		go func() {
+			registry.Announce(ctx, gateway, cfg.Get("GATEWAY_REGISTRY_TOKEN"), signer, func() registry.Service {
+				s.Token = token()
+				return s
+			}, registry.DefaultTTL/3)
+			close(withdrawn)
+		}()
+	}
+	if err := httpserver.ListenAndServe(ctx, server, certFile, keyFile); err != nil {
+		log.Fatal(err)
+	}
+	if withdrawn != nil {
+		<-withdrawn
+	}
+	log.Println("chores stopped")
+}
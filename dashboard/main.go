@@ -0,0 +1,187 @@
+// Command dashboard shows the home server at a glance in a browser: the
+// blockchain node's height, peers, mining and sync state, its mempool and
+// the balances of its own wallet and those in WALLETS, the host's CPU,
+// memory, disks, temperatures and network from metrics-service, and
+// shutdown-service's pending action, UPS and battery. The page refreshes
+// itself every REFRESH (default 10s).
+//
+// NODE_URL (such as http://localhost:8080), METRICS_URL (such as
+// http://localhost:9101) and POWER_URL (such as http://localhost:8080) say
+// where each service is; any left unset is left off the page. METRICS_TOKEN
+// and POWER_TOKEN are sent to them if set, and shutdown-service needs one:
+// any token can read its /status, so one with no scopes will do. With
+// GATEWAY_URL set instead, each service defaults to the gateway's
+// /blockchain, /host and /power, called with GATEWAY_TOKEN. WALLETS is a
+// comma-separated list of addresses, each optionally named as NAME=ADDRESS.
+//
+// GET / serves the page and GET /api/v1/summary everything on it as JSON,
+// read from every service at once and reused for 2 seconds. A service that
+// doesn't answer within 5 seconds shows its error without holding up the
+// rest.
+//
+// Otherwise it serves as package httpserver describes, on LISTEN_ADDR
+// (default :8090) so it can be opened from anywhere on the LAN, and
+// registers with the gateway as dashboard by default. With DASHBOARD_TOKEN
+// set, the browser asks for a login: any user name, with the token as the
+// password. With SERVICE_KEY set, the services and the gateway can trust the
+// dashboard's key instead of handing it their tokens.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/oksmith/home-server/pkg/config"
+	"github.com/oksmith/home-server/pkg/httpserver"
+	"github.com/oksmith/home-server/pkg/registry"
+	"github.com/oksmith/home-server/pkg/sigauth"
+)
+
+// settings are the dashboard's settings
+var settings = []config.Field{
+	{Name: "NODE_URL", Check: config.HTTPURL},
+	{Name: "METRICS_URL", Check: config.HTTPURL},
+	{Name: "METRICS_TOKEN", Secret: true, Reload: true},
+	{Name: "POWER_URL", Check: config.HTTPURL},
+	{Name: "POWER_TOKEN", Secret: true, Reload: true},
+	{Name: "GATEWAY_URL", Check: config.HTTPURL},
+	{Name: "GATEWAY_TOKEN", Secret: true, Reload: true},
+	{Name: "WALLETS"},
+	{Name: "REFRESH", Default: "10s", Check: minDuration(time.Second)},
+	{Name: "LISTEN_ADDR", Default: ":8090", Check: config.HostPort},
+	{Name: "DASHBOARD_TOKEN", Secret: true, Reload: true},
+	{Name: "TLS_CERT"},
+	{Name: "TLS_KEY"},
+	{Name: "GATEWAY_REGISTRY_TOKEN", Secret: true},
+	{Name: "GATEWAY_NAME", Default: "dashboard"},
+	{Name: "GATEWAY_SERVICE_URL", Check: config.HTTPURL},
+	{Name: "AUTHORIZED_KEYS"},
+	{Name: "SERVICE_KEY"},
+}
+
+// minDuration checks for a duration of at least min
+func minDuration(min time.Duration) func(string) error {
+	return func(s string) error {
+		if d, err := time.ParseDuration(s); err != nil || d < min {
+			return fmt.Errorf("must be a duration of at least %s, such as 10s, not %q", min, s)
+		}
+		return nil
+	}
+}
+
+// newSource returns the service at the URL in the urlSetting, or under prefix
+// at the gateway, with the token in tokenSetting, if it has one, or the
+// gateway's. It is nil if neither is set.
+func newSource(cfg *config.Config, urlSetting, tokenSetting, prefix string) *source {
+	if u := cfg.Get(urlSetting); u != "" {
+		s := &source{url: u, token: func() string { return "" }}
+		if tokenSetting != "" {
+			s.token = func() string { return cfg.Get(tokenSetting) }
+		}
+		return s
+	}
+	if gateway := cfg.Get("GATEWAY_URL"); gateway != "" {
+		return &source{url: strings.TrimSuffix(gateway, "/") + prefix, token: func() string { return cfg.Get("GATEWAY_TOKEN") }}
+	}
+	return nil
+}
+
+func main() {
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"), settings...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	d := &dashboard{
+		node:    newSource(cfg, "NODE_URL", "", "/blockchain"),
+		host:    newSource(cfg, "METRICS_URL", "METRICS_TOKEN", "/host"),
+		power:   newSource(cfg, "POWER_URL", "POWER_TOKEN", "/power"),
+		wallets: parseWallets(cfg.Get("WALLETS")),
+		refresh: cfg.Duration("REFRESH"),
+	}
+	for _, service := range []struct {
+		name string
+		src  *source
+	}{{"node", d.node}, {"metrics-service", d.host}, {"shutdown-service", d.power}} {
+		if service.src != nil {
+			log.Printf("showing %s from %s", service.name, service.src.url)
+		}
+	}
+	addr := cfg.Get("LISTEN_ADDR")
+
+	keys, err := sigauth.LoadKeyring(cfg.Get("AUTHORIZED_KEYS"))
+	if err != nil {
+		log.Fatalf("AUTHORIZED_KEYS: %v", err)
+	}
+	signer, err := sigauth.LoadSigner(cfg.Get("SERVICE_KEY"))
+	if err != nil {
+		log.Fatalf("SERVICE_KEY: %v", err)
+	}
+	client.Transport = signer.Transport(nil)
+
+	token := func() string { return cfg.Get("DASHBOARD_TOKEN") }
+	g := httpserver.NewGuard(httpserver.DefaultLimits)
+	auth := func(next http.HandlerFunc) http.Handler {
+		return httpserver.RequireAuth("dashboard", token, keys, g, next)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.Handle("GET /{$}", auth(uiHandler))
+	mux.Handle("GET /api/v1/summary", auth(func(w http.ResponseWriter, r *http.Request) {
+		// Others may be waiting on the same summary, so finish it even if
+		// this client goes away
+		ctx := context.WithoutCancel(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(d.summary(ctx))
+	}))
+	metrics := httpserver.NewMetrics()
+	server := &http.Server{Addr: addr, Handler: g.Middleware(httpserver.InstrumentMux(metrics, slog.Default(), mux))}
+
+	certFile, keyFile := cfg.Get("TLS_CERT"), cfg.Get("TLS_KEY")
+	switch {
+	case certFile == "" && keyFile == "":
+		log.Printf("dashboard starting on %s", addr)
+	case certFile == "" || keyFile == "":
+		log.Fatal("TLS_CERT and TLS_KEY must be set together")
+	default:
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		log.Printf("dashboard starting on %s with TLS", addr)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go cfg.Watch(ctx, config.DefaultPoll)
+	var withdrawn chan struct{}
+	if gateway, registryToken := cfg.Get("GATEWAY_URL"), cfg.Get("GATEWAY_REGISTRY_TOKEN"); gateway != "" && (registryToken != "" || signer != nil) {
+		s, err := registry.Local(cfg.Get("GATEWAY_NAME"), cfg.Get("GATEWAY_SERVICE_URL"), addr, server.TLSConfig != nil)
+		if err != nil {
+			log.Fatalf("GATEWAY_URL: %v", err)
+		}
+		withdrawn = make(chan struct{})
+		go func() {
+			registry.Announce(ctx, gateway, registryToken, signer, func() registry.Service {
+				s.Token = token()
+				return s
+			}, registry.DefaultTTL/3)
+			close(withdrawn)
+		}()
+	}
+	if err := httpserver.ListenAndServe(ctx, server, certFile, keyFile); err != nil {
+		log.Fatal(err)
+	}
+	if withdrawn != nil {
+		<-withdrawn
+	}
+	log.Println("dashboard stopped")
+}
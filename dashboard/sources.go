@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fetchTimeout bounds each request to a service
+const fetchTimeout = 5 * time.Second
+
+// cacheFor is how long a summary is reused, so open tabs don't multiply the
+// load on the services
+const cacheFor = 2 * time.Second
+
+// mempoolShown is how many pending transactions the dashboard lists
+const mempoolShown = 10
+
+// source is a service the dashboard reads, at a base URL and with a bearer
+// token if it needs one, which may change while running
+type source struct {
+	url   string
+	token func() string
+}
+
+var client = &http.Client{Timeout: fetchTimeout}
+
+// get fetches path from the source as raw JSON
+func (s *source) get(ctx context.Context, path string) (json.RawMessage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(s.url, "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := s.token(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if !json.Valid(body) {
+		return nil, fmt.Errorf("%s didn't answer with JSON", path)
+	}
+	return body, nil
+}
+
+// wallet is an address whose balance is shown
+type wallet struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+// balance is a wallet's balance, or why it couldn't be read
+type balance struct {
+	wallet
+	Balance *float64 `json:"balance,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// nodeSummary is what the dashboard shows of the blockchain node
+type nodeSummary struct {
+	Error    string          `json:"error,omitempty"`
+	Status   json.RawMessage `json:"status,omitempty"`
+	Mempool  json.RawMessage `json:"mempool,omitempty"`
+	Balances []balance       `json:"balances"`
+}
+
+// serviceSummary is one response from another service, or why there isn't one
+type serviceSummary struct {
+	Error string          `json:"error,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// summary is everything on the dashboard. Services that aren't configured
+// are left out.
+type summary struct {
+	Time           time.Time       `json:"time"`
+	RefreshSeconds float64         `json:"refresh_seconds"`
+	Node           *nodeSummary    `json:"node,omitempty"`
+	Host           *serviceSummary `json:"host,omitempty"`
+	Power          *serviceSummary `json:"power,omitempty"`
+}
+
+// dashboard gathers summaries from the services it is configured with
+type dashboard struct {
+	node, host, power *source
+	wallets           []wallet
+	refresh           time.Duration
+
+	mu      sync.Mutex
+	cached  summary
+	expires time.Time
+}
+
+// summary returns a recent summary, asking every service at once if the
+// cached one is too old
+func (d *dashboard) summary(ctx context.Context) summary {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	if now.Before(d.expires) {
+		return d.cached
+	}
+
+	s := summary{Time: now, RefreshSeconds: d.refresh.Seconds()}
+	var wg sync.WaitGroup
+	if d.node != nil {
+		s.Node = &nodeSummary{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.readNode(ctx, s.Node)
+		}()
+	}
+	read := func(src *source, path string) *serviceSummary {
+		if src == nil {
+			return nil
+		}
+		out := &serviceSummary{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := src.get(ctx, path)
+			out.Data = data
+			if err != nil {
+				out.Error = err.Error()
+			}
+		}()
+		return out
+	}
+	s.Host = read(d.host, "/api/v1/metrics")
+	s.Power = read(d.power, "/status")
+	wg.Wait()
+
+	d.cached, d.expires = s, now.Add(cacheFor)
+	return s
+}
+
+// readNode reads the node's status, mempool and the wallets' balances,
+// including the node's own wallet
+func (d *dashboard) readNode(ctx context.Context, out *nodeSummary) {
+	status, err := d.node.get(ctx, "/api/v1/status")
+	if err != nil {
+		out.Error = err.Error()
+		return
+	}
+	out.Status = status
+	if out.Mempool, err = d.node.get(ctx, fmt.Sprintf("/api/v1/mempool?limit=%d", mempoolShown)); err != nil {
+		out.Error = "mempool: " + err.Error()
+	}
+
+	wallets := d.wallets
+	var own struct {
+		WalletAddress string `json:"wallet_address"`
+	}
+	if json.Unmarshal(status, &own) == nil && own.WalletAddress != "" {
+		wallets = append([]wallet{{Name: "node", Address: own.WalletAddress}}, wallets...)
+	}
+	out.Balances = make([]balance, len(wallets))
+	var wg sync.WaitGroup
+	for i, w := range wallets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b := balance{wallet: w}
+			data, err := d.node.get(ctx, "/api/v1/balance?address="+url.QueryEscape(w.Address))
+			var resp struct {
+				Balance float64 `json:"balance"`
+			}
+			if err == nil {
+				err = json.Unmarshal(data, &resp)
+			}
+			if err != nil {
+				b.Error = err.Error()
+			} else {
+				b.Balance = &resp.Balance
+			}
+			out.Balances[i] = b
+		}()
+	}
+	wg.Wait()
+}
+
+// parseWallets reads WALLETS, a comma-separated list of addresses, each
+// optionally named as NAME=ADDRESS
+func parseWallets(s string) []wallet {
+	var wallets []wallet
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, address, ok := strings.Cut(entry, "=")
+		if !ok {
+			address = name
+			name = address[:min(8, len(address))]
+		}
+		wallets = append(wallets, wallet{Name: strings.TrimSpace(name), Address: strings.TrimSpace(address)})
+	}
+	return wallets
+}
@@ -0,0 +1,66 @@
+package e2e
+
+import (
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+func TestSyncMinePay(t *testing.T) {
+	a, b := StartNode(t), StartNode(t)
+	if _, err := a.Client.Generate(t.Context(), 5); err != nil {
+		t.Fatal(err)
+	}
+
+	// A node joining late catches up with the longer chain
+	b.AddPeer(a.Address)
+	a.AddPeer(b.Address)
+	if err := b.SyncWithPeers(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if b.Height() != 5 || b.Tip() != a.Tip() {
+		t.Fatalf("expected b to sync to a's tip at 5, got %d", b.Height())
+	}
+
+	// Blocks mined on one are relayed to the other
+	alice, _ := wallet.New()
+	bob, _ := wallet.New()
+	if _, err := a.Client.Faucet(t.Context(), alice.Address(), 20); err != nil {
+		t.Fatal(err)
+	}
+	Eventually(t, "b to follow a's faucet block", func() bool { return b.Tip() == a.Tip() })
+
+	// A payment sent to b is relayed to a, which mines it
+	tx := transaction.New(alice.Address(), bob.Address(), 7)
+	if err := tx.Sign(alice.PrivateKey); err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := b.Client.SubmitTransaction(t.Context(), tx); err != nil || !resp.Accepted {
+		t.Fatalf("got %+v, %v", resp, err)
+	}
+	Eventually(t, "the payment to reach a", func() bool {
+		_, ok := a.Mempool.Get(tx.ID)
+		return ok
+	})
+	if _, err := a.Client.Generate(t.Context(), 1); err != nil {
+		t.Fatal(err)
+	}
+	Eventually(t, "b to follow a's block", func() bool { return b.Tip() == a.Tip() })
+
+	info, err := b.Client.Transaction(t.Context(), tx.ID)
+	if err != nil || info.Status != "confirmed" || info.BlockHash != a.Tip() {
+		t.Errorf("expected the payment confirmed in a's latest block, got %+v, %v", info, err)
+	}
+	if _, ok := b.Mempool.Get(tx.ID); ok {
+		t.Error("expected the mined payment to leave b's mempool")
+	}
+	for _, n := range []*Node{a, b} {
+		if got, err := n.Client.Balance(t.Context(), bob.Address()); err != nil || got != 7 {
+			t.Errorf("expected bob to have 7, got %v, %v", got, err)
+		}
+		if got, err := n.Client.Balance(t.Context(), alice.Address()); err != nil || got != 13 {
+			t.Errorf("expected alice to have 13, got %v, %v", got, err)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+module github.com/oksmith/home-server/e2e
+
+go 1.24.5
+
+require (
+	github.com/oksmith/home-server/blockchain v0.0.0
+	github.com/oksmith/home-server/pkg v0.0.0
+)
+
+replace (
+	github.com/oksmith/home-server/blockchain => ../blockchain
+	github.com/oksmith/home-server/pkg => ../pkg
+)
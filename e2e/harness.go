@@ -0,0 +1,390 @@
+// Package e2e runs the home-server's nodes and services together and checks
+// what they do to each other: nodes syncing, mining and relaying payments,
+// and services paying, anchoring, scheduling and powering off through them,
+// with their notifications arriving where notify-service sends them. Its
+// tests are run with
+//
+//	go test ./e2e/...
+//
+// from the top of the repository, and skipped under -short.
+//
+// Nodes run in the test process, in regtest mode, each on a local port of
+// its own. Services run as their real binaries, built from the repository
+// on first use and kept until the tests finish, each listening on a free
+// local port with only the settings the test gives it, so nothing from the
+// machine's own configuration leaks in. Power actions are only ever dry
+// runs on the fake backend. A failing test logs the output of every service
+// it started.
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oksmith/home-server/blockchain/pkg/client"
+	"github.com/oksmith/home-server/blockchain/pkg/node"
+	"github.com/oksmith/home-server/pkg/notify"
+)
+
+// Timeouts for things happening across services
+const (
+	// StartTimeout is how long a service has to answer /healthz
+	StartTimeout = 30 * time.Second
+	// WaitTimeout is how long Eventually waits
+	WaitTimeout = 15 * time.Second
+	// stopTimeout is how long a service has to exit after SIGINT
+	stopTimeout = 10 * time.Second
+)
+
+// skipShort skips a test run with -short, as starting services takes a while
+func skipShort(t testing.TB) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("end-to-end tests are skipped with -short")
+	}
+}
+
+// Node is a regtest node served by the test
+type Node struct {
+	*node.Node
+	URL    string
+	Client *client.Client
+}
+
+// StartNode starts a regtest node at difficulty 1 on a local port, stopped
+// when the test ends
+func StartNode(t testing.TB) *Node {
+	t.Helper()
+	skipShort(t)
+	srv := httptest.NewUnstartedServer(nil)
+	n, err := node.New(srv.Listener.Addr().String(), 1, 10.0)
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	if err := n.EnableRegtest(); err != nil {
+		t.Fatal(err)
+	}
+	srv.Config.Handler = n.Handler()
+	srv.Start()
+	t.Cleanup(func() {
+		n.Shutdown()
+		srv.Close()
+	})
+	return &Node{Node: n, URL: srv.URL, Client: client.New(srv.URL)}
+}
+
+// Height is the height of the node's latest block
+func (n *Node) Height() int64 {
+	return n.Chain.GetLatestBlock().Index
+}
+
+// Tip is the hash of the node's latest block
+func (n *Node) Tip() string {
+	return n.Chain.GetLatestBlock().Hash
+}
+
+// builds holds the binaries built so far, by service
+var builds struct {
+	sync.Mutex
+	dir  string
+	done map[string]string
+}
+
+// Build builds a service's binary from its directory in the repository,
+// once per test run, and returns its path
+func Build(t testing.TB, name string) string {
+	t.Helper()
+	builds.Lock()
+	defer builds.Unlock()
+	if path, ok := builds.done[name]; ok {
+		return path
+	}
+	if builds.dir == "" {
+		dir, err := os.MkdirTemp("", "home-server-e2e-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		builds.dir, builds.done = dir, map[string]string{}
+	}
+	path := filepath.Join(builds.dir, name)
+	if runtime.GOOS == "windows" {
+		path += ".exe"
+	}
+	cmd := exec.Command("go", "build", "-o", path, ".")
+	cmd.Dir = filepath.Join("..", name)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to build %s: %v\n%s", name, err, out)
+	}
+	builds.done[name] = path
+	return path
+}
+
+// RemoveBuilds deletes the binaries Build made, for TestMain to call once
+// the tests have run
+func RemoveBuilds() {
+	builds.Lock()
+	defer builds.Unlock()
+	if builds.dir != "" {
+		os.RemoveAll(builds.dir)
+		builds.dir, builds.done = "", nil
+	}
+}
+
+// FreeAddr returns a local address with a port nothing is listening on
+func FreeAddr(t testing.TB) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// output collects a service's output for logging if the test fails
+type output struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.Write(p)
+}
+
+func (o *output) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.String()
+}
+
+// Service is a service's binary running for a test
+type Service struct {
+	Name   string
+	URL    string
+	Token  string // sent by Call, if set
+	cmd    *exec.Cmd
+	out    *output
+	exited chan struct{}
+}
+
+// Start builds and runs a service with env as its only settings, besides
+// LISTEN_ADDR, which it is given a free port in, and waits until its
+// /healthz answers. It is stopped when the test ends.
+func Start(t testing.TB, name string, env map[string]string) *Service {
+	t.Helper()
+	skipShort(t)
+	path := Build(t, name)
+	addr := FreeAddr(t)
+	s := &Service{Name: name, URL: "http://" + addr, out: &output{}, exited: make(chan struct{})}
+
+	s.cmd = exec.Command(path)
+	s.cmd.Dir = t.TempDir()
+	s.cmd.Env = []string{"LISTEN_ADDR=" + addr}
+	for _, key := range []string{"PATH", "HOME", "TMPDIR", "SYSTEMROOT"} {
+		if v, ok := os.LookupEnv(key); ok {
+			s.cmd.Env = append(s.cmd.Env, key+"="+v)
+		}
+	}
+	for k, v := range env {
+		s.cmd.Env = append(s.cmd.Env, k+"="+v)
+	}
+	s.cmd.Stdout, s.cmd.Stderr = s.out, s.out
+	if err := s.cmd.Start(); err != nil {
+		t.Fatalf("failed to start %s: %v", name, err)
+	}
+	go func() {
+		s.cmd.Wait()
+		close(s.exited)
+	}()
+	t.Cleanup(func() {
+		s.Stop()
+		if t.Failed() {
+			t.Logf("%s output:\n%s", name, s.out)
+		}
+	})
+
+	deadline := time.Now().Add(StartTimeout)
+	for {
+		resp, err := http.Get(s.URL + "/healthz")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return s
+			}
+		}
+		select {
+		case <-s.exited:
+			t.Fatalf("%s exited while starting: %v\n%s", name, s.cmd.ProcessState, s.out)
+		case <-time.After(20 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s didn't answer /healthz within %s\n%s", name, StartTimeout, s.out)
+		}
+	}
+}
+
+// Stop interrupts the service and waits for it to exit, killing it if it
+// takes too long
+func (s *Service) Stop() {
+	select {
+	case <-s.exited:
+		return
+	default:
+	}
+	if err := s.cmd.Process.Signal(os.Interrupt); err != nil {
+		s.cmd.Process.Kill()
+	}
+	select {
+	case <-s.exited:
+	case <-time.After(stopTimeout):
+		s.cmd.Process.Kill()
+		<-s.exited
+	}
+}
+
+// Output is what the service has written so far
+func (s *Service) Output() string {
+	return s.out.String()
+}
+
+// Call sends a request to the service with its token, if it has one, and
+// body as JSON unless it is nil, decodes a JSON reply into into unless that
+// is nil, and returns the status code. Replies that aren't JSON, such as
+// most errors, are left undecoded.
+func (s *Service) Call(t testing.TB, method, path string, body, into any) int {
+	t.Helper()
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(t.Context(), method, s.URL+path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s %s: %v", s.Name, method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if into != nil && strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		if err := json.Unmarshal(data, into); err != nil {
+			t.Fatalf("%s %s %s answered %s, not JSON: %v", s.Name, method, path, strings.TrimSpace(string(data)), err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// Inbox is a webhook notify-service can deliver to, keeping every message
+type Inbox struct {
+	URL      string
+	mu       sync.Mutex
+	messages []notify.Message
+}
+
+// NewInbox serves a webhook until the test ends
+func NewInbox(t testing.TB) *Inbox {
+	t.Helper()
+	in := &Inbox{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m notify.Message
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		in.mu.Lock()
+		in.messages = append(in.messages, m)
+		in.mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+	in.URL = srv.URL
+	return in
+}
+
+// Messages returns the messages received so far, oldest first
+func (in *Inbox) Messages() []notify.Message {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return append([]notify.Message{}, in.messages...)
+}
+
+// Await waits for a message from source about event and returns the first
+func (in *Inbox) Await(t testing.TB, source, event string) notify.Message {
+	t.Helper()
+	var found notify.Message
+	Eventually(t, fmt.Sprintf("%s to notify %s", source, event), func() bool {
+		for _, m := range in.Messages() {
+			if m.Source == source && m.Event == event {
+				found = m
+				return true
+			}
+		}
+		return false
+	})
+	return found
+}
+
+// NotifyFile writes a notify-service channels file sending every message to
+// the webhook at url, and returns its path
+func NotifyFile(t testing.TB, url string) string {
+	t.Helper()
+	return WriteJSON(t, "notify.json", map[string]any{
+		"channels": map[string]any{"inbox": map[string]string{"type": "webhook", "url": url}},
+		"routes":   []map[string]any{{"to": []string{"inbox"}}},
+	})
+}
+
+// WriteJSON writes v as JSON to a file named name in a temporary directory
+// and returns its path
+func WriteJSON(t testing.TB, name string, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Eventually polls cond until it holds, failing the test after WaitTimeout
+func Eventually(t testing.TB, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(WaitTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("gave up waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,65 @@
+package e2e
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPowerEvents(t *testing.T) {
+	inbox := NewInbox(t)
+	hub := Start(t, "notify-service", map[string]string{
+		"NOTIFY_FILE":  NotifyFile(t, inbox.URL),
+		"NOTIFY_TOKEN": "hub-token",
+	})
+	fake := filepath.Join(t.TempDir(), "power.log")
+	power := Start(t, "shutdown-service", map[string]string{
+		"SHUTDOWN_TOKEN":  "power-token",
+		"POWER_BACKEND":   "fake",
+		"POWER_FAKE_FILE": fake,
+		"DRY_RUN":         "true",
+		"WALL":            "false",
+		"NOTIFY_URL":      hub.URL,
+		"NOTIFY_TOKEN":    "hub-token",
+	})
+
+	// A request with the wrong token is refused and reported
+	power.Token = "guess"
+	if code := power.Call(t, http.MethodPost, "/shutdown", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a wrong token, got %d", code)
+	}
+	inbox.Await(t, "shutdown-service", "unauthorized")
+	power.Token = "power-token"
+
+	// A delayed shutdown is scheduled, then called off
+	if code := power.Call(t, http.MethodPost, "/shutdown?delay=1h&reason=e2e", nil, nil); code >= 300 {
+		t.Fatalf("scheduling a shutdown answered %d", code)
+	}
+	if m := inbox.Await(t, "shutdown-service", "scheduled"); m.Fields["action"] != "shutdown" || m.Fields["reason"] != "e2e" {
+		t.Errorf("got %+v", m)
+	}
+	var status struct {
+		Pending *struct {
+			Action string `json:"action"`
+		} `json:"pending"`
+	}
+	if power.Call(t, http.MethodGet, "/status", nil, &status); status.Pending == nil || status.Pending.Action != "shutdown" {
+		t.Errorf("expected the shutdown to be pending, got %+v", status.Pending)
+	}
+	if code := power.Call(t, http.MethodDelete, "/shutdown/pending", nil, nil); code >= 300 {
+		t.Fatalf("cancelling answered %d", code)
+	}
+	inbox.Await(t, "shutdown-service", "cancelled")
+
+	// A reboot runs at once, but only as a dry run
+	if code := power.Call(t, http.MethodPost, "/reboot", nil, nil); code >= 300 {
+		t.Fatalf("rebooting answered %d", code)
+	}
+	if m := inbox.Await(t, "shutdown-service", "executed"); m.Fields["action"] != "reboot" || m.Priority != "high" {
+		t.Errorf("got %+v", m)
+	}
+	if _, err := os.Stat(fake); !os.IsNotExist(err) {
+		t.Errorf("expected a dry run not to reach the power backend, got %v", err)
+	}
+}
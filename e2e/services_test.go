@@ -0,0 +1,251 @@
+package e2e
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/oksmith/home-server/blockchain/pkg/transaction"
+	"github.com/oksmith/home-server/blockchain/pkg/wallet"
+)
+
+// fundedWallet saves a new wallet's key holding amount on n and returns the
+// wallet and its key file
+func fundedWallet(t *testing.T, n *Node, amount float64) (*wallet.Wallet, string) {
+	t.Helper()
+	w, err := wallet.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "wallet.pem")
+	if err := w.SaveToFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.Client.Faucet(t.Context(), w.Address(), amount); err != nil {
+		t.Fatal(err)
+	}
+	return w, path
+}
+
+func TestScheduledMining(t *testing.T) {
+	n := StartNode(t)
+	inbox := NewInbox(t)
+	hub := Start(t, "notify-service", map[string]string{"NOTIFY_FILE": NotifyFile(t, inbox.URL)})
+	scheduler := Start(t, "scheduler", map[string]string{
+		"JOBS_FILE": WriteJSON(t, "jobs.json", []map[string]any{
+			{"name": "mine", "schedule": "@yearly", "http": map[string]string{"url": n.URL + "/api/v1/generate?blocks=2"}},
+			{"name": "too-many", "schedule": "@yearly", "http": map[string]string{"url": n.URL + "/api/v1/generate?blocks=5000"}},
+		}),
+		"SCHEDULER_TOKEN": "scheduler-token",
+		"NOTIFY_URL":      hub.URL,
+	})
+	scheduler.Token = "scheduler-token"
+
+	type run struct {
+		OK       bool   `json:"ok"`
+		Trigger  string `json:"trigger"`
+		Attempts int    `json:"attempts"`
+		Error    string `json:"error"`
+	}
+	var r run
+	if code := scheduler.Call(t, http.MethodPost, "/api/v1/jobs/mine/run?wait=true", nil, &r); code != http.StatusOK || !r.OK {
+		t.Fatalf("expected the job to succeed, got %d %+v", code, r)
+	}
+	if n.Height() != 2 {
+		t.Errorf("expected the job to mine 2 blocks, the node is at %d", n.Height())
+	}
+
+	// A job the node refuses fails and is reported
+	r = run{}
+	if code := scheduler.Call(t, http.MethodPost, "/api/v1/jobs/too-many/run?wait=true", nil, &r); code != http.StatusBadGateway || r.OK {
+		t.Fatalf("expected the job to fail, got %d %+v", code, r)
+	}
+	if m := inbox.Await(t, "scheduler", "job_failed"); m.Fields["job"] != "too-many" || m.Fields["trigger"] != "manual" {
+		t.Errorf("got %+v", m)
+	}
+	if n.Height() != 2 {
+		t.Errorf("expected no more blocks, the node is at %d", n.Height())
+	}
+}
+
+func TestAnchor(t *testing.T) {
+	n := StartNode(t)
+	_, key := fundedWallet(t, n, 1)
+	dir := t.TempDir()
+	anchors := Start(t, "anchor-service", map[string]string{
+		"ANCHOR_DIR":    dir,
+		"ANCHOR_STATE":  filepath.Join(t.TempDir(), "anchors.json"),
+		"ANCHOR_WALLET": key,
+		"NODE_URL":      n.URL,
+		"SCAN_INTERVAL": "50ms",
+	})
+
+	contents := []byte("the deeds to the house")
+	sum := sha256.Sum256(contents)
+	hash := hex.EncodeToString(sum[:])
+	if err := os.WriteFile(filepath.Join(dir, "deeds.txt"), contents, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The anchor is paid for once the file holds still, then mined
+	Eventually(t, "the anchor to reach the node", func() bool {
+		for _, tx := range n.Mempool.GetAll() {
+			if tx.To == hash {
+				return true
+			}
+		}
+		return false
+	})
+	if _, err := n.Client.Generate(t.Context(), 1); err != nil {
+		t.Fatal(err)
+	}
+	height := n.Height()
+	Eventually(t, "the anchor to be recorded as mined", func() bool {
+		var list struct {
+			Anchors []struct {
+				SHA256 string `json:"sha256"`
+				Height int64  `json:"height"`
+			} `json:"anchors"`
+		}
+		anchors.Call(t, http.MethodGet, "/api/v1/anchors", nil, &list)
+		return len(list.Anchors) == 1 && list.Anchors[0].SHA256 == hash && list.Anchors[0].Height == height
+	})
+
+	// Anyone can check the file against the chain
+	var verified struct {
+		Proof *struct {
+			TxID   string `json:"tx_id"`
+			Height int64  `json:"height"`
+		} `json:"proof"`
+		Files  []string `json:"files"`
+		Before *bool    `json:"before"`
+	}
+	code := anchors.Call(t, http.MethodGet, fmt.Sprintf("/api/v1/verify?sha256=%s&block=%d", hash, height), nil, &verified)
+	if code != http.StatusOK || verified.Proof == nil || verified.Proof.Height != height || verified.Before == nil || !*verified.Before {
+		t.Fatalf("got %d %+v", code, verified)
+	}
+	if len(verified.Files) != 1 || verified.Files[0] != "deeds.txt" {
+		t.Errorf("expected the file to be named, got %v", verified.Files)
+	}
+	if code := anchors.Call(t, http.MethodGet, fmt.Sprintf("/api/v1/verify?sha256=%s&block=%d", hash, height-1), nil, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("expected the file not to be anchored before block %d, got %d", height-1, code)
+	}
+	other := sha256.Sum256([]byte("something else"))
+	if code := anchors.Call(t, http.MethodGet, "/api/v1/verify?sha256="+hex.EncodeToString(other[:]), nil, nil); code != http.StatusNotFound {
+		t.Errorf("expected an unanchored hash not to be found, got %d", code)
+	}
+}
+
+func TestChores(t *testing.T) {
+	n := StartNode(t)
+	inbox := NewInbox(t)
+	hub := Start(t, "notify-service", map[string]string{"NOTIFY_FILE": NotifyFile(t, inbox.URL)})
+	bank, key := fundedWallet(t, n, 1)
+	parent, _ := wallet.New()
+	kid, _ := wallet.New()
+	chores := Start(t, "chores", map[string]string{
+		"HOUSEHOLD_FILE": WriteJSON(t, "household.json", map[string]any{
+			"members": []map[string]string{
+				{"name": "alex", "role": "parent", "address": parent.Address()},
+				{"name": "sam", "role": "kid", "address": kid.Address()},
+			},
+			"chores":  []map[string]any{{"name": "dishes", "points": 5}},
+			"rewards": []map[string]any{{"name": "sweets", "points": 3}},
+		}),
+		"HOUSEHOLD_WALLET": key,
+		"NODE_URL":         n.URL,
+		"SYNC_INTERVAL":    "50ms",
+		"PARENT_TOKEN":     "parent-token",
+		"NOTIFY_URL":       hub.URL,
+	})
+
+	type entry struct {
+		ID     int64  `json:"id"`
+		Status string `json:"status"`
+		TxID   string `json:"tx_id"`
+	}
+	entries := func() map[int64]entry {
+		var list []entry
+		chores.Call(t, http.MethodGet, "/api/v1/entries?member=sam", nil, &list)
+		byID := map[int64]entry{}
+		for _, e := range list {
+			byID[e.ID] = e
+		}
+		return byID
+	}
+
+	// Sam does the dishes and a parent is told
+	var claim entry
+	if code := chores.Call(t, http.MethodPost, "/api/v1/chores/dishes/done?member=sam", nil, &claim); code != http.StatusCreated {
+		t.Fatalf("claiming answered %d", code)
+	}
+	if m := inbox.Await(t, "chores", "chore_claimed"); m.Fields["member"] != "sam" || m.Fields["points"] != "5" {
+		t.Errorf("got %+v", m)
+	}
+
+	// Only a parent may approve it, which pays sam from the household wallet
+	path := fmt.Sprintf("/api/v1/entries/%d/approve?parent=alex", claim.ID)
+	if code := chores.Call(t, http.MethodPost, path, nil, nil); code != http.StatusForbidden {
+		t.Errorf("expected approval without PARENT_TOKEN to be refused, got %d", code)
+	}
+	chores.Token = "parent-token"
+	if code := chores.Call(t, http.MethodPost, path, nil, &claim); code >= 300 || claim.TxID == "" {
+		t.Fatalf("approving answered %d %+v", code, claim)
+	}
+	chores.Token = ""
+	if _, ok := n.Mempool.Get(claim.TxID); !ok {
+		t.Fatal("expected the payment to be waiting on the node")
+	}
+	if _, err := n.Client.Generate(t.Context(), 1); err != nil {
+		t.Fatal(err)
+	}
+	Eventually(t, "the payment to be recorded as mined", func() bool { return entries()[claim.ID].Status == "paid" })
+	if got, err := n.Client.Balance(t.Context(), kid.Address()); err != nil || got != 0.05 {
+		t.Errorf("expected sam's wallet to hold 0.05, got %v, %v", got, err)
+	}
+
+	// Sam spends 3 of the points on sweets by paying the household back
+	var redeemed struct {
+		Entry   entry   `json:"entry"`
+		Address string  `json:"address"`
+		Amount  float64 `json:"amount"`
+	}
+	if code := chores.Call(t, http.MethodPost, "/api/v1/rewards/sweets/redeem?member=sam", nil, &redeemed); code != http.StatusCreated {
+		t.Fatalf("redeeming answered %d", code)
+	}
+	if redeemed.Address != bank.Address() || redeemed.Amount != 0.03 || redeemed.Entry.Status != "pending" {
+		t.Fatalf("got %+v", redeemed)
+	}
+	tx := transaction.New(kid.Address(), redeemed.Address, redeemed.Amount)
+	if err := tx.Sign(kid.PrivateKey); err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := n.Client.SubmitTransaction(t.Context(), tx); err != nil || !resp.Accepted {
+		t.Fatalf("got %+v, %v", resp, err)
+	}
+	if _, err := n.Client.Generate(t.Context(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if m := inbox.Await(t, "chores", "reward_redeemed"); m.Fields["member"] != "sam" {
+		t.Errorf("got %+v", m)
+	}
+	if e := entries()[redeemed.Entry.ID]; e.Status != "paid" || e.TxID != tx.ID {
+		t.Errorf("expected the redemption settled by sam's payment, got %+v", e)
+	}
+	var h struct {
+		Members []struct {
+			Name   string `json:"name"`
+			Points *int64 `json:"points"`
+		} `json:"members"`
+	}
+	chores.Call(t, http.MethodGet, "/api/v1/household", nil, &h)
+	for _, m := range h.Members {
+		if m.Name == "sam" && (m.Points == nil || *m.Points != 2) {
+			t.Errorf("expected sam to have 2 points left, got %v", m.Points)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Command gateway puts the home-server's services behind one address, one
+// TLS certificate and one token: /blockchain/... goes to the blockchain node,
+// /power/... to shutdown-service, and so on, with the prefix removed. Requests
+// need GATEWAY_TOKEN, as a bearer token or a Basic password, which the gateway
+// swaps for the service's own token before passing them on.
+//
+// SERVICES_FILE names a JSON list of services, each {"name", "url", "token"}
+// with optionally a "prefix" (default /NAME) and "public": true to serve it
+// without GATEWAY_TOKEN, passing the caller's own credentials through instead.
+// The longest matching prefix wins.
+//
+// Services can also register themselves. With REGISTRY_TOKEN set, POST
+// /registry with that token and a service as above adds one for 90 seconds,
+// and posting it again renews it; shutdown-service and the node do so every
+// 30 seconds once given GATEWAY_URL and the token, and DELETE /registry/NAME
+// as they stop. Registrations can't take a prefix another live service holds
+// or replace a service from SERVICES_FILE. GET /registry lists the services,
+// without their tokens, for GATEWAY_TOKEN.
+//
+// Instead of tokens, services can sign their requests with a wallet key, as
+// described in package sigauth. AUTHORIZED_KEYS names a file of the keys
+// trusted in place of GATEWAY_TOKEN and REGISTRY_TOKEN, and is reread when it
+// changes. With SERVICE_KEY naming the gateway's own unencrypted wallet key,
+// it signs what it passes on to private services, so those can trust its key
+// rather than each hand it a token.
+//
+// Otherwise it serves as package httpserver describes, on LISTEN_ADDR
+// (default :8000), and REGISTRY_TOKEN reloads along with GATEWAY_TOKEN.
+// UPSTREAM_CA names a CA trusted for services' own HTTPS certificates besides
+// the system's, and GET /metrics counts requests and errors by service.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/oksmith/home-server/pkg/config"
+	"github.com/oksmith/home-server/pkg/httpserver"
+	"github.com/oksmith/home-server/pkg/registry"
+	"github.com/oksmith/home-server/pkg/sigauth"
+)
+
+// reserved are the gateway's own paths, which no service can take
+var reserved = []string{"/registry", "/healthz", "/metrics"}
+
+// settings are the gateway's settings
+var settings = []config.Field{
+	{Name: "GATEWAY_TOKEN", Required: true, Secret: true, Reload: true},
+	{Name: "REGISTRY_TOKEN", Secret: true, Reload: true},
+	{Name: "LISTEN_ADDR", Default: ":8000", Check: config.HostPort},
+	{Name: "SERVICES_FILE"},
+	{Name: "UPSTREAM_CA"},
+	{Name: "AUTHORIZED_KEYS"},
+	{Name: "SERVICE_KEY"},
+	{Name: "TLS_CERT"},
+	{Name: "TLS_KEY"},
+}
+
+// loadServices adds the services listed in a JSON file to reg for good
+func loadServices(filename string, reg *registry.Registry) (int, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	var services []registry.Service
+	if err := json.Unmarshal(data, &services); err != nil {
+		return 0, fmt.Errorf("%s: %w", filename, err)
+	}
+	for _, s := range services {
+		if _, err := reg.Add(s, true); err != nil {
+			return 0, fmt.Errorf("%s: %s: %w", filename, s.Name, err)
+		}
+	}
+	return len(services), nil
+}
+
+func main() {
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"), settings...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	token := func() string { return cfg.Get("GATEWAY_TOKEN") }
+	addr := cfg.Get("LISTEN_ADDR")
+
+	reg := registry.New(registry.DefaultTTL, reserved...)
+	if filename := cfg.Get("SERVICES_FILE"); filename != "" {
+		n, err := loadServices(filename, reg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("serving %d services from %s", n, filename)
+	}
+	transport, err := upstreamTransport(cfg.Get("UPSTREAM_CA"))
+	if err != nil {
+		log.Fatalf("UPSTREAM_CA: %v", err)
+	}
+	keys, err := sigauth.LoadKeyring(cfg.Get("AUTHORIZED_KEYS"))
+	if err != nil {
+		log.Fatalf("AUTHORIZED_KEYS: %v", err)
+	}
+	signer, err := sigauth.LoadSigner(cfg.Get("SERVICE_KEY"))
+	if err != nil {
+		log.Fatalf("SERVICE_KEY: %v", err)
+	}
+	if signer != nil {
+		log.Printf("signing requests to services as %s", signer.ID())
+	}
+
+	g := httpserver.NewGuard(httpserver.DefaultLimits)
+	metrics := httpserver.NewMetrics()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.Handle("GET /registry", httpserver.RequireAuth("home-server", token, keys, g, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		list := reg.List()
+		for i := range list {
+			list[i].Token = ""
+		}
+		httpserver.WriteJSON(w, http.StatusOK, list)
+	})))
+	// Registration is refused while REGISTRY_TOKEN is empty, unless signed
+	registryToken := func() string { return cfg.Get("REGISTRY_TOKEN") }
+	registration := reg.Handler(registryToken, keys, g)
+	mux.Handle("POST /registry", registration)
+	mux.Handle("DELETE /registry/{name}", registration)
+	if registryToken() != "" || keys.Len() > 0 {
+		log.Println("services may register at /registry")
+	}
+	mux.Handle("GET /metrics", httpserver.RequireAuth("home-server", token, keys, g, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpserver.WriteJSON(w, http.StatusOK, metrics.Snapshot())
+	})))
+	own := httpserver.InstrumentMux(metrics, slog.Default(), mux)
+
+	// Anything under a service's prefix goes to it, recorded by its name
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, rest, ok := reg.Match(r.URL.Path)
+		if !ok {
+			own.ServeHTTP(w, r)
+			return
+		}
+		var next http.Handler = proxyTo(s, rest, transport, signer)
+		if !s.Public {
+			next = httpserver.RequireAuth("home-server", token, keys, g, next)
+		}
+		httpserver.Instrument(metrics, slog.Default(), s.Name, false, next).ServeHTTP(w, r)
+	})
+	server := &http.Server{Addr: addr, Handler: g.Middleware(handler)}
+
+	certFile, keyFile := cfg.Get("TLS_CERT"), cfg.Get("TLS_KEY")
+	switch {
+	case certFile == "" && keyFile == "":
+		log.Printf("gateway starting on %s", addr)
+	case certFile == "" || keyFile == "":
+		log.Fatal("TLS_CERT and TLS_KEY must be set together")
+	default:
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		log.Printf("gateway starting on %s with TLS", addr)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go cfg.Watch(ctx, config.DefaultPoll)
+	if err := httpserver.ListenAndServe(ctx, server, certFile, keyFile); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("gateway stopped")
+}
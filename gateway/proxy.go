@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+
+	"github.com/oksmith/home-server/pkg/registry"
+	"github.com/oksmith/home-server/pkg/sigauth"
+)
+
+// upstreamTransport is how the gateway reaches services, trusting the
+// certificates signed by caFile as well as the system's if it is set
+func upstreamTransport(caFile string) (http.RoundTripper, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caFile == "" {
+		return transport, nil
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	return transport, nil
+}
+
+// proxyTo passes a request on to a service, with the path after its prefix.
+// Callers of a private service have shown the gateway's token or signed with
+// a key it trusts, so that is swapped for the service's own token and the
+// gateway's signature, if it has a signer; a public service sees the caller's
+// credentials instead, so its token can't be borrowed by anyone.
+func proxyTo(s registry.Service, rest string, transport http.RoundTripper, signer *sigauth.Signer) http.Handler {
+	target, err := url.Parse(s.URL)
+	if err != nil {
+		// The registry only takes valid URLs
+		panic(err)
+	}
+	if !s.Public {
+		transport = signer.Transport(transport)
+	}
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Path, pr.Out.URL.RawPath = rest, ""
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			pr.Out.Header.Set("X-Forwarded-Prefix", s.Prefix)
+			if !s.Public {
+				for _, h := range []string{"Authorization", sigauth.HeaderKey, sigauth.HeaderTimestamp, sigauth.HeaderNonce, sigauth.HeaderSignature} {
+					pr.Out.Header.Del(h)
+				}
+				if s.Token != "" {
+					pr.Out.Header.Set("Authorization", "Bearer "+s.Token)
+				}
+			}
+		},
+		Transport: transport,
+		// Flush straight away so event streams aren't held back
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			slog.Warn("service unreachable", "service", s.Name, "url", s.URL, "error", err)
+			http.Error(w, s.Name+" is unreachable", http.StatusBadGateway)
+		},
+	}
+}
@@ -0,0 +1,159 @@
+// Package collect samples how busy a Linux host is, from /proc and /sys:
+// CPU, memory, disks, temperatures and network traffic
+package collect
+
+import (
+	"path/filepath"
+	"time"
+)
+
+// Snapshot is one sample of the host. Rates and CPU usage are over the time
+// since the previous sample, or since boot for the first.
+type Snapshot struct {
+	Time         time.Time     `json:"time"`
+	Uptime       float64       `json:"uptime_seconds"`
+	CPU          CPU           `json:"cpu"`
+	Memory       Memory        `json:"memory"`
+	Disks        []Disk        `json:"disks"`
+	Temperatures []Temperature `json:"temperatures"`
+	Network      Network       `json:"network"`
+	Errors       []string      `json:"errors,omitempty"` // what couldn't be read
+}
+
+// CPU is processor usage across all cores and for each
+type CPU struct {
+	UsagePercent float64    `json:"usage_percent"`
+	Cores        []float64  `json:"cores_percent"`
+	Load         [3]float64 `json:"load"` // 1, 5 and 15 minute load averages
+}
+
+// Memory is RAM and swap usage
+type Memory struct {
+	TotalBytes     uint64  `json:"total_bytes"`
+	AvailableBytes uint64  `json:"available_bytes"`
+	UsedPercent    float64 `json:"used_percent"`
+	SwapTotalBytes uint64  `json:"swap_total_bytes"`
+	SwapFreeBytes  uint64  `json:"swap_free_bytes"`
+}
+
+// Disk is the usage of the filesystem holding Path
+type Disk struct {
+	Path           string  `json:"path"`
+	TotalBytes     uint64  `json:"total_bytes"`
+	AvailableBytes uint64  `json:"available_bytes"`
+	UsedPercent    float64 `json:"used_percent"`
+}
+
+// Temperature is one sensor's reading
+type Temperature struct {
+	Sensor  string  `json:"sensor"`
+	Celsius float64 `json:"celsius"`
+}
+
+// Network is traffic on every interface, with totals leaving out loopback
+type Network struct {
+	ReceiveBytesPerSec  float64     `json:"receive_bytes_per_sec"`
+	TransmitBytesPerSec float64     `json:"transmit_bytes_per_sec"`
+	Interfaces          []Interface `json:"interfaces"`
+}
+
+// Interface is one network interface's counters and rates
+type Interface struct {
+	Name                string  `json:"name"`
+	ReceiveBytes        uint64  `json:"receive_bytes"`
+	TransmitBytes       uint64  `json:"transmit_bytes"`
+	ReceiveBytesPerSec  float64 `json:"receive_bytes_per_sec"`
+	TransmitBytesPerSec float64 `json:"transmit_bytes_per_sec"`
+}
+
+// Sampler takes snapshots, remembering the counters of the last one to work
+// out rates. It isn't safe for concurrent use.
+type Sampler struct {
+	Proc  string   // where procfs is mounted, /proc by default
+	Sys   string   // where sysfs is mounted, /sys by default
+	Disks []string // filesystems to report
+
+	last    time.Time
+	cpu     []cpuTimes // the total first, then each core
+	network map[string][2]uint64
+}
+
+// New returns a sampler reporting the filesystems holding disks
+func New(disks []string) *Sampler {
+	return &Sampler{Proc: "/proc", Sys: "/sys", Disks: disks}
+}
+
+// Sample reads the host now. Whatever can't be read is left out and noted in
+// the snapshot's Errors.
+func (s *Sampler) Sample(now time.Time) Snapshot {
+	snap := Snapshot{Time: now, Disks: []Disk{}, Temperatures: []Temperature{}}
+	note := func(err error) {
+		if err != nil {
+			snap.Errors = append(snap.Errors, err.Error())
+		}
+	}
+	elapsed := now.Sub(s.last).Seconds()
+	if s.last.IsZero() {
+		elapsed = 0
+	}
+	s.last = now
+
+	var err error
+	snap.Uptime, err = readUptime(s.proc("uptime"))
+	note(err)
+	if elapsed == 0 {
+		// Counters start at boot, so the first rates are since then
+		elapsed = snap.Uptime
+	}
+
+	cpu, err := readCPUTimes(s.proc("stat"))
+	note(err)
+	if err == nil {
+		snap.CPU.UsagePercent, snap.CPU.Cores = cpuUsage(s.cpu, cpu)
+		s.cpu = cpu
+	}
+	snap.CPU.Load, err = readLoad(s.proc("loadavg"))
+	note(err)
+	snap.Memory, err = readMemory(s.proc("meminfo"))
+	note(err)
+
+	for _, path := range s.Disks {
+		d, err := readDisk(path)
+		note(err)
+		if err == nil {
+			snap.Disks = append(snap.Disks, d)
+		}
+	}
+	snap.Temperatures = readTemperatures(s.sys())
+
+	counters, err := readNetwork(s.proc("net", "dev"))
+	note(err)
+	if err == nil {
+		snap.Network = networkRates(s.network, counters, elapsed)
+		s.network = counters
+	}
+	return snap
+}
+
+func (s *Sampler) proc(name ...string) string {
+	root := s.Proc
+	if root == "" {
+		root = "/proc"
+	}
+	return filepath.Join(append([]string{root}, name...)...)
+}
+
+func (s *Sampler) sys() string {
+	if s.Sys == "" {
+		return "/sys"
+	}
+	return s.Sys
+}
+
+// percent returns part as a percentage of whole, 0 if whole is 0
+func percent(part, whole float64) float64 {
+	if whole <= 0 {
+		return 0
+	}
+	return part / whole * 100
+}
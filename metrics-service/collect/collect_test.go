@@ -0,0 +1,121 @@
+package collect
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakeHost writes the procfs and sysfs files a sampler reads
+func fakeHost(t *testing.T, files map[string]string) *Sampler {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		filename := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &Sampler{Proc: filepath.Join(root, "proc"), Sys: filepath.Join(root, "sys"), Disks: []string{root}}
+}
+
+func writeFile(t *testing.T, filename, content string) {
+	t.Helper()
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const meminfo = `MemTotal:        1000 kB
+MemFree:          100 kB
+MemAvailable:     250 kB
+SwapTotal:        512 kB
+SwapFree:         256 kB
+`
+
+func netDev(rx, tx uint64) string {
+	return "Inter-|   Receive                                                |  Transmit\n" +
+		" face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed\n" +
+		"    lo: 5000 10 0 0 0 0 0 0 5000 10 0 0 0 0 0 0\n" +
+		"  eth0: " + strconv.FormatUint(rx, 10) + " 10 0 0 0 0 0 0 " + strconv.FormatUint(tx, 10) + " 10 0 0 0 0 0 0\n"
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestSample(t *testing.T) {
+	s := fakeHost(t, map[string]string{
+		"proc/uptime":  "100.00 350.00\n",
+		"proc/loadavg": "0.50 0.25 0.10 1/100 1234\n",
+		"proc/meminfo": meminfo,
+		"proc/stat": "cpu  100 0 100 700 100 0 0 0 0 0\n" +
+			"cpu0 50 0 50 350 50 0 0 0 0 0\n" +
+			"cpu1 50 0 50 350 50 0 0 0 0 0\n" +
+			"intr 12345\n",
+		"proc/net/dev":                           netDev(1000, 2000),
+		"sys/class/thermal/thermal_zone0/temp":   "45500\n",
+		"sys/class/thermal/thermal_zone0/type":   "cpu-thermal\n",
+		"sys/class/hwmon/hwmon0/name":            "nvme\n",
+		"sys/class/hwmon/hwmon0/temp1_input":     "38000\n",
+		"sys/class/hwmon/hwmon0/temp1_label":     "Composite\n",
+		"sys/class/hwmon/hwmon1/temp2_input":     "garbage\n",
+		"sys/class/thermal/thermal_zone1/policy": "step_wise\n",
+	})
+	start := time.Now()
+	snap := s.Sample(start)
+	if len(snap.Errors) != 0 {
+		t.Fatalf("errors: %v", snap.Errors)
+	}
+	// 200 busy ticks out of 1000 since boot
+	if !near(snap.CPU.UsagePercent, 20) || len(snap.CPU.Cores) != 2 || !near(snap.CPU.Cores[1], 20) {
+		t.Errorf("cpu = %+v", snap.CPU)
+	}
+	if snap.CPU.Load != [3]float64{0.5, 0.25, 0.1} {
+		t.Errorf("load = %v", snap.CPU.Load)
+	}
+	if snap.Memory.TotalBytes != 1000*1024 || !near(snap.Memory.UsedPercent, 75) || snap.Memory.SwapFreeBytes != 256*1024 {
+		t.Errorf("memory = %+v", snap.Memory)
+	}
+	if len(snap.Disks) != 1 || snap.Disks[0].TotalBytes == 0 {
+		t.Errorf("disks = %+v", snap.Disks)
+	}
+	want := []Temperature{{"cpu-thermal", 45.5}, {"nvme/Composite", 38}}
+	if len(snap.Temperatures) != 2 || snap.Temperatures[0] != want[0] || snap.Temperatures[1] != want[1] {
+		t.Errorf("temperatures = %+v", snap.Temperatures)
+	}
+	// Rates since boot, 100 seconds ago, leaving out loopback
+	if !near(snap.Network.ReceiveBytesPerSec, 10) || !near(snap.Network.TransmitBytesPerSec, 20) {
+		t.Errorf("network = %+v", snap.Network)
+	}
+
+	// The next sample's usage and rates are since the first
+	writeFile(t, s.proc("stat"), "cpu  150 0 150 750 150 0 0 0 0 0\ncpu0 100 0 100 350 50 0 0 0 0 0\ncpu1 50 0 50 400 100 0 0 0 0 0\n")
+	writeFile(t, s.proc("net", "dev"), netDev(6000, 2000))
+	snap = s.Sample(start.Add(10 * time.Second))
+	if !near(snap.CPU.UsagePercent, 50) || !near(snap.CPU.Cores[0], 100) || !near(snap.CPU.Cores[1], 0) {
+		t.Errorf("cpu = %+v", snap.CPU)
+	}
+	if !near(snap.Network.ReceiveBytesPerSec, 500) || !near(snap.Network.TransmitBytesPerSec, 0) {
+		t.Errorf("network = %+v", snap.Network)
+	}
+}
+
+func TestSampleNotesErrors(t *testing.T) {
+	s := fakeHost(t, map[string]string{"proc/loadavg": "0.50 0.25 0.10 1/100 1234\n"})
+	s.Disks = append(s.Disks, "/does/not/exist")
+	snap := s.Sample(time.Now())
+	if snap.CPU.Load[0] != 0.5 {
+		t.Errorf("load not read: %v", snap.CPU.Load)
+	}
+	// uptime, stat, meminfo, the missing disk and net/dev
+	if len(snap.Errors) != 5 {
+		t.Errorf("expected 5 errors, got %q", snap.Errors)
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !windows
+
+package collect
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// readDisk reports the size and free space of the filesystem holding path
+func readDisk(path string) (Disk, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return Disk{}, fmt.Errorf("disk %s: %w", path, err)
+	}
+	// The field types differ between Linux, macOS and FreeBSD
+	bsize := uint64(fs.Bsize)
+	d := Disk{
+		Path:           path,
+		TotalBytes:     uint64(fs.Blocks) * bsize,
+		AvailableBytes: uint64(fs.Bavail) * bsize,
+	}
+	// Space reserved for root counts as used, as in df
+	used := (uint64(fs.Blocks) - uint64(fs.Bfree)) * bsize
+	d.UsedPercent = percent(float64(used), float64(used+d.AvailableBytes))
+	return d, nil
+}
@@ -0,0 +1,8 @@
+package collect
+
+import "errors"
+
+// readDisk isn't supported on Windows, which has no /proc to sample either
+func readDisk(path string) (Disk, error) {
+	return Disk{}, errors.New("disk usage isn't supported on windows")
+}
@@ -0,0 +1,270 @@
+package collect
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// cpuTimes is a cpu line of /proc/stat, in clock ticks
+type cpuTimes struct {
+	idle, total uint64
+}
+
+// readUptime reads seconds since boot from /proc/uptime
+func readUptime(filename string) (float64, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("empty %s", filename)
+	}
+	secs, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("reading %s: %w", filename, err)
+	}
+	return secs, nil
+}
+
+// readCPUTimes reads the total CPU line of /proc/stat followed by each core's
+func readCPUTimes(filename string) ([]cpuTimes, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var times []cpuTimes
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// cpu  user nice system idle iowait irq softirq steal guest guest_nice
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		var t cpuTimes
+		// guest time is already counted in user, so stop at steal
+		for i, field := range fields[1:min(len(fields), 9)] {
+			n, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("reading %s: %w", filename, err)
+			}
+			t.total += n
+			if i == 3 || i == 4 { // idle and iowait
+				t.idle += n
+			}
+		}
+		times = append(times, t)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(times) == 0 {
+		return nil, fmt.Errorf("no cpu lines in %s", filename)
+	}
+	return times, nil
+}
+
+// cpuUsage works out the busy percentage overall and of each core between
+// two readings; prev may be nil for usage since boot
+func cpuUsage(prev, cur []cpuTimes) (float64, []float64) {
+	usage := func(i int) float64 {
+		var p cpuTimes
+		if i < len(prev) {
+			p = prev[i]
+		}
+		// Counters going backwards means a core went offline and back
+		if cur[i].total < p.total || cur[i].idle < p.idle {
+			p = cpuTimes{}
+		}
+		total := float64(cur[i].total - p.total)
+		return percent(total-float64(cur[i].idle-p.idle), total)
+	}
+	cores := make([]float64, 0, len(cur)-1)
+	for i := 1; i < len(cur); i++ {
+		cores = append(cores, usage(i))
+	}
+	return usage(0), cores
+}
+
+// readLoad reads the 1, 5 and 15 minute load averages from /proc/loadavg
+func readLoad(filename string) ([3]float64, error) {
+	var load [3]float64
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return load, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return load, fmt.Errorf("malformed %s", filename)
+	}
+	for i := range load {
+		if load[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return load, fmt.Errorf("reading %s: %w", filename, err)
+		}
+	}
+	return load, nil
+}
+
+// readMemory reads RAM and swap from /proc/meminfo
+func readMemory(filename string) (Memory, error) {
+	var m Memory
+	f, err := os.Open(filename)
+	if err != nil {
+		return m, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// e.g. "MemAvailable:   12345678 kB"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			m.TotalBytes = kb * 1024
+		case "MemAvailable:":
+			m.AvailableBytes = kb * 1024
+		case "SwapTotal:":
+			m.SwapTotalBytes = kb * 1024
+		case "SwapFree:":
+			m.SwapFreeBytes = kb * 1024
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return m, err
+	}
+	if m.TotalBytes == 0 {
+		return m, fmt.Errorf("no MemTotal in %s", filename)
+	}
+	m.UsedPercent = percent(float64(m.TotalBytes-m.AvailableBytes), float64(m.TotalBytes))
+	return m, nil
+}
+
+// readTemperatures reads the thermal zones and hwmon sensors under sysfs,
+// skipping any that can't be read, as some sensors fail while asleep
+func readTemperatures(sys string) []Temperature {
+	temps := []Temperature{}
+	zones, _ := filepath.Glob(filepath.Join(sys, "class", "thermal", "thermal_zone*"))
+	for _, zone := range zones {
+		c, err := readMillidegrees(filepath.Join(zone, "temp"))
+		if err != nil {
+			continue
+		}
+		name := readLine(filepath.Join(zone, "type"))
+		if name == "" {
+			name = filepath.Base(zone)
+		}
+		temps = append(temps, Temperature{Sensor: name, Celsius: c})
+	}
+
+	inputs, _ := filepath.Glob(filepath.Join(sys, "class", "hwmon", "hwmon*", "temp*_input"))
+	for _, input := range inputs {
+		c, err := readMillidegrees(input)
+		if err != nil {
+			continue
+		}
+		dir := filepath.Dir(input)
+		sensor := strings.TrimSuffix(filepath.Base(input), "_input")
+		if label := readLine(filepath.Join(dir, sensor+"_label")); label != "" {
+			sensor = label
+		}
+		chip := readLine(filepath.Join(dir, "name"))
+		if chip == "" {
+			chip = filepath.Base(dir)
+		}
+		temps = append(temps, Temperature{Sensor: chip + "/" + sensor, Celsius: c})
+	}
+	sort.Slice(temps, func(i, j int) bool { return temps[i].Sensor < temps[j].Sensor })
+	return temps
+}
+
+// readMillidegrees reads a sysfs temperature, given in thousandths of a degree
+func readMillidegrees(filename string) (float64, error) {
+	n, err := strconv.ParseInt(readLine(filename), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return float64(n) / 1000, nil
+}
+
+// readLine returns a sysfs file's contents without surrounding space, or ""
+func readLine(filename string) string {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// readNetwork reads the bytes received and sent by each interface from
+// /proc/net/dev
+func readNetwork(filename string) (map[string][2]uint64, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	counters := make(map[string][2]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, fields, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		// rx bytes is the first counter and tx bytes the ninth
+		c := strings.Fields(fields)
+		if len(c) < 9 {
+			continue
+		}
+		rx, err1 := strconv.ParseUint(c[0], 10, 64)
+		tx, err2 := strconv.ParseUint(c[8], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		counters[strings.TrimSpace(name)] = [2]uint64{rx, tx}
+	}
+	return counters, scanner.Err()
+}
+
+// networkRates works out each interface's rates over elapsed seconds
+func networkRates(prev, cur map[string][2]uint64, elapsed float64) Network {
+	n := Network{Interfaces: make([]Interface, 0, len(cur))}
+	rate := func(from, to uint64) float64 {
+		// A counter going backwards means the interface was recreated
+		if elapsed <= 0 || to < from {
+			return 0
+		}
+		return float64(to-from) / elapsed
+	}
+	for name, c := range cur {
+		p := prev[name]
+		i := Interface{
+			Name:                name,
+			ReceiveBytes:        c[0],
+			TransmitBytes:       c[1],
+			ReceiveBytesPerSec:  rate(p[0], c[0]),
+			TransmitBytesPerSec: rate(p[1], c[1]),
+		}
+		n.Interfaces = append(n.Interfaces, i)
+		if name != "lo" {
+			n.ReceiveBytesPerSec += i.ReceiveBytesPerSec
+			n.TransmitBytesPerSec += i.TransmitBytesPerSec
+		}
+	}
+	sort.Slice(n.Interfaces, func(i, j int) bool { return n.Interfaces[i].Name < n.Interfaces[j].Name })
+	return n
+}
@@ -0,0 +1,82 @@
+package collect
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// labelEscaper escapes label values in the Prometheus text format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// promWriter writes metric families in the Prometheus text format
+type promWriter struct {
+	w *bufio.Writer
+}
+
+// family starts a metric with its help text and type
+func (p promWriter) family(name, kind, help string) {
+	p.w.WriteString("# HELP " + name + " " + help + "\n# TYPE " + name + " " + kind + "\n")
+}
+
+// sample writes one value, with a label if label isn't empty
+func (p promWriter) sample(name, label, value string, v float64) {
+	p.w.WriteString(name)
+	if label != "" {
+		p.w.WriteString("{" + label + `="` + labelEscaper.Replace(value) + `"}`)
+	}
+	p.w.WriteString(" " + strconv.FormatFloat(v, 'g', -1, 64) + "\n")
+}
+
+// gauge writes a metric with a single value
+func (p promWriter) gauge(name, help string, v float64) {
+	p.family(name, "gauge", help)
+	p.sample(name, "", "", v)
+}
+
+// WritePrometheus writes a snapshot in the Prometheus text exposition format
+func WritePrometheus(w io.Writer, s Snapshot) error {
+	p := promWriter{bufio.NewWriter(w)}
+	p.gauge("host_uptime_seconds", "Seconds since the host booted.", s.Uptime)
+
+	p.gauge("host_cpu_usage_ratio", "Share of CPU time spent busy since the previous sample.", s.CPU.UsagePercent/100)
+	p.family("host_cpu_core_usage_ratio", "gauge", "Share of each core's time spent busy since the previous sample.")
+	for i, c := range s.CPU.Cores {
+		p.sample("host_cpu_core_usage_ratio", "core", strconv.Itoa(i), c/100)
+	}
+	p.gauge("host_load1", "1 minute load average.", s.CPU.Load[0])
+	p.gauge("host_load5", "5 minute load average.", s.CPU.Load[1])
+	p.gauge("host_load15", "15 minute load average.", s.CPU.Load[2])
+
+	p.gauge("host_memory_total_bytes", "Installed memory.", float64(s.Memory.TotalBytes))
+	p.gauge("host_memory_available_bytes", "Memory available without swapping.", float64(s.Memory.AvailableBytes))
+	p.gauge("host_swap_total_bytes", "Swap space.", float64(s.Memory.SwapTotalBytes))
+	p.gauge("host_swap_free_bytes", "Unused swap space.", float64(s.Memory.SwapFreeBytes))
+
+	p.family("host_disk_total_bytes", "gauge", "Size of the filesystem holding each path.")
+	for _, d := range s.Disks {
+		p.sample("host_disk_total_bytes", "path", d.Path, float64(d.TotalBytes))
+	}
+	p.family("host_disk_available_bytes", "gauge", "Space available to users on the filesystem holding each path.")
+	for _, d := range s.Disks {
+		p.sample("host_disk_available_bytes", "path", d.Path, float64(d.AvailableBytes))
+	}
+
+	p.family("host_temperature_celsius", "gauge", "Temperature reported by each sensor.")
+	for _, t := range s.Temperatures {
+		p.sample("host_temperature_celsius", "sensor", t.Sensor, t.Celsius)
+	}
+
+	p.family("host_network_receive_bytes_total", "counter", "Bytes received by each interface.")
+	for _, i := range s.Network.Interfaces {
+		p.sample("host_network_receive_bytes_total", "interface", i.Name, float64(i.ReceiveBytes))
+	}
+	p.family("host_network_transmit_bytes_total", "counter", "Bytes sent by each interface.")
+	for _, i := range s.Network.Interfaces {
+		p.sample("host_network_transmit_bytes_total", "interface", i.Name, float64(i.TransmitBytes))
+	}
+
+	p.gauge("host_sample_errors", "Readings that failed in the latest sample.", float64(len(s.Errors)))
+	return p.w.Flush()
+}
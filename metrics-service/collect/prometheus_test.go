@@ -0,0 +1,34 @@
+package collect
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	s := Snapshot{
+		CPU:          CPU{UsagePercent: 25, Cores: []float64{50, 0}, Load: [3]float64{1.5, 1, 0.5}},
+		Disks:        []Disk{{Path: "/", TotalBytes: 1 << 30}},
+		Temperatures: []Temperature{{Sensor: `odd "name"`, Celsius: 41.5}},
+		Network:      Network{Interfaces: []Interface{{Name: "eth0", ReceiveBytes: 123456789}}},
+	}
+	var b strings.Builder
+	if err := WritePrometheus(&b, s); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"# TYPE host_cpu_usage_ratio gauge\nhost_cpu_usage_ratio 0.25\n",
+		`host_cpu_core_usage_ratio{core="0"} 0.5`,
+		"host_load1 1.5\n",
+		`host_disk_total_bytes{path="/"} 1.073741824e+09`,
+		`host_temperature_celsius{sensor="odd \"name\""} 41.5`,
+		"# TYPE host_network_receive_bytes_total counter\n",
+		`host_network_receive_bytes_total{interface="eth0"} 1.23456789e+08`,
+		"host_sample_errors 0\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
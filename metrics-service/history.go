@@ -0,0 +1,53 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/oksmith/home-server/metrics-service/collect"
+)
+
+// history keeps the latest samples, oldest first, dropping those older than
+// keep
+type history struct {
+	keep time.Duration
+
+	mu      sync.Mutex
+	samples []collect.Snapshot
+}
+
+// add records a sample
+func (h *history) add(s collect.Snapshot) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.samples = append(h.samples, s)
+	cutoff := s.Time.Add(-h.keep)
+	drop := 0
+	for drop < len(h.samples)-1 && h.samples[drop].Time.Before(cutoff) {
+		drop++
+	}
+	h.samples = append(h.samples[:0], h.samples[drop:]...)
+}
+
+// latest returns the newest sample, reporting whether there is one
+func (h *history) latest() (collect.Snapshot, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.samples) == 0 {
+		return collect.Snapshot{}, false
+	}
+	return h.samples[len(h.samples)-1], true
+}
+
+// since returns the samples taken after t
+func (h *history) since(t time.Time) []collect.Snapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	list := []collect.Snapshot{}
+	for _, s := range h.samples {
+		if s.Time.After(t) {
+			list = append(list, s)
+		}
+	}
+	return list
+}
@@ -0,0 +1,175 @@
+// Command metrics-service samples how busy this host is every SAMPLE_INTERVAL
+// (default 15s): CPU usage overall and per core, load averages, memory and
+// swap, disk usage of each path in DISKS (default /), every temperature
+// sensor under /sys and traffic on each network interface.
+//
+// GET /metrics serves the latest sample in the Prometheus text format, for
+// Prometheus to scrape. GET /api/v1/metrics serves it as JSON, with CPU usage
+// and network rates since the sample before, and GET /api/v1/history?since=
+// DURATION (such as 15m) the samples kept for the last HISTORY (default 1h),
+// for the dashboard and shutdown-service's idle policy. Readings that fail
+// are listed in the sample's errors rather than failing it.
+//
+// Otherwise it serves as package httpserver describes, on LISTEN_ADDR
+// (default :9101) with METRICS_TOKEN as its token, and registers with the
+// gateway as host by default, so it is served under /host. In a container,
+// PROC_PATH and SYS_PATH say where the host's /proc and /sys are mounted.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/oksmith/home-server/metrics-service/collect"
+	"github.com/oksmith/home-server/pkg/config"
+	"github.com/oksmith/home-server/pkg/httpserver"
+	"github.com/oksmith/home-server/pkg/registry"
+	"github.com/oksmith/home-server/pkg/sigauth"
+)
+
+// settings are the service's settings
+var settings = []config.Field{
+	{Name: "SAMPLE_INTERVAL", Default: "15s", Check: config.PositiveDuration},
+	{Name: "HISTORY", Default: "1h", Check: config.PositiveDuration},
+	{Name: "LISTEN_ADDR", Default: ":9101", Check: config.HostPort},
+	{Name: "DISKS", Default: "/"},
+	{Name: "PROC_PATH"},
+	{Name: "SYS_PATH"},
+	{Name: "METRICS_TOKEN", Secret: true, Reload: true},
+	{Name: "TLS_CERT"},
+	{Name: "TLS_KEY"},
+	{Name: "GATEWAY_URL", Check: config.HTTPURL},
+	{Name: "GATEWAY_REGISTRY_TOKEN", Secret: true},
+	{Name: "GATEWAY_NAME", Default: "host"},
+	{Name: "GATEWAY_SERVICE_URL", Check: config.HTTPURL},
+	{Name: "AUTHORIZED_KEYS"},
+	{Name: "SERVICE_KEY"},
+}
+
+// sample adds a sample to h every interval until ctx is done
+func sample(ctx context.Context, s *collect.Sampler, h *history, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			snap := s.Sample(now)
+			for _, err := range snap.Errors {
+				slog.Debug("sampling failed", "error", err)
+			}
+			h.add(snap)
+		}
+	}
+}
+
+func main() {
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"), settings...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	interval, keep := cfg.Duration("SAMPLE_INTERVAL"), cfg.Duration("HISTORY")
+	addr := cfg.Get("LISTEN_ADDR")
+	sampler := collect.New(cfg.List("DISKS"))
+	if path := cfg.Get("PROC_PATH"); path != "" {
+		sampler.Proc = path
+	}
+	if path := cfg.Get("SYS_PATH"); path != "" {
+		sampler.Sys = path
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go cfg.Watch(ctx, config.DefaultPoll)
+	h := &history{keep: keep}
+	first := sampler.Sample(time.Now())
+	for _, err := range first.Errors {
+		log.Printf("can't sample: %s", err)
+	}
+	h.add(first)
+	go sample(ctx, sampler, h, interval)
+	log.Printf("sampling every %s, keeping %s of history", interval, keep)
+
+	keys, err := sigauth.LoadKeyring(cfg.Get("AUTHORIZED_KEYS"))
+	if err != nil {
+		log.Fatalf("AUTHORIZED_KEYS: %v", err)
+	}
+	signer, err := sigauth.LoadSigner(cfg.Get("SERVICE_KEY"))
+	if err != nil {
+		log.Fatalf("SERVICE_KEY: %v", err)
+	}
+
+	token := func() string { return cfg.Get("METRICS_TOKEN") }
+	g := httpserver.NewGuard(httpserver.DefaultLimits)
+	auth := func(next http.HandlerFunc) http.Handler {
+		return httpserver.RequireAuth("metrics-service", token, keys, g, next)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.Handle("GET /metrics", auth(func(w http.ResponseWriter, r *http.Request) {
+		snap, _ := h.latest()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		collect.WritePrometheus(w, snap)
+	}))
+	mux.Handle("GET /api/v1/metrics", auth(func(w http.ResponseWriter, r *http.Request) {
+		snap, _ := h.latest()
+		httpserver.WriteJSON(w, http.StatusOK, snap)
+	}))
+	mux.Handle("GET /api/v1/history", auth(func(w http.ResponseWriter, r *http.Request) {
+		since := keep
+		if s := r.URL.Query().Get("since"); s != "" {
+			if since, err = time.ParseDuration(s); err != nil || since <= 0 {
+				http.Error(w, fmt.Sprintf("since must be a positive duration such as 15m, not %q", s), http.StatusBadRequest)
+				return
+			}
+		}
+		httpserver.WriteJSON(w, http.StatusOK, h.since(time.Now().Add(-since)))
+	}))
+	metrics := httpserver.NewMetrics()
+	server := &http.Server{Addr: addr, Handler: g.Middleware(httpserver.InstrumentMux(metrics, slog.Default(), mux))}
+
+	certFile, keyFile := cfg.Get("TLS_CERT"), cfg.Get("TLS_KEY")
+	switch {
+	case certFile == "" && keyFile == "":
+		log.Printf("metrics-service starting on %s", addr)
+	case certFile == "" || keyFile == "":
+		log.Fatal("TLS_CERT and TLS_KEY must be set together")
+	default:
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		log.Printf("metrics-service starting on %s with TLS", addr)
+	}
+
+	var withdrawn chan struct{}
+	if gateway := cfg.Get("GATEWAY_URL"); gateway != "" {
+		s, err := registry.Local(cfg.Get("GATEWAY_NAME"), cfg.Get("GATEWAY_SERVICE_URL"), addr, server.TLSConfig != nil)
+		if err != nil {
+			log.Fatalf("GATEWAY_URL: %v", err)
+		}
+		withdrawn = make(chan struct{})
+		go func() {
+			registry.Announce(ctx, gateway, cfg.Get("GATEWAY_REGISTRY_TOKEN"), signer, func() registry.Service {
+				s.Token = token()
+				return s
+			}, registry.DefaultTTL/3)
+			close(withdrawn)
+		}()
+	}
+	if err := httpserver.ListenAndServe(ctx, server, certFile, keyFile); err != nil {
+		log.Fatal(err)
+	}
+	if withdrawn != nil {
+		<-withdrawn
+	}
+	log.Println("metrics-service stopped")
+}
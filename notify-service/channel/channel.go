@@ -0,0 +1,241 @@
+// Package channel delivers notifications through webhooks, email, Telegram,
+// ntfy and MQTT
+package channel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/smtp"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/oksmith/home-server/pkg/mqtt"
+	"github.com/oksmith/home-server/pkg/notify"
+)
+
+// Channel delivers messages somewhere
+type Channel interface {
+	Send(ctx context.Context, m notify.Message) error
+}
+
+// Title is a message's title, prefixed with the host it came from
+func Title(m notify.Message) string {
+	if m.Host != "" {
+		return m.Host + ": " + m.Title
+	}
+	return m.Title
+}
+
+// Webhook POSTs each message as JSON
+type Webhook struct {
+	URL string
+}
+
+func (w Webhook) Send(ctx context.Context, m notify.Message) error {
+	body, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return post(ctx, w.URL, "application/json", body, nil)
+}
+
+// Ntfy publishes each message to an ntfy topic such as https://ntfy.sh/my-server
+type Ntfy struct {
+	URL   string
+	Token string // for protected topics
+}
+
+// ntfyPriorities maps priorities to ntfy's, leaving normal as ntfy's default
+var ntfyPriorities = map[string]string{notify.Low: "low", notify.High: "high", notify.Urgent: "urgent"}
+
+func (n Ntfy) Send(ctx context.Context, m notify.Message) error {
+	headers := map[string]string{"Title": Title(m), "Tags": m.Event}
+	if p, ok := ntfyPriorities[m.Priority]; ok {
+		headers["Priority"] = p
+	}
+	if n.Token != "" {
+		headers["Authorization"] = "Bearer " + n.Token
+	}
+	return post(ctx, n.URL, "text/plain", []byte(m.Body()), headers)
+}
+
+// Telegram sends each message from a bot to a chat
+type Telegram struct {
+	BotToken string
+	ChatID   string
+	APIURL   string // https://api.telegram.org unless set
+}
+
+func (t Telegram) Send(ctx context.Context, m notify.Message) error {
+	api := t.APIURL
+	if api == "" {
+		api = "https://api.telegram.org"
+	}
+	text := Title(m)
+	if m.Text != "" {
+		text += "\n" + m.Text
+	}
+	body, err := json.Marshal(map[string]string{
+		"chat_id": t.ChatID,
+		"text":    text,
+	})
+	if err != nil {
+		return err
+	}
+	return post(ctx, api+"/bot"+t.BotToken+"/sendMessage", "application/json", body, nil)
+}
+
+// Email sends each message through an SMTP server
+type Email struct {
+	Addr     string // host:port, e.g. smtp.example.com:587
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+func (e Email) Send(ctx context.Context, m notify.Message) error {
+	var auth smtp.Auth
+	if e.Username != "" {
+		host, _, _ := strings.Cut(e.Addr, ":")
+		auth = smtp.PlainAuth("", e.Username, e.Password, host)
+	}
+	// smtp.SendMail can't be cancelled, so give up waiting for it instead
+	done := make(chan error, 1)
+	go func() { done <- smtp.SendMail(e.Addr, auth, e.From, e.To, e.message(m)) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// message builds the email for a message, with its fields after the text
+func (e Email) message(m notify.Message) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", e.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", Title(m))
+	fmt.Fprintf(&b, "Date: %s\r\n", m.Time.Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(m.Body(), "\n", "\r\n") + "\r\n")
+	if len(m.Fields) > 0 {
+		b.WriteString("\r\n")
+		for _, k := range slices.Sorted(maps.Keys(m.Fields)) {
+			fmt.Fprintf(&b, "%s: %s\r\n", k, m.Fields[k])
+		}
+	}
+	return b.Bytes()
+}
+
+// MQTT publishes each message as JSON to TOPIC/SOURCE/EVENT, connecting for
+// each one, as notifications are rare
+type MQTT struct {
+	Options mqtt.Options
+	Topic   string
+}
+
+func (q MQTT) Send(ctx context.Context, m notify.Message) error {
+	body, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	// A client ID of its own, so the broker doesn't drop one sending alongside
+	opts := q.Options
+	opts.ClientID = fmt.Sprintf("%s-%x", opts.ClientID, time.Now().UnixNano()&0xffffff)
+	client, err := mqtt.Dial(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return client.Publish(q.Topic+"/"+m.Source+"/"+m.Event, body, false)
+}
+
+// Config is a channel's settings, as the hub's file gives them
+type Config struct {
+	Type string `json:"type"` // webhook, ntfy, telegram, email or mqtt
+
+	URL      string   `json:"url"`       // webhook, ntfy, mqtt
+	Token    string   `json:"token"`     // ntfy
+	BotToken string   `json:"bot_token"` // telegram
+	ChatID   string   `json:"chat_id"`   // telegram
+	SMTP     string   `json:"smtp"`      // email
+	Username string   `json:"username"`  // email
+	Password string   `json:"password"`  // email
+	From     string   `json:"from"`      // email
+	To       []string `json:"to"`        // email
+	Topic    string   `json:"topic"`     // mqtt, default homeserver/notify
+}
+
+// New checks a channel's settings and builds it
+func New(c Config) (Channel, error) {
+	switch c.Type {
+	case "webhook":
+		if c.URL == "" {
+			return nil, fmt.Errorf("needs a url")
+		}
+		return Webhook{URL: c.URL}, nil
+	case "ntfy":
+		if c.URL == "" {
+			return nil, fmt.Errorf("needs a url such as https://ntfy.sh/TOPIC")
+		}
+		return Ntfy{URL: c.URL, Token: c.Token}, nil
+	case "telegram":
+		if c.BotToken == "" || c.ChatID == "" {
+			return nil, fmt.Errorf("needs a bot_token and chat_id")
+		}
+		return Telegram{BotToken: c.BotToken, ChatID: c.ChatID, APIURL: c.URL}, nil
+	case "email":
+		if c.SMTP == "" || c.From == "" || len(c.To) == 0 {
+			return nil, fmt.Errorf("needs smtp, from and to")
+		}
+		return Email{Addr: c.SMTP, Username: c.Username, Password: c.Password, From: c.From, To: c.To}, nil
+	case "mqtt":
+		opts, err := mqtt.ParseURL(c.URL)
+		if err != nil {
+			return nil, fmt.Errorf("url %w", err)
+		}
+		host, err := os.Hostname()
+		if err != nil {
+			host = "server"
+		}
+		opts.ClientID = "notify-service-" + host
+		topic := strings.TrimSuffix(c.Topic, "/")
+		if topic == "" {
+			topic = "homeserver/notify"
+		}
+		return MQTT{Options: opts, Topic: topic}, nil
+	default:
+		return nil, fmt.Errorf("unknown type %q; use webhook, ntfy, telegram, email or mqtt", c.Type)
+	}
+}
+
+// post sends body to url, failing unless the reply is a 2xx
+func post(ctx context.Context, url, contentType string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
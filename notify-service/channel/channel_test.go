@@ -0,0 +1,208 @@
+package channel
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oksmith/home-server/pkg/notify"
+)
+
+// recorder is a test server that keeps every request it gets
+type recorder struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   []string
+}
+
+func newRecorder(t *testing.T, status int) *recorder {
+	r := &recorder{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		r.requests = append(r.requests, req)
+		r.bodies = append(r.bodies, string(body))
+		r.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+var message = notify.Message{Source: "shutdown-service", Event: "executed", Priority: notify.High, Host: "media",
+	Title: "shutdown executed", Text: "shutting down now"}
+
+func TestWebhook(t *testing.T) {
+	r := newRecorder(t, http.StatusOK)
+	if err := (Webhook{URL: r.URL}).Send(context.Background(), message); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	var got notify.Message
+	if err := json.Unmarshal([]byte(r.bodies[0]), &got); err != nil || got.Event != "executed" || got.Source != "shutdown-service" {
+		t.Errorf("expected the message as JSON, got %s (%v)", r.bodies[0], err)
+	}
+
+	failing := newRecorder(t, http.StatusInternalServerError)
+	if err := (Webhook{URL: failing.URL}).Send(context.Background(), message); err == nil {
+		t.Error("expected a 500 reply to be an error")
+	}
+}
+
+func TestNtfy(t *testing.T) {
+	r := newRecorder(t, http.StatusOK)
+	if err := (Ntfy{URL: r.URL + "/topic", Token: "tk"}).Send(context.Background(), message); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	req := r.requests[0]
+	if req.URL.Path != "/topic" || r.bodies[0] != "shutting down now" {
+		t.Errorf("expected the message posted to the topic, got %s %q", req.URL.Path, r.bodies[0])
+	}
+	if req.Header.Get("Title") != "media: shutdown executed" || req.Header.Get("Priority") != "high" || req.Header.Get("Tags") != "executed" {
+		t.Errorf("unexpected headers %v", req.Header)
+	}
+	if req.Header.Get("Authorization") != "Bearer tk" {
+		t.Errorf("expected the token to be sent, got %q", req.Header.Get("Authorization"))
+	}
+
+	// Normal messages leave the priority to ntfy, and a title stands in for missing text
+	r = newRecorder(t, http.StatusOK)
+	if err := (Ntfy{URL: r.URL}).Send(context.Background(), notify.Message{Event: "reorg", Title: "chain reorganised"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if r.requests[0].Header.Get("Priority") != "" || r.bodies[0] != "chain reorganised" {
+		t.Errorf("got priority %q, body %q", r.requests[0].Header.Get("Priority"), r.bodies[0])
+	}
+}
+
+func TestTelegram(t *testing.T) {
+	r := newRecorder(t, http.StatusOK)
+	tg := Telegram{BotToken: "123:abc", ChatID: "42", APIURL: r.URL}
+	if err := tg.Send(context.Background(), message); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if r.requests[0].URL.Path != "/bot123:abc/sendMessage" {
+		t.Errorf("unexpected path %s", r.requests[0].URL.Path)
+	}
+	var msg map[string]string
+	json.Unmarshal([]byte(r.bodies[0]), &msg)
+	if msg["chat_id"] != "42" || msg["text"] != "media: shutdown executed\nshutting down now" {
+		t.Errorf("unexpected message %v", msg)
+	}
+}
+
+func TestEmailMessage(t *testing.T) {
+	e := Email{From: "server@example.com", To: []string{"a@example.com", "b@example.com"}}
+	m := notify.Message{Event: "cancelled", Host: "media", Title: "reboot cancelled", Text: "never mind\nReason: done",
+		Fields: map[string]string{"reason": "done", "action": "reboot"}, Time: time.Now()}
+	msg := string(e.message(m))
+	for _, want := range []string{
+		"To: a@example.com, b@example.com\r\n",
+		"Subject: media: reboot cancelled\r\n",
+		"\r\n\r\nnever mind\r\nReason: done\r\n\r\naction: reboot\r\nreason: done\r\n",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected %q in\n%s", want, msg)
+		}
+	}
+}
+
+func TestMQTT(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	published := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			header, body, err := readPacket(r)
+			if err != nil {
+				return
+			}
+			switch header >> 4 {
+			case 1: // CONNECT
+				conn.Write([]byte{0x20, 2, 0, 0})
+			case 3: // PUBLISH
+				published <- body
+			}
+		}
+	}()
+
+	ch, err := New(Config{Type: "mqtt", URL: "mqtt://" + ln.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ch.Send(context.Background(), message); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	select {
+	case body := <-published:
+		topicLen := int(body[0])<<8 | int(body[1])
+		topic, payload := string(body[2:2+topicLen]), body[2+topicLen:]
+		var got notify.Message
+		if topic != "homeserver/notify/shutdown-service/executed" || json.Unmarshal(payload, &got) != nil || got.Title != message.Title {
+			t.Errorf("got %s %s", topic, payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("nothing published")
+	}
+}
+
+// readPacket reads one MQTT packet's first byte and body
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, shift := 0, 0
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		shift += 7
+	}
+	body := make([]byte, length)
+	_, err = io.ReadFull(r, body)
+	return header, body, err
+}
+
+func TestNew(t *testing.T) {
+	for _, bad := range []Config{
+		{Type: "pager"},
+		{Type: "webhook"},
+		{Type: "telegram", BotToken: "x"},
+		{Type: "email", SMTP: "localhost:25"},
+		{Type: "mqtt", URL: "http://broker"},
+	} {
+		if _, err := New(bad); err == nil {
+			t.Errorf("expected %+v to be refused", bad)
+		}
+	}
+	ch, err := New(Config{Type: "mqtt", URL: "mqtts://u:p@broker.lan", Topic: "alerts/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q := ch.(MQTT); q.Topic != "alerts" || q.Options.Addr != "broker.lan:8883" || q.Options.Username != "u" {
+		t.Errorf("got %+v", q)
+	}
+}
@@ -0,0 +1,7 @@
+module github.com/oksmith/home-server/notify-service
+
+go 1.24.5
+
+require github.com/oksmith/home-server/pkg v0.0.0
+
+replace github.com/oksmith/home-server/pkg => ../pkg
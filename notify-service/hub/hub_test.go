@@ -0,0 +1,109 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/oksmith/home-server/notify-service/channel"
+	"github.com/oksmith/home-server/pkg/notify"
+)
+
+// fake is a channel that remembers what it was sent
+type fake struct {
+	mu   sync.Mutex
+	sent []notify.Message
+	err  error
+}
+
+func (f *fake) Send(ctx context.Context, m notify.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, m)
+	return f.err
+}
+
+func TestRoute(t *testing.T) {
+	channels := map[string]channel.Channel{"phone": &fake{}, "mail": &fake{}, "ha": &fake{}}
+	h, err := New(channels, []Route{
+		{Source: "node", Events: []string{"block_found"}, To: []string{"phone"}, Final: true},
+		{MinPriority: notify.High, To: []string{"phone", "mail"}},
+		{Host: "nas", To: []string{"mail"}},
+		{To: []string{"ha"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		m    notify.Message
+		want []string
+	}{
+		{notify.Message{Source: "node", Event: "block_found", Priority: notify.Urgent}, []string{"phone"}},
+		{notify.Message{Source: "node", Event: "reorg", Priority: notify.High}, []string{"phone", "mail", "ha"}},
+		{notify.Message{Source: "backup-service", Event: "backup_succeeded", Priority: notify.Low, Host: "nas"}, []string{"mail", "ha"}},
+		{notify.Message{Source: "shutdown-service", Event: "scheduled"}, []string{"ha"}},
+	} {
+		if got := h.Route(tc.m); !slices.Equal(got, tc.want) {
+			t.Errorf("%s from %s: got %v, want %v", tc.m.Event, tc.m.Source, got, tc.want)
+		}
+	}
+
+	everywhere, err := New(channels, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := everywhere.Route(notify.Message{Event: "x"}); !slices.Equal(got, []string{"ha", "mail", "phone"}) {
+		t.Errorf("without routes: got %v", got)
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	phone, mail := &fake{}, &fake{err: errors.New("smtp down")}
+	h, err := New(map[string]channel.Channel{"phone": phone, "mail": mail}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := h.Deliver(context.Background(), notify.Message{Source: "node", Event: "reorg", Title: "Reorg"})
+	want := []Result{{Channel: "mail", Error: "smtp down"}, {Channel: "phone"}}
+	if !slices.Equal(results, want) {
+		t.Errorf("got %+v, want %+v", results, want)
+	}
+	if len(phone.sent) != 1 || phone.sent[0].Title != "Reorg" {
+		t.Errorf("phone got %+v", phone.sent)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "notify.json")
+	os.WriteFile(filename, []byte(`{
+		"channels": {
+			"phone": {"type": "ntfy", "url": "https://ntfy.sh/t"},
+			"ha": {"type": "mqtt", "url": "mqtt://broker.lan"}
+		},
+		"routes": [{"min_priority": "high", "to": ["phone"]}, {"to": ["ha"]}]
+	}`), 0600)
+	h, err := Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Len() != 2 {
+		t.Errorf("got %d channels", h.Len())
+	}
+
+	for _, bad := range []string{
+		`[]`,
+		`{"channels": {}}`,
+		`{"channels": {"x": {"type": "pager"}}}`,
+		`{"channels": {"x": {"type": "webhook", "url": "http://x"}}, "routes": [{"to": ["y"]}]}`,
+		`{"channels": {"x": {"type": "webhook", "url": "http://x"}}, "routes": [{"source": "node"}]}`,
+		`{"channels": {"x": {"type": "webhook", "url": "http://x"}}, "routes": [{"min_priority": "loud", "to": ["x"]}]}`,
+	} {
+		if _, err := Parse([]byte(bad)); err == nil {
+			t.Errorf("expected %s to be refused", bad)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Command notify-service is the home-server's notification hub. The other
+// services POST what happened to it, and it passes each message on to email,
+// Telegram, ntfy, MQTT or webhooks as its routing rules say, so channels and
+// their credentials are set up once instead of in every service.
+//
+// NOTIFY_FILE is a JSON file naming the channels and the routes to them; see
+// hub.Parse for the format. Routes match messages by source, event, host and
+// minimum priority, and with none, every message goes everywhere.
+//
+// POST /notify takes a message as JSON, the fields of notify.Message:
+//
+//	{"source": "backup-service", "event": "backup_failed", "priority": "high",
+//	 "host": "nas", "title": "Backup of photos failed", "text": "...",
+//	 "fields": {"job": "photos"}}
+//
+// priority is low, normal (the default), high or urgent. It answers 202 at
+// once with the channels the message is going to, or with ?wait=true, once
+// delivery has finished, with how each channel went: 200 if all succeeded,
+// or 502. Package notify in pkg is the client the services use.
+//
+// Otherwise it serves as package httpserver describes, on LISTEN_ADDR
+// (default :8097) with NOTIFY_TOKEN as its token, and registers with the
+// gateway as notify by default. A node can sign its messages with the
+// wallet key it already has rather than hold NOTIFY_TOKEN.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/oksmith/home-server/notify-service/hub"
+	"github.com/oksmith/home-server/pkg/config"
+	"github.com/oksmith/home-server/pkg/httpserver"
+	"github.com/oksmith/home-server/pkg/notify"
+	"github.com/oksmith/home-server/pkg/registry"
+	"github.com/oksmith/home-server/pkg/sigauth"
+)
+
+// maxMessage caps the size of a message
+const maxMessage = 64 << 10
+
+// settings are the service's settings
+var settings = []config.Field{
+	{Name: "NOTIFY_FILE", Required: true},
+	{Name: "LISTEN_ADDR", Default: ":8097", Check: config.HostPort},
+	{Name: "NOTIFY_TOKEN", Secret: true, Reload: true},
+	{Name: "TLS_CERT"},
+	{Name: "TLS_KEY"},
+	{Name: "GATEWAY_URL", Check: config.HTTPURL},
+	{Name: "GATEWAY_REGISTRY_TOKEN", Secret: true},
+	{Name: "GATEWAY_NAME", Default: "notify"},
+	{Name: "GATEWAY_SERVICE_URL", Check: config.HTTPURL},
+	{Name: "AUTHORIZED_KEYS"},
+	{Name: "SERVICE_KEY"},
+}
+
+// notifyHandler takes a message and delivers it
+func notifyHandler(h *hub.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var m notify.Message
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMessage)).Decode(&m); err != nil {
+			http.Error(w, "invalid message: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := m.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if m.Time.IsZero() {
+			m.Time = time.Now()
+		}
+		to := h.Route(m)
+		log.Printf("%s from %s to %v", m.Event, m.Source, to)
+
+		if r.URL.Query().Get("wait") != "true" {
+			go h.Deliver(context.WithoutCancel(r.Context()), m)
+			httpserver.WriteJSON(w, http.StatusAccepted, map[string][]string{"channels": to})
+			return
+		}
+		results := h.Deliver(r.Context(), m)
+		status := http.StatusOK
+		for _, res := range results {
+			if res.Error != "" {
+				status = http.StatusBadGateway
+			}
+		}
+		httpserver.WriteJSON(w, status, map[string][]hub.Result{"channels": results})
+	}
+}
+
+func main() {
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"), settings...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	h, err := hub.Load(cfg.Get("NOTIFY_FILE"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	addr := cfg.Get("LISTEN_ADDR")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go cfg.Watch(ctx, config.DefaultPoll)
+
+	keys, err := sigauth.LoadKeyring(cfg.Get("AUTHORIZED_KEYS"))
+	if err != nil {
+		log.Fatalf("AUTHORIZED_KEYS: %v", err)
+	}
+	signer, err := sigauth.LoadSigner(cfg.Get("SERVICE_KEY"))
+	if err != nil {
+		log.Fatalf("SERVICE_KEY: %v", err)
+	}
+
+	token := func() string { return cfg.Get("NOTIFY_TOKEN") }
+	g := httpserver.NewGuard(httpserver.DefaultLimits)
+	auth := func(next http.HandlerFunc) http.Handler {
+		return httpserver.RequireAuth("notify-service", token, keys, g, next)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.Handle("POST /notify", auth(notifyHandler(h)))
+	metrics := httpserver.NewMetrics()
+	server := &http.Server{Addr: addr, Handler: g.Middleware(httpserver.InstrumentMux(metrics, slog.Default(), mux))}
+
+	certFile, keyFile := cfg.Get("TLS_CERT"), cfg.Get("TLS_KEY")
+	switch {
+	case certFile == "" && keyFile == "":
+		log.Printf("notify-service starting on %s with %d channels", addr, h.Len())
+	case certFile == "" || keyFile == "":
+		log.Fatal("TLS_CERT and TLS_KEY must be set together")
+	default:
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		log.Printf("notify-service starting on %s with TLS and %d channels", addr, h.Len())
+	}
+
+	var withdrawn chan struct{}
+	if gateway := cfg.Get("GATEWAY_URL"); gateway != "" {
+		s, err := registry.Local(cfg.Get("GATEWAY_NAME"), cfg.Get("GATEWAY_SERVICE_URL"), addr, server.TLSConfig != nil)
+		if err != nil {
+			log.Fatalf("GATEWAY_URL: %v", err)
+		}
+		withdrawn = make(chan struct{})
+		go func() {
+			registry.Announce(ctx, gateway, cfg.Get("GATEWAY_REGISTRY_TOKEN"), signer, func() registry.Service {
+				s.Token = token()
+				return s
+			}, registry.DefaultTTL/3)
+			close(withdrawn)
+		}()
+	}
+	if err := httpserver.ListenAndServe(ctx, server, certFile, keyFile); err != nil {
+		log.Fatal(err)
+	}
+	if withdrawn != nil {
+		<-withdrawn
+	}
+	log.Println("notify-service stopped")
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PositiveDuration checks for a duration above zero, such as 15s
+func PositiveDuration(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("must be a positive duration such as 15s, not %q", s)
+	}
+	return nil
+}
+
+// IntBetween checks for a whole number from min to max
+func IntBetween(min, max int) func(string) error {
+	return func(s string) error {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < min || n > max {
+			return fmt.Errorf("must be a whole number from %d to %d, not %q", min, max, s)
+		}
+		return nil
+	}
+}
+
+// NumberBetween checks for a number from min to max
+func NumberBetween(min, max float64) func(string) error {
+	return func(s string) error {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || f < min || f > max {
+			return fmt.Errorf("must be a number from %g to %g, not %q", min, max, s)
+		}
+		return nil
+	}
+}
+
+// Boolean checks for true or false, or another form strconv accepts
+func Boolean(s string) error {
+	if _, err := strconv.ParseBool(s); err != nil {
+		return fmt.Errorf("must be true or false, not %q", s)
+	}
+	return nil
+}
+
+// HTTPURL checks for an http or https URL
+func HTTPURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("must be an http:// or https:// URL, not %q", s)
+	}
+	return nil
+}
+
+// HostPort checks for an address to listen on or dial, such as :8080
+func HostPort(s string) error {
+	if _, _, err := net.SplitHostPort(s); err != nil {
+		return fmt.Errorf("must be host:port, not %q", s)
+	}
+	return nil
+}
+
+// OneOf checks for one of the given values
+func OneOf(values ...string) func(string) error {
+	return func(s string) error {
+		if !slices.Contains(values, s) {
+			return fmt.Errorf("must be one of %s, not %q", strings.Join(values, ", "), s)
+		}
+		return nil
+	}
+}
+
+// Each applies check to every item of a comma-separated list
+func Each(check func(string) error) func(string) error {
+	return func(s string) error {
+		for _, item := range SplitList(s) {
+			if err := check(item); err != nil {
+				return fmt.Errorf("%s: %w", item, err)
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,357 @@
+// Package config loads the home-server services' settings in layers, from
+// built-in defaults, a settings file and the environment, checks them
+// against a schema and resolves references to secrets kept elsewhere. It can
+// reload them on SIGHUP or when the file changes, so a token or a list of
+// peers can change without restarting the service.
+//
+// A settings file holds one setting per line as NAME=value or name = value,
+// optionally starting with export. Blank lines and lines starting with # or ;
+// are ignored, and a value may be quoted. This reads both systemd-style
+// environment files and the node's config file.
+//
+// Any value may include ${file:PATH}, replaced by that file's contents
+// without the final newline, ${env:NAME}, replaced by an environment
+// variable, or ${cred:NAME}, replaced by a systemd credential from
+// $CREDENTIALS_DIRECTORY, so secrets needn't be written into the settings
+// file itself.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxFileSize bounds a settings file, or a secret file it refers to
+const maxFileSize = 1 << 20
+
+// Field describes one setting
+type Field struct {
+	// Name is the setting's key in the file. One that looks like an
+	// environment variable (upper case letters, digits and underscores) can
+	// also be set by that variable, unless Env says otherwise.
+	Name string
+	// Env is another environment variable that overrides the file, if any
+	Env      string
+	Default  string
+	Required bool
+	Secret   bool               // shown as ******** by Settings
+	Reload   bool               // may change while running; others need a restart
+	Check    func(string) error // checks a value that isn't empty
+}
+
+// envVar is the variable that overrides a field, if any
+func (f Field) envVar() string {
+	if f.Env != "" {
+		return f.Env
+	}
+	for _, r := range f.Name {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '_' {
+			return ""
+		}
+	}
+	return f.Name
+}
+
+// Sources of a value
+const (
+	FromDefault = "default"
+	FromFile    = "file"
+	FromEnv     = "env"
+)
+
+// value is a setting's resolved value
+type value struct {
+	text   string
+	source string
+}
+
+// Config holds the current settings. It is safe to use from several
+// goroutines while reloading.
+type Config struct {
+	file   string
+	fields []Field
+	index  map[string]int
+
+	mu      sync.RWMutex
+	values  map[string]value
+	secrets []string // files referred to by ${file:...} and ${cred:...}
+	hooks   []func(changed []string)
+}
+
+// Load reads the settings for fields from filename, if it isn't empty, and
+// the environment, which overrides the file. Every problem found is
+// reported, not just the first.
+func Load(filename string, fields ...Field) (*Config, error) {
+	c := &Config{file: filename, fields: fields, index: map[string]int{}}
+	for i, f := range fields {
+		if _, dup := c.index[f.Name]; dup {
+			panic("config: " + f.Name + " is defined twice")
+		}
+		c.index[f.Name] = i
+	}
+	values, secrets, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+	c.values, c.secrets = values, secrets
+	return c, nil
+}
+
+// File is the settings file, if there is one
+func (c *Config) File() string {
+	return c.file
+}
+
+// read loads every layer and checks the result
+func (c *Config) read() (map[string]value, []string, error) {
+	values := map[string]value{}
+	for _, f := range c.fields {
+		values[f.Name] = value{f.Default, FromDefault}
+	}
+	var errs []error
+	if c.file != "" {
+		data, err := readLimited(c.file)
+		if err != nil {
+			return nil, nil, err
+		}
+		entries, err := Parse(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", c.file, err)
+		}
+		for _, e := range entries {
+			if _, ok := c.index[e.Name]; !ok {
+				errs = append(errs, fmt.Errorf("%s:%d: unknown setting %q", c.file, e.Line, e.Name))
+				continue
+			}
+			values[e.Name] = value{e.Value, FromFile}
+		}
+	}
+	for _, f := range c.fields {
+		if env := f.envVar(); env != "" {
+			if v, ok := os.LookupEnv(env); ok {
+				values[f.Name] = value{v, FromEnv}
+			}
+		}
+	}
+
+	var secrets []string
+	for _, f := range c.fields {
+		v := values[f.Name]
+		text, files, err := resolve(v.text)
+		secrets = append(secrets, files...)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("%s: %w", f.Name, err))
+		case text == "" && f.Required:
+			errs = append(errs, fmt.Errorf("%s must be set", f.Name))
+		case text != "" && f.Check != nil:
+			if err := f.Check(text); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", f.Name, err))
+			}
+		}
+		values[f.Name] = value{text, v.source}
+	}
+	if len(errs) > 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+	return values, secrets, nil
+}
+
+// readLimited reads a file, refusing one too large to hold settings
+func readLimited(filename string) ([]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxFileSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", filename, maxFileSize)
+	}
+	return data, nil
+}
+
+// secretRef matches a reference to a secret in a value
+var secretRef = regexp.MustCompile(`\$\{(file|env|cred):([^}]*)\}`)
+
+// resolve replaces the secret references in s, returning the files read
+func resolve(s string) (string, []string, error) {
+	var files []string
+	var err error
+	out := secretRef.ReplaceAllStringFunc(s, func(ref string) string {
+		m := secretRef.FindStringSubmatch(ref)
+		kind, name := m[1], m[2]
+		if name == "" {
+			err = fmt.Errorf("%s names nothing", ref)
+			return ""
+		}
+		switch kind {
+		case "env":
+			v, ok := os.LookupEnv(name)
+			if !ok {
+				err = fmt.Errorf("%s: %s isn't set", ref, name)
+			}
+			return v
+		case "cred":
+			dir := os.Getenv("CREDENTIALS_DIRECTORY")
+			if dir == "" {
+				err = fmt.Errorf("%s: CREDENTIALS_DIRECTORY isn't set; is LoadCredential= in the unit?", ref)
+				return ""
+			}
+			name = dir + string(os.PathSeparator) + name
+		}
+		files = append(files, name)
+		data, readErr := readLimited(name)
+		if readErr != nil {
+			err = readErr
+			return ""
+		}
+		return strings.TrimRight(string(data), "\r\n")
+	})
+	return out, files, err
+}
+
+// field returns the definition of a setting, which must exist
+func (c *Config) field(name string) Field {
+	i, ok := c.index[name]
+	if !ok {
+		panic("config: unknown setting " + name)
+	}
+	return c.fields[i]
+}
+
+// Get returns a setting's value
+func (c *Config) Get(name string) string {
+	c.field(name)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.values[name].text
+}
+
+// Source says where a setting's value came from: FromDefault, FromFile or
+// FromEnv
+func (c *Config) Source(name string) string {
+	c.field(name)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.values[name].source
+}
+
+// Duration returns a setting as a duration, or 0 if it is empty
+func (c *Config) Duration(name string) time.Duration {
+	d, _ := time.ParseDuration(c.Get(name))
+	return d
+}
+
+// Int returns a setting as an integer, or 0 if it is empty
+func (c *Config) Int(name string) int {
+	n, _ := strconv.Atoi(c.Get(name))
+	return n
+}
+
+// Float returns a setting as a number, or 0 if it is empty
+func (c *Config) Float(name string) float64 {
+	f, _ := strconv.ParseFloat(c.Get(name), 64)
+	return f
+}
+
+// Bool returns a setting as a boolean, false if it is empty
+func (c *Config) Bool(name string) bool {
+	b, _ := strconv.ParseBool(c.Get(name))
+	return b
+}
+
+// List splits a comma-separated setting, dropping empty items
+func (c *Config) List(name string) []string {
+	return SplitList(c.Get(name))
+}
+
+// SplitList splits a comma-separated value, dropping empty items
+func SplitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Setting is a setting's current value and where it came from
+type Setting struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+	Reload bool   `json:"reload"` // changes without a restart
+}
+
+// Settings lists every setting in the order they were defined, with secrets
+// hidden, for showing the effective configuration
+func (c *Config) Settings() []Setting {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	settings := make([]Setting, 0, len(c.fields))
+	for _, f := range c.fields {
+		v := c.values[f.Name]
+		if f.Secret && v.text != "" {
+			v.text = "********"
+		}
+		settings = append(settings, Setting{Name: f.Name, Value: v.text, Source: v.source, Reload: f.Reload})
+	}
+	return settings
+}
+
+// OnReload calls fn after each reload that changes any settings marked
+// Reload, with their names
+func (c *Config) OnReload(fn func(changed []string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hooks = append(c.hooks, fn)
+}
+
+// Reload reads the settings again. If they are no longer valid, nothing
+// changes and the error says why. Settings that can only change on a restart
+// keep their values, with a warning logged if they differ.
+func (c *Config) Reload() error {
+	values, secrets, err := c.read()
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	var changed []string
+	for _, f := range c.fields {
+		old, v := c.values[f.Name], values[f.Name]
+		if old.text == v.text {
+			continue
+		}
+		if !f.Reload {
+			slog.Warn("setting changed, restart to apply it", "setting", f.Name, "file", c.file)
+			values[f.Name] = old
+			continue
+		}
+		changed = append(changed, f.Name)
+	}
+	c.values, c.secrets = values, secrets
+	hooks := slices.Clone(c.hooks)
+	c.mu.Unlock()
+
+	if len(changed) > 0 {
+		slog.Info("settings reloaded", "changed", strings.Join(changed, ","))
+		for _, fn := range hooks {
+			fn(changed)
+		}
+	}
+	return nil
+}
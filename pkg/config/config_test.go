@@ -0,0 +1,187 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLayers(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.env")
+	writeFile(t, file, `# settings
+export LISTEN_ADDR=:9000
+NAME="home server"
+; also a comment
+peers = 'a:1, b:2'
+`)
+	t.Setenv("NAME", "from env")
+	c, err := Load(file,
+		Field{Name: "LISTEN_ADDR", Default: ":8000", Check: HostPort},
+		Field{Name: "NAME"},
+		Field{Name: "peers", Check: Each(HostPort)},
+		Field{Name: "INTERVAL", Default: "15s", Check: PositiveDuration},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct{ name, value, source string }{
+		{"LISTEN_ADDR", ":9000", FromFile},
+		{"NAME", "from env", FromEnv},
+		{"peers", "a:1, b:2", FromFile},
+		{"INTERVAL", "15s", FromDefault},
+	} {
+		if got := c.Get(tc.name); got != tc.value {
+			t.Errorf("%s = %q, want %q", tc.name, got, tc.value)
+		}
+		if got := c.Source(tc.name); got != tc.source {
+			t.Errorf("%s came from %s, want %s", tc.name, got, tc.source)
+		}
+	}
+	if got := c.List("peers"); !slices.Equal(got, []string{"a:1", "b:2"}) {
+		t.Errorf("peers = %q", got)
+	}
+	if got := c.Duration("INTERVAL"); got != 15*time.Second {
+		t.Errorf("INTERVAL = %v", got)
+	}
+}
+
+func TestEnvVar(t *testing.T) {
+	t.Setenv("admin-token", "ignored")
+	t.Setenv("NODE_ADMIN_TOKEN", "secret")
+	c, err := Load("", Field{Name: "admin-token", Env: "NODE_ADMIN_TOKEN"}, Field{Name: "peers"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Get("admin-token"); got != "secret" {
+		t.Errorf("admin-token = %q", got)
+	}
+	t.Setenv("peers", "a:1")
+	if c, _ := Load("", Field{Name: "peers"}); c.Get("peers") != "" {
+		t.Error("a lower-case setting was read from the environment")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.env")
+	writeFile(t, file, "PORT=abc\nUNKNOWN=1\n")
+	_, err := Load(file,
+		Field{Name: "PORT", Check: IntBetween(1, 65535)},
+		Field{Name: "TOKEN", Required: true},
+		Field{Name: "MODE", Default: "fast", Check: OneOf("slow", "medium")},
+	)
+	if err == nil {
+		t.Fatal("loaded invalid settings")
+	}
+	for _, want := range []string{"PORT: must be a whole number", "unknown setting \"UNKNOWN\"", "TOKEN must be set", "MODE: must be one of slow, medium"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't mention %q", err, want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, bad := range []string{"novalue\n", "=x\n", "A=1\nA=2\n", `A="unterminated` + "\n"} {
+		if _, err := Parse([]byte(bad)); err == nil {
+			t.Errorf("parsed %q", bad)
+		}
+	}
+	entries, err := Parse([]byte("A = \"x\\ty\"\nB=\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Value != "x\ty" || entries[1].Value != "" || entries[1].Line != 2 {
+		t.Errorf("parsed %+v", entries)
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "token"), "from-file\n")
+	writeFile(t, filepath.Join(dir, "cred"), "from-cred")
+	t.Setenv("CREDENTIALS_DIRECTORY", dir)
+	t.Setenv("PASSWORD", "from-env")
+	t.Setenv("TOKEN", "${file:"+filepath.Join(dir, "token")+"}")
+	t.Setenv("DSN", "user:${env:PASSWORD}@host/${cred:cred}")
+	c, err := Load("", Field{Name: "TOKEN", Secret: true}, Field{Name: "DSN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Get("TOKEN"); got != "from-file" {
+		t.Errorf("TOKEN = %q", got)
+	}
+	if got := c.Get("DSN"); got != "user:from-env@host/from-cred" {
+		t.Errorf("DSN = %q", got)
+	}
+	if s := c.Settings(); s[0].Value != "********" || s[1].Value != "user:from-env@host/from-cred" {
+		t.Errorf("settings = %+v", s)
+	}
+
+	t.Setenv("TOKEN", "${file:"+filepath.Join(dir, "missing")+"}")
+	if _, err := Load("", Field{Name: "TOKEN"}); err == nil {
+		t.Error("loaded a missing secret file")
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	file, secret := filepath.Join(dir, "test.env"), filepath.Join(dir, "token")
+	writeFile(t, secret, "one")
+	writeFile(t, file, "TOKEN=${file:"+secret+"}\nLISTEN_ADDR=:9000\n")
+	c, err := Load(file,
+		Field{Name: "TOKEN", Required: true, Reload: true},
+		Field{Name: "LISTEN_ADDR", Check: HostPort},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := make(chan []string, 10)
+	c.OnReload(func(changed []string) { changes <- changed })
+
+	// Settings that need a restart keep their values
+	writeFile(t, file, "TOKEN=${file:"+secret+"}\nLISTEN_ADDR=:9001\n")
+	if err := c.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Get("LISTEN_ADDR"); got != ":9000" {
+		t.Errorf("LISTEN_ADDR changed to %q", got)
+	}
+	if len(changes) != 0 {
+		t.Errorf("reported changes %q", <-changes)
+	}
+
+	// Invalid settings leave the current ones alone
+	writeFile(t, file, "TOKEN=\n")
+	if err := c.Reload(); err == nil {
+		t.Error("reloaded an empty token")
+	}
+	if got := c.Get("TOKEN"); got != "one" {
+		t.Errorf("TOKEN = %q", got)
+	}
+
+	// Watching notices the secret file changing
+	writeFile(t, file, "TOKEN=${file:"+secret+"}\nLISTEN_ADDR=:9000\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Watch(ctx, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	writeFile(t, secret, "two-longer")
+	select {
+	case changed := <-changes:
+		if !slices.Equal(changed, []string{"TOKEN"}) || c.Get("TOKEN") != "two-longer" {
+			t.Errorf("changed %q, TOKEN = %q", changed, c.Get("TOKEN"))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the change wasn't noticed")
+	}
+}
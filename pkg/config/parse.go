@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Entry is one setting in a settings file
+type Entry struct {
+	Name  string
+	Value string
+	Line  int
+}
+
+// Parse reads the settings in a file's contents, refusing any set twice.
+// Secret references are left as they are.
+func Parse(data []byte) ([]Entry, error) {
+	var entries []Entry
+	seen := map[string]int{}
+	for i, line := range strings.Split(string(data), "\n") {
+		n := i + 1
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		name, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("line %d: expected name = value", n)
+		}
+		switch {
+		case strings.HasPrefix(value, `"`):
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid quoted value %s", n, value)
+			}
+			value = unquoted
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		}
+		if prev, dup := seen[name]; dup {
+			return nil, fmt.Errorf("line %d: %s is already set on line %d", n, name, prev)
+		}
+		seen[name] = n
+		entries = append(entries, Entry{name, value, n})
+	}
+	return entries, nil
+}
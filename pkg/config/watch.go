@@ -0,0 +1,66 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DefaultPoll is how often Watch looks for changed files
+const DefaultPoll = 5 * time.Second
+
+// Watch reloads the settings on SIGHUP, and when the settings file or a
+// secret file it refers to changes, checking every poll, until ctx is done.
+// A reload that fails is logged and the current settings kept.
+func (c *Config) Watch(ctx context.Context, poll time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+
+	last := c.fingerprint()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			slog.Info("reloading settings on SIGHUP", "file", c.file)
+		case <-ticker.C:
+			if now := c.fingerprint(); now == last {
+				continue
+			}
+		}
+		if err := c.Reload(); err != nil {
+			slog.Error("can't reload settings, keeping the current ones", "file", c.file, "error", err)
+		}
+		// Taken after the reload, so a failed one isn't retried until the
+		// files change again
+		last = c.fingerprint()
+	}
+}
+
+// fingerprint summarises the size and modification time of the settings
+// file and the secret files, to notice when any changes
+func (c *Config) fingerprint() string {
+	c.mu.RLock()
+	files := append([]string{c.file}, c.secrets...)
+	c.mu.RUnlock()
+	var b strings.Builder
+	for _, name := range files {
+		if name == "" {
+			continue
+		}
+		if info, err := os.Stat(name); err == nil {
+			fmt.Fprintf(&b, "%s %d %d;", name, info.ModTime().UnixNano(), info.Size())
+		} else {
+			fmt.Fprintf(&b, "%s missing;", name)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,138 @@
+// Package cron reads standard five-field cron expressions and finds when they
+// next match
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed five-field cron expression: minute, hour, day of
+// month, month and day of week
+type Schedule struct {
+	minute, hour, dom, month, dow [64]bool
+	domAny, dowAny                bool // the field was "*", so only the other day field counts
+}
+
+// bounds are the bounds of each field, in order
+var bounds = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7}, // 0 and 7 are both Sunday
+}
+
+// shorthands are the @ names cron accepts in place of an expression
+var shorthands = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse reads a standard five-field cron expression such as "0 1 * * *"
+// (1am every day) or "30 23 * * 1-5" (11:30pm on weekdays). Fields may be *,
+// a number, a range a-b, a list a,b,c, or any of those with a /step. The
+// shorthands @hourly, @daily (or @midnight), @weekly, @monthly and @yearly
+// (or @annually) work too. Times are in the server's local time zone.
+func Parse(expr string) (*Schedule, error) {
+	if full, ok := shorthands[strings.TrimSpace(expr)]; ok {
+		expr = full
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != len(bounds) {
+		return nil, fmt.Errorf("cron expression %q needs 5 fields (minute hour day-of-month month day-of-week)", expr)
+	}
+
+	s := &Schedule{domAny: fields[2] == "*", dowAny: fields[4] == "*"}
+	sets := []*[64]bool{&s.minute, &s.hour, &s.dom, &s.month, &s.dow}
+	for i, field := range fields {
+		if err := parseField(field, bounds[i].min, bounds[i].max, sets[i]); err != nil {
+			return nil, fmt.Errorf("cron %s field %q: %w", bounds[i].name, field, err)
+		}
+	}
+	if s.dow[7] {
+		s.dow[0] = true
+	}
+	return s, nil
+}
+
+// parseField marks the values a field matches in set
+func parseField(field string, min, max int, set *[64]bool) error {
+	for _, part := range strings.Split(field, ",") {
+		rng, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step < 1 {
+				return fmt.Errorf("bad step %q", stepText)
+			}
+		}
+
+		lo, hi := min, max
+		if rng != "*" {
+			loText, hiText, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(loText); err != nil {
+				return fmt.Errorf("bad value %q", loText)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(hiText); err != nil {
+					return fmt.Errorf("bad value %q", hiText)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return fmt.Errorf("%s is outside %d-%d", rng, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return nil
+}
+
+// Next returns the first time after t that the schedule matches, to the minute
+func (s *Schedule) Next(t time.Time) (time.Time, error) {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Every schedule that can match at all does so within four years (Feb 29)
+	for end := t.AddDate(4, 0, 1); t.Before(end); t = t.Add(time.Minute) {
+		if !s.month[t.Month()] || !s.matchesDay(t) {
+			// Skip to the start of the next day
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()).Add(-time.Minute)
+			continue
+		}
+		if s.hour[t.Hour()] && s.minute[t.Minute()] {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("cron expression never matches")
+}
+
+// matchesDay applies cron's rule that when both day fields are restricted, a
+// day matching either one counts
+func (s *Schedule) matchesDay(t time.Time) bool {
+	dom, dow := s.dom[t.Day()], s.dow[t.Weekday()]
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	}
+	return dom || dow
+}
@@ -0,0 +1,51 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	from := time.Date(2026, 10, 16, 14, 30, 20, 0, time.UTC) // a Friday
+	for expr, want := range map[string]string{
+		"0 3 * * *":        "2026-10-17 03:00",
+		"*/15 * * * *":     "2026-10-16 14:45",
+		"30 23 * * 1-5":    "2026-10-16 23:30",
+		"0 9 * * 0":        "2026-10-18 09:00",
+		"0 9 * * 7":        "2026-10-18 09:00",
+		"0 0 1 * *":        "2026-11-01 00:00",
+		"0 0 13 * 5":       "2026-10-23 00:00", // the 13th or any Friday
+		"0 12 29 2 *":      "2028-02-29 12:00",
+		"0,30 14-15 * * *": "2026-10-16 15:00",
+		"@hourly":          "2026-10-16 15:00",
+		"@daily":           "2026-10-17 00:00",
+		"@weekly":          "2026-10-18 00:00",
+		"@monthly":         "2026-11-01 00:00",
+		"@yearly":          "2027-01-01 00:00",
+	} {
+		s, err := Parse(expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", expr, err)
+			continue
+		}
+		next, err := s.Next(from)
+		if err != nil || next.Format("2006-01-02 15:04") != want {
+			t.Errorf("%q: next = %v, %v, want %s", expr, next, err, want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "a * * * *", "@fortnightly"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded", expr)
+		}
+	}
+	s, err := Parse("0 0 31 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Next(time.Now()); err == nil {
+		t.Error("February 31st matched")
+	}
+}
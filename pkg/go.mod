@@ -0,0 +1,3 @@
+module github.com/oksmith/home-server/pkg
+
+go 1.24.5
@@ -0,0 +1,75 @@
+package httpserver
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/oksmith/home-server/pkg/sigauth"
+)
+
+// BearerToken returns the token a request carries, as a bearer token or as
+// the password of Basic credentials, which browsers can be prompted for
+func BearerToken(r *http.Request) (string, bool) {
+	if _, password, ok := r.BasicAuth(); ok {
+		return password, true
+	}
+	return strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// TokenMatches compares a token in constant time. An empty want never matches.
+func TokenMatches(got, want string) bool {
+	return want != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// RequireAuth wraps a handler so it only runs for requests carrying the
+// current token or signed with one of keys, while either is set. Wrong tokens
+// and signatures count towards locking the sender out with g, and requests
+// without credentials are asked for Basic ones in realm, which makes browsers
+// prompt for the token.
+func RequireAuth(realm string, token func() string, keys *sigauth.Keyring, g *Guard, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sigauth.Signed(r) {
+			if _, err := keys.Verify(r); err != nil {
+				g.Failed(r)
+				http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+				return
+			}
+			g.Succeeded(r)
+			next.ServeHTTP(w, r)
+			return
+		}
+		want := token()
+		if want == "" && keys.Len() == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		got, ok := BearerToken(r)
+		if ok && TokenMatches(got, want) {
+			g.Succeeded(r)
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "" {
+			g.Failed(r)
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// HasClientCert reports whether a request came with a client certificate
+// that verified against the server's client CAs
+func HasClientCert(r *http.Request) bool {
+	return r.TLS != nil && len(r.TLS.VerifiedChains) > 0
+}
+
+// ClientIP returns the address a request came from, without its port
+func ClientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
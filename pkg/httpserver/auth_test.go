@@ -0,0 +1,117 @@
+package httpserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/oksmith/home-server/pkg/sigauth"
+)
+
+func TestBearerToken(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	if _, ok := BearerToken(r); ok {
+		t.Error("found a token in a request without one")
+	}
+	r.Header.Set("Authorization", "Bearer secret")
+	if got, ok := BearerToken(r); !ok || got != "secret" {
+		t.Errorf("bearer: got %q, %v", got, ok)
+	}
+	r.SetBasicAuth("anyone", "password")
+	if got, ok := BearerToken(r); !ok || got != "password" {
+		t.Errorf("basic: got %q, %v", got, ok)
+	}
+}
+
+func TestTokenMatches(t *testing.T) {
+	if !TokenMatches("secret", "secret") {
+		t.Error("equal tokens don't match")
+	}
+	if TokenMatches("secret", "other") || TokenMatches("", "") {
+		t.Error("different or empty tokens match")
+	}
+}
+
+func TestRequireAuth(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := sigauth.NewSigner(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusted := sigauth.NewKeyring(sigauth.Key{Name: "alice", ID: signer.ID(), PublicKey: &key.PublicKey})
+
+	token := "secret"
+	g := NewGuard(Limits{Burst: 100, PerSecond: 1, LockoutAfter: 2, LockoutBase: time.Minute, LockoutMax: time.Hour})
+	h := RequireAuth("test", func() string { return token }, trusted, g, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(set func(*http.Request)) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest("GET", "/", nil)
+		if set != nil {
+			set(r)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve(nil)
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != `Basic realm="test"` {
+		t.Errorf("without a token: got %d, %q", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+	if w := serve(func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") }); w.Code != http.StatusOK {
+		t.Errorf("bearer token: got %d", w.Code)
+	}
+	if w := serve(func(r *http.Request) { r.SetBasicAuth("", "secret") }); w.Code != http.StatusOK {
+		t.Errorf("basic password: got %d", w.Code)
+	}
+	signed := func(r *http.Request) {
+		out, _ := http.NewRequest("GET", "http://example.com/", nil)
+		if err := signer.Sign(out); err != nil {
+			t.Fatal(err)
+		}
+		r.Header = out.Header.Clone()
+	}
+	if w := serve(signed); w.Code != http.StatusOK {
+		t.Errorf("signed: got %d: %s", w.Code, w.Body)
+	}
+
+	// Missing credentials don't count towards a lockout, wrong ones do
+	serve(nil)
+	serve(nil)
+	if _, ok := g.Allow("192.0.2.1"); !ok {
+		t.Fatal("locked out for requests without a token")
+	}
+	serve(func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") })
+	serve(func(r *http.Request) { r.Header.Set(sigauth.HeaderKey, signer.ID()) })
+	if _, ok := g.Allow("192.0.2.1"); ok {
+		t.Error("expected a bad token and a bad signature to lock the client out")
+	}
+
+	// With no token or keys set, everything is let through
+	token = ""
+	open := RequireAuth("test", func() string { return token }, nil, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w = httptest.NewRecorder()
+	open.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("without a token set: got %d", w.Code)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "[::1]:5000"
+	if got := ClientIP(r); got != "::1" {
+		t.Errorf("got %q", got)
+	}
+	r.RemoteAddr = "@"
+	if got := ClientIP(r); got != "@" {
+		t.Errorf("got %q for an address without a port", got)
+	}
+}
@@ -0,0 +1,37 @@
+// Package httpserver is the HTTP plumbing shared by the home-server services:
+// token auth, per-client rate limiting with lockouts, request logging and
+// metrics, JSON responses, and serving with a graceful shutdown.
+//
+// The services built on it behave alike, so each one's own documentation
+// only names its settings and says where it differs:
+//
+// Settings come from the environment, or from the file named by CONFIG_FILE,
+// such as /etc/notify-service.env, with the environment taking precedence.
+// Any setting may refer to a secret kept elsewhere as ${file:PATH},
+// ${env:NAME} or ${cred:NAME}, as package config describes. Editing that
+// file, or sending SIGHUP, changes a service's tokens without a restart;
+// other settings need one.
+//
+// A service listens on LISTEN_ADDR, and setting TLS_CERT and TLS_KEY serves
+// HTTPS. GET /healthz answers "ok" to anyone. With the service's token set,
+// everything else needs it as a bearer token or a Basic password
+// (RequireAuth). Each client IP may make 20 requests at once, refilled at one
+// a second, and is locked out for a minute after 5 bad tokens in a row,
+// doubling up to an hour (Guard with DefaultLimits).
+//
+// Requests signed with a wallet key listed in the AUTHORIZED_KEYS file are
+// let in without the token, as package sigauth describes, and the file is
+// reread when it changes. Once it lists any key, requests with neither are
+// refused. SERVICE_KEY names the service's own unencrypted wallet key, which
+// signs what it sends to the others, such as messages to notify-service at
+// NOTIFY_URL, in place of their tokens.
+//
+// With GATEWAY_URL and GATEWAY_REGISTRY_TOKEN or SERVICE_KEY set, a service
+// registers itself with the gateway as GATEWAY_NAME, reachable at
+// GATEWAY_SERVICE_URL (default this machine's hostname on the listen port)
+// with its token. The registration is renewed every 30 seconds and withdrawn
+// as the service stops; see package registry.
+//
+// SIGINT or SIGTERM stops a service, giving requests in flight
+// ShutdownTimeout, 10 seconds, to finish (ListenAndServe).
+package httpserver
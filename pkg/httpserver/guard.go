@@ -0,0 +1,160 @@
+package httpserver
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limits configures a Guard
+type Limits struct {
+	// Burst requests can arrive at once from one client, refilled at PerSecond
+	Burst     float64
+	PerSecond float64
+	// LockoutAfter bad tokens in a row lock a client out for LockoutBase,
+	// doubling with each further bad token up to LockoutMax
+	LockoutAfter int
+	LockoutBase  time.Duration
+	LockoutMax   time.Duration
+}
+
+// DefaultLimits suit an API used by a handful of devices and automations
+var DefaultLimits = Limits{
+	Burst:        20,
+	PerSecond:    1,
+	LockoutAfter: 5,
+	LockoutBase:  time.Minute,
+	LockoutMax:   time.Hour,
+}
+
+// clientIdle is how long a client's state is kept after its last request
+const clientIdle = 2 * time.Hour
+
+// client is what a guard remembers about one client
+type client struct {
+	tokens      float64
+	last        time.Time
+	failures    int
+	lockedUntil time.Time
+}
+
+// Guard rate limits each client and locks out those that keep sending bad
+// tokens. Clients are told apart by Key, ClientIP if nil. A nil Guard lets
+// everything through.
+type Guard struct {
+	Key func(*http.Request) string
+	// Limited, if set, is called before a request is turned away
+	Limited func(w http.ResponseWriter, r *http.Request)
+
+	limits  Limits
+	clients map[string]*client
+	pruned  time.Time
+	mu      sync.Mutex
+}
+
+// NewGuard returns a guard enforcing limits
+func NewGuard(limits Limits) *Guard {
+	return &Guard{limits: limits, clients: make(map[string]*client), pruned: time.Now()}
+}
+
+func (g *Guard) key(r *http.Request) string {
+	if g.Key != nil {
+		return g.Key(r)
+	}
+	return ClientIP(r)
+}
+
+// get returns a client's state, creating it with a full bucket. The caller holds mu.
+func (g *Guard) get(key string, now time.Time) *client {
+	if now.Sub(g.pruned) > clientIdle {
+		for k, c := range g.clients {
+			if now.Sub(c.last) > clientIdle && now.After(c.lockedUntil) {
+				delete(g.clients, k)
+			}
+		}
+		g.pruned = now
+	}
+	c, ok := g.clients[key]
+	if !ok {
+		c = &client{tokens: g.limits.Burst, last: now}
+		g.clients[key] = c
+	}
+	return c
+}
+
+// Allow takes a request from a client's bucket, or says how long it must wait
+func (g *Guard) Allow(key string) (time.Duration, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	c := g.get(key, now)
+	if now.Before(c.lockedUntil) {
+		return c.lockedUntil.Sub(now), false
+	}
+	c.tokens = min(g.limits.Burst, c.tokens+now.Sub(c.last).Seconds()*g.limits.PerSecond)
+	c.last = now
+	if c.tokens < 1 {
+		return time.Duration((1 - c.tokens) / g.limits.PerSecond * float64(time.Second)), false
+	}
+	c.tokens--
+	return 0, true
+}
+
+// Failed counts a bad token from a request's client, locking it out once
+// there are too many
+func (g *Guard) Failed(r *http.Request) {
+	if g == nil {
+		return
+	}
+	key := g.key(r)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	c := g.get(key, time.Now())
+	c.failures++
+	if c.failures < g.limits.LockoutAfter {
+		return
+	}
+	lockout := g.limits.LockoutMax
+	if shift := c.failures - g.limits.LockoutAfter; shift < 16 {
+		lockout = min(g.limits.LockoutMax, g.limits.LockoutBase<<shift)
+	}
+	c.lockedUntil = time.Now().Add(lockout)
+	slog.Warn("locking out client after bad tokens", "client", key, "for", lockout, "failures", c.failures)
+}
+
+// Succeeded clears the bad tokens of a request's client
+func (g *Guard) Succeeded(r *http.Request) {
+	if g == nil {
+		return
+	}
+	key := g.key(r)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if c, ok := g.clients[key]; ok {
+		c.failures = 0
+	}
+}
+
+// Middleware turns away requests from clients that are over their rate or
+// locked out
+func (g *Guard) Middleware(next http.Handler) http.Handler {
+	if g == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wait, ok := g.Allow(g.key(r)); !ok {
+			if g.Limited != nil {
+				g.Limited(w, r)
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,86 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGuardRateLimit(t *testing.T) {
+	g := NewGuard(Limits{Burst: 3, PerSecond: 1, LockoutAfter: 5, LockoutBase: time.Minute, LockoutMax: time.Hour})
+	limited := 0
+	g.Limited = func(http.ResponseWriter, *http.Request) { limited++ }
+	h := g.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	codes := make([]int, 0, 4)
+	for range 4 {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		codes = append(codes, w.Code)
+	}
+	if codes[2] != http.StatusOK || codes[3] != http.StatusTooManyRequests {
+		t.Errorf("expected the fourth request to be limited, got %v", codes)
+	}
+	if limited != 1 {
+		t.Errorf("Limited called %d times", limited)
+	}
+
+	// Another client has its own bucket
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.0.2.2:1234"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("another client got %d", w.Code)
+	}
+}
+
+func TestGuardLockout(t *testing.T) {
+	g := NewGuard(Limits{Burst: 100, PerSecond: 1, LockoutAfter: 2, LockoutBase: time.Minute, LockoutMax: time.Hour})
+	r := httptest.NewRequest("GET", "/", nil)
+	key := ClientIP(r)
+
+	g.Failed(r)
+	g.Succeeded(r)
+	g.Failed(r)
+	if _, ok := g.Allow(key); !ok {
+		t.Fatal("locked out though a success reset the count")
+	}
+	g.Failed(r)
+	wait, ok := g.Allow(key)
+	if ok || wait < 59*time.Second {
+		t.Errorf("expected a minute's lockout, got %v %v", wait, ok)
+	}
+	g.Failed(r)
+	if wait, _ := g.Allow(key); wait < 119*time.Second {
+		t.Errorf("expected the lockout to double, got %v", wait)
+	}
+}
+
+func TestGuardKey(t *testing.T) {
+	g := NewGuard(Limits{Burst: 1, PerSecond: 0.001})
+	g.Key = func(r *http.Request) string { return r.Header.Get("X-Client") }
+	h := g.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, client := range []string{"a", "b"} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Client", client)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("client %s got %d", client, w.Code)
+		}
+	}
+}
+
+func TestNilGuard(t *testing.T) {
+	var g *Guard
+	r := httptest.NewRequest("GET", "/", nil)
+	g.Failed(r)
+	g.Succeeded(r)
+	w := httptest.NewRecorder()
+	g.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("nil guard turned a request away with %d", w.Code)
+	}
+}
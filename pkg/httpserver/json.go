@@ -0,0 +1,13 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// WriteJSON sends v as a JSON response with the given status code
+func WriteJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
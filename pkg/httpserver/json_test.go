@@ -0,0 +1,18 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteJSON(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteJSON(w, http.StatusCreated, map[string]string{"id": "abc"})
+	if w.Code != http.StatusCreated || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("got %d with Content-Type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if got := w.Body.String(); got != "{\"id\":\"abc\"}\n" {
+		t.Errorf("got body %q", got)
+	}
+}
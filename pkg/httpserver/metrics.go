@@ -0,0 +1,116 @@
+package httpserver
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RouteMetrics counts requests to one route
+type RouteMetrics struct {
+	Requests       uint64  `json:"requests"`
+	LegacyRequests uint64  `json:"legacy_requests"` // via a deprecated path
+	ClientErrors   uint64  `json:"client_errors"`   // 4xx responses
+	ServerErrors   uint64  `json:"server_errors"`   // 5xx responses
+	AvgMillis      float64 `json:"avg_ms"`
+}
+
+// Metrics aggregates per-route request statistics
+type Metrics struct {
+	routes map[string]*RouteMetrics
+	total  map[string]time.Duration // route -> summed handler time
+	mu     sync.Mutex
+}
+
+// NewMetrics creates empty metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		routes: make(map[string]*RouteMetrics),
+		total:  make(map[string]time.Duration),
+	}
+}
+
+// Record adds one request to a route's statistics
+func (m *Metrics) Record(route string, legacy bool, status int, elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rm, exists := m.routes[route]
+	if !exists {
+		rm = &RouteMetrics{}
+		m.routes[route] = rm
+	}
+	rm.Requests++
+	if legacy {
+		rm.LegacyRequests++
+	}
+	switch {
+	case status >= 500:
+		rm.ServerErrors++
+	case status >= 400:
+		rm.ClientErrors++
+	}
+	m.total[route] += elapsed
+	rm.AvgMillis = float64(m.total[route].Microseconds()) / 1000 / float64(rm.Requests)
+}
+
+// Snapshot returns a copy of the statistics, keyed by route
+func (m *Metrics) Snapshot() map[string]RouteMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := make(map[string]RouteMetrics, len(m.routes))
+	for route, rm := range m.routes {
+		snapshot[route] = *rm
+	}
+	return snapshot
+}
+
+// StatusRecorder captures the status code written by a handler
+type StatusRecorder struct {
+	http.ResponseWriter
+	Status int
+}
+
+func (s *StatusRecorder) WriteHeader(status int) {
+	s.Status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (s *StatusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// Instrument logs each request to route at debug level and records it in m.
+// A legacy route is a deprecated path kept for older clients.
+func Instrument(m *Metrics, logger *slog.Logger, route string, legacy bool, next http.Handler) http.Handler {
+	return instrument(m, logger, func(*http.Request) string { return route }, legacy, next)
+}
+
+// InstrumentMux is Instrument for every route of mux, recording each request
+// under the pattern it matched
+func InstrumentMux(m *Metrics, logger *slog.Logger, mux *http.ServeMux) http.Handler {
+	return instrument(m, logger, func(r *http.Request) string {
+		if r.Pattern == "" {
+			return "unmatched"
+		}
+		return r.Pattern
+	}, false, mux)
+}
+
+// instrument records requests under the route named once each is served
+func instrument(m *Metrics, logger *slog.Logger, route func(*http.Request) string, legacy bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		elapsed := time.Since(start)
+
+		m.Record(route(r), legacy, rec.Status, elapsed)
+		logger.Debug("http request",
+			"method", r.Method, "path", r.URL.Path, "status", rec.Status,
+			"duration", elapsed, "remote", r.RemoteAddr)
+	})
+}
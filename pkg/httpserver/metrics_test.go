@@ -0,0 +1,54 @@
+package httpserver
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	m.Record("/a", false, http.StatusOK, 10*time.Millisecond)
+	m.Record("/a", true, http.StatusNotFound, 30*time.Millisecond)
+	m.Record("/a", false, http.StatusBadGateway, 20*time.Millisecond)
+
+	got := m.Snapshot()["/a"]
+	want := RouteMetrics{Requests: 3, LegacyRequests: 1, ClientErrors: 1, ServerErrors: 1, AvgMillis: 20}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	m := NewMetrics()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := Instrument(m, logger, "/teapot", false, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/teapot", nil))
+
+	if rm := m.Snapshot()["/teapot"]; rm.Requests != 1 || rm.ClientErrors != 1 {
+		t.Errorf("unexpected metrics %+v", rm)
+	}
+}
+
+func TestInstrumentMux(t *testing.T) {
+	m := NewMetrics()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hosts/{name}", func(w http.ResponseWriter, r *http.Request) {})
+	h := InstrumentMux(m, slog.New(slog.NewTextHandler(io.Discard, nil)), mux)
+	for _, path := range []string{"/hosts/nas", "/hosts/pc", "/nowhere"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	snapshot := m.Snapshot()
+	if got := snapshot["/hosts/{name}"].Requests; got != 2 {
+		t.Errorf("expected 2 requests under the pattern, got %d", got)
+	}
+	if got := snapshot["unmatched"]; got.Requests != 1 || got.ClientErrors != 1 {
+		t.Errorf("expected one unmatched 404, got %+v", got)
+	}
+}
@@ -0,0 +1,43 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ShutdownTimeout is how long requests in flight get to finish once a
+// server is asked to stop
+const ShutdownTimeout = 10 * time.Second
+
+// ListenAndServe runs srv until ctx is done, then shuts it down gracefully:
+// requests in flight get ShutdownTimeout to finish, after which streams and
+// any other stragglers are cut off, and it returns nil. It serves HTTPS if
+// srv has a TLSConfig, with certificates from certFile and keyFile unless the
+// config already holds them.
+func ListenAndServe(ctx context.Context, srv *http.Server, certFile, keyFile string) error {
+	errCh := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			errCh <- srv.ListenAndServeTLS(certFile, keyFile)
+		} else {
+			errCh <- srv.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		srv.Close()
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
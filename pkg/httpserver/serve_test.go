@@ -0,0 +1,63 @@
+package httpserver
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestListenAndServeShutsDown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	release := make(chan struct{})
+	srv := &http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("done"))
+	})}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- ListenAndServe(ctx, srv, "", "") }()
+
+	// Start a slow request, then ask the server to stop while it's in flight
+	var resp *http.Response
+	got := make(chan error, 1)
+	go func() {
+		for range 50 {
+			if resp, err = http.Get("http://" + addr); err == nil {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		got <- err
+	}()
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	close(release)
+
+	if err := <-got; err != nil {
+		t.Fatalf("in-flight request failed: %v", err)
+	}
+	resp.Body.Close()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("expected a clean shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server didn't stop")
+	}
+}
+
+func TestListenAndServeFails(t *testing.T) {
+	srv := &http.Server{Addr: "127.0.0.1:-1"}
+	if err := ListenAndServe(context.Background(), srv, "", ""); err == nil {
+		t.Error("expected an error for a bad address")
+	}
+}
@@ -0,0 +1,187 @@
+// Package notify sends notifications to notify-service, the home-server's
+// notification hub, which passes each one on to email, Telegram, ntfy, MQTT
+// or webhooks as its routing rules say. Services only describe what
+// happened; who hears about it, and how, is set up in one place.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/oksmith/home-server/pkg/sigauth"
+)
+
+// Priorities, from least to most urgent
+const (
+	Low    = "low"
+	Normal = "normal"
+	High   = "high"
+	Urgent = "urgent"
+)
+
+var priorities = []string{Low, Normal, High, Urgent}
+
+// Rank orders a priority among the others, from 0 for Low, with "" counting
+// as Normal. ok is false for an unknown priority.
+func Rank(priority string) (rank int, ok bool) {
+	if priority == "" {
+		priority = Normal
+	}
+	for i, p := range priorities {
+		if p == priority {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Timeout bounds each call to the hub. When waiting for delivery, the hub
+// gives up on a channel sooner than this.
+const Timeout = 15 * time.Second
+
+// Message is one notification
+type Message struct {
+	Source   string            `json:"source"`             // the service sending it, e.g. shutdown-service
+	Event    string            `json:"event"`              // what happened, e.g. executed or block_found
+	Priority string            `json:"priority,omitempty"` // Normal if empty
+	Host     string            `json:"host,omitempty"`     // the machine it happened on
+	Title    string            `json:"title"`              // a one-line summary, used as a subject or heading
+	Text     string            `json:"text,omitempty"`
+	Fields   map[string]string `json:"fields,omitempty"` // details for routing rules and webhooks
+	Time     time.Time         `json:"time"`
+}
+
+// Validate checks a message has what the hub needs
+func (m *Message) Validate() error {
+	switch {
+	case m.Source == "":
+		return errors.New("source is required")
+	case m.Event == "":
+		return errors.New("event is required")
+	case m.Title == "":
+		return errors.New("title is required")
+	}
+	if _, ok := Rank(m.Priority); !ok {
+		return fmt.Errorf("unknown priority %q; use %s", m.Priority, strings.Join(priorities, ", "))
+	}
+	return nil
+}
+
+// Body is the message's text, or its title if it has none
+func (m *Message) Body() string {
+	if m.Text != "" {
+		return m.Text
+	}
+	return m.Title
+}
+
+// Client sends messages to the hub. A nil Client sends nothing, so services
+// can hold one whether or not a hub is configured.
+type Client struct {
+	url    string
+	source string
+	host   string
+	token  func() string
+	signer *sigauth.Signer
+	http   *http.Client
+}
+
+// NewClient returns a client of the hub at hubURL, such as
+// http://localhost:8097, sending as source. Requests carry the bearer token
+// returned by token, or while there is none, are signed with signer, if it is
+// not nil. It returns nil if hubURL is empty.
+func NewClient(hubURL, source string, token func() string, signer *sigauth.Signer) *Client {
+	if hubURL == "" {
+		return nil
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "server"
+	}
+	if token == nil {
+		token = func() string { return "" }
+	}
+	return &Client{
+		url:    strings.TrimSuffix(hubURL, "/") + "/notify",
+		source: source,
+		host:   host,
+		token:  token,
+		signer: signer,
+		http:   &http.Client{Timeout: Timeout},
+	}
+}
+
+// Send delivers a message in the background, logging any failure
+func (c *Client) Send(m Message) {
+	if c == nil {
+		return
+	}
+	go func() {
+		if err := c.send(context.Background(), m, false); err != nil {
+			slog.Warn("can't notify", "event", m.Event, "hub", c.url, "error", err)
+		}
+	}()
+}
+
+// SendWait delivers a message and waits until the hub has passed it on to
+// every channel or given up, for when the machine is about to go away
+func (c *Client) SendWait(ctx context.Context, m Message) error {
+	if c == nil {
+		return nil
+	}
+	return c.send(ctx, m, true)
+}
+
+// send posts a message to the hub, filling in what the caller left out
+func (c *Client) send(ctx context.Context, m Message, wait bool) error {
+	if m.Source == "" {
+		m.Source = c.source
+	}
+	if m.Host == "" {
+		m.Host = c.host
+	}
+	if m.Time.IsZero() {
+		m.Time = time.Now()
+	}
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	body, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	target := c.url
+	if wait {
+		target += "?wait=true"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token := c.token(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if err := c.signer.Sign(req); err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
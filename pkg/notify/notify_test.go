@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSendWait(t *testing.T) {
+	var got Message
+	var query, auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/notify" {
+			http.NotFound(w, r)
+			return
+		}
+		query, auth = r.URL.RawQuery, r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL+"/", "backup-service", func() string { return "secret" }, nil)
+	err := c.SendWait(context.Background(), Message{Event: "backup_failed", Priority: High, Title: "Backup failed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != "wait=true" || auth != "Bearer secret" {
+		t.Errorf("got query %q, auth %q", query, auth)
+	}
+	if got.Source != "backup-service" || got.Host == "" || got.Time.IsZero() || got.Priority != High {
+		t.Errorf("got %+v", got)
+	}
+
+	if err := c.SendWait(context.Background(), Message{Event: "x", Title: "x", Priority: "loud"}); err == nil {
+		t.Error("unknown priority sent")
+	}
+}
+
+func TestSendWaitRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, "node", nil, nil)
+	if err := c.SendWait(context.Background(), Message{Event: "reorg", Title: "Reorg"}); err == nil {
+		t.Error("no error for a 401")
+	}
+}
+
+func TestNilClient(t *testing.T) {
+	c := NewClient("", "node", nil, nil)
+	if c != nil {
+		t.Fatal("client without a hub URL")
+	}
+	c.Send(Message{Event: "reorg", Title: "Reorg"})
+	if err := c.SendWait(context.Background(), Message{}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRank(t *testing.T) {
+	low, _ := Rank(Low)
+	normal, _ := Rank("")
+	urgent, _ := Rank(Urgent)
+	if !(low < normal && normal < urgent) {
+		t.Errorf("got low %d, normal %d, urgent %d", low, normal, urgent)
+	}
+	if _, ok := Rank("loud"); ok {
+		t.Error("unknown priority ranked")
+	}
+}
@@ -0,0 +1,115 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/oksmith/home-server/pkg/sigauth"
+)
+
+// requestTimeout bounds each call to the gateway
+const requestTimeout = 10 * time.Second
+
+// Announce registers the service returned by service with the gateway at
+// gatewayURL using its registry token, or signing with signer if there is no
+// token, renewing the registration every interval until ctx is done and then
+// withdrawing it. service is called for each renewal, so a changed token
+// reaches the gateway. Failures are logged and retried, so services can start
+// before the gateway does.
+func Announce(ctx context.Context, gatewayURL, token string, signer *sigauth.Signer, service func() Service, interval time.Duration) {
+	base := strings.TrimSuffix(gatewayURL, "/")
+	registered := false
+	for {
+		s := service()
+		err := call(ctx, http.MethodPost, base+"/registry", token, signer, s)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			slog.Warn("can't register with the gateway", "gateway", base, "service", s.Name, "error", err)
+			registered = false
+		case err == nil && !registered:
+			slog.Info("registered with the gateway", "gateway", base, "service", s.Name)
+			registered = true
+		}
+
+		select {
+		case <-ctx.Done():
+			// ctx is done, so withdraw under a context of our own
+			withdrawCtx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+			defer cancel()
+			if err := call(withdrawCtx, http.MethodDelete, base+"/registry/"+url.PathEscape(s.Name), token, signer, nil); err != nil {
+				slog.Warn("can't withdraw from the gateway", "gateway", base, "service", s.Name, "error", err)
+			}
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Local describes a service listening on listenAddr on this machine, apart
+// from its token. Without serviceURL, the gateway reaches it at this
+// machine's hostname on the listen port, over HTTPS if https is set.
+func Local(name, serviceURL, listenAddr string, https bool) (Service, error) {
+	s := Service{Name: name, URL: serviceURL}
+	if s.URL == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return s, err
+		}
+		_, port, err := net.SplitHostPort(listenAddr)
+		if err != nil {
+			return s, err
+		}
+		scheme := "http"
+		if https {
+			scheme = "https"
+		}
+		s.URL = scheme + "://" + net.JoinHostPort(host, port)
+	}
+	return s, s.Validate()
+}
+
+// call makes one registry request
+func call(ctx context.Context, method, target, token string, signer *sigauth.Signer, body any) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if err := signer.Sign(req); err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package registry
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oksmith/home-server/pkg/sigauth"
+)
+
+func TestAnnounce(t *testing.T) {
+	reg := New(time.Minute)
+	gateway := httptest.NewServer(reg.Handler(func() string { return "secret" }, nil, nil))
+	defer gateway.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Announce(ctx, gateway.URL, "secret", nil, func() Service {
+			return Service{Name: "power", URL: "http://nas:8080", Token: "t"}
+		}, time.Hour)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if s, _, ok := reg.Match("/power/status"); ok {
+			if s.Token != "t" {
+				t.Errorf("token not registered: %+v", s)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("service never registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+	if _, _, ok := reg.Match("/power/status"); ok {
+		t.Error("service still registered after Announce returned")
+	}
+}
+
+func TestHandlerNeedsToken(t *testing.T) {
+	reg := New(time.Minute)
+	h := reg.Handler(func() string { return "secret" }, nil, nil)
+	for _, token := range []string{"", "wrong"} {
+		r := httptest.NewRequest("POST", "/registry", strings.NewReader(`{"name":"power","url":"http://nas:8080"}`))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: got %d", token, w.Code)
+		}
+	}
+	if len(reg.List()) != 0 {
+		t.Error("registered without a token")
+	}
+
+	r := httptest.NewRequest("POST", "/registry", strings.NewReader(`{"name":"power","url":"http://nas:8080","token":"t"}`))
+	r.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"token"`) {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestAnnounceSigned(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := sigauth.NewSigner(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := New(time.Minute)
+	keys := sigauth.NewKeyring(sigauth.Key{Name: "power", ID: signer.ID(), PublicKey: &key.PublicKey})
+	// No registry token, so only signed calls get in
+	gateway := httptest.NewServer(reg.Handler(func() string { return "" }, keys, nil))
+	defer gateway.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Announce(ctx, gateway.URL, "", signer, func() Service {
+			return Service{Name: "power", URL: "http://nas:8080"}
+		}, time.Hour)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, _, ok := reg.Match("/power/status"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("service never registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	if _, _, ok := reg.Match("/power/status"); ok {
+		t.Error("service still registered after Announce returned")
+	}
+}
+
+func TestLocal(t *testing.T) {
+	host, err := os.Hostname()
+	if err != nil {
+		t.Skip(err)
+	}
+	s, err := Local("notify", "", ":8097", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.URL != "https://"+host+":8097" || s.Prefix != "/notify" {
+		t.Errorf("expected this host on the listen port, got %+v", s)
+	}
+	if s, err := Local("notify", "http://hub.lan:80", ":8097", false); err != nil || s.URL != "http://hub.lan:80" {
+		t.Errorf("expected the given URL kept, got %+v, %v", s, err)
+	}
+	if _, err := Local("notify", "", "8097", false); err == nil {
+		t.Error("expected a listen address without a port to be refused")
+	}
+	if _, err := Local("", "http://hub.lan", ":8097", false); err == nil {
+		t.Error("expected a service without a name to be refused")
+	}
+}
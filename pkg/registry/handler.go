@@ -0,0 +1,69 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/oksmith/home-server/pkg/httpserver"
+	"github.com/oksmith/home-server/pkg/sigauth"
+)
+
+// maxRegistration caps the size of a registration
+const maxRegistration = 4096
+
+// Handler serves "POST /registry", taking a Service to register or renew, and
+// "DELETE /registry/{name}" to withdraw one, for callers with the token
+// returned by token, refusing token holders while it is empty, or signing
+// with one of keys, which may be nil. Bad tokens and signatures count against
+// guard, which may be nil.
+func (r *Registry) Handler(token func() string, keys *sigauth.Keyring, guard *httpserver.Guard) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /registry", func(w http.ResponseWriter, req *http.Request) {
+		var s Service
+		if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxRegistration)).Decode(&s); err != nil {
+			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		e, err := r.Add(s, false)
+		if errors.Is(err, ErrConflict) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		slog.Debug("service registered", "service", e.Name, "prefix", e.Prefix, "url", e.URL)
+		e.Token = ""
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(e)
+	})
+	mux.HandleFunc("DELETE /registry/{name}", func(w http.ResponseWriter, req *http.Request) {
+		if !r.Remove(req.PathValue("name")) {
+			http.Error(w, "No such registered service", http.StatusNotFound)
+			return
+		}
+		slog.Info("service withdrawn", "service", req.PathValue("name"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if sigauth.Signed(req) {
+			key, err := keys.Verify(req)
+			if err != nil {
+				guard.Failed(req)
+				http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+				return
+			}
+			slog.Debug("registry call signed", "key", key.Name)
+		} else if got, _ := httpserver.BearerToken(req); !httpserver.TokenMatches(got, token()) {
+			guard.Failed(req)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		guard.Succeeded(req)
+		mux.ServeHTTP(w, req)
+	})
+}
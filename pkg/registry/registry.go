@@ -0,0 +1,168 @@
+// Package registry is how the home-server services find each other: the
+// gateway keeps a Registry of them, and each announces itself with Announce
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTTL is how long a registration lasts unless it is renewed
+const DefaultTTL = 90 * time.Second
+
+// ErrConflict means another service is already served at a prefix
+var ErrConflict = errors.New("prefix is taken by another service")
+
+// validName is what a service may be called
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// Service is a backend the gateway routes to
+type Service struct {
+	Name   string `json:"name"`
+	Prefix string `json:"prefix,omitempty"` // path it is served under, "/" + Name if empty
+	URL    string `json:"url"`              // where the gateway reaches it
+	Token  string `json:"token,omitempty"`  // bearer token the gateway sends it
+	Public bool   `json:"public,omitempty"` // served without the gateway's token
+}
+
+// Entry is a registered service, as listed by the gateway
+type Entry struct {
+	Service
+	Expires *time.Time `json:"expires,omitempty"` // nil for services configured at the gateway
+}
+
+// Validate checks a service and fills in its default prefix
+func (s *Service) Validate() error {
+	if !validName.MatchString(s.Name) {
+		return fmt.Errorf("name %q must be lower case letters, digits and dashes", s.Name)
+	}
+	if s.Prefix == "" {
+		s.Prefix = "/" + s.Name
+	}
+	s.Prefix = "/" + strings.Trim(s.Prefix, "/")
+	if s.Prefix == "/" {
+		return errors.New("prefix can't be /")
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url %q must be http:// or https://", s.URL)
+	}
+	return nil
+}
+
+// Registry is the set of services, found by the longest prefix of a path
+type Registry struct {
+	ttl      time.Duration
+	reserved []string // prefixes the gateway serves itself
+
+	mu       sync.Mutex
+	services map[string]*Entry // by name
+}
+
+// New returns an empty registry whose registrations last ttl, which won't
+// give out the reserved prefixes
+func New(ttl time.Duration, reserved ...string) *Registry {
+	return &Registry{ttl: ttl, reserved: reserved, services: make(map[string]*Entry)}
+}
+
+// Add registers a service, or renews it. Services that are static never
+// expire.
+func (r *Registry) Add(s Service, static bool) (Entry, error) {
+	if err := s.Validate(); err != nil {
+		return Entry{}, err
+	}
+	for _, p := range r.reserved {
+		if underPrefix(p, s.Prefix) || underPrefix(s.Prefix, p) {
+			return Entry{}, fmt.Errorf("prefix %s is reserved", s.Prefix)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for name, e := range r.services {
+		if name != s.Name && e.Prefix == s.Prefix && !e.expired(now) {
+			return Entry{}, fmt.Errorf("%w: %s is %s's", ErrConflict, s.Prefix, name)
+		}
+	}
+	if old, ok := r.services[s.Name]; ok && old.Expires == nil && !static {
+		return Entry{}, fmt.Errorf("%s is configured at the gateway", s.Name)
+	}
+	e := &Entry{Service: s}
+	if !static {
+		expires := now.Add(r.ttl)
+		e.Expires = &expires
+	}
+	r.services[s.Name] = e
+	return *e, nil
+}
+
+// Remove drops a registered service, reporting whether there was one. Static
+// services stay.
+func (r *Registry) Remove(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.services[name]
+	if !ok || e.Expires == nil {
+		return false
+	}
+	delete(r.services, name)
+	return true
+}
+
+// Match finds the service for a path, returning the rest of the path after
+// its prefix
+func (r *Registry) Match(path string) (Service, string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var best *Entry
+	now := time.Now()
+	for _, e := range r.services {
+		if e.expired(now) || !underPrefix(e.Prefix, path) {
+			continue
+		}
+		if best == nil || len(e.Prefix) > len(best.Prefix) {
+			best = e
+		}
+	}
+	if best == nil {
+		return Service{}, "", false
+	}
+	rest := strings.TrimPrefix(path, best.Prefix)
+	if rest == "" {
+		rest = "/"
+	}
+	return best.Service, rest, true
+}
+
+// List returns the live services by prefix, dropping expired ones
+func (r *Registry) List() []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	list := make([]Entry, 0, len(r.services))
+	for name, e := range r.services {
+		if e.expired(now) {
+			delete(r.services, name)
+			continue
+		}
+		list = append(list, *e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Prefix < list[j].Prefix })
+	return list
+}
+
+func (e *Entry) expired(now time.Time) bool {
+	return e.Expires != nil && now.After(*e.Expires)
+}
+
+// underPrefix reports whether path is prefix or below it
+func underPrefix(prefix, path string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
@@ -0,0 +1,96 @@
+package registry
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMatchLongestPrefix(t *testing.T) {
+	r := New(time.Minute)
+	for _, s := range []Service{
+		{Name: "blockchain", URL: "http://node:9000"},
+		{Name: "explorer", Prefix: "/blockchain/explorer/", URL: "http://explorer:8000"},
+		{Name: "power", URL: "http://nas:8080"},
+	} {
+		if _, err := r.Add(s, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct{ path, name, rest string }{
+		{"/blockchain/chain", "blockchain", "/chain"},
+		{"/blockchain", "blockchain", "/"},
+		{"/blockchain/explorer/blocks", "explorer", "/blocks"},
+		{"/power/status", "power", "/status"},
+	}
+	for _, tt := range tests {
+		s, rest, ok := r.Match(tt.path)
+		if !ok || s.Name != tt.name || rest != tt.rest {
+			t.Errorf("Match(%q) = %q %q %v, want %q %q", tt.path, s.Name, rest, ok, tt.name, tt.rest)
+		}
+	}
+	for _, path := range []string{"/", "/powerful", "/other/power"} {
+		if s, _, ok := r.Match(path); ok {
+			t.Errorf("Match(%q) found %q", path, s.Name)
+		}
+	}
+}
+
+func TestAddValidates(t *testing.T) {
+	r := New(time.Minute, "/registry")
+	bad := []Service{
+		{Name: "Power", URL: "http://nas:8080"},
+		{Name: "power", URL: "nas:8080"},
+		{Name: "power", Prefix: "/", URL: "http://nas:8080"},
+		{Name: "registry", URL: "http://nas:8080"},
+		{Name: "power", Prefix: "/registry/power", URL: "http://nas:8080"},
+	}
+	for _, s := range bad {
+		if _, err := r.Add(s, false); err == nil {
+			t.Errorf("Add(%+v) succeeded", s)
+		}
+	}
+
+	if _, err := r.Add(Service{Name: "power", URL: "http://nas:8080"}, false); err != nil {
+		t.Fatal(err)
+	}
+	_, err := r.Add(Service{Name: "other", Prefix: "/power", URL: "http://pc:8080"}, false)
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("expected a conflict, got %v", err)
+	}
+	// Renewing is fine
+	if _, err := r.Add(Service{Name: "power", URL: "http://nas:8081"}, false); err != nil {
+		t.Errorf("renewing: %v", err)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	r := New(time.Millisecond)
+	r.Add(Service{Name: "static", URL: "http://a"}, true)
+	r.Add(Service{Name: "dynamic", URL: "http://b"}, false)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, _, ok := r.Match("/dynamic/x"); ok {
+		t.Error("expired service still matched")
+	}
+	list := r.List()
+	if len(list) != 1 || list[0].Name != "static" || list[0].Expires != nil {
+		t.Errorf("expected only the static service, got %+v", list)
+	}
+	// An expired registration doesn't hold its prefix
+	if _, err := r.Add(Service{Name: "other", Prefix: "/dynamic", URL: "http://c"}, false); err != nil {
+		t.Errorf("prefix still held: %v", err)
+	}
+}
+
+func TestStaticServicesStay(t *testing.T) {
+	r := New(time.Minute)
+	r.Add(Service{Name: "power", URL: "http://nas:8080"}, true)
+	if _, err := r.Add(Service{Name: "power", URL: "http://evil:8080"}, false); err == nil {
+		t.Error("a registration replaced a static service")
+	}
+	if r.Remove("power") {
+		t.Error("removed a static service")
+	}
+}
@@ -0,0 +1,255 @@
+package sigauth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Errors from Verify
+var (
+	ErrUnsigned     = errors.New("request is not signed")
+	ErrUnknownKey   = errors.New("key is not authorized")
+	ErrExpired      = errors.New("signature timestamp is too far from now")
+	ErrReplayed     = errors.New("signed request was already seen")
+	ErrBadSignature = errors.New("signature doesn't match the request")
+)
+
+// recheckEvery is how often a Keyring looks for changes to its file
+const recheckEvery = 2 * time.Second
+
+// Key is a caller allowed to sign requests
+type Key struct {
+	Name      string
+	ID        string // wallet address
+	PublicKey *ecdsa.PublicKey
+	Scopes    []string
+}
+
+// Allows reports whether the key was granted scope
+func (k Key) Allows(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseKeys reads an authorized keys file's contents. Blank lines and lines
+// starting with # are skipped.
+func ParseKeys(data []byte) ([]Key, error) {
+	var keys []Key
+	names := map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("line %d: want a name, a public key and optionally scopes", line)
+		}
+		pub, err := ParsePublicKey(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if names[fields[0]] {
+			return nil, fmt.Errorf("line %d: %s is listed twice", line, fields[0])
+		}
+		names[fields[0]] = true
+		k := Key{Name: fields[0], ID: KeyID(pub), PublicKey: pub}
+		if len(fields) == 3 {
+			k.Scopes = strings.Split(fields[2], ",")
+		}
+		keys = append(keys, k)
+	}
+	return keys, scanner.Err()
+}
+
+// Keyring holds the keys a service trusts and checks requests against them.
+// Loaded from a file, it picks up edits to that file within a few seconds. A
+// nil Keyring trusts no one.
+type Keyring struct {
+	filename string
+
+	mu      sync.Mutex
+	keys    map[string]Key
+	stamp   string    // the file's size and modification time when read
+	checked time.Time // when the file was last looked at
+	seen    map[string]time.Time
+	pruned  time.Time
+}
+
+// NewKeyring returns a Keyring trusting keys
+func NewKeyring(keys ...Key) *Keyring {
+	k := &Keyring{seen: map[string]time.Time{}}
+	k.set(keys)
+	return k
+}
+
+// LoadKeyring reads an authorized keys file. An empty filename gives a nil
+// Keyring, for services where the file is optional.
+func LoadKeyring(filename string) (*Keyring, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	k := &Keyring{filename: filename, seen: map[string]time.Time{}}
+	keys, stamp, err := readKeys(filename)
+	if err != nil {
+		return nil, err
+	}
+	k.set(keys)
+	k.stamp, k.checked = stamp, time.Now()
+	return k, nil
+}
+
+// Len returns how many keys are trusted
+func (k *Keyring) Len() int {
+	if k == nil {
+		return 0
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.refresh()
+	return len(k.keys)
+}
+
+// set replaces the trusted keys
+func (k *Keyring) set(keys []Key) {
+	k.keys = make(map[string]Key, len(keys))
+	for _, key := range keys {
+		k.keys[key.ID] = key
+	}
+}
+
+// refresh reloads the file if it has changed, keeping the old keys if it no
+// longer reads. k.mu is held.
+func (k *Keyring) refresh() {
+	if k.filename == "" || time.Since(k.checked) < recheckEvery {
+		return
+	}
+	k.checked = time.Now()
+	st, err := os.Stat(k.filename)
+	if err == nil && fileStamp(st) == k.stamp {
+		return
+	}
+	keys, stamp, err := readKeys(k.filename)
+	if err != nil {
+		slog.Warn("can't reload authorized keys, keeping the last ones", "file", k.filename, "error", err)
+		return
+	}
+	k.set(keys)
+	k.stamp = stamp
+	slog.Info("authorized keys reloaded", "file", k.filename, "keys", len(keys))
+}
+
+// readKeys reads and parses an authorized keys file
+func readKeys(filename string) ([]Key, string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := io.ReadAll(io.LimitReader(f, maxKeyFileSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > maxKeyFileSize {
+		return nil, "", fmt.Errorf("%s is over %d bytes", filename, maxKeyFileSize)
+	}
+	keys, err := ParseKeys(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", filename, err)
+	}
+	return keys, fileStamp(st), nil
+}
+
+// fileStamp identifies a version of a file
+func fileStamp(st os.FileInfo) string {
+	return fmt.Sprintf("%d %d", st.Size(), st.ModTime().UnixNano())
+}
+
+// Signed reports whether a request claims to be signed, so callers can tell
+// it apart from one carrying a token
+func Signed(r *http.Request) bool {
+	return r.Header.Get(HeaderKey) != "" || r.Header.Get(HeaderSignature) != ""
+}
+
+// Verify checks a request's signature, returning the key that made it. The
+// body is read to hash it and put back for the handler. Requests without the
+// headers fail with ErrUnsigned.
+func (k *Keyring) Verify(r *http.Request) (Key, error) {
+	id, timestamp := r.Header.Get(HeaderKey), r.Header.Get(HeaderTimestamp)
+	nonce, signature := r.Header.Get(HeaderNonce), r.Header.Get(HeaderSignature)
+	if id == "" && signature == "" {
+		return Key{}, ErrUnsigned
+	}
+	if id == "" || timestamp == "" || nonce == "" || signature == "" {
+		return Key{}, errors.New("signed request is missing some of its headers")
+	}
+	if k == nil {
+		return Key{}, ErrUnknownKey
+	}
+
+	k.mu.Lock()
+	k.refresh()
+	key, ok := k.keys[id]
+	k.mu.Unlock()
+	if !ok {
+		return Key{}, ErrUnknownKey
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return Key{}, errors.New("invalid signature timestamp")
+	}
+	signedAt := time.Unix(unix, 0)
+	if d := time.Since(signedAt); d > MaxSkew || d < -MaxSkew {
+		return Key{}, ErrExpired
+	}
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return Key{}, ErrBadSignature
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		return Key{}, err
+	}
+	if !verifySignature(key.PublicKey, signedMessage(r.Method, r.Host, r.URL.RequestURI(), timestamp, nonce, body), sig) {
+		return Key{}, ErrBadSignature
+	}
+
+	// Only now, so forged requests can't use up nonces
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	now := time.Now()
+	if now.Sub(k.pruned) > MaxSkew {
+		for n, expires := range k.seen {
+			if now.After(expires) {
+				delete(k.seen, n)
+			}
+		}
+		k.pruned = now
+	}
+	if _, replayed := k.seen[id+" "+nonce]; replayed {
+		return Key{}, ErrReplayed
+	}
+	k.seen[id+" "+nonce] = signedAt.Add(MaxSkew)
+	return key, nil
+}
@@ -0,0 +1,276 @@
+// Package sigauth lets the home-server services authenticate to each other
+// with wallet keys instead of shared bearer tokens. A caller signs each
+// request with the ECDSA P-256 key of a blockchain wallet, and the service
+// checks it against the public keys it has been told to trust, so no secret
+// ever crosses the network or sits in more than one place.
+//
+// A signed request carries four headers: X-Auth-Key, the signer's key ID,
+// which is its wallet address; X-Auth-Timestamp, the Unix time it was signed;
+// X-Auth-Nonce, a random value used once; and X-Auth-Signature, the hex r||s
+// signature of the SHA-256 of
+//
+//	home-server-request-v1
+//	METHOD
+//	HOST
+//	PATH?QUERY
+//	TIMESTAMP
+//	NONCE
+//	hex SHA-256 of the body
+//
+// one per line, the same signature wallets make. Requests are accepted within
+// MaxSkew of their timestamp and each nonce only once, so a captured request
+// can't be replayed, nor sent to another host or with another body.
+//
+// Trusted keys live in a file with a line for each caller, its name, its
+// public key as hex PKIX DER, the form transactions carry, and optionally a
+// comma-separated list of scopes for services that grant some:
+//
+//	# name   public key                   scopes
+//	gateway  3059301306072a8648ce3d02...
+//	phone    3059301306072a8648ce3d02...  wake,hosts
+//
+// bchain key authorize NAME prints such a line for a saved wallet.
+package sigauth
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of a signed request
+const (
+	HeaderKey       = "X-Auth-Key"
+	HeaderTimestamp = "X-Auth-Timestamp"
+	HeaderNonce     = "X-Auth-Nonce"
+	HeaderSignature = "X-Auth-Signature"
+)
+
+// scheme starts every signed message, so signatures made for anything else
+// never pass as requests
+const scheme = "home-server-request-v1"
+
+// MaxSkew is how far a request's timestamp may be from the verifier's clock
+const MaxSkew = 5 * time.Minute
+
+// MaxBody caps the body of a signed request, which is read whole to hash it
+const MaxBody = 8 << 20
+
+// maxKeyFileSize bounds the key files read
+const maxKeyFileSize = 64 << 10
+
+// KeyID returns the ID of a public key, the same as its wallet address
+func KeyID(pub *ecdsa.PublicKey) string {
+	hash := sha256.Sum256(append(pub.X.Bytes(), pub.Y.Bytes()...))
+	return hex.EncodeToString(hash[:])
+}
+
+// EncodePublicKey returns a public key as hex PKIX DER, as transactions and
+// authorized keys files carry it
+func EncodePublicKey(pub *ecdsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(der), nil
+}
+
+// ParsePublicKey reads a P-256 public key written by EncodePublicKey
+func ParsePublicKey(s string) (*ecdsa.PublicKey, error) {
+	der, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("public key is not hex")
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	pub, ok := key.(*ecdsa.PublicKey)
+	if !ok || pub.Curve != elliptic.P256() {
+		return nil, errors.New("public key is not ECDSA P-256")
+	}
+	return pub, nil
+}
+
+// Signer signs requests with a wallet key. A nil Signer signs nothing, so
+// callers can hold one whether or not a key is configured.
+type Signer struct {
+	key *ecdsa.PrivateKey
+	id  string
+}
+
+// NewSigner returns a Signer for a P-256 private key
+func NewSigner(key *ecdsa.PrivateKey) (*Signer, error) {
+	if key.Curve != elliptic.P256() {
+		return nil, errors.New("key is not ECDSA P-256")
+	}
+	return &Signer{key: key, id: KeyID(&key.PublicKey)}, nil
+}
+
+// LoadSigner reads an unencrypted wallet key file, as written by bchain wallet
+// new, bchain key export -unencrypted or a node's wallet.pem. An empty
+// filename gives a nil Signer, for services where the key is optional.
+func LoadSigner(filename string) (*Signer, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxKeyFileSize))
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM key found", filename)
+	}
+	if block.Type != "EC PRIVATE KEY" {
+		return nil, fmt.Errorf("%s: a %s can't sign requests; export it with bchain key export -unencrypted", filename, block.Type)
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	s, err := NewSigner(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return s, nil
+}
+
+// ID returns the signer's key ID, its wallet address
+func (s *Signer) ID() string {
+	return s.id
+}
+
+// PublicKey returns the signer's public key, encoded for an authorized keys
+// file
+func (s *Signer) PublicKey() string {
+	pub, err := EncodePublicKey(&s.key.PublicKey)
+	if err != nil {
+		// P-256 keys always marshal
+		panic(err)
+	}
+	return pub
+}
+
+// Sign adds the signature headers to a request about to be sent, reading
+// its body to hash it and putting it back. It does nothing for a nil Signer.
+func (s *Signer) Sign(req *http.Request) error {
+	if s == nil {
+		return nil
+	}
+	body, err := readBody(req)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	message := signedMessage(req.Method, host, req.URL.RequestURI(), timestamp, hex.EncodeToString(nonce), body)
+
+	hash := sha256.Sum256(message)
+	r, sv, err := ecdsa.Sign(rand.Reader, s.key, hash[:])
+	if err != nil {
+		return fmt.Errorf("failed to sign: %w", err)
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	sv.FillBytes(signature[32:])
+
+	req.Header.Set(HeaderKey, s.id)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, hex.EncodeToString(nonce))
+	req.Header.Set(HeaderSignature, hex.EncodeToString(signature))
+	return nil
+}
+
+// Transport returns a RoundTripper that signs each request before passing it
+// to base, or http.DefaultTransport if base is nil. A nil Signer returns base
+// as it is.
+func (s *Signer) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if s == nil {
+		return base
+	}
+	return &transport{signer: s, base: base}
+}
+
+// transport signs requests on their way out
+type transport struct {
+	signer *Signer
+	base   http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers mustn't change the caller's request
+	req = req.Clone(req.Context())
+	if err := t.signer.Sign(req); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// readBody reads a request's body whole and puts it back
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, MaxBody+1))
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > MaxBody {
+		return nil, fmt.Errorf("body is over %d bytes, too big to sign", MaxBody)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return body, nil
+}
+
+// signedMessage is what a request's signature covers
+func signedMessage(method, host, uri, timestamp, nonce string, body []byte) []byte {
+	bodyHash := sha256.Sum256(body)
+	return []byte(strings.Join([]string{
+		scheme, method, strings.ToLower(host), uri, timestamp, nonce, hex.EncodeToString(bodyHash[:]),
+	}, "\n"))
+}
+
+// verifySignature checks an r||s signature of message
+func verifySignature(pub *ecdsa.PublicKey, message, signature []byte) bool {
+	if len(signature) != 64 {
+		return false
+	}
+	hash := sha256.Sum256(message)
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	return ecdsa.Verify(pub, hash[:], r, s)
+}
@@ -0,0 +1,211 @@
+package sigauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newSigner(t *testing.T) *Signer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSigner(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func keyFor(t *testing.T, name string, s *Signer, scopes ...string) Key {
+	t.Helper()
+	return Key{Name: name, ID: s.ID(), PublicKey: &s.key.PublicKey, Scopes: scopes}
+}
+
+// signedRequest makes a request as a server would receive it, signed by s
+func signedRequest(t *testing.T, s *Signer, method, target, body string) *http.Request {
+	t.Helper()
+	out, err := http.NewRequest(method, target, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Sign(out); err != nil {
+		t.Fatal(err)
+	}
+	in := httptest.NewRequest(method, target, strings.NewReader(body))
+	in.Header = out.Header.Clone()
+	return in
+}
+
+func TestVerify(t *testing.T) {
+	alice, mallory := newSigner(t), newSigner(t)
+	keys := NewKeyring(keyFor(t, "alice", alice, "wake"))
+
+	r := signedRequest(t, alice, "POST", "http://nas:8080/wake?mac=x", `{"a":1}`)
+	again := httptest.NewRequest("POST", "http://nas:8080/wake?mac=x", strings.NewReader(`{"a":1}`))
+	again.Header = r.Header.Clone()
+	key, err := keys.Verify(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Name != "alice" || !key.Allows("wake") || key.Allows("admin") {
+		t.Errorf("got key %+v", key)
+	}
+	if body, _ := io.ReadAll(r.Body); string(body) != `{"a":1}` {
+		t.Errorf("body not put back: %q", body)
+	}
+	if _, err := keys.Verify(again); !errors.Is(err, ErrReplayed) {
+		t.Errorf("replayed: got %v", err)
+	}
+
+	if _, err := keys.Verify(signedRequest(t, mallory, "GET", "http://nas:8080/", "")); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("unknown key: got %v", err)
+	}
+	if _, err := keys.Verify(httptest.NewRequest("GET", "http://nas:8080/", nil)); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("unsigned: got %v", err)
+	}
+	var none *Keyring
+	if _, err := none.Verify(signedRequest(t, alice, "GET", "http://nas:8080/", "")); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("nil keyring: got %v", err)
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	alice := newSigner(t)
+	keys := NewKeyring(keyFor(t, "alice", alice))
+
+	for name, tamper := range map[string]func(r *http.Request){
+		"body":   func(r *http.Request) { r.Body = io.NopCloser(strings.NewReader(`{"a":2}`)) },
+		"method": func(r *http.Request) { r.Method = "PUT" },
+		"host":   func(r *http.Request) { r.Host = "other:8080" },
+		"path":   func(r *http.Request) { r.URL.Path = "/shutdown" },
+		"query":  func(r *http.Request) { r.URL.RawQuery = "mac=y" },
+		"nonce":  func(r *http.Request) { r.Header.Set(HeaderNonce, "00") },
+	} {
+		r := signedRequest(t, alice, "POST", "http://nas:8080/wake?mac=x", `{"a":1}`)
+		tamper(r)
+		if _, err := keys.Verify(r); !errors.Is(err, ErrBadSignature) {
+			t.Errorf("%s changed: got %v", name, err)
+		}
+	}
+
+	r := signedRequest(t, alice, "GET", "http://nas:8080/", "")
+	r.Header.Set(HeaderTimestamp, strconv.FormatInt(time.Now().Add(-MaxSkew-time.Minute).Unix(), 10))
+	if _, err := keys.Verify(r); !errors.Is(err, ErrExpired) {
+		t.Errorf("old timestamp: got %v", err)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	alice := newSigner(t)
+	keys := NewKeyring(keyFor(t, "alice", alice))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, err := keys.Verify(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte(key.Name + " " + string(body)))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: alice.Transport(nil)}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Post(server.URL+"/drain?now=1", "text/plain", strings.NewReader("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(body) != "alice hello" {
+			t.Errorf("got %s %q", resp.Status, body)
+		}
+	}
+
+	var nobody *Signer
+	if nobody.Transport(http.DefaultTransport) != http.DefaultTransport {
+		t.Error("nil signer wrapped the transport")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	alice, bob := newSigner(t), newSigner(t)
+
+	der, err := x509.MarshalECPrivateKey(alice.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "alice.pem")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadSigner(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ID() != alice.ID() {
+		t.Errorf("loaded %s, want %s", loaded.ID(), alice.ID())
+	}
+	encrypted := filepath.Join(dir, "encrypted.pem")
+	os.WriteFile(encrypted, pem.EncodeToMemory(&pem.Block{Type: "BCHAIN ENCRYPTED KEY", Bytes: []byte("x")}), 0600)
+	if _, err := LoadSigner(encrypted); err == nil || !strings.Contains(err.Error(), "export") {
+		t.Errorf("encrypted key: got %v", err)
+	}
+
+	keysFile := filepath.Join(dir, "authorized_keys")
+	os.WriteFile(keysFile, []byte("# trusted\nalice "+alice.PublicKey()+"\n"), 0600)
+	keys, err := LoadKeyring(keysFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys.Len() != 1 {
+		t.Fatalf("got %d keys", keys.Len())
+	}
+	if _, err := keys.Verify(signedRequest(t, bob, "GET", "http://nas/", "")); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("bob before being added: got %v", err)
+	}
+
+	// Edits are picked up, and a broken file keeps the last keys
+	os.WriteFile(keysFile, []byte("alice "+alice.PublicKey()+"\nbob "+bob.PublicKey()+" wake,hosts\n"), 0600)
+	keys.checked = time.Time{}
+	key, err := keys.Verify(signedRequest(t, bob, "GET", "http://nas/", ""))
+	if err != nil || !key.Allows("hosts") {
+		t.Errorf("bob after being added: got %+v, %v", key, err)
+	}
+	os.WriteFile(keysFile, []byte("bob not-a-key\n"), 0600)
+	keys.checked = time.Time{}
+	if keys.Len() != 2 {
+		t.Errorf("broken file: got %d keys", keys.Len())
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	s := newSigner(t)
+	for _, data := range []string{
+		"alice",
+		"alice nothex",
+		"alice 3059",
+		"alice " + s.PublicKey() + " wake extra",
+		"alice " + s.PublicKey() + "\nalice " + s.PublicKey(),
+	} {
+		if _, err := ParseKeys([]byte(data)); err == nil {
+			t.Errorf("%q: no error", data)
+		}
+	}
+}
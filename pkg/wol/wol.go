@@ -0,0 +1,51 @@
+// Package wol wakes machines over the network by sending Wake-on-LAN magic
+// packets
+package wol
+
+import (
+	"fmt"
+	"net"
+)
+
+// DefaultBroadcast is where magic packets go unless told otherwise: every
+// machine on the local network, on the discard port most network cards listen on
+const DefaultBroadcast = "255.255.255.255:9"
+
+// MagicPacket builds the packet that wakes the machine with the given
+// Ethernet address: six 0xFF bytes followed by the address sixteen times
+func MagicPacket(mac net.HardwareAddr) ([]byte, error) {
+	if len(mac) != 6 {
+		return nil, fmt.Errorf("%s is not a 6-byte Ethernet address", mac)
+	}
+	packet := make([]byte, 0, 6+16*6)
+	for range 6 {
+		packet = append(packet, 0xFF)
+	}
+	for range 16 {
+		packet = append(packet, mac...)
+	}
+	return packet, nil
+}
+
+// Send broadcasts a magic packet for mac, such as "aa:bb:cc:dd:ee:ff", to
+// addr, a host:port that is usually the network's broadcast address
+func Send(mac, addr string) error {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return err
+	}
+	packet, err := MagicPacket(hw)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s: %w", addr, err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(packet); err != nil {
+		return fmt.Errorf("failed to send magic packet to %s: %w", addr, err)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package wol
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestMagicPacket(t *testing.T) {
+	mac, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+	packet, err := MagicPacket(mac)
+	if err != nil {
+		t.Fatalf("MagicPacket failed: %v", err)
+	}
+	if len(packet) != 102 || !bytes.Equal(packet[:6], bytes.Repeat([]byte{0xFF}, 6)) {
+		t.Fatalf("expected 102 bytes starting with six 0xFF, got % x", packet)
+	}
+	if !bytes.Equal(packet[6:], bytes.Repeat(mac, 16)) {
+		t.Errorf("expected the address sixteen times, got % x", packet[6:])
+	}
+
+	long, _ := net.ParseMAC("00:00:00:00:fe:80:00:00:00:00:00:00:02:00:5e:10:00:00:00:01")
+	if _, err := MagicPacket(long); err == nil {
+		t.Error("expected a 20-byte address to be refused")
+	}
+}
+
+func TestSend(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	if err := Send("aa:bb:cc:dd:ee:ff", conn.LocalAddr().String()); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	buf := make([]byte, 200)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil || n != 102 {
+		t.Errorf("expected a 102-byte packet, got %d bytes, %v", n, err)
+	}
+
+	if err := Send("not-a-mac", conn.LocalAddr().String()); err == nil {
+		t.Error("expected a bad address to be refused")
+	}
+}
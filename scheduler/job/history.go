@@ -0,0 +1,145 @@
+package job
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// maxRuns is how many runs History keeps, of all jobs together
+const maxRuns = 1000
+
+// History keeps the most recent runs and, given a file, appends them to it
+// so they survive restarts
+type History struct {
+	runs      []Run  // oldest first, at most maxRuns
+	filename  string // "" keeps runs in memory only
+	fileLines int    // runs in the file, which is compacted when it grows past twice maxRuns
+	mu        sync.Mutex
+}
+
+// OpenHistory loads the runs saved in filename and appends new ones to it.
+// With no filename, runs are kept in memory only.
+func OpenHistory(filename string) (*History, error) {
+	h := &History{filename: filename}
+	if filename == "" {
+		return h, nil
+	}
+	f, err := os.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r Run
+		// Skip a line torn by a crash mid-write rather than losing the whole history
+		if json.Unmarshal(scanner.Bytes(), &r) != nil {
+			continue
+		}
+		h.fileLines++
+		h.append(r)
+	}
+	return h, scanner.Err()
+}
+
+// Add records a run
+func (h *History) Add(r Run) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.append(r)
+	return h.persist(r)
+}
+
+// Runs returns up to limit runs, newest first, of the named job or with no
+// name of every job. A limit of 0 or less means all of them.
+func (h *History) Runs(job string, limit int) []Run {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	runs := []Run{}
+	for i := len(h.runs) - 1; i >= 0 && (limit <= 0 || len(runs) < limit); i-- {
+		if job == "" || h.runs[i].Job == job {
+			runs = append(runs, h.runs[i])
+		}
+	}
+	return runs
+}
+
+// Last returns the latest run of a job, if it has one
+func (h *History) Last(job string) (Run, bool) {
+	if runs := h.Runs(job, 1); len(runs) > 0 {
+		return runs[0], true
+	}
+	return Run{}, false
+}
+
+// append adds a run, dropping the oldest once there are too many. Callers
+// must hold the lock.
+func (h *History) append(r Run) {
+	h.runs = append(h.runs, r)
+	if len(h.runs) > maxRuns {
+		h.runs = append(h.runs[:0], h.runs[len(h.runs)-maxRuns:]...)
+	}
+}
+
+// persist appends a run to the file, rewriting it with only the kept runs
+// once it holds too many. Callers must hold the lock.
+func (h *History) persist(r Run) error {
+	if h.filename == "" {
+		return nil
+	}
+
+	if h.fileLines >= 2*maxRuns {
+		tmp := h.filename + ".tmp"
+		if err := writeRuns(tmp, h.runs); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		if err := os.Rename(tmp, h.filename); err != nil {
+			return err
+		}
+		h.fileLines = len(h.runs)
+		return nil
+	}
+
+	f, err := os.OpenFile(h.filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	h.fileLines++
+	return nil
+}
+
+// writeRuns writes runs to a file, one JSON object per line
+func writeRuns(filename string, runs []Run) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, r := range runs {
+		if err := enc.Encode(r); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
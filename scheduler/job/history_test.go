@@ -0,0 +1,46 @@
+package job
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "runs.jsonl")
+	h, err := OpenHistory(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Add(Run{Job: "a", OK: true})
+	h.Add(Run{Job: "b"})
+	h.Add(Run{Job: "a", Attempts: 2})
+
+	h, err = OpenHistory(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs := h.Runs("a", 0); len(runs) != 2 || runs[0].Attempts != 2 || !runs[1].OK {
+		t.Errorf("got %+v", runs)
+	}
+	if runs := h.Runs("", 2); len(runs) != 2 || runs[1].Job != "b" {
+		t.Errorf("got %+v", runs)
+	}
+	if _, ok := h.Last("c"); ok {
+		t.Error("expected no run of c")
+	}
+
+	for i := 0; i < 2*maxRuns; i++ {
+		if err := h.Add(Run{Job: "c"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, _ := os.ReadFile(filename)
+	if lines := bytes.Count(data, []byte("\n")); lines > 2*maxRuns {
+		t.Errorf("expected the file to be compacted, got %d runs", lines)
+	}
+	if runs := h.Runs("", 0); len(runs) != maxRuns {
+		t.Errorf("kept %d runs", len(runs))
+	}
+}
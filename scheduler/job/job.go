@@ -0,0 +1,263 @@
+// Package job runs HTTP requests and commands on cron schedules, retrying
+// those that fail and keeping a history of every run
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/oksmith/home-server/pkg/cron"
+	"github.com/oksmith/home-server/pkg/sigauth"
+)
+
+// Defaults for a job's settings
+const (
+	DefaultTimeout    = 5 * time.Minute
+	DefaultRetryDelay = 30 * time.Second
+	// maxRetries caps a job's retries, which double their delay each time
+	maxRetries = 10
+	// maxOutput is how much of a run's output or response is kept
+	maxOutput = 2048
+)
+
+// HiddenToken stands in for a job's token where it is shown
+const HiddenToken = "********"
+
+// HTTP is a request a job makes. It succeeds on a 2xx reply.
+type HTTP struct {
+	Method  string            `json:"method,omitempty"` // POST unless set
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	Token   string            `json:"token,omitempty"` // sent as a bearer token; without one, the request is signed if the runner has a key
+}
+
+// Spec is a job as the jobs file and the API give it
+type Spec struct {
+	Name       string   `json:"name"`
+	Schedule   string   `json:"schedule"`              // a cron expression, or a shorthand such as @daily
+	Jitter     string   `json:"jitter,omitempty"`      // a random delay of up to this after each scheduled time
+	Timeout    string   `json:"timeout,omitempty"`     // for each attempt, default DefaultTimeout
+	Retries    int      `json:"retries,omitempty"`     // further attempts after one fails
+	RetryDelay string   `json:"retry_delay,omitempty"` // before the first retry, doubling each time, default DefaultRetryDelay
+	HTTP       *HTTP    `json:"http,omitempty"`
+	Command    []string `json:"command,omitempty"` // a program and its arguments, run without a shell
+	Paused     bool     `json:"paused,omitempty"`  // scheduled runs are skipped, but it can still be run by hand
+}
+
+// Job is a checked Spec
+type Job struct {
+	Spec
+	schedule   *cron.Schedule
+	jitter     time.Duration
+	timeout    time.Duration
+	retryDelay time.Duration
+}
+
+// New checks a spec and returns its job
+func New(spec Spec) (*Job, error) {
+	j := &Job{Spec: spec, timeout: DefaultTimeout, retryDelay: DefaultRetryDelay}
+	if spec.Name == "" || strings.ContainsAny(spec.Name, "/ ") {
+		return nil, fmt.Errorf("job %q needs a name without slashes or spaces", spec.Name)
+	}
+	var err error
+	if j.schedule, err = cron.Parse(spec.Schedule); err != nil {
+		return nil, fmt.Errorf("job %s: %w", spec.Name, err)
+	}
+	for _, d := range []struct {
+		name  string
+		value string
+		into  *time.Duration
+	}{
+		{"jitter", spec.Jitter, &j.jitter},
+		{"timeout", spec.Timeout, &j.timeout},
+		{"retry_delay", spec.RetryDelay, &j.retryDelay},
+	} {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("job %s: %s must be a positive duration such as 30s, not %q", spec.Name, d.name, d.value)
+		}
+		*d.into = v
+	}
+	if spec.Retries < 0 || spec.Retries > maxRetries {
+		return nil, fmt.Errorf("job %s: retries must be from 0 to %d", spec.Name, maxRetries)
+	}
+
+	switch {
+	case spec.HTTP != nil && len(spec.Command) > 0:
+		return nil, fmt.Errorf("job %s has both http and command; give one", spec.Name)
+	case spec.HTTP != nil:
+		u, err := url.Parse(spec.HTTP.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("job %s: http url must be an http:// or https:// URL, not %q", spec.Name, spec.HTTP.URL)
+		}
+	case len(spec.Command) > 0:
+		if spec.Command[0] == "" {
+			return nil, fmt.Errorf("job %s: command needs a program", spec.Name)
+		}
+	default:
+		return nil, fmt.Errorf("job %s needs an http request or a command to run", spec.Name)
+	}
+	return j, nil
+}
+
+// Parse reads a JSON list of jobs, such as
+//
+//	[{"name": "empty-block", "schedule": "0 2 * * *", "jitter": "10m",
+//	  "http": {"url": "http://localhost:8080/api/v1/mine", "token": "..."}},
+//	 {"name": "backup", "schedule": "@daily", "retries": 3, "retry_delay": "5m",
+//	  "http": {"url": "http://nas.lan:8095/api/v1/backups"}},
+//	 {"name": "ap-power-cycle", "schedule": "0 4 * * 1", "command": ["ssh", "ap.lan", "reboot"]}]
+func Parse(data []byte) ([]*Job, error) {
+	var specs []Spec
+	if err := json.Unmarshal(data, &specs); err != nil {
+		return nil, err
+	}
+	var jobs []*Job
+	seen := map[string]bool{}
+	for _, spec := range specs {
+		j, err := New(spec)
+		if err != nil {
+			return nil, err
+		}
+		if seen[j.Name] {
+			return nil, fmt.Errorf("job %s is listed twice", j.Name)
+		}
+		seen[j.Name] = true
+		jobs = append(jobs, j)
+	}
+	return jobs, nil
+}
+
+// Next returns when the job is next due after t, before any jitter
+func (j *Job) Next(t time.Time) (time.Time, error) {
+	return j.schedule.Next(t)
+}
+
+// Redacted returns the job's spec without its token, to show
+func (j *Job) Redacted() Spec {
+	s := j.Spec
+	if s.HTTP != nil && s.HTTP.Token != "" {
+		h := *s.HTTP
+		h.Token = HiddenToken
+		s.HTTP = &h
+	}
+	return s
+}
+
+// Run is one run of a job, with each of its attempts
+type Run struct {
+	Job      string    `json:"job"`
+	Trigger  string    `json:"trigger"` // schedule or manual
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Attempts int       `json:"attempts"`
+	OK       bool      `json:"ok"`
+	Output   string    `json:"output,omitempty"` // the start of the last attempt's output or reply
+	Error    string    `json:"error,omitempty"`
+}
+
+// Runner runs jobs
+type Runner struct {
+	Client *http.Client
+	Signer *sigauth.Signer // signs HTTP jobs without a token, if set
+}
+
+// Run runs a job, retrying as it says until an attempt succeeds, the retries
+// run out or ctx is done
+func (r *Runner) Run(ctx context.Context, j *Job, trigger string) Run {
+	run := Run{Job: j.Name, Trigger: trigger, Started: time.Now().UTC()}
+	delay := j.retryDelay
+	for {
+		run.Attempts++
+		output, err := r.attempt(ctx, j)
+		run.Output, run.Error = output, ""
+		if err == nil {
+			run.OK = true
+			break
+		}
+		run.Error = err.Error()
+		if run.Attempts > j.Retries || ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	run.Finished = time.Now().UTC()
+	return run
+}
+
+// attempt runs a job once
+func (r *Runner) attempt(ctx context.Context, j *Job) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, j.timeout)
+	defer cancel()
+	if j.HTTP != nil {
+		return r.request(ctx, j.HTTP)
+	}
+	out, err := exec.CommandContext(ctx, j.Command[0], j.Command[1:]...).CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %s", j.timeout)
+	}
+	return clip(out), err
+}
+
+// request makes a job's HTTP request
+func (r *Runner) request(ctx context.Context, h *HTTP) (string, error) {
+	method := h.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	var body io.Reader
+	if h.Body != "" {
+		body = strings.NewReader(h.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, h.URL, body)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range h.Headers {
+		req.Header.Set(k, v)
+	}
+	if h.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.Token)
+	} else if err := r.Signer.Sign(req); err != nil {
+		return "", err
+	}
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	reply, _ := io.ReadAll(io.LimitReader(resp.Body, maxOutput+1))
+	if resp.StatusCode/100 != 2 {
+		return clip(reply), errors.New(resp.Status)
+	}
+	return clip(reply), nil
+}
+
+// clip trims output to what is kept of it
+func clip(out []byte) string {
+	s := strings.TrimSpace(string(out))
+	if len(s) > maxOutput {
+		s = s[:maxOutput] + "..."
+	}
+	return s
+}
@@ -0,0 +1,110 @@
+package job
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	j, err := New(Spec{Name: "backup", Schedule: "@daily", Jitter: "10m", Retries: 2, HTTP: &HTTP{URL: "http://nas.lan:8095/api/v1/backups", Token: "secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.jitter != 10*time.Minute || j.timeout != DefaultTimeout || j.retryDelay != DefaultRetryDelay {
+		t.Errorf("got jitter %s, timeout %s, retry delay %s", j.jitter, j.timeout, j.retryDelay)
+	}
+	if r := j.Redacted(); r.HTTP.Token == "secret" || j.HTTP.Token != "secret" {
+		t.Errorf("redacting gave %q and left %q", r.HTTP.Token, j.HTTP.Token)
+	}
+	at, _ := j.Next(time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local))
+	if want := time.Date(2026, 3, 2, 0, 0, 0, 0, time.Local); !at.Equal(want) {
+		t.Errorf("next run at %s, want %s", at, want)
+	}
+
+	for _, bad := range []Spec{
+		{Schedule: "@daily", Command: []string{"true"}},
+		{Name: "a b", Schedule: "@daily", Command: []string{"true"}},
+		{Name: "x", Schedule: "61 * * * *", Command: []string{"true"}},
+		{Name: "x", Schedule: "@daily"},
+		{Name: "x", Schedule: "@daily", Command: []string{"true"}, HTTP: &HTTP{URL: "http://x"}},
+		{Name: "x", Schedule: "@daily", HTTP: &HTTP{URL: "ftp://x"}},
+		{Name: "x", Schedule: "@daily", Command: []string{""}},
+		{Name: "x", Schedule: "@daily", Command: []string{"true"}, Jitter: "soon"},
+		{Name: "x", Schedule: "@daily", Command: []string{"true"}, Timeout: "-1s"},
+		{Name: "x", Schedule: "@daily", Command: []string{"true"}, Retries: maxRetries + 1},
+	} {
+		if _, err := New(bad); err == nil {
+			t.Errorf("expected %+v to be refused", bad)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	jobs, err := Parse([]byte(`[
+		{"name": "empty-block", "schedule": "0 2 * * *", "http": {"url": "http://localhost:8080/api/v1/mine"}},
+		{"name": "ap-power-cycle", "schedule": "0 4 * * 1", "command": ["ssh", "ap.lan", "reboot"]}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 || jobs[1].Command[0] != "ssh" {
+		t.Errorf("got %+v", jobs)
+	}
+	if _, err := Parse([]byte(`[{"name": "x", "schedule": "@daily", "command": ["true"]},
+		{"name": "x", "schedule": "@hourly", "command": ["true"]}]`)); err == nil {
+		t.Error("expected a repeated name to be refused")
+	}
+}
+
+func TestRunHTTP(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("got %s with %q", r.Method, r.Header.Get("Authorization"))
+		}
+		if calls.Add(1) < 3 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("mined"))
+	}))
+	defer srv.Close()
+
+	j, err := New(Spec{Name: "mine", Schedule: "@daily", Retries: 2, RetryDelay: "10ms", HTTP: &HTTP{URL: srv.URL, Token: "secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := (&Runner{}).Run(context.Background(), j, "manual")
+	if !run.OK || run.Attempts != 3 || run.Output != "mined" || run.Error != "" {
+		t.Errorf("got %+v", run)
+	}
+
+	calls.Store(-10)
+	run = (&Runner{}).Run(context.Background(), j, "manual")
+	if run.OK || run.Attempts != 3 || run.Output != "busy" || !strings.Contains(run.Error, "503") {
+		t.Errorf("expected it to fail after 3 attempts, got %+v", run)
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	j, err := New(Spec{Name: "echo", Schedule: "@daily", Command: []string{"echo", "hello"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run := (&Runner{}).Run(context.Background(), j, "schedule"); !run.OK || run.Output != "hello" {
+		t.Errorf("got %+v", run)
+	}
+
+	j, err = New(Spec{Name: "slow", Schedule: "@daily", Timeout: "50ms", Command: []string{"sleep", "5"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run := (&Runner{}).Run(context.Background(), j, "schedule"); run.OK || !strings.Contains(run.Error, "timed out") {
+		t.Errorf("expected a timeout, got %+v", run)
+	}
+}
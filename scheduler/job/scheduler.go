@@ -0,0 +1,270 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Errors RunNow returns
+var (
+	ErrNotFound = errors.New("no such job")
+	ErrRunning  = errors.New("job is already running")
+)
+
+// Status is a job as the scheduler sees it, with its token hidden
+type Status struct {
+	Spec
+	Next    *time.Time `json:"next,omitempty"` // when it is next due, unless it is paused
+	Running bool       `json:"running"`
+	Last    *Run       `json:"last,omitempty"`
+}
+
+// entry is a job the scheduler holds
+type entry struct {
+	job     *Job
+	due     time.Time // the scheduled time of the next run
+	next    time.Time // due plus jitter, when the timer fires
+	timer   *time.Timer
+	running bool
+}
+
+// Scheduler runs jobs when their schedules say. A scheduled run is skipped
+// while the job is paused or still running from last time, so runs of one
+// job never overlap.
+type Scheduler struct {
+	runner  *Runner
+	history *History
+	onRun   func(Run)
+	jitter  func(time.Duration) time.Duration
+	jobs    map[string]*entry
+	ctx     context.Context
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+}
+
+// NewScheduler returns a scheduler running jobs with runner until ctx is
+// done, recording each run in history and then passing it to onRun, if set
+func NewScheduler(ctx context.Context, runner *Runner, history *History, onRun func(Run)) *Scheduler {
+	return &Scheduler{
+		runner:  runner,
+		history: history,
+		onRun:   onRun,
+		jitter:  func(d time.Duration) time.Duration { return rand.N(d) },
+		jobs:    map[string]*entry{},
+		ctx:     ctx,
+	}
+}
+
+// Put adds a job, or replaces the one with its name. A run of the old job
+// already under way carries on.
+func (s *Scheduler) Put(j *Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := &entry{job: j}
+	if old, ok := s.jobs[j.Name]; ok {
+		s.stop(old)
+		e.running = old.running
+	}
+	s.jobs[j.Name] = e
+	s.arm(e, time.Now())
+}
+
+// Remove drops a job, reporting whether there was one. A run under way
+// carries on.
+func (s *Scheduler) Remove(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.jobs[name]
+	if ok {
+		s.stop(e)
+		delete(s.jobs, name)
+	}
+	return ok
+}
+
+// SetPaused pauses or resumes a job, returning it as it now is
+func (s *Scheduler) SetPaused(name string, paused bool) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.jobs[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if e.job.Paused != paused {
+		j := *e.job
+		j.Paused = paused
+		e.job = &j
+		s.stop(e)
+		s.arm(e, time.Now())
+	}
+	return e.job, nil
+}
+
+// RunNow starts a run of a job by hand, paused or not, returning a channel
+// that gets the run once it has finished
+func (s *Scheduler) RunNow(name string) (<-chan Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.jobs[name]
+	switch {
+	case !ok:
+		return nil, ErrNotFound
+	case e.running:
+		return nil, ErrRunning
+	}
+	done := make(chan Run, 1)
+	s.start(e, "manual", done)
+	return done, nil
+}
+
+// Job returns a job's status
+func (s *Scheduler) Job(name string) (Status, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.jobs[name]
+	if !ok {
+		return Status{}, false
+	}
+	return s.status(e), true
+}
+
+// Jobs returns the status of every job, by name
+func (s *Scheduler) Jobs() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Status, 0, len(s.jobs))
+	for _, e := range s.jobs {
+		list = append(list, s.status(e))
+	}
+	slices.SortFunc(list, func(a, b Status) int { return strings.Compare(a.Name, b.Name) })
+	return list
+}
+
+// Specs returns every job's spec, token included, by name, for saving
+func (s *Scheduler) Specs() []Spec {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	specs := make([]Spec, 0, len(s.jobs))
+	for _, e := range s.jobs {
+		specs = append(specs, e.job.Spec)
+	}
+	slices.SortFunc(specs, func(a, b Spec) int { return strings.Compare(a.Name, b.Name) })
+	return specs
+}
+
+// Wait stops scheduling and waits for runs under way, which end early once
+// the scheduler's context is done
+func (s *Scheduler) Wait() {
+	s.mu.Lock()
+	for _, e := range s.jobs {
+		s.stop(e)
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// status describes an entry. Callers must hold the lock.
+func (s *Scheduler) status(e *entry) Status {
+	st := Status{Spec: e.job.Redacted(), Running: e.running}
+	if e.timer != nil {
+		next := e.next
+		st.Next = &next
+	}
+	if last, ok := s.history.Last(e.job.Name); ok {
+		st.Last = &last
+	}
+	return st
+}
+
+// arm sets an entry's timer for its next time after t, unless it is paused
+// or its schedule never matches. Callers must hold the lock.
+func (s *Scheduler) arm(e *entry, t time.Time) {
+	if e.job.Paused || s.ctx.Err() != nil {
+		return
+	}
+	due, err := e.job.Next(t)
+	if err != nil {
+		log.Printf("job %s will not run: %v", e.job.Name, err)
+		return
+	}
+	e.due, e.next = due, due
+	if e.job.jitter > 0 {
+		e.next = due.Add(s.jitter(e.job.jitter))
+	}
+	e.timer = time.AfterFunc(time.Until(e.next), func() { s.fire(e) })
+}
+
+// stop stops an entry's timer. Callers must hold the lock.
+func (s *Scheduler) stop(e *entry) {
+	if e.timer != nil {
+		e.timer.Stop()
+		e.timer = nil
+	}
+}
+
+// fire starts a scheduled run of an entry that is still current, after
+// arming its next one
+func (s *Scheduler) fire(e *entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.jobs[e.job.Name] != e || e.timer == nil {
+		return
+	}
+	// Arm from when it was due rather than now, so jitter can't skip the next
+	// slot, unless it fired so late, after the machine slept, that it would
+	// catch up on every slot missed
+	from := e.due
+	if late := time.Now().Add(-e.job.jitter); late.After(from) {
+		from = late
+	}
+	s.arm(e, from)
+	if e.running {
+		log.Printf("skipping the scheduled run of %s: %v", e.job.Name, ErrRunning)
+		return
+	}
+	s.start(e, "schedule", nil)
+}
+
+// start runs an entry's job in the background, sending the run to done if it
+// is set. Callers must hold the lock.
+func (s *Scheduler) start(e *entry, trigger string, done chan<- Run) {
+	e.running = true
+	j := e.job
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		run := s.runner.Run(s.ctx, j, trigger)
+		if err := s.history.Add(run); err != nil {
+			log.Printf("failed to save the run of %s: %v", j.Name, err)
+		}
+
+		s.mu.Lock()
+		// The job may have been replaced meanwhile, in which case it is the
+		// replacement that has now stopped running
+		if cur, ok := s.jobs[j.Name]; ok {
+			cur.running = false
+		}
+		s.mu.Unlock()
+
+		if s.onRun != nil {
+			s.onRun(run)
+		}
+		if done != nil {
+			done <- run
+		}
+	}()
+}
@@ -0,0 +1,89 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+
+	history, _ := OpenHistory("")
+	ran := make(chan Run, 10)
+	s := NewScheduler(context.Background(), &Runner{}, history, func(r Run) { ran <- r })
+	s.jitter = func(d time.Duration) time.Duration { return d }
+	j, err := New(Spec{Name: "mine", Schedule: "0 2 * * *", Jitter: "10m", HTTP: &HTTP{URL: srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put(j)
+
+	st, ok := s.Job("mine")
+	if !ok || st.Next == nil || st.Next.Hour() != 2 || st.Next.Minute() != 10 {
+		t.Fatalf("got %+v", st)
+	}
+
+	done, err := s.RunNow("mine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RunNow("mine"); !errors.Is(err, ErrRunning) {
+		t.Errorf("expected a second run to be refused, got %v", err)
+	}
+	// A scheduled run while it is still running is skipped
+	s.fire(s.jobs["mine"])
+	close(release)
+	if run := <-done; !run.OK || run.Trigger != "manual" {
+		t.Errorf("got %+v", run)
+	}
+	<-ran
+	s.Wait()
+	if runs := history.Runs("", 0); len(runs) != 1 {
+		t.Errorf("expected one run, got %+v", runs)
+	}
+	if st, _ := s.Job("mine"); st.Running || st.Last == nil {
+		t.Errorf("got %+v", st)
+	}
+
+	if _, err := s.RunNow("nope"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestSchedulerPause(t *testing.T) {
+	history, _ := OpenHistory("")
+	s := NewScheduler(context.Background(), &Runner{}, history, nil)
+	j, err := New(Spec{Name: "echo", Schedule: "@hourly", Command: []string{"echo"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put(j)
+	defer s.Wait()
+
+	if j, err := s.SetPaused("echo", true); err != nil || !j.Paused {
+		t.Fatalf("got %+v, %v", j, err)
+	}
+	if st, _ := s.Job("echo"); st.Next != nil {
+		t.Errorf("a paused job should have no next run, got %s", st.Next)
+	}
+	if specs := s.Specs(); len(specs) != 1 || !specs[0].Paused {
+		t.Errorf("got %+v", specs)
+	}
+	if _, err := s.SetPaused("echo", false); err != nil {
+		t.Fatal(err)
+	}
+	if st, _ := s.Job("echo"); st.Next == nil {
+		t.Error("a resumed job should have a next run")
+	}
+	if !s.Remove("echo") || s.Remove("echo") || len(s.Jobs()) != 0 {
+		t.Error("expected the job to be removed once")
+	}
+}
@@ -0,0 +1,363 @@
+// Command scheduler runs the home-server's recurring jobs on cron schedules:
+// HTTP requests to the other services, such as mining an empty block each
+// night or starting a backup, and commands, such as power-cycling the access
+// point weekly.
+//
+// JOBS_FILE is a JSON list of jobs; see job.Parse for the format. Each has a
+// cron expression, or a shorthand such as @daily, in local time, and either
+// an HTTP request, which succeeds on a 2xx reply, or a command, run without
+// a shell. A job may add a random jitter after each scheduled time, give
+// each attempt a timeout (default 5m) and retry a failed run, waiting
+// retry_delay (default 30s) and doubling it each time. A scheduled run is
+// skipped while the job is paused or its last run is still going. HTTP jobs
+// send their token as a bearer token, or without one are signed with
+// SERVICE_KEY.
+//
+// Every run is kept in memory, the latest 1000 of them, and appended to
+// HISTORY_FILE if it is set so they survive restarts. NOTIFY_URL, the
+// address of notify-service, has it tell people when a run fails for good,
+// as event job_failed (high priority). NOTIFY_TOKEN is the hub's token.
+//
+// GET /api/v1/jobs lists the jobs with their next and last runs, tokens
+// hidden. GET /api/v1/jobs/NAME gives one with its recent runs. PUT
+// /api/v1/jobs/NAME adds or replaces an HTTP job, taking it as JSON in the
+// jobs file's format, and DELETE removes one; both rewrite JOBS_FILE. A
+// token given as "********", as GET shows it, keeps the job's current one.
+// Command jobs can only be added in JOBS_FILE, so the API can't be used to
+// run programs. POST /api/v1/jobs/NAME/run starts a run now, answering 409
+// if one is going, or with ?wait=true waits for it, answering 200 if it
+// succeeded or 502. POST /api/v1/jobs/NAME/pause and /resume stop and
+// restart its scheduled runs. GET /api/v1/runs?job=NAME&limit=N lists the
+// latest runs, newest first (default 50, of every job).
+//
+// Otherwise it serves as package httpserver describes, on LISTEN_ADDR
+// (default :8098) with SCHEDULER_TOKEN as its token, and registers with the
+// gateway as scheduler by default. Stopping it cuts short runs in progress.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"github.com/oksmith/home-server/pkg/config"
+	"github.com/oksmith/home-server/pkg/httpserver"
+	"github.com/oksmith/home-server/pkg/notify"
+	"github.com/oksmith/home-server/pkg/registry"
+	"github.com/oksmith/home-server/pkg/sigauth"
+	"github.com/oksmith/home-server/scheduler/job"
+)
+
+const (
+	// maxSpec caps the size of a job sent to the API
+	maxSpec = 64 << 10
+	// defaultRuns is how many runs GET /api/v1/runs lists unless asked
+	defaultRuns = 50
+	// jobRuns is how many recent runs GET /api/v1/jobs/NAME includes
+	jobRuns = 20
+)
+
+// settings are the service's settings
+var settings = []config.Field{
+	{Name: "JOBS_FILE", Required: true},
+	{Name: "HISTORY_FILE"},
+	{Name: "LISTEN_ADDR", Default: ":8098", Check: config.HostPort},
+	{Name: "SCHEDULER_TOKEN", Secret: true, Reload: true},
+	{Name: "TLS_CERT"},
+	{Name: "TLS_KEY"},
+	{Name: "GATEWAY_URL", Check: config.HTTPURL},
+	{Name: "GATEWAY_REGISTRY_TOKEN", Secret: true},
+	{Name: "GATEWAY_NAME", Default: "scheduler"},
+	{Name: "GATEWAY_SERVICE_URL", Check: config.HTTPURL},
+	{Name: "AUTHORIZED_KEYS"},
+	{Name: "SERVICE_KEY"},
+	{Name: "NOTIFY_URL", Check: config.HTTPURL},
+	{Name: "NOTIFY_TOKEN", Secret: true, Reload: true},
+}
+
+// jobsFile is the jobs file, which the API's changes are written back to
+type jobsFile struct {
+	path string
+	mu   sync.Mutex
+}
+
+// load reads the jobs in the file
+func (f *jobsFile) load() ([]*job.Job, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+	return job.Parse(data)
+}
+
+// save replaces the file with the scheduler's jobs, via a temporary file so a
+// crash never leaves it half written. It holds tokens, so only its owner can
+// read it.
+func (f *jobsFile) save(s *job.Scheduler) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, err := json.MarshalIndent(s.Specs(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), ".jobs-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// reportRun logs a run and tells people if it failed
+func reportRun(events *notify.Client) func(job.Run) {
+	return func(run job.Run) {
+		if run.OK {
+			log.Printf("job %s succeeded after %d attempts", run.Job, run.Attempts)
+			return
+		}
+		log.Printf("job %s failed after %d attempts: %s", run.Job, run.Attempts, run.Error)
+		events.Send(notify.Message{Event: "job_failed", Priority: notify.High,
+			Title: "Job " + run.Job + " failed", Text: run.Error,
+			Fields: map[string]string{"job": run.Job, "trigger": run.Trigger, "attempts": strconv.Itoa(run.Attempts)}})
+	}
+}
+
+// putHandler adds or replaces an HTTP job and saves the jobs
+func putHandler(s *job.Scheduler, file *jobsFile) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		var spec job.Spec
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSpec)).Decode(&spec); err != nil {
+			http.Error(w, "invalid job: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if spec.Name == "" {
+			spec.Name = name
+		}
+		if spec.Name != name {
+			http.Error(w, fmt.Sprintf("job is named %q, not %q", spec.Name, name), http.StatusBadRequest)
+			return
+		}
+		if len(spec.Command) > 0 {
+			http.Error(w, "command jobs can only be added in JOBS_FILE", http.StatusForbidden)
+			return
+		}
+		if old, ok := s.Job(name); ok && old.HTTP == nil {
+			http.Error(w, "command jobs can only be changed in JOBS_FILE", http.StatusForbidden)
+			return
+		}
+		if spec.HTTP != nil && spec.HTTP.Token == job.HiddenToken {
+			spec.HTTP.Token = ""
+			for _, old := range s.Specs() {
+				if old.Name == name && old.HTTP != nil {
+					spec.HTTP.Token = old.HTTP.Token
+				}
+			}
+		}
+		j, err := job.New(spec)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_, existed := s.Job(name)
+		s.Put(j)
+		if err := file.save(s); err != nil {
+			log.Printf("failed to save %s: %v", file.path, err)
+			http.Error(w, "job scheduled but not saved: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("job %s saved through the API", name)
+		status := http.StatusCreated
+		if existed {
+			status = http.StatusOK
+		}
+		st, _ := s.Job(name)
+		httpserver.WriteJSON(w, status, st)
+	}
+}
+
+// runHandler starts a run of a job now, waiting for it if asked
+func runHandler(s *job.Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		done, err := s.RunNow(r.PathValue("name"))
+		switch {
+		case errors.Is(err, job.ErrNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if r.URL.Query().Get("wait") != "true" {
+			httpserver.WriteJSON(w, http.StatusAccepted, map[string]string{"status": "started"})
+			return
+		}
+		select {
+		case run := <-done:
+			status := http.StatusOK
+			if !run.OK {
+				status = http.StatusBadGateway
+			}
+			httpserver.WriteJSON(w, status, run)
+		case <-r.Context().Done():
+		}
+	}
+}
+
+// pauseHandler pauses or resumes a job and saves the jobs
+func pauseHandler(s *job.Scheduler, file *jobsFile, paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := s.SetPaused(r.PathValue("name"), paused); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err := file.save(s); err != nil {
+			log.Printf("failed to save %s: %v", file.path, err)
+		}
+		st, _ := s.Job(r.PathValue("name"))
+		httpserver.WriteJSON(w, http.StatusOK, st)
+	}
+}
+
+func main() {
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"), settings...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	file := &jobsFile{path: cfg.Get("JOBS_FILE")}
+	jobs, err := file.load()
+	if err != nil {
+		log.Fatalf("JOBS_FILE: %v", err)
+	}
+	history, err := job.OpenHistory(cfg.Get("HISTORY_FILE"))
+	if err != nil {
+		log.Fatalf("HISTORY_FILE: %v", err)
+	}
+	addr := cfg.Get("LISTEN_ADDR")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go cfg.Watch(ctx, config.DefaultPoll)
+
+	keys, err := sigauth.LoadKeyring(cfg.Get("AUTHORIZED_KEYS"))
+	if err != nil {
+		log.Fatalf("AUTHORIZED_KEYS: %v", err)
+	}
+	signer, err := sigauth.LoadSigner(cfg.Get("SERVICE_KEY"))
+	if err != nil {
+		log.Fatalf("SERVICE_KEY: %v", err)
+	}
+	events := notify.NewClient(cfg.Get("NOTIFY_URL"), "scheduler", func() string { return cfg.Get("NOTIFY_TOKEN") }, signer)
+
+	s := job.NewScheduler(ctx, &job.Runner{Signer: signer}, history, reportRun(events))
+	for _, j := range jobs {
+		s.Put(j)
+	}
+
+	token := func() string { return cfg.Get("SCHEDULER_TOKEN") }
+	g := httpserver.NewGuard(httpserver.DefaultLimits)
+	auth := func(next http.HandlerFunc) http.Handler {
+		return httpserver.RequireAuth("scheduler", token, keys, g, next)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.Handle("GET /api/v1/jobs", auth(func(w http.ResponseWriter, r *http.Request) {
+		httpserver.WriteJSON(w, http.StatusOK, map[string][]job.Status{"jobs": s.Jobs()})
+	}))
+	mux.Handle("GET /api/v1/jobs/{name}", auth(func(w http.ResponseWriter, r *http.Request) {
+		st, ok := s.Job(r.PathValue("name"))
+		if !ok {
+			http.Error(w, job.ErrNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		httpserver.WriteJSON(w, http.StatusOK, struct {
+			job.Status
+			Runs []job.Run `json:"runs"`
+		}{st, history.Runs(st.Name, jobRuns)})
+	}))
+	mux.Handle("PUT /api/v1/jobs/{name}", auth(putHandler(s, file)))
+	mux.Handle("DELETE /api/v1/jobs/{name}", auth(func(w http.ResponseWriter, r *http.Request) {
+		if !s.Remove(r.PathValue("name")) {
+			http.Error(w, job.ErrNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		if err := file.save(s); err != nil {
+			log.Printf("failed to save %s: %v", file.path, err)
+			http.Error(w, "job removed but not saved: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("job %s removed through the API", r.PathValue("name"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mux.Handle("POST /api/v1/jobs/{name}/run", auth(runHandler(s)))
+	mux.Handle("POST /api/v1/jobs/{name}/pause", auth(pauseHandler(s, file, true)))
+	mux.Handle("POST /api/v1/jobs/{name}/resume", auth(pauseHandler(s, file, false)))
+	mux.Handle("GET /api/v1/runs", auth(func(w http.ResponseWriter, r *http.Request) {
+		limit := defaultRuns
+		if v := r.URL.Query().Get("limit"); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+				http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+				return
+			}
+		}
+		httpserver.WriteJSON(w, http.StatusOK, map[string][]job.Run{"runs": history.Runs(r.URL.Query().Get("job"), limit)})
+	}))
+	metrics := httpserver.NewMetrics()
+	server := &http.Server{Addr: addr, Handler: g.Middleware(httpserver.InstrumentMux(metrics, slog.Default(), mux))}
+
+	certFile, keyFile := cfg.Get("TLS_CERT"), cfg.Get("TLS_KEY")
+	switch {
+	case certFile == "" && keyFile == "":
+		log.Printf("scheduler starting on %s with %d jobs", addr, len(jobs))
+	case certFile == "" || keyFile == "":
+		log.Fatal("TLS_CERT and TLS_KEY must be set together")
+	default:
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		log.Printf("scheduler starting on %s with TLS and %d jobs", addr, len(jobs))
+	}
+
+	var withdrawn chan struct{}
+	if gateway := cfg.Get("GATEWAY_URL"); gateway != "" {
+		gs, err := registry.Local(cfg.Get("GATEWAY_NAME"), cfg.Get("GATEWAY_SERVICE_URL"), addr, server.TLSConfig != nil)
+		if err != nil {
+			log.Fatalf("GATEWAY_URL: %v", err)
+		}
+		withdrawn = make(chan struct{})
+		go func() {
+			registry.Announce(ctx, gateway, cfg.Get("GATEWAY_REGISTRY_TOKEN"), signer, func() registry.Service {
+				gs.Token = token()
+				return gs
+			}, registry.DefaultTTL/3)
+			close(withdrawn)
+		}()
+	}
+	if err := httpserver.ListenAndServe(ctx, server, certFile, keyFile); err != nil {
+		log.Fatal(err)
+	}
+	s.Wait()
+	if withdrawn != nil {
+		<-withdrawn
+	}
+	log.Println("scheduler stopped")
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oksmith/home-server/pkg/httpserver"
+)
+
+const (
+	// auditMaxSize is the size at which the audit file is rotated
+	auditMaxSize = 10 << 20
+	// auditKeep is how many rotated files (audit.jsonl.1, .2, ...) are kept
+	auditKeep = 5
+	// auditDefaultLimit is how many entries GET /audit returns by default
+	auditDefaultLimit = 100
+)
+
+// auditEntry is one line of the audit file
+type auditEntry struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"` // client IP, or "scheduler"
+	Method string    `json:"method,omitempty"`
+	Action string    `json:"action"` // request path, or the scheduled action
+	Query  string    `json:"query,omitempty"`
+	Auth   string    `json:"auth,omitempty"` // token:NAME, cert, missing, denied, limited, ...
+	Status int       `json:"status,omitempty"`
+	DryRun bool      `json:"dry_run,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+	Error  string    `json:"error,omitempty"` // the error response, or why a scheduled action failed
+}
+
+// auditLog appends entries to a JSONL file, rotating it once it grows past
+// auditMaxSize. A nil auditLog records nothing.
+type auditLog struct {
+	path string
+	file *os.File
+	size int64
+	mu   sync.Mutex
+}
+
+// openAuditLog opens the audit file for appending, creating it if needed
+func openAuditLog(path string) (*auditLog, error) {
+	a := &auditLog{path: path}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *auditLog) open() error {
+	f, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("opening audit file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	a.file, a.size = f, info.Size()
+	return nil
+}
+
+// record appends an entry, rotating the file first if it is full
+func (a *auditLog) record(e auditEntry) {
+	if a == nil {
+		return
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("audit: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.size+int64(len(line)) > auditMaxSize && a.size > 0 {
+		if err := a.rotate(); err != nil {
+			log.Printf("audit: rotating %s failed: %v", a.path, err)
+		}
+	}
+	if a.file == nil {
+		return
+	}
+	n, err := a.file.Write(line)
+	a.size += int64(n)
+	if err != nil {
+		log.Printf("audit: %v", err)
+	}
+}
+
+// rotate shifts audit.jsonl to audit.jsonl.1, .1 to .2 and so on up to the
+// first gap, dropping the oldest if there is none, and starts a new file. If
+// the current file can't be moved aside it is kept, so entries go on being
+// recorded, and the next entry tries again.
+func (a *auditLog) rotate() error {
+	a.file.Close()
+	a.file = nil
+	last := auditKeep
+	for n := 1; n < auditKeep; n++ {
+		if _, err := os.Lstat(a.rotated(n)); os.IsNotExist(err) {
+			last = n
+			break
+		}
+	}
+	for i := last - 1; i >= 1; i-- {
+		os.Rename(a.rotated(i), a.rotated(i+1))
+	}
+	if err := os.Rename(a.path, a.rotated(1)); err != nil {
+		return errors.Join(err, a.open())
+	}
+	return a.open()
+}
+
+// rotated returns the name of the nth rotated file, or the current one for 0
+func (a *auditLog) rotated(n int) string {
+	if n == 0 {
+		return a.path
+	}
+	return a.path + "." + strconv.Itoa(n)
+}
+
+// recent returns up to limit of the newest entries, oldest first, reading
+// back through the rotated files if the current one is short
+func (a *auditLog) recent(limit int) ([]json.RawMessage, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var entries []json.RawMessage
+	for n := 0; n <= auditKeep && len(entries) < limit; n++ {
+		f, err := os.Open(a.rotated(n))
+		if os.IsNotExist(err) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		var lines []json.RawMessage
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if json.Valid(scanner.Bytes()) {
+				lines = append(lines, json.RawMessage(append([]byte(nil), scanner.Bytes()...)))
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		entries = append(lines, entries...)
+	}
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries, nil
+}
+
+// auditRecorder captures what a handler did with a request
+type auditRecorder struct {
+	http.ResponseWriter
+	entry auditEntry
+	body  []byte
+}
+
+func (rec *auditRecorder) WriteHeader(status int) {
+	if rec.entry.Status == 0 {
+		rec.entry.Status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *auditRecorder) Write(b []byte) (int, error) {
+	if rec.entry.Status == 0 {
+		rec.entry.Status = http.StatusOK
+	}
+	// Error responses are short messages from http.Error
+	if rec.entry.Status >= 400 && len(rec.body) < 200 {
+		rec.body = append(rec.body, b...)
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// noteDryRun records that a request only simulated its action, if it is being audited
+func noteDryRun(w http.ResponseWriter) {
+	if rec, ok := w.(*auditRecorder); ok {
+		rec.entry.DryRun = true
+	}
+}
+
+// noteReason records the reason given for an action, if the request is being audited
+func noteReason(w http.ResponseWriter, reason string) {
+	if rec, ok := w.(*auditRecorder); ok {
+		rec.entry.Reason = reason
+	}
+}
+
+// noteAuth records how a request authenticated, if it is being audited
+func noteAuth(w http.ResponseWriter, result string) {
+	if rec, ok := w.(*auditRecorder); ok {
+		rec.entry.Auth = result
+	}
+}
+
+// middleware records every request passing through next, except health probes
+func (a *auditLog) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Probes would drown out everything else
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rec := &auditRecorder{ResponseWriter: w, entry: auditEntry{
+			Time:   time.Now(),
+			Source: clientIP(r),
+			Method: r.Method,
+			Action: strings.TrimPrefix(r.URL.Path, "/"),
+			Query:  r.URL.RawQuery,
+		}}
+		next.ServeHTTP(rec, r)
+
+		if rec.entry.Status == 0 {
+			rec.entry.Status = http.StatusOK
+		}
+		if rec.entry.Status >= 400 {
+			rec.entry.Error = strings.TrimSpace(string(rec.body))
+		}
+		a.record(rec.entry)
+	})
+}
+
+// auditHandler returns the newest audit entries, ?limit=N of them
+func auditHandler(a *auditLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+
+		limit := auditDefaultLimit
+		if s := r.URL.Query().Get("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n <= 0 {
+				http.Error(w, fmt.Sprintf("limit must be a positive number, not %q", s), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		entries, err := a.recent(limit)
+		if err != nil {
+			log.Printf("reading audit log failed: %v", err)
+			http.Error(w, "reading audit log failed", http.StatusInternalServerError)
+			return
+		}
+		if entries == nil {
+			entries = []json.RawMessage{}
+		}
+		httpserver.WriteJSON(w, http.StatusOK, entries)
+	}
+}
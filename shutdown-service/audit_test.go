@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuditRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	a, err := openAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { a.file.Close() }()
+	a.record(auditEntry{Action: "/first"})
+
+	// Rotated files that can't be replaced stop the current one being moved
+	// aside, which must not lose what comes after
+	for n := 1; n <= auditKeep; n++ {
+		if err := os.MkdirAll(filepath.Join(a.rotated(n), "x"), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a.size = auditMaxSize
+	a.record(auditEntry{Action: "/second"})
+	if a.file == nil {
+		t.Fatal("expected the audit file reopened after a failed rotation")
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "/first") || !strings.Contains(string(data), "/second") {
+		t.Fatalf("expected both entries in %s, got %s", path, data)
+	}
+
+	// Once the way is clear, a full file rotates
+	for n := 1; n <= auditKeep; n++ {
+		os.RemoveAll(a.rotated(n))
+	}
+	a.size = auditMaxSize
+	a.record(auditEntry{Action: "/third"})
+	entries, err := a.recent(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || !strings.Contains(string(entries[2]), "/third") {
+		t.Errorf("expected all 3 entries, newest last, got %s", entries)
+	}
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), "/second") {
+		t.Error("expected the full file rotated to .1")
+	}
+
+	// Rotating again shifts .1 up to the gap rather than dropping it
+	a.size = auditMaxSize
+	a.record(auditEntry{Action: "/fourth"})
+	if _, err := os.Stat(a.rotated(2)); err != nil {
+		t.Errorf("expected the first rotated file kept as .2: %v", err)
+	}
+	if entries, _ := a.recent(10); len(entries) != 4 {
+		t.Errorf("expected 4 entries, got %d", len(entries))
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// powerCommand carries out one power action
+type powerCommand interface {
+	Run() error
+	Check() error // whether Run could work, without running it
+	String() string
+}
+
+// checkTimeout bounds each readiness check
+const checkTimeout = 5 * time.Second
+
+// errUnsupported means the backend has no way to carry out an action
+var errUnsupported = errors.New("not supported by this backend")
+
+// execCommand runs a program, such as sudo shutdown now
+type execCommand []string
+
+func (c execCommand) Run() error {
+	var stderr bytes.Buffer
+	cmd := exec.Command(c[0], c[1:]...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %w: %s", c, err, msg)
+		}
+		return fmt.Errorf("%s: %w", c, err)
+	}
+	return nil
+}
+
+// Check makes sure the program exists and, when it is run with sudo, that the
+// sudoers rules allow it without a password
+func (c execCommand) Check() error {
+	if _, err := exec.LookPath(c[0]); err != nil {
+		return err
+	}
+	if filepath.Base(c[0]) != "sudo" || len(c) < 2 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+	// sudo -l COMMAND succeeds only if COMMAND may be run
+	args := append([]string{"-n", "-l"}, c[1:]...)
+	if out, err := exec.CommandContext(ctx, c[0], args...).CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("sudo won't run %s: %s", strings.Join(c[1:], " "), msg)
+		}
+		return fmt.Errorf("sudo won't run %s without a password", strings.Join(c[1:], " "))
+	}
+	return nil
+}
+
+func (c execCommand) String() string {
+	return strings.Join(c, " ")
+}
+
+// fakeCommand only records the action, appending it to a file if one is
+// given, for trying the service out in containers and tests
+type fakeCommand struct {
+	action string
+	file   string
+}
+
+func (c fakeCommand) Run() error {
+	log.Printf("fake backend: %s", c.action)
+	if c.file == "" {
+		return nil
+	}
+	f, err := os.OpenFile(c.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%s %s\n", time.Now().Format(time.RFC3339), c.action)
+	return err
+}
+
+func (c fakeCommand) Check() error { return nil }
+
+func (c fakeCommand) String() string {
+	if c.file == "" {
+		return "fake " + c.action
+	}
+	return "fake " + c.action + " >> " + c.file
+}
+
+// commandBackends are the commands each POWER_BACKEND runs for each action.
+// An action that's missing isn't supported.
+var commandBackends = map[string]map[string]string{
+	// The original commands, for a user allowed to run them with sudo
+	"sudo": {
+		"shutdown": "sudo shutdown now",
+		"reboot":   "sudo systemctl reboot",
+		// --no-block returns once the sleep is queued rather than after waking
+		// up, so the client gets its reply
+		"suspend":   "sudo systemctl --no-block suspend",
+		"hibernate": "sudo systemctl --no-block hibernate",
+	},
+	// For a user polkit lets manage power, or running as root
+	"systemd": {
+		"shutdown":  "systemctl poweroff",
+		"reboot":    "systemctl reboot",
+		"suspend":   "systemctl --no-block suspend",
+		"hibernate": "systemctl --no-block hibernate",
+	},
+	// FreeBSD and OpenBSD; only OpenBSD has ZZZ to hibernate, so it isn't offered
+	"bsd": {
+		"shutdown": "sudo shutdown -p now",
+		"reboot":   "sudo shutdown -r now",
+		"suspend":  "sudo zzz",
+	},
+	"macos": {
+		"shutdown": "sudo shutdown -h now",
+		"reboot":   "sudo shutdown -r now",
+		"suspend":  "pmset sleepnow",
+	},
+	// Windows has no command to sleep without hibernating when hibernation is
+	// on, so suspend needs SUSPEND_CMD, e.g. psshutdown -d -t 0
+	"windows": {
+		"shutdown":  "shutdown /s /t 0",
+		"reboot":    "shutdown /r /t 0",
+		"hibernate": "shutdown /h",
+	},
+}
+
+// defaultBackend is the POWER_BACKEND for the operating system the service
+// was built for
+func defaultBackend() string {
+	switch runtime.GOOS {
+	case "windows":
+		return "windows"
+	case "darwin":
+		return "macos"
+	case "freebsd", "openbsd":
+		return "bsd"
+	}
+	return "sudo"
+}
+
+// backendCommands returns the commands of a POWER_BACKEND: sudo, systemd,
+// bsd, macos, windows, syscall or fake. Actions set in their *_CMD
+// environment variable run that command instead.
+func backendCommands(backend string) (map[string]powerCommand, error) {
+	commands := make(map[string]powerCommand)
+	switch backend {
+	case "syscall":
+		var err error
+		if commands, err = syscallCommands(); err != nil {
+			return nil, err
+		}
+	case "fake":
+		for _, a := range actions {
+			commands[a.name] = fakeCommand{action: a.name, file: cfg.Get("POWER_FAKE_FILE")}
+		}
+	default:
+		defaults, ok := commandBackends[backend]
+		if !ok {
+			return nil, fmt.Errorf("unknown POWER_BACKEND %q; use sudo, systemd, bsd, macos, windows, syscall or fake", backend)
+		}
+		for name, command := range defaults {
+			commands[name] = execCommand(strings.Fields(command))
+		}
+	}
+
+	for _, a := range actions {
+		if custom := strings.Fields(cfg.Get(a.env)); len(custom) > 0 {
+			commands[a.name] = execCommand(custom)
+		}
+	}
+	return commands, nil
+}
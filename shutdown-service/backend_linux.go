@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// capSysBoot is CAP_SYS_BOOT's bit in a capability set
+const capSysBoot = 22
+
+// syscallCommand carries out an action with a system call rather than a
+// program, which needs root or CAP_SYS_BOOT
+type syscallCommand struct {
+	name  string
+	do    func() error
+	check func() error
+}
+
+func (c syscallCommand) Run() error     { return c.do() }
+func (c syscallCommand) Check() error   { return c.check() }
+func (c syscallCommand) String() string { return c.name }
+
+// canReboot checks the process may call reboot(2)
+func canReboot() error {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		hex, ok := strings.CutPrefix(scanner.Text(), "CapEff:")
+		if !ok {
+			continue
+		}
+		caps, err := strconv.ParseUint(strings.TrimSpace(hex), 16, 64)
+		if err != nil {
+			return err
+		}
+		if caps&(1<<capSysBoot) == 0 {
+			return errors.New("missing CAP_SYS_BOOT; run as root or grant it with AmbientCapabilities=CAP_SYS_BOOT")
+		}
+		return nil
+	}
+	return errors.New("no CapEff in /proc/self/status")
+}
+
+// canSleep checks the kernel supports state and the process may ask for it
+func canSleep(state string) error {
+	data, err := os.ReadFile("/sys/power/state")
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(strings.Fields(string(data)), state) {
+		return fmt.Errorf("the kernel doesn't support %q; /sys/power/state lists %q", state, strings.TrimSpace(string(data)))
+	}
+	f, err := os.OpenFile("/sys/power/state", os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// syscallCommands power the machine off and restart it with reboot(2), and
+// sleep through /sys/power/state. Filesystems are synced first, but services
+// aren't stopped and the client won't get a reply to a shutdown or reboot.
+func syscallCommands() (map[string]powerCommand, error) {
+	reboot := func(cmd int) func() error {
+		return func() error {
+			syscall.Sync()
+			return syscall.Reboot(cmd)
+		}
+	}
+	sleep := func(state string) func() error {
+		return func() error {
+			syscall.Sync()
+			return os.WriteFile("/sys/power/state", []byte(state), 0)
+		}
+	}
+	return map[string]powerCommand{
+		"shutdown":  syscallCommand{"reboot(POWER_OFF)", reboot(syscall.LINUX_REBOOT_CMD_POWER_OFF), canReboot},
+		"reboot":    syscallCommand{"reboot(RESTART)", reboot(syscall.LINUX_REBOOT_CMD_RESTART), canReboot},
+		"suspend":   syscallCommand{"mem > /sys/power/state", sleep("mem"), func() error { return canSleep("mem") }},
+		"hibernate": syscallCommand{"disk > /sys/power/state", sleep("disk"), func() error { return canSleep("disk") }},
+	}, nil
+}
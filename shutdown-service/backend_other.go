@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// syscallCommands is only available on Linux
+func syscallCommands() (map[string]powerCommand, error) {
+	return nil, errors.New("the syscall backend needs Linux")
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// confirmTTL is how long a confirmation token can be redeemed
+const confirmTTL = 60 * time.Second
+
+// confirmation is a power action waiting to be confirmed
+type confirmation struct {
+	action  string
+	delay   time.Duration
+	dryRun  bool
+	reason  string
+	expires time.Time
+}
+
+// confirmations holds the one-time tokens of actions that need a second
+// request before they run, so one stray request can't power the server off
+type confirmations struct {
+	actions map[string]bool // actions that need confirming
+	pending map[string]confirmation
+	mu      sync.Mutex
+}
+
+// newConfirmations reads CONFIRM_ACTIONS, a comma-separated list of actions
+// such as "shutdown,reboot", or "all"
+func newConfirmations(list string) (*confirmations, error) {
+	c := &confirmations{actions: make(map[string]bool), pending: make(map[string]confirmation)}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "":
+		case name == "all":
+			for _, a := range actions {
+				c.actions[a.name] = true
+			}
+		case !isAction(name):
+			return nil, fmt.Errorf("CONFIRM_ACTIONS: unknown action %q", name)
+		default:
+			c.actions[name] = true
+		}
+	}
+	return c, nil
+}
+
+// isAction reports whether name is one of the power actions
+func isAction(name string) bool {
+	for _, a := range actions {
+		if a.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// required reports whether an action needs confirming
+func (c *confirmations) required(name string) bool {
+	return c.actions[name]
+}
+
+// issue records an action awaiting confirmation and returns its token
+func (c *confirmations) issue(name string, delay time.Duration, dryRun bool, reason string) (string, time.Time, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	token := hex.EncodeToString(b)
+	expires := time.Now().Add(confirmTTL)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for t, p := range c.pending {
+		if time.Now().After(p.expires) {
+			delete(c.pending, t)
+		}
+	}
+	c.pending[token] = confirmation{action: name, delay: delay, dryRun: dryRun, reason: reason, expires: expires}
+	return token, expires, nil
+}
+
+// redeem uses up a token for an action, returning what was confirmed
+func (c *confirmations) redeem(name, token string) (confirmation, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.pending[token]
+	if !ok || p.action != name {
+		return confirmation{}, false
+	}
+	delete(c.pending, token)
+	return p, time.Now().Before(p.expires)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewConfirmations(t *testing.T) {
+	c, err := newConfirmations(" shutdown, reboot ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.required("shutdown") || !c.required("reboot") || c.required("suspend") {
+		t.Errorf("expected shutdown and reboot to need confirming, got %v", c.actions)
+	}
+	if all, _ := newConfirmations("all"); !all.required("hibernate") {
+		t.Error("expected all to cover every action")
+	}
+	if none, _ := newConfirmations(""); none.required("shutdown") {
+		t.Error("expected nothing to need confirming by default")
+	}
+	if _, err := newConfirmations("shutdown,explode"); err == nil {
+		t.Error("expected an unknown action to be refused")
+	}
+}
+
+func TestRedeemConfirmation(t *testing.T) {
+	c, _ := newConfirmations("shutdown,reboot")
+	token, expires, err := c.issue("shutdown", 10*time.Minute, true, "updates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(expires); d <= 0 || d > confirmTTL {
+		t.Errorf("expected the token to expire within %s, got %s", confirmTTL, d)
+	}
+
+	if _, ok := c.redeem("shutdown", "wrong"); ok {
+		t.Error("redeemed an unknown token")
+	}
+	if _, ok := c.redeem("reboot", token); ok {
+		t.Error("redeemed a shutdown token for reboot")
+	}
+	got, ok := c.redeem("shutdown", token)
+	if !ok || got.delay != 10*time.Minute || !got.dryRun || got.reason != "updates" {
+		t.Errorf("expected the confirmed request back, got %+v, %v", got, ok)
+	}
+	if _, ok := c.redeem("shutdown", token); ok {
+		t.Error("redeemed a token twice")
+	}
+
+	// An expired token is refused, and used up
+	token, _, _ = c.issue("reboot", 0, false, "")
+	p := c.pending[token]
+	p.expires = time.Now().Add(-time.Second)
+	c.pending[token] = p
+	if _, ok := c.redeem("reboot", token); ok {
+		t.Error("redeemed an expired token")
+	}
+	if _, left := c.pending[token]; left {
+		t.Error("expected the expired token dropped")
+	}
+
+	// Issuing another prunes expired tokens nobody redeemed
+	stale, _, _ := c.issue("reboot", 0, false, "")
+	p = c.pending[stale]
+	p.expires = time.Now().Add(-time.Second)
+	c.pending[stale] = p
+	c.issue("shutdown", 0, false, "")
+	if _, left := c.pending[stale]; left || len(c.pending) != 1 {
+		t.Errorf("expected only the new token pending, got %d", len(c.pending))
+	}
+}
+
+func TestConfirmHandler(t *testing.T) {
+	var ran []string
+	run := func(name string, dryRun bool, reason string) error {
+		ran = append(ran, name)
+		return nil
+	}
+	sched := &scheduler{run: run}
+	c, _ := newConfirmations("shutdown")
+	shutdown := actions[0]
+
+	w := httptest.NewRecorder()
+	actionHandler(shutdown, run, sched, c, false)(w, httptest.NewRequest("POST", "/shutdown", nil))
+	if w.Code != http.StatusAccepted || len(ran) != 0 {
+		t.Fatalf("expected a confirmation token instead of a shutdown, got %d and ran %v", w.Code, ran)
+	}
+	var token string
+	for pending := range c.pending {
+		token = pending
+	}
+
+	confirm := func(token string) int {
+		w := httptest.NewRecorder()
+		confirmHandler(shutdown, run, sched, c)(w, httptest.NewRequest("POST", "/shutdown/confirm",
+			strings.NewReader(`{"token": "`+token+`"}`)))
+		return w.Code
+	}
+	if code := confirm("wrong"); code != http.StatusForbidden {
+		t.Errorf("wrong token: got %d", code)
+	}
+	if code := confirm(token); code != http.StatusOK || len(ran) != 1 {
+		t.Errorf("expected the shutdown run once confirmed, got %d and ran %v", code, ran)
+	}
+	if code := confirm(token); code != http.StatusForbidden || len(ran) != 1 {
+		t.Errorf("expected a used token to be refused, got %d", code)
+	}
+}
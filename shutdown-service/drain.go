@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultDrainTimeout is how long a service has to acknowledge a drain
+const defaultDrainTimeout = 30 * time.Second
+
+// drainService is another service on this machine told to save its state
+// before the power goes, such as the blockchain node's POST /api/v1/shutdown
+type drainService struct {
+	Name    string   `json:"name"`
+	URL     string   `json:"url"`               // POSTed to, acknowledged with any 2xx
+	Token   string   `json:"token,omitempty"`   // sent as a bearer token
+	Timeout string   `json:"timeout,omitempty"` // e.g. "1m", default 30s
+	Actions []string `json:"actions,omitempty"` // default shutdown and reboot
+
+	timeout time.Duration
+}
+
+// loadDrainServices reads the drain file, a JSON array of
+// {name, url, token, timeout, actions}
+func loadDrainServices(filename string) ([]drainService, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var services []drainService
+	if err := json.Unmarshal(data, &services); err != nil {
+		return nil, fmt.Errorf("invalid drain file %s: %w", filename, err)
+	}
+
+	for i := range services {
+		s := &services[i]
+		switch {
+		case s.Name == "":
+			return nil, fmt.Errorf("drain service %d needs a name", i+1)
+		case !strings.HasPrefix(s.URL, "http://") && !strings.HasPrefix(s.URL, "https://"):
+			return nil, fmt.Errorf("drain service %s: url must start with http:// or https://", s.Name)
+		}
+		s.timeout = defaultDrainTimeout
+		if s.Timeout != "" {
+			if s.timeout, err = time.ParseDuration(s.Timeout); err != nil || s.timeout <= 0 {
+				return nil, fmt.Errorf("drain service %s: invalid timeout %q", s.Name, s.Timeout)
+			}
+		}
+		if len(s.Actions) == 0 {
+			// Suspending and hibernating keep memory, so services lose nothing
+			s.Actions = []string{"shutdown", "reboot"}
+		}
+		for _, a := range s.Actions {
+			if !isAction(a) {
+				return nil, fmt.Errorf("drain service %s: unknown action %q", s.Name, a)
+			}
+		}
+	}
+	return services, nil
+}
+
+// drainServices tells every service that wants it about action at once, and
+// returns when they have all acknowledged or timed out. A service that fails
+// or doesn't answer is logged but doesn't stop the action. A dry run only
+// logs the services it would drain.
+func drainServices(services []drainService, action string, dryRun bool) {
+	var wg sync.WaitGroup
+	for _, s := range services {
+		if !slices.Contains(s.Actions, action) {
+			continue
+		}
+		if dryRun {
+			log.Printf("dry run: would drain %s at %s", s.Name, s.URL)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			if err := s.drain(); err != nil {
+				log.Printf("draining %s before %s failed: %v", s.Name, action, err)
+				return
+			}
+			log.Printf("drained %s in %s", s.Name, time.Since(start).Round(time.Millisecond))
+		}()
+	}
+	wg.Wait()
+}
+
+// drain POSTs to the service and waits for its acknowledgement
+func (s drainService) drain() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, nil)
+	if err != nil {
+		return err
+	}
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+	if err := signer.Sign(req); err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/oksmith/home-server/pkg/notify"
+)
+
+// Kinds of power event sent to the notification hub
+const (
+	eventScheduled    = "scheduled"    // an action will run later
+	eventExecuted     = "executed"     // an action is running now
+	eventCancelled    = "cancelled"    // a pending action was called off
+	eventUnauthorized = "unauthorized" // a request had a bad token
+)
+
+// event is one thing worth telling people about
+type event struct {
+	Kind    string
+	Action  string
+	Message string
+	Reason  string // why the action was asked for
+}
+
+// text is the event's message, followed by its reason if it has one
+func (e event) text() string {
+	if e.Reason != "" {
+		return e.Message + "\nReason: " + e.Reason
+	}
+	return e.Message
+}
+
+// message turns the event into a notification. Actions running now and
+// rejected requests are high priority.
+func (e event) message() notify.Message {
+	m := notify.Message{Event: e.Kind, Title: e.Kind, Text: e.text()}
+	if e.Action != "" {
+		m.Title = e.Action + " " + e.Kind
+		m.Fields = map[string]string{"action": e.Action}
+		if e.Reason != "" {
+			m.Fields["reason"] = e.Reason
+		}
+	}
+	if e.Kind == eventExecuted || e.Kind == eventUnauthorized {
+		m.Priority = notify.High
+	}
+	return m
+}
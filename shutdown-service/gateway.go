@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/oksmith/home-server/pkg/registry"
+)
+
+// gatewayRenew is how often the registration with the gateway is renewed,
+// well within its lifetime
+const gatewayRenew = registry.DefaultTTL / 3
+
+// announceToGateway registers this service with the gateway at GATEWAY_URL
+// until ctx is done, returning a channel closed once it has withdrawn, or nil
+// if there's no gateway. The gateway reaches it at GATEWAY_SERVICE_URL using
+// SHUTDOWN_TOKEN, and is told when that changes, or with its own signature
+// if it is trusted in AUTHORIZED_KEYS.
+func announceToGateway(ctx context.Context, https bool) (<-chan struct{}, error) {
+	gateway := cfg.Get("GATEWAY_URL")
+	if gateway == "" {
+		return nil, nil
+	}
+	token := cfg.Get("SHUTDOWN_TOKEN")
+	if token == "" && cfg.Get("AUTHORIZED_KEYS") == "" {
+		return nil, errors.New("SHUTDOWN_TOKEN or AUTHORIZED_KEYS must be set for the gateway to use")
+	}
+	name := cfg.Get("GATEWAY_NAME")
+	if name == "" {
+		name = "power"
+	}
+	s, err := registry.Local(name, cfg.Get("GATEWAY_SERVICE_URL"), cfg.Get("LISTEN_ADDR"), https)
+	if err != nil {
+		return nil, err
+	}
+	s.Token = token
+
+	done := make(chan struct{})
+	go func() {
+		registry.Announce(ctx, gateway, cfg.Get("GATEWAY_REGISTRY_TOKEN"), signer, func() registry.Service {
+			// Keep the last token if SHUTDOWN_TOKEN is taken away
+			if token := cfg.Get("SHUTDOWN_TOKEN"); token != "" {
+				s.Token = token
+			}
+			return s
+		}, gatewayRenew)
+		close(done)
+	}()
+	return done, nil
+}
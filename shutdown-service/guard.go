@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/oksmith/home-server/pkg/httpserver"
+)
+
+// newGuard rate limits each client IP and locks out those that keep sending
+// bad tokens, noting turned-away requests in the audit log
+func newGuard() *httpserver.Guard {
+	g := httpserver.NewGuard(httpserver.DefaultLimits)
+	g.Key = clientIP
+	g.Limited = func(w http.ResponseWriter, r *http.Request) { noteAuth(w, "limited") }
+	return g
+}
+
+// clientIP returns the address a request came from, without its port, or
+// "local" for the local socket
+func clientIP(r *http.Request) string {
+	if _, ok := localPeer(r); ok {
+		return "local"
+	}
+	return httpserver.ClientIP(r)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/oksmith/home-server/pkg/httpserver"
+)
+
+func TestGuardLockout(t *testing.T) {
+	tokens, _ := loadTokens("")
+	tokens.addDefault("secret")
+	audit, err := openAuditLog(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { audit.file.Close() }()
+	g := newGuard()
+	h := audit.middleware(g.Middleware(requireToken(tokens, nil, "", g, nil, func(w http.ResponseWriter, r *http.Request) {})))
+
+	send := func(addr, token string) int {
+		r := httptest.NewRequest("GET", "/status", nil)
+		r.RemoteAddr = addr
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// Requests without a token don't count towards a lockout
+	for range httpserver.DefaultLimits.LockoutAfter {
+		send("192.0.2.1:1000", "")
+	}
+	if code := send("192.0.2.1:1000", "secret"); code != http.StatusOK {
+		t.Fatalf("expected the right token let through, got %d", code)
+	}
+
+	for range httpserver.DefaultLimits.LockoutAfter {
+		if code := send("192.0.2.1:1000", "wrong"); code != http.StatusUnauthorized {
+			t.Fatalf("wrong token: got %d", code)
+		}
+	}
+	if code := send("192.0.2.1:2000", "secret"); code != http.StatusTooManyRequests {
+		t.Errorf("expected the client locked out from any port, even with the right token, got %d", code)
+	}
+	if code := send("192.0.2.2:1000", "secret"); code != http.StatusOK {
+		t.Errorf("expected another client unaffected, got %d", code)
+	}
+
+	entries, err := audit.recent(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var limited auditEntry
+	if err := json.Unmarshal(entries[0], &limited); err != nil {
+		t.Fatal(err)
+	}
+	if limited.Auth != "limited" || limited.Source != "192.0.2.1" || limited.Status != http.StatusTooManyRequests {
+		t.Errorf("expected the locked out request audited as limited, got %+v", limited)
+	}
+}
+
+func TestGuardLocalClients(t *testing.T) {
+	r := httptest.NewRequest("GET", "/status", nil)
+	if got := clientIP(r); got != "192.0.2.1" {
+		t.Errorf("expected the remote address, got %q", got)
+	}
+	local := r.WithContext(context.WithValue(r.Context(), localPeerKey{}, "local:alice"))
+	if got := clientIP(local); got != "local" {
+		t.Errorf("expected requests over the local socket to share one key, got %q", got)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/oksmith/home-server/pkg/httpserver"
+)
+
+// readyCacheFor is how long readiness results are reused, so frequent probes
+// don't run sudo every time
+const readyCacheFor = 30 * time.Second
+
+// commandCheck is whether one action's command could run
+type commandCheck struct {
+	Action  string `json:"action"`
+	Command string `json:"command"`
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+}
+
+// readiness checks every configured power command, remembering the results
+// for a while
+type readiness struct {
+	commands map[string]powerCommand
+
+	mu      sync.Mutex
+	checked time.Time
+	results []commandCheck
+}
+
+// check returns each command's result, checking again if fresh is set or the
+// last results are stale
+func (r *readiness) check(fresh bool) []commandCheck {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !fresh && time.Since(r.checked) < readyCacheFor {
+		return r.results
+	}
+
+	results := make([]commandCheck, 0, len(r.commands))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, command := range r.commands {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := commandCheck{Action: name, Command: command.String(), OK: true}
+			if err := command.Check(); err != nil {
+				c.OK, c.Error = false, err.Error()
+			}
+			mu.Lock()
+			results = append(results, c)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	sort.Slice(results, func(i, j int) bool { return results[i].Action < results[j].Action })
+
+	r.checked, r.results = time.Now(), results
+	return results
+}
+
+// logProblems logs every command that can't run, so misconfiguration shows
+// up at startup rather than when the command is needed
+func (r *readiness) logProblems() {
+	for _, c := range r.check(true) {
+		if !c.OK {
+			log.Printf("warning: /%s won't work: %s", c.Action, c.Error)
+		}
+	}
+}
+
+// healthzHandler answers GET /healthz while the service is running
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+// readyzHandler answers GET /readyz with 200 if every configured power
+// command could run, and 503 listing the problems if not
+func readyzHandler(ready *readiness) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		checks := ready.check(false)
+		code := http.StatusOK
+		for _, c := range checks {
+			if !c.OK {
+				code = http.StatusServiceUnavailable
+			}
+		}
+		httpserver.WriteJSON(w, code, struct {
+			Ready  bool           `json:"ready"`
+			Checks []commandCheck `json:"checks"`
+		}{code == http.StatusOK, checks})
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oksmith/home-server/pkg/mqtt"
+)
+
+// statusInterval is how often the machine's status is published over MQTT
+const statusInterval = 30 * time.Second
+
+// Payloads on the MQTT topics, in Home Assistant's defaults
+const (
+	payloadOnline  = "online"
+	payloadOffline = "offline"
+	payloadOn      = "ON"
+	payloadOff     = "OFF"
+	payloadPress   = "PRESS"
+)
+
+// homeAssistant shows this machine in Home Assistant through an MQTT broker:
+// a power switch that shuts it down, a button for each other action and
+// sensors for its status, announced with discovery messages
+type homeAssistant struct {
+	opts      mqtt.Options
+	prefix    string // topic prefix, e.g. homeserver
+	discovery string // Home Assistant's discovery prefix, "" for none
+	nodeID    string
+	actions   []string // supported actions
+	run       runFunc
+	status    func() serviceStatus
+
+	mu     sync.Mutex
+	client *mqtt.Client // nil while disconnected
+}
+
+// newHomeAssistant reads MQTT_URL and friends, returning nil if unset
+func newHomeAssistant(run runFunc, actions []string, status func() serviceStatus) (*homeAssistant, error) {
+	raw := cfg.Get("MQTT_URL")
+	if raw == "" {
+		return nil, nil
+	}
+	opts, err := mqtt.ParseURL(raw)
+	if err != nil {
+		return nil, fmt.Errorf("MQTT_URL: %w", err)
+	}
+
+	hostname, _ := os.Hostname()
+	h := &homeAssistant{
+		prefix:  "homeserver",
+		nodeID:  regexp.MustCompile(`[^a-zA-Z0-9_-]+`).ReplaceAllString(hostname, "_"),
+		actions: actions,
+		run:     run,
+		status:  status,
+		opts:    opts,
+	}
+	if s := cfg.Get("MQTT_TOPIC"); s != "" {
+		h.prefix = strings.Trim(s, "/")
+	}
+	h.discovery = strings.Trim(cfg.Get("MQTT_DISCOVERY_PREFIX"), "/")
+	if s := cfg.Get("MQTT_NODE_ID"); s != "" {
+		h.nodeID = s
+	}
+
+	h.opts.ClientID = "shutdown-service-" + h.nodeID
+	h.opts.Will = &mqtt.Message{Topic: h.topic("availability"), Payload: []byte(payloadOffline), Retain: true}
+	h.opts.OnMessage = h.command
+	return h, nil
+}
+
+func (h *homeAssistant) topic(name string) string {
+	return h.prefix + "/" + name
+}
+
+// watch stays connected to the broker, reconnecting with backoff
+func (h *homeAssistant) watch() {
+	backoff := 5 * time.Second
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		client, err := mqtt.Dial(ctx, h.opts)
+		if err == nil {
+			err = h.announce(ctx, client)
+			if err != nil {
+				client.Close()
+			}
+		}
+		cancel()
+		if err != nil {
+			log.Printf("mqtt: %s: %v; retrying in %s", h.opts.Addr, err, backoff)
+			time.Sleep(backoff)
+			backoff = min(2*backoff, 5*time.Minute)
+			continue
+		}
+
+		log.Printf("mqtt: connected to %s, publishing to %s/", h.opts.Addr, h.prefix)
+		backoff = 5 * time.Second
+		h.mu.Lock()
+		h.client = client
+		h.mu.Unlock()
+
+		h.publishStatus(client)
+		ticker := time.NewTicker(statusInterval)
+	connected:
+		for {
+			select {
+			case <-ticker.C:
+				h.publishStatus(client)
+			case <-client.Done():
+				break connected
+			}
+		}
+		ticker.Stop()
+
+		h.mu.Lock()
+		h.client = nil
+		h.mu.Unlock()
+		log.Printf("mqtt: lost connection to %s: %v", h.opts.Addr, client.Err())
+	}
+}
+
+// announce publishes the discovery messages and subscribes to the command topics
+func (h *homeAssistant) announce(ctx context.Context, client *mqtt.Client) error {
+	if h.discovery != "" {
+		for _, c := range h.entities() {
+			data, err := json.Marshal(c.config)
+			if err != nil {
+				return err
+			}
+			topic := fmt.Sprintf("%s/%s/%s/%s/config", h.discovery, c.component, h.nodeID, c.id)
+			if err := client.Publish(topic, data, true); err != nil {
+				return err
+			}
+		}
+	}
+	filters := []string{h.topic("power/set")}
+	for _, a := range h.actions {
+		filters = append(filters, h.topic(a+"/set"))
+	}
+	return client.Subscribe(ctx, filters...)
+}
+
+// entity is one Home Assistant entity's discovery message
+type entity struct {
+	component string // switch, button or sensor
+	id        string
+	config    map[string]any
+}
+
+// entities lists what the machine shows up as in Home Assistant
+func (h *homeAssistant) entities() []entity {
+	hostname, _ := os.Hostname()
+	common := func(id, name string) map[string]any {
+		return map[string]any{
+			"name":               name,
+			"unique_id":          h.nodeID + "_" + id,
+			"availability_topic": h.topic("availability"),
+			"device": map[string]any{
+				"identifiers":  []string{"shutdown-service_" + h.nodeID},
+				"name":         hostname,
+				"manufacturer": "home-server",
+				"model":        "shutdown-service",
+			},
+		}
+	}
+
+	var list []entity
+	for _, a := range h.actions {
+		if a == "shutdown" {
+			c := common("power", "Power")
+			c["command_topic"] = h.topic("power/set")
+			c["state_topic"] = h.topic("power/state")
+			c["icon"] = "mdi:server"
+			list = append(list, entity{"switch", "power", c})
+			continue
+		}
+		c := common(a, strings.ToUpper(a[:1])+a[1:])
+		c["command_topic"] = h.topic(a + "/set")
+		c["payload_press"] = payloadPress
+		if a == "reboot" {
+			c["device_class"] = "restart"
+		}
+		list = append(list, entity{"button", a, c})
+	}
+
+	sensors := []struct {
+		id, name, template string
+		extra              map[string]any
+	}{
+		{"pending", "Pending action", "{{ value_json.pending.action if value_json.pending else 'none' }}", nil},
+		{"pending_at", "Pending action at", "{{ value_json.pending.at if value_json.pending else None }}",
+			map[string]any{"device_class": "timestamp"}},
+		{"load", "Load", "{{ value_json.system.load[0] }}",
+			map[string]any{"state_class": "measurement"}},
+		{"memory", "Memory used", "{{ value_json.system.memory.used_percent }}",
+			map[string]any{"unit_of_measurement": "%", "state_class": "measurement"}},
+		{"uptime", "Uptime", "{{ value_json.system.uptime_seconds | int }}",
+			map[string]any{"device_class": "duration", "unit_of_measurement": "s"}},
+	}
+	for _, s := range sensors {
+		c := common(s.id, s.name)
+		c["state_topic"] = h.topic("status")
+		c["value_template"] = s.template
+		for k, v := range s.extra {
+			c[k] = v
+		}
+		list = append(list, entity{"sensor", s.id, c})
+	}
+	return list
+}
+
+// publishStatus says the machine is up and publishes its status
+func (h *homeAssistant) publishStatus(client *mqtt.Client) {
+	data, err := json.Marshal(h.status())
+	if err != nil {
+		log.Printf("mqtt: %v", err)
+		return
+	}
+	client.Publish(h.topic("availability"), []byte(payloadOnline), true)
+	client.Publish(h.topic("power/state"), []byte(payloadOn), true)
+	client.Publish(h.topic("status"), data, true)
+}
+
+// command runs an action asked for on a command topic. It is called by the
+// MQTT reader, so the action runs separately.
+func (h *homeAssistant) command(m mqtt.Message) {
+	name, ok := strings.CutSuffix(strings.TrimPrefix(m.Topic, h.prefix+"/"), "/set")
+	payload := strings.TrimSpace(string(m.Payload))
+	switch {
+	case !ok:
+		return
+	case name == "power" && payload == payloadOn:
+		return // already on
+	case name == "power" && payload == payloadOff:
+		name = "shutdown"
+	case name != "power" && payload == payloadPress:
+	default:
+		log.Printf("mqtt: ignoring %q on %s", payload, m.Topic)
+		return
+	}
+
+	log.Printf("mqtt: %s requested on %s", name, m.Topic)
+	go func() {
+		if err := h.run(name, false, "requested from Home Assistant"); err != nil {
+			log.Printf("mqtt: %s failed: %v", name, err)
+		}
+	}()
+}
+
+// poweringOff tells Home Assistant the machine is going away, just before an
+// action runs. If the action fails, the next status update brings it back.
+func (h *homeAssistant) poweringOff() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	client := h.client
+	h.mu.Unlock()
+	if client == nil {
+		return
+	}
+	client.Publish(h.topic("power/state"), []byte(payloadOff), true)
+	client.Publish(h.topic("availability"), []byte(payloadOffline), true)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oksmith/home-server/pkg/httpserver"
+	"github.com/oksmith/home-server/pkg/wol"
+)
+
+// hostTimeout bounds each request proxied to another host's agent
+const hostTimeout = 10 * time.Second
+
+// maxProxyBody caps a request body passed on to another host
+const maxProxyBody = 64 << 10
+
+// host is another machine running shutdown-service, controlled through this one
+type host struct {
+	Name  string `json:"name"`
+	URL   string `json:"url"`           // e.g. http://nas.lan:8080
+	Token string `json:"token"`         // that agent's SHUTDOWN_TOKEN
+	MAC   string `json:"mac,omitempty"` // for /hosts/NAME/wake, sent from this machine
+}
+
+// hostStatus is one entry of GET /hosts
+type hostStatus struct {
+	Name      string          `json:"name"`
+	URL       string          `json:"url"`
+	Reachable bool            `json:"reachable"`
+	Status    json.RawMessage `json:"status,omitempty"` // the agent's GET /status
+	Error     string          `json:"error,omitempty"`
+}
+
+// loadHosts reads the hosts file, a JSON array of {name, url, token, mac}
+func loadHosts(filename string) (map[string]host, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var list []host
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("invalid hosts file %s: %w", filename, err)
+	}
+
+	hosts := make(map[string]host, len(list))
+	for _, h := range list {
+		switch {
+		case h.Name == "" || strings.Contains(h.Name, "/"):
+			return nil, fmt.Errorf("host %q needs a name without slashes", h.Name)
+		case !strings.HasPrefix(h.URL, "http://") && !strings.HasPrefix(h.URL, "https://"):
+			return nil, fmt.Errorf("host %s: url must start with http:// or https://", h.Name)
+		}
+		if h.MAC != "" {
+			if _, err := net.ParseMAC(h.MAC); err != nil {
+				return nil, fmt.Errorf("host %s: %w", h.Name, err)
+			}
+		}
+		if _, dup := hosts[h.Name]; dup {
+			return nil, fmt.Errorf("host %s is listed twice", h.Name)
+		}
+		h.URL = strings.TrimRight(h.URL, "/")
+		hosts[h.Name] = h
+	}
+	return hosts, nil
+}
+
+// hostsHandler reports every host's status, asking them all at once
+func hostsHandler(hosts map[string]host) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+
+		statuses := make([]hostStatus, 0, len(hosts))
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for _, h := range hosts {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				st := hostStatus{Name: h.Name, URL: h.URL}
+				resp, err := proxyRequest(r.Context(), h, http.MethodGet, "/status", "", nil)
+				if err == nil {
+					body, _ := io.ReadAll(io.LimitReader(resp.Body, maxProxyBody))
+					resp.Body.Close()
+					if resp.StatusCode == http.StatusOK && json.Valid(body) {
+						st.Reachable, st.Status = true, body
+					} else {
+						err = fmt.Errorf("agent returned %s", resp.Status)
+					}
+				}
+				if err != nil {
+					st.Error = err.Error()
+				}
+				mu.Lock()
+				statuses = append(statuses, st)
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+
+		sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+		httpserver.WriteJSON(w, http.StatusOK, statuses)
+	}
+}
+
+// hostHandler serves /hosts/{name}/..., waking a host from here and passing
+// everything else on to its agent
+func hostHandler(hosts map[string]host, broadcast string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h, ok := hosts[r.PathValue("name")]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown host %q", r.PathValue("name")), http.StatusNotFound)
+			return
+		}
+		path := "/" + r.PathValue("path")
+
+		// A sleeping host can't answer, so it is woken from this machine
+		if path == "/wake" {
+			if !allowMethod(w, r, http.MethodPost) {
+				return
+			}
+			if h.MAC == "" {
+				http.Error(w, fmt.Sprintf("host %s has no mac configured", h.Name), http.StatusNotFound)
+				return
+			}
+			if err := wol.Send(h.MAC, broadcast); err != nil {
+				log.Printf("wake %s failed: %v", h.Name, err)
+				http.Error(w, "wake failed", http.StatusInternalServerError)
+				return
+			}
+			log.Printf("sent magic packet to host %s (%s)", h.Name, h.MAC)
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("Waking " + h.Name + "..."))
+			return
+		}
+
+		// Bodies are small JSON, so buffer them to send a Content-Length
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxProxyBody))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp, err := proxyRequest(r.Context(), h, r.Method, path, r.URL.RawQuery, body)
+		if err != nil {
+			log.Printf("proxying %s %s to host %s failed: %v", r.Method, path, h.Name, err)
+			http.Error(w, fmt.Sprintf("host %s is unreachable", h.Name), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+
+		if ct := resp.Header.Get("Content-Type"); ct != "" {
+			w.Header().Set("Content-Type", ct)
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}
+}
+
+// proxyRequest sends a request to a host's agent with that agent's token, if
+// it has one, signed with SERVICE_KEY if it is set
+func proxyRequest(ctx context.Context, h host, method, path, query string, body []byte) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, hostTimeout)
+	target := h.URL + path
+	if query != "" {
+		target += "?" + query
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if h.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.Token)
+	}
+	if len(body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if err := signer.Sign(req); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = cancelOnClose{resp.Body, cancel}
+	return resp, nil
+}
+
+// cancelOnClose releases a request's context once its response is read
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// triggerPoll is how often the trigger file is looked for
+const triggerPoll = 2 * time.Second
+
+// maxTrigger caps how much of a trigger file is read
+const maxTrigger = 1024
+
+// localPeerKey holds who is on the other end of a local socket connection
+type localPeerKey struct{}
+
+// localPeer describes the process that sent a request over the local socket,
+// reporting whether it came that way
+func localPeer(r *http.Request) (string, bool) {
+	peer, ok := r.Context().Value(localPeerKey{}).(string)
+	return peer, ok
+}
+
+// serveLocal serves handler on a unix socket at path, without tokens: who may
+// connect is up to the socket's mode, e.g. 0660 for the service's group
+func serveLocal(path string, mode os.FileMode, handler http.Handler) error {
+	// A socket left behind by an earlier run would stop us listening
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return fmt.Errorf("%s exists and isn't a socket", path)
+		}
+		os.Remove(path)
+	}
+	ln, err := listenLocal(path, mode)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Handler: handler,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, localPeerKey{}, "local:"+peerName(c))
+		},
+	}
+	go func() {
+		log.Fatal(server.Serve(ln))
+	}()
+	return nil
+}
+
+// listenLocal listens on a unix socket at path with the given mode. The
+// socket is created in a directory only we can enter and given its mode
+// there, then moved into place, so nobody can connect while it has the
+// umask's mode instead.
+func listenLocal(path string, mode os.FileMode) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".socket-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	private := filepath.Join(dir, filepath.Base(path))
+	ln, err := net.Listen("unix", private)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(private, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	if err := os.Rename(private, path); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// trigger is a request read from the trigger file
+type trigger struct {
+	action string // or "cancel"
+	delay  time.Duration
+	reason string
+}
+
+// parseTrigger reads "ACTION [+DELAY] [REASON...]", such as
+// "shutdown +10m backup finished"; an empty file means shutdown
+func parseTrigger(content string) (trigger, error) {
+	fields := strings.Fields(content)
+	t := trigger{action: "shutdown"}
+	if len(fields) > 0 {
+		t.action, fields = fields[0], fields[1:]
+	}
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "+") {
+		d, err := time.ParseDuration(fields[0][1:])
+		if err != nil || d < 0 {
+			return t, fmt.Errorf("bad delay %q", fields[0])
+		}
+		t.delay, fields = d, fields[1:]
+	}
+	reason, ok := cleanReason(strings.Join(fields, " "))
+	if !ok {
+		return t, fmt.Errorf("reason must be at most %d characters", maxReason)
+	}
+	t.reason = reason
+	return t, nil
+}
+
+// triggerWatcher carries out requests written to a file by local scripts,
+// removing the file as it reads it
+type triggerWatcher struct {
+	path          string
+	run           runFunc
+	sched         *scheduler
+	supported     []string
+	requireReason bool
+}
+
+// watch polls for the trigger file. One left from before the service started
+// is removed without acting on it, so a stale trigger can't power the
+// machine off again as soon as it boots.
+func (t *triggerWatcher) watch() {
+	if content, err := t.take(); err == nil {
+		log.Printf("trigger: ignoring %q left in %s from before startup", content, t.path)
+	}
+	for range time.Tick(triggerPoll) {
+		content, err := t.take()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			log.Printf("trigger: %v", err)
+			continue
+		}
+		if err := t.handle(content); err != nil {
+			log.Printf("trigger: %q: %v", content, err)
+		}
+	}
+}
+
+// take reads and removes the trigger file, which must be a regular file. It
+// is removed first so a failure can't make it fire over and over. The file
+// is opened without following a symlink and checked once open, so it can't
+// be swapped for something else in between.
+func (t *triggerWatcher) take() (string, error) {
+	f, err := os.OpenFile(t.path, os.O_RDONLY|triggerOpenFlags, 0)
+	if err != nil {
+		if info, lerr := os.Lstat(t.path); lerr == nil && !info.Mode().IsRegular() {
+			os.Remove(t.path)
+			return "", fmt.Errorf("removed %s, which isn't a regular file", t.path)
+		}
+		return "", err
+	}
+	defer f.Close()
+	if err := os.Remove(t.path); err != nil {
+		return "", err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("removed %s, which isn't a regular file", t.path)
+	}
+	data, err := io.ReadAll(io.LimitReader(f, maxTrigger))
+	return strings.TrimSpace(string(data)), err
+}
+
+// handle carries out one trigger
+func (t *triggerWatcher) handle(content string) error {
+	req, err := parseTrigger(content)
+	if err != nil {
+		return err
+	}
+	if req.action == "cancel" {
+		if p := t.sched.current(); p != nil && t.sched.cancelPending(*p) {
+			return nil
+		}
+		return errors.New("nothing is pending")
+	}
+	if !isAction(req.action) {
+		return fmt.Errorf("unknown action %q", req.action)
+	}
+	if !slices.Contains(t.supported, req.action) {
+		return errUnsupported
+	}
+	if req.reason == "" && t.requireReason {
+		return errors.New("a reason is required")
+	}
+	if req.reason == "" {
+		req.reason = "requested by a local trigger"
+	}
+
+	if req.delay > 0 {
+		t.sched.schedule(req.action, time.Now().Add(req.delay), "", nil, false, req.reason)
+		return nil
+	}
+	log.Printf("trigger: running %s", req.action)
+	go func() {
+		if err := t.run(req.action, false, req.reason); err != nil {
+			log.Printf("trigger: %s failed: %v", req.action, err)
+		}
+	}()
+	return nil
+}
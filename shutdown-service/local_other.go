@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "net"
+
+// peerName can't tell who is on the other end of a unix socket here
+func peerName(c net.Conn) string {
+	return "unknown"
+}
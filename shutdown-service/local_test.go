@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTrigger(t *testing.T) {
+	tests := []struct {
+		content string
+		want    trigger
+	}{
+		{"", trigger{action: "shutdown"}},
+		{"reboot", trigger{action: "reboot"}},
+		{"shutdown +10m backup finished", trigger{action: "shutdown", delay: 10 * time.Minute, reason: "backup finished"}},
+		{"suspend nightly", trigger{action: "suspend", reason: "nightly"}},
+		{"cancel", trigger{action: "cancel"}},
+	}
+	for _, tt := range tests {
+		got, err := parseTrigger(tt.content)
+		if err != nil {
+			t.Errorf("%q: %v", tt.content, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.content, got, tt.want)
+		}
+	}
+
+	for _, content := range []string{"shutdown +soon", "shutdown +-5m", "shutdown " + strings.Repeat("x", maxReason+1)} {
+		if _, err := parseTrigger(content); err == nil {
+			t.Errorf("%q: expected an error", content)
+		}
+	}
+}
+
+func TestHandleTrigger(t *testing.T) {
+	ran := make(chan string, 1)
+	run := func(name string, dryRun bool, reason string) error {
+		ran <- name + ": " + reason
+		return nil
+	}
+	sched := &scheduler{run: run}
+	w := &triggerWatcher{run: run, sched: sched, supported: []string{"shutdown", "reboot"}}
+
+	if err := w.handle("reboot"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-ran:
+		if got != "reboot: requested by a local trigger" {
+			t.Errorf("ran %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the trigger never ran")
+	}
+
+	if err := w.handle("shutdown +1h updates"); err != nil {
+		t.Fatal(err)
+	}
+	if p := sched.current(); p == nil || p.Action != "shutdown" || p.Reason != "updates" {
+		t.Errorf("expected shutdown scheduled, got %+v", p)
+	}
+	if err := w.handle("cancel"); err != nil || sched.current() != nil {
+		t.Errorf("expected cancel to drop the pending shutdown: %v", err)
+	}
+	if err := w.handle("cancel"); err == nil {
+		t.Error("expected cancel with nothing pending to fail")
+	}
+
+	for _, content := range []string{"explode", "suspend", "shutdown +soon"} {
+		if err := w.handle(content); err == nil {
+			t.Errorf("%q: expected an error", content)
+		}
+	}
+	w.requireReason = true
+	if err := w.handle("shutdown"); err == nil {
+		t.Error("expected a trigger without a reason to be refused")
+	}
+	select {
+	case got := <-ran:
+		t.Errorf("ran %q for a refused trigger", got)
+	default:
+	}
+}
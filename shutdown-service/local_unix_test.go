@@ -0,0 +1,81 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestListenLocal(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "shutdown.sock")
+	ln, err := listenLocal(path, 0660)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Type() != fs.ModeSocket || info.Mode().Perm() != 0660 {
+		t.Errorf("expected a socket with mode 0660, got %v", info.Mode())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("expected only the socket left in %s, got %d entries", dir, len(entries))
+	}
+}
+
+func TestTakeTrigger(t *testing.T) {
+	dir := t.TempDir()
+	w := &triggerWatcher{path: filepath.Join(dir, "trigger")}
+
+	if _, err := w.take(); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected no trigger, got %v", err)
+	}
+
+	if err := os.WriteFile(w.path, []byte("reboot +5m updates\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := w.take(); err != nil || content != "reboot +5m updates" {
+		t.Errorf("got %q, %v", content, err)
+	}
+	if _, err := os.Lstat(w.path); !errors.Is(err, fs.ErrNotExist) {
+		t.Error("expected the trigger file removed")
+	}
+
+	// A symlink isn't followed, and is removed
+	target := filepath.Join(dir, "target")
+	if err := os.WriteFile(target, []byte("shutdown"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, w.path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.take(); err == nil {
+		t.Error("expected a symlink to be refused")
+	}
+	if _, err := os.Lstat(w.path); !errors.Is(err, fs.ErrNotExist) {
+		t.Error("expected the symlink removed")
+	}
+	if _, err := os.Stat(target); err != nil {
+		t.Errorf("expected the symlink's target left alone: %v", err)
+	}
+
+	// Nor is a FIFO waited on
+	if err := syscall.Mkfifo(w.path, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.take(); err == nil {
+		t.Error("expected a FIFO to be refused")
+	}
+	if _, err := os.Lstat(w.path); !errors.Is(err, fs.ErrNotExist) {
+		t.Error("expected the FIFO removed")
+	}
+}
@@ -0,0 +1,542 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oksmith/home-server/pkg/httpserver"
+)
+
+// policyInterval is how often the idle policy samples the machine
+const policyInterval = time.Minute
+
+// sshPort is the port whose established connections count as SSH sessions
+const sshPort = 22
+
+// activity is one sample of how busy the machine is
+type activity struct {
+	Load        float64 `json:"load"`         // 1 minute load average
+	SSHSessions int     `json:"ssh_sessions"` // established connections to port 22
+	NetKBps     float64 `json:"net_kbps"`     // received plus sent, excluding loopback
+	CPUPercent  float64 `json:"cpu_percent"`  // only known from metrics-service
+}
+
+// hostMetrics is the part of metrics-service's GET /api/v1/metrics the
+// policy uses
+type hostMetrics struct {
+	CPU struct {
+		UsagePercent float64    `json:"usage_percent"`
+		Load         [3]float64 `json:"load"`
+	} `json:"cpu"`
+	Network struct {
+		ReceiveBytesPerSec  float64 `json:"receive_bytes_per_sec"`
+		TransmitBytesPerSec float64 `json:"transmit_bytes_per_sec"`
+	} `json:"network"`
+}
+
+// metricsClient fetches samples from metrics-service
+var metricsClient = &http.Client{Timeout: 10 * time.Second}
+
+// fetchHostMetrics reads the latest sample from the metrics-service at base
+func fetchHostMetrics(base, token string) (hostMetrics, error) {
+	var m hostMetrics
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(base, "/")+"/api/v1/metrics", nil)
+	if err != nil {
+		return m, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if err := signer.Sign(req); err != nil {
+		return m, err
+	}
+	resp, err := metricsClient.Do(req)
+	if err != nil {
+		return m, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return m, fmt.Errorf("metrics-service answered %s", resp.Status)
+	}
+	return m, json.NewDecoder(resp.Body).Decode(&m)
+}
+
+// awakeWindow is a time of day, on some days of the week, when the machine
+// stays on however idle it is
+type awakeWindow struct {
+	text       string
+	days       [7]bool
+	start, end int // minutes after midnight; end < start spans midnight
+}
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// parseAwakeWindows reads KEEP_AWAKE, a comma-separated list of windows such
+// as "08:00-18:00", "mon-fri 07:30-09:00" or "sat,sun 22:00-02:00"
+func parseAwakeWindows(s string) ([]awakeWindow, error) {
+	var windows []awakeWindow
+	var days string
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		// A bare day such as "sat" in "sat,sun 22:00-02:00" joins the next window
+		if !strings.Contains(part, ":") {
+			days += part + ","
+			continue
+		}
+		fields := strings.Fields(part)
+		if len(fields) == 2 {
+			days += fields[0]
+			fields = fields[1:]
+		}
+		if len(fields) != 1 {
+			return nil, fmt.Errorf("keep-awake window %q should look like mon-fri 08:00-18:00", part)
+		}
+		days = strings.TrimSuffix(days, ",")
+		w := awakeWindow{text: strings.TrimSpace(days + " " + fields[0])}
+		if err := parseWeekdays(days, &w.days); err != nil {
+			return nil, fmt.Errorf("keep-awake window %q: %w", part, err)
+		}
+		days = ""
+
+		from, to, ok := strings.Cut(fields[0], "-")
+		var err error
+		if !ok {
+			return nil, fmt.Errorf("keep-awake window %q needs a start-end time", part)
+		}
+		if w.start, err = parseClock(from); err == nil {
+			w.end, err = parseClock(to)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("keep-awake window %q: %w", part, err)
+		}
+		windows = append(windows, w)
+	}
+	if days != "" {
+		return nil, fmt.Errorf("keep-awake days %q have no times", strings.TrimSuffix(days, ","))
+	}
+	return windows, nil
+}
+
+// parseWeekdays marks the days in a list of names and ranges, or every day if empty
+func parseWeekdays(s string, days *[7]bool) error {
+	if s == "" {
+		for i := range days {
+			days[i] = true
+		}
+		return nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(strings.ToLower(part), "-")
+		if !isRange {
+			to = from
+		}
+		lo, hi := weekday(from), weekday(to)
+		if lo < 0 || hi < 0 {
+			return fmt.Errorf("unknown day in %q", part)
+		}
+		for d := lo; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == hi {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func weekday(name string) int {
+	for i, d := range weekdays {
+		if name == d {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseClock reads HH:MM as minutes after midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("bad time %q, want HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// contains reports whether t falls in the window. A window spanning midnight
+// belongs to the day it starts on.
+func (w awakeWindow) contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	day := int(t.Weekday())
+	if w.start <= w.end {
+		return w.days[day] && m >= w.start && m < w.end
+	}
+	return (w.days[day] && m >= w.start) || (w.days[(day+6)%7] && m < w.end)
+}
+
+// policy powers the machine down once it has been idle for long enough
+type policy struct {
+	action  string
+	maxLoad float64
+	maxNet  float64 // kB/s
+	maxCPU  float64 // percent, 0 to ignore
+	windows []awakeWindow
+	run     runFunc
+	// sampler takes a sample, p.sample unless a test replaces it
+	sampler func(now time.Time) (activity, error)
+
+	// metricsURL, if set, is a metrics-service to read load, CPU and
+	// network from
+	metricsURL   string
+	metricsToken string
+
+	mu             sync.Mutex
+	enabled        bool
+	idleAfter      time.Duration
+	keepAwakeUntil time.Time
+	last           activity
+	idleSince      time.Time
+	reason         string // why the machine isn't idle, if it isn't
+	checked        time.Time
+	netBytes       uint64
+	netAt          time.Time
+}
+
+// newPolicy reads the idle policy from the environment, returning nil unless
+// IDLE_SHUTDOWN_AFTER is set
+func newPolicy(run runFunc) (*policy, error) {
+	after := cfg.Get("IDLE_SHUTDOWN_AFTER")
+	if after == "" {
+		return nil, nil
+	}
+	p := &policy{action: "shutdown", maxLoad: 0.5, maxNet: 100, run: run, enabled: true}
+	p.sampler = p.sample
+	var err error
+	if p.idleAfter, err = time.ParseDuration(after); err != nil || p.idleAfter <= 0 {
+		return nil, fmt.Errorf("IDLE_SHUTDOWN_AFTER must be a positive duration such as 30m, not %q", after)
+	}
+	if a := cfg.Get("IDLE_ACTION"); a != "" {
+		if !isAction(a) {
+			return nil, fmt.Errorf("IDLE_ACTION: unknown action %q", a)
+		}
+		p.action = a
+	}
+	if s := cfg.Get("IDLE_MAX_LOAD"); s != "" {
+		if p.maxLoad, err = strconv.ParseFloat(s, 64); err != nil {
+			return nil, fmt.Errorf("IDLE_MAX_LOAD: %w", err)
+		}
+	}
+	if s := cfg.Get("IDLE_MAX_NET_KBPS"); s != "" {
+		if p.maxNet, err = strconv.ParseFloat(s, 64); err != nil {
+			return nil, fmt.Errorf("IDLE_MAX_NET_KBPS: %w", err)
+		}
+	}
+	p.metricsURL, p.metricsToken = cfg.Get("IDLE_METRICS_URL"), cfg.Get("IDLE_METRICS_TOKEN")
+	if s := cfg.Get("IDLE_MAX_CPU"); s != "" {
+		if p.metricsURL == "" {
+			return nil, fmt.Errorf("IDLE_MAX_CPU needs IDLE_METRICS_URL")
+		}
+		if p.maxCPU, err = strconv.ParseFloat(s, 64); err != nil {
+			return nil, fmt.Errorf("IDLE_MAX_CPU: %w", err)
+		}
+	}
+	if p.windows, err = parseAwakeWindows(cfg.Get("KEEP_AWAKE")); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// watch samples the machine every policyInterval, running the action once it
+// has been idle for idleAfter
+func (p *policy) watch() {
+	p.check(time.Now())
+	for now := range time.Tick(policyInterval) {
+		p.check(now)
+	}
+}
+
+// check takes one sample and acts on it
+func (p *policy) check(now time.Time) {
+	p.mu.Lock()
+	prev := p.checked
+	p.checked = now
+	p.mu.Unlock()
+	a, err := p.sampler(now)
+	if err != nil {
+		log.Printf("policy: %v", err)
+	}
+	// A long gap between samples means the machine was asleep, which isn't
+	// idleness. The monotonic clock stops during sleep, so compare wall times.
+	woke := !prev.IsZero() && now.Round(0).Sub(prev.Round(0)) > 3*policyInterval
+
+	p.mu.Lock()
+	p.last = a
+	p.reason = p.busy(a, now)
+	if p.reason == "" && err != nil {
+		// What couldn't be read may have been busy
+		p.reason = err.Error()
+	}
+	if p.reason != "" || woke {
+		p.idleSince = time.Time{}
+	} else if p.idleSince.IsZero() {
+		p.idleSince = now
+	}
+	act := !p.idleSince.IsZero() && now.Sub(p.idleSince) >= p.idleAfter
+	if act {
+		p.idleSince = time.Time{}
+	}
+	p.mu.Unlock()
+
+	if act {
+		log.Printf("policy: idle for %s, running %s", p.idleAfter, p.action)
+		if err := p.run(p.action, false, fmt.Sprintf("idle for %s", p.idleAfter)); err != nil {
+			log.Printf("policy: %s failed: %v", p.action, err)
+		}
+	}
+}
+
+// busy returns why the machine should stay on, or "" if it is idle. The caller holds mu.
+func (p *policy) busy(a activity, now time.Time) string {
+	switch {
+	case !p.enabled:
+		return "policy disabled"
+	case now.Before(p.keepAwakeUntil):
+		return "kept awake until " + p.keepAwakeUntil.Format(time.RFC3339)
+	case a.SSHSessions > 0:
+		return fmt.Sprintf("%d ssh sessions", a.SSHSessions)
+	case a.Load > p.maxLoad:
+		return fmt.Sprintf("load %.2f above %.2f", a.Load, p.maxLoad)
+	case a.NetKBps > p.maxNet:
+		return fmt.Sprintf("network %.1fkB/s above %.1fkB/s", a.NetKBps, p.maxNet)
+	case p.maxCPU > 0 && a.CPUPercent > p.maxCPU:
+		return fmt.Sprintf("cpu %.0f%% above %.0f%%", a.CPUPercent, p.maxCPU)
+	}
+	for _, w := range p.windows {
+		if w.contains(now) {
+			return "keep-awake window " + w.text
+		}
+	}
+	return ""
+}
+
+// sample reads the load average, SSH sessions and network rate since the
+// last sample. With a metrics-service, the load, CPU usage and network rate
+// come from there instead, unless it doesn't answer.
+func (p *policy) sample(now time.Time) (activity, error) {
+	var a activity
+	var errs, local []string
+	var err error
+	if load, err := loadAverages(); err != nil {
+		local = append(local, err.Error())
+	} else {
+		a.Load = load[0]
+	}
+	if a.SSHSessions, err = sshSessions(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	// A failed read keeps the last good count, so the next rate isn't
+	// measured from zero
+	if bytes, err := networkBytes(); err != nil {
+		local = append(local, err.Error())
+	} else {
+		p.mu.Lock()
+		if !p.netAt.IsZero() && bytes >= p.netBytes {
+			a.NetKBps = float64(bytes-p.netBytes) / 1024 / now.Sub(p.netAt).Seconds()
+		}
+		p.netBytes, p.netAt = bytes, now
+		p.mu.Unlock()
+	}
+
+	if p.metricsURL != "" {
+		if m, err := fetchHostMetrics(p.metricsURL, p.metricsToken); err != nil {
+			errs = append(errs, "metrics-service: "+err.Error())
+		} else {
+			a.Load, a.CPUPercent = m.CPU.Load[0], m.CPU.UsagePercent
+			a.NetKBps = (m.Network.ReceiveBytesPerSec + m.Network.TransmitBytesPerSec) / 1024
+			local = nil
+		}
+	}
+	errs = append(errs, local...)
+	if len(errs) > 0 {
+		return a, fmt.Errorf("sampling activity: %s", strings.Join(errs, "; "))
+	}
+	return a, nil
+}
+
+// sshSessions counts established TCP connections to the SSH port
+func sshSessions() (int, error) {
+	count := 0
+	for _, name := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		f, err := os.Open(name)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Scan() // header
+		for scanner.Scan() {
+			// sl local_address rem_address st ..., addresses as HEXIP:HEXPORT
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 4 || fields[3] != "01" { // 01 is ESTABLISHED
+				continue
+			}
+			_, port, _ := strings.Cut(fields[1], ":")
+			if p, err := strconv.ParseUint(port, 16, 16); err == nil && p == sshPort {
+				count++
+			}
+		}
+		f.Close()
+	}
+	return count, nil
+}
+
+// networkBytes totals the bytes received and sent on every interface but
+// loopback, from /proc/net/dev
+func networkBytes() (uint64, error) {
+	f, err := os.Open("/proc/net/dev")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var total uint64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, counters, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || strings.TrimSpace(name) == "lo" {
+			continue
+		}
+		// rx bytes is the first counter and tx bytes the ninth
+		fields := strings.Fields(counters)
+		if len(fields) < 9 {
+			continue
+		}
+		rx, _ := strconv.ParseUint(fields[0], 10, 64)
+		tx, _ := strconv.ParseUint(fields[8], 10, 64)
+		total += rx + tx
+	}
+	return total, scanner.Err()
+}
+
+// policyStatus is the response of GET /policy
+type policyStatus struct {
+	Enabled        bool       `json:"enabled"`
+	Action         string     `json:"action"`
+	IdleAfter      string     `json:"idle_after"`
+	MaxLoad        float64    `json:"max_load"`
+	MaxNetKBps     float64    `json:"max_net_kbps"`
+	MaxCPUPercent  float64    `json:"max_cpu_percent,omitempty"`
+	KeepAwake      []string   `json:"keep_awake"`
+	KeepAwakeUntil *time.Time `json:"keep_awake_until,omitempty"`
+	Activity       activity   `json:"activity"`
+	Busy           string     `json:"busy,omitempty"` // why the machine isn't idle
+	IdleSince      *time.Time `json:"idle_since,omitempty"`
+	ActsAt         *time.Time `json:"acts_at,omitempty"`
+}
+
+// status reports the policy's settings and what it last saw
+func (p *policy) status() policyStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := policyStatus{
+		Enabled:       p.enabled,
+		Action:        p.action,
+		IdleAfter:     p.idleAfter.String(),
+		MaxLoad:       p.maxLoad,
+		MaxNetKBps:    p.maxNet,
+		MaxCPUPercent: p.maxCPU,
+		KeepAwake:     []string{},
+		Activity:      p.last,
+		Busy:          p.reason,
+	}
+	for _, w := range p.windows {
+		s.KeepAwake = append(s.KeepAwake, w.text)
+	}
+	if time.Now().Before(p.keepAwakeUntil) {
+		until := p.keepAwakeUntil
+		s.KeepAwakeUntil = &until
+	}
+	if !p.idleSince.IsZero() {
+		since, at := p.idleSince, p.idleSince.Add(p.idleAfter)
+		s.IdleSince, s.ActsAt = &since, &at
+	}
+	return s
+}
+
+// policyHandler shows the idle policy on GET and changes it on POST with
+// {"enabled": false}, {"idle_after": "1h"} or {"keep_awake_for": "2h"}
+// until the service restarts
+func policyHandler(p *policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var req struct {
+				Enabled      *bool  `json:"enabled"`
+				IdleAfter    string `json:"idle_after"`
+				KeepAwakeFor string `json:"keep_awake_for"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			idleAfter, err := parseOptionalDuration("idle_after", req.IdleAfter, false)
+			var keepAwake time.Duration
+			if err == nil {
+				keepAwake, err = parseOptionalDuration("keep_awake_for", req.KeepAwakeFor, true)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			p.mu.Lock()
+			if req.Enabled != nil {
+				p.enabled = *req.Enabled
+			}
+			if idleAfter > 0 {
+				p.idleAfter = idleAfter
+			}
+			if req.KeepAwakeFor != "" {
+				// 0 ends an earlier keep-awake
+				p.keepAwakeUntil = time.Now().Add(keepAwake)
+				p.idleSince = time.Time{}
+			}
+			p.reason = p.busy(p.last, time.Now())
+			if p.reason != "" {
+				p.idleSince = time.Time{}
+			}
+			log.Printf("policy changed: enabled %v, idle after %s, kept awake until %s",
+				p.enabled, p.idleAfter, p.keepAwakeUntil.Format(time.RFC3339))
+			p.mu.Unlock()
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		httpserver.WriteJSON(w, http.StatusOK, p.status())
+	}
+}
+
+// parseOptionalDuration reads a duration field that may be empty
+func parseOptionalDuration(field, s string, zeroOK bool) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 || (d == 0 && !zeroOK) {
+		return 0, fmt.Errorf("%s must be a positive duration such as 2h, not %q", field, s)
+	}
+	return d, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseAwakeWindows(t *testing.T) {
+	windows, err := parseAwakeWindows("08:00-18:00, mon-fri 07:30-09:00,sat,sun 22:00-02:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != 3 {
+		t.Fatalf("expected 3 windows, got %d", len(windows))
+	}
+	every, weekdays, weekend := windows[0], windows[1], windows[2]
+	if every.days != [7]bool{true, true, true, true, true, true, true} || every.start != 8*60 || every.end != 18*60 {
+		t.Errorf("08:00-18:00: got %+v", every)
+	}
+	if weekdays.days != [7]bool{false, true, true, true, true, true, false} || weekdays.start != 7*60+30 {
+		t.Errorf("mon-fri 07:30-09:00: got %+v", weekdays)
+	}
+	if weekend.text != "sat,sun 22:00-02:00" || weekend.days != [7]bool{true, false, false, false, false, false, true} ||
+		weekend.start != 22*60 || weekend.end != 2*60 {
+		t.Errorf("sat,sun 22:00-02:00: got %+v", weekend)
+	}
+
+	if windows, err := parseAwakeWindows(""); err != nil || len(windows) != 0 {
+		t.Errorf("expected no windows, got %v, %v", windows, err)
+	}
+	for _, s := range []string{"sat", "08:00", "funday 08:00-09:00", "08:00-25:00", "mon tue 08:00-09:00"} {
+		if _, err := parseAwakeWindows(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestAwakeWindowContains(t *testing.T) {
+	windows, err := parseAwakeWindows("fri 22:00-02:00,mon 09:00-17:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	night, day := windows[0], windows[1]
+	// 2025-06-06 is a Friday
+	at := func(day, hour, minute int) time.Time { return time.Date(2025, 6, day, hour, minute, 0, 0, time.UTC) }
+	tests := []struct {
+		w    awakeWindow
+		t    time.Time
+		want bool
+	}{
+		{night, at(6, 21, 59), false},
+		{night, at(6, 22, 0), true},
+		{night, at(6, 23, 59), true},
+		{night, at(7, 1, 59), true}, // Saturday morning, still Friday night's window
+		{night, at(7, 2, 0), false},
+		{night, at(7, 22, 30), false},
+		{night, at(6, 1, 0), false}, // Friday morning belongs to Thursday
+		{day, at(9, 9, 0), true},
+		{day, at(9, 17, 0), false},
+		{day, at(10, 12, 0), false},
+	}
+	for _, tt := range tests {
+		if got := tt.w.contains(tt.t); got != tt.want {
+			t.Errorf("%s contains %s: got %v, want %v", tt.w.text, tt.t.Format("Mon 15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestPolicyBusy(t *testing.T) {
+	now := time.Date(2025, 6, 6, 12, 0, 0, 0, time.UTC)
+	windows, _ := parseAwakeWindows("fri 11:00-13:00")
+	tests := []struct {
+		name   string
+		change func(*policy)
+		a      activity
+		busy   bool
+	}{
+		{"idle", nil, activity{Load: 0.1, NetKBps: 5}, false},
+		{"disabled", func(p *policy) { p.enabled = false }, activity{}, true},
+		{"kept awake", func(p *policy) { p.keepAwakeUntil = now.Add(time.Minute) }, activity{}, true},
+		{"keep awake over", func(p *policy) { p.keepAwakeUntil = now }, activity{}, false},
+		{"ssh", nil, activity{SSHSessions: 1}, true},
+		{"load", nil, activity{Load: 0.6}, true},
+		{"network", nil, activity{NetKBps: 101}, true},
+		{"cpu ignored", nil, activity{CPUPercent: 90}, false},
+		{"cpu", func(p *policy) { p.maxCPU = 20 }, activity{CPUPercent: 21}, true},
+		{"window", func(p *policy) { p.windows = windows }, activity{}, true},
+	}
+	for _, tt := range tests {
+		p := &policy{maxLoad: 0.5, maxNet: 100, enabled: true}
+		if tt.change != nil {
+			tt.change(p)
+		}
+		if reason := p.busy(tt.a, now); (reason != "") != tt.busy {
+			t.Errorf("%s: got %q", tt.name, reason)
+		}
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	var ran []string
+	p := &policy{action: "suspend", maxLoad: 0.5, maxNet: 100, enabled: true, idleAfter: 3 * time.Minute,
+		run: func(name string, dryRun bool, reason string) error {
+			ran = append(ran, name)
+			return nil
+		}}
+	var next activity
+	var sampleErr error
+	p.sampler = func(time.Time) (activity, error) { return next, sampleErr }
+
+	start := time.Date(2025, 6, 6, 12, 0, 0, 0, time.UTC)
+	minute := func(n int) time.Time { return start.Add(time.Duration(n) * policyInterval) }
+
+	// Idle from the first sample, acting once idleAfter has passed
+	p.check(minute(0))
+	if !p.idleSince.Equal(minute(0)) {
+		t.Fatalf("expected idle since the first sample, got %v", p.idleSince)
+	}
+	p.check(minute(2))
+	if len(ran) != 0 {
+		t.Fatal("acted before idleAfter")
+	}
+	p.check(minute(3))
+	if len(ran) != 1 || ran[0] != "suspend" || !p.idleSince.IsZero() {
+		t.Fatalf("expected suspend once idle for 3m, ran %v", ran)
+	}
+
+	// Activity starts the wait again
+	p.check(minute(4))
+	next = activity{SSHSessions: 1}
+	p.check(minute(5))
+	if !p.idleSince.IsZero() || p.reason == "" {
+		t.Errorf("expected an SSH session to count as busy, got %q", p.reason)
+	}
+	next = activity{}
+	p.check(minute(6))
+	p.check(minute(8))
+	if len(ran) != 1 {
+		t.Error("acted before being idle for 3m since the SSH session")
+	}
+
+	// A sample that can't be read isn't idle
+	sampleErr = errors.New("sampling activity: /proc/loadavg: no such file")
+	p.check(minute(9))
+	if !p.idleSince.IsZero() || p.reason == "" {
+		t.Errorf("expected a failed sample to count as busy, got %q", p.reason)
+	}
+	sampleErr = nil
+
+	// Nor is a gap between samples, when the machine was asleep
+	p.check(minute(10))
+	p.check(minute(20))
+	if !p.idleSince.IsZero() {
+		t.Error("expected waking up to start the wait again")
+	}
+	p.check(minute(21))
+	p.check(minute(23))
+	if len(ran) != 1 {
+		t.Errorf("expected no action within 3m of waking, ran %v", ran)
+	}
+	p.check(minute(24))
+	if len(ran) != 2 {
+		t.Errorf("expected the action once idle for 3m after waking, ran %v", ran)
+	}
+}
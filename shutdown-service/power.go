@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// powerTimeout bounds each call to apcaccess or upower
+const powerTimeout = 5 * time.Second
+
+// errNotInstalled means a status tool isn't on this machine
+var errNotInstalled = errors.New("not installed")
+
+// power is the state of a UPS or battery
+type power struct {
+	Source         string  `json:"source"` // apcupsd, upower or nut
+	Name           string  `json:"name,omitempty"`
+	Status         string  `json:"status"`
+	OnBattery      bool    `json:"on_battery"`
+	ChargePercent  float64 `json:"charge_percent"`
+	RuntimeMinutes float64 `json:"runtime_minutes,omitempty"` // estimated time left on battery
+}
+
+// readPower asks whichever of apcupsd and upower are installed about the
+// machine's UPSes and batteries
+func readPower() ([]power, error) {
+	var all []power
+	var errs []error
+	for _, read := range []func() ([]power, error){readApcupsd, readUpower} {
+		p, err := read()
+		all = append(all, p...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return all, errors.Join(errs...)
+}
+
+// runTool runs a status tool, returning errNotInstalled if it isn't there
+func runTool(name string, args ...string) (string, error) {
+	if _, err := exec.LookPath(name); err != nil {
+		return "", errNotInstalled
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), powerTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return string(out), nil
+}
+
+// keyValues splits "KEY : value" lines, as printed by apcaccess and upower
+func keyValues(out string) map[string]string {
+	kv := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		k, v, ok := strings.Cut(line, ":")
+		if ok {
+			kv[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+		}
+	}
+	return kv
+}
+
+// leadingNumber reads the number at the start of a value such as "85.0 Percent"
+func leadingNumber(s string) float64 {
+	fields := strings.Fields(strings.TrimSuffix(s, "%"))
+	if len(fields) == 0 {
+		return 0
+	}
+	n, _ := strconv.ParseFloat(strings.TrimSuffix(fields[0], "%"), 64)
+	return n
+}
+
+// readApcupsd reads the UPS managed by apcupsd through apcaccess
+func readApcupsd() ([]power, error) {
+	out, err := runTool("apcaccess", "status")
+	if err == errNotInstalled {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return []power{parseApcaccess(out)}, nil
+}
+
+// parseApcaccess reads the output of apcaccess status, where STATUS is e.g.
+// ONLINE or ONBATT, BCHARGE "100.0 Percent" and TIMELEFT "34.5 Minutes"
+func parseApcaccess(out string) power {
+	kv := keyValues(out)
+	p := power{
+		Source:         "apcupsd",
+		Name:           kv["upsname"],
+		Status:         kv["status"],
+		ChargePercent:  leadingNumber(kv["bcharge"]),
+		RuntimeMinutes: leadingNumber(kv["timeleft"]),
+	}
+	p.OnBattery = strings.Contains(p.Status, "ONBATT")
+	return p
+}
+
+// readUpower reads every battery and UPS known to upower
+func readUpower() ([]power, error) {
+	out, err := runTool("upower", "-e")
+	if err == errNotInstalled {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var all []power
+	for _, device := range strings.Fields(out) {
+		if !strings.Contains(device, "battery_") && !strings.Contains(device, "ups_") {
+			continue
+		}
+		info, err := runTool("upower", "-i", device)
+		if err != nil {
+			return all, err
+		}
+		all = append(all, parseUpower(device, info))
+	}
+	return all, nil
+}
+
+// parseUpower reads the output of upower -i, with lines such as
+// "state: discharging", "percentage: 85%" and "time to empty: 2.3 hours"
+func parseUpower(device, out string) power {
+	kv := keyValues(out)
+	p := power{
+		Source:        "upower",
+		Name:          device[strings.LastIndex(device, "/")+1:],
+		Status:        kv["state"],
+		OnBattery:     kv["state"] == "discharging",
+		ChargePercent: leadingNumber(kv["percentage"]),
+	}
+	if left := kv["time to empty"]; left != "" {
+		p.RuntimeMinutes = leadingNumber(left)
+		if strings.Contains(left, "hour") {
+			p.RuntimeMinutes *= 60
+		} else if strings.Contains(left, "second") {
+			p.RuntimeMinutes /= 60
+		}
+	}
+	return p
+}
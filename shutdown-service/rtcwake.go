@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oksmith/home-server/pkg/httpserver"
+)
+
+// alarmCommands set the RTC wake alarm for each POWER_BACKEND, given the
+// arguments to rtcwake. Backends that are missing can't set one.
+var alarmCommands = map[string]string{
+	"sudo":    "sudo rtcwake",
+	"systemd": "rtcwake",
+	"syscall": "rtcwake",
+}
+
+// rtcAlarm sets and clears the wake alarm of the machine's real-time clock,
+// which powers it back on from off, suspend or hibernation
+type rtcAlarm struct {
+	exec []string // rtcwake, or nil for the fake backend
+	fake string   // the fake backend's file
+}
+
+// newRTCAlarm returns the alarm for a backend, or nil if it has none.
+// RTCWAKE_CMD replaces the backend's rtcwake command.
+func newRTCAlarm(backend string) *rtcAlarm {
+	if custom := strings.Fields(cfg.Get("RTCWAKE_CMD")); len(custom) > 0 {
+		return &rtcAlarm{exec: custom}
+	}
+	if backend == "fake" {
+		return &rtcAlarm{fake: cfg.Get("POWER_FAKE_FILE")}
+	}
+	if command, ok := alarmCommands[backend]; ok {
+		return &rtcAlarm{exec: strings.Fields(command)}
+	}
+	return nil
+}
+
+// run runs rtcwake with args, or records them on the fake backend
+func (a *rtcAlarm) run(args ...string) error {
+	if a.exec == nil {
+		return fakeCommand{action: "rtcwake " + strings.Join(args, " "), file: a.fake}.Run()
+	}
+	return execCommand(append(append([]string{}, a.exec...), args...)).Run()
+}
+
+// set programs the alarm for t, without putting the machine to sleep
+func (a *rtcAlarm) set(t time.Time) error {
+	return a.run("-m", "no", "-t", strconv.FormatInt(t.Unix(), 10))
+}
+
+// clear turns the alarm off
+func (a *rtcAlarm) clear() error {
+	return a.run("-m", "disable")
+}
+
+// wakeSchedule is when the machine should next power itself on: every day at
+// a time of day, or once at a given time
+type wakeSchedule struct {
+	alarm *rtcAlarm
+
+	mu    sync.Mutex
+	daily string    // e.g. "06:30", local time
+	once  time.Time // if daily is ""
+}
+
+// parseWakeTime reads a time of day such as "06:30", which repeats daily, or
+// an RFC 3339 time
+func parseWakeTime(s string) (daily string, once time.Time, err error) {
+	if t, err := time.Parse("15:04", s); err == nil {
+		return t.Format("15:04"), time.Time{}, nil
+	}
+	if once, err = time.Parse(time.RFC3339, s); err != nil {
+		return "", time.Time{}, fmt.Errorf("time must be HH:MM or RFC 3339, not %q", s)
+	}
+	return "", once, nil
+}
+
+// nextWake returns when a schedule next wakes the machine after now, or the
+// zero time if it won't
+func nextWake(daily string, once, now time.Time) time.Time {
+	if daily == "" {
+		if once.After(now) {
+			return once
+		}
+		return time.Time{}
+	}
+	t, _ := time.Parse("15:04", daily)
+	next := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// next returns when the machine will next be woken, or the zero time
+func (s *wakeSchedule) next() time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return nextWake(s.daily, s.once, time.Now())
+}
+
+// arm sets the alarm before the machine goes to sleep or powers off, moving
+// a daily wake on to its next day. Failures are logged; they don't stop the
+// action.
+func (s *wakeSchedule) arm(dryRun bool) {
+	at := s.next()
+	if at.IsZero() {
+		return
+	}
+	if dryRun {
+		log.Printf("dry run: would set the wake alarm for %s", at.Format(time.RFC3339))
+		return
+	}
+	if err := s.alarm.set(at); err != nil {
+		log.Printf("setting the wake alarm for %s failed: %v", at.Format(time.RFC3339), err)
+		return
+	}
+	log.Printf("waking up at %s", at.Format(time.RFC3339))
+}
+
+// wakeScheduleHandler shows the wake schedule at GET /wake/schedule, sets it
+// from {"time": "06:30"} or {"time": "2026-10-17T06:30:00+01:00"} at POST and
+// clears it at DELETE. The alarm is set straight away and again before every
+// action but reboot.
+func wakeScheduleHandler(s *wakeSchedule) http.HandlerFunc {
+	describe := func() any {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		next := nextWake(s.daily, s.once, time.Now())
+		if next.IsZero() {
+			return nil
+		}
+		return struct {
+			Daily  string    `json:"daily,omitempty"`
+			WakeAt time.Time `json:"wake_at"`
+		}{s.daily, next}
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.alarm == nil {
+			http.Error(w, "this power backend can't set a wake alarm; set RTCWAKE_CMD", http.StatusNotImplemented)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			httpserver.WriteJSON(w, http.StatusOK, describe())
+
+		case http.MethodPost:
+			var req struct {
+				Time string `json:"time"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+				return
+			}
+			daily, once, err := parseWakeTime(req.Time)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			next := nextWake(daily, once, time.Now())
+			if next.IsZero() {
+				http.Error(w, "time is in the past", http.StatusBadRequest)
+				return
+			}
+			if err := s.alarm.set(next); err != nil {
+				http.Error(w, "setting the wake alarm failed: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			s.mu.Lock()
+			s.daily, s.once = daily, once
+			s.mu.Unlock()
+			log.Printf("waking up at %s", next.Format(time.RFC3339))
+			httpserver.WriteJSON(w, http.StatusOK, describe())
+
+		case http.MethodDelete:
+			if s.next().IsZero() {
+				http.Error(w, "no wake is scheduled", http.StatusNotFound)
+				return
+			}
+			err := s.alarm.clear()
+			s.mu.Lock()
+			s.daily, s.once = "", time.Time{}
+			s.mu.Unlock()
+			if err != nil {
+				http.Error(w, "clearing the wake alarm failed: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Write([]byte("Wake cancelled"))
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
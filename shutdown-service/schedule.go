@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/oksmith/home-server/pkg/cron"
+	"github.com/oksmith/home-server/pkg/notify"
+)
+
+// pendingAction is a power action waiting for its time
+type pendingAction struct {
+	Action string    `json:"action"`
+	At     time.Time `json:"at"`
+	Cron   string    `json:"cron,omitempty"` // runs again on this schedule, if set
+	DryRun bool      `json:"dry_run,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+
+	timer *time.Timer
+}
+
+// scheduler holds at most one pending action; scheduling another replaces it
+type scheduler struct {
+	pending *pendingAction
+	run     runFunc
+	events  *notify.Client
+	wall    *announcer
+	mu      sync.Mutex
+}
+
+// schedule runs action name at when, and again at each later time repeat,
+// parsed from the cron expression expr, matches if it is set, only pretending
+// to if dryRun is set. It returns the
+// new pending action.
+func (s *scheduler) schedule(name string, at time.Time, expr string, repeat *cron.Schedule, dryRun bool, reason string) pendingAction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending != nil {
+		s.pending.timer.Stop()
+		log.Printf("replacing pending %s at %s", s.pending.Action, s.pending.At.Format(time.RFC3339))
+	}
+	p := &pendingAction{Action: name, At: at, Cron: expr, DryRun: dryRun, Reason: reason}
+	p.timer = time.AfterFunc(time.Until(at), func() { s.fire(p, repeat) })
+	s.pending = p
+	log.Printf("%s scheduled for %s", name, at.Format(time.RFC3339))
+	e := event{Kind: eventScheduled, Action: name, Reason: reason,
+		Message: fmt.Sprintf("%s scheduled for %s%s", name, at.Format("Mon 15:04 MST"), dryRunNote(dryRun))}
+	s.events.Send(e.message())
+	go s.wall.announce(e, dryRun)
+	return *p
+}
+
+// fire runs a pending action that is still pending, then re-arms it if it repeats
+func (s *scheduler) fire(p *pendingAction, repeat *cron.Schedule) {
+	s.mu.Lock()
+	if s.pending != p {
+		s.mu.Unlock()
+		return
+	}
+	s.pending = nil
+	s.mu.Unlock()
+
+	if err := s.run(p.Action, p.DryRun, p.Reason); err != nil {
+		log.Printf("scheduled %s failed: %v", p.Action, err)
+	}
+	// Repeat unless something else was scheduled while the action ran
+	if repeat != nil && s.current() == nil {
+		if next, err := repeat.Next(time.Now()); err == nil {
+			s.schedule(p.Action, next, p.Cron, repeat, p.DryRun, p.Reason)
+		}
+	}
+}
+
+// cancel drops the pending action if it is for name, reporting whether it was
+func (s *scheduler) cancel(name string) (pendingAction, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending == nil || s.pending.Action != name {
+		return pendingAction{}, false
+	}
+	p := *s.pending
+	s.pending.timer.Stop()
+	s.pending = nil
+	s.cancelled(p)
+	return p, true
+}
+
+// cancelPending drops the pending action if it is still p, reporting whether it was
+func (s *scheduler) cancelPending(p pendingAction) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending == nil || s.pending.Action != p.Action || !s.pending.At.Equal(p.At) {
+		return false
+	}
+	s.pending.timer.Stop()
+	s.pending = nil
+	s.cancelled(p)
+	return true
+}
+
+// cancelled reports that p won't run after all
+func (s *scheduler) cancelled(p pendingAction) {
+	log.Printf("cancelled %s at %s", p.Action, p.At.Format(time.RFC3339))
+	e := event{Kind: eventCancelled, Action: p.Action, Reason: p.Reason,
+		Message: fmt.Sprintf("%s at %s was cancelled%s", p.Action, p.At.Format("Mon 15:04 MST"), dryRunNote(p.DryRun))}
+	s.events.Send(e.message())
+	go s.wall.announce(e, p.DryRun)
+}
+
+// dryRunNote marks messages about actions that will only be simulated
+func dryRunNote(dryRun bool) string {
+	if dryRun {
+		return " (dry run)"
+	}
+	return ""
+}
+
+// current returns the pending action, or nil
+func (s *scheduler) current() *pendingAction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending == nil {
+		return nil
+	}
+	p := *s.pending
+	return &p
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oksmith/home-server/pkg/cron"
+)
+
+func TestActionDelay(t *testing.T) {
+	sched := &scheduler{run: func(string, bool, string) error { return nil }}
+	confirm, _ := newConfirmations("")
+	h := actionHandler(actions[0], sched.run, sched, confirm, false)
+
+	for _, delay := range []string{"soon", "-5m", "0s"} {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest("POST", "/shutdown?delay="+delay, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("delay %s: got %d", delay, w.Code)
+		}
+	}
+	if sched.current() != nil {
+		t.Fatal("expected a bad delay to schedule nothing")
+	}
+
+	before := time.Now()
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest("POST", "/shutdown?delay=10m&reason=updates", nil))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	p := sched.current()
+	if p == nil || p.Action != "shutdown" || p.Reason != "updates" {
+		t.Fatalf("expected shutdown pending, got %+v", p)
+	}
+	if p.At.Before(before.Add(10*time.Minute)) || p.At.After(time.Now().Add(10*time.Minute)) {
+		t.Errorf("expected shutdown in 10m, got %s", p.At)
+	}
+
+	// Scheduling again replaces it, and cancelling takes only that action
+	sched.schedule("reboot", time.Now().Add(time.Hour), "", nil, false, "")
+	if _, ok := sched.cancel("shutdown"); ok {
+		t.Error("cancelled shutdown, which was replaced")
+	}
+	if _, ok := sched.cancel("reboot"); !ok || sched.current() != nil {
+		t.Error("expected reboot cancelled")
+	}
+}
+
+func TestScheduleCron(t *testing.T) {
+	sched := &scheduler{run: func(string, bool, string) error { return nil }}
+	h := scheduleHandler(actions[0], sched, false)
+
+	for _, body := range []string{`{"cron": "61 * * * *"}`, `{"cron": ""}`, `not json`} {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest("POST", "/shutdown/schedule", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d", body, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest("POST", "/shutdown/schedule", strings.NewReader(`{"cron": "30 1 * * *"}`)))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	defer sched.cancel("shutdown")
+	p := sched.current()
+	if p == nil || p.Cron != "30 1 * * *" {
+		t.Fatalf("expected a cron schedule pending, got %+v", p)
+	}
+	if p.At.Hour() != 1 || p.At.Minute() != 30 || !p.At.After(time.Now()) || p.At.After(time.Now().Add(24*time.Hour)) {
+		t.Errorf("expected the next 01:30, got %s", p.At)
+	}
+}
+
+func TestScheduleRepeats(t *testing.T) {
+	ran := make(chan string, 1)
+	sched := &scheduler{run: func(name string, dryRun bool, reason string) error {
+		ran <- name
+		return nil
+	}}
+	repeat, err := cron.Parse("0 3 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sched.schedule("reboot", time.Now().Add(10*time.Millisecond), "0 3 * * *", repeat, false, "nightly")
+	select {
+	case name := <-ran:
+		if name != "reboot" {
+			t.Errorf("ran %s", name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the pending action never ran")
+	}
+
+	// Once run, it is scheduled again for the next time the expression matches
+	var p *pendingAction
+	for deadline := time.Now().Add(5 * time.Second); p == nil && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+		p = sched.current()
+	}
+	if p == nil {
+		t.Fatal("expected the action re-armed")
+	}
+	defer sched.cancel("reboot")
+	if p.At.Hour() != 3 || p.At.Minute() != 0 || !p.At.After(time.Now()) || p.Reason != "nightly" {
+		t.Errorf("expected reboot at the next 03:00, got %+v", p)
+	}
+}
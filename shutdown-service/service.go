@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// serviceName is what the service is installed as
+const serviceName = "shutdown-service"
+
+// parseCommandLine handles "install" and "uninstall", which set the binary
+// up as a service and exit, and otherwise the flags of a normal run
+func parseCommandLine() {
+	if len(os.Args) > 1 && (os.Args[1] == "install" || os.Args[1] == "uninstall") {
+		var err error
+		if os.Args[1] == "install" {
+			err = install(os.Args[2:])
+		} else {
+			err = uninstallService()
+		}
+		if err != nil {
+			log.Fatalf("%s: %v", os.Args[1], err)
+		}
+		os.Exit(0)
+	}
+
+	envFile := flag.String("env-file", os.Getenv("CONFIG_FILE"), "read settings from `FILE` of KEY=value lines, reloading them when it changes; the environment overrides them")
+	logFile := flag.String("log-file", "", "append the log to `FILE` rather than stderr")
+	asService := flag.Bool("service", false, "run under the Windows service manager")
+	flag.Parse()
+
+	if *logFile != "" {
+		f, err := os.OpenFile(*logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.SetOutput(f)
+	}
+	loadSettings(*envFile)
+	if *asService {
+		if err := startService(); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// install sets this binary up as a service started at boot, creating its
+// settings file with a new token if there isn't one
+func install(args []string) error {
+	flags := flag.NewFlagSet("install", flag.ExitOnError)
+	envFile := flags.String("env-file", defaultEnvFile, "the service's settings `FILE`")
+	logFile := flags.String("log-file", defaultLogFile, "where the service logs to")
+	flags.Parse(args)
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	if *envFile, err = filepath.Abs(*envFile); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(*envFile); errors.Is(err, fs.ErrNotExist) {
+		if err := createEnvFile(*envFile); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	if err := installService(exe, *envFile, *logFile); err != nil {
+		return err
+	}
+	fmt.Printf("installed %s as the %s service; its settings are in %s\n", exe, serviceName, *envFile)
+	return nil
+}
+
+// createEnvFile writes a settings file holding only a new SHUTDOWN_TOKEN, in
+// a directory only administrators can read
+func createEnvFile(filename string) error {
+	dir := filepath.Dir(filename)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := restrictDir(dir); err != nil {
+		return err
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return err
+	}
+	content := "# Settings for " + serviceName + "; see its documentation for the rest\n" +
+		"SHUTDOWN_TOKEN=" + secret + "\n"
+	if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s with a new SHUTDOWN_TOKEN: %s\n", filename, secret)
+	return nil
+}
+
+// runSetup runs a command that sets up the service, including its output in
+// any error
+func runSetup(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, msg)
+		}
+		return fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"os"
+	"strings"
+)
+
+const (
+	defaultEnvFile = "/usr/local/etc/shutdown-service.env"
+	defaultLogFile = "/var/log/shutdown-service.log"
+	launchdLabel   = "com.github.oksmith." + serviceName
+	plistFile      = "/Library/LaunchDaemons/" + launchdLabel + ".plist"
+)
+
+// installService writes a launchd daemon running exe as root at boot,
+// restarting it if it fails, then loads it
+func installService(exe, envFile, logFile string) error {
+	var args strings.Builder
+	for _, arg := range []string{exe, "-env-file", envFile} {
+		args.WriteString("\t\t<string>" + xmlEscape(arg) + "</string>\n")
+	}
+	plist := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>` + launchdLabel + `</string>
+	<key>ProgramArguments</key>
+	<array>
+` + args.String() + `	</array>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+	<key>StandardOutPath</key>
+	<string>` + xmlEscape(logFile) + `</string>
+	<key>StandardErrorPath</key>
+	<string>` + xmlEscape(logFile) + `</string>
+</dict>
+</plist>
+`
+	if err := os.WriteFile(plistFile, []byte(plist), 0644); err != nil {
+		return err
+	}
+	// Unload any older version first
+	runSetup("launchctl", "bootout", "system/"+launchdLabel)
+	return runSetup("launchctl", "bootstrap", "system", plistFile)
+}
+
+// uninstallService unloads the daemon and removes its plist
+func uninstallService() error {
+	runSetup("launchctl", "bootout", "system/"+launchdLabel)
+	if err := os.Remove(plistFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
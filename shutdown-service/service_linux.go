@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+)
+
+const (
+	defaultEnvFile = "/etc/shutdown-service.env"
+	defaultLogFile = "" // the journal
+	unitFile       = "/etc/systemd/system/" + serviceName + ".service"
+)
+
+// installService writes a systemd unit running exe as the user who ran sudo,
+// so the sudo backend's rules apply, then enables and (re)starts it
+func installService(exe, envFile, logFile string) error {
+	name := os.Getenv("SUDO_USER")
+	if name == "" {
+		u, err := user.Current()
+		if err != nil {
+			return err
+		}
+		name = u.Username
+	}
+	start := exe + " -env-file " + envFile
+	if logFile != "" {
+		start += " -log-file " + logFile
+	}
+	unit := fmt.Sprintf(`[Unit]
+Description=Home Server Shutdown Service
+After=network.target
+
+[Service]
+Type=simple
+User=%s
+ExecStart=%s
+ExecReload=/bin/kill -HUP $MAINPID
+Restart=on-failure
+RestartSec=5s
+
+[Install]
+WantedBy=multi-user.target
+`, name, start)
+	if err := os.WriteFile(unitFile, []byte(unit), 0644); err != nil {
+		return err
+	}
+	if err := runSetup("systemctl", "daemon-reload"); err != nil {
+		return err
+	}
+	if err := runSetup("systemctl", "enable", serviceName); err != nil {
+		return err
+	}
+	return runSetup("systemctl", "restart", serviceName)
+}
+
+// uninstallService stops the service and removes its unit
+func uninstallService() error {
+	runSetup("systemctl", "disable", "--now", serviceName)
+	if err := os.Remove(unitFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return runSetup("systemctl", "daemon-reload")
+}
@@ -0,0 +1,22 @@
+//go:build !linux && !darwin && !windows
+
+package main
+
+import (
+	"errors"
+	"runtime"
+)
+
+const (
+	defaultEnvFile = "/usr/local/etc/shutdown-service.env"
+	defaultLogFile = "/var/log/shutdown-service.log"
+)
+
+// installService isn't written for this system's init
+func installService(exe, envFile, logFile string) error {
+	return errors.New("not supported on " + runtime.GOOS + "; run it with -env-file from an rc.d script")
+}
+
+func uninstallService() error {
+	return errors.New("not supported on " + runtime.GOOS)
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+// restrictDir does nothing: the settings file's own mode keeps it private
+func restrictDir(dir string) error { return nil }
+
+// startService fails, as only Windows services need -service
+func startService() error {
+	return errors.New("-service is only for Windows; systemd and launchd run the service as it is")
+}
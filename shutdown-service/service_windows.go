@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	defaultEnvFile = `C:\ProgramData\shutdown-service\shutdown-service.env`
+	defaultLogFile = `C:\ProgramData\shutdown-service\shutdown-service.log`
+)
+
+// installService registers exe with the service manager to start at boot as
+// LocalSystem and restart if it fails, lets it through the firewall and
+// starts it
+func installService(exe, envFile, logFile string) error {
+	command := []string{exe, "-service", "-env-file", envFile}
+	if logFile != "" {
+		command = append(command, "-log-file", logFile)
+	}
+	for i, arg := range command {
+		command[i] = syscall.EscapeArg(arg)
+	}
+	config := []string{serviceName, "binPath=", strings.Join(command, " "), "start=", "auto",
+		"DisplayName=", "Home Server Shutdown Service"}
+
+	// Reconfigure an existing service rather than failing
+	if runSetup("sc.exe", "query", serviceName) == nil {
+		runSetup("sc.exe", "stop", serviceName)
+		if err := runSetup("sc.exe", append([]string{"config"}, config...)...); err != nil {
+			return err
+		}
+	} else if err := runSetup("sc.exe", append([]string{"create"}, config...)...); err != nil {
+		return err
+	}
+	if err := runSetup("sc.exe", "description", serviceName, "Lets trusted devices power this machine off over HTTP"); err != nil {
+		return err
+	}
+	if err := runSetup("sc.exe", "failure", serviceName, "reset=", "86400", "actions=", "restart/5000/restart/5000/restart/60000"); err != nil {
+		return err
+	}
+
+	runSetup("netsh", "advfirewall", "firewall", "delete", "rule", "name="+serviceName)
+	if err := runSetup("netsh", "advfirewall", "firewall", "add", "rule", "name="+serviceName,
+		"dir=in", "action=allow", "protocol=TCP", "localport=8080", "program="+exe); err != nil {
+		return err
+	}
+	return runSetup("sc.exe", "start", serviceName)
+}
+
+// uninstallService stops and removes the service and its firewall rule
+func uninstallService() error {
+	runSetup("sc.exe", "stop", serviceName)
+	runSetup("netsh", "advfirewall", "firewall", "delete", "rule", "name="+serviceName)
+	return runSetup("sc.exe", "delete", serviceName)
+}
+
+// restrictDir lets only SYSTEM and Administrators into dir, as ProgramData is
+// readable by every user
+func restrictDir(dir string) error {
+	return runSetup("icacls", dir, "/inheritance:r",
+		"/grant:r", "*S-1-5-18:(OI)(CI)F", "/grant:r", "*S-1-5-32-544:(OI)(CI)F")
+}
+
+var (
+	advapi32                          = syscall.NewLazyDLL("advapi32.dll")
+	procStartServiceCtrlDispatcherW   = advapi32.NewProc("StartServiceCtrlDispatcherW")
+	procRegisterServiceCtrlHandlerExW = advapi32.NewProc("RegisterServiceCtrlHandlerExW")
+	procSetServiceStatus              = advapi32.NewProc("SetServiceStatus")
+)
+
+// Service states, accepted controls and control codes, from winsvc.h
+const (
+	serviceWin32OwnProcess = 0x10
+
+	serviceStopped     = 1
+	serviceStopPending = 3
+	serviceRunning     = 4
+
+	serviceAcceptStop     = 0x1
+	serviceAcceptShutdown = 0x4
+
+	serviceControlStop        = 1
+	serviceControlInterrogate = 4
+	serviceControlShutdown    = 5
+
+	errorCallNotImplemented = 120
+)
+
+// winServiceStatus is SERVICE_STATUS
+type winServiceStatus struct {
+	ServiceType             uint32
+	CurrentState            uint32
+	ControlsAccepted        uint32
+	Win32ExitCode           uint32
+	ServiceSpecificExitCode uint32
+	CheckPoint              uint32
+	WaitHint                uint32
+}
+
+// serviceTableEntry is SERVICE_TABLE_ENTRYW
+type serviceTableEntry struct {
+	name *uint16
+	proc uintptr
+}
+
+// windowsService reports to the service manager
+type windowsService struct {
+	handle uintptr
+	stop   chan struct{}
+	once   sync.Once
+}
+
+func (s *windowsService) report(state, accepts uint32) {
+	status := winServiceStatus{ServiceType: serviceWin32OwnProcess, CurrentState: state, ControlsAccepted: accepts}
+	if state == serviceStopPending {
+		status.WaitHint = 5000
+	}
+	procSetServiceStatus.Call(s.handle, uintptr(unsafe.Pointer(&status)))
+}
+
+// startService connects to the service manager, returning once it knows the
+// service is running. The process exits when the service manager stops it.
+func startService() error {
+	s := &windowsService{stop: make(chan struct{})}
+	name, err := syscall.UTF16PtrFromString(serviceName)
+	if err != nil {
+		return err
+	}
+
+	handler := syscall.NewCallback(func(control, eventType, eventData, context uintptr) uintptr {
+		switch control {
+		case serviceControlStop, serviceControlShutdown:
+			s.report(serviceStopPending, 0)
+			s.once.Do(func() { close(s.stop) })
+		case serviceControlInterrogate:
+		default:
+			return errorCallNotImplemented
+		}
+		return 0
+	})
+	running := make(chan error, 1)
+	serviceMain := syscall.NewCallback(func(argc, argv uintptr) uintptr {
+		var callErr error
+		s.handle, _, callErr = procRegisterServiceCtrlHandlerExW.Call(uintptr(unsafe.Pointer(name)), handler, 0)
+		if s.handle == 0 {
+			running <- fmt.Errorf("RegisterServiceCtrlHandlerEx: %w", callErr)
+			return 0
+		}
+		s.report(serviceRunning, serviceAcceptStop|serviceAcceptShutdown)
+		running <- nil
+		<-s.stop
+		log.Println("stopped by the service manager")
+		s.report(serviceStopped, 0)
+		return 0
+	})
+
+	go func() {
+		// The dispatcher keeps this thread until every service has stopped
+		runtime.LockOSThread()
+		table := []serviceTableEntry{{name, serviceMain}, {nil, 0}}
+		if ok, _, err := procStartServiceCtrlDispatcherW.Call(uintptr(unsafe.Pointer(&table[0]))); ok == 0 {
+			running <- fmt.Errorf("not started by the service manager: %w", err)
+			return
+		}
+		os.Exit(0)
+	}()
+	return <-running
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	"github.com/oksmith/home-server/pkg/config"
+	"github.com/oksmith/home-server/pkg/sigauth"
+)
+
+// cfg holds the settings, read by parseCommandLine before anything else runs
+var cfg *config.Config
+
+// signer signs calls to other services with SERVICE_KEY, if it is set
+var signer *sigauth.Signer
+
+// settings are every setting the service reads. SHUTDOWN_TOKEN and
+// NOTIFY_TOKEN may change while it runs; the rest take a restart.
+var settings = []config.Field{
+	{Name: "LISTEN_ADDR", Default: ":8080", Check: config.HostPort},
+	{Name: "SHUTDOWN_TOKEN", Secret: true, Reload: true},
+	{Name: "TOKENS_FILE"},
+	{Name: "TLS_CERT"},
+	{Name: "TLS_KEY"},
+	{Name: "TLS_CLIENT_CA"},
+	{Name: "AUTHORIZED_KEYS"},
+	{Name: "SERVICE_KEY"},
+	{Name: "POWER_BACKEND", Check: config.OneOf("sudo", "systemd", "bsd", "macos", "windows", "syscall", "fake")},
+	{Name: "POWER_FAKE_FILE"},
+	{Name: "SHUTDOWN_CMD"},
+	{Name: "REBOOT_CMD"},
+	{Name: "SUSPEND_CMD"},
+	{Name: "HIBERNATE_CMD"},
+	{Name: "RTCWAKE_CMD"},
+	{Name: "PRE_ACTION_HOOK"},
+	{Name: "DRAIN_FILE"},
+	{Name: "DRY_RUN", Check: config.Boolean},
+	{Name: "REQUIRE_REASON", Check: config.Boolean},
+	{Name: "WALL", Check: config.Boolean},
+	{Name: "CONFIRM_ACTIONS"},
+	{Name: "WAKE_TARGETS"},
+	{Name: "WAKE_BROADCAST", Check: config.HostPort},
+	{Name: "STATUS_DISKS"},
+	{Name: "UPS_MONITOR"},
+	{Name: "UPS_SHUTDOWN_BELOW", Check: config.NumberBetween(0, 100)},
+	{Name: "UPS_SHUTDOWN_GRACE"},
+	{Name: "UPS_NOTIFY_URL", Check: config.HTTPURL},
+	{Name: "NOTIFY_URL", Check: config.HTTPURL},
+	{Name: "NOTIFY_TOKEN", Secret: true, Reload: true},
+	{Name: "MQTT_URL"},
+	{Name: "MQTT_TOPIC"},
+	{Name: "MQTT_DISCOVERY_PREFIX", Default: "homeassistant"},
+	{Name: "MQTT_NODE_ID"},
+	{Name: "LOCAL_SOCKET"},
+	{Name: "LOCAL_SOCKET_MODE"},
+	{Name: "TRIGGER_FILE"},
+	{Name: "GATEWAY_URL", Check: config.HTTPURL},
+	{Name: "GATEWAY_REGISTRY_TOKEN", Secret: true},
+	{Name: "GATEWAY_NAME"},
+	{Name: "GATEWAY_SERVICE_URL", Check: config.HTTPURL},
+	{Name: "HOSTS_FILE"},
+	{Name: "AUDIT_FILE"},
+	{Name: "IDLE_SHUTDOWN_AFTER", Check: config.PositiveDuration},
+	{Name: "IDLE_ACTION", Check: func(s string) error {
+		if !isAction(s) {
+			return errors.New("unknown action " + s)
+		}
+		return nil
+	}},
+	{Name: "IDLE_MAX_LOAD", Check: config.NumberBetween(0, 1e6)},
+	{Name: "IDLE_MAX_NET_KBPS", Check: config.NumberBetween(0, 1e9)},
+	{Name: "IDLE_MAX_CPU", Check: config.NumberBetween(0, 100)},
+	{Name: "IDLE_METRICS_URL", Check: config.HTTPURL},
+	{Name: "IDLE_METRICS_TOKEN", Secret: true},
+	{Name: "KEEP_AWAKE"},
+}
+
+// loadSettings reads the settings from filename, if set, and the
+// environment, which overrides it
+func loadSettings(filename string) {
+	var err error
+	if cfg, err = config.Load(filename, settings...); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// reloadDefaultToken keeps the "default" token in step with SHUTDOWN_TOKEN
+// as the settings are reloaded
+func reloadDefaultToken(tokens *tokenStore) {
+	cfg.OnReload(func(changed []string) {
+		for _, name := range changed {
+			if name != "SHUTDOWN_TOKEN" {
+				continue
+			}
+			if secret := cfg.Get("SHUTDOWN_TOKEN"); secret != "" {
+				tokens.addDefault(secret)
+				log.Println("SHUTDOWN_TOKEN changed")
+			} else {
+				tokens.removeDefault()
+				log.Println("SHUTDOWN_TOKEN removed; only TOKENS_FILE tokens and client certificates are accepted")
+			}
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import "time"
+
+// systemStatus is the machine's state as reported by GET /status
+type systemStatus struct {
+	Uptime        string       `json:"uptime"`
+	UptimeSeconds float64      `json:"uptime_seconds"`
+	Load          [3]float64   `json:"load"` // 1, 5 and 15 minute averages
+	Memory        memoryStatus `json:"memory"`
+	Disks         []diskStatus `json:"disks"`
+	Power         []power      `json:"power,omitempty"` // UPSes and batteries, if any
+	Errors        []string     `json:"errors,omitempty"`
+}
+
+type memoryStatus struct {
+	TotalBytes     uint64  `json:"total_bytes"`
+	AvailableBytes uint64  `json:"available_bytes"`
+	UsedPercent    float64 `json:"used_percent"`
+}
+
+type diskStatus struct {
+	Path           string  `json:"path"`
+	TotalBytes     uint64  `json:"total_bytes"`
+	AvailableBytes uint64  `json:"available_bytes"`
+	UsedPercent    float64 `json:"used_percent"`
+}
+
+// readSystem gathers uptime, load, memory, the given disks and power state.
+// Whatever can't be read is left out and noted in Errors.
+func readSystem(disks []string) systemStatus {
+	var s systemStatus
+	fail := func(err error) { s.Errors = append(s.Errors, err.Error()) }
+
+	if up, err := uptime(); err != nil {
+		fail(err)
+	} else {
+		s.UptimeSeconds, s.Uptime = up.Seconds(), up.Truncate(time.Second).String()
+	}
+	var err error
+	if s.Load, err = loadAverages(); err != nil {
+		fail(err)
+	}
+	if s.Memory, err = memory(); err != nil {
+		fail(err)
+	}
+	s.Disks = []diskStatus{}
+	for _, path := range disks {
+		if d, err := disk(path); err != nil {
+			fail(err)
+		} else {
+			s.Disks = append(s.Disks, d)
+		}
+	}
+	s.Power, err = readPower()
+	if err != nil {
+		fail(err)
+	}
+	return s
+}
+
+// percent returns part as a percentage of whole, to one decimal place
+func percent(part, whole uint64) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part*1000/whole) / 10
+}
@@ -0,0 +1,112 @@
+//go:build !windows
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// defaultDisk is the filesystem /status reports if STATUS_DISKS isn't set
+const defaultDisk = "/"
+
+// triggerOpenFlags stop opening the trigger file following a symlink, or
+// waiting for a writer if it is a FIFO
+const triggerOpenFlags = syscall.O_NOFOLLOW | syscall.O_NONBLOCK
+
+// uptime reads how long the machine has been up from /proc/uptime
+func uptime() (time.Duration, error) {
+	data, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("empty /proc/uptime")
+	}
+	secs, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("reading /proc/uptime: %w", err)
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// loadAverages reads the 1, 5 and 15 minute load averages from /proc/loadavg
+func loadAverages() ([3]float64, error) {
+	var load [3]float64
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return load, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return load, fmt.Errorf("malformed /proc/loadavg")
+	}
+	for i := range load {
+		if load[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return load, fmt.Errorf("reading /proc/loadavg: %w", err)
+		}
+	}
+	return load, nil
+}
+
+// memory reads total and available memory from /proc/meminfo
+func memory() (memoryStatus, error) {
+	var m memoryStatus
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return m, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// e.g. "MemAvailable:   12345678 kB"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			m.TotalBytes = kb * 1024
+		case "MemAvailable:":
+			m.AvailableBytes = kb * 1024
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return m, err
+	}
+	if m.TotalBytes == 0 {
+		return m, fmt.Errorf("no MemTotal in /proc/meminfo")
+	}
+	m.UsedPercent = percent(m.TotalBytes-m.AvailableBytes, m.TotalBytes)
+	return m, nil
+}
+
+// disk reports the size and free space of the filesystem holding path
+func disk(path string) (diskStatus, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return diskStatus{}, fmt.Errorf("disk %s: %w", path, err)
+	}
+	// The field types differ between Linux, macOS and FreeBSD
+	bsize := uint64(fs.Bsize)
+	d := diskStatus{
+		Path:           path,
+		TotalBytes:     uint64(fs.Blocks) * bsize,
+		AvailableBytes: uint64(fs.Bavail) * bsize,
+	}
+	// Space reserved for root counts as used, as in df
+	used := (uint64(fs.Blocks) - uint64(fs.Bfree)) * bsize
+	d.UsedPercent = percent(used, used+d.AvailableBytes)
+	return d, nil
+}
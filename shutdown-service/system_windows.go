@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// defaultDisk is the filesystem /status reports if STATUS_DISKS isn't set
+const defaultDisk = `C:\`
+
+// triggerOpenFlags are none: the trigger file is checked once it is open
+const triggerOpenFlags = 0
+
+var (
+	kernel32                 = syscall.NewLazyDLL("kernel32.dll")
+	procGetTickCount64       = kernel32.NewProc("GetTickCount64")
+	procGlobalMemoryStatusEx = kernel32.NewProc("GlobalMemoryStatusEx")
+	procGetDiskFreeSpaceExW  = kernel32.NewProc("GetDiskFreeSpaceExW")
+)
+
+// uptime is the time since Windows started, from GetTickCount64
+func uptime() (time.Duration, error) {
+	ms, _, _ := procGetTickCount64.Call()
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// loadAverages fails: Windows keeps no load average
+func loadAverages() ([3]float64, error) {
+	return [3]float64{}, errors.New("Windows has no load average")
+}
+
+// memoryStatusEx is Windows' MEMORYSTATUSEX
+type memoryStatusEx struct {
+	Length               uint32
+	MemoryLoad           uint32
+	TotalPhys            uint64
+	AvailPhys            uint64
+	TotalPageFile        uint64
+	AvailPageFile        uint64
+	TotalVirtual         uint64
+	AvailVirtual         uint64
+	AvailExtendedVirtual uint64
+}
+
+// memory reads total and available memory with GlobalMemoryStatusEx
+func memory() (memoryStatus, error) {
+	ms := memoryStatusEx{}
+	ms.Length = uint32(unsafe.Sizeof(ms))
+	if ok, _, err := procGlobalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&ms))); ok == 0 {
+		return memoryStatus{}, fmt.Errorf("GlobalMemoryStatusEx: %w", err)
+	}
+	return memoryStatus{
+		TotalBytes:     ms.TotalPhys,
+		AvailableBytes: ms.AvailPhys,
+		UsedPercent:    percent(ms.TotalPhys-ms.AvailPhys, ms.TotalPhys),
+	}, nil
+}
+
+// disk reports the size and free space of the volume holding path
+func disk(path string) (diskStatus, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return diskStatus{}, fmt.Errorf("disk %s: %w", path, err)
+	}
+	var available, total, free uint64
+	ok, _, err := procGetDiskFreeSpaceExW.Call(uintptr(unsafe.Pointer(p)),
+		uintptr(unsafe.Pointer(&available)), uintptr(unsafe.Pointer(&total)), uintptr(unsafe.Pointer(&free)))
+	if ok == 0 {
+		return diskStatus{}, fmt.Errorf("disk %s: %w", path, err)
+	}
+	// Quotas can leave less available to us than is free
+	used := total - free
+	return diskStatus{
+		Path:           path,
+		TotalBytes:     total,
+		AvailableBytes: available,
+		UsedPercent:    percent(used, used+available),
+	}, nil
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oksmith/home-server/pkg/httpserver"
+)
+
+// Scopes a token can hold besides the action names. Every token can read
+// /status and open the control panel.
+const (
+	scopeAll   = "all"   // everything, as SHUTDOWN_TOKEN and client certificates can
+	scopeWake  = "wake"  // POST /wake
+	scopeHosts = "hosts" // GET /hosts and everything under /hosts/NAME/
+	scopeAdmin = "admin" // /tokens, /policy and /audit
+)
+
+// defaultTokenName is what SHUTDOWN_TOKEN is called in the audit log and /tokens
+const defaultTokenName = "default"
+
+var errTokenExists = errors.New("a token with that name already exists")
+
+// apiToken is a named token, saved in the tokens file by the SHA-256 of its
+// secret so the file can't be used to authenticate
+type apiToken struct {
+	Name    string     `json:"name"`
+	Hash    string     `json:"hash"` // hex SHA-256 of the secret
+	Scopes  []string   `json:"scopes"`
+	Created time.Time  `json:"created"`
+	Expires *time.Time `json:"expires,omitempty"`
+
+	fromEnv bool // SHUTDOWN_TOKEN, which isn't saved and can't be revoked
+}
+
+// allows reports whether the token grants scope, where "" is any valid token
+func (t *apiToken) allows(scope string) bool {
+	if scope == "" {
+		return true
+	}
+	for _, s := range t.Scopes {
+		if s == scope || s == scopeAll {
+			return true
+		}
+	}
+	return false
+}
+
+// expired reports whether the token's expiry date has passed
+func (t *apiToken) expired(now time.Time) bool {
+	return t.Expires != nil && !now.Before(*t.Expires)
+}
+
+// tokenStore holds the tokens requests may carry, saving changes to its file
+type tokenStore struct {
+	file   string // "" when only SHUTDOWN_TOKEN is in use
+	tokens map[string]*apiToken
+	mu     sync.Mutex
+}
+
+// loadTokens reads the tokens file, which needn't exist yet
+func loadTokens(file string) (*tokenStore, error) {
+	s := &tokenStore{file: file, tokens: make(map[string]*apiToken)}
+	if file == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []*apiToken
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("invalid tokens file %s: %w", file, err)
+	}
+	for _, t := range list {
+		if err := validScopes(t.Scopes); err != nil {
+			return nil, fmt.Errorf("token %s: %w", t.Name, err)
+		}
+		if _, dup := s.tokens[t.Name]; dup || t.Name == defaultTokenName {
+			return nil, fmt.Errorf("token %s: %w", t.Name, errTokenExists)
+		}
+		s.tokens[t.Name] = t
+	}
+	return s, nil
+}
+
+// addDefault accepts SHUTDOWN_TOKEN with every scope
+func (s *tokenStore) addDefault(secret string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[defaultTokenName] = &apiToken{Name: defaultTokenName, Hash: hashToken(secret),
+		Scopes: []string{scopeAll}, Created: time.Now().UTC().Truncate(time.Second), fromEnv: true}
+}
+
+// removeDefault stops accepting SHUTDOWN_TOKEN
+func (s *tokenStore) removeDefault() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, defaultTokenName)
+}
+
+// len returns how many tokens there are
+func (s *tokenStore) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.tokens)
+}
+
+// lookup returns a copy of the token with the given secret, expired or not
+func (s *tokenStore) lookup(secret string) (apiToken, bool) {
+	hash := []byte(hashToken(secret))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var found *apiToken
+	// Check every token in constant time so none can be guessed a byte at a time
+	for _, t := range s.tokens {
+		if subtle.ConstantTimeCompare(hash, []byte(t.Hash)) == 1 {
+			found = t
+		}
+	}
+	if found == nil {
+		return apiToken{}, false
+	}
+	return *found, true
+}
+
+// newSecret returns a random token
+func newSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// create adds a token and returns its secret, which isn't kept
+func (s *tokenStore) create(name string, scopes []string, expires *time.Time) (string, apiToken, error) {
+	secret, err := newSecret()
+	if err != nil {
+		return "", apiToken{}, err
+	}
+	t := &apiToken{Name: name, Hash: hashToken(secret), Scopes: scopes,
+		Created: time.Now().UTC().Truncate(time.Second), Expires: expires}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, dup := s.tokens[name]; dup {
+		return "", apiToken{}, errTokenExists
+	}
+	s.tokens[name] = t
+	if err := s.save(); err != nil {
+		delete(s.tokens, name)
+		return "", apiToken{}, err
+	}
+	return secret, *t, nil
+}
+
+// revoke removes a token, reporting whether there was one by that name
+func (s *tokenStore) revoke(name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[name]
+	if !ok {
+		return false, nil
+	}
+	if t.fromEnv {
+		return true, errors.New("the default token comes from SHUTDOWN_TOKEN; unset it to revoke it")
+	}
+	delete(s.tokens, name)
+	if err := s.save(); err != nil {
+		s.tokens[name] = t
+		return true, err
+	}
+	return true, nil
+}
+
+// save writes the tokens file, replacing it in one step. The caller holds mu.
+func (s *tokenStore) save() error {
+	list := make([]*apiToken, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		if !t.fromEnv {
+			list = append(list, t)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.file), ".tokens-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.file)
+}
+
+// hashToken returns the hex SHA-256 of a secret
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// validScopes checks a token is granted at least one known scope
+func validScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return errors.New("no scopes given")
+	}
+	for _, s := range scopes {
+		switch {
+		case s == scopeAll, s == scopeWake, s == scopeHosts, s == scopeAdmin, isAction(s):
+		default:
+			return fmt.Errorf("unknown scope %q", s)
+		}
+	}
+	return nil
+}
+
+// tokenInfo is a token as GET /tokens shows it, without its hash
+type tokenInfo struct {
+	Name    string     `json:"name"`
+	Scopes  []string   `json:"scopes"`
+	Created time.Time  `json:"created"`
+	Expires *time.Time `json:"expires,omitempty"`
+	Expired bool       `json:"expired,omitempty"`
+	Env     bool       `json:"env,omitempty"` // SHUTDOWN_TOKEN
+}
+
+// info describes the token as GET /tokens shows it
+func (t *apiToken) info(now time.Time) tokenInfo {
+	return tokenInfo{Name: t.Name, Scopes: t.Scopes, Created: t.Created, Expires: t.Expires,
+		Expired: t.expired(now), Env: t.fromEnv}
+}
+
+// tokensHandler lists the tokens at GET /tokens and creates one from
+// {"name", "scopes", "expires"} or {..., "expires_in"} at POST /tokens. The
+// new token's secret is only ever in that response.
+func tokensHandler(tokens *tokenStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			now := time.Now()
+			tokens.mu.Lock()
+			list := make([]tokenInfo, 0, len(tokens.tokens))
+			for _, t := range tokens.tokens {
+				list = append(list, t.info(now))
+			}
+			tokens.mu.Unlock()
+			sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+			httpserver.WriteJSON(w, http.StatusOK, list)
+
+		case http.MethodPost:
+			var req struct {
+				Name      string     `json:"name"`
+				Scopes    []string   `json:"scopes"`
+				Expires   *time.Time `json:"expires"`
+				ExpiresIn string     `json:"expires_in"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+				return
+			}
+			if req.Name == "" || strings.Contains(req.Name, "/") {
+				http.Error(w, "name must be set and have no slashes", http.StatusBadRequest)
+				return
+			}
+			if err := validScopes(req.Scopes); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if req.ExpiresIn != "" {
+				d, err := time.ParseDuration(req.ExpiresIn)
+				if err != nil || d <= 0 || req.Expires != nil {
+					http.Error(w, "expires_in must be a positive duration such as 720h, without expires", http.StatusBadRequest)
+					return
+				}
+				at := time.Now().Add(d).UTC().Truncate(time.Second)
+				req.Expires = &at
+			}
+			if req.Expires != nil && !req.Expires.After(time.Now()) {
+				http.Error(w, "expires must be in the future", http.StatusBadRequest)
+				return
+			}
+
+			secret, t, err := tokens.create(req.Name, req.Scopes, req.Expires)
+			if errors.Is(err, errTokenExists) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			if err != nil {
+				http.Error(w, "saving tokens failed: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			httpserver.WriteJSON(w, http.StatusCreated, struct {
+				tokenInfo
+				Token string `json:"token"`
+			}{t.info(time.Now()), secret})
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// revokeHandler deletes a token at DELETE /tokens/{name}
+func revokeHandler(tokens *tokenStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodDelete) {
+			return
+		}
+		name := r.PathValue("name")
+		found, err := tokens.revoke(name)
+		switch {
+		case !found:
+			http.Error(w, fmt.Sprintf("no token named %q", name), http.StatusNotFound)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("Revoked " + name))
+		}
+	}
+}
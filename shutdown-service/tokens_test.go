@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTokenAllows(t *testing.T) {
+	tests := []struct {
+		scopes []string
+		scope  string
+		want   bool
+	}{
+		{[]string{scopeWake}, "", true},
+		{[]string{scopeWake}, scopeWake, true},
+		{[]string{scopeWake}, scopeAdmin, false},
+		{[]string{scopeAll}, scopeAdmin, true},
+		{[]string{"shutdown", scopeHosts}, "shutdown", true},
+		{[]string{"shutdown"}, "reboot", false},
+	}
+	for _, tt := range tests {
+		tok := apiToken{Scopes: tt.scopes}
+		if got := tok.allows(tt.scope); got != tt.want {
+			t.Errorf("%v allows %q: got %v, want %v", tt.scopes, tt.scope, got, tt.want)
+		}
+	}
+}
+
+func TestTokenExpired(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Second), now.Add(time.Hour)
+	tests := []struct {
+		expires *time.Time
+		want    bool
+	}{
+		{nil, false},
+		{&future, false},
+		{&now, true},
+		{&past, true},
+	}
+	for _, tt := range tests {
+		tok := apiToken{Expires: tt.expires}
+		if got := tok.expired(now); got != tt.want {
+			t.Errorf("expires %v: got %v, want %v", tt.expires, got, tt.want)
+		}
+	}
+}
+
+func TestTokenStore(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tokens.json")
+	s, err := loadTokens(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.addDefault("env-secret")
+	secret, created, err := s.create("phone", []string{scopeWake}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.create("phone", []string{scopeWake}, nil); !errors.Is(err, errTokenExists) {
+		t.Errorf("expected a second token named phone to be refused, got %v", err)
+	}
+
+	tests := []struct {
+		secret string
+		name   string
+		found  bool
+	}{
+		{secret, "phone", true},
+		{"env-secret", defaultTokenName, true},
+		{"wrong", "", false},
+		{"", "", false},
+		{created.Hash, "", false},
+	}
+	for _, tt := range tests {
+		got, found := s.lookup(tt.secret)
+		if found != tt.found || got.Name != tt.name {
+			t.Errorf("lookup %q: got %q, %v, want %q, %v", tt.secret, got.Name, found, tt.name, tt.found)
+		}
+	}
+
+	// Tokens are saved, without SHUTDOWN_TOKEN, and read back
+	reloaded, err := loadTokens(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := reloaded.lookup(secret); !found || reloaded.len() != 1 {
+		t.Errorf("expected only phone saved, got %d tokens", reloaded.len())
+	}
+
+	if found, err := s.revoke("phone"); !found || err != nil {
+		t.Errorf("revoking phone: %v, %v", found, err)
+	}
+	if _, found := s.lookup(secret); found {
+		t.Error("expected a revoked token to be refused")
+	}
+	if found, _ := s.revoke("phone"); found {
+		t.Error("expected revoking phone twice to find nothing")
+	}
+	if found, err := s.revoke(defaultTokenName); !found || err == nil {
+		t.Error("expected SHUTDOWN_TOKEN not to be revocable")
+	}
+	if reloaded, _ := loadTokens(file); reloaded.len() != 0 {
+		t.Errorf("expected the revocation saved, got %d tokens", reloaded.len())
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	s, err := loadTokens("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := time.Now().Add(-time.Hour)
+	s.tokens["phone"] = &apiToken{Name: "phone", Hash: hashToken("phone-secret"), Scopes: []string{scopeWake}}
+	s.tokens["old"] = &apiToken{Name: "old", Hash: hashToken("old-secret"), Scopes: []string{scopeAll}, Expires: &expired}
+	s.tokens["admin"] = &apiToken{Name: "admin", Hash: hashToken("admin-secret"), Scopes: []string{scopeAll}}
+
+	tests := []struct {
+		name   string
+		auth   string
+		scope  string
+		status int
+	}{
+		{"missing", "", scopeWake, http.StatusUnauthorized},
+		{"wrong", "Bearer nope", scopeWake, http.StatusUnauthorized},
+		{"expired", "Bearer old-secret", scopeWake, http.StatusUnauthorized},
+		{"scoped", "Bearer phone-secret", scopeWake, http.StatusOK},
+		{"any token", "Bearer phone-secret", "", http.StatusOK},
+		{"other scope", "Bearer phone-secret", scopeAdmin, http.StatusForbidden},
+		{"all", "Bearer admin-secret", scopeAdmin, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := requireToken(s, nil, tt.scope, nil, nil, func(w http.ResponseWriter, r *http.Request) {})
+			r := httptest.NewRequest("POST", "/wake", nil)
+			if tt.auth != "" {
+				r.Header.Set("Authorization", tt.auth)
+			}
+			w := httptest.NewRecorder()
+			h(w, r)
+			if w.Code != tt.status {
+				t.Errorf("got %d, want %d", w.Code, tt.status)
+			}
+			if tt.auth == "" && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected a request without a token to be asked for one")
+			}
+		})
+	}
+}
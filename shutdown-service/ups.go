@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oksmith/home-server/pkg/notify"
+)
+
+// upsPollInterval is how often the UPS monitor reads the UPS
+const upsPollInterval = 15 * time.Second
+
+// upsMonitor shuts the machine down when its UPS runs low on battery. It
+// schedules the shutdown a grace period ahead, so it shows in /status and
+// can still be cancelled, and calls it off if mains power comes back.
+type upsMonitor struct {
+	read      func() (power, error)
+	source    string  // apcupsd or nut:UPS@HOST
+	below     float64 // charge percent that triggers the shutdown
+	grace     time.Duration
+	notifyURL string
+	sched     *scheduler
+	audit     *auditLog
+	events    *notify.Client
+
+	pending   *pendingAction // the shutdown this monitor scheduled
+	onBattery bool
+}
+
+// newUPSMonitor reads the UPS monitor settings from the environment, returning
+// nil unless UPS_MONITOR is set to "apcupsd" or "nut:UPS@HOST"
+func newUPSMonitor(sched *scheduler, audit *auditLog, events *notify.Client) (*upsMonitor, error) {
+	source := cfg.Get("UPS_MONITOR")
+	if source == "" {
+		return nil, nil
+	}
+	m := &upsMonitor{source: source, below: 30, grace: time.Minute, sched: sched, audit: audit,
+		events: events, notifyURL: cfg.Get("UPS_NOTIFY_URL")}
+
+	switch {
+	case source == "apcupsd":
+		m.read = func() (power, error) {
+			out, err := runTool("apcaccess", "status")
+			if err != nil {
+				return power{}, fmt.Errorf("apcaccess: %w", err)
+			}
+			return parseApcaccess(out), nil
+		}
+	case strings.HasPrefix(source, "nut:"):
+		ups := strings.TrimPrefix(source, "nut:")
+		m.read = func() (power, error) {
+			out, err := runTool("upsc", ups)
+			if err != nil {
+				return power{}, fmt.Errorf("upsc: %w", err)
+			}
+			return parseUpsc(ups, out), nil
+		}
+	default:
+		return nil, fmt.Errorf("UPS_MONITOR must be apcupsd or nut:UPS@HOST, not %q", source)
+	}
+
+	var err error
+	if s := cfg.Get("UPS_SHUTDOWN_BELOW"); s != "" {
+		if m.below, err = strconv.ParseFloat(s, 64); err != nil || m.below < 0 || m.below > 100 {
+			return nil, fmt.Errorf("UPS_SHUTDOWN_BELOW must be a percentage, not %q", s)
+		}
+	}
+	if s := cfg.Get("UPS_SHUTDOWN_GRACE"); s != "" {
+		if m.grace, err = time.ParseDuration(s); err != nil || m.grace < 0 {
+			return nil, fmt.Errorf("UPS_SHUTDOWN_GRACE must be a duration such as 1m, not %q", s)
+		}
+	}
+	return m, nil
+}
+
+// parseUpsc reads the output of NUT's upsc, with lines such as
+// "ups.status: OB LB", "battery.charge: 64" and "battery.runtime: 750"
+func parseUpsc(name, out string) power {
+	kv := keyValues(out)
+	return power{
+		Source:         "nut",
+		Name:           name,
+		Status:         kv["ups.status"],
+		ChargePercent:  leadingNumber(kv["battery.charge"]),
+		RuntimeMinutes: leadingNumber(kv["battery.runtime"]) / 60,
+		OnBattery:      slices.Contains(strings.Fields(kv["ups.status"]), "OB"),
+	}
+}
+
+// lowBattery reports whether the UPS itself says its battery is low
+func lowBattery(p power) bool {
+	flags := strings.Fields(p.Status)
+	return slices.Contains(flags, "LB") || slices.Contains(flags, "LOWBATT")
+}
+
+// watch polls the UPS until the service exits
+func (m *upsMonitor) watch() {
+	for ; ; time.Sleep(upsPollInterval) {
+		p, err := m.read()
+		if err != nil {
+			log.Printf("ups: %v", err)
+			continue
+		}
+		m.check(p)
+	}
+}
+
+// check acts on one reading of the UPS
+func (m *upsMonitor) check(p power) {
+	if p.OnBattery != m.onBattery {
+		m.onBattery = p.OnBattery
+		if p.OnBattery {
+			m.notify("on_battery", p, fmt.Sprintf("UPS %s is on battery at %.0f%%", m.source, p.ChargePercent))
+		} else {
+			m.notify("on_mains", p, fmt.Sprintf("UPS %s is back on mains power", m.source))
+		}
+	}
+
+	if !p.OnBattery {
+		if m.pending != nil {
+			if m.sched.cancelPending(*m.pending) {
+				m.notify("shutdown_cancelled", p, "power is back, cancelled the UPS shutdown")
+			}
+			m.pending = nil
+		}
+		return
+	}
+	if m.pending != nil || (p.ChargePercent >= m.below && !lowBattery(p)) {
+		return
+	}
+
+	reason := fmt.Sprintf("UPS %s on battery at %.0f%%", m.source, p.ChargePercent)
+	pending := m.sched.schedule("shutdown", time.Now().Add(m.grace), "", nil, false, reason)
+	m.pending = &pending
+	m.notify("shutdown_scheduled", p, fmt.Sprintf("UPS %s battery at %.0f%%, shutting down at %s",
+		m.source, p.ChargePercent, pending.At.Format(time.RFC3339)))
+}
+
+// upsEvent is POSTed to UPS_NOTIFY_URL
+type upsEvent struct {
+	Event   string    `json:"event"` // on_battery, on_mains, shutdown_scheduled or shutdown_cancelled
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+	UPS     power     `json:"ups"`
+}
+
+// notify logs an event, audits it, sends it to the notification hub and POSTs
+// it to the notify URL, if there is one
+func (m *upsMonitor) notify(event string, p power, message string) {
+	log.Printf("ups: %s", message)
+	m.audit.record(auditEntry{Time: time.Now(), Source: "ups", Action: event})
+	priority := notify.Normal
+	if event == "on_battery" || event == "shutdown_scheduled" {
+		priority = notify.High
+	}
+	m.events.Send(notify.Message{Event: "ups_" + event, Priority: priority, Title: "UPS " + strings.ReplaceAll(event, "_", " "),
+		Text: message, Fields: map[string]string{"ups": m.source, "charge": fmt.Sprintf("%.0f", p.ChargePercent)}})
+	if m.notifyURL == "" {
+		return
+	}
+
+	body, err := json.Marshal(upsEvent{Event: event, Message: message, Time: time.Now(), UPS: p})
+	if err != nil {
+		log.Printf("ups: %v", err)
+		return
+	}
+	client := &http.Client{Timeout: hostTimeout}
+	resp, err := client.Post(m.notifyURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("ups: notifying %s failed: %v", m.notifyURL, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("ups: notifying %s failed: %s", m.notifyURL, resp.Status)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// wallTimeout bounds wall, which can hang on a stuck terminal
+const wallTimeout = 5 * time.Second
+
+// maxReason caps the length of a reason given for an action
+const maxReason = 200
+
+// announcer tells everyone logged in to the machine about power actions with
+// wall. A nil announcer says nothing.
+type announcer struct {
+	path string
+}
+
+// newAnnouncer finds wall, unless WALL=false turns announcements off
+func newAnnouncer() (*announcer, error) {
+	if s := cfg.Get("WALL"); s != "" {
+		on, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, err
+		}
+		if !on {
+			return nil, nil
+		}
+	}
+	path, err := exec.LookPath("wall")
+	if err != nil {
+		log.Println("wall isn't installed, so logged-in users won't be told about actions")
+		return nil, nil
+	}
+	return &announcer{path: path}, nil
+}
+
+// announce broadcasts an event and its reason, only logging it for a dry run
+func (a *announcer) announce(e event, dryRun bool) {
+	if a == nil {
+		return
+	}
+	if dryRun {
+		log.Printf("dry run: would announce %q", e.text())
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), wallTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, a.path)
+	cmd.Stdin = strings.NewReader("shutdown-service: " + e.text() + "\n")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		log.Printf("wall failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+}
+
+// cleanReason turns a reason's control characters and runs of spaces into
+// single spaces, so it can't forge extra lines in wall messages or logs
+func cleanReason(s string) (string, bool) {
+	s = strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	}), " ")
+	return s, len(s) <= maxReason
+}
@@ -0,0 +1,172 @@
+// Command supervisor runs the home-server's services on machines without
+// systemd, such as containers and the BSDs. It starts each service once the
+// ones it depends on are healthy, checks their health, restarts any that
+// exit or stop answering, and stops them in reverse order when it is stopped
+// itself.
+//
+// SERVICES_FILE is a JSON list of services; see supervise.Parse for the
+// format. Each is a command, run without a shell in a process group of its
+// own, with the supervisor's environment, less CONFIG_FILE and the
+// supervisor's own settings, plus any it sets. A service with a health URL
+// counts as healthy once that answers 2xx, checked every health_interval
+// (default 10s); it is restarted if it doesn't within start_timeout
+// (default 1m), or later fails health_failures checks in a row (default 3).
+// One without counts as healthy once started. A service that exits is
+// started again after a backoff of 1s, doubling up to a minute and starting
+// over once it has stayed healthy for 5 minutes, unless its restart policy
+// is on-failure and it exited cleanly, or never. Services that depend on a
+// restarted one are left running. Stopping a service sends SIGTERM to its
+// process group, and SIGKILL after stop_timeout (default 10s). Services'
+// output is written to the supervisor's, each line prefixed with its name.
+//
+// GET /api/v1/services lists the services in start order with their state,
+// process ID, restarts and last exit, and GET /api/v1/services/NAME gives
+// one. POST /api/v1/services/NAME/stop, start or restart acts on one; a
+// service stopped by hand stays stopped until started again.
+//
+// Otherwise it serves as package httpserver describes, on LISTEN_ADDR
+// (default :8101) with SUPERVISOR_TOKEN as its token. SIGINT or SIGTERM
+// stops the services before the supervisor.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/oksmith/home-server/pkg/config"
+	"github.com/oksmith/home-server/pkg/httpserver"
+	"github.com/oksmith/home-server/pkg/sigauth"
+	"github.com/oksmith/home-server/supervisor/supervise"
+)
+
+// settings are the supervisor's settings
+var settings = []config.Field{
+	{Name: "SERVICES_FILE", Required: true},
+	{Name: "LISTEN_ADDR", Default: ":8101", Check: config.HostPort},
+	{Name: "SUPERVISOR_TOKEN", Secret: true, Reload: true},
+	{Name: "TLS_CERT"},
+	{Name: "TLS_KEY"},
+	{Name: "AUTHORIZED_KEYS"},
+}
+
+// childEnv returns the supervisor's environment without the settings meant
+// for it, which the services would otherwise pick up as their own
+func childEnv() []string {
+	own := map[string]bool{"CONFIG_FILE": true}
+	for _, f := range settings {
+		own[f.Name] = true
+	}
+	return slices.DeleteFunc(os.Environ(), func(kv string) bool {
+		name, _, _ := strings.Cut(kv, "=")
+		return own[name]
+	})
+}
+
+// actionHandler starts, stops or restarts a service
+func actionHandler(s *supervise.Supervisor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		var err error
+		switch r.PathValue("action") {
+		case "start":
+			err = s.Start(name)
+		case "stop":
+			err = s.Stop(name)
+		case "restart":
+			err = s.Restart(name)
+		default:
+			http.Error(w, "action must be start, stop or restart", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, supervise.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("%s %s requested by %s", r.PathValue("action"), name, r.RemoteAddr)
+		st, _ := s.Status(name)
+		httpserver.WriteJSON(w, http.StatusAccepted, st)
+	}
+}
+
+func main() {
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"), settings...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	data, err := os.ReadFile(cfg.Get("SERVICES_FILE"))
+	if err != nil {
+		log.Fatalf("SERVICES_FILE: %v", err)
+	}
+	services, err := supervise.Parse(data)
+	if err != nil {
+		log.Fatalf("SERVICES_FILE: %v", err)
+	}
+	sup := supervise.NewSupervisor(services, childEnv(), os.Stdout)
+	addr := cfg.Get("LISTEN_ADDR")
+
+	keys, err := sigauth.LoadKeyring(cfg.Get("AUTHORIZED_KEYS"))
+	if err != nil {
+		log.Fatalf("AUTHORIZED_KEYS: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go cfg.Watch(ctx, config.DefaultPoll)
+	supervised := make(chan struct{})
+	go func() {
+		sup.Run(ctx)
+		close(supervised)
+	}()
+
+	token := func() string { return cfg.Get("SUPERVISOR_TOKEN") }
+	g := httpserver.NewGuard(httpserver.DefaultLimits)
+	auth := func(next http.HandlerFunc) http.Handler {
+		return httpserver.RequireAuth("supervisor", token, keys, g, next)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.Handle("GET /api/v1/services", auth(func(w http.ResponseWriter, r *http.Request) {
+		httpserver.WriteJSON(w, http.StatusOK, sup.Statuses())
+	}))
+	mux.Handle("GET /api/v1/services/{name}", auth(func(w http.ResponseWriter, r *http.Request) {
+		st, err := sup.Status(r.PathValue("name"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		httpserver.WriteJSON(w, http.StatusOK, st)
+	}))
+	mux.Handle("POST /api/v1/services/{name}/{action}", auth(actionHandler(sup)))
+	metrics := httpserver.NewMetrics()
+	server := &http.Server{Addr: addr, Handler: g.Middleware(httpserver.InstrumentMux(metrics, slog.Default(), mux))}
+
+	certFile, keyFile := cfg.Get("TLS_CERT"), cfg.Get("TLS_KEY")
+	switch {
+	case certFile == "" && keyFile == "":
+		log.Printf("supervisor starting on %s with %d services", addr, len(services))
+	case certFile == "" || keyFile == "":
+		log.Fatal("TLS_CERT and TLS_KEY must be set together")
+	default:
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		log.Printf("supervisor starting on %s with TLS and %d services", addr, len(services))
+	}
+	if err := httpserver.ListenAndServe(ctx, server, certFile, keyFile); err != nil {
+		// Don't leave the services behind without a supervisor
+		stop()
+		<-supervised
+		log.Fatal(err)
+	}
+	<-supervised
+	log.Println("supervisor stopped")
+}
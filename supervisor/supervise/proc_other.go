@@ -0,0 +1,24 @@
+//go:build !unix
+
+package supervise
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// procAttr leaves a service in the supervisor's process group
+func procAttr() *syscall.SysProcAttr {
+	return nil
+}
+
+// interrupt can't ask a process to exit cleanly here, since there is no
+// SIGTERM, so it ends the process straight away
+func interrupt(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+// kill ends a service's process
+func kill(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package supervise
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// procAttr starts a service in a process group of its own, so stopping it
+// reaches any children it started too
+func procAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
+
+// interrupt asks a service's process group to exit
+func interrupt(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
+
+// kill ends a service's process group
+func kill(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,160 @@
+// Package supervise runs a set of services as child processes: it starts
+// them in dependency order, checks their health, restarts those that exit or
+// stop answering with a growing backoff, and stops them in reverse order
+package supervise
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Defaults for a service's settings
+const (
+	DefaultHealthInterval = 10 * time.Second
+	DefaultHealthFailures = 3
+	DefaultStartTimeout   = time.Minute
+	DefaultStopTimeout    = 10 * time.Second
+)
+
+// Restart policies
+const (
+	Always    = "always"     // restart whenever the service exits
+	OnFailure = "on-failure" // restart unless it exits with status 0
+	Never     = "never"
+)
+
+// Spec is a service as the services file gives it
+type Spec struct {
+	Name           string            `json:"name"`
+	Command        []string          `json:"command"` // a program and its arguments, run without a shell
+	Dir            string            `json:"dir,omitempty"`
+	Env            map[string]string `json:"env,omitempty"`        // added to the supervisor's environment
+	DependsOn      []string          `json:"depends_on,omitempty"` // services that must be healthy before this one starts
+	Health         string            `json:"health,omitempty"`     // a URL answering 2xx once the service is ready; without one, it is ready once started
+	HealthInterval string            `json:"health_interval,omitempty"`
+	HealthFailures int               `json:"health_failures,omitempty"` // failed checks in a row before it is restarted
+	StartTimeout   string            `json:"start_timeout,omitempty"`   // to pass its first health check
+	StopTimeout    string            `json:"stop_timeout,omitempty"`    // after SIGTERM before it is killed
+	Restart        string            `json:"restart,omitempty"`         // Always unless set
+}
+
+// Service is a checked Spec
+type Service struct {
+	Spec
+	healthInterval time.Duration
+	startTimeout   time.Duration
+	stopTimeout    time.Duration
+}
+
+// New checks a spec and returns its service
+func New(spec Spec) (*Service, error) {
+	s := &Service{Spec: spec, healthInterval: DefaultHealthInterval, startTimeout: DefaultStartTimeout, stopTimeout: DefaultStopTimeout}
+	if spec.Name == "" || strings.ContainsAny(spec.Name, "/ ") {
+		return nil, fmt.Errorf("service %q needs a name without slashes or spaces", spec.Name)
+	}
+	if len(spec.Command) == 0 || spec.Command[0] == "" {
+		return nil, fmt.Errorf("service %s needs a command to run", spec.Name)
+	}
+	for _, d := range []struct {
+		name  string
+		value string
+		into  *time.Duration
+	}{
+		{"health_interval", spec.HealthInterval, &s.healthInterval},
+		{"start_timeout", spec.StartTimeout, &s.startTimeout},
+		{"stop_timeout", spec.StopTimeout, &s.stopTimeout},
+	} {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("service %s: %s must be a positive duration such as 30s, not %q", spec.Name, d.name, d.value)
+		}
+		*d.into = v
+	}
+	if spec.HealthFailures < 0 {
+		return nil, fmt.Errorf("service %s: health_failures must not be negative", spec.Name)
+	}
+	if spec.HealthFailures == 0 {
+		s.HealthFailures = DefaultHealthFailures
+	}
+	if spec.Health != "" {
+		u, err := url.Parse(spec.Health)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("service %s: health must be an http:// or https:// URL, not %q", spec.Name, spec.Health)
+		}
+	}
+	switch spec.Restart {
+	case "":
+		s.Restart = Always
+	case Always, OnFailure, Never:
+	default:
+		return nil, fmt.Errorf("service %s: restart must be %s, %s or %s", spec.Name, Always, OnFailure, Never)
+	}
+	return s, nil
+}
+
+// Parse reads a JSON list of services, such as
+//
+//	[{"name": "node", "command": ["/usr/local/bin/node", "-datadir", "/var/lib/node"],
+//	  "health": "http://localhost:8080/api/v1/status"},
+//	 {"name": "shutdown-service", "command": ["/usr/local/bin/shutdown-service"],
+//	  "env": {"CONFIG_FILE": "/etc/shutdown-service.env"}, "health": "http://localhost:8081/healthz"},
+//	 {"name": "dashboard", "command": ["/usr/local/bin/dashboard"],
+//	  "depends_on": ["node", "shutdown-service"], "health": "http://localhost:8090/healthz"}]
+//
+// and returns the services in an order that starts each after those it
+// depends on, keeping the file's order otherwise. Dependencies must be
+// listed and may not go round in a circle.
+func Parse(data []byte) ([]*Service, error) {
+	var specs []Spec
+	if err := json.Unmarshal(data, &specs); err != nil {
+		return nil, err
+	}
+	byName := map[string]*Service{}
+	var services []*Service
+	for _, spec := range specs {
+		s, err := New(spec)
+		if err != nil {
+			return nil, err
+		}
+		if byName[s.Name] != nil {
+			return nil, fmt.Errorf("service %s is listed twice", s.Name)
+		}
+		byName[s.Name] = s
+		services = append(services, s)
+	}
+	for _, s := range services {
+		for _, dep := range s.DependsOn {
+			if byName[dep] == nil {
+				return nil, fmt.Errorf("service %s depends on %s, which isn't listed", s.Name, dep)
+			}
+		}
+	}
+
+	// Repeatedly take the first service whose dependencies are all placed
+	var ordered []*Service
+	placed := map[string]bool{}
+	for len(ordered) < len(services) {
+		next := slices.IndexFunc(services, func(s *Service) bool {
+			return !placed[s.Name] && !slices.ContainsFunc(s.DependsOn, func(dep string) bool { return !placed[dep] })
+		})
+		if next < 0 {
+			var stuck []string
+			for _, s := range services {
+				if !placed[s.Name] {
+					stuck = append(stuck, s.Name)
+				}
+			}
+			return nil, fmt.Errorf("services %s depend on each other in a circle", strings.Join(stuck, ", "))
+		}
+		placed[services[next].Name] = true
+		ordered = append(ordered, services[next])
+	}
+	return ordered, nil
+}
@@ -0,0 +1,50 @@
+package supervise
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	services, err := Parse([]byte(`[
+		{"name": "dashboard", "command": ["dashboard"], "depends_on": ["node", "shutdown-service"]},
+		{"name": "node", "command": ["node"], "health": "http://localhost:8080/api/v1/status", "restart": "on-failure"},
+		{"name": "shutdown-service", "command": ["shutdown-service"], "health_interval": "2s"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range services {
+		names = append(names, s.Name)
+	}
+	if got := strings.Join(names, " "); got != "node shutdown-service dashboard" {
+		t.Errorf("expected dependencies first, got %s", got)
+	}
+	if s := services[2]; s.Restart != Always || s.HealthFailures != DefaultHealthFailures || s.stopTimeout != DefaultStopTimeout {
+		t.Errorf("expected defaults, got %+v", s)
+	}
+	if s := services[1]; s.healthInterval.Seconds() != 2 {
+		t.Errorf("got %+v", s)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name, data, want string
+	}{
+		{"no command", `[{"name": "a"}]`, "needs a command"},
+		{"bad name", `[{"name": "a b", "command": ["x"]}]`, "without slashes"},
+		{"twice", `[{"name": "a", "command": ["x"]}, {"name": "a", "command": ["y"]}]`, "listed twice"},
+		{"unknown dependency", `[{"name": "a", "command": ["x"], "depends_on": ["b"]}]`, "isn't listed"},
+		{"circle", `[{"name": "a", "command": ["x"], "depends_on": ["b"]}, {"name": "b", "command": ["x"], "depends_on": ["a"]}, {"name": "c", "command": ["x"]}]`, "services a, b depend on each other"},
+		{"bad health", `[{"name": "a", "command": ["x"], "health": "localhost:80"}]`, "health must be"},
+		{"bad duration", `[{"name": "a", "command": ["x"], "stop_timeout": "soon"}]`, "stop_timeout"},
+		{"bad restart", `[{"name": "a", "command": ["x"], "restart": "sometimes"}]`, "restart must be"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tc.data)); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("expected an error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,509 @@
+package supervise
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"os/exec"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Defaults for restarting a service that exits
+const (
+	DefaultMinBackoff = time.Second
+	DefaultMaxBackoff = time.Minute
+	// DefaultResetAfter is how long a service must stay healthy for its
+	// backoff to start again from the minimum
+	DefaultResetAfter = 5 * time.Minute
+	// maxHealthTimeout bounds each health check
+	maxHealthTimeout = 5 * time.Second
+)
+
+// States of a service
+const (
+	Stopped  = "stopped"  // not running, as asked
+	Waiting  = "waiting"  // for the services it depends on to be healthy
+	Starting = "starting" // running but not yet healthy
+	Running  = "running"  // running and healthy
+	Stopping = "stopping" // asked to exit
+	Backoff  = "backoff"  // exited, and waiting to be started again
+	Exited   = "exited"   // exited cleanly, and its restart policy leaves it so
+	Failed   = "failed"   // exited with an error, and its restart policy leaves it so
+)
+
+// ErrNotFound is returned for a service that isn't supervised
+var ErrNotFound = errors.New("no such service")
+
+// Status is how a service is doing
+type Status struct {
+	Name       string     `json:"name"`
+	State      string     `json:"state"`
+	Since      time.Time  `json:"since"` // when it entered the state
+	PID        int        `json:"pid,omitempty"`
+	Restarts   int        `json:"restarts"`
+	LastExit   string     `json:"last_exit,omitempty"` // why it last stopped
+	LastExitAt *time.Time `json:"last_exit_at,omitempty"`
+	NextStart  *time.Time `json:"next_start,omitempty"` // while in Backoff
+	DependsOn  []string   `json:"depends_on,omitempty"`
+}
+
+// entry is a supervised service and what is known of it
+type entry struct {
+	*Service
+	status  Status
+	want    bool // whether it should be running
+	restart bool // stop it and start it again straight away
+}
+
+// Supervisor runs services and keeps them running
+type Supervisor struct {
+	// MinBackoff is how long to wait before restarting a service the first
+	// time, doubling each time up to MaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// ResetAfter is how long a service must stay healthy for its backoff to
+	// start again from MinBackoff
+	ResetAfter time.Duration
+
+	entries []*entry
+	env     []string
+	output  *lineWriter
+	client  *http.Client
+	mu      sync.Mutex
+	changed chan struct{} // closed and replaced whenever an entry changes
+}
+
+// NewSupervisor returns a Supervisor for services, in the order Parse gives
+// them, started with env as their environment along with their own, and
+// writing their output to w a line at a time, each prefixed with the
+// service's name
+func NewSupervisor(services []*Service, env []string, w io.Writer) *Supervisor {
+	s := &Supervisor{
+		MinBackoff: DefaultMinBackoff,
+		MaxBackoff: DefaultMaxBackoff,
+		ResetAfter: DefaultResetAfter,
+		env:        env,
+		output:     &lineWriter{w: w},
+		client:     &http.Client{},
+		changed:    make(chan struct{}),
+	}
+	for _, svc := range services {
+		s.entries = append(s.entries, &entry{Service: svc, status: Status{Name: svc.Name, State: Stopped, Since: time.Now(), DependsOn: svc.DependsOn}})
+	}
+	return s
+}
+
+// Run starts every service and keeps them running until ctx is done, then
+// stops them in the reverse of the order they were started in
+func (s *Supervisor) Run(ctx context.Context) {
+	inner, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	s.mu.Lock()
+	for _, e := range s.entries {
+		e.want = true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.loop(inner, e)
+		}()
+	}
+	s.notify()
+	s.mu.Unlock()
+
+	<-ctx.Done()
+	for _, e := range slices.Backward(s.entries) {
+		s.Stop(e.Name)
+		s.waitUntil(e, func(st Status) bool { return st.State == Stopped || st.State == Exited || st.State == Failed })
+	}
+	cancel()
+	wg.Wait()
+}
+
+// Start has a stopped service started, once the services it depends on are healthy
+func (s *Supervisor) Start(name string) error {
+	return s.change(name, func(e *entry) { e.want = true })
+}
+
+// Stop has a service stopped, leaving the services that depend on it running
+func (s *Supervisor) Stop(name string) error {
+	return s.change(name, func(e *entry) { e.want, e.restart = false, false })
+}
+
+// Restart has a service stopped and started again straight away, or started
+// if it isn't running
+func (s *Supervisor) Restart(name string) error {
+	return s.change(name, func(e *entry) {
+		e.restart = e.want
+		e.want = true
+	})
+}
+
+// change alters an entry and wakes whatever is waiting on it
+func (s *Supervisor) change(name string, f func(*entry)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.find(name)
+	if e == nil {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	f(e)
+	s.notify()
+	return nil
+}
+
+// Status returns how a service is doing
+func (s *Supervisor) Status(name string) (Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.find(name)
+	if e == nil {
+		return Status{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return e.status, nil
+}
+
+// Statuses returns how every service is doing, in the order they start in
+func (s *Supervisor) Statuses() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Status, 0, len(s.entries))
+	for _, e := range s.entries {
+		list = append(list, e.status)
+	}
+	return list
+}
+
+// find returns the entry for a service, or nil. Callers must hold s.mu.
+func (s *Supervisor) find(name string) *entry {
+	for _, e := range s.entries {
+		if e.Name == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// notify wakes everything waiting for a change. Callers must hold s.mu.
+func (s *Supervisor) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// set moves an entry to a state. Callers must hold s.mu.
+func (s *Supervisor) set(e *entry, state string) {
+	if e.status.State == state {
+		return
+	}
+	e.status.State, e.status.Since = state, time.Now()
+	log.Printf("%s is %s", e.Name, state)
+	s.notify()
+}
+
+// waitUntil blocks until an entry's status satisfies done
+func (s *Supervisor) waitUntil(e *entry, done func(Status) bool) {
+	for {
+		s.mu.Lock()
+		ok, ch := done(e.status), s.changed
+		s.mu.Unlock()
+		if ok {
+			return
+		}
+		<-ch
+	}
+}
+
+// loop runs a service for as long as it is wanted, until ctx is done
+func (s *Supervisor) loop(ctx context.Context, e *entry) {
+	var backoff time.Duration
+	for {
+		if !s.await(ctx, e) {
+			return
+		}
+		healthy, exit, clean := s.runOnce(ctx, e)
+		if ctx.Err() != nil {
+			return
+		}
+
+		s.mu.Lock()
+		now := time.Now()
+		e.status.PID, e.status.LastExit, e.status.LastExitAt = 0, exit, &now
+		log.Printf("%s stopped: %s", e.Name, exit)
+		switch {
+		case e.restart:
+			e.restart = false
+			e.status.Restarts++
+			backoff = 0
+			s.notify()
+			s.mu.Unlock()
+			continue
+		case !e.want:
+			s.set(e, Stopped)
+			s.mu.Unlock()
+			continue
+		case e.Restart == Never || (e.Restart == OnFailure && clean):
+			e.want = false
+			if clean {
+				s.set(e, Exited)
+			} else {
+				s.set(e, Failed)
+			}
+			s.mu.Unlock()
+			continue
+		}
+		if healthy >= s.ResetAfter {
+			backoff = 0
+		}
+		backoff = min(max(2*backoff, s.MinBackoff), s.MaxBackoff)
+		next := now.Add(backoff)
+		e.status.NextStart = &next
+		s.set(e, Backoff)
+		s.mu.Unlock()
+
+		s.sleep(ctx, e, backoff)
+		s.mu.Lock()
+		if e.want {
+			e.status.Restarts++
+		}
+		e.restart, e.status.NextStart = false, nil
+		s.mu.Unlock()
+	}
+}
+
+// await waits until an entry is wanted and the services it depends on are
+// healthy, reporting false if ctx is done first
+func (s *Supervisor) await(ctx context.Context, e *entry) bool {
+	for {
+		s.mu.Lock()
+		ready := e.want && s.dependenciesReady(e)
+		switch {
+		case ready:
+		case e.want:
+			s.set(e, Waiting)
+		case e.status.State != Exited && e.status.State != Failed:
+			s.set(e, Stopped)
+		}
+		ch := s.changed
+		s.mu.Unlock()
+		if ready {
+			return true
+		}
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// dependenciesReady reports whether everything e depends on is healthy.
+// Callers must hold s.mu.
+func (s *Supervisor) dependenciesReady(e *entry) bool {
+	for _, dep := range e.DependsOn {
+		if d := s.find(dep); d == nil || d.status.State != Running {
+			return false
+		}
+	}
+	return true
+}
+
+// sleep waits out a backoff, ending early if the entry is stopped or
+// restarted or ctx is done
+func (s *Supervisor) sleep(ctx context.Context, e *entry, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	for {
+		s.mu.Lock()
+		interrupted, ch := !e.want || e.restart, s.changed
+		s.mu.Unlock()
+		if interrupted {
+			return
+		}
+		select {
+		case <-timer.C:
+			return
+		case <-ch:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runOnce starts a service and watches it until it exits, stopping it if
+// it is asked to stop, fails too many health checks in a row or doesn't
+// pass one within its start timeout. It returns how long the service was
+// healthy, why it stopped and whether it exited cleanly.
+func (s *Supervisor) runOnce(ctx context.Context, e *entry) (time.Duration, string, bool) {
+	cmd := exec.Command(e.Command[0], e.Command[1:]...)
+	cmd.Dir = e.Dir
+	cmd.Env = s.environ(e)
+	cmd.Stdout = &prefixWriter{out: s.output, prefix: e.Name + " | "}
+	cmd.Stderr = cmd.Stdout
+	cmd.SysProcAttr = procAttr()
+
+	s.mu.Lock()
+	e.restart = false
+	err := cmd.Start()
+	if err != nil {
+		s.mu.Unlock()
+		return 0, "failed to start: " + err.Error(), false
+	}
+	e.status.PID = cmd.Process.Pid
+	var healthySince time.Time
+	if e.Health == "" {
+		healthySince = time.Now()
+		s.set(e, Running)
+	} else {
+		s.set(e, Starting)
+	}
+	s.notify()
+	s.mu.Unlock()
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	healthyFor := func() time.Duration {
+		if healthySince.IsZero() {
+			return 0
+		}
+		return time.Since(healthySince)
+	}
+
+	var checks <-chan time.Time
+	if e.Health != "" {
+		ticker := time.NewTicker(e.healthInterval)
+		defer ticker.Stop()
+		checks = ticker.C
+	}
+	startDeadline := time.NewTimer(e.startTimeout)
+	defer startDeadline.Stop()
+	failures := 0
+	for {
+		s.mu.Lock()
+		stop, ch := !e.want || e.restart, s.changed
+		s.mu.Unlock()
+		if stop || ctx.Err() != nil {
+			return healthyFor(), s.terminate(e, cmd, exited, "stopped"), false
+		}
+
+		select {
+		case err := <-exited:
+			if err == nil {
+				return healthyFor(), "exited cleanly", true
+			}
+			return healthyFor(), err.Error(), false
+		case <-ch:
+		case <-ctx.Done():
+		case <-startDeadline.C:
+			if healthySince.IsZero() {
+				return 0, s.terminate(e, cmd, exited, fmt.Sprintf("not healthy within %s", e.startTimeout)), false
+			}
+		case <-checks:
+			err := s.check(ctx, e)
+			switch {
+			case err == nil:
+				failures = 0
+				if healthySince.IsZero() {
+					healthySince = time.Now()
+					s.mu.Lock()
+					s.set(e, Running)
+					s.mu.Unlock()
+				}
+			case !healthySince.IsZero():
+				failures++
+				log.Printf("%s health check failed (%d of %d): %v", e.Name, failures, e.HealthFailures, err)
+				if failures >= e.HealthFailures {
+					return healthyFor(), s.terminate(e, cmd, exited, "unhealthy: "+err.Error()), false
+				}
+			}
+		}
+	}
+}
+
+// terminate asks a service's process to exit, killing it if it hasn't
+// within its stop timeout, and returns why it was stopped
+func (s *Supervisor) terminate(e *entry, cmd *exec.Cmd, exited <-chan error, why string) string {
+	s.mu.Lock()
+	s.set(e, Stopping)
+	s.mu.Unlock()
+
+	if err := interrupt(cmd); err != nil {
+		log.Printf("%s: %v", e.Name, err)
+	}
+	timer := time.NewTimer(e.stopTimeout)
+	defer timer.Stop()
+	select {
+	case <-exited:
+		return why
+	case <-timer.C:
+		kill(cmd)
+		<-exited
+		return fmt.Sprintf("%s, killed after %s", why, e.stopTimeout)
+	}
+}
+
+// check asks a service's health URL whether it is healthy
+func (s *Supervisor) check(ctx context.Context, e *entry) error {
+	ctx, cancel := context.WithTimeout(ctx, min(e.healthInterval, maxHealthTimeout))
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.Health, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s answered %s", e.Health, resp.Status)
+	}
+	return nil
+}
+
+// environ returns a service's environment: the supervisor's with the
+// service's own added
+func (s *Supervisor) environ(e *entry) []string {
+	env := append([]string{}, s.env...)
+	for _, k := range slices.Sorted(maps.Keys(e.Env)) {
+		env = append(env, k+"="+e.Env[k])
+	}
+	return env
+}
+
+// lineWriter writes whole lines from several services without mixing them up
+type lineWriter struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+// prefixWriter passes a service's output on to a lineWriter a line at a time
+type prefixWriter struct {
+	out    *lineWriter
+	prefix string
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		w.out.mu.Lock()
+		fmt.Fprintf(w.out.w, "%s%s\n", w.prefix, w.buf[:i])
+		w.out.mu.Unlock()
+		w.buf = w.buf[i+1:]
+	}
+}
@@ -0,0 +1,195 @@
+package supervise
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// start runs a supervisor for services until the test ends
+func start(t *testing.T, services ...*Service) *Supervisor {
+	t.Helper()
+	s := NewSupervisor(services, nil, io.Discard)
+	s.MinBackoff, s.MaxBackoff = 10*time.Millisecond, 40*time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return s
+}
+
+// service returns a checked service, failing the test if it is invalid
+func service(t *testing.T, spec Spec) *Service {
+	t.Helper()
+	s, err := New(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// waitFor waits for a service's status to satisfy ok
+func waitFor(t *testing.T, s *Supervisor, name string, ok func(Status) bool) Status {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st, err := s.Status(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok(st) {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("gave up waiting on %s, which is %+v", name, st)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func inState(state string) func(Status) bool {
+	return func(st Status) bool { return st.State == state }
+}
+
+// healthServer answers health checks with 200 while healthy is set, and 503 otherwise
+func healthServer(t *testing.T, healthy *atomic.Bool) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestDependencyOrder(t *testing.T) {
+	var healthy atomic.Bool
+	db := service(t, Spec{Name: "db", Command: []string{"sleep", "60"}, Health: healthServer(t, &healthy), HealthInterval: "10ms"})
+	app := service(t, Spec{Name: "app", Command: []string{"sleep", "60"}, DependsOn: []string{"db"}})
+	s := start(t, db, app)
+
+	waitFor(t, s, "db", inState(Starting))
+	waitFor(t, s, "app", inState(Waiting))
+	healthy.Store(true)
+	waitFor(t, s, "db", inState(Running))
+	if st := waitFor(t, s, "app", inState(Running)); st.PID == 0 {
+		t.Errorf("expected a process ID, got %+v", st)
+	}
+
+	// Stopping a dependency leaves the services that need it running
+	s.Stop("db")
+	if st := waitFor(t, s, "db", inState(Stopped)); st.PID != 0 || st.LastExit != "stopped" {
+		t.Errorf("got %+v", st)
+	}
+	if st, _ := s.Status("app"); st.State != Running {
+		t.Errorf("expected app to keep running, got %+v", st)
+	}
+	s.Start("db")
+	waitFor(t, s, "db", inState(Running))
+}
+
+func TestRestartPolicies(t *testing.T) {
+	s := start(t,
+		service(t, Spec{Name: "crashes", Command: []string{"sh", "-c", "exit 3"}}),
+		service(t, Spec{Name: "once", Command: []string{"true"}, Restart: OnFailure}),
+		service(t, Spec{Name: "never", Command: []string{"false"}, Restart: Never}),
+	)
+	st := waitFor(t, s, "crashes", func(st Status) bool { return st.Restarts >= 3 })
+	if !strings.Contains(st.LastExit, "exit status 3") {
+		t.Errorf("got %+v", st)
+	}
+	if st := waitFor(t, s, "once", inState(Exited)); st.Restarts != 0 || st.LastExit != "exited cleanly" {
+		t.Errorf("got %+v", st)
+	}
+	failed := waitFor(t, s, "never", inState(Failed))
+	if failed.Restarts != 0 {
+		t.Errorf("got %+v", failed)
+	}
+
+	// A failed service can still be started by hand
+	s.Start("never")
+	waitFor(t, s, "never", func(st Status) bool { return st.State == Failed && st.LastExitAt.After(*failed.LastExitAt) })
+}
+
+func TestUnhealthy(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	s := start(t, service(t, Spec{Name: "web", Command: []string{"sleep", "60"}, Health: healthServer(t, &healthy),
+		HealthInterval: "10ms", HealthFailures: 2}))
+
+	first := waitFor(t, s, "web", inState(Running))
+	healthy.Store(false)
+	st := waitFor(t, s, "web", func(st Status) bool { return st.Restarts > 0 })
+	if !strings.HasPrefix(st.LastExit, "unhealthy") {
+		t.Errorf("expected the service to be restarted for failing its checks, got %+v", st)
+	}
+	healthy.Store(true)
+	if st := waitFor(t, s, "web", inState(Running)); st.PID == first.PID {
+		t.Errorf("expected a new process, got %+v", st)
+	}
+}
+
+func TestStartTimeout(t *testing.T) {
+	var healthy atomic.Bool
+	s := start(t, service(t, Spec{Name: "slow", Command: []string{"sleep", "60"}, Health: healthServer(t, &healthy),
+		HealthInterval: "10ms", StartTimeout: "50ms"}))
+	st := waitFor(t, s, "slow", func(st Status) bool { return st.LastExit != "" })
+	if st.LastExit != "not healthy within 50ms" {
+		t.Errorf("got %+v", st)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	s := start(t, service(t, Spec{Name: "app", Command: []string{"sleep", "60"}, StopTimeout: "50ms"}))
+	first := waitFor(t, s, "app", inState(Running))
+	if err := s.Restart("app"); err != nil {
+		t.Fatal(err)
+	}
+	st := waitFor(t, s, "app", func(st Status) bool { return st.State == Running && st.PID != first.PID })
+	if st.Restarts != 1 || st.LastExit != "stopped" {
+		t.Errorf("got %+v", st)
+	}
+	if err := s.Restart("missing"); err == nil {
+		t.Error("expected an unknown service to be refused")
+	}
+}
+
+func TestStopKills(t *testing.T) {
+	// The shell ignores SIGTERM, so it has to be killed
+	s := start(t, service(t, Spec{Name: "stubborn", Command: []string{"sh", "-c", "trap '' TERM; while :; do sleep 0.01; done"}, StopTimeout: "50ms"}))
+	waitFor(t, s, "stubborn", inState(Running))
+	time.Sleep(50 * time.Millisecond) // for the trap to be set
+	s.Stop("stubborn")
+	if st := waitFor(t, s, "stubborn", inState(Stopped)); !strings.Contains(st.LastExit, "killed after 50ms") {
+		t.Errorf("got %+v", st)
+	}
+}
+
+func TestOutput(t *testing.T) {
+	var out strings.Builder
+	s := NewSupervisor([]*Service{service(t, Spec{Name: "hello", Command: []string{"sh", "-c", "echo hi; echo there >&2; echo $GREETING"},
+		Env: map[string]string{"GREETING": "hey"}, Restart: Never})}, nil, &out)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	waitFor(t, s, "hello", inState(Exited))
+	cancel()
+	<-done
+	if got := out.String(); got != "hello | hi\nhello | there\nhello | hey\n" {
+		t.Errorf("got %q", got)
+	}
+}
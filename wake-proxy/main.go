@@ -0,0 +1,186 @@
+// Command wake-proxy lets machines such as a NAS sleep while still being
+// there when something needs them. It listens on a port for each service on
+// each machine, and when a connection arrives and the machine doesn't
+// answer, it sends a Wake-on-LAN magic packet, waits for the machine to come
+// up and then forwards the connection, with whatever the client had sent
+// meanwhile. Clients just see a slow first connection.
+//
+// MACHINES_FILE is a JSON list of machines, each with a name, its mac, the
+// broadcast address for the magic packet (default 255.255.255.255:9), the
+// probe address that answers once it is up (default its first target), how
+// long to wait for it as wake_timeout (default 2m) and the ports to forward:
+//
+//	[{"name": "nas", "mac": "aa:bb:cc:dd:ee:ff", "broadcast": "192.168.1.255:9",
+//	  "forward": [{"listen": ":8445", "target": "nas.lan:445"},
+//	              {"listen": ":5001", "target": "nas.lan:5001"}]}]
+//
+// Point clients at this machine's ports instead of the NAS's, or register a
+// forwarded port with the gateway so requests through it wake the NAS too.
+// Connections through the proxy keep the machine busy, so its own idle
+// timer only starts once they close.
+//
+// GET /api/v1/machines lists each machine with whether it is waking, when it
+// was last reached and woken, and its open connections. POST
+// /api/v1/machines/NAME/wake wakes one ahead of time, answering 202 at once,
+// or with ?wait=true, 200 once it is up or 504 if it doesn't wake in time.
+//
+// Otherwise the API serves as package httpserver describes, on LISTEN_ADDR
+// (default :8096) with WAKE_TOKEN as its token, and registers with the
+// gateway as wake by default; the forwarded ports take no token. Signing
+// with a wallet key lets the gateway and shutdown-service wake machines
+// without holding WAKE_TOKEN. Stopping it closes the forwarded ports.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/oksmith/home-server/pkg/config"
+	"github.com/oksmith/home-server/pkg/httpserver"
+	"github.com/oksmith/home-server/pkg/registry"
+	"github.com/oksmith/home-server/pkg/sigauth"
+	"github.com/oksmith/home-server/wake-proxy/wake"
+)
+
+// settings are the service's settings
+var settings = []config.Field{
+	{Name: "MACHINES_FILE", Required: true},
+	{Name: "LISTEN_ADDR", Default: ":8096", Check: config.HostPort},
+	{Name: "WAKE_TOKEN", Secret: true, Reload: true},
+	{Name: "TLS_CERT"},
+	{Name: "TLS_KEY"},
+	{Name: "GATEWAY_URL", Check: config.HTTPURL},
+	{Name: "GATEWAY_REGISTRY_TOKEN", Secret: true},
+	{Name: "GATEWAY_NAME", Default: "wake"},
+	{Name: "GATEWAY_SERVICE_URL", Check: config.HTTPURL},
+	{Name: "AUTHORIZED_KEYS"},
+	{Name: "SERVICE_KEY"},
+}
+
+func main() {
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"), settings...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	filename := cfg.Get("MACHINES_FILE")
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	machines, err := wake.Parse(data)
+	if err != nil {
+		log.Fatalf("%s: %v", filename, err)
+	}
+	addr := cfg.Get("LISTEN_ADDR")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go cfg.Watch(ctx, config.DefaultPoll)
+	byName := map[string]*wake.Machine{}
+	for _, m := range machines {
+		byName[m.Name] = m
+		for _, f := range m.Forwards {
+			ln, err := net.Listen("tcp", f.Listen)
+			if err != nil {
+				log.Fatalf("%s: %v", m.Name, err)
+			}
+			go func() {
+				<-ctx.Done()
+				ln.Close()
+			}()
+			go func() {
+				if err := m.Serve(ctx, ln, f.Target); err != nil {
+					log.Fatalf("%s: %v", m.Name, err)
+				}
+			}()
+			log.Printf("forwarding %s to %s on %s", f.Listen, f.Target, m.Name)
+		}
+	}
+
+	keys, err := sigauth.LoadKeyring(cfg.Get("AUTHORIZED_KEYS"))
+	if err != nil {
+		log.Fatalf("AUTHORIZED_KEYS: %v", err)
+	}
+	signer, err := sigauth.LoadSigner(cfg.Get("SERVICE_KEY"))
+	if err != nil {
+		log.Fatalf("SERVICE_KEY: %v", err)
+	}
+
+	token := func() string { return cfg.Get("WAKE_TOKEN") }
+	g := httpserver.NewGuard(httpserver.DefaultLimits)
+	auth := func(next http.HandlerFunc) http.Handler {
+		return httpserver.RequireAuth("wake-proxy", token, keys, g, next)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.Handle("GET /api/v1/machines", auth(func(w http.ResponseWriter, r *http.Request) {
+		statuses := make([]wake.Status, 0, len(machines))
+		for _, m := range machines {
+			statuses = append(statuses, m.Status())
+		}
+		httpserver.WriteJSON(w, http.StatusOK, statuses)
+	}))
+	mux.Handle("POST /api/v1/machines/{name}/wake", auth(func(w http.ResponseWriter, r *http.Request) {
+		m, ok := byName[r.PathValue("name")]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown machine %q", r.PathValue("name")), http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("wait") != "true" {
+			go m.Wake(context.WithoutCancel(r.Context()))
+			httpserver.WriteJSON(w, http.StatusAccepted, m.Status())
+			return
+		}
+		if err := m.Wake(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusGatewayTimeout)
+			return
+		}
+		httpserver.WriteJSON(w, http.StatusOK, m.Status())
+	}))
+	metrics := httpserver.NewMetrics()
+	server := &http.Server{Addr: addr, Handler: g.Middleware(httpserver.InstrumentMux(metrics, slog.Default(), mux))}
+
+	certFile, keyFile := cfg.Get("TLS_CERT"), cfg.Get("TLS_KEY")
+	switch {
+	case certFile == "" && keyFile == "":
+		log.Printf("wake-proxy starting on %s", addr)
+	case certFile == "" || keyFile == "":
+		log.Fatal("TLS_CERT and TLS_KEY must be set together")
+	default:
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		log.Printf("wake-proxy starting on %s with TLS", addr)
+	}
+
+	var withdrawn chan struct{}
+	if gateway := cfg.Get("GATEWAY_URL"); gateway != "" {
+		s, err := registry.Local(cfg.Get("GATEWAY_NAME"), cfg.Get("GATEWAY_SERVICE_URL"), addr, server.TLSConfig != nil)
+		if err != nil {
+			log.Fatalf("GATEWAY_URL: %v", err)
+		}
+		withdrawn = make(chan struct{})
+		go func() {
+			registry.Announce(ctx, gateway, cfg.Get("GATEWAY_REGISTRY_TOKEN"), signer, func() registry.Service {
+				s.Token = token()
+				return s
+			}, registry.DefaultTTL/3)
+			close(withdrawn)
+		}()
+	}
+	if err := httpserver.ListenAndServe(ctx, server, certFile, keyFile); err != nil {
+		log.Fatal(err)
+	}
+	if withdrawn != nil {
+		<-withdrawn
+	}
+	log.Println("wake-proxy stopped")
+}
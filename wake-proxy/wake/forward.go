@@ -0,0 +1,66 @@
+package wake
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+)
+
+// Serve accepts connections on ln and forwards them to target on the
+// machine until ln is closed. A connection that arrives while the machine
+// sleeps is held while it wakes, and whatever the client has sent by then,
+// such as an HTTP request, is passed on once it is up.
+func (m *Machine) Serve(ctx context.Context, ln net.Listener, target string) error {
+	for {
+		client, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go m.forward(ctx, client, target)
+	}
+}
+
+func (m *Machine) forward(ctx context.Context, client net.Conn, target string) {
+	m.mu.Lock()
+	m.connections++
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.connections--
+		m.mu.Unlock()
+	}()
+	defer client.Close()
+
+	upstream, err := m.Dial(ctx, target)
+	if err != nil {
+		log.Printf("%s: can't forward %s to %s: %v", m.Name, client.RemoteAddr(), target, err)
+		return
+	}
+	defer upstream.Close()
+	splice(client, upstream)
+}
+
+// splice copies both ways until both sides are done, passing on each side's
+// end of input as a half close so protocols that rely on it still work
+func splice(a, b net.Conn) {
+	var wg sync.WaitGroup
+	copyHalf := func(dst, src net.Conn) {
+		defer wg.Done()
+		io.Copy(dst, src)
+		if c, ok := dst.(interface{ CloseWrite() error }); ok {
+			c.CloseWrite()
+		} else {
+			dst.Close()
+		}
+	}
+	wg.Add(2)
+	go copyHalf(a, b)
+	go copyHalf(b, a)
+	wg.Wait()
+}
@@ -0,0 +1,253 @@
+// Package wake forwards connections to machines that may be asleep, waking
+// them with a Wake-on-LAN packet when they don't answer and holding each
+// connection until they do
+package wake
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oksmith/home-server/pkg/wol"
+)
+
+// Defaults for a machine's settings
+const (
+	DefaultTimeout = 2 * time.Minute
+	// quickDial bounds the first try at reaching a machine that may be
+	// asleep, which on a LAN fails slowly as ARP goes unanswered
+	quickDial = 2 * time.Second
+	// pollEvery is how often a waking machine is checked
+	pollEvery = time.Second
+	// resendEvery repeats the magic packet in case one is lost
+	resendEvery = 15 * time.Second
+)
+
+// Forward passes connections to Listen on to Target
+type Forward struct {
+	Listen string `json:"listen"` // such as :8445
+	Target string `json:"target"` // host:port on the machine
+}
+
+// Machine is a machine that can be woken, with the ports forwarded to it
+type Machine struct {
+	Name      string        `json:"name"`
+	MAC       string        `json:"mac"`
+	Broadcast string        `json:"broadcast,omitempty"` // default wol.DefaultBroadcast
+	Probe     string        `json:"probe,omitempty"`     // host:port that answers once it is up, default the first target
+	Timeout   time.Duration `json:"-"`                   // how long to wait for it, default DefaultTimeout
+	Forwards  []Forward     `json:"forward"`
+
+	send func(mac, addr string) error
+	dial func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	mu          sync.Mutex
+	waking      chan struct{} // closed when the wake in progress ends
+	wakeErr     error         // how the last wake ended
+	lastUp      time.Time
+	lastWake    time.Time
+	wakes       int
+	connections int
+}
+
+// Parse reads a JSON list of machines, such as
+//
+//	[{"name": "nas", "mac": "aa:bb:cc:dd:ee:ff", "broadcast": "192.168.1.255:9",
+//	  "wake_timeout": "3m", "forward": [{"listen": ":8445", "target": "nas.lan:445"}]}]
+func Parse(data []byte) ([]*Machine, error) {
+	var list []struct {
+		Machine
+		WakeTimeout string `json:"wake_timeout"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	var machines []*Machine
+	seen := map[string]bool{}
+	listens := map[string]string{}
+	for i := range list {
+		entry := &list[i]
+		m := &entry.Machine
+		if m.Name == "" || strings.Contains(m.Name, "/") {
+			return nil, fmt.Errorf("machine %q needs a name without slashes", m.Name)
+		}
+		if seen[m.Name] {
+			return nil, fmt.Errorf("machine %s is listed twice", m.Name)
+		}
+		seen[m.Name] = true
+		if _, err := net.ParseMAC(m.MAC); err != nil {
+			return nil, fmt.Errorf("machine %s: %w", m.Name, err)
+		}
+		if len(m.Forwards) == 0 {
+			return nil, fmt.Errorf("machine %s has nothing to forward", m.Name)
+		}
+		for _, f := range m.Forwards {
+			if _, _, err := net.SplitHostPort(f.Target); err != nil {
+				return nil, fmt.Errorf("machine %s: target %w", m.Name, err)
+			}
+			if _, _, err := net.SplitHostPort(f.Listen); err != nil {
+				return nil, fmt.Errorf("machine %s: listen %w", m.Name, err)
+			}
+			if other, dup := listens[f.Listen]; dup {
+				return nil, fmt.Errorf("machine %s: %s is already forwarded for %s", m.Name, f.Listen, other)
+			}
+			listens[f.Listen] = m.Name
+		}
+		if m.Broadcast == "" {
+			m.Broadcast = wol.DefaultBroadcast
+		}
+		if m.Probe == "" {
+			m.Probe = m.Forwards[0].Target
+		}
+		m.Timeout = DefaultTimeout
+		if entry.WakeTimeout != "" {
+			d, err := time.ParseDuration(entry.WakeTimeout)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("machine %s: wake_timeout must be a positive duration such as 2m, not %q", m.Name, entry.WakeTimeout)
+			}
+			m.Timeout = d
+		}
+		machines = append(machines, m)
+	}
+	return machines, nil
+}
+
+// Dial connects to addr on the machine, waking it first if it doesn't answer
+func (m *Machine) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	quick, cancel := context.WithTimeout(ctx, quickDial)
+	conn, err := m.dialer()(quick, "tcp", addr)
+	cancel()
+	if err == nil {
+		m.sawUp()
+		return conn, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	log.Printf("%s isn't answering on %s: %v", m.Name, addr, err)
+	if err := m.Wake(ctx); err != nil {
+		return nil, err
+	}
+	conn, err = m.dialer()(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("%s woke, but %s: %w", m.Name, addr, err)
+	}
+	return conn, nil
+}
+
+// Wake wakes the machine and waits until its probe port answers, joining a
+// wake already in progress. The wake carries on if ctx ends first, so other
+// connections waiting on it aren't let down.
+func (m *Machine) Wake(ctx context.Context) error {
+	m.mu.Lock()
+	if m.waking == nil {
+		m.waking = make(chan struct{})
+		m.lastWake = time.Now()
+		m.wakes++
+		go m.wake(m.waking)
+	}
+	waking := m.waking
+	m.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-waking:
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.wakeErr
+}
+
+// wake sends magic packets and polls the probe port until it answers or the
+// timeout passes, then closes done
+func (m *Machine) wake(done chan struct{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeout)
+	defer cancel()
+	send := m.send
+	if send == nil {
+		send = wol.Send
+	}
+	log.Printf("waking %s", m.Name)
+	started := time.Now()
+	var err error
+	var lastSent time.Time
+	for {
+		if time.Since(lastSent) >= resendEvery {
+			if sendErr := send(m.MAC, m.Broadcast); sendErr != nil {
+				log.Printf("%s: %v", m.Name, sendErr)
+			}
+			lastSent = time.Now()
+		}
+		tried := time.Now()
+		probe, cancelProbe := context.WithTimeout(ctx, pollEvery)
+		conn, dialErr := m.dialer()(probe, "tcp", m.Probe)
+		cancelProbe()
+		if dialErr == nil {
+			conn.Close()
+			log.Printf("%s is up after %s", m.Name, time.Since(started).Round(time.Second))
+			break
+		}
+		// A refused connection fails at once, so wait out the interval
+		select {
+		case <-ctx.Done():
+		case <-time.After(pollEvery - time.Since(tried)):
+		}
+		if ctx.Err() != nil {
+			err = fmt.Errorf("%s didn't wake within %s", m.Name, m.Timeout)
+			log.Print(err)
+			break
+		}
+	}
+
+	m.mu.Lock()
+	m.wakeErr = err
+	if err == nil {
+		m.lastUp = time.Now()
+	}
+	m.waking = nil
+	m.mu.Unlock()
+	close(done)
+}
+
+func (m *Machine) dialer() func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if m.dial != nil {
+		return m.dial
+	}
+	var d net.Dialer
+	return d.DialContext
+}
+
+func (m *Machine) sawUp() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastUp = time.Now()
+}
+
+// Status describes a machine for the API
+type Status struct {
+	Name        string    `json:"name"`
+	Waking      bool      `json:"waking"`
+	LastUp      time.Time `json:"last_up,omitzero"`   // when a connection last reached it
+	LastWake    time.Time `json:"last_wake,omitzero"` // when it was last woken
+	Wakes       int       `json:"wakes"`
+	Connections int       `json:"connections"` // open through the proxy
+	Error       string    `json:"error,omitempty"`
+	Forwards    []Forward `json:"forward"`
+}
+
+func (m *Machine) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := Status{Name: m.Name, Waking: m.waking != nil, LastUp: m.lastUp, LastWake: m.lastWake,
+		Wakes: m.wakes, Connections: m.connections, Forwards: m.Forwards}
+	if m.wakeErr != nil {
+		s.Error = m.wakeErr.Error()
+	}
+	return s
+}
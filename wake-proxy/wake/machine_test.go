@@ -0,0 +1,193 @@
+package wake
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	machines, err := Parse([]byte(`[
+		{"name": "nas", "mac": "aa:bb:cc:dd:ee:ff", "wake_timeout": "3m",
+		 "forward": [{"listen": ":8445", "target": "nas.lan:445"}, {"listen": ":5000", "target": "nas.lan:5000"}]},
+		{"name": "desktop", "mac": "11:22:33:44:55:66", "broadcast": "192.168.1.255:9", "probe": "desktop.lan:22",
+		 "forward": [{"listen": "127.0.0.1:3389", "target": "desktop.lan:3389"}]}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nas, desktop := machines[0], machines[1]
+	if nas.Probe != "nas.lan:445" || nas.Broadcast != "255.255.255.255:9" || nas.Timeout != 3*time.Minute {
+		t.Errorf("nas = %+v", nas)
+	}
+	if desktop.Probe != "desktop.lan:22" || desktop.Timeout != DefaultTimeout {
+		t.Errorf("desktop = %+v", desktop)
+	}
+
+	for _, bad := range []string{
+		`[{"name": "", "mac": "aa:bb:cc:dd:ee:ff", "forward": [{"listen": ":1", "target": "a:1"}]}]`,
+		`[{"name": "a", "mac": "nope", "forward": [{"listen": ":1", "target": "a:1"}]}]`,
+		`[{"name": "a", "mac": "aa:bb:cc:dd:ee:ff"}]`,
+		`[{"name": "a", "mac": "aa:bb:cc:dd:ee:ff", "forward": [{"listen": ":1", "target": "a"}]}]`,
+		`[{"name": "a", "mac": "aa:bb:cc:dd:ee:ff", "wake_timeout": "soon", "forward": [{"listen": ":1", "target": "a:1"}]}]`,
+		`[{"name": "a", "mac": "aa:bb:cc:dd:ee:ff", "forward": [{"listen": ":1", "target": "a:1"}]},
+		  {"name": "b", "mac": "aa:bb:cc:dd:ee:ff", "forward": [{"listen": ":1", "target": "b:1"}]}]`,
+	} {
+		if _, err := Parse([]byte(bad)); err == nil {
+			t.Errorf("Parse(%s) succeeded", bad)
+		}
+	}
+}
+
+// sleeper is a machine whose port only opens once a magic packet arrives
+type sleeper struct {
+	addr  string
+	sent  atomic.Int32
+	mu    sync.Mutex
+	ln    net.Listener
+	awake bool
+}
+
+func newSleeper(t *testing.T) *sleeper {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &sleeper{addr: ln.Addr().String()}
+	ln.Close()
+	t.Cleanup(func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.ln != nil {
+			s.ln.Close()
+		}
+	})
+	return s
+}
+
+// send wakes the machine shortly after, to echo lines back in upper case
+func (s *sleeper) send(mac, addr string) error {
+	s.sent.Add(1)
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		s.wakeUp()
+	}()
+	return nil
+}
+
+func (s *sleeper) wakeUp() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.awake {
+		return
+	}
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		panic(err)
+	}
+	s.ln, s.awake = ln, true
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				line, _ := bufio.NewReader(c).ReadString('\n')
+				io.WriteString(c, strings.ToUpper(line))
+			}()
+		}
+	}()
+}
+
+// proxy serves m's first forward on a local port, returning its address
+func proxy(t *testing.T, m *Machine) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go m.Serve(context.Background(), ln, m.Forwards[0].Target)
+	return ln.Addr().String()
+}
+
+// roundTrip sends a line through the proxy and returns the answer
+func roundTrip(addr, line string) (string, error) {
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := io.WriteString(c, line+"\n"); err != nil {
+		return "", err
+	}
+	answer, err := bufio.NewReader(c).ReadString('\n')
+	return strings.TrimSpace(answer), err
+}
+
+func TestForwardWakesMachine(t *testing.T) {
+	s := newSleeper(t)
+	m := &Machine{Name: "nas", MAC: "aa:bb:cc:dd:ee:ff", Probe: s.addr, Timeout: 10 * time.Second,
+		Forwards: []Forward{{Target: s.addr}}, send: s.send}
+	addr := proxy(t, m)
+
+	// Several clients arrive while it sleeps; one wake serves them all
+	var wg sync.WaitGroup
+	for i := range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := roundTrip(addr, "hello")
+			if err != nil || got != "HELLO" {
+				t.Errorf("client %d got %q, %v", i, got, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := s.sent.Load(); n != 1 {
+		t.Errorf("sent %d magic packets, want 1", n)
+	}
+
+	// Once awake, connections go straight through
+	if got, err := roundTrip(addr, "again"); err != nil || got != "AGAIN" {
+		t.Errorf("got %q, %v", got, err)
+	}
+	st := m.Status()
+	if st.Wakes != 1 || st.Waking || st.LastUp.IsZero() || st.Error != "" || s.sent.Load() != 1 {
+		t.Errorf("status %+v after %d packets", st, s.sent.Load())
+	}
+}
+
+func TestWakeTimesOut(t *testing.T) {
+	s := newSleeper(t)
+	var sent atomic.Int32
+	m := &Machine{Name: "nas", MAC: "aa:bb:cc:dd:ee:ff", Probe: s.addr, Timeout: 1500 * time.Millisecond,
+		Forwards: []Forward{{Target: s.addr}},
+		send:     func(mac, addr string) error { sent.Add(1); return nil }}
+
+	_, err := m.Dial(context.Background(), s.addr)
+	if err == nil || !strings.Contains(err.Error(), "didn't wake") {
+		t.Fatalf("Dial = %v", err)
+	}
+	if st := m.Status(); st.Error == "" || st.Waking || sent.Load() != 1 {
+		t.Errorf("status %+v after %d packets", st, sent.Load())
+	}
+
+	// A caller that gives up doesn't stop the wake for others
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := m.Wake(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Wake = %v", err)
+	}
+	if !m.Status().Waking {
+		t.Error("wake stopped with its first caller")
+	}
+}